@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// initialReadLimit bounds how much of an existing file is read on startup to
+// find its last lines.
+const initialReadLimit = 64 << 10
+
+// viewerQueueSize is how many lines may wait for a slow viewer before further
+// lines are skipped for it.
+const viewerQueueSize = 256
+
+// follower polls one file for appended lines and fans them out to viewers. It
+// reopens the file when it is rotated and starts over when it is truncated.
+type follower struct {
+	path     string
+	backlog  int
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	recent  []string
+	viewers map[*viewer]struct{}
+	state   string
+}
+
+// viewer is one connected session's subscription.
+type viewer struct {
+	lines   chan string
+	skipped atomic.Int64
+}
+
+func newFollower(path string, backlog int, interval time.Duration, logger *slog.Logger) *follower {
+	return &follower{
+		path:     path,
+		backlog:  backlog,
+		interval: interval,
+		logger:   logger,
+		viewers:  make(map[*viewer]struct{}),
+		state:    "starting",
+	}
+}
+
+// Subscribe returns the most recent lines and a viewer receiving every line
+// after them. Call Unsubscribe when done.
+func (f *follower) Subscribe() ([]string, *viewer) {
+	v := &viewer{lines: make(chan string, viewerQueueSize)}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.viewers[v] = struct{}{}
+	return append([]string(nil), f.recent...), v
+}
+
+func (f *follower) Unsubscribe(v *viewer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.viewers, v)
+}
+
+// Status describes the file and its audience for the status line.
+func (f *follower) Status() (state string, viewers int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state, len(f.viewers)
+}
+
+// Run follows the file until ctx is cancelled.
+func (f *follower) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	var (
+		file    *os.File
+		offset  int64
+		partial []byte
+		opened  bool
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	for {
+		if file == nil {
+			var err error
+			partial = nil
+			if file, offset, err = f.open(opened, &partial); err != nil {
+				f.setState(fmt.Sprintf("waiting for file: %v", err))
+			} else {
+				opened = true
+				f.setState("following")
+			}
+		} else {
+			switch current, err := os.Stat(f.path); {
+			case err != nil, !sameFile(file, current):
+				// Rotated away: finish the old file, then pick up the new one.
+				f.readFrom(file, &partial)
+				file.Close()
+				file = nil
+				f.publish("-- file rotated --")
+				continue
+			case current.Size() < offset:
+				f.publish("-- file truncated --")
+				offset, partial = 0, nil
+				if _, err := file.Seek(0, io.SeekStart); err != nil {
+					file.Close()
+					file = nil
+					continue
+				}
+			}
+			offset += f.readFrom(file, &partial)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// open opens the file and publishes its lines: only the last ones on startup,
+// when the file may be large, but all of them for a file that replaced a
+// rotated one. It returns the offset read up to.
+func (f *follower) open(rotated bool, partial *[]byte) (*os.File, int64, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var start int64
+	if info, err := file.Stat(); err == nil && !rotated && info.Size() > initialReadLimit {
+		start = info.Size() - initialReadLimit
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	offset := start + int64(len(data))
+	if start > 0 {
+		// The seek most likely landed mid-line; drop the cut-off start.
+		_, data, _ = bytes.Cut(data, []byte("\n"))
+	}
+	f.publishLines(data, partial)
+	return file, offset, nil
+}
+
+// readFrom publishes the lines appended to file since the last read. It
+// returns the number of bytes read.
+func (f *follower) readFrom(file *os.File, partial *[]byte) int64 {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		f.logger.Warn("logtail: read failed", "path", f.path, "err", err)
+	}
+	f.publishLines(data, partial)
+	return int64(len(data))
+}
+
+// publishLines publishes every complete line in data, continuing the partial
+// line left by the previous read, and keeps a new trailing partial line.
+func (f *follower) publishLines(data []byte, partial *[]byte) {
+	buf := append(*partial, data...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		f.publish(string(buf[:i]))
+		buf = buf[i+1:]
+	}
+	*partial = append([]byte(nil), buf...)
+}
+
+// publish records line in the backlog and queues it for every viewer,
+// skipping viewers whose queue is full.
+func (f *follower) publish(line string) {
+	line = sanitize(line)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recent = append(f.recent, line)
+	if len(f.recent) > f.backlog {
+		f.recent = f.recent[len(f.recent)-f.backlog:]
+	}
+	for v := range f.viewers {
+		select {
+		case v.lines <- line:
+		default:
+			v.skipped.Add(1)
+		}
+	}
+}
+
+func (f *follower) setState(state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state != state {
+		f.logger.Info("logtail: "+state, "path", f.path)
+		f.state = state
+	}
+}
+
+func sameFile(file *os.File, current os.FileInfo) bool {
+	info, err := file.Stat()
+	return err == nil && os.SameFile(info, current)
+}
+
+// csiSequence matches terminal escapes such as the colors of colored loggers.
+var csiSequence = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]`)
+
+// sanitize expands tabs and drops terminal escapes and other control
+// characters, so log content cannot move the cursor or redraw the status line.
+func sanitize(line string) string {
+	line = csiSequence.ReplaceAllString(strings.TrimSuffix(line, "\r"), "")
+	line = strings.ReplaceAll(line, "\t", "    ")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, line)
+}
@@ -0,0 +1,80 @@
+// Command logtail serves a log file over SSH: everyone who connects sees its
+// last lines and then follows new ones beneath a status line, like tail -f.
+//
+// It is an example of a SessionHandler other than the chat: the SSH listener,
+// authentication, and exit reporting come from pkg/sshserver and the screen
+// from pkg/tui, exactly as schat uses them.
+//
+//	go run ./cmd/examples/logtail -file /var/log/syslog
+//	ssh -p 2223 anyone@localhost
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+func main() {
+	addr := flag.String("addr", ":2223", "TCP address for the SSH server")
+	file := flag.String("file", "", "Log file to serve (required)")
+	backlog := flag.Int("lines", 20, "Number of existing lines shown on connect")
+	poll := flag.Duration("poll", 500*time.Millisecond, "How often the file is checked for new lines")
+	hostKey := flag.String("host-key", "", "SSH host key path, generated if missing (empty uses a temporary key)")
+	authorizedKeys := flag.String("authorized-keys", "", "OpenSSH authorized_keys file restricting who may connect (empty allows anyone)")
+	flag.Parse()
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	signer, err := loadHostKey(*hostKey)
+	if err != nil {
+		log.Fatalf("host key: %v", err)
+	}
+	auth := sshserver.NoAuth()
+	if *authorizedKeys != "" {
+		keys, err := sshserver.LoadAuthorizedKeys(*authorizedKeys)
+		if err != nil {
+			log.Fatalf("authorized keys: %v", err)
+		}
+		auth = keys
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	tail := newFollower(*file, *backlog, *poll, logger)
+	go tail.Run(ctx)
+
+	server := sshserver.New(*addr, signer, logger, sshserver.WithAuthenticators(auth))
+	err = server.ListenAndServe(ctx, func(ctx context.Context, conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) error {
+		return serveViewer(ctx, tail, conn, channel, requests)
+	})
+	// The viewers' sessions end with ctx; let them send an exit status.
+	drainCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	_ = server.Drain(drainCtx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("server stopped: %v", err)
+	}
+}
+
+func loadHostKey(path string) (ssh.Signer, error) {
+	if path == "" {
+		return sshserver.EphemeralSigner()
+	}
+	return sshserver.LoadOrGenerateSigner(path)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// statusRefresh is how often the status line picks up new viewer counts.
+const statusRefresh = time.Second
+
+var errNoShell = errors.New("client closed the session before requesting a shell")
+
+// serveViewer streams the followed file to one SSH session until the viewer
+// presses q, Ctrl+C, or Ctrl+D, disconnects, or ctx is done.
+func serveViewer(ctx context.Context, tail *follower, conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) error {
+	screen := tui.NewScreen(channel, tui.WithPrompt(""))
+	if !awaitShell(screen, requests) {
+		return sshserver.Exit(sshserver.ExitClientGone, errNoShell)
+	}
+	go func() {
+		for req := range requests {
+			handleRequest(screen, req)
+		}
+	}()
+
+	// Buffered so the reader can exit after the session has returned.
+	quit := make(chan error, 1)
+	go readKeys(channel, quit)
+
+	recent, v := tail.Subscribe()
+	defer tail.Unsubscribe(v)
+
+	if err := screen.ClearScreen(); err != nil {
+		return sshserver.Exit(sshserver.ExitClientGone, err)
+	}
+	for _, line := range recent {
+		if err := screen.DisplayMessage(line, status(tail, v), ""); err != nil {
+			return sshserver.Exit(sshserver.ExitClientGone, err)
+		}
+	}
+
+	ticker := time.NewTicker(statusRefresh)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case line := <-v.lines:
+			err = screen.DisplayMessage(line, status(tail, v), "")
+		case <-ticker.C:
+			err = screen.UpdatePrompt(status(tail, v), "")
+		case err := <-quit:
+			if err != nil {
+				return sshserver.Exit(sshserver.ExitClientGone, err)
+			}
+			return nil
+		case <-ctx.Done():
+			return sshserver.ContextExit(ctx)
+		}
+		if err != nil {
+			return sshserver.Exit(sshserver.ExitClientGone, err)
+		}
+	}
+}
+
+// awaitShell serves requests until the client asks for a shell, and reports
+// whether it did. One-shot commands are refused: there is nothing to run.
+func awaitShell(screen *tui.Screen, requests <-chan *ssh.Request) bool {
+	for req := range requests {
+		if handleRequest(screen, req) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleRequest answers one channel request and reports whether it started
+// the shell.
+func handleRequest(screen *tui.Screen, req *ssh.Request) bool {
+	switch {
+	case screen.Resize(req), req.Type == "env":
+		req.Reply(true, nil)
+	case req.Type == "shell":
+		req.Reply(true, nil)
+		return true
+	default:
+		req.Reply(false, nil)
+	}
+	return false
+}
+
+// readKeys reports nil on quit when the viewer presses q, Ctrl+C, or Ctrl+D,
+// or the read error once the client goes away. Other input is ignored.
+func readKeys(channel ssh.Channel, quit chan<- error) {
+	buf := make([]byte, 64)
+	for {
+		n, err := channel.Read(buf)
+		for _, b := range buf[:n] {
+			if b == 'q' || b == 0x03 || b == 0x04 {
+				quit <- nil
+				return
+			}
+		}
+		if err != nil {
+			quit <- err
+			return
+		}
+	}
+}
+
+// status renders the status line for v.
+func status(tail *follower, v *viewer) string {
+	state, viewers := tail.Status()
+	line := fmt.Sprintf("%s | %s | %d watching", tail.path, state, viewers)
+	if skipped := v.skipped.Load(); skipped > 0 {
+		line += fmt.Sprintf(" | %d lines skipped", skipped)
+	}
+	return line + " | q to quit"
+}
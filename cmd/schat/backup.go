@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/backup"
+	"github.com/ledzpl/schat/pkg/config"
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+// backupFlags are the flags shared by backup and restore.
+type backupFlags struct {
+	config        *string
+	dataDir       *string
+	passphraseEnv *string
+}
+
+func registerBackupFlags(fs *flag.FlagSet) backupFlags {
+	return backupFlags{
+		config:        fs.String("config", "", "Config file naming the data_dir"),
+		dataDir:       fs.String("data-dir", "", "Data directory (overrides the config file)"),
+		passphraseEnv: fs.String("passphrase-env", "", "Environment variable or secret reference holding the passphrase the backup is encrypted with (empty: not encrypted)"),
+	}
+}
+
+// load resolves the data directory, which only needDir requires, and the
+// passphrase.
+func (f backupFlags) load(needDir bool) (config.Config, []byte, error) {
+	cfg := config.Default()
+	if *f.config != "" {
+		if err := cfg.LoadFile(*f.config); err != nil {
+			return cfg, nil, err
+		}
+	}
+	if *f.dataDir != "" {
+		cfg.DataDir = *f.dataDir
+	}
+	if needDir && cfg.DataDir == "" {
+		return cfg, nil, errors.New("no data directory; set data_dir in -config or pass -data-dir")
+	}
+	cfg.ApplyDataDir()
+	if *f.passphraseEnv == "" {
+		return cfg, nil, nil
+	}
+	ctx := context.Background()
+	res, err := newSecrets(ctx, cfg.Secrets)
+	if err != nil {
+		return cfg, nil, err
+	}
+	passphrase, err := res.Resolve(ctx, *f.passphraseEnv)
+	if err != nil {
+		return cfg, nil, err
+	}
+	if passphrase == "" {
+		return cfg, nil, fmt.Errorf("%s is empty", *f.passphraseEnv)
+	}
+	return cfg, []byte(passphrase), nil
+}
+
+// runBackup writes the data directory to a single, optionally encrypted,
+// file while the server keeps running.
+func runBackup(args []string) int {
+	fs := flag.NewFlagSet("schat backup", flag.ContinueOnError)
+	flags := registerBackupFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: schat backup [-config file] [-data-dir dir] [-passphrase-env VAR] <file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	cfg, passphrase, err := flags.load(true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schat backup:", err)
+		return 2
+	}
+	if err := writeBackup(cfg, passphrase, fs.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, "schat backup:", err)
+		return 1
+	}
+	return 0
+}
+
+func writeBackup(cfg config.Config, passphrase []byte, out string) error {
+	dir := cfg.DataDir
+	if inside(dir, out) {
+		return fmt.Errorf("write the backup outside the data directory %s", dir)
+	}
+	opts := []backup.Option{backup.WithPassphrase(passphrase)}
+	if cfg.DB != "" && inside(dir, cfg.DB) {
+		rel, _ := filepath.Rel(filepath.Clean(dir), filepath.Clean(cfg.DB))
+		opts = append(opts, backup.WithSnapshot(rel, func(dst string) error {
+			return store.SnapshotSQLite(context.Background(), cfg.DB, dst)
+		}))
+	}
+	for _, path := range append([]string{cfg.HostKey, cfg.DB, cfg.Archive.Dir, cfg.TokenFile, cfg.AuditFile, cfg.BanFile, cfg.Auth.AccountsFile, cfg.Auth.IdentitiesFile}, cfg.HostKeys...) {
+		if path != "" && !strings.Contains(path, ":") && !inside(dir, path) {
+			fmt.Fprintf(os.Stderr, "schat backup: note: %s is outside the data directory and not backed up\n", path)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	tmp := ""
+	if out != "-" {
+		f, err := os.OpenFile(out+".tmp", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		tmp = f.Name()
+		defer os.Remove(tmp)
+		defer f.Close()
+		w = f
+	}
+	manifest, err := backup.Create(w, dir, opts...)
+	if err != nil {
+		return err
+	}
+	if tmp != "" {
+		if err := w.(*os.File).Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, out); err != nil {
+			return err
+		}
+	}
+	how := ""
+	if len(passphrase) > 0 {
+		how = ", encrypted"
+	}
+	fmt.Fprintf(os.Stderr, "backed up %d files (%d bytes%s) from %s to %s\n", len(manifest.Files), manifest.Size(), how, dir, out)
+	return nil
+}
+
+// runRestore checks a backup against its manifest and unpacks it into an
+// empty data directory.
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("schat restore", flag.ContinueOnError)
+	flags := registerBackupFlags(fs)
+	check := fs.Bool("check", false, "Only verify the backup against its manifest; write nothing")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: schat restore [-config file] [-data-dir dir] [-passphrase-env VAR] [-check] <file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	cfg, passphrase, err := flags.load(!*check)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schat restore:", err)
+		return 2
+	}
+
+	in := os.Stdin
+	if fs.Arg(0) != "-" {
+		if in, err = os.Open(fs.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, "schat restore:", err)
+			return 1
+		}
+		defer in.Close()
+	}
+	var manifest *backup.Manifest
+	if *check {
+		manifest, err = backup.Verify(in, backup.WithPassphrase(passphrase))
+	} else {
+		manifest, err = backup.Restore(in, cfg.DataDir, backup.WithPassphrase(passphrase))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schat restore:", err)
+		return 1
+	}
+	if *check {
+		fmt.Printf("backup ok: %d files (%d bytes) taken %s\n", len(manifest.Files), manifest.Size(), manifest.Created.Format("2006-01-02 15:04:05 MST"))
+		return 0
+	}
+	fmt.Printf("restored %d files (%d bytes) taken %s into %s\n", len(manifest.Files), manifest.Size(), manifest.Created.Format("2006-01-02 15:04:05 MST"), cfg.DataDir)
+	return 0
+}
+
+// inside reports whether path is dir or below it.
+func inside(dir, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
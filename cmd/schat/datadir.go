@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// prepareDataDir creates the data directory readable only by the server's
+// user, and warns when an existing one is open to others, since it holds the
+// host key and chat history.
+func prepareDataDir(dir string, logger *slog.Logger) error {
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("data dir %s is not a directory", dir)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		logger.Warn("data dir is accessible to other users; chmod 700 it", "path", dir, "mode", perm.String())
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ledzpl/schat/internal/chat"
+	"github.com/ledzpl/schat/pkg/buildinfo"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// handoverEnv tells a server started by a hot restart which inherited
+// descriptors hold its ports, as "addr=fd,...".
+const handoverEnv = "SCHAT_HANDOVER_FDS"
+
+// handoverReadyEnv names the inherited pipe on which a server started by a hot
+// restart reports its version once it accepts connections.
+const handoverReadyEnv = "SCHAT_HANDOVER_READY"
+
+// handoverReadyTimeout bounds how long the new process may take to start.
+const handoverReadyTimeout = time.Minute
+
+// handedOverListeners picks up the ports a hot restart passed in.
+func handedOverListeners() (listeners, error) {
+	fds, ok := os.LookupEnv(handoverEnv)
+	if !ok {
+		return listeners{}, nil
+	}
+	_ = os.Unsetenv(handoverEnv)
+	return inheritListeners(handoverEnv, fds)
+}
+
+// reportHandover tells the server that started this one by a hot restart that
+// it has taken over.
+func reportHandover() error {
+	num, ok := os.LookupEnv(handoverReadyEnv)
+	if !ok {
+		return nil
+	}
+	_ = os.Unsetenv(handoverReadyEnv)
+	fd, err := strconv.Atoi(num)
+	if err != nil {
+		return fmt.Errorf("bad $%s %q", handoverReadyEnv, num)
+	}
+	f := os.NewFile(uintptr(fd), "handover")
+	defer f.Close()
+	_, err = fmt.Fprintln(f, buildinfo.Get().Version)
+	return err
+}
+
+// restarter performs a hot restart on SIGUSR1: it starts the server's
+// executable again, which a deploy may have replaced, with the ports the
+// server listens on, and once the new process accepts connections stops
+// accepting them itself. Sessions already open stay on this process, told to
+// reconnect, until they end or the drain timeout passes.
+type restarter struct {
+	ports  listeners
+	server *sshserver.Server
+	rooms  *chat.RoomManager
+	// stopServing stops what only one process may run, such as the HTTP
+	// servers and the bridges.
+	stopServing  context.CancelFunc
+	drainTimeout time.Duration
+	hardened     bool
+	logger       *slog.Logger
+
+	// drained is closed once the sessions left on this process have ended.
+	drained chan struct{}
+}
+
+func (r *restarter) run(ctx context.Context) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	defer signal.Stop(usr1)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-usr1:
+		}
+		if r.hardened {
+			r.logger.Error("hot restart: not available to a hardened server; restart it instead")
+			continue
+		}
+		pid, version, err := r.handOver()
+		if err != nil {
+			r.logger.Error("hot restart failed; still serving", "err", err)
+			continue
+		}
+		r.logger.Info("hot restart: new process took over", "pid", pid, "version", version, "drain_timeout", r.drainTimeout)
+		if err := sdNotify(fmt.Sprintf("MAINPID=%d", pid)); err != nil {
+			r.logger.Warn("failed to notify systemd", "err", err)
+		}
+		r.drain(ctx, version)
+		return
+	}
+}
+
+// handOver starts the new process and waits until it reports that it accepts
+// connections.
+func (r *restarter) handOver() (int, string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, "", fmt.Errorf("find executable: %w", err)
+	}
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, "", err
+	}
+	defer ready.Close()
+
+	// ExtraFiles become descriptors 3 and up in the new process.
+	var files []*os.File
+	var fds []string
+	for addr, ln := range r.ports {
+		f, err := ln.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			closeAll(append(files, readyW))
+			return 0, "", fmt.Errorf("pass listener %q: %w", addr, err)
+		}
+		files = append(files, f)
+		fds = append(fds, fmt.Sprintf("%s=%d", addr, 2+len(files)))
+	}
+	files = append(files, readyW)
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), handoverEnv+"="+strings.Join(fds, ","), fmt.Sprintf("%s=%d", handoverReadyEnv, 2+len(files)))
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	err = cmd.Start()
+	// Only the new process may keep the write end, so that the read below
+	// ends should it exit.
+	closeAll(files)
+	if err != nil {
+		return 0, "", fmt.Errorf("start %s: %w", exe, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	reported := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(ready).ReadString('\n')
+		reported <- line
+	}()
+	select {
+	case line := <-reported:
+		if line != "" {
+			return cmd.Process.Pid, strings.TrimSpace(line), nil
+		}
+		err = errors.New("the new process exited before taking over")
+	case <-time.After(handoverReadyTimeout):
+		err = fmt.Errorf("the new process did not take over within %s", handoverReadyTimeout)
+	}
+	_ = cmd.Process.Kill()
+	<-exited
+	return 0, "", err
+}
+
+// drain stops accepting connections and waits for the sessions left on this
+// process, telling them the server is being upgraded.
+func (r *restarter) drain(ctx context.Context, version string) {
+	defer close(r.drained)
+	r.stopServing()
+	notice := chat.UpgradeNotice{Version: version}
+	if r.drainTimeout > 0 {
+		notice.Deadline = time.Now().Add(r.drainTimeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.drainTimeout)
+		defer cancel()
+	}
+	r.rooms.AnnounceUpgrade(notice)
+	if err := r.server.Drain(ctx); err != nil {
+		r.logger.Warn("hot restart: closing the sessions still open", "err", err)
+		return
+	}
+	r.logger.Info("hot restart: all sessions ended")
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
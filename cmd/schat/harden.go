@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/config"
+	"github.com/ledzpl/schat/pkg/secrets"
+)
+
+// hardenedEnv tells the confined server, re-executed by the one that bound
+// its ports, which inherited descriptors hold them, as "addr=fd,...".
+const hardenedEnv = "SCHAT_HARDENED_FDS"
+
+// systemReadPaths stay readable to a hardened server for DNS, TLS roots, and
+// time zones, which the standard library loads lazily.
+var systemReadPaths = []string{"/etc", "/usr/share/zoneinfo"}
+
+// errNoLandlock is returned when the kernel cannot confine file access.
+var errNoLandlock = errors.New("landlock is not available")
+
+// listeners are the ports bound before the server gave up its privileges,
+// or passed by systemd socket activation, keyed by address. Addresses not
+// among them are bound when asked for.
+type listeners map[string]net.Listener
+
+func (l listeners) listen(addr string) (net.Listener, error) {
+	if ln, ok := l[addr]; ok {
+		delete(l, addr)
+		return ln, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// harden locks a server configured for it down before it opens anything
+// else. It binds the ports, switches to the configured user, and re-executes
+// itself confined to the data directory with Landlock; confining the process
+// it starts is the only way to cover every thread. The confined process picks
+// up the ports it inherited. Either way, a hardened server refuses to go on as
+// root unless allowed to. Ports already activated are passed on, not bound.
+func harden(cfg config.Config, configPath string, activated listeners, logger *slog.Logger) (listeners, error) {
+	if !cfg.Hardening.Enabled {
+		return activated, nil
+	}
+	if fds, ok := os.LookupEnv(hardenedEnv); ok {
+		if err := refuseRoot(cfg); err != nil {
+			return nil, err
+		}
+		logger.Info("hardening: running confined", "data_dir", cfg.DataDir, "uid", os.Getuid())
+		return inheritListeners(hardenedEnv, fds)
+	}
+	// Files rewritten at runtime are replaced through a temporary file next
+	// to them, so their directories must be writable.
+	for _, f := range []struct{ name, path string }{
+		{"db", cfg.DB},
+		{"archive dir", cfg.Archive.Dir},
+		{"token file", cfg.TokenFile},
+		{"audit file", cfg.AuditFile},
+		{"ban file", cfg.BanFile},
+		{"accounts file", cfg.Auth.AccountsFile},
+		{"identities file", cfg.Auth.IdentitiesFile},
+	} {
+		if f.path != "" && !inside(cfg.DataDir, f.path) {
+			return nil, fmt.Errorf("%s %s is outside the data directory %s", f.name, f.path, cfg.DataDir)
+		}
+	}
+
+	bound := activated
+	for _, addr := range []string{cfg.Addr, cfg.MetricsAddr, cfg.Webhooks.Addr, cfg.AdminAPI.Addr, cfg.ControlAPI.Addr, cfg.WebGateway.Addr, cfg.Telnet.Addr} {
+		if _, ok := bound[addr]; ok || addr == "" {
+			continue
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("listen %q: %w", addr, err)
+		}
+		bound[addr] = ln
+	}
+	if cfg.Hardening.User != "" {
+		if os.Geteuid() != 0 {
+			return nil, fmt.Errorf("switching to user %q needs the server to start as root", cfg.Hardening.User)
+		}
+		if err := dropPrivileges(cfg.Hardening.User, cfg.DataDir, cfg.Log.File); err != nil {
+			return nil, err
+		}
+		logger.Info("hardening: switched user", "user", cfg.Hardening.User, "uid", os.Getuid(), "gid", os.Getgid())
+	}
+	if err := refuseRoot(cfg); err != nil {
+		return nil, err
+	}
+
+	// SQLite spills large sorts into temporary files, by default in /tmp.
+	if os.Getenv("SQLITE_TMPDIR") == "" {
+		_ = os.Setenv("SQLITE_TMPDIR", cfg.DataDir)
+	}
+	readable := append([]string{configPath, cfg.HostKey, cfg.MOTD, cfg.Banner, cfg.WordFilter.File,
+		cfg.Auth.PasswordFile, cfg.Auth.AuthorizedKeys, cfg.Auth.AdminKeys, cfg.RoomBackend.NATS.Credentials}, cfg.HostKeys...)
+	readable = append(readable, secrets.Files(secretRefs(cfg)...)...)
+	readable = append(readable, systemReadPaths...)
+	err := execConfined(cfg.DataDir, cfg.Log.File, readable, bound)
+	if errors.Is(err, errNoLandlock) {
+		logger.Warn("hardening: Landlock is not available; file access is not confined to the data dir", "data_dir", cfg.DataDir)
+		return bound, nil
+	}
+	return nil, err
+}
+
+func refuseRoot(cfg config.Config) error {
+	if os.Geteuid() == 0 && !cfg.Hardening.AllowRoot {
+		return errors.New("refusing to run as root; set hardening user (-run-as) or allow_root (-allow-root)")
+	}
+	return nil
+}
+
+// inheritListeners turns the descriptors named in env, as "addr=fd,...",
+// back into listeners.
+func inheritListeners(env, fds string) (listeners, error) {
+	inherited := listeners{}
+	for _, entry := range strings.Split(fds, ",") {
+		if entry == "" {
+			continue
+		}
+		addr, num, ok := strings.Cut(entry, "=")
+		fd, err := strconv.Atoi(num)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("bad $%s entry %q", env, entry)
+		}
+		f := os.NewFile(uintptr(fd), addr)
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherit listener %q: %w", addr, err)
+		}
+		inherited[addr] = ln
+	}
+	return inherited, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Landlock rights on files; directories may also be granted the rest.
+const (
+	landlockFileRead  = unix.LANDLOCK_ACCESS_FS_READ_FILE
+	landlockFileWrite = unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	landlockDirRead   = landlockFileRead | unix.LANDLOCK_ACCESS_FS_READ_DIR
+)
+
+// dropPrivileges switches the process to account, given by name or as
+// uid:gid, first handing it the server's own files, such as the data
+// directory, so it can keep writing to them.
+func dropPrivileges(account string, owned ...string) error {
+	uid, gid, err := lookupAccount(account)
+	if err != nil {
+		return err
+	}
+	if uid == 0 {
+		return fmt.Errorf("hardening user %q is root", account)
+	}
+	for _, root := range owned {
+		if root == "" {
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, uid, gid)
+		})
+		if err != nil {
+			return fmt.Errorf("hand %s to %s: %w", root, account, err)
+		}
+	}
+	// Go applies these to every thread of the process.
+	if err := syscall.Setgroups(nil); err != nil {
+		return fmt.Errorf("drop supplementary groups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("switch to gid %d: %w", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("switch to uid %d: %w", uid, err)
+	}
+	return nil
+}
+
+// lookupAccount resolves a user name, or a numeric uid:gid, to its IDs.
+func lookupAccount(account string) (int, int, error) {
+	if u, g, ok := strings.Cut(account, ":"); ok {
+		uid, err := strconv.Atoi(u)
+		if err != nil {
+			return 0, 0, fmt.Errorf("hardening user %q: bad uid", account)
+		}
+		gid, err := strconv.Atoi(g)
+		if err != nil {
+			return 0, 0, fmt.Errorf("hardening user %q: bad gid", account)
+		}
+		return uid, gid, nil
+	}
+	u, err := user.Lookup(account)
+	if err != nil {
+		return 0, 0, fmt.Errorf("hardening user: %w", err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("hardening user %q: uid %q is not numeric", account, u.Uid)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("hardening user %q: gid %q is not numeric", account, u.Gid)
+	}
+	return uid, gid, nil
+}
+
+// libraryPaths hold the dynamic loader and the C libraries the re-executed
+// server needs to start.
+var libraryPaths = []string{"/lib", "/lib64", "/usr/lib", "/usr/lib64"}
+
+// execConfined restricts the calling thread with Landlock to reading and
+// writing beneath dataDir, appending to logFile, and reading the readable
+// paths that exist, then re-executes the server on it with the bound
+// listeners, so the new process is confined from its first thread. It only
+// returns on failure, with errNoLandlock when the kernel has no Landlock.
+func execConfined(dataDir, logFile string, readable []string, bound listeners) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		if errno == unix.ENOSYS || errno == unix.EOPNOTSUPP {
+			return errNoLandlock
+		}
+		return fmt.Errorf("landlock: %w", errno)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("find executable: %w", err)
+	}
+
+	// Handle every right this kernel knows, so anything not granted below
+	// is denied.
+	handled := uint64(unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG | unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM)
+	if abi >= 2 {
+		handled |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		handled |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock: create ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer unix.Close(ruleset)
+
+	rules := []struct {
+		paths  []string
+		access uint64
+	}{
+		{[]string{dataDir}, handled &^ unix.LANDLOCK_ACCESS_FS_EXECUTE},
+		{[]string{logFile}, landlockFileWrite},
+		{readable, landlockDirRead},
+		{append([]string{exe}, libraryPaths...), landlockDirRead | unix.LANDLOCK_ACCESS_FS_EXECUTE},
+	}
+	for _, rule := range rules {
+		for _, path := range rule.paths {
+			if path == "" {
+				continue
+			}
+			err := allowBeneath(ruleset, path, rule.access, handled)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	env := os.Environ()
+	var fds []string
+	for addr, ln := range bound {
+		f, err := ln.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			return fmt.Errorf("pass listener %q: %w", addr, err)
+		}
+		// File returns a duplicate closed on exec; this one must survive it.
+		if _, err := unix.FcntlInt(f.Fd(), unix.F_SETFD, 0); err != nil {
+			return fmt.Errorf("pass listener %q: %w", addr, err)
+		}
+		fds = append(fds, fmt.Sprintf("%s=%d", addr, f.Fd()))
+	}
+	env = append(env, hardenedEnv+"="+strings.Join(fds, ","))
+
+	// Both the restriction and no_new_privs apply to this thread only, which
+	// is the one that runs execve.
+	runtime.LockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("landlock: set no_new_privs: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("landlock: restrict: %w", errno)
+	}
+	if err := syscall.Exec(exe, os.Args, env); err != nil {
+		return fmt.Errorf("re-execute %s: %w", exe, err)
+	}
+	return nil
+}
+
+// allowBeneath grants access to path, or to everything beneath it if it is a
+// directory. Files only take the rights that apply to files.
+func allowBeneath(ruleset int, path string, access, handled uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("landlock: open %s: %w", path, err)
+	}
+	defer unix.Close(fd)
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("landlock: stat %s: %w", path, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= landlockFileRead | landlockFileWrite | unix.LANDLOCK_ACCESS_FS_EXECUTE
+	}
+	rule := unix.LandlockPathBeneathAttr{Allowed_access: access & handled, Parent_fd: int32(fd)}
+	if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock: allow %s: %w", path, errno)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+var errHardeningUnsupported = errors.New("hardening is only supported on Linux")
+
+func dropPrivileges(account string, owned ...string) error {
+	return errHardeningUnsupported
+}
+
+func execConfined(dataDir, logFile string, readable []string, bound listeners) error {
+	return errHardeningUnsupported
+}
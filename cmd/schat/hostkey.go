@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+
+	"github.com/ledzpl/schat/pkg/config"
+	"github.com/ledzpl/schat/pkg/secrets"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// hostKeyPassphrase reads an encrypted host key's passphrase from the secret
+// reference, falling back to a prompt when it is not set and stdin is a
+// terminal.
+func hostKeyPassphrase(ctx context.Context, res *secrets.Resolver, ref string) sshserver.PassphraseFunc {
+	return func() ([]byte, error) {
+		value, err := res.Resolve(ctx, ref)
+		if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+			return nil, err
+		}
+		if value != "" {
+			return []byte(value), nil
+		}
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return nil, errors.New("host key is encrypted: set " + refName(ref) + " or run from a terminal to enter the passphrase")
+		}
+
+		fmt.Fprint(os.Stderr, "Host key passphrase: ")
+		passphrase, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("read host key passphrase: %w", err)
+		}
+		return passphrase, nil
+	}
+}
+
+// loadHostKeys loads or generates the primary host key, then the extra keys
+// served alongside it. The primary key comes first. Keys named by a secret
+// reference are fetched and never generated.
+func loadHostKeys(ctx context.Context, cfg config.Config, res *secrets.Resolver, logger *slog.Logger) ([]ssh.Signer, error) {
+	keyType, err := sshserver.ParseKeyType(cfg.HostKeyType)
+	if err != nil {
+		return nil, err
+	}
+	passphrase := sshserver.WithPassphrase(hostKeyPassphrase(ctx, res, cfg.HostKeyPassphraseEnv))
+
+	var primary ssh.Signer
+	if res.IsRef(cfg.HostKey) {
+		primary, err = loadHostKey(ctx, res, cfg.HostKey, passphrase)
+	} else {
+		primary, err = sshserver.LoadOrGenerateSigner(cfg.HostKey, sshserver.WithKeyType(keyType), passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signers := []ssh.Signer{primary}
+	for _, path := range cfg.HostKeys {
+		signer, err := loadHostKey(ctx, res, path, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	if err := sshserver.CheckHostKeys(signers...); err != nil {
+		return nil, err
+	}
+
+	for _, signer := range signers {
+		logger.Info("host key loaded", "type", signer.PublicKey().Type(), "fingerprint", ssh.FingerprintSHA256(signer.PublicKey()))
+	}
+	return signers, nil
+}
+
+// loadHostKey loads an existing host key from a path or a secret reference.
+func loadHostKey(ctx context.Context, res *secrets.Resolver, key string, opts ...sshserver.HostKeyOption) (ssh.Signer, error) {
+	if !res.IsRef(key) {
+		return sshserver.LoadSigner(key, opts...)
+	}
+	data, err := res.Resolve(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("host key: %w", err)
+	}
+	return sshserver.ParseSigner(key, []byte(data), opts...)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/config"
+	"github.com/ledzpl/schat/pkg/importer"
+	"github.com/ledzpl/schat/pkg/secrets"
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+// runImport adds chat logs from other servers to the history database.
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("schat import", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Config file naming the db, data_dir, and db_key_env")
+	dataDir := fs.String("data-dir", "", "Data directory holding schat.db (overrides the config file)")
+	db := fs.String("db", "", "SQLite database to import into (overrides the config file)")
+	dbKeyEnv := fs.String("db-key-env", "", "Environment variable or secret reference holding the secret the database is encrypted with (overrides the config file)")
+	format := fs.String("format", "", "Log format: "+strings.Join(importer.Formats(), ", "))
+	room := fs.String("room", "lobby", "Room to import into, unless a jsonl line names one")
+	origin := fs.String("origin", "", `Suffix marking imported senders, as in alice@irc (default: the format for ssh-chat and irc, none for jsonl; "-" for none)`)
+	date := fs.String("date", "", "Day (2006-01-02) of timestamps that only hold a time of day, until the log says otherwise")
+	tz := fs.String("tz", "Local", "Time zone of timestamps that do not carry one, e.g. UTC or Asia/Seoul")
+	dryRun := fs.Bool("dry-run", false, "Parse the logs and report what would be imported; write nothing")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: schat import -format ssh-chat|irc|jsonl [-config file] [-data-dir dir] [-db file] [-room name] [-origin name] [-date day] [-tz zone] [-dry-run] <file>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if fs.NArg() == 0 || *format == "" {
+		fs.Usage()
+		return 2
+	}
+
+	f, err := importer.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schat import:", err)
+		return 2
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schat import: -tz:", err)
+		return 2
+	}
+	opts := []importer.Option{importer.WithRoom(*room), importer.WithLocation(loc)}
+	if *date != "" {
+		day, err := time.ParseInLocation("2006-01-02", *date, loc)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "schat import: -date:", err)
+			return 2
+		}
+		opts = append(opts, importer.WithDate(day))
+	}
+	switch *origin {
+	case "":
+		if f != importer.FormatJSONL {
+			opts = append(opts, importer.WithOrigin(string(f)))
+		}
+	case "-":
+	default:
+		opts = append(opts, importer.WithOrigin(*origin))
+	}
+
+	cfg := config.Default()
+	if *configPath != "" {
+		if err := cfg.LoadFile(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, "schat import:", err)
+			return 2
+		}
+	}
+	if *dataDir != "" {
+		cfg.DataDir = *dataDir
+	}
+	if *db != "" {
+		cfg.DB = *db
+	}
+	if *dbKeyEnv != "" {
+		cfg.DBKeyEnv = *dbKeyEnv
+	}
+	cfg.ApplyDataDir()
+
+	var history store.Store
+	if !*dryRun {
+		if cfg.DB == "" {
+			fmt.Fprintln(os.Stderr, "schat import: no database; pass -db or -data-dir, or set db or data_dir in -config")
+			return 2
+		}
+		if history, err = openHistory(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "schat import:", err)
+			return 1
+		}
+		defer history.Close()
+		if sealed, ok := history.(*store.Encrypted); ok {
+			opts = append(opts, importer.WithDecrypt(sealed.Open))
+		}
+	}
+	if err := importLogs(history, f, fs.Args(), opts); err != nil {
+		fmt.Fprintln(os.Stderr, "schat import:", err)
+		return 1
+	}
+	return 0
+}
+
+// openHistory opens the database the server keeps history in, encrypted the
+// way the server would.
+func openHistory(cfg config.Config) (store.Store, error) {
+	db, err := store.OpenSQLite(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DBKeyEnv == "" {
+		return db, nil
+	}
+	ctx := context.Background()
+	res, err := newSecrets(ctx, cfg.Secrets)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	history, err := encryptHistory(ctx, db, res, cfg.DBKeyEnv)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return history, nil
+}
+
+// encryptHistory wraps db so messages are encrypted with the secret ref
+// points at.
+func encryptHistory(ctx context.Context, db store.Store, res *secrets.Resolver, ref string) (*store.Encrypted, error) {
+	key, err := res.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	history, err := store.NewEncrypted(db, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", refName(ref), err)
+	}
+	return history, nil
+}
+
+// importLogs reads each file, "-" being standard input, into history, or
+// only counts the records when history is nil. Every file is read before
+// anything is written, so a log that fails to parse imports nothing.
+func importLogs(history store.Store, f importer.Format, files []string, opts []importer.Option) error {
+	var records []store.Record
+	var first, last time.Time
+	add := func(rec store.Record) error {
+		if first.IsZero() || rec.Timestamp.Before(first) {
+			first = rec.Timestamp
+		}
+		if rec.Timestamp.After(last) {
+			last = rec.Timestamp
+		}
+		records = append(records, rec)
+		return nil
+	}
+
+	var total importer.Stats
+	for _, name := range files {
+		var in io.Reader = os.Stdin
+		if name != "-" {
+			file, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			in = file
+		}
+		stats, err := importer.Read(in, f, add, opts...)
+		total.Records += stats.Records
+		total.Skipped += stats.Skipped
+		if errors.Is(err, importer.ErrNoDate) {
+			return fmt.Errorf("%s: %w; pass -date", name, err)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	verb := "would import"
+	if history != nil {
+		verb = "imported"
+		for i, rec := range records {
+			if err := history.Append(context.Background(), rec); err != nil {
+				return fmt.Errorf("%w (%d of %d messages were imported)", err, i, len(records))
+			}
+		}
+	}
+	fmt.Printf("%s %d messages (%d lines skipped)", verb, total.Records, total.Skipped)
+	if total.Records > 0 {
+		fmt.Printf(" from %s to %s", first.Format(time.DateTime), last.Format(time.DateTime))
+	}
+	fmt.Println()
+	return nil
+}
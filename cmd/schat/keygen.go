@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/config"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// subcommands run instead of the server when named as the first argument.
+// -version and --version are accepted like the flags they look like.
+var subcommands = map[string]func(args []string) int{
+	"backup":     runBackup,
+	"import":     runImport,
+	"restore":    runRestore,
+	"keygen":     runKeygen,
+	"rotate-key": runRotateKey,
+	"version":    runVersion,
+	"-version":   runVersion,
+	"--version":  runVersion,
+}
+
+// runKeygen generates a host key at the given path.
+func runKeygen(args []string) int {
+	fs := flag.NewFlagSet("schat keygen", flag.ContinueOnError)
+	keyType := fs.String("type", string(sshserver.DefaultKeyType), "Key algorithm: "+strings.Join(sshserver.KeyTypes(), ", "))
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: schat keygen [-type ed25519] <path>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	t, err := sshserver.ParseKeyType(*keyType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schat keygen:", err)
+		return 2
+	}
+	signer, err := sshserver.GenerateSigner(fs.Arg(0), sshserver.WithKeyType(t))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schat keygen:", err)
+		return 1
+	}
+	fmt.Printf("generated %s host key %s (%s)\n", t, fs.Arg(0), ssh.FingerprintSHA256(signer.PublicKey()))
+	return 0
+}
+
+// runRotateKey stages a new host key next to the current one and explains how
+// to serve both until clients have learned the new key.
+func runRotateKey(args []string) int {
+	fs := flag.NewFlagSet("schat rotate-key", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Config file naming the current host_key and host_keys")
+	hostKey := fs.String("host-key", "", "Current host key (overrides the config file)")
+	keyType := fs.String("type", string(sshserver.DefaultKeyType), "Algorithm of the new key: "+strings.Join(sshserver.KeyTypes(), ", "))
+	out := fs.String("out", "", "Path of the new key (default: ssh_host_<algorithm> next to the current key)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: schat rotate-key [-config file] [-host-key path] [-type ed25519] [-out path]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg := config.Default()
+	if *configPath != "" {
+		if err := cfg.LoadFile(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, "schat rotate-key:", err)
+			return 1
+		}
+	}
+	if *hostKey != "" {
+		cfg.HostKey = *hostKey
+	}
+	cfg.ApplyDataDir()
+	t, err := sshserver.ParseKeyType(*keyType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schat rotate-key:", err)
+		return 2
+	}
+	path := *out
+	if path == "" && strings.Contains(cfg.HostKey, ":") {
+		fmt.Fprintln(os.Stderr, "schat rotate-key: host_key is a secret reference; pass -out to choose where the new key goes")
+		return 2
+	}
+	if path == "" {
+		algo, _, _ := strings.Cut(string(t), "-")
+		path = filepath.Join(filepath.Dir(cfg.HostKey), "ssh_host_"+algo)
+	}
+
+	if err := rotateKey(cfg, t, path); err != nil {
+		fmt.Fprintln(os.Stderr, "schat rotate-key:", err)
+		return 1
+	}
+	return 0
+}
+
+func rotateKey(cfg config.Config, t sshserver.KeyType, path string) error {
+	ctx := context.Background()
+	res, err := newSecrets(ctx, cfg.Secrets)
+	if err != nil {
+		return err
+	}
+	passphrase := sshserver.WithPassphrase(hostKeyPassphrase(ctx, res, cfg.HostKeyPassphraseEnv))
+	current, err := loadHostKey(ctx, res, cfg.HostKey, passphrase)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no current host key at %s to rotate from; use schat keygen to create one", cfg.HostKey)
+	} else if err != nil {
+		return err
+	}
+	if current.PublicKey().Type() == t.Algorithm() {
+		return fmt.Errorf("the current host key is already %s; SSH serves one key per algorithm, so choose another -type", current.PublicKey().Type())
+	}
+	for _, extra := range cfg.HostKeys {
+		signer, err := loadHostKey(ctx, res, extra, passphrase)
+		if err != nil {
+			return err
+		}
+		if signer.PublicKey().Type() == t.Algorithm() {
+			return fmt.Errorf("host key %s is already served as %s; remove it from host_keys first", extra, t.Algorithm())
+		}
+	}
+
+	next, err := sshserver.GenerateSigner(path, sshserver.WithKeyType(t))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("current host key: %s (%s, %s)\n", cfg.HostKey, current.PublicKey().Type(), ssh.FingerprintSHA256(current.PublicKey()))
+	fmt.Printf("staged host key:  %s (%s, %s)\n", path, next.PublicKey().Type(), ssh.FingerprintSHA256(next.PublicKey()))
+	fmt.Println()
+	fmt.Println("To rotate:")
+	fmt.Printf("  1. Serve both keys: add %s to host_keys (or -host-keys) and restart.\n", path)
+	fmt.Println("     Clients keep verifying the key they already know.")
+	fmt.Printf("  2. Publish %s.pub so users can add it to known_hosts.\n", path)
+	fmt.Printf("  3. Later, set host_key to %s, move %s to host_keys, and restart;\n", path, cfg.HostKey)
+	fmt.Println("     drop the old key once no clients depend on it.")
+	return nil
+}
+
+// flagExitCode maps a flag parse error to an exit status; -h is not a failure.
+func flagExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/ledzpl/schat/internal/chat"
+	"github.com/ledzpl/schat/pkg/config"
+)
+
+// openLogOutput returns the writer logs go to: stdout, or the configured file
+// opened for appending.
+func openLogOutput(cfg config.Log) (io.WriteCloser, error) {
+	if cfg.File == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// newLogger builds the server logger in the configured format. The minimum
+// level is read from level so a reload can change it. Records are also
+// copied into serverLog when it is not nil.
+func newLogger(w io.Writer, cfg config.Log, level *slog.LevelVar, serverLog *chat.ServerLog) *slog.Logger {
+	if l, err := cfg.SlogLevel(); err == nil {
+		level.Set(l)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if cfg.Format == config.LogFormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	if serverLog != nil {
+		handler = serverLog.Handler(handler)
+	}
+	return slog.New(handler)
+}
+
+// newServerLog returns the log streamed into #server-log, or nil when the
+// room is off.
+func newServerLog(cfg config.Log) *chat.ServerLog {
+	level, on, err := cfg.RoomSlogLevel()
+	if err != nil || !on {
+		return nil
+	}
+	return chat.NewServerLog(level)
+}
+
+// fatal logs err and exits.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "err", err)
+	os.Exit(1)
+}
@@ -2,42 +2,919 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"expvar"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
 	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc"
 
 	"github.com/ledzpl/schat/internal/chat"
+	"github.com/ledzpl/schat/pkg/adminapi"
+	"github.com/ledzpl/schat/pkg/audit"
+	"github.com/ledzpl/schat/pkg/automod"
+	"github.com/ledzpl/schat/pkg/bans"
+	"github.com/ledzpl/schat/pkg/bridge"
+	"github.com/ledzpl/schat/pkg/bridge/irc"
+	"github.com/ledzpl/schat/pkg/bridge/matrix"
+	"github.com/ledzpl/schat/pkg/buildinfo"
+	"github.com/ledzpl/schat/pkg/cluster"
+	"github.com/ledzpl/schat/pkg/config"
+	"github.com/ledzpl/schat/pkg/controlapi"
+	"github.com/ledzpl/schat/pkg/features"
+	"github.com/ledzpl/schat/pkg/fileshare"
+	"github.com/ledzpl/schat/pkg/natsroom"
+	"github.com/ledzpl/schat/pkg/redisroom"
+	"github.com/ledzpl/schat/pkg/roomstate"
+	"github.com/ledzpl/schat/pkg/schedule"
+	"github.com/ledzpl/schat/pkg/secrets"
 	"github.com/ledzpl/schat/pkg/sshserver"
+	"github.com/ledzpl/schat/pkg/store"
+	"github.com/ledzpl/schat/pkg/telnet"
+	"github.com/ledzpl/schat/pkg/tokens"
+	"github.com/ledzpl/schat/pkg/translate"
+	"github.com/ledzpl/schat/pkg/webgateway"
+	"github.com/ledzpl/schat/pkg/webhook"
+	"github.com/ledzpl/schat/pkg/wordfilter"
 )
 
 func main() {
-	addr := flag.String("addr", ":2222", "TCP address for the SSH chat server")
-	hostKeyPath := flag.String("host-key", "configs/ssh_host_rsa", "Path to the SSH host private key (auto-generated if missing)")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		if sub, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(sub(os.Args[2:]))
+		}
+	}
 
-	logger := log.New(os.Stdout, "", log.LstdFlags)
+	loader, err := config.ParseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
 
-	signer, err := sshserver.LoadOrGenerateSigner(*hostKeyPath)
+	logOutput, err := openLogOutput(cfg.Log)
 	if err != nil {
-		logger.Fatalf("failed to prepare host key: %v", err)
+		log.Fatalf("invalid log configuration: %v", err)
+	}
+	defer logOutput.Close()
+	level := new(slog.LevelVar)
+	serverLog := newServerLog(cfg.Log)
+	logger := newLogger(logOutput, cfg.Log, level, serverLog)
+	slog.SetDefault(logger)
+	build := buildinfo.Get()
+	logger.Info("starting schat", "version", build.Version, "commit", build.Commit, "built", build.Date, "go", build.GoVersion)
+	if path := loader.Path(); path != "" {
+		logger.Info("config: loaded", "path", path)
 	}
 
-	room := chat.NewRoom()
-	server := sshserver.New(*addr, signer, logger)
+	tuning, err := cfg.EffectiveTuning()
+	if err != nil {
+		fatal(logger, "invalid configuration", err)
+	}
+	tuning.ApplyRuntime()
+	logger.Info("tuning profile applied", "profile", cfg.Profile, "tuning", tuning.String())
 
+	if err := prepareDataDir(cfg.DataDir, logger); err != nil {
+		fatal(logger, "invalid -data-dir", err)
+	}
+	activated, err := activatedListeners(cfg)
+	if err != nil {
+		fatal(logger, "failed to use activated sockets", err)
+	}
+	for addr, ln := range activated {
+		logger.Info("using socket from systemd", "addr", addr, "listen", ln.Addr().String())
+	}
+	handedOver, err := handedOverListeners()
+	if err != nil {
+		fatal(logger, "failed to take over from the previous server", err)
+	}
+	maps.Copy(activated, handedOver)
+	bound, err := harden(cfg, loader.Path(), activated, logger)
+	if err != nil {
+		fatal(logger, "failed to harden the server", err)
+	}
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
+	// serving ends before ctx when a hot restart hands the ports over.
+	serving, stopServing := context.WithCancel(ctx)
+	defer stopServing()
+	ports := listeners{}
+
+	secretStore, err := newSecrets(ctx, cfg.Secrets)
+	if err != nil {
+		fatal(logger, "invalid secrets configuration", err)
+	}
+	signers, err := loadHostKeys(ctx, cfg, secretStore, logger)
+	if err != nil {
+		fatal(logger, "failed to prepare host keys", err)
+	}
+	sshPol, err := sshPolicy(cfg.Security)
+	if err != nil {
+		fatal(logger, "invalid security policy", err)
+	}
+	reportPolicy(sshPol, signers, logger)
+
+	var accounts *sshserver.Accounts
+	if cfg.Auth.AccountsFile != "" {
+		if accounts, err = sshserver.OpenAccounts(cfg.Auth.AccountsFile); err != nil {
+			fatal(logger, "invalid -accounts-file", err)
+		}
+	}
+	var identities *sshserver.Identities
+	if cfg.Auth.IdentitiesFile != "" {
+		if identities, err = sshserver.OpenIdentities(cfg.Auth.IdentitiesFile); err != nil {
+			fatal(logger, "invalid -identities-file", err)
+		}
+	}
+	auths, err := buildAuthenticators(ctx, cfg.Auth, accounts)
+	if err != nil {
+		fatal(logger, "failed to configure authentication", err)
+	}
+	if len(cfg.Operators) > 0 && accounts == nil && identities == nil && cfg.Auth.PasswordFile == "" && cfg.Auth.OIDCIssuer == "" {
+		// Operators must prove their name, and nothing here can prove one.
+		logger.Warn("operators listed but no auth mode proves a username; set accounts_file, password_file, identities_file, or oidc_issuer")
+	}
+
+	policy, err := chat.ParseBackpressurePolicy(cfg.Limits.Backpressure)
+	if err != nil {
+		fatal(logger, "invalid -backpressure", err)
+	}
+	roomPolicies := make(map[string]chat.BackpressurePolicy, len(cfg.Limits.RoomBackpressure))
+	for room, name := range cfg.Limits.RoomBackpressure {
+		if roomPolicies[room], err = chat.ParseBackpressurePolicy(name); err != nil {
+			fatal(logger, "invalid limits.room_backpressure", fmt.Errorf("%s: %w", room, err))
+		}
+	}
 
-	err = server.ListenAndServe(ctx, func(conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) {
-		chat.HandleSession(room, conn, channel, requests)
+	defaults, err := features.Parse(strings.Join(cfg.Features, ","))
+	if err != nil {
+		fatal(logger, "invalid -features", err)
+	}
+	var words *wordfilter.Filter
+	if cfg.WordFilter.Enabled() {
+		if words, err = loadWordFilter(cfg.WordFilter); err != nil {
+			fatal(logger, "invalid word_filter configuration", err)
+		}
+		if _, set := defaults[features.WordFilter]; !set {
+			defaults[features.WordFilter] = true
+		}
+	}
+	mod, err := loadAutomod(cfg.AutoMod)
+	if err != nil {
+		fatal(logger, "invalid automod configuration", err)
+	}
+	if _, set := defaults[features.AutoMod]; !set && cfg.AutoMod.Enabled {
+		defaults[features.AutoMod] = true
+	}
+	if _, set := defaults[features.WebGateway]; !set && cfg.WebGateway.Addr != "" {
+		defaults[features.WebGateway] = true
+	}
+	flags := features.New(defaults)
+
+	keys, err := chat.ParseKeyPolicy(cfg.Keys.Bindings, cfg.Keys.Locked)
+	if err != nil {
+		fatal(logger, "invalid keys configuration", err)
+	}
+	interrupt, err := chat.ParseInterruptPolicy(cfg.Keys.Interrupt)
+	if err != nil {
+		fatal(logger, "invalid -interrupt", err)
+	}
+	statusBar, err := chat.ParseStatusBar(cfg.StatusBar.Left, cfg.StatusBar.Right)
+	if err != nil {
+		fatal(logger, "invalid status_bar configuration", err)
+	}
+
+	live, err := loadLiveSettings(cfg)
+	if err != nil {
+		fatal(logger, "invalid configuration", err)
+	}
+
+	var clusterTLS *cluster.TLS
+	if cfg.Cluster.TLS.Enabled() {
+		if clusterTLS, err = cluster.LoadTLS(cfg.Cluster.TLS.Cert, cfg.Cluster.TLS.Key, cfg.Cluster.TLS.CA); err != nil {
+			fatal(logger, "invalid cluster configuration", err)
+		}
+	}
+	var controlTLS *cluster.TLS
+	if cfg.ControlAPI.Addr != "" {
+		if controlTLS, err = cluster.LoadTLS(cfg.ControlAPI.TLS.Cert, cfg.ControlAPI.TLS.Key, cfg.ControlAPI.TLS.CA); err != nil {
+			fatal(logger, "invalid control_api configuration", err)
+		}
+	}
+	node, err := buildCluster(cfg.Cluster, clusterTLS, logger)
+	if err != nil {
+		fatal(logger, "invalid cluster configuration", err)
+	}
+	backend, err := buildRoomBackend(ctx, cfg, secretStore, logger)
+	if err != nil {
+		fatal(logger, "invalid room_backend configuration", err)
+	}
+
+	bridges := bridge.NewSupervisor(bridge.WithLogger(logger))
+
+	var webhookSecret string
+	if cfg.Webhooks.Enabled() {
+		if webhookSecret, err = secretStore.Resolve(ctx, cfg.Webhooks.SecretEnv); err != nil {
+			fatal(logger, "invalid webhooks configuration", err)
+		}
+		if webhookSecret == "" {
+			fatal(logger, "invalid webhooks configuration", fmt.Errorf("%s must hold the shared secret", refName(cfg.Webhooks.SecretEnv)))
+		}
+	}
+	// The admin token also guards the debug endpoints on metrics_addr that
+	// change the server.
+	var adminToken string
+	if cfg.AdminAPI.Addr != "" || cfg.MetricsAddr != "" {
+		if adminToken, err = secretStore.Resolve(ctx, cfg.AdminAPI.TokenEnv); err != nil {
+			fatal(logger, "invalid admin_api configuration", err)
+		}
+		if adminToken == "" && cfg.AdminAPI.Addr != "" {
+			fatal(logger, "invalid admin_api configuration", fmt.Errorf("%s must hold the bearer token", refName(cfg.AdminAPI.TokenEnv)))
+		}
+	}
+	webhooks := webhook.NewDispatcher(webhookSecret, cfg.Webhooks.Outbound, webhook.WithLogger(logger))
+	prompts := promptSystems(cfg.Webhooks.Prompts, webhookSecret, logger)
+
+	var tokenStore *tokens.Store
+	if cfg.TokenFile != "" {
+		if tokenStore, err = tokens.Open(cfg.TokenFile); err != nil {
+			fatal(logger, "invalid -token-file", err)
+		}
+	}
+
+	auditLog, err := audit.Open(cfg.AuditFile)
+	if err != nil {
+		fatal(logger, "invalid -audit-file", err)
+	}
+	defer auditLog.Close()
+	banList, err := bans.Open(cfg.BanFile)
+	if err != nil {
+		fatal(logger, "invalid -ban-file", err)
+	}
+
+	roomOpts := []chat.RoomOption{
+		chat.WithServerName(live.rooms.ServerName),
+		chat.WithMOTD(live.rooms.MOTD),
+		chat.WithGoodbye(cfg.Goodbye),
+		chat.WithOperators(live.rooms.Operators...),
+		chat.WithBackpressure(policy, cfg.Limits.BackpressureTimeout),
+		chat.WithQueueSize(tuning.QueueSize),
+		chat.WithHistorySize(tuning.HistorySize),
+		chat.WithRelayWorkers(tuning.RelayWorkers),
+		chat.WithAutoAway(live.rooms.AutoAway),
+		chat.WithMaxMessageLength(cfg.Limits.MaxMessageLength),
+		chat.WithFeatures(flags),
+		chat.WithCluster(node),
+		chat.WithBridges(bridges),
+		chat.WithWebhooks(webhooks),
+		chat.WithTokens(tokenStore),
+		chat.WithAccounts(accounts),
+		chat.WithIdentities(identities),
+		chat.WithKeyPolicy(keys),
+		chat.WithInterrupt(interrupt),
+		chat.WithStatusBar(statusBar),
+		chat.WithWordFilter(words),
+		chat.WithAutomod(mod),
+		chat.WithAudit(auditLog),
+		chat.WithBans(banList),
+		chat.WithLogger(logger),
+	}
+	if cfg.Translate.URL != "" {
+		apiKey, err := secretStore.Resolve(ctx, cfg.Translate.APIKeyEnv)
+		if err != nil {
+			fatal(logger, "invalid translate configuration", err)
+		}
+		provider := translate.NewLibreTranslate(cfg.Translate.URL, apiKey)
+		roomOpts = append(roomOpts, chat.WithTranslator(translate.New(provider,
+			translate.WithCacheSize(cfg.Translate.CacheSize),
+			translate.WithRateLimit(cfg.Translate.RatePerMinute, time.Minute),
+		)))
+	}
+	if backend != nil {
+		roomOpts = append(roomOpts, chat.WithBackend(backend))
+	}
+	if cfg.Files.MaxBytes > 0 {
+		roomOpts = append(roomOpts, chat.WithFiles(fileshare.New(cfg.Files.MaxBytes, cfg.Files.TotalBytes, cfg.Files.TTL)))
+	}
+	// sealed encrypts room archives with the history's keys, when it has them.
+	var sealed *store.Encrypted
+	if cfg.DB != "" {
+		db, err := store.OpenSQLite(cfg.DB)
+		if err != nil {
+			fatal(logger, "invalid -db", err)
+		}
+		defer db.Close()
+		var history store.Store = db
+		if cfg.DBKeyEnv != "" {
+			if sealed, err = encryptHistory(ctx, db, secretStore, cfg.DBKeyEnv); err != nil {
+				fatal(logger, "invalid -db-key-env", err)
+			}
+			history = sealed
+		}
+		roomOpts = append(roomOpts, chat.WithStore(history), chat.WithHistoryRetention(cfg.DBRetention))
+		if cfg.DBRetention > 0 {
+			go pruneHistory(ctx, db, cfg.DBRetention, logger)
+		}
+	}
+
+	announcements, err := loadAnnouncements(cfg.Announcements)
+	if err != nil {
+		fatal(logger, "invalid announcements configuration", err)
+	}
+	rooms := chat.NewRoomManager(
+		chat.WithRoomOptions(roomOpts...),
+		chat.WithRoomBackpressure(roomPolicies),
+		chat.WithArchive(chat.ArchivePolicy{Dir: cfg.Archive.Dir, Retention: cfg.Archive.Retention, Encrypt: sealed}),
+		chat.WithInactiveArchive(cfg.Archive.Inactive),
+		chat.WithAnnouncements(announcements...),
+		chat.WithProbes(chat.ProbePolicy{Interval: cfg.Probes.Interval, Timeout: cfg.Probes.Timeout}),
+		chat.WithPrompts(prompts...),
+		chat.WithServerLog(serverLog),
+	)
+	if err := rooms.Ensure(cfg.Rooms...); err != nil {
+		fatal(logger, "invalid -rooms", err)
+	}
+	for _, a := range announcements {
+		if a.Room != "" {
+			if err := rooms.Ensure(a.Room); err != nil {
+				fatal(logger, "invalid announcements configuration", err)
+			}
+		}
+	}
+	for _, p := range prompts {
+		if err := rooms.Ensure(p.Rooms...); err != nil {
+			fatal(logger, "invalid webhooks prompts configuration", err)
+		}
+	}
+	if err := addBridges(ctx, bridges, rooms, cfg.Bridges, secretStore, logger); err != nil {
+		fatal(logger, "invalid bridges configuration", err)
+	}
+	go rooms.Run(ctx)
+	go announceUpgrades(ctx, rooms)
+	go bridges.Run(serving)
+	go node.Run(serving)
+	if backend != nil {
+		go backend.Run(serving, rooms.PostReplicated)
+	}
+	go webhooks.Run(ctx)
+	for _, p := range prompts {
+		go p.Replies.Run(ctx)
+	}
+	expvar.Publish("schat_memory", expvar.Func(func() any { return rooms.MemoryStats() }))
+	expvar.Publish("schat_bridges", expvar.Func(func() any { return bridges.Status() }))
+	expvar.Publish("schat_webhooks", expvar.Func(func() any {
+		status := webhooks.Status()
+		for _, p := range prompts {
+			status = append(status, p.Replies.Status()...)
+		}
+		return status
+	}))
+	expvar.Publish("schat_cluster_replication", expvar.Func(func() any { return node.ReplicationStatus() }))
+	expvar.Publish("schat_probes", expvar.Func(func() any { return rooms.ProbeStatus() }))
+	expvar.Publish("schat_build", expvar.Func(func() any { return buildinfo.Get() }))
+	if cfg.MetricsAddr != "" {
+		admin := http.NewServeMux()
+		admin.Handle("/debug/vars", expvar.Handler())
+		admin.Handle("/debug/features", adminapi.RequireToken(adminToken, flags.Handler()))
+		admin.Handle("/debug/cluster", node.Handler(rooms.Whereabouts))
+		admin.Handle("/debug/cluster/events", node.EventsHandler(rooms.PostReplicated))
+		admin.Handle("/debug/version", buildinfo.Handler())
+		admin.Handle("/debug/upgrade", adminapi.RequireToken(adminToken, rooms.UpgradeHandler()))
+		var adminTLS *tls.Config
+		if clusterTLS != nil {
+			adminTLS = clusterTLS.ServerConfig()
+		}
+		ln, err := bound.listen(cfg.MetricsAddr)
+		if err != nil {
+			fatal(logger, "invalid -metrics-addr", err)
+		}
+		ports[cfg.MetricsAddr] = ln
+		go serveHTTP(serving, "metrics", ln, admin, adminTLS, logger)
+	}
+	if cfg.Webhooks.Addr != "" {
+		inbound := http.NewServeMux()
+		inbound.Handle("/webhook", webhook.Handler(webhookSecret, rooms.PostWebhook))
+		inbound.Handle("/webhook/prompt", webhook.PromptHandler(webhookSecret, rooms.PostPrompt))
+		ln, err := bound.listen(cfg.Webhooks.Addr)
+		if err != nil {
+			fatal(logger, "invalid -webhook-addr", err)
+		}
+		ports[cfg.Webhooks.Addr] = ln
+		go serveHTTP(serving, "webhook", ln, inbound, nil, logger)
+	}
+	proxies, err := sshserver.ParseProxySources(cfg.ProxyProtocol)
+	if err != nil {
+		fatal(logger, "invalid proxy_protocol", err)
+	}
+	server := sshserver.New(cfg.Addr, signers[0], logger,
+		sshserver.WithHostKeys(signers[1:]...),
+		sshserver.WithPolicy(sshPol),
+		sshserver.WithAuthenticators(auths...),
+		sshserver.WithBanner(live.banner),
+		sshserver.WithBannerHint(node.BannerHint),
+		sshserver.WithConnLimits(cfg.Limits.MaxClients, cfg.Limits.MaxPerIP),
+		sshserver.WithFailBan(sshserver.FailBan(cfg.FailBan)),
+		sshserver.WithProxyProtocol(proxies...),
+		sshserver.WithBans(func(user, fingerprint string, addr netip.Addr) (string, bool) {
+			e, banned := banList.Check(time.Now(), user, fingerprint, addr)
+			return e.Reason, banned
+		}),
+	)
+
+	go (&reloader{
+		loader:     loader,
+		started:    cfg,
+		level:      level,
+		serverLog:  serverLog,
+		server:     server,
+		rooms:      rooms,
+		clusterTLS: clusterTLS,
+		controlTLS: controlTLS,
+		audit:      auditLog,
+		logger:     logger,
+	}).run(ctx)
+
+	expvar.Publish("schat_session_exits", expvar.Func(func() any { return server.SessionExits() }))
+	expvar.Publish("schat_fail_ban", expvar.Func(func() any { return server.FailBanStats() }))
+	if cfg.AdminAPI.Addr != "" {
+		api := adminapi.Handler(adminToken, rooms.AdminBackend(), adminapi.WithReadiness("ssh", func() error {
+			if !server.Accepting() {
+				return errors.New("not accepting SSH connections")
+			}
+			return nil
+		}))
+		ln, err := bound.listen(cfg.AdminAPI.Addr)
+		if err != nil {
+			fatal(logger, "invalid -admin-api-addr", err)
+		}
+		ports[cfg.AdminAPI.Addr] = ln
+		go serveHTTP(serving, "admin-api", ln, api, nil, logger)
+	}
+	if cfg.ControlAPI.Addr != "" {
+		ln, err := bound.listen(cfg.ControlAPI.Addr)
+		if err != nil {
+			fatal(logger, "invalid -control-api-addr", err)
+		}
+		ports[cfg.ControlAPI.Addr] = ln
+		go serveGRPC(serving, "control-api", ln, controlapi.NewServer(controlTLS.StrictServerConfig(), rooms.ControlBackend()), logger)
+	}
+	if cfg.WebGateway.Addr != "" {
+		// Web sessions end with ctx, as SSH sessions do, so a hot restart
+		// leaves them to the old process until it exits.
+		gw := webgateway.New(ctx, func(ctx context.Context, conn webgateway.Conn) error {
+			return chat.HandleWebSession(ctx, rooms.Lobby(), conn)
+		},
+			webgateway.WithTokens(tokenStore),
+			webgateway.WithAnonymous(slices.Contains(cfg.Auth.Modes, "none")),
+			webgateway.WithNameCheck(rooms.Lobby().CheckGuestName),
+			webgateway.WithOrigins(cfg.WebGateway.Origins...),
+			webgateway.WithLogger(logger),
+		)
+		ln, err := bound.listen(cfg.WebGateway.Addr)
+		if err != nil {
+			fatal(logger, "invalid -web-addr", err)
+		}
+		ports[cfg.WebGateway.Addr] = ln
+		go serveHTTP(serving, "web", ln, gw, nil, logger)
+	}
+	if cfg.Telnet.Addr != "" {
+		tel := telnet.New(ctx, func(ctx context.Context, conn *telnet.Conn) error {
+			return chat.HandleTerminalSession(ctx, rooms.Lobby(), chat.ClientInfo{
+				Username:      conn.Name(),
+				RemoteAddr:    conn.RemoteAddr().String(),
+				ClientVersion: telnet.ClientVersion,
+				SessionID:     conn.SessionID(),
+			}, conn)
+		},
+			telnet.WithRaw(cfg.Telnet.Raw),
+			telnet.WithBanner(live.banner),
+			telnet.WithNameCheck(rooms.Lobby().CheckGuestName),
+			telnet.WithLogger(logger),
+		)
+		ln, err := bound.listen(cfg.Telnet.Addr)
+		if err != nil {
+			fatal(logger, "invalid -telnet-addr", err)
+		}
+		ports[cfg.Telnet.Addr] = ln
+		go func() {
+			if err := tel.Serve(serving, ln); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("telnet: server failed", "err", err)
+			}
+		}()
+	}
+
+	listener, err := bound.listen(cfg.Addr)
+	if err != nil {
+		fatal(logger, "invalid -addr", err)
+	}
+	ports[cfg.Addr] = listener
+	// Sockets inherited for addresses no longer configured would queue
+	// connections nobody accepts.
+	for addr, ln := range bound {
+		logger.Warn("closing inherited socket for an address no longer configured", "addr", addr)
+		_ = ln.Close()
+	}
+	hot := &restarter{
+		ports:        ports,
+		server:       server,
+		rooms:        rooms,
+		stopServing:  stopServing,
+		drainTimeout: cfg.DrainTimeout,
+		hardened:     cfg.Hardening.Enabled,
+		logger:       logger,
+		drained:      make(chan struct{}),
+	}
+	go hot.run(ctx)
+	if err := reportHandover(); err != nil {
+		logger.Warn("failed to report the hot restart to the previous server", "err", err)
+	}
+	if err := sdNotify("READY=1"); err != nil {
+		logger.Warn("failed to notify systemd", "err", err)
+	}
+	err = server.Serve(ctx, listener, func(ctx context.Context, conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) error {
+		return chat.HandleSession(ctx, rooms.Lobby(), conn, channel, requests)
 	})
+	draining := errors.Is(err, sshserver.ErrDraining)
+	if draining {
+		<-hot.drained
+		err = nil
+	} else {
+		_ = sdNotify("STOPPING=1")
+	}
+	// Cancelling ctx ends the sessions still open; give them a moment to tell
+	// their users and send an exit status before the process exits.
+	cancel()
+	shutdownCtx, stopShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer stopShutdown()
+	if err := server.Drain(shutdownCtx); err != nil {
+		logger.Warn("sessions did not end in time", "err", err)
+	}
+	// The new process of a hot restart shares this server's name; leave its
+	// presence entries alone.
+	if backend != nil && !draining {
+		if err := backend.Close(); err != nil {
+			logger.Warn("failed to clear room presence", "err", err)
+		}
+	}
 
 	if err != nil && !errors.Is(err, context.Canceled) {
-		logger.Fatalf("server stopped with error: %v", err)
+		fatal(logger, "server stopped with error", err)
+	}
+}
+
+func buildAuthenticators(ctx context.Context, cfg config.Auth, accounts *sshserver.Accounts) ([]sshserver.Authenticator, error) {
+	var auths []sshserver.Authenticator
+
+	for _, mode := range cfg.Modes {
+		switch strings.TrimSpace(mode) {
+		case "", "none":
+			auths = append(auths, sshserver.NoAuth())
+		case "password":
+			if cfg.PasswordFile == "" {
+				return nil, errors.New("-auth password requires -password-file")
+			}
+			pf, err := sshserver.LoadPasswordFile(cfg.PasswordFile)
+			if err != nil {
+				return nil, err
+			}
+			auths = append(auths, pf)
+		case "pubkey":
+			if cfg.AuthorizedKeys == "" {
+				return nil, errors.New("-auth pubkey requires -authorized-keys")
+			}
+			ak, err := sshserver.LoadAuthorizedKeys(cfg.AuthorizedKeys)
+			if err != nil {
+				return nil, err
+			}
+			auths = append(auths, ak)
+		case "oidc":
+			flow, err := sshserver.NewDeviceFlow(ctx, sshserver.DeviceFlowConfig{
+				Issuer:   cfg.OIDCIssuer,
+				ClientID: cfg.OIDCClientID,
+			})
+			if err != nil {
+				return nil, err
+			}
+			auths = append(auths, flow)
+		default:
+			return nil, fmt.Errorf("unknown auth provider %q", mode)
+		}
+	}
+	// Accounts and then admin keys wrap the callbacks above, so they come last.
+	if accounts != nil {
+		auths = append(auths, accounts)
+	}
+	if cfg.AdminKeys != "" {
+		admin, err := sshserver.LoadAdminKeys(cfg.AdminKeys, cfg.AdminUser)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, admin)
+	}
+
+	return auths, nil
+}
+
+// buildCluster returns this node's view of the cluster, or nil when running
+// standalone.
+func buildCluster(cfg config.Cluster, tlsFiles *cluster.TLS, logger *slog.Logger) (*cluster.Cluster, error) {
+	if cfg.Node == "" {
+		return nil, nil
+	}
+	nodes := make([]cluster.Node, len(cfg.Nodes))
+	for i, n := range cfg.Nodes {
+		nodes[i] = cluster.Node{ID: n.ID, Addr: n.Addr, Admin: n.Admin}
+	}
+	return cluster.New(cfg.Node, nodes,
+		cluster.WithAffinity(cfg.Affinity),
+		cluster.WithSticky(cfg.Sticky),
+		cluster.WithRedirect(cfg.Redirect),
+		cluster.WithTLS(tlsFiles),
+		cluster.WithReplication(cfg.Replicate),
+		cluster.WithLogger(logger),
+	)
+}
+
+// roomBackend is a roomstate.Backend that delivers what other servers post
+// while it runs.
+type roomBackend interface {
+	roomstate.Backend
+	Run(ctx context.Context, deliver func(cluster.Event) error)
+	Close() error
+}
+
+// buildRoomBackend connects to the shared room backend, or returns nil when
+// rooms stay in memory.
+func buildRoomBackend(ctx context.Context, cfg config.Config, store *secrets.Resolver, logger *slog.Logger) (roomBackend, error) {
+	if cfg.RoomBackend.Type == config.RoomBackendMemory {
+		return nil, nil
+	}
+	server := cfg.RoomBackend.Server
+	if server == "" {
+		server = cfg.Cluster.Node
+	}
+	if server == "" {
+		var err error
+		if server, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("server name: %w", err)
+		}
+	}
+	if cfg.RoomBackend.Type == config.RoomBackendNATS {
+		return openNATSRoom(ctx, cfg.RoomBackend.NATS, server, store, logger)
+	}
+
+	rc := cfg.RoomBackend.Redis
+	password, err := store.Resolve(ctx, rc.PasswordEnv)
+	if err != nil {
+		return nil, err
+	}
+	opts := &redis.Options{Addr: rc.Addr, Password: password, DB: rc.DB}
+	if rc.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	client := redis.NewClient(opts)
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis %s: %w", rc.Addr, err)
+	}
+	return redisroom.New(client, server, redisroom.WithPrefix(rc.Prefix), redisroom.WithLogger(logger)), nil
+}
+
+// openNATSRoom connects to NATS and opens the JetStream stream and presence
+// bucket of the shared rooms.
+func openNATSRoom(ctx context.Context, cfg config.NATS, server string, store *secrets.Resolver, logger *slog.Logger) (*natsroom.Backend, error) {
+	token, err := store.Resolve(ctx, cfg.TokenEnv)
+	if err != nil {
+		return nil, err
+	}
+	opts := []nats.Option{
+		nats.Name("schat " + server),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Warn("nats disconnected", "err", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Info("nats reconnected", "url", nc.ConnectedUrl())
+		}),
+	}
+	if token != "" {
+		opts = append(opts, nats.Token(token))
+	}
+	if cfg.Credentials != "" {
+		opts = append(opts, nats.UserCredentials(cfg.Credentials))
+	}
+	nc, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("nats %s: %w", cfg.URL, err)
+	}
+	backend, err := natsroom.Open(nc, server,
+		natsroom.WithStream(cfg.Stream),
+		natsroom.WithPrefix(cfg.Prefix),
+		natsroom.WithRetention(cfg.Retention),
+		natsroom.WithLogger(logger),
+	)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return backend, nil
+}
+
+func loadWordFilter(cfg config.WordFilter) (*wordfilter.Filter, error) {
+	action, err := wordfilter.ParseAction(cfg.Action)
+	if err != nil {
+		return nil, err
+	}
+	return wordfilter.New(cfg.File, cfg.Words, action)
+}
+
+// loadAutomod builds the automod engine. It is built even when the feature
+// is off so operators can turn it on at runtime with /feature.
+func loadAutomod(cfg config.AutoMod) (*automod.Engine, error) {
+	actions, err := automod.ParseActions(cfg.Actions)
+	if err != nil {
+		return nil, err
+	}
+	return automod.New(automod.Config{
+		Repeats:        cfg.Repeats,
+		RepeatWindow:   cfg.RepeatWindow,
+		CapsRatio:      cfg.CapsRatio,
+		CapsMinLetters: cfg.CapsMinLetters,
+		LinkCount:      cfg.Links,
+		LinkWindow:     cfg.LinkWindow,
+		Joins:          cfg.Joins,
+		JoinWindow:     cfg.JoinWindow,
+		Actions:        actions,
+		MuteFor:        cfg.MuteFor,
+		BanFor:         cfg.BanFor,
+		StrikeWindow:   cfg.StrikeWindow,
+	})
+}
+
+// loadAnnouncements parses the schedules of the configured announcements.
+func loadAnnouncements(cfg []config.Announcement) ([]chat.Announcement, error) {
+	out := make([]chat.Announcement, 0, len(cfg))
+	for _, a := range cfg {
+		sched, err := schedule.Parse(a.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chat.Announcement{Schedule: sched, Room: strings.TrimPrefix(a.Room, "#"), Text: a.Text})
+	}
+	return out, nil
+}
+
+// promptSystems gives every configured prompt system a dispatcher that
+// delivers the answers to its callback.
+func promptSystems(cfg []config.PromptSystem, secret string, logger *slog.Logger) []chat.PromptSystem {
+	out := make([]chat.PromptSystem, 0, len(cfg))
+	for _, p := range cfg {
+		rooms := make([]string, 0, len(p.Rooms))
+		for _, room := range p.Rooms {
+			rooms = append(rooms, strings.TrimPrefix(room, "#"))
+		}
+		out = append(out, chat.PromptSystem{
+			Name:      p.Name,
+			Rooms:     rooms,
+			Approvers: p.Approvers,
+			Replies:   webhook.NewDispatcher(secret, []string{p.Callback}, webhook.WithLogger(logger)),
+		})
+	}
+	return out
+}
+
+// addBridges registers the configured bridges with the supervisor, creating
+// the rooms they relay.
+func addBridges(ctx context.Context, sup *bridge.Supervisor, rooms *chat.RoomManager, cfg config.Bridges, res *secrets.Resolver, logger *slog.Logger) error {
+	for _, b := range cfg.IRC {
+		for _, room := range b.Channels {
+			if err := rooms.Ensure(room); err != nil {
+				return err
+			}
+		}
+		password, err := res.Resolve(ctx, b.PasswordEnv)
+		if err != nil {
+			return fmt.Errorf("irc bridge %q: %w", b.Name, err)
+		}
+		conn := irc.New(irc.Config{
+			Name:     b.Name,
+			Server:   b.Server,
+			TLS:      b.TLS,
+			Nick:     b.Nick,
+			Password: password,
+			Channels: b.Channels,
+		}, rooms.PostBridged, irc.WithLogger(logger))
+		if err := sup.Add(conn); err != nil {
+			return err
+		}
+	}
+	for _, b := range cfg.Matrix {
+		for _, room := range b.Rooms {
+			if err := rooms.Ensure(room); err != nil {
+				return err
+			}
+		}
+		token, err := res.Resolve(ctx, b.TokenEnv)
+		if err != nil {
+			return fmt.Errorf("matrix bridge %q: %w", b.Name, err)
+		}
+		if token == "" {
+			return fmt.Errorf("matrix bridge %q: %s must hold the access token", b.Name, refName(b.TokenEnv))
+		}
+		conn := matrix.New(matrix.Config{
+			Name:        b.Name,
+			Homeserver:  b.Homeserver,
+			AccessToken: token,
+			Rooms:       b.Rooms,
+		}, rooms.PostBridged, matrix.WithLogger(logger))
+		if err := sup.Add(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// historyPruneInterval is how often pruneHistory deletes expired messages.
+const historyPruneInterval = time.Hour
+
+// shutdownTimeout bounds how long a stopping server waits for its sessions to
+// end.
+const shutdownTimeout = 5 * time.Second
+
+// pruneHistory deletes messages older than retention from st now and then
+// every historyPruneInterval until ctx is cancelled.
+func pruneHistory(ctx context.Context, st store.Store, retention time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+	for {
+		n, err := st.Prune(ctx, time.Now().Add(-retention))
+		if err != nil {
+			logger.Error("store: prune history failed", "err", err)
+		} else if n > 0 {
+			logger.Info("store: pruned history", "messages", n, "retention", retention)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveHTTP serves handler, e.g. the expvar metrics and admin endpoints, on
+// addr until ctx is cancelled, over HTTPS when tlsConfig is set. name
+// prefixes its log messages.
+func serveHTTP(ctx context.Context, name string, ln net.Listener, handler http.Handler, tlsConfig *tls.Config, logger *slog.Logger) {
+	srv := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	logger.Info(name+": listening", "addr", ln.Addr().String(), "tls", tlsConfig != nil)
+	serve := func() error { return srv.Serve(ln) }
+	if tlsConfig != nil {
+		// The certificate comes from tlsConfig, which may rotate it.
+		serve = func() error { return srv.ServeTLS(ln, "", "") }
+	}
+	if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error(name+": server failed", "err", err)
+	}
+}
+
+// serveGRPC serves srv on ln until ctx is cancelled. name prefixes its log
+// messages.
+func serveGRPC(ctx context.Context, name string, ln net.Listener, srv *grpc.Server, logger *slog.Logger) {
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+
+	logger.Info(name+": listening", "addr", ln.Addr().String(), "tls", true)
+	if err := srv.Serve(ln); err != nil {
+		logger.Error(name+": server failed", "err", err)
 	}
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/ledzpl/schat/pkg/config"
+	"github.com/ledzpl/schat/pkg/sshserver"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshPolicy returns the configured algorithm preset with the config's
+// overrides applied.
+func sshPolicy(cfg config.Security) (sshserver.Policy, error) {
+	p, err := sshserver.ParsePolicy(cfg.Policy)
+	if err != nil {
+		return sshserver.Policy{}, err
+	}
+	custom := false
+	if len(cfg.KeyExchanges) > 0 {
+		p.KeyExchanges, custom = cfg.KeyExchanges, true
+	}
+	if len(cfg.Ciphers) > 0 {
+		p.Ciphers, custom = cfg.Ciphers, true
+	}
+	if len(cfg.MACs) > 0 {
+		p.MACs, custom = cfg.MACs, true
+	}
+	if cfg.MinRSABits > 0 {
+		p.MinRSABits, custom = cfg.MinRSABits, true
+	}
+	if custom {
+		p.Name += "+custom"
+	}
+	if err := p.Validate(); err != nil {
+		return sshserver.Policy{}, fmt.Errorf("security: %w", err)
+	}
+	return p, nil
+}
+
+// reportPolicy logs the algorithms the server will negotiate and warns about
+// the weak ones and weak host keys.
+func reportPolicy(p sshserver.Policy, signers []ssh.Signer, logger *slog.Logger) {
+	logger.Info("ssh policy in effect", p.Report()...)
+	for _, warning := range p.Warnings(signers...) {
+		logger.Warn("weak ssh configuration", "policy", p.Name, "detail", warning)
+	}
+}
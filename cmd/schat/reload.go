@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/template"
+
+	"github.com/ledzpl/schat/internal/chat"
+	"github.com/ledzpl/schat/pkg/audit"
+	"github.com/ledzpl/schat/pkg/buildinfo"
+	"github.com/ledzpl/schat/pkg/cluster"
+	"github.com/ledzpl/schat/pkg/config"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// liveSettings are the parts of the configuration that SIGHUP can change
+// without a restart, already loaded from the files they point at.
+type liveSettings struct {
+	rooms  chat.Settings
+	banner string
+}
+
+func loadLiveSettings(cfg config.Config) (liveSettings, error) {
+	live := liveSettings{
+		rooms: chat.Settings{
+			ServerName: cfg.ServerName,
+			Operators:  cfg.Operators,
+			AutoAway:   cfg.Limits.AutoAway,
+		},
+	}
+
+	var err error
+	if cfg.MOTD != "" {
+		if live.rooms.MOTD, err = chat.LoadMOTD(cfg.MOTD); err != nil {
+			return liveSettings{}, err
+		}
+	}
+	if cfg.Banner != "" {
+		if live.banner, err = loadBanner(cfg.Banner, cfg.ServerName); err != nil {
+			return liveSettings{}, err
+		}
+	}
+	return live, nil
+}
+
+// reloader re-reads the configuration on SIGHUP and applies the reloadable
+// settings. A config that fails to load or validate is ignored as a whole.
+type reloader struct {
+	loader  *config.Loader
+	started config.Config
+	server  *sshserver.Server
+	rooms   *chat.RoomManager
+	level   *slog.LevelVar
+	// serverLog is nil when #server-log is off.
+	serverLog *chat.ServerLog
+	// clusterTLS is re-read on every reload so node keys can be rotated.
+	clusterTLS *cluster.TLS
+	// controlTLS is re-read likewise for the control API.
+	controlTLS *cluster.TLS
+	audit      *audit.Log
+	logger     *slog.Logger
+}
+
+func (r *reloader) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload()
+		}
+	}
+}
+
+func (r *reloader) reload() {
+	next, err := r.loader.Load()
+	if err != nil {
+		r.logger.Error("config: reload failed, keeping current settings", "err", err)
+		return
+	}
+	live, err := loadLiveSettings(next)
+	if err != nil {
+		r.logger.Error("config: reload failed, keeping current settings", "err", err)
+		return
+	}
+	if err := r.rooms.Ensure(next.Rooms...); err != nil {
+		r.logger.Error("config: reload failed, keeping current settings", "err", err)
+		return
+	}
+
+	level, _ := next.Log.SlogLevel() // validated by Load
+	r.level.Set(level)
+	if roomLevel, on, _ := next.Log.RoomSlogLevel(); on && r.serverLog != nil {
+		r.serverLog.SetLevel(roomLevel)
+	}
+	r.rooms.Reload(live.rooms)
+	r.server.SetBanner(live.banner)
+	r.server.SetConnLimits(next.Limits.MaxClients, next.Limits.MaxPerIP)
+	if r.clusterTLS != nil {
+		if err := r.clusterTLS.Reload(); err != nil {
+			r.logger.Error("config: cluster tls reload failed, keeping current keys", "err", err)
+		}
+	}
+	if r.controlTLS != nil {
+		if err := r.controlTLS.Reload(); err != nil {
+			r.logger.Error("config: control_api tls reload failed, keeping current keys", "err", err)
+		}
+	}
+
+	reason := "applied"
+	if changed := r.started.RestartRequired(next); len(changed) > 0 {
+		r.logger.Warn("config: restart required to apply some changes", "settings", strings.Join(changed, ", "))
+		reason = "restart required for " + strings.Join(changed, ", ")
+	}
+	r.logger.Info("config: reloaded", "path", r.loader.Path(), "audit", true)
+	if err := r.audit.Record(audit.Entry{Actor: "SIGHUP", Action: audit.Reload, Target: r.loader.Path(), Reason: reason}); err != nil {
+		r.logger.Error("config: audit log write failed", "err", err)
+	}
+}
+
+// bannerData is the data available to banner templates, e.g.
+// "{{.ServerName}} {{.Version}} (commit {{.Commit}}, built {{.Date}})".
+type bannerData struct {
+	ServerName string
+	buildinfo.Info
+}
+
+// loadBanner reads and renders the pre-auth banner template, normalising line
+// endings to CRLF.
+func loadBanner(path, serverName string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New("banner").Parse(string(data))
+	if err != nil {
+		return "", fmt.Errorf("parse banner %q: %w", path, err)
+	}
+	if serverName == "" {
+		serverName = "schat"
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, bannerData{ServerName: serverName, Info: buildinfo.Get()}); err != nil {
+		return "", fmt.Errorf("render banner %q: %w", path, err)
+	}
+	text := strings.ReplaceAll(buf.String(), "\r\n", "\n")
+	return strings.ReplaceAll(text, "\n", "\r\n"), nil
+}
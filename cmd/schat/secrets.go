@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/config"
+	"github.com/ledzpl/schat/pkg/secrets"
+)
+
+// newSecrets returns the resolver for the secret references in the config.
+// The Vault token is itself read through env: or file: first.
+func newSecrets(ctx context.Context, cfg config.Secrets) (*secrets.Resolver, error) {
+	if cfg.Vault.Addr == "" {
+		return secrets.New(), nil
+	}
+	token, err := secrets.New().Resolve(ctx, cfg.Vault.Token)
+	if err != nil {
+		return nil, fmt.Errorf("secrets vault token: %w", err)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("secrets vault token: %s is not set", refName(cfg.Vault.Token))
+	}
+	vault := secrets.NewVault(cfg.Vault.Addr, token, secrets.WithNamespace(cfg.Vault.Namespace))
+	return secrets.New(secrets.WithProvider(secrets.SchemeVault, vault)), nil
+}
+
+// refName renders a secret reference for messages: "$NAME" for a bare
+// variable name and the reference itself otherwise.
+func refName(ref string) string {
+	if strings.Contains(ref, ":") {
+		return ref
+	}
+	return "$" + ref
+}
+
+// secretRefs lists the settings that may hold secret references, so that a
+// hardened server can still read the file: ones.
+func secretRefs(cfg config.Config) []string {
+	refs := []string{cfg.HostKey, cfg.HostKeyPassphraseEnv, cfg.DBKeyEnv, cfg.Translate.APIKeyEnv,
+		cfg.Webhooks.SecretEnv, cfg.AdminAPI.TokenEnv, cfg.RoomBackend.Redis.PasswordEnv, cfg.RoomBackend.NATS.TokenEnv, cfg.Secrets.Vault.Token}
+	refs = append(refs, cfg.HostKeys...)
+	for _, b := range cfg.Bridges.IRC {
+		refs = append(refs, b.PasswordEnv)
+	}
+	for _, b := range cfg.Bridges.Matrix {
+		refs = append(refs, b.TokenEnv)
+	}
+	return refs
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/config"
+)
+
+// listenFDsStart is the first descriptor systemd passes to an activated
+// service.
+const listenFDsStart = 3
+
+// activatedListeners picks up the sockets systemd passed with socket
+// activation, keyed by the address they serve. A socket named "metrics",
+// "webhook", "admin-api", "control-api", "web", or "telnet" with
+// FileDescriptorName= serves metrics_addr, webhooks.addr, admin_api.addr,
+// control_api.addr, web_gateway.addr, or telnet.addr; any other serves addr.
+// The variables are cleared so that a re-executed hardened server does not
+// pick the sockets up again.
+func activatedListeners(cfg config.Config) (listeners, error) {
+	defer func() {
+		for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			_ = os.Unsetenv(name)
+		}
+	}()
+	activated := listeners{}
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return activated, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return activated, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < count; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		addr, key := cfg.Addr, "addr"
+		switch name {
+		case "metrics":
+			addr, key = cfg.MetricsAddr, "metrics_addr"
+		case "webhook":
+			addr, key = cfg.Webhooks.Addr, "webhooks.addr"
+		case "admin-api":
+			addr, key = cfg.AdminAPI.Addr, "admin_api.addr"
+		case "control-api":
+			addr, key = cfg.ControlAPI.Addr, "control_api.addr"
+		case "web":
+			addr, key = cfg.WebGateway.Addr, "web_gateway.addr"
+		case "telnet":
+			addr, key = cfg.Telnet.Addr, "telnet.addr"
+		}
+		if addr == "" {
+			return nil, fmt.Errorf("socket activation: socket %q needs %s to be set", name, key)
+		}
+		if _, ok := activated[addr]; ok {
+			return nil, fmt.Errorf("socket activation: more than one socket for %s", key)
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: socket %q: %w", name, err)
+		}
+		activated[addr] = ln
+	}
+	return activated, nil
+}
+
+// sdNotify sends state, e.g. "READY=1", to the service manager when it asked
+// for notifications with $NOTIFY_SOCKET, as a Type=notify service does.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	return nil
+}
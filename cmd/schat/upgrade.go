@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ledzpl/schat/internal/chat"
+)
+
+// announceUpgrades tells everyone connected that the server is about to be
+// replaced whenever it receives SIGUSR2, e.g. from a deploy script just before
+// it starts the new release. POST /debug/upgrade, with the admin token, can
+// also name the release and when this server goes away.
+func announceUpgrades(ctx context.Context, rooms *chat.RoomManager) {
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+	defer signal.Stop(usr2)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-usr2:
+			rooms.AnnounceUpgrade(chat.UpgradeNotice{})
+		}
+	}
+}
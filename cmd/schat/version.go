@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ledzpl/schat/pkg/buildinfo"
+)
+
+// runVersion prints the build information: schat version, or schat --version.
+func runVersion(args []string) int {
+	fs := flag.NewFlagSet("schat version", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the build information as JSON")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	info := buildinfo.Get()
+	if !*asJSON {
+		fmt.Println(info)
+		return 0
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "schat version:", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
@@ -0,0 +1,219 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/audit"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// adminRequestTimeout bounds how long an admin connection may take to send
+// its exec request.
+const adminRequestTimeout = 10 * time.Second
+
+// adminCommand is a one-shot moderation command run over an SSH exec channel
+// by a connection authenticated with an admin key.
+type adminCommand struct {
+	usage   string
+	summary string
+	run     func(a *adminExec, args string) error
+}
+
+var adminCommands map[string]*adminCommand
+
+func init() {
+	// Assigned in init because help lists adminCommands itself.
+	adminCommands = map[string]*adminCommand{
+		"help":     {usage: "help", summary: "list admin commands", run: runAdminHelp},
+		"who":      {usage: "who", summary: "list connected users and their rooms", run: runAdminWho},
+		"kick":     {usage: "kick <user> [reason]", summary: "disconnect every session of user", run: runAdminKick},
+		"announce": {usage: "announce <text>", summary: "post a system message to every room", run: runAdminAnnounce},
+	}
+}
+
+var (
+	// errAdminUsage marks a command that was called with the wrong arguments.
+	errAdminUsage   = errors.New("usage")
+	errAdminShell   = errors.New("admin keys cannot open a shell")
+	errAdminTimeout = errors.New("no admin command received in time")
+)
+
+// adminExec runs one admin command and reports its outcome like a shell
+// command: output on stdout, errors on stderr, and an exit status.
+type adminExec struct {
+	room  *Room
+	admin string
+	out   io.Writer
+	log   *slog.Logger
+}
+
+// serveAdmin handles a connection authenticated with an admin key. Like an
+// OpenSSH forced command, only exec requests are honoured: shells, ptys, and
+// subsystems are refused so the key cannot open a chat session.
+func serveAdmin(ctx context.Context, room *Room, info ClientInfo, channel ssh.Channel, requests <-chan *ssh.Request, fingerprint string) error {
+	log := room.logger.With("session_id", info.SessionID, "remote_addr", info.RemoteAddr, "username", info.Username, "key", fingerprint)
+
+	timeout := time.NewTimer(adminRequestTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				return sshserver.Exit(sshserver.ExitClientGone, nil)
+			}
+			switch req.Type {
+			case "exec":
+			case "shell":
+				// Accept the shell only to explain why it ends at once.
+				req.Reply(true, nil)
+				fmt.Fprintln(channel.Stderr(), "schat: admin keys can only run commands, e.g. ssh admin@host help")
+				return sshserver.Exit(sshserver.ExitFailed, errAdminShell)
+			case "env":
+				req.Reply(true, nil)
+				continue
+			default:
+				req.Reply(false, nil)
+				continue
+			}
+
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				return fmt.Errorf("chat: admin exec request: %w", err)
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+
+			a := &adminExec{room: room, admin: info.Username, out: channel, log: log}
+			if err := a.run(payload.Command); err != nil {
+				fmt.Fprintf(channel.Stderr(), "schat: %v\n", err)
+				return sshserver.Exit(sshserver.ExitFailed, err)
+			}
+			return nil
+		case <-timeout.C:
+			return errAdminTimeout
+		case <-ctx.Done():
+			return sshserver.ContextExit(ctx)
+		}
+	}
+}
+
+// run parses and executes one command line.
+func (a *adminExec) run(line string) error {
+	name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	args = strings.TrimSpace(args)
+	cmd, ok := adminCommands[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown admin command %q (try help)", name)
+	}
+	a.log.Info("chat: admin command", "command", name, "args", args)
+	err := cmd.run(a, args)
+	if errors.Is(err, errAdminUsage) {
+		return fmt.Errorf("usage: %s", cmd.usage)
+	}
+	return err
+}
+
+func (a *adminExec) println(format string, args ...any) {
+	fmt.Fprintf(a.out, format+"\n", args...)
+}
+
+// rooms returns every room on this server.
+func (a *adminExec) rooms() []*Room {
+	if a.room.manager == nil {
+		return []*Room{a.room}
+	}
+	return a.room.manager.Rooms()
+}
+
+func runAdminHelp(a *adminExec, _ string) error {
+	names := make([]string, 0, len(adminCommands))
+	for name := range adminCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := adminCommands[name]
+		a.println("%-22s %s", cmd.usage, cmd.summary)
+	}
+	return nil
+}
+
+func runAdminWho(a *adminExec, _ string) error {
+	for _, room := range a.rooms() {
+		now := room.now()
+		for _, client := range room.Clients() {
+			a.println("%-16s #%-12s idle %s", client.Username, room.Name(), formatIdle(now.Sub(client.LastActive())))
+		}
+	}
+	return nil
+}
+
+func runAdminKick(a *adminExec, args string) error {
+	user, reason, _ := strings.Cut(args, " ")
+	reason = strings.TrimSpace(reason)
+	if user == "" {
+		return errAdminUsage
+	}
+
+	kicked := kickUser(a.rooms(), a.admin, user, reason)
+	if kicked == 0 {
+		return fmt.Errorf("%v: %s", errNoSuchUser, user)
+	}
+	a.println("kicked %d session(s) of %s", kicked, user)
+	return nil
+}
+
+func runAdminAnnounce(a *adminExec, args string) error {
+	text := stripControl(args)
+	if text == "" {
+		return errAdminUsage
+	}
+	a.println("announced in %d room(s)", announce(a.rooms(), a.admin, text))
+	return nil
+}
+
+// kickUser disconnects every session of user in rooms, telling each room who
+// kicked them and why, and returns how many there were.
+func kickUser(rooms []*Room, actor, user, reason string) int {
+	kicked := 0
+	for _, room := range rooms {
+		for _, client := range room.Clients() {
+			if client.Username == user {
+				kickClient(room, client, actor, reason)
+				kicked++
+			}
+		}
+	}
+	return kicked
+}
+
+// kickClient disconnects client from room, telling the room who kicked it
+// and why.
+func kickClient(room *Room, client *Client, actor, reason string) {
+	notice := fmt.Sprintf("%s was kicked by %s", client.Username, actor)
+	if reason != "" {
+		notice += ": " + stripControl(reason)
+	}
+	room.broadcastSystem(notice)
+	client.disconnect(sshserver.Exit(sshserver.ExitKicked, errors.New(notice)))
+	room.audit(audit.Entry{Actor: actor, Action: audit.Kick, Target: client.Username, Reason: reason})
+}
+
+// announce posts text from actor to every room in rooms and returns how many
+// there are. text must already be stripped of control characters.
+func announce(rooms []*Room, actor, text string) int {
+	for _, room := range rooms {
+		room.broadcastSystem(fmt.Sprintf("announcement from %s: %s", actor, text))
+	}
+	return len(rooms)
+}
@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// dialAdmin connects to room as if authenticated with an admin key.
+func dialAdmin(t *testing.T, room *Room) *ssh.Client {
+	t.Helper()
+	return dialSSHWith(t, room, "admin", &ssh.ServerConfig{
+		NoClientAuth: true,
+		NoClientAuthCallback: func(ssh.ConnMetadata) (*ssh.Permissions, error) {
+			return &ssh.Permissions{Extensions: map[string]string{
+				sshserver.ExtAuthMethod: "publickey",
+				sshserver.ExtAdmin:      "1",
+			}}, nil
+		},
+	})
+}
+
+// adminRun runs command over exec and returns its stdout, stderr, and exit status.
+func adminRun(t *testing.T, client *ssh.Client, command string) (string, string, int) {
+	t.Helper()
+	sess, err := client.NewSession()
+	require.NoError(t, err)
+	defer sess.Close()
+
+	var stdout, stderr strings.Builder
+	sess.Stdout, sess.Stderr = &stdout, &stderr
+	err = sess.Run(command)
+	var exit *ssh.ExitError
+	if errors.As(err, &exit) {
+		return stdout.String(), stderr.String(), exit.ExitStatus()
+	}
+	require.NoError(t, err)
+	return stdout.String(), stderr.String(), 0
+}
+
+func TestAdminExecKick(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "")
+	require.NoError(t, err)
+	watcher := m.Lobby().AddClient("watcher")
+	bob := dev.AddClient("bob")
+	carol := dev.AddClient("carol")
+	kicked := make(chan *sshserver.SessionExit, 1)
+	bob.setDisconnectHandler(func(exit *sshserver.SessionExit) { kicked <- exit })
+	drainChannel(watcher.Send())
+	drainChannel(carol.Send())
+
+	admin := dialAdmin(t, m.Lobby())
+	out, _, status := adminRun(t, admin, "who")
+	require.Zero(t, status)
+	require.Regexp(t, `watcher +#lobby`, out)
+	require.Regexp(t, `bob +#dev`, out)
+
+	out, _, status = adminRun(t, admin, "kick bob spamming")
+	require.Zero(t, status)
+	require.Equal(t, "kicked 1 session(s) of bob\n", out)
+	exit := <-kicked
+	require.Equal(t, sshserver.ExitKicked, exit.Reason)
+	require.Equal(t, "bob was kicked by admin: spamming", exit.Error())
+	require.Equal(t, "bob was kicked by admin: spamming", (<-carol.Send()).Body)
+
+	_, errOut, status := adminRun(t, admin, "kick nobody")
+	require.Equal(t, 1, status)
+	require.Equal(t, "schat: no such user: nobody\n", errOut)
+
+	_, errOut, status = adminRun(t, admin, "kick")
+	require.Equal(t, 1, status)
+	require.Contains(t, errOut, "usage: kick <user> [reason]")
+
+	_, errOut, status = adminRun(t, admin, "rm -rf /")
+	require.Equal(t, 1, status)
+	require.Contains(t, errOut, `unknown admin command "rm"`)
+}
+
+func TestAdminExecAnnounce(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "")
+	require.NoError(t, err)
+	bob := dev.AddClient("bob")
+	drainChannel(bob.Send())
+
+	out, _, status := adminRun(t, dialAdmin(t, m.Lobby()), "announce restarting at 5pm")
+	require.Zero(t, status)
+	require.Equal(t, "announced in 2 room(s)\n", out)
+	require.Equal(t, "announcement from admin: restarting at 5pm", (<-bob.Send()).Body)
+}
+
+func TestAdminKeyCannotOpenShell(t *testing.T) {
+	room := NewRoom()
+	sess, err := dialAdmin(t, room).NewSession()
+	require.NoError(t, err)
+	var stderr strings.Builder
+	sess.Stderr = &stderr
+	require.NoError(t, sess.Shell())
+
+	var exit *ssh.ExitError
+	require.ErrorAs(t, sess.Wait(), &exit)
+	require.Equal(t, 1, exit.ExitStatus())
+	require.Contains(t, stderr.String(), "admin keys can only run commands")
+	require.Zero(t, room.ClientCount(), "admin connections never join the chat")
+}
@@ -0,0 +1,175 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/ledzpl/schat/pkg/adminapi"
+	"github.com/ledzpl/schat/pkg/controlapi"
+)
+
+// AdminBackend returns the rooms as the backend of the admin HTTP API.
+func (m *RoomManager) AdminBackend() adminapi.Backend {
+	return adminBackend{m}
+}
+
+// ControlBackend returns the rooms as the backend of the gRPC control API.
+func (m *RoomManager) ControlBackend() controlapi.Backend {
+	return adminBackend{m}
+}
+
+// adminBackend serves the admin HTTP and gRPC control APIs from a room
+// manager.
+type adminBackend struct {
+	m *RoomManager
+}
+
+// Sessions lists the connected sessions of every room, room by room.
+func (b adminBackend) Sessions() []adminapi.Session {
+	var sessions []adminapi.Session
+	for _, room := range b.m.Rooms() {
+		for _, client := range room.Clients() {
+			sessions = append(sessions, adminapi.Session{
+				ID:            client.ID,
+				User:          client.Username,
+				Room:          room.Name(),
+				RemoteAddr:    client.RemoteAddr,
+				ClientVersion: client.ClientVersion,
+				AuthMethod:    client.AuthMethod,
+				Operator:      client.Operator,
+				JoinedAt:      client.JoinedAt,
+				LastActive:    client.LastActive(),
+			})
+		}
+	}
+	return sessions
+}
+
+// Rooms lists every room.
+func (b adminBackend) Rooms() []adminapi.Room {
+	rooms := b.m.Rooms()
+	summaries := make([]adminapi.Room, 0, len(rooms))
+	for _, room := range rooms {
+		_, archived := room.Archived()
+		summaries = append(summaries, adminapi.Room{
+			Name:         room.Name(),
+			Topic:        room.Topic(),
+			Owner:        room.Owner(),
+			Members:      room.ClientCount(),
+			Archived:     archived,
+			LastActivity: room.LastActivity(),
+		})
+	}
+	return summaries
+}
+
+// Messages returns up to limit of the newest messages room keeps in memory,
+// oldest first.
+func (b adminBackend) Messages(room string, limit int) ([]adminapi.Message, error) {
+	r, ok := b.m.Room(room)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", adminapi.ErrUnknownRoom, room)
+	}
+	recent := r.history.Recent(limit)
+	msgs := make([]adminapi.Message, 0, len(recent))
+	for _, msg := range recent {
+		msgs = append(msgs, adminapi.Message{
+			Room:    r.Name(),
+			ID:      msg.ID,
+			Time:    msg.Timestamp,
+			Kind:    msg.Kind.String(),
+			From:    msg.SenderName,
+			Body:    msg.Body,
+			Edited:  msg.Edited,
+			Deleted: msg.Deleted,
+		})
+	}
+	return msgs, nil
+}
+
+// Kick disconnects every session of user, like the kick admin command.
+func (b adminBackend) Kick(actor, user, reason string) (int, error) {
+	b.m.lobby.logger.Info("chat: admin API", "action", "kick", "user", user, "reason", reason)
+	if kicked := kickUser(b.m.Rooms(), actor, user, reason); kicked > 0 {
+		return kicked, nil
+	}
+	return 0, fmt.Errorf("%w: %s", adminapi.ErrUnknownUser, user)
+}
+
+// Announce posts text to every room, like the announce admin command.
+func (b adminBackend) Announce(actor, text string) int {
+	b.m.lobby.logger.Info("chat: admin API", "action", "announce", "text", text)
+	return announce(b.m.Rooms(), actor, stripControl(text))
+}
+
+// KickSession disconnects the session with id.
+func (b adminBackend) KickSession(actor, id, reason string) (string, error) {
+	for _, room := range b.m.Rooms() {
+		if client, ok := room.client(id); ok {
+			b.m.lobby.logger.Info("chat: control API", "action", "kick", "actor", actor, "session_id", id, "user", client.Username, "reason", reason)
+			kickClient(room, client, actor, reason)
+			return client.Username, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", controlapi.ErrUnknownSession, id)
+}
+
+// Broadcast posts text to room, or to every room when room is "".
+func (b adminBackend) Broadcast(actor, room, text string) (int, error) {
+	rooms, err := b.rooms(room)
+	if err != nil {
+		return 0, err
+	}
+	b.m.lobby.logger.Info("chat: control API", "action", "announce", "actor", actor, "room", room, "text", text)
+	return announce(rooms, actor, stripControl(text)), nil
+}
+
+// RoomStats reports on room, or on every room when room is "".
+func (b adminBackend) RoomStats(room string) ([]controlapi.RoomStats, error) {
+	rooms, err := b.rooms(room)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]controlapi.RoomStats, 0, len(rooms))
+	for _, r := range rooms {
+		mem := r.MemoryStats()
+		_, archived := r.Archived()
+		stats = append(stats, controlapi.RoomStats{
+			Room: adminapi.Room{
+				Name:         r.Name(),
+				Topic:        r.Topic(),
+				Owner:        r.Owner(),
+				Members:      mem.Clients,
+				Archived:     archived,
+				LastActivity: r.LastActivity(),
+			},
+			HistoryMessages: mem.HistoryMessages,
+			HistoryBytes:    mem.HistoryBytes,
+			QueuedBytes:     mem.QueuedBytes,
+		})
+	}
+	return stats, nil
+}
+
+// Watch delivers the messages posted in room, or in every room when room is
+// "".
+func (b adminBackend) Watch(room string) (<-chan adminapi.Message, func(), error) {
+	if room != "" {
+		if _, ok := b.m.Room(room); !ok {
+			return nil, nil, fmt.Errorf("%w: %s", adminapi.ErrUnknownRoom, room)
+		}
+	}
+	msgs, stop := b.m.watchers.watch(room)
+	return msgs, stop, nil
+}
+
+// rooms returns the named room, or every room for "".
+func (b adminBackend) rooms(name string) ([]*Room, error) {
+	if name == "" {
+		return b.m.Rooms(), nil
+	}
+	room, ok := b.m.Room(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", adminapi.ErrUnknownRoom, name)
+	}
+	return []*Room{room}, nil
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/adminapi"
+	"github.com/ledzpl/schat/pkg/controlapi"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+func TestAdminBackend(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	alice := dev.AddClient("alice")
+	bob := dev.AddClient("bob")
+	watcher := m.Lobby().AddClient("watcher")
+	kicked := make(chan *sshserver.SessionExit, 1)
+	bob.setDisconnectHandler(func(exit *sshserver.SessionExit) { kicked <- exit })
+	_, err = dev.Broadcast(alice.ID, "alice", "hello")
+	require.NoError(t, err)
+	drainChannel(alice.Send())
+	drainChannel(watcher.Send())
+
+	api := httptest.NewServer(adminapi.Handler("s3cret", m.AdminBackend()))
+	defer api.Close()
+	call := func(method, path, body string, v any) int {
+		req, err := http.NewRequest(method, api.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil && resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+
+	var sessions []adminapi.Session
+	require.Equal(t, http.StatusOK, call(http.MethodGet, "/api/sessions", "", &sessions))
+	var where []string
+	for _, s := range sessions {
+		where = append(where, s.User+"@"+s.Room)
+	}
+	require.ElementsMatch(t, []string{"watcher@lobby", "alice@dev", "bob@dev"}, where)
+
+	var rooms []adminapi.Room
+	require.Equal(t, http.StatusOK, call(http.MethodGet, "/api/rooms", "", &rooms))
+	members := make(map[string]int)
+	for _, r := range rooms {
+		members[r.Name] = r.Members
+	}
+	require.Equal(t, map[string]int{"lobby": 1, "dev": 2}, members)
+
+	var msgs []adminapi.Message
+	require.Equal(t, http.StatusOK, call(http.MethodGet, "/api/messages?room=dev&limit=1", "", &msgs))
+	require.Len(t, msgs, 1)
+	require.Equal(t, "chat", msgs[0].Kind)
+	require.Equal(t, "alice", msgs[0].From)
+	require.Equal(t, "hello", msgs[0].Body)
+	require.Equal(t, http.StatusNotFound, call(http.MethodGet, "/api/messages?room=ops", "", nil))
+
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/api/kick", `{"user":"bob","reason":"spam"}`, nil))
+	exit := <-kicked
+	require.Equal(t, sshserver.ExitKicked, exit.Reason)
+	require.ErrorContains(t, exit, "bob was kicked by admin-api: spam")
+	require.Equal(t, http.StatusNotFound, call(http.MethodPost, "/api/kick", `{"user":"nobody"}`, nil))
+
+	var announced map[string]int
+	require.Equal(t, http.StatusOK, call(http.MethodPost, "/api/announce", `{"text":"restart at 10"}`, &announced))
+	require.Equal(t, map[string]int{"rooms": 2}, announced)
+	msg := <-watcher.Send()
+	require.Equal(t, KindSystem, msg.Kind)
+	require.Equal(t, "announcement from admin-api: restart at 10", msg.Body)
+}
+
+func TestControlBackend(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	alice := dev.AddClient("alice")
+	bob := dev.AddClient("bob")
+	watcher := m.Lobby().AddClient("watcher")
+	kicked := make(chan *sshserver.SessionExit, 1)
+	bob.setDisconnectHandler(func(exit *sshserver.SessionExit) { kicked <- exit })
+	drainChannel(alice.Send())
+	drainChannel(watcher.Send())
+	backend := m.ControlBackend()
+
+	msgs, stop, err := backend.Watch("dev")
+	require.NoError(t, err)
+	defer stop()
+	_, _, err = backend.Watch("ops")
+	require.ErrorIs(t, err, adminapi.ErrUnknownRoom)
+	_, err = dev.Broadcast(alice.ID, "alice", "hello")
+	require.NoError(t, err)
+	drainChannel(alice.Send())
+	msg := <-msgs
+	require.Equal(t, "dev", msg.Room)
+	require.Equal(t, "chat", msg.Kind)
+	require.Equal(t, "alice", msg.From)
+	require.Equal(t, "hello", msg.Body)
+
+	stats, err := backend.RoomStats("dev")
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	require.Equal(t, 2, stats[0].Members)
+	mem := dev.MemoryStats()
+	require.Equal(t, mem.HistoryMessages, stats[0].HistoryMessages)
+	require.Equal(t, mem.HistoryBytes, stats[0].HistoryBytes)
+	_, err = backend.RoomStats("ops")
+	require.ErrorIs(t, err, adminapi.ErrUnknownRoom)
+
+	rooms, err := backend.Broadcast("dashboard", "dev", "deploying")
+	require.NoError(t, err)
+	require.Equal(t, 1, rooms)
+	require.Equal(t, "announcement from dashboard: deploying", (<-alice.Send()).Body)
+	require.Zero(t, len(watcher.Send()), "other rooms are left alone")
+	_, err = backend.Broadcast("dashboard", "ops", "deploying")
+	require.ErrorIs(t, err, adminapi.ErrUnknownRoom)
+
+	user, err := backend.KickSession("dashboard", bob.ID, "spam")
+	require.NoError(t, err)
+	require.Equal(t, "bob", user)
+	exit := <-kicked
+	require.Equal(t, sshserver.ExitKicked, exit.Reason)
+	require.ErrorContains(t, exit, "bob was kicked by dashboard: spam")
+	_, err = backend.KickSession("dashboard", "nope", "")
+	require.ErrorIs(t, err, controlapi.ErrUnknownSession)
+}
@@ -0,0 +1,245 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/schedule"
+)
+
+// announceCheckInterval is how often the manager looks for due
+// announcements. Schedules have minute resolution.
+const announceCheckInterval = 10 * time.Second
+
+// announceNextFormat shows when a scheduled announcement fires next.
+const announceNextFormat = "Mon 2006-01-02 15:04"
+
+var errNoSuchAnnouncement = errors.New("no such announcement")
+
+// Announcement is a system message posted on a schedule, e.g. a maintenance
+// reminder.
+type Announcement struct {
+	Schedule schedule.Schedule
+	// Room is where it is posted; empty posts in every room.
+	Room string
+	Text string
+}
+
+// scheduledAnnouncement is an Announcement the manager is running.
+type scheduledAnnouncement struct {
+	Announcement
+	ID int
+	// By is the operator who added it at runtime, empty for configured ones.
+	By   string
+	next time.Time
+}
+
+// announcer holds the scheduled announcements of a RoomManager.
+type announcer struct {
+	mu     sync.Mutex
+	lastID int
+	list   []*scheduledAnnouncement
+}
+
+// WithAnnouncements schedules announcements when the manager starts.
+// Operators add and remove more at runtime with /announce.
+func WithAnnouncements(list ...Announcement) ManagerOption {
+	return func(m *RoomManager) {
+		for _, a := range list {
+			m.announcer.add(a, "", time.Time{})
+		}
+	}
+}
+
+// add schedules ann from now; a zero now defers that to the first check.
+func (a *announcer) add(ann Announcement, by string, now time.Time) scheduledAnnouncement {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastID++
+	s := &scheduledAnnouncement{Announcement: ann, ID: a.lastID, By: by}
+	if !now.IsZero() {
+		s.next = ann.Schedule.Next(now)
+	}
+	a.list = append(a.list, s)
+	return *s
+}
+
+func (a *announcer) remove(id int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, s := range a.list {
+		if s.ID == id {
+			a.list = append(a.list[:i], a.list[i+1:]...)
+			return nil
+		}
+	}
+	return errNoSuchAnnouncement
+}
+
+// scheduled returns copies of the announcements, with next filled in from
+// now for ones that have not been checked yet.
+func (a *announcer) scheduled(now time.Time) []scheduledAnnouncement {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]scheduledAnnouncement, 0, len(a.list))
+	for _, s := range a.list {
+		if s.next.IsZero() {
+			s.next = s.Schedule.Next(now)
+		}
+		out = append(out, *s)
+	}
+	return out
+}
+
+// due returns the announcements whose time has come by now and schedules
+// their next run. Announcements are never posted for times before they were
+// first checked, so a restart does not replay missed ones.
+func (a *announcer) due(now time.Time) []Announcement {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out []Announcement
+	for _, s := range a.list {
+		switch {
+		case s.next.IsZero():
+			s.next = s.Schedule.Next(now)
+		case !now.Before(s.next):
+			out = append(out, s.Announcement)
+			// Step from the due time so intervals do not drift with the check
+			// interval, unless the server fell far behind.
+			if s.next = s.Schedule.Next(s.next); !s.next.After(now) {
+				s.next = s.Schedule.Next(now)
+			}
+		}
+	}
+	return out
+}
+
+// postAnnouncements posts the announcements due at now. Announcements for
+// rooms that no longer exist are skipped.
+func (m *RoomManager) postAnnouncements(now time.Time) {
+	for _, ann := range m.announcer.due(now) {
+		rooms := m.Rooms()
+		if ann.Room != "" {
+			room, ok := m.Room(ann.Room)
+			if !ok {
+				m.lobby.logger.Warn("chat: announcement room not found", "room", ann.Room)
+				continue
+			}
+			rooms = []*Room{room}
+		}
+		for _, room := range rooms {
+			room.broadcastSystem("announcement: " + ann.Text)
+		}
+	}
+}
+
+// runAnnounce manages scheduled announcements:
+// /announce [list | add <schedule> [#room] <text> | rm <id> | now [#room] <text>].
+func runAnnounce(s *session, args string) error {
+	manager := s.room().manager
+	if manager == nil {
+		return s.printSystem("/announce: " + errRoomsDisabled.Error())
+	}
+
+	sub, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+	switch strings.ToLower(sub) {
+	case "", "list":
+		return s.listAnnouncements(manager)
+	case "add":
+		sched, rest, err := schedule.Split(rest)
+		if err != nil {
+			return s.printSystem(fmt.Sprintf("/announce: %v", err))
+		}
+		room, text, err := announceTarget(manager, rest)
+		if err != nil {
+			return s.printSystem(fmt.Sprintf("/announce: %v", err))
+		}
+		name := ""
+		if room != nil {
+			name = room.Name()
+		}
+		added := manager.announcer.add(Announcement{Schedule: sched, Room: name, Text: text}, s.client.Username, s.room().now())
+		s.log.Info("chat: announcement scheduled", "id", added.ID, "schedule", sched.String(), "room", name)
+		return s.printSystem(fmt.Sprintf("scheduled announcement #%d %s, next %s", added.ID, announceWhere(name), formatNext(added.next)))
+	case "rm":
+		id, err := strconv.Atoi(strings.TrimPrefix(rest, "#"))
+		if err != nil {
+			return s.printSystem("usage: /announce rm <id>")
+		}
+		if err := manager.announcer.remove(id); err != nil {
+			return s.printSystem(fmt.Sprintf("/announce: %v: #%d", err, id))
+		}
+		s.log.Info("chat: announcement removed", "id", id)
+		return s.printSystem(fmt.Sprintf("removed announcement #%d", id))
+	case "now":
+		room, text, err := announceTarget(manager, rest)
+		if err != nil {
+			return s.printSystem(fmt.Sprintf("/announce: %v", err))
+		}
+		rooms := manager.Rooms()
+		if room != nil {
+			rooms = []*Room{room}
+		}
+		for _, r := range rooms {
+			r.broadcastSystem(fmt.Sprintf("announcement from %s: %s", s.client.Username, text))
+		}
+		return s.printSystem(fmt.Sprintf("announced in %d room(s)", len(rooms)))
+	}
+	return s.printSystem("usage: /announce [list | add <schedule> [#room] <text> | rm <id> | now [#room] <text>]")
+}
+
+// announceTarget splits an optional leading #room from the announcement text.
+// The room is nil when the text has none, meaning every room.
+func announceTarget(manager *RoomManager, text string) (*Room, string, error) {
+	var room *Room
+	if strings.HasPrefix(text, "#") {
+		name, rest, _ := strings.Cut(text, " ")
+		var ok bool
+		if room, ok = manager.Room(strings.TrimPrefix(name, "#")); !ok {
+			return nil, "", fmt.Errorf("%w: %s", errNoSuchRoom, name)
+		}
+		text = rest
+	}
+	text = stripControl(strings.TrimSpace(text))
+	if text == "" {
+		return nil, "", errors.New("the announcement needs some text")
+	}
+	return room, text, nil
+}
+
+func (s *session) listAnnouncements(manager *RoomManager) error {
+	list := manager.announcer.scheduled(s.room().now())
+	if len(list) == 0 {
+		return s.printSystem("no scheduled announcements; add one with /announce add <schedule> [#room] <text>")
+	}
+	lines := []string{"Scheduled announcements:"}
+	for _, a := range list {
+		origin := "from configuration"
+		if a.By != "" {
+			origin = "added by " + a.By
+		}
+		lines = append(lines,
+			fmt.Sprintf("  #%d  %s %s, next %s (%s)", a.ID, a.Schedule, announceWhere(a.Room), formatNext(a.next), origin),
+			"      "+a.Text)
+	}
+	return s.printSystem(lines...)
+}
+
+func announceWhere(room string) string {
+	if room == "" {
+		return "in every room"
+	}
+	return "in #" + room
+}
+
+func formatNext(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(announceNextFormat)
+}
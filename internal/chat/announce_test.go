@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/schedule"
+)
+
+func mustSchedule(t *testing.T, spec string) schedule.Schedule {
+	t.Helper()
+	s, err := schedule.Parse(spec)
+	require.NoError(t, err)
+	return s
+}
+
+func TestScheduledAnnouncements(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 59, 30, 0, time.UTC)
+	m := newTestManager(
+		WithRoomOptions(WithClock(func() time.Time { return now })),
+		WithAnnouncements(
+			Announcement{Schedule: mustSchedule(t, "0 9 * * *"), Text: "maintenance at noon"},
+			Announcement{Schedule: mustSchedule(t, "@every 1h"), Room: "dev", Text: "stretch"},
+		),
+	)
+	dev, err := m.Create("dev", "")
+	require.NoError(t, err)
+	lobby := m.Lobby().AddClient("alice")
+	coder := dev.AddClient("bob")
+	drainChannel(lobby.Send())
+	drainChannel(coder.Send())
+
+	m.postAnnouncements(now)
+	require.Empty(t, lobby.Send(), "the first check only schedules")
+
+	now = now.Add(30 * time.Second)
+	m.postAnnouncements(now)
+	require.Equal(t, "announcement: maintenance at noon", (<-lobby.Send()).Body)
+	require.Equal(t, "announcement: maintenance at noon", (<-coder.Send()).Body)
+	require.Empty(t, coder.Send())
+
+	now = now.Add(time.Hour)
+	m.postAnnouncements(now)
+	require.Equal(t, "announcement: stretch", (<-coder.Send()).Body)
+	require.Empty(t, lobby.Send(), "room announcements stay in their room")
+
+	now = now.Add(10 * time.Second)
+	m.postAnnouncements(now)
+	require.Empty(t, coder.Send(), "each run posts once")
+}
+
+func TestAnnounceCommand(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	m := newTestManager(
+		WithRoomOptions(WithClock(func() time.Time { return now }), WithOperators("root")),
+		WithAnnouncements(Announcement{Schedule: mustSchedule(t, "@daily"), Text: "backups run at midnight"}),
+	)
+	dev, err := m.Create("dev", "")
+	require.NoError(t, err)
+	op, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "root", Account: true})
+
+	require.NoError(t, op.runCommand("/announce add 0 9 * * 1-5 #dev stand-up in 5 minutes"))
+	require.Contains(t, out.String(), "scheduled announcement #2 in #dev, next Wed 2024-05-01 09:00")
+
+	out.Reset()
+	require.NoError(t, op.runCommand("/announce"))
+	require.Contains(t, out.String(), "#1  @daily in every room, next Thu 2024-05-02 00:00 (from configuration)")
+	require.Contains(t, out.String(), "backups run at midnight")
+	require.Contains(t, out.String(), "#2  0 9 * * 1-5 in #dev, next Wed 2024-05-01 09:00 (added by root)")
+
+	out.Reset()
+	require.NoError(t, op.runCommand("/announce add 0 9 * * * #nowhere hi"))
+	require.Contains(t, out.String(), "/announce: no such room: #nowhere")
+	out.Reset()
+	require.NoError(t, op.runCommand("/announce add 61 * * * * hi"))
+	require.Contains(t, out.String(), "minute 61 is outside 0-59")
+	out.Reset()
+	require.NoError(t, op.runCommand("/announce add @hourly"))
+	require.Contains(t, out.String(), "the announcement needs some text")
+
+	out.Reset()
+	require.NoError(t, op.runCommand("/announce rm 1"))
+	require.Contains(t, out.String(), "removed announcement #1")
+	out.Reset()
+	require.NoError(t, op.runCommand("/announce rm 1"))
+	require.Contains(t, out.String(), "/announce: no such announcement: #1")
+
+	out.Reset()
+	require.NoError(t, op.runCommand("/announce now #dev restarting at 18:00"))
+	require.Contains(t, out.String(), "announced in 1 room(s)")
+	require.Equal(t, "announcement from root: restarting at 18:00", dev.history.Recent(1)[0].Body)
+	require.NotContains(t, out.String(), "restarting at 18:00", "other rooms are left alone")
+
+	guest, guestOut := newCommandTestSession(m.Lobby(), ClientInfo{Username: "guest"})
+	require.NoError(t, guest.runCommand("/announce"))
+	require.Contains(t, guestOut.String(), errPermissionDenied.Error())
+}
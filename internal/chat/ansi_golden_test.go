@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files under testdata/")
+
+// TestTerminalUIGoldenScreen replays a scripted session through tui.Screen on
+// a vt10x terminal and compares the final screen to a golden file, catching
+// escape sequence regressions before they reach users. vt10x gives every rune
+// one column, so the script sticks to narrow text; pkg/tui checks the
+// sequences against the terminfo entries of the terminals it supports.
+func TestTerminalUIGoldenScreen(t *testing.T) {
+	screen := newVTScreen(40, 8)
+	ui := tui.NewScreen(screen)
+	ui.SetWidth(40)
+
+	require.NoError(t, ui.ClearScreen())
+	require.NoError(t, ui.DisplayMessage("Welcome to schat, alice!", "Users online: 1", ""))
+	require.NoError(t, ui.DisplayMessage("[12:00:00] bob: hi there", "Users online: 2", ""))
+	for _, line := range []string{"h", "he", "hel", "hello w", "hello wo", "hello w"} {
+		require.NoError(t, ui.UpdatePrompt("Users online: 2", line))
+	}
+	require.NoError(t, ui.DisplayMessage("[12:00:01] [system] carol joined the chat", "Users online: 3", "hello w"))
+
+	x, y := screen.Cursor()
+	got := fmt.Sprintf("%s\n--- cursor %d,%d\n", screen, x, y)
+
+	path := filepath.Join("testdata", "ansi", "screen.golden")
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test -update to create golden files")
+	require.Equal(t, string(want), got)
+}
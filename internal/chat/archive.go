@@ -0,0 +1,128 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+const archiveSuffix = ".jsonl"
+
+// ArchivePolicy decides what happens to a room's history when it is deleted.
+// With no Dir the history is discarded. Otherwise it is written to Dir as JSON
+// lines, and archives older than Retention are pruned; zero keeps them forever.
+// With Encrypt set, the names and text in each line are sealed with the room's
+// key, as the store seals them.
+type ArchivePolicy struct {
+	Dir       string
+	Retention time.Duration
+	Encrypt   *store.Encrypted
+}
+
+// WithArchive sets the archive policy for deleted rooms.
+func WithArchive(policy ArchivePolicy) ManagerOption {
+	return func(m *RoomManager) {
+		m.archive = policy
+	}
+}
+
+// store writes msgs for room and prunes expired archives.
+func (p ArchivePolicy) store(room string, msgs []Message, now time.Time) error {
+	if p.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(p.Dir, 0o700); err != nil {
+		return fmt.Errorf("chat: archive %s: %w", room, err)
+	}
+
+	name := fmt.Sprintf("%s-%s%s", room, now.UTC().Format("20060102T150405Z"), archiveSuffix)
+	f, err := os.OpenFile(filepath.Join(p.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("chat: archive %s: %w", room, err)
+	}
+
+	enc := json.NewEncoder(f)
+	for _, msg := range msgs {
+		if p.Encrypt != nil {
+			if msg, err = p.seal(room, msg); err != nil {
+				f.Close()
+				return fmt.Errorf("chat: archive %s: %w", room, err)
+			}
+		}
+		if err := enc.Encode(msg); err != nil {
+			f.Close()
+			return fmt.Errorf("chat: archive %s: %w", room, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("chat: archive %s: %w", room, err)
+	}
+
+	return p.prune(now)
+}
+
+// seal returns a copy of msg with its names and text sealed for room.
+func (p ArchivePolicy) seal(room string, msg Message) (Message, error) {
+	var err error
+	for _, f := range []struct {
+		field string
+		text  *string
+	}{
+		{"sender", &msg.SenderName},
+		{"sender", &msg.RecipientName},
+		{"body", &msg.Body},
+		{"sender", &msg.ReplyName},
+		{"body", &msg.ReplyQuote},
+	} {
+		if *f.text == "" {
+			continue
+		}
+		if *f.text, err = p.Encrypt.Seal(room, f.field, *f.text); err != nil {
+			return Message{}, err
+		}
+	}
+	// The reactions are shared with the room's history; seal a copy.
+	reactions := msg.Reactions
+	msg.Reactions = nil
+	for _, r := range reactions {
+		sealed := Reaction{Emoji: r.Emoji}
+		for _, user := range r.Users {
+			user, err = p.Encrypt.Seal(room, "sender", user)
+			if err != nil {
+				return Message{}, err
+			}
+			sealed.Users = append(sealed.Users, user)
+		}
+		msg.Reactions = append(msg.Reactions, sealed)
+	}
+	return msg, nil
+}
+
+// prune removes archives last modified more than Retention before now.
+func (p ArchivePolicy) prune(now time.Time) error {
+	if p.Retention <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(p.Dir)
+	if err != nil {
+		return fmt.Errorf("chat: prune archives: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), archiveSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) > p.Retention {
+			_ = os.Remove(filepath.Join(p.Dir, entry.Name()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestDeleteArchivesHistory(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	m := newTestManager(
+		WithRoomOptions(WithClock(func() time.Time { return now })),
+		WithArchive(ArchivePolicy{Dir: dir}),
+	)
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	alice := dev.AddClient("alice")
+	dev.Broadcast(alice.ID, "alice", "ship it")
+
+	require.NoError(t, m.Delete(dev, alice))
+
+	f, err := os.Open(filepath.Join(dir, "dev-20240501T090000Z.jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	var bodies []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg Message
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+		bodies = append(bodies, msg.Kind.String()+": "+msg.Body)
+	}
+	require.Equal(t, []string{"system: alice joined the chat", "chat: ship it"}, bodies)
+}
+
+func TestArchivePolicyPrunesExpired(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	old := filepath.Join(dir, "old-20240101T000000Z.jsonl")
+	require.NoError(t, os.WriteFile(old, nil, 0o600))
+	require.NoError(t, os.Chtimes(old, now.Add(-48*time.Hour), now.Add(-48*time.Hour)))
+	unrelated := filepath.Join(dir, "notes.txt")
+	require.NoError(t, os.WriteFile(unrelated, nil, 0o600))
+	require.NoError(t, os.Chtimes(unrelated, now.Add(-48*time.Hour), now.Add(-48*time.Hour)))
+
+	policy := ArchivePolicy{Dir: dir, Retention: 24 * time.Hour}
+	require.NoError(t, policy.store("dev", nil, now))
+
+	_, err := os.Stat(old)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.FileExists(t, unrelated)
+	require.FileExists(t, filepath.Join(dir, "dev-20240501T090000Z.jsonl"))
+}
+
+func TestArchivePolicyWithoutDirDiscards(t *testing.T) {
+	require.NoError(t, ArchivePolicy{}.store("dev", []Message{{Body: "x"}}, time.Now()))
+}
+
+func TestArchivePolicySealsWithTheRoomKey(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	sealed, err := store.NewEncrypted(nil, []byte("correct horse battery staple"))
+	require.NoError(t, err)
+	reactions := []Reaction{{Emoji: "👍", Users: []string{"bob"}}}
+	msgs := []Message{{SenderName: "alice", Body: "ship it", Kind: KindChat, ReplyName: "bob", ReplyQuote: "ready?", Reactions: reactions}}
+
+	policy := ArchivePolicy{Dir: dir, Encrypt: sealed}
+	require.NoError(t, policy.store("dev", msgs, now))
+	require.Equal(t, "bob", reactions[0].Users[0], "the room's history is left alone")
+
+	data, err := os.ReadFile(filepath.Join(dir, "dev-20240501T090000Z.jsonl"))
+	require.NoError(t, err)
+	for _, plain := range []string{"alice", "ship it", "bob", "ready?"} {
+		require.NotContains(t, string(data), plain)
+	}
+	var msg Message
+	require.NoError(t, json.Unmarshal(data, &msg))
+	for _, f := range []struct{ field, sealed, want string }{
+		{"sender", msg.SenderName, "alice"},
+		{"body", msg.Body, "ship it"},
+		{"sender", msg.ReplyName, "bob"},
+		{"body", msg.ReplyQuote, "ready?"},
+		{"sender", msg.Reactions[0].Users[0], "bob"},
+	} {
+		got, err := sealed.Open("dev", f.field, f.sealed)
+		require.NoError(t, err)
+		require.Equal(t, f.want, got)
+	}
+}
@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// archivedSetting is the room settings key holding when the room was
+// archived, in RFC 3339.
+const archivedSetting = "archived"
+
+var errRoomArchived = errors.New("this room is archived and read-only; /room unarchive to revive it")
+
+// WithInactiveArchive archives rooms nobody has joined or written in for
+// after: they become read-only and are hidden from /rooms, keeping their
+// history, until someone runs /room unarchive. Zero never archives. The lobby
+// and rooms with members online are never archived.
+func WithInactiveArchive(after time.Duration) ManagerOption {
+	return func(m *RoomManager) {
+		m.inactiveAfter = after
+	}
+}
+
+// markActivity records that the room was just used.
+func (r *Room) markActivity(t time.Time) {
+	r.lastActivity.Store(t.UnixNano())
+}
+
+// LastActivity reports when the room was created, last joined, or last
+// written in, whichever is latest.
+func (r *Room) LastActivity() time.Time {
+	return time.Unix(0, r.lastActivity.Load())
+}
+
+// Archived reports whether the room is archived and since when.
+func (r *Room) Archived() (time.Time, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.archivedAt, !r.archivedAt.IsZero()
+}
+
+// setArchived archives the room at t, or revives it for a zero t, and saves
+// the change with the room's settings.
+func (r *Room) setArchived(t time.Time) error {
+	r.mu.Lock()
+	r.archivedAt = t
+	r.mu.Unlock()
+	return r.saveSettings()
+}
+
+// showArchived tells a client joining an archived room that it is read-only.
+func (r *Room) showArchived(client *Client) {
+	at, ok := r.Archived()
+	if !ok {
+		return
+	}
+	client.deliver(Message{
+		Timestamp: r.now(),
+		Body:      fmt.Sprintf("#%s was archived on %s for inactivity and is read-only; /room unarchive to revive it", r.name, at.Format(time.DateOnly)),
+		Kind:      KindSystem,
+	}, r.backpressure, r.backpressureTimeout)
+}
+
+// archiveInactive archives every room that has been idle for the configured
+// time as of now.
+func (m *RoomManager) archiveInactive(now time.Time) {
+	if m.inactiveAfter <= 0 {
+		return
+	}
+	for _, room := range m.Rooms() {
+		if room == m.lobby || room.serverLog || room.ClientCount() > 0 || now.Sub(room.LastActivity()) < m.inactiveAfter {
+			continue
+		}
+		if _, archived := room.Archived(); archived {
+			continue
+		}
+		if err := room.setArchived(now); err != nil {
+			room.logger.Warn("chat: archived room state not saved", "room", room.Name(), "err", err)
+		}
+		room.logger.Info("chat: room archived", "room", room.Name(), "idle", now.Sub(room.LastActivity()).Round(time.Minute))
+	}
+}
+
+// Unarchive revives an archived room for actor, who must be in it.
+func (m *RoomManager) Unarchive(room *Room, actor *Client) error {
+	if _, archived := room.Archived(); !archived {
+		return fmt.Errorf("#%s is not archived", room.Name())
+	}
+	if err := room.setArchived(time.Time{}); err != nil {
+		return err
+	}
+	now := room.now()
+	room.markActivity(now)
+	room.logger.Info("chat: room unarchived", "room", room.Name(), "username", actor.Username)
+	room.broadcastSystem(fmt.Sprintf("%s revived #%s", actor.Username, room.Name()))
+	return nil
+}
+
+func runRoomUnarchive(s *session, room *Room) error {
+	if room.manager == nil {
+		return s.printSystem(errRoomsDisabled.Error())
+	}
+	if err := room.manager.Unarchive(room, s.client); err != nil {
+		return s.printSystem(fmt.Sprintf("/room unarchive: %v", err))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestInactiveRoomsAreArchived(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	st := store.NewMemory()
+	clock := WithClock(func() time.Time { return now })
+	m := newTestManager(WithRoomOptions(clock, WithStore(st)), WithInactiveArchive(24*time.Hour))
+	_, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	ops, err := m.Create("ops", "")
+	require.NoError(t, err)
+	ops.AddClient("carol")
+
+	now = now.Add(23 * time.Hour)
+	m.archiveInactive(now)
+	dev, _ := m.Room("dev")
+	_, archived := dev.Archived()
+	require.False(t, archived)
+
+	now = now.Add(2 * time.Hour)
+	m.archiveInactive(now)
+	at, archived := dev.Archived()
+	require.True(t, archived)
+	require.Equal(t, now, at)
+	_, archived = ops.Archived()
+	require.False(t, archived, "rooms with members online stay open")
+	_, archived = m.Lobby().Archived()
+	require.False(t, archived, "the lobby is never archived")
+
+	sess, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "bob"})
+	require.NoError(t, sess.runCommand("/rooms"))
+	require.NotContains(t, out.String(), "#dev")
+	require.Contains(t, out.String(), "1 archived rooms not shown; /rooms all to list them")
+	require.NoError(t, sess.runCommand("/rooms all"))
+	require.Regexp(t, `#dev\s+0 online  owner alice  archived 2024-05-02`, out.String())
+
+	drainChannel(sess.client.Send())
+	require.NoError(t, sess.runCommand("/join dev"))
+	var notices []string
+	for len(sess.client.Send()) > 0 {
+		notices = append(notices, (<-sess.client.Send()).Body)
+	}
+	require.Contains(t, notices, "#dev was archived on 2024-05-02 for inactivity and is read-only; /room unarchive to revive it")
+	require.NoError(t, sess.broadcastLine("anyone here?"))
+	require.Contains(t, out.String(), "message not sent: this room is archived and read-only")
+	require.NoError(t, sess.runCommand("/room"))
+	require.Contains(t, out.String(), "archived: 2024-05-02 (read-only; /room unarchive to revive it)")
+
+	settings, err := st.RoomSettings(context.Background(), "dev")
+	require.NoError(t, err)
+	require.Equal(t, "2024-05-02T10:00:00Z", settings[archivedSetting])
+	restarted := newTestManager(WithRoomOptions(clock, WithStore(st)))
+	require.NoError(t, restarted.Ensure("dev"))
+	again, _ := restarted.Room("dev")
+	_, archived = again.Archived()
+	require.True(t, archived, "the archive survives a restart")
+
+	require.NoError(t, sess.runCommand("/room unarchive"))
+	require.Equal(t, "bob revived #dev", (<-sess.client.Send()).Body)
+	require.NoError(t, sess.broadcastLine("back in business"))
+	require.Contains(t, out.String(), "bob: back in business")
+	_, archived = dev.Archived()
+	require.False(t, archived)
+	require.NoError(t, sess.runCommand("/room unarchive"))
+	require.Contains(t, out.String(), "/room unarchive: #dev is not archived")
+
+	settings, err = st.RoomSettings(context.Background(), "dev")
+	require.NoError(t, err)
+	require.NotContains(t, settings, archivedSetting)
+}
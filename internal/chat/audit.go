@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/audit"
+)
+
+// auditShown is how many entries /audit lists.
+const auditShown = 15
+
+// WithAudit records moderation and administrative actions in log.
+func WithAudit(log *audit.Log) RoomOption {
+	return func(r *Room) {
+		r.auditLog = log
+	}
+}
+
+// audit records an action taken in or on the room. It always reaches the
+// server log; actions against users are warnings there, so #server-log shows
+// them at its default level.
+func (r *Room) audit(e audit.Entry) {
+	if e.Time.IsZero() {
+		e.Time = r.now()
+	}
+	if e.Room == "" {
+		e.Room = r.name
+	}
+	level := slog.LevelInfo
+	switch e.Action {
+	case audit.Warn, audit.Mute, audit.Kick, audit.Ban:
+		level = slog.LevelWarn
+	}
+	r.logger.Log(context.Background(), level, "chat: audit", "audit", true, "actor", e.Actor, "action", e.Action,
+		"target", e.Target, "room", e.Room, "reason", e.Reason)
+	if r.auditLog == nil {
+		return
+	}
+	if err := r.auditLog.Record(e); err != nil {
+		r.logger.Error("chat: audit log write failed", "action", e.Action, "err", err)
+	}
+}
+
+// runAudit lists the latest recorded actions, optionally only those by or
+// against one user: /audit [<user>].
+func runAudit(s *session, args string) error {
+	log := s.room().auditLog
+	if log == nil {
+		return s.printSystem("the audit log is not configured")
+	}
+	name := strings.TrimPrefix(strings.TrimSpace(args), "@")
+	if strings.ContainsAny(name, " ,") {
+		return s.printSystem("usage: /audit [<user>]")
+	}
+	var match func(audit.Entry) bool
+	if name != "" {
+		match = func(e audit.Entry) bool { return e.Involves(name) }
+	}
+	entries := log.Recent(auditShown, match)
+	if len(entries) == 0 {
+		if name != "" {
+			return s.printSystem("no recorded actions involve " + name)
+		}
+		return s.printSystem("no actions recorded yet")
+	}
+	lines := make([]string, 0, len(entries)+1)
+	lines = append(lines, fmt.Sprintf("latest %d recorded action(s):", len(entries)))
+	for _, e := range entries {
+		lines = append(lines, "  "+formatAuditEntry(e))
+	}
+	return s.printSystem(lines...)
+}
+
+// formatAuditEntry renders e as e.g. "01-02 03:04:05 root kick mallory in
+// #lobby: spam".
+func formatAuditEntry(e audit.Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s", e.Time.Format("01-02 15:04:05"), e.Actor, e.Action)
+	if e.Target != "" {
+		b.WriteString(" " + e.Target)
+	}
+	if e.Room != "" {
+		b.WriteString(" in #" + e.Room)
+	}
+	if e.Reason != "" {
+		b.WriteString(": " + stripControl(e.Reason))
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/audit"
+	"github.com/ledzpl/schat/pkg/features"
+)
+
+func TestAuditRecordsModeration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := audit.Open(path)
+	require.NoError(t, err)
+	set := features.New(nil)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithOperators("root"), WithFeatures(set), WithAudit(log))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "root", Account: true})
+	room.AddClient("mallory")
+
+	require.NoError(t, sess.runCommand("/audit"))
+	require.Contains(t, out.String(), "no actions recorded yet")
+
+	require.NoError(t, sess.runCommand("/topic release day"))
+	require.NoError(t, sess.runCommand("/feature reactions on"))
+	a := &adminExec{room: room, admin: "admin", out: &bytes.Buffer{}, log: room.logger}
+	require.NoError(t, a.run("kick mallory spamming links"))
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/audit"))
+	require.Contains(t, out.String(), "latest 3 recorded action(s):")
+	require.Contains(t, out.String(), "root topic in #lobby: set to release day")
+	require.Contains(t, out.String(), "root feature reactions in #lobby: on for #lobby")
+	require.Contains(t, out.String(), "admin kick mallory in #lobby: spamming links")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/audit @mallory"))
+	require.Contains(t, out.String(), "latest 1 recorded action(s):")
+	require.NoError(t, sess.runCommand("/audit nobody"))
+	require.Contains(t, out.String(), "no recorded actions involve nobody")
+
+	require.NoError(t, log.Close())
+	reopened, err := audit.Open(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	entries := reopened.Recent(10, nil)
+	require.Len(t, entries, 3, "entries reach the file")
+	require.Equal(t, audit.Kick, entries[2].Action)
+	require.Equal(t, "mallory", entries[2].Target)
+}
+
+func TestAuditCommandWithoutLog(t *testing.T) {
+	sess, out := newCommandTestSession(NewRoom(), ClientInfo{Username: "root", Operator: true})
+	require.NoError(t, sess.runCommand("/audit"))
+	require.Contains(t, out.String(), "the audit log is not configured")
+}
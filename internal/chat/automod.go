@@ -0,0 +1,204 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/audit"
+	"github.com/ledzpl/schat/pkg/automod"
+	"github.com/ledzpl/schat/pkg/features"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+const (
+	// automodShown is how many verdicts /automod lists.
+	automodShown = 10
+	// automodActor is who the audit log says acted on automod's verdicts.
+	automodActor = "automod"
+)
+
+var errMuted = errors.New("you are muted")
+
+// WithAutomod has e judge what users send and how often they come and go,
+// and carries out its verdicts. It applies in rooms where the automod
+// feature flag is on; operators are exempt.
+func WithAutomod(e *automod.Engine) RoomOption {
+	return func(r *Room) {
+		if e == nil {
+			return
+		}
+		r.automod = e
+		r.plugins = append(r.plugins, automodPlugin{engine: e})
+	}
+}
+
+type automodPlugin struct {
+	engine *automod.Engine
+}
+
+func (p automodPlugin) OnJoin(room *Room, client *Client) { p.presence(room, client) }
+
+func (p automodPlugin) OnLeave(room *Room, client *Client) { p.presence(room, client) }
+
+func (p automodPlugin) presence(room *Room, client *Client) {
+	if !room.moderates(client) {
+		return
+	}
+	if v, hit := p.engine.Presence(client.Username, room.Name(), room.now()); hit {
+		room.enforce(client, v)
+	}
+}
+
+// OnMessage suppresses everything a muted user sends, and the messages that
+// break a rule.
+func (p automodPlugin) OnMessage(room *Room, msg Message) (Message, error) {
+	client, ok := room.client(msg.SenderID)
+	if !ok || !room.moderates(client) {
+		return msg, nil
+	}
+	now := room.now()
+	if until, muted := p.engine.Muted(client.Username, now); muted {
+		return msg, fmt.Errorf("%w for another %s", errMuted, formatIdle(until.Sub(now)))
+	}
+	switch msg.Kind {
+	case KindChat, KindAction, KindDirect, KindEdit:
+	default:
+		return msg, nil
+	}
+	v, hit := p.engine.Message(client.Username, room.Name(), msg.Body, now)
+	if !hit {
+		return msg, nil
+	}
+	room.enforce(client, v)
+	return msg, fmt.Errorf("held by automod for %s", v.Rule.Reason())
+}
+
+// moderates reports whether automod judges client in this room.
+func (r *Room) moderates(client *Client) bool {
+	return r.automod != nil && !client.Operator && r.FeatureEnabled(features.AutoMod)
+}
+
+// enforce carries out a verdict against client and records it in the audit
+// log.
+func (r *Room) enforce(client *Client, v automod.Verdict) {
+	reason := v.Rule.Reason()
+	r.audit(audit.Entry{Actor: automodActor, Action: audit.Action(v.Action), Target: client.Username,
+		Reason: fmt.Sprintf("%s (strike %d, from %s)", reason, v.Strike, valueOr(client.RemoteAddr, "unknown"))})
+
+	switch v.Action {
+	case automod.Warn:
+		client.deliver(Message{
+			Timestamp: r.now(),
+			Body:      fmt.Sprintf("automod: warning %d for %s; keep it up and you will be muted or removed", v.Strike, reason),
+			Kind:      KindSystem,
+		}, r.backpressure, r.backpressureTimeout)
+	case automod.Mute:
+		r.broadcastSystem(fmt.Sprintf("%s was muted for %s by automod for %s", client.Username, formatIdle(v.Until.Sub(r.now())), reason))
+	case automod.Kick:
+		notice := fmt.Sprintf("%s was kicked by automod for %s", client.Username, reason)
+		r.broadcastSystem(notice)
+		client.disconnect(sshserver.Exit(sshserver.ExitKicked, errors.New(notice)))
+	case automod.Ban:
+		if host := remoteHost(client.RemoteAddr); host != "" {
+			r.automod.Ban(host, v.Until)
+		}
+		notice := fmt.Sprintf("%s was banned for %s by automod for %s", client.Username, formatIdle(v.Until.Sub(r.now())), reason)
+		r.broadcastSystem(notice)
+		r.disconnectMatching(func(c *Client) bool { return c.Username == client.Username }, notice)
+		// A client that has just left is no longer listed in any room.
+		client.disconnect(sshserver.Exit(sshserver.ExitKicked, errors.New(notice)))
+	}
+}
+
+// allRooms returns every room on this server.
+func (r *Room) allRooms() []*Room {
+	if r.manager == nil {
+		return []*Room{r}
+	}
+	return r.manager.Rooms()
+}
+
+// checkBanned refuses a session that a ban in the ban list covers, or whose
+// user or address automod banned.
+func (r *Room) checkBanned(info ClientInfo) error {
+	now := r.now()
+	// Compare the name the client would join as, however it was spelled.
+	info.Username = sshserver.CanonicalUsername(info.Username)
+	if r.bans != nil {
+		addr, _ := netip.ParseAddr(remoteHost(info.RemoteAddr))
+		if e, banned := r.bans.Check(now, info.Username, info.KeyFingerprint, addr); banned {
+			r.logger.Info("chat: banned user refused", "username", stripControl(info.Username), "remote_addr", info.RemoteAddr, "ban", e.String())
+			msg := "you are banned"
+			if e.Reason != "" {
+				msg += ": " + stripControl(e.Reason)
+			}
+			return sshserver.Exit(sshserver.ExitKicked, errors.New(msg))
+		}
+	}
+	if r.automod == nil || info.Operator {
+		return nil
+	}
+	until, banned := r.automod.Banned(now, info.Username, remoteHost(info.RemoteAddr))
+	if !banned {
+		return nil
+	}
+	r.logger.Info("chat: banned user refused", "username", stripControl(info.Username), "remote_addr", info.RemoteAddr)
+	return sshserver.Exit(sshserver.ExitKicked, fmt.Errorf("you are banned by automod for another %s", formatIdle(until.Sub(now))))
+}
+
+// remoteHost strips the port from a client's address.
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// runAutomod shows automod's latest verdicts or lifts one user's strikes,
+// mute, and ban: /automod [pardon <user>].
+func runAutomod(s *session, args string) error {
+	e := s.room().automod
+	if e == nil {
+		return s.printSystem("automod is not configured")
+	}
+
+	sub, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	switch strings.ToLower(sub) {
+	case "":
+		state := "off"
+		if s.room().FeatureEnabled(features.AutoMod) {
+			state = "on"
+		}
+		lines := []string{fmt.Sprintf("automod: %s in #%s (toggle with /feature %s on|off)", state, s.room().Name(), features.AutoMod)}
+		recent := e.Recent()
+		if len(recent) == 0 {
+			lines = append(lines, "  no offences recorded")
+		}
+		if len(recent) > automodShown {
+			recent = recent[len(recent)-automodShown:]
+		}
+		for _, entry := range recent {
+			line := fmt.Sprintf("  %s %s in #%s: %s, strike %d -> %s", entry.Time.Format("15:04:05"), entry.User, entry.Room, entry.Rule, entry.Strike, entry.Action)
+			if !entry.Until.IsZero() {
+				line += " until " + entry.Until.Format("15:04")
+			}
+			lines = append(lines, line)
+		}
+		return s.printSystem(lines...)
+	case "pardon":
+		name := strings.TrimPrefix(strings.TrimSpace(rest), "@")
+		if name == "" {
+			return s.printSystem("usage: /automod pardon <user>")
+		}
+		if !e.Pardon(name) {
+			return s.printSystem(name + " has no automod strikes")
+		}
+		s.room().audit(audit.Entry{Actor: s.client.Username, Action: audit.Pardon, Target: name})
+		return s.printSystem("pardoned " + name + ": strikes, mute, and ban cleared")
+	default:
+		return s.printSystem("usage: /automod [pardon <user>]")
+	}
+}
@@ -0,0 +1,138 @@
+package chat
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/automod"
+	"github.com/ledzpl/schat/pkg/features"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+func newAutomod(t *testing.T, cfg automod.Config) *automod.Engine {
+	t.Helper()
+	cfg.Actions = []automod.Action{automod.Warn, automod.Mute, automod.Kick, automod.Ban}
+	cfg.MuteFor, cfg.BanFor, cfg.StrikeWindow = 5*time.Minute, time.Hour, time.Hour
+	e, err := automod.New(cfg)
+	require.NoError(t, err)
+	return e
+}
+
+// watchDisconnect records how client was disconnected.
+func watchDisconnect(client *Client) <-chan *sshserver.SessionExit {
+	exits := make(chan *sshserver.SessionExit, 1)
+	client.setDisconnectHandler(func(exit *sshserver.SessionExit) { exits <- exit })
+	return exits
+}
+
+func TestAutomodLadder(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var logs bytes.Buffer
+	set := features.New(map[features.Flag]bool{features.AutoMod: true})
+	room := NewRoom(WithFeatures(set), WithClock(func() time.Time { return now }),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		WithAutomod(newAutomod(t, automod.Config{CapsRatio: 0.5})))
+	alice := room.Join(ClientInfo{Username: "alice", RemoteAddr: "192.0.2.7:50123"})
+	bob := room.AddClient("bob")
+	drainChannel(alice.Send())
+	drainChannel(bob.Send())
+	kicked := watchDisconnect(alice)
+
+	_, err := room.Broadcast(alice.ID, "alice", "STOP IT")
+	require.EqualError(t, err, "held by automod for excessive capitals")
+	require.Contains(t, (<-alice.Send()).Body, "automod: warning 1 for excessive capitals")
+	require.Empty(t, bob.Send(), "warnings are private")
+	require.Contains(t, logs.String(), "audit=true")
+	require.Contains(t, logs.String(), "level=WARN msg=\"chat: audit\" audit=true actor=automod action=warn target=alice")
+
+	_, err = room.Broadcast(alice.ID, "alice", "STOP IT")
+	require.Error(t, err)
+	require.Equal(t, "alice was muted for 5m by automod for excessive capitals", (<-bob.Send()).Body)
+	_, err = room.Broadcast(alice.ID, "alice", "sorry")
+	require.ErrorIs(t, err, errMuted)
+	_, err = room.Action(alice.ID, "alice", "sulks")
+	require.ErrorIs(t, err, errMuted)
+
+	now = now.Add(6 * time.Minute)
+	_, err = room.Broadcast(alice.ID, "alice", "sorry")
+	require.NoError(t, err, "the mute ended")
+	drainChannel(bob.Send())
+	_, err = room.Broadcast(alice.ID, "alice", "STOP IT")
+	require.Error(t, err)
+	require.Equal(t, "alice was kicked by automod for excessive capitals", (<-bob.Send()).Body)
+	exit := <-kicked
+	require.Equal(t, sshserver.ExitKicked, exit.Reason)
+
+	alice = room.Join(ClientInfo{Username: "alice", RemoteAddr: "192.0.2.7:50124"})
+	_, err = room.Broadcast(alice.ID, "alice", "STOP IT")
+	require.Error(t, err)
+	require.Contains(t, logs.String(), "action=ban")
+	require.ErrorContains(t, room.checkBanned(ClientInfo{Username: "alice"}), "banned by automod for another 1h00m")
+	require.Error(t, room.checkBanned(ClientInfo{Username: "alice2", RemoteAddr: "192.0.2.7:50200"}), "the address is banned too")
+	require.NoError(t, room.checkBanned(ClientInfo{Username: "bob", RemoteAddr: "198.51.100.1:4000"}))
+	require.NoError(t, room.checkBanned(ClientInfo{Username: "alice", Operator: true}))
+
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, room.checkBanned(ClientInfo{Username: "alice", RemoteAddr: "192.0.2.7:50300"}), "bans end")
+}
+
+func TestAutomodSparesOperatorsAndRoomsWithoutTheFlag(t *testing.T) {
+	set := features.New(map[features.Flag]bool{features.AutoMod: true})
+	room := NewRoom(WithFeatures(set), WithOperators("root"), WithAutomod(newAutomod(t, automod.Config{CapsRatio: 0.5})))
+	root := room.AddClient("root")
+	alice := room.AddClient("alice")
+
+	_, err := room.Broadcast(root.ID, "root", "READ THE RULES")
+	require.NoError(t, err)
+
+	require.NoError(t, set.Set(room.Name(), features.AutoMod, false))
+	_, err = room.Broadcast(alice.ID, "alice", "HELLO EVERYONE")
+	require.NoError(t, err)
+}
+
+func TestAutomodJoinFlood(t *testing.T) {
+	set := features.New(map[features.Flag]bool{features.AutoMod: true})
+	room := NewRoom(WithFeatures(set), WithAutomod(newAutomod(t, automod.Config{Joins: 3, JoinWindow: time.Minute})))
+	carol := room.AddClient("carol")
+	room.RemoveClient(carol.ID)
+	carol = room.AddClient("carol")
+
+	var last Message
+	for len(carol.Send()) > 0 {
+		last = <-carol.Send()
+	}
+	require.Equal(t, "automod: warning 1 for joining and leaving too often; keep it up and you will be muted or removed", last.Body)
+}
+
+func TestAutomodCommand(t *testing.T) {
+	set := features.New(map[features.Flag]bool{features.AutoMod: true})
+	e := newAutomod(t, automod.Config{CapsRatio: 0.5})
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithOperators("root"), WithFeatures(set), WithAutomod(e))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "root", Account: true})
+
+	require.NoError(t, sess.runCommand("/automod"))
+	require.Contains(t, out.String(), "automod: on in #lobby")
+	require.Contains(t, out.String(), "no offences recorded")
+
+	alice := room.AddClient("alice")
+	_, err := room.Broadcast(alice.ID, "alice", "STOP IT")
+	require.Error(t, err)
+	out.Reset()
+	require.NoError(t, sess.runCommand("/automod"))
+	require.Contains(t, out.String(), "alice in #lobby: caps, strike 1 -> warn")
+
+	require.NoError(t, sess.runCommand("/automod pardon @alice"))
+	require.Contains(t, out.String(), "pardoned alice")
+	require.NoError(t, sess.runCommand("/automod pardon alice"))
+	require.Contains(t, out.String(), "alice has no automod strikes")
+	require.NoError(t, sess.runCommand("/automod pardon"))
+	require.Contains(t, out.String(), "usage: /automod pardon <user>")
+
+	plain, out := newCommandTestSession(NewRoom(), ClientInfo{Username: "root", Operator: true})
+	require.NoError(t, plain.runCommand("/automod"))
+	require.Contains(t, out.String(), "automod is not configured")
+}
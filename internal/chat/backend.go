@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"github.com/ledzpl/schat/pkg/cluster"
+	"github.com/ledzpl/schat/pkg/roomstate"
+)
+
+// WithBackend keeps the presence and messages of rooms in b, e.g. a
+// redisroom.Backend that several servers behind a load balancer share so
+// they serve the same rooms. Without one, a room keeps them in a
+// roomstate.Memory of its own.
+func WithBackend(b roomstate.Backend) RoomOption {
+	return func(r *Room) {
+		if b != nil {
+			r.backend = b
+		}
+	}
+}
+
+// elsewhere lists the users in the room on other servers sharing its
+// backend.
+func (r *Room) elsewhere() ([]cluster.Location, error) {
+	members, err := r.shared.Members()
+	if err != nil {
+		return nil, err
+	}
+	var remote []cluster.Location
+	for _, m := range members {
+		if m.Node != r.backend.Server() {
+			remote = append(remote, m)
+		}
+	}
+	return remote, nil
+}
@@ -0,0 +1,64 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/redisroom"
+)
+
+func TestRedisBackendSharesRooms(t *testing.T) {
+	srv := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	managers := make(map[string]*RoomManager)
+	for _, server := range []string{"a", "b"} {
+		client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+		defer client.Close()
+		backend := redisroom.New(client, server)
+		managers[server] = newTestManager(WithRoomOptions(WithBackend(backend)))
+		go backend.Run(ctx, managers[server].PostReplicated)
+	}
+	require.Eventually(t, func() bool { return srv.PubSubNumPat() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	devA, err := managers["a"].Create("dev", "alice")
+	require.NoError(t, err)
+	alice := devA.AddClient("alice")
+	drainChannel(alice.Send())
+
+	_, err = devA.Broadcast(alice.ID, "alice", "hello from a")
+	require.NoError(t, err)
+	var devB *Room
+	require.Eventually(t, func() bool {
+		devB, _ = managers["b"].Room("dev")
+		return devB != nil && len(devB.history.Recent(10)) > 0
+	}, 5*time.Second, 10*time.Millisecond, "the room is created on b for the first message")
+	msg := devB.history.Recent(1)[0]
+	require.Equal(t, "hello from a", msg.Body)
+	require.Equal(t, "a", msg.Node)
+
+	bob := devB.AddClient("bob")
+	drainChannel(bob.Send())
+	_, err = devB.Action(bob.ID, "bob", "waves")
+	require.NoError(t, err)
+	got := <-alice.Send()
+	require.Equal(t, KindAction, got.Kind)
+	require.Equal(t, "waves", got.Body)
+	require.Equal(t, "b", got.Node)
+
+	sess, out := newCommandTestSession(devA, ClientInfo{Username: "carol"})
+	require.NoError(t, sess.runCommand("/who"))
+	require.Contains(t, out.String(), "1 on other servers:")
+	require.Regexp(t, `bob\s+on b`, out.String())
+
+	devB.RemoveClient(bob.ID)
+	out.Reset()
+	require.NoError(t, sess.runCommand("/who"))
+	require.NotContains(t, out.String(), "on other servers")
+}
@@ -0,0 +1,165 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// BackpressurePolicy decides what happens when a client's outbound queue is full.
+type BackpressurePolicy int
+
+const (
+	// DropOldest discards the oldest queued message to make room for the new one.
+	DropOldest BackpressurePolicy = iota
+	// DropNewest discards the incoming message and keeps the queue untouched.
+	DropNewest
+	// DisconnectSlow drops the client from the room once its queue overflows.
+	DisconnectSlow
+	// BlockWithTimeout waits up to the configured timeout for queue space before
+	// dropping the message. Broadcasts wait for every slow client at once, so
+	// each stalls for at most one timeout; keep it short.
+	BlockWithTimeout
+)
+
+const defaultBackpressureTimeout = 250 * time.Millisecond
+
+// errTooSlow ends the sessions of clients dropped by DisconnectSlow.
+var errTooSlow = sshserver.Exit(sshserver.ExitSlowClient, errors.New("too slow to keep up with the room"))
+
+var backpressurePolicyNames = map[BackpressurePolicy]string{
+	DropOldest:       "drop-oldest",
+	DropNewest:       "drop-newest",
+	DisconnectSlow:   "disconnect",
+	BlockWithTimeout: "block",
+}
+
+// String returns the flag-friendly name of the policy.
+func (p BackpressurePolicy) String() string {
+	if name, ok := backpressurePolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("BackpressurePolicy(%d)", int(p))
+}
+
+// ParseBackpressurePolicy converts a policy name such as "drop-oldest" into a policy.
+func ParseBackpressurePolicy(name string) (BackpressurePolicy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for policy, candidate := range backpressurePolicyNames {
+		if candidate == name {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("chat: unknown backpressure policy %q", name)
+}
+
+// WithBackpressure selects how the room treats clients that cannot keep up.
+// The timeout only applies to BlockWithTimeout; zero selects a default.
+func WithBackpressure(policy BackpressurePolicy, timeout time.Duration) RoomOption {
+	return func(r *Room) {
+		r.backpressure = policy
+		if timeout > 0 {
+			r.backpressureTimeout = timeout
+		}
+	}
+}
+
+// WithRoomBackpressure overrides the backpressure policy of the named rooms,
+// e.g. to block briefly in a low traffic announcements room while busy rooms
+// drop. Other rooms keep the policy set by WithBackpressure.
+func WithRoomBackpressure(policies map[string]BackpressurePolicy) ManagerOption {
+	return func(m *RoomManager) {
+		if m.roomBackpressure == nil {
+			m.roomBackpressure = make(map[string]BackpressurePolicy, len(policies))
+		}
+		for name, policy := range policies {
+			m.roomBackpressure[normalizeRoomName(name)] = policy
+		}
+	}
+}
+
+// deliver queues msg for the client, applying policy when the queue is full.
+// It must be called with the room lock held so the channel cannot be closed.
+func (c *Client) deliver(msg Message, policy BackpressurePolicy, timeout time.Duration) {
+	if c.enqueue(msg) {
+		return
+	}
+
+	switch policy {
+	case DropOldest:
+		select {
+		case old := <-c.send:
+			c.dequeued(old)
+			if old.Kind != KindTyping {
+				c.missed.Add(1)
+			}
+		default:
+		}
+		if !c.enqueue(msg) {
+			c.missed.Add(1)
+		}
+	case DisconnectSlow:
+		c.missed.Add(1)
+		c.disconnect(errTooSlow)
+	case BlockWithTimeout:
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case c.send <- msg:
+			c.queued(msg)
+		case <-timer.C:
+			c.missed.Add(1)
+		}
+	default:
+		c.missed.Add(1)
+	}
+}
+
+// blockAll waits up to timeout for queue space in each of clients, all at
+// once, so a broadcast stalls for one timeout however many clients are slow.
+// Like deliver, it must be called with the room lock held.
+func blockAll(clients []*Client, msg Message, timeout time.Duration) {
+	if len(clients) == 0 {
+		return
+	}
+	expired := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() { close(expired) })
+	defer timer.Stop()
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			select {
+			case c.send <- msg:
+				c.queued(msg)
+			case <-expired:
+				c.missed.Add(1)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// takeMissed returns and resets the number of messages dropped for this client.
+func (c *Client) takeMissed() int64 {
+	return c.missed.Swap(0)
+}
+
+// missedNotice builds the system message telling a client how much it lost.
+func missedNotice(n int64, ts time.Time) Message {
+	noun := "messages"
+	if n == 1 {
+		noun = "message"
+	}
+	return Message{
+		Timestamp: ts,
+		Body:      fmt.Sprintf("you missed %d %s because your connection fell behind", n, noun),
+		Kind:      KindSystem,
+	}
+}
@@ -0,0 +1,119 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+func TestClientDeliverPolicies(t *testing.T) {
+	cases := []struct {
+		name       string
+		policy     BackpressurePolicy
+		wantFirst  string
+		wantMissed int64
+		wantKicked bool
+	}{
+		{name: "drop oldest", policy: DropOldest, wantFirst: "1", wantMissed: 1},
+		{name: "drop newest", policy: DropNewest, wantFirst: "0", wantMissed: 1},
+		{name: "block with timeout", policy: BlockWithTimeout, wantFirst: "0", wantMissed: 1},
+		{name: "disconnect", policy: DisconnectSlow, wantFirst: "0", wantMissed: 1, wantKicked: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newClient("id", "user", "")
+			kicked := make(chan *sshserver.SessionExit, 1)
+			client.setDisconnectHandler(func(exit *sshserver.SessionExit) { kicked <- exit })
+
+			for i := 0; i <= cap(client.send); i++ {
+				client.deliver(Message{Body: string(rune('0' + i))}, tc.policy, 10*time.Millisecond)
+			}
+
+			first := <-client.Send()
+			require.Equal(t, tc.wantFirst, first.Body)
+			require.Equal(t, tc.wantMissed, client.takeMissed())
+			require.Zero(t, client.takeMissed(), "counter resets after being read")
+
+			select {
+			case exit := <-kicked:
+				require.True(t, tc.wantKicked)
+				require.Equal(t, sshserver.ExitSlowClient, exit.Reason)
+			case <-time.After(50 * time.Millisecond):
+				require.False(t, tc.wantKicked)
+			}
+		})
+	}
+}
+
+func TestRelayAnnouncesMissedMessages(t *testing.T) {
+	pool := newRelayPool(1)
+	client := newClient("id", "user", "")
+	client.missed.Add(3)
+	client.tryDeliver(Message{Body: "next"})
+
+	var got []Message
+	target := pool.attach(client, func(msg Message) error {
+		got = append(got, msg)
+		return nil
+	})
+	client.closeSend()
+	waitDone(t, target)
+
+	require.Len(t, got, 2)
+	require.Equal(t, KindSystem, got[0].Kind)
+	require.Contains(t, got[0].Body, "missed 3 messages")
+	require.Equal(t, "next", got[1].Body)
+}
+
+func TestParseBackpressurePolicy(t *testing.T) {
+	for policy, name := range backpressurePolicyNames {
+		parsed, err := ParseBackpressurePolicy(name)
+		require.NoError(t, err)
+		require.Equal(t, policy, parsed)
+	}
+
+	_, err := ParseBackpressurePolicy("yolo")
+	require.Error(t, err)
+}
+
+func TestBroadcastBlocksForSlowClientsTogether(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	room := NewRoom(WithBackpressure(BlockWithTimeout, timeout))
+	var slow []*Client
+	for i := 0; i < 5; i++ {
+		client := newClient(string(rune('a'+i)), string(rune('a'+i)), "")
+		for len(client.send) < cap(client.send) {
+			client.tryDeliver(Message{Body: "backlog"})
+		}
+		room.mu.Lock()
+		room.clients[client.ID] = client
+		room.mu.Unlock()
+		slow = append(slow, client)
+	}
+
+	start := time.Now()
+	room.broadcastSystem("hello")
+	require.Less(t, time.Since(start), 3*timeout, "slow clients are waited for at once")
+	for _, client := range slow {
+		require.Equal(t, int64(1), client.takeMissed())
+	}
+}
+
+func TestRoomBackpressureOverridesThePolicy(t *testing.T) {
+	m := NewRoomManager(
+		WithRoomOptions(WithBackpressure(DropNewest, 0)),
+		WithRoomBackpressure(map[string]BackpressurePolicy{"#Announcements": BlockWithTimeout}),
+	)
+	announcements, err := m.Create("announcements", "alice")
+	require.NoError(t, err)
+	random, err := m.Create("random", "alice")
+	require.NoError(t, err)
+
+	require.Equal(t, BlockWithTimeout, announcements.backpressure)
+	require.Equal(t, DropNewest, random.backpressure)
+	require.Equal(t, DropNewest, m.Lobby().backpressure)
+}
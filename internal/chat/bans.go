@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/audit"
+	"github.com/ledzpl/schat/pkg/bans"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// WithBans keeps the bans /ban adds in list. The SSH server should refuse
+// the same list at handshake time; rooms check it again when a session
+// starts and disconnect sessions a new ban matches.
+func WithBans(list *bans.List) RoomOption {
+	return func(r *Room) {
+		r.bans = list
+	}
+}
+
+// banMatches reports whether ban e covers client.
+func banMatches(e bans.Entry, client *Client) bool {
+	switch e.Kind {
+	case bans.User:
+		return strings.EqualFold(e.Value, client.Username)
+	case bans.Key:
+		return client.KeyFingerprint != "" && e.Value == client.KeyFingerprint
+	case bans.Net:
+		addr, err := netip.ParseAddr(remoteHost(client.RemoteAddr))
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		if prefix, err := netip.ParsePrefix(e.Value); err == nil {
+			return prefix.Contains(addr)
+		}
+		return e.Value == addr.String()
+	}
+	return false
+}
+
+// disconnectMatching ends the sessions in every room that match, telling them
+// why, and returns how many it ended.
+func (r *Room) disconnectMatching(match func(*Client) bool, notice string) int {
+	ended := 0
+	for _, room := range r.allRooms() {
+		for _, c := range room.Clients() {
+			if match(c) {
+				c.disconnect(sshserver.Exit(sshserver.ExitKicked, errors.New(notice)))
+				ended++
+			}
+		}
+	}
+	return ended
+}
+
+// parseBanDuration reads a ban length such as 30m, 12h, or 7d.
+func parseBanDuration(s string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err == nil && n > 0
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
+
+// describeBan renders a ban for /ban-list and the audit log.
+func describeBan(e bans.Entry, now time.Time) string {
+	var b strings.Builder
+	b.WriteString(e.String())
+	if e.By != "" {
+		b.WriteString(" by " + e.By)
+	}
+	if e.Until.IsZero() {
+		b.WriteString(", permanent")
+	} else {
+		b.WriteString(", " + formatIdle(e.Until.Sub(now)) + " left")
+	}
+	if e.Reason != "" {
+		b.WriteString(": " + stripControl(e.Reason))
+	}
+	return b.String()
+}
+
+// runBan bans a user, key, address, or range and disconnects the sessions it
+// covers: /ban <user|address|range|SHA256:key> [<duration>] [reason].
+func runBan(s *session, args string) error {
+	list := s.room().bans
+	if list == nil {
+		return s.printSystem("bans are not configured")
+	}
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return s.printSystem("usage: /ban <user|address|range|SHA256:key> [<duration>] [reason]")
+	}
+	kind, value, err := bans.ParseTarget(fields[0])
+	if err != nil {
+		return s.printSystem(strings.TrimPrefix(err.Error(), "bans: "))
+	}
+	now := s.room().now()
+	entry := bans.Entry{Kind: kind, Value: value, By: s.client.Username}
+	rest := fields[1:]
+	if len(rest) > 0 {
+		if d, ok := parseBanDuration(rest[0]); ok {
+			entry.Until = now.Add(d)
+			rest = rest[1:]
+		}
+	}
+	entry.Reason = strings.Join(rest, " ")
+	if banMatches(entry, s.client) {
+		return s.printSystem("refusing a ban that covers your own session")
+	}
+
+	stored, err := list.Add(entry, now)
+	if err != nil {
+		s.log.Error("chat: ban failed", "target", entry.String(), "err", err)
+		return s.printSystem("could not save the ban; see the server log")
+	}
+	entry = stored
+	s.room().audit(audit.Entry{Actor: s.client.Username, Action: audit.Ban, Target: value, Reason: describeBan(entry, now)})
+
+	notice := fmt.Sprintf("%s was banned by %s", value, s.client.Username)
+	if entry.Reason != "" {
+		notice += ": " + stripControl(entry.Reason)
+	}
+	ended := s.room().disconnectMatching(func(c *Client) bool { return banMatches(entry, c) }, notice)
+	if ended > 0 {
+		s.room().broadcastSystem(notice)
+	}
+	return s.printSystem(fmt.Sprintf("banned %s; %d session(s) disconnected", describeBan(entry, now), ended))
+}
+
+// runUnban lifts a ban: /unban <user|address|range|SHA256:key>.
+func runUnban(s *session, args string) error {
+	list := s.room().bans
+	if list == nil {
+		return s.printSystem("bans are not configured")
+	}
+	if args == "" || strings.ContainsAny(args, " \t") {
+		return s.printSystem("usage: /unban <user|address|range|SHA256:key>")
+	}
+	kind, value, err := bans.ParseTarget(args)
+	if err != nil {
+		return s.printSystem(strings.TrimPrefix(err.Error(), "bans: "))
+	}
+	entry, err := list.Remove(value, s.room().now())
+	switch {
+	case errors.Is(err, bans.ErrNotFound):
+		return s.printSystem(fmt.Sprintf("no ban on %s %s", kind, value))
+	case err != nil:
+		s.log.Error("chat: unban failed", "target", value, "err", err)
+		return s.printSystem("could not save the ban list; see the server log")
+	}
+	s.room().audit(audit.Entry{Actor: s.client.Username, Action: audit.Unban, Target: entry.Value})
+	return s.printSystem("lifted the ban on " + entry.String())
+}
+
+// runBanList lists the bans in force: /ban-list.
+func runBanList(s *session, _ string) error {
+	list := s.room().bans
+	if list == nil {
+		return s.printSystem("bans are not configured")
+	}
+	now := s.room().now()
+	entries := list.Entries(now)
+	if len(entries) == 0 {
+		return s.printSystem("no bans in force")
+	}
+	lines := make([]string, 0, len(entries)+1)
+	lines = append(lines, fmt.Sprintf("%d ban(s) in force:", len(entries)))
+	for _, e := range entries {
+		lines = append(lines, "  "+describeBan(e, now))
+	}
+	return s.printSystem(lines...)
+}
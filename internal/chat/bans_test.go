@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/audit"
+	"github.com/ledzpl/schat/pkg/bans"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+func TestBanCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	list, err := bans.Open(path)
+	require.NoError(t, err)
+	log, err := audit.Open("")
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithClock(func() time.Time { return now }), WithBans(list), WithAudit(log))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "root", Operator: true, RemoteAddr: "198.51.100.1:40000"})
+	mallory := room.Join(ClientInfo{Username: "mallory", RemoteAddr: "203.0.113.7:50000"})
+	malloryExit := watchDisconnect(mallory)
+	bob := room.Join(ClientInfo{Username: "bob", RemoteAddr: "192.0.2.9:50000"})
+	bobExit := watchDisconnect(bob)
+
+	require.NoError(t, sess.runCommand("/ban-list"))
+	require.Contains(t, out.String(), "no bans in force")
+
+	require.NoError(t, sess.runCommand("/ban 198.51.100.0/24"))
+	require.Contains(t, out.String(), "refusing a ban that covers your own session")
+
+	require.NoError(t, sess.runCommand("/ban 203.0.113.0/24 7d botnet"))
+	require.Contains(t, out.String(), "banned net 203.0.113.0/24 by root, 168h00m left: botnet; 1 session(s) disconnected")
+	exit := <-malloryExit
+	require.Equal(t, sshserver.ExitKicked, exit.Reason)
+	require.Empty(t, bobExit)
+
+	require.NoError(t, sess.runCommand("/ban @Bob being rude"))
+	require.Equal(t, sshserver.ExitKicked, (<-bobExit).Reason)
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/ban-list"))
+	require.Contains(t, out.String(), "2 ban(s) in force:")
+	require.Contains(t, out.String(), "user Bob by root, permanent: being rude")
+
+	err = room.checkBanned(ClientInfo{Username: "bob", RemoteAddr: "192.0.2.9:50001"})
+	require.ErrorContains(t, err, "you are banned: being rude")
+	require.Error(t, room.checkBanned(ClientInfo{Username: " bob\u200b"}), "bans match the name the client would join as")
+	require.NoError(t, room.checkBanned(ClientInfo{Username: "carol", RemoteAddr: "192.0.2.9:50001"}))
+
+	reopened, err := bans.Open(path)
+	require.NoError(t, err)
+	require.Len(t, reopened.Entries(now), 2, "bans survive a restart")
+
+	require.NoError(t, sess.runCommand("/unban bob"))
+	require.Contains(t, out.String(), "lifted the ban on user Bob")
+	require.NoError(t, sess.runCommand("/unban bob"))
+	require.Contains(t, out.String(), "no ban on user bob")
+	require.NoError(t, room.checkBanned(ClientInfo{Username: "bob"}))
+
+	recent := log.Recent(10, nil)
+	require.Len(t, recent, 3)
+	require.Equal(t, audit.Ban, recent[0].Action)
+	require.Equal(t, "203.0.113.0/24", recent[0].Target)
+	require.Equal(t, audit.Unban, recent[2].Action)
+}
+
+func TestBanCommandsWithoutList(t *testing.T) {
+	sess, out := newCommandTestSession(NewRoom(), ClientInfo{Username: "root", Operator: true})
+	require.NoError(t, sess.runCommand("/ban mallory"))
+	require.Contains(t, out.String(), "bans are not configured")
+}
@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ledzpl/schat/pkg/botclient"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// maxBotRequestBytes bounds one request line from a bot.
+const maxBotRequestBytes = 64 << 10
+
+var errEmptyText = errors.New("text is empty")
+
+// isBotRequest reports whether req asks for the bot subsystem.
+func isBotRequest(req *Request) bool {
+	return req.Type == RequestSubsystem && req.Name == botclient.Subsystem
+}
+
+// botWriter serialises events from the relay and the request loop.
+type botWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *botWriter) write(ev botclient.Event) error {
+	ev.V = botclient.Version
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(ev)
+}
+
+// serveBot runs a headless client for the bot subsystem: room messages go out
+// as JSON Lines events and requests come in the same way, with no terminal
+// drawing. pkg/botclient is the Go client for it.
+func (s *session) serveBot() error {
+	w := &botWriter{enc: json.NewEncoder(s.channel)}
+
+	if err := s.home.checkBanned(s.info); err != nil {
+		_ = w.write(botclient.Event{Type: botclient.EventError, Time: s.home.now(), Error: err.Error()})
+		return err
+	}
+	s.info = s.home.identify(s.info)
+	s.client = s.home.Join(s.info)
+	s.log = s.log.With("username", s.client.Username)
+	s.log.Info("chat: bot joined", "room", s.home.Name(), "auth_method", s.client.AuthMethod)
+	s.client.setDisconnectHandler(s.dropInput)
+	// Ready goes out first; the join notice and topic wait in the client's
+	// queue until the relay is attached.
+	if err := w.write(botclient.Event{
+		Type: botclient.EventReady,
+		Time: s.room().now(),
+		User: s.client.Username,
+		Room: s.room().Name(),
+	}); err != nil {
+		return s.exitFor(sshserver.Exit(sshserver.ExitClientGone, err))
+	}
+	if code, text := s.protocolNotice(botclient.Subsystem, botclient.Version); code != "" {
+		if err := w.write(botclient.Event{Type: botclient.EventNotice, Time: s.room().now(), Code: code, Body: text}); err != nil {
+			return s.exitFor(sshserver.Exit(sshserver.ExitClientGone, err))
+		}
+	}
+	s.relay = s.home.relay.attach(s.client, func(msg Message) error {
+		if msg.Kind == KindTyping {
+			return nil
+		}
+		return w.write(s.botEvent(msg))
+	})
+
+	defer s.dropOnDone(s.dropInput)()
+	go func() {
+		_, err := io.Copy(s.input, s.channel)
+		s.input.CloseWithError(err)
+	}()
+	scanner := bufio.NewScanner(s.inputReader)
+	scanner.Buffer(make([]byte, 4096), maxBotRequestBytes)
+	for scanner.Scan() {
+		var req botclient.Request
+		reply := botclient.Event{Type: botclient.EventOK, Time: s.room().now()}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			reply.Type, reply.Error = botclient.EventError, "bad request: "+err.Error()
+		} else if err := s.handleBotRequest(req); err != nil {
+			reply.Type, reply.Error = botclient.EventError, err.Error()
+		}
+		reply.ID = req.ID
+		reply.Room = s.room().Name()
+		if err := w.write(reply); err != nil {
+			return s.exitFor(sshserver.Exit(sshserver.ExitClientGone, err))
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
+		var exit *sshserver.SessionExit
+		if !errors.As(err, &exit) {
+			s.log.Warn("chat: bot read failed", "err", err)
+		}
+		return s.exitFor(sshserver.Exit(sshserver.ExitClientGone, err))
+	}
+	return s.exitFor(nil)
+}
+
+// handleBotRequest carries out one request from a bot.
+func (s *session) handleBotRequest(req botclient.Request) error {
+	room := s.room()
+	text := strings.TrimSpace(stripControl(req.Text))
+
+	switch req.Type {
+	case botclient.RequestSend, botclient.RequestAction:
+		if text == "" {
+			return errEmptyText
+		}
+		room.touch(s.client)
+		var err error
+		if req.Type == botclient.RequestAction {
+			_, err = room.Action(s.client.ID, s.client.Username, text)
+		} else {
+			_, err = room.Broadcast(s.client.ID, s.client.Username, text)
+		}
+		return err
+	case botclient.RequestDirect:
+		if text == "" {
+			return errEmptyText
+		}
+		room.touch(s.client)
+		_, _, err := room.SendDirect(s.client.ID, req.To, text)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, req.To)
+		}
+		return nil
+	case botclient.RequestJoin:
+		manager := room.manager
+		if manager == nil {
+			return errRoomsDisabled
+		}
+		target, ok := manager.Room(req.Room)
+		if !ok {
+			var err error
+			if target, err = manager.Create(req.Room, s.client.Username); err != nil {
+				return err
+			}
+		}
+		return manager.Move(s.client, target)
+	default:
+		return fmt.Errorf("unknown request type %q", req.Type)
+	}
+}
+
+// botEvent converts a delivered message into its bot protocol form.
+func (s *session) botEvent(msg Message) botclient.Event {
+	if n := msg.Notice; n.Code != "" {
+		ev := botclient.Event{Type: botclient.EventNotice, Time: msg.Timestamp, Code: n.Code, ServerVersion: n.Version, Body: msg.Body}
+		if !n.Deadline.IsZero() {
+			ev.Deadline = &n.Deadline
+		}
+		return ev
+	}
+	ev := botclient.Event{
+		Type:    botclient.EventMessage,
+		Time:    msg.Timestamp,
+		Room:    s.room().Name(),
+		From:    msg.SenderName,
+		Kind:    msg.Kind.String(),
+		Body:    msg.Body,
+		Message: msg.ID,
+		ReplyTo: msg.ReplyTo,
+	}
+	if msg.Kind == KindDirect {
+		ev.Room = ""
+	}
+	return ev
+}
@@ -0,0 +1,174 @@
+package chat
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/bans"
+	"github.com/ledzpl/schat/pkg/botclient"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// dialBot connects a bot to room over an in-memory SSH connection.
+func dialBot(t *testing.T, room *Room, user string) *botclient.Client {
+	t.Helper()
+	return dialBotWith(t, room, user, &ssh.ServerConfig{NoClientAuth: true})
+}
+
+// dialBotWith is dialBot with a custom server config, e.g. to sign in with a
+// key through NoClientAuthCallback.
+func dialBotWith(t *testing.T, room *Room, user string, cfg *ssh.ServerConfig) *botclient.Client {
+	t.Helper()
+	bot, err := connectBot(t, room, user, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { bot.Close() })
+	return bot
+}
+
+// connectBot is dialBotWith for bots the server may refuse.
+func connectBot(t *testing.T, room *Room, user string, cfg *ssh.ServerConfig) (*botclient.Client, error) {
+	t.Helper()
+	serverConn, clientConn := newMemPipe()
+	go serveTranscript(context.Background(), t, room, serverConn, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return botclient.Connect(ctx, "pipe", user,
+		botclient.WithHostKeyCallback(ssh.InsecureIgnoreHostKey()),
+		botclient.WithDialer(func(context.Context, string, string) (net.Conn, error) { return clientConn, nil }),
+	)
+}
+
+// botInbox collects the messages a bot receives.
+type botInbox struct {
+	mu   sync.Mutex
+	msgs []botclient.Message
+}
+
+func (b *botInbox) add(msg botclient.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.msgs = append(b.msgs, msg)
+}
+
+func (b *botInbox) find(t *testing.T, kind, text string) botclient.Message {
+	t.Helper()
+	var found botclient.Message
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, msg := range b.msgs {
+			if msg.Kind == kind && msg.Text == text {
+				found = msg
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 5*time.Millisecond, "no %s message %q", kind, text)
+	return found
+}
+
+func TestBotSendsAndReceives(t *testing.T) {
+	m := newTestManager()
+	alice := m.Lobby().AddClient("alice")
+	bot := dialBot(t, m.Lobby(), "karma")
+	require.Equal(t, "karma", bot.User())
+	require.Equal(t, "lobby", bot.Room())
+
+	var inbox botInbox
+	bot.OnMessage(inbox.add)
+	ctx := context.Background()
+
+	m.Lobby().Broadcast(alice.ID, "alice", "go++")
+	msg := inbox.find(t, botclient.KindChat, "go++")
+	require.Equal(t, "alice", msg.From)
+	require.Equal(t, "lobby", msg.Room)
+
+	_, _, err := m.Lobby().SendDirect(alice.ID, "karma", "psst")
+	require.NoError(t, err)
+	require.Empty(t, inbox.find(t, botclient.KindDirect, "psst").Room)
+
+	drainChannel(alice.Send())
+	require.NoError(t, bot.Send(ctx, "go has 1 karma"))
+	require.NoError(t, bot.Action(ctx, "tips hat"))
+	require.NoError(t, bot.Direct(ctx, "alice", "hi\x1b[2J"))
+	got := []Message{<-alice.Send(), <-alice.Send(), <-alice.Send()}
+	require.Equal(t, "go has 1 karma", got[0].Body)
+	require.Equal(t, KindAction, got[1].Kind)
+	require.Equal(t, KindDirect, got[2].Kind)
+	require.Equal(t, "hi[2J", got[2].Body, "control characters are stripped")
+
+	require.ErrorContains(t, bot.Send(ctx, "  "), "send: text is empty")
+	require.ErrorContains(t, bot.Direct(ctx, "nobody", "hi"), "direct: no such user: nobody")
+}
+
+func TestBotJoinsRooms(t *testing.T) {
+	m := newTestManager()
+	bot := dialBot(t, m.Lobby(), "reminder")
+	var inbox botInbox
+	bot.OnMessage(inbox.add)
+	ctx := context.Background()
+
+	require.NoError(t, bot.Join(ctx, "#Ops"))
+	require.Equal(t, "ops", bot.Room())
+	ops, ok := m.Room("ops")
+	require.True(t, ok)
+	require.Equal(t, "reminder", ops.Owner())
+
+	bob := ops.AddClient("bob")
+	ops.Broadcast(bob.ID, "bob", "standup?")
+	require.Equal(t, "ops", inbox.find(t, botclient.KindChat, "standup?").Room)
+
+	require.ErrorContains(t, bot.Join(ctx, "no spaces"), "join:")
+}
+
+func TestBotDisconnect(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	bot := dialBot(t, room, "bye")
+	require.Eventually(t, func() bool { return room.ClientCount() == 1 }, time.Second, time.Millisecond)
+
+	require.NoError(t, bot.Close())
+	<-bot.Done()
+	require.ErrorIs(t, bot.Send(context.Background(), "hi"), botclient.ErrClosed)
+	require.Eventually(t, func() bool { return room.ClientCount() == 0 }, 2*time.Second, time.Millisecond)
+}
+
+func TestBotJoinsUnderItsKeysSavedName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"fingerprint": "SHA256:karma", "user": "karma"}]`), 0o600))
+	ids, err := sshserver.OpenIdentities(path)
+	require.NoError(t, err)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithIdentities(ids))
+
+	bot := dialBotWith(t, room, "root", &ssh.ServerConfig{
+		NoClientAuth: true,
+		NoClientAuthCallback: func(ssh.ConnMetadata) (*ssh.Permissions, error) {
+			return &ssh.Permissions{Extensions: map[string]string{
+				sshserver.ExtAuthMethod:     "publickey",
+				sshserver.ExtKeyFingerprint: "SHA256:karma",
+			}}, nil
+		},
+	})
+	require.Equal(t, "karma", bot.User())
+}
+
+func TestBotRefusedWhenBanned(t *testing.T) {
+	list, err := bans.Open("")
+	require.NoError(t, err)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithBans(list))
+	_, err = list.Add(bans.Entry{Kind: bans.User, Value: "spammer", Reason: "spam"}, time.Now())
+	require.NoError(t, err)
+
+	_, err = connectBot(t, room, "spammer", &ssh.ServerConfig{NoClientAuth: true})
+	require.ErrorIs(t, err, botclient.ErrClosed)
+	require.ErrorContains(t, err, "you are banned: spam")
+	require.Zero(t, room.ClientCount())
+}
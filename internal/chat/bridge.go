@@ -0,0 +1,53 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+	"github.com/ledzpl/schat/pkg/features"
+)
+
+// errBridgesDisabled is returned for messages bridged into a room whose
+// bridges feature flag is off.
+var errBridgesDisabled = errors.New("chat: bridges are disabled in this room")
+
+// relayToBridges hands a chat or action message to the bridges, unless the
+// room has its bridges feature flag turned off or the message was replicated
+// from another cluster node, which relays it itself.
+func (r *Room) relayToBridges(msg Message) {
+	if r.bridges == nil || r.serverLog || msg.Node != "" || !r.FeatureEnabled(features.Bridges) {
+		return
+	}
+	r.bridges.Publish(bridge.Message{
+		Room:   r.name,
+		User:   msg.SenderName,
+		Text:   msg.Body,
+		Action: msg.Kind == KindAction,
+		Origin: msg.Bridge,
+	})
+}
+
+// PostBridged delivers a message that a bridge received from another network
+// to its room, which relays it on to the other bridges.
+func (m *RoomManager) PostBridged(in bridge.Message) error {
+	room, ok := m.Room(in.Room)
+	if !ok {
+		return fmt.Errorf("chat: no room %q for bridge %s", in.Room, in.Origin)
+	}
+	if !room.FeatureEnabled(features.Bridges) {
+		return errBridgesDisabled
+	}
+	kind := KindChat
+	if in.Action {
+		kind = KindAction
+	}
+	_, err := room.broadcastMessage(Message{
+		Timestamp:  room.now(),
+		SenderName: in.User,
+		Body:       in.Text,
+		Kind:       kind,
+		Bridge:     in.Origin,
+	})
+	return err
+}
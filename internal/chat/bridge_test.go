@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+	"github.com/ledzpl/schat/pkg/features"
+)
+
+// recordingRelay collects the messages relayed to it.
+type recordingRelay struct {
+	name string
+	mu   sync.Mutex
+	got  []bridge.Message
+}
+
+func (r *recordingRelay) Name() string { return r.name }
+
+func (r *recordingRelay) Run(ctx context.Context, ready func()) error {
+	ready()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (r *recordingRelay) Relay(msg bridge.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.got = append(r.got, msg)
+}
+
+func (r *recordingRelay) messages() []bridge.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]bridge.Message(nil), r.got...)
+}
+
+func newBridgedManager(t *testing.T, enabled bool) (*RoomManager, *recordingRelay, *recordingRelay) {
+	t.Helper()
+	sup := bridge.NewSupervisor()
+	irc, matrix := &recordingRelay{name: "irc:libera"}, &recordingRelay{name: "matrix"}
+	require.NoError(t, sup.Add(irc))
+	require.NoError(t, sup.Add(matrix))
+	m := newTestManager(WithRoomOptions(
+		WithBridges(sup),
+		WithFeatures(features.New(map[features.Flag]bool{features.Bridges: enabled})),
+	))
+	return m, irc, matrix
+}
+
+func TestRoomRelaysToBridges(t *testing.T) {
+	m, irc, _ := newBridgedManager(t, true)
+	alice := m.Lobby().AddClient("alice")
+	m.Lobby().Broadcast(alice.ID, "alice", "hello")
+	m.Lobby().Action(alice.ID, "alice", "waves")
+
+	require.Equal(t, []bridge.Message{
+		{Room: "lobby", User: "alice", Text: "hello"},
+		{Room: "lobby", User: "alice", Text: "waves", Action: true},
+	}, irc.messages(), "joins and other system messages are not relayed")
+}
+
+func TestPostBridged(t *testing.T) {
+	m, irc, matrix := newBridgedManager(t, true)
+	alice := m.Lobby().AddClient("alice")
+	drainChannel(alice.Send())
+
+	require.NoError(t, m.PostBridged(bridge.Message{Room: "lobby", User: "bob@libera", Text: "hi\athere", Origin: "irc:libera"}))
+	msg := <-alice.Send()
+	require.Equal(t, KindChat, msg.Kind)
+	require.Equal(t, "bob@libera", msg.SenderName)
+	require.Equal(t, "hithere", msg.Body)
+	require.Equal(t, "irc:libera", msg.Bridge)
+
+	require.Empty(t, irc.messages(), "not echoed back to its origin")
+	require.Equal(t, []bridge.Message{
+		{Room: "lobby", User: "bob@libera", Text: "hithere", Origin: "irc:libera"},
+	}, matrix.messages())
+
+	require.ErrorContains(t, m.PostBridged(bridge.Message{Room: "ops", User: "bob@libera", Text: "hi"}), `no room "ops"`)
+}
+
+func TestBridgesFeatureDisabled(t *testing.T) {
+	m, irc, _ := newBridgedManager(t, false)
+	alice := m.Lobby().AddClient("alice")
+	m.Lobby().Broadcast(alice.ID, "alice", "hello")
+	require.Empty(t, irc.messages())
+
+	err := m.PostBridged(bridge.Message{Room: "lobby", User: "bob@libera", Text: "hi", Origin: "irc:libera"})
+	require.ErrorIs(t, err, errBridgesDisabled)
+}
@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"context"
+	"io"
+)
+
+// Channel is the byte stream a terminal session talks to its user over. An
+// ssh.Channel is one; plaintext listeners such as pkg/telnet provide others,
+// so the session, its line buffer, and its screen do not depend on SSH.
+type Channel interface {
+	io.ReadWriteCloser
+}
+
+// resizer is implemented by channels that report the terminal's size, as
+// telnet clients do with NAWS. fn is called with each size reported.
+type resizer interface {
+	OnResize(fn func(cols, rows int))
+}
+
+// stderr returns where file commands report errors: the channel's error
+// stream when it has one, or the channel itself.
+func stderr(channel Channel) io.Writer {
+	if ch, ok := channel.(interface{ Stderr() io.ReadWriter }); ok {
+		return ch.Stderr()
+	}
+	return channel
+}
+
+// HandleTerminalSession runs an interactive session on a channel that did not
+// come from SSH, e.g. a telnet connection, for the user described by info.
+// There are no channel requests: the session starts a shell at once, and the
+// terminal width comes from the channel when it reports one. It returns how
+// the session ended, as HandleSession does.
+func HandleTerminalSession(ctx context.Context, room *Room, info ClientInfo, channel Channel) error {
+	s := newSession(ctx, room, info, channel, nil)
+	return s.runTerminal()
+}
+
+func (s *session) runTerminal() error {
+	defer s.cleanupSession()
+
+	s.initUI()
+	if ch, ok := s.channel.(resizer); ok {
+		ch.OnResize(func(cols, _ int) { s.ui.SetWidth(cols) })
+	}
+	return s.serveShell()
+}
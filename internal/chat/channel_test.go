@@ -0,0 +1,63 @@
+package chat
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/telnet"
+)
+
+// sizedChannel is a terminal channel that reports its width, as telnet
+// connections do.
+type sizedChannel struct {
+	net.Conn
+	cols int
+}
+
+func (c *sizedChannel) OnResize(fn func(cols, rows int)) { fn(c.cols, 24) }
+
+func TestTerminalSession(t *testing.T) {
+	m := newTestManager()
+	alice := m.Lobby().AddClient("alice")
+	drainChannel(alice.Send())
+
+	server, client := newMemPipe()
+	done := make(chan error, 1)
+	info := ClientInfo{Username: "tel", RemoteAddr: "192.0.2.7:5000", ClientVersion: telnet.ClientVersion, SessionID: "telnet-1"}
+	go func() {
+		done <- HandleTerminalSession(context.Background(), m.Lobby(), info, &sizedChannel{Conn: server, cols: 60})
+	}()
+	require.Eventually(t, func() bool { return m.Lobby().ClientCount() == 2 }, 2*time.Second, time.Millisecond)
+
+	sess, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "carol"})
+	require.NoError(t, sess.runCommand("/who"))
+	require.Regexp(t, `tel\s+joined .* via telnet`, out.String())
+
+	drainChannel(alice.Send())
+	_, err := client.Write([]byte("hello over telnet\r"))
+	require.NoError(t, err)
+	for chat := false; !chat; {
+		select {
+		case msg := <-alice.Send():
+			if chat = msg.Kind == KindChat; chat {
+				require.Equal(t, "tel", msg.SenderName)
+				require.Equal(t, "hello over telnet", msg.Body)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("the message was not broadcast")
+		}
+	}
+
+	require.NoError(t, client.Close())
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the session did not end")
+	}
+	_, ok := m.Lobby().FindClient("tel")
+	require.False(t, ok, "the user left")
+}
@@ -1,33 +1,192 @@
 package chat
 
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// ClientInfo describes a connecting participant to Room.Join.
+type ClientInfo struct {
+	Username string
+	// Operator grants access to administrative commands.
+	Operator bool
+	// AuthMethod is how the connection authenticated ("password", "publickey",
+	// "oidc"), or empty for anonymous users.
+	AuthMethod string
+	// Account reports that the user signed in with a credential that proves
+	// the username: a registered account's password or key, a password file
+	// entry, or an OIDC sign-in.
+	Account bool
+	// KeyFingerprint identifies the public key the user signed in with.
+	KeyFingerprint string
+	// Color is the ANSI color the user is shown in; empty picks the next one.
+	Color string
+
+	RemoteAddr    string
+	ClientVersion string
+	// SessionID correlates the chat session with transport logs.
+	SessionID string
+
+	// keyBound is set by identify when the username is the one saved for the
+	// key the user signed in with.
+	keyBound bool
+}
+
 // Client represents a connected participant in the chat room.
 type Client struct {
 	ID       string
 	Username string
 	Color    string
+	Operator bool
+
+	AuthMethod     string
+	KeyFingerprint string
+	RemoteAddr     string
+	ClientVersion  string
+	JoinedAt       time.Time
+	// nameProved reports that the sign-in proved the username, with
+	// ClientInfo.Account or the key identity saved under it, rather than with
+	// a key or password that admits any name.
+	nameProved bool
+
+	// room is the room the client is currently in. membership serialises moves
+	// between rooms against the session leaving for good.
+	room       atomic.Pointer[Room]
+	membership sync.Mutex
+	left       bool
+
+	lastActive atomic.Int64
+	// lastSent is the message /edit and /delete change.
+	lastSent atomic.Pointer[sentMessage]
+	// unread is what the client missed in the room it last joined.
+	unread     atomic.Pointer[unreadReplay]
+	presenceMu sync.Mutex
+	presence   Presence
+
+	send     chan Message
+	notifier atomic.Pointer[func()]
 
-	send chan string
+	queuedBytes atomic.Int64
+	inputBytes  atomic.Int64
+	missed      atomic.Int64
+
+	disconnectOnce sync.Once
+	onDisconnect   atomic.Pointer[func(exit *sshserver.SessionExit)]
+}
+
+const defaultQueueSize = 16
+
+// Registered reports whether the client authenticated with a credential rather
+// than joining anonymously.
+func (c *Client) Registered() bool {
+	return c.AuthMethod != ""
 }
 
 func newClient(id, username, color string) *Client {
+	return newClientWithQueue(id, username, color, defaultQueueSize)
+}
+
+func newClientWithQueue(id, username, color string, queueSize int) *Client {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
 	return &Client{
 		ID:       id,
 		Username: username,
 		Color:    color,
-		send:     make(chan string, 16),
+		send:     make(chan Message, queueSize),
 	}
 }
 
+// Room returns the room the client is currently in.
+func (c *Client) Room() *Room {
+	return c.room.Load()
+}
+
+// leave marks the client as gone so it is no longer moved between rooms, and
+// returns the room it must be removed from.
+func (c *Client) leave() *Room {
+	c.membership.Lock()
+	defer c.membership.Unlock()
+	c.left = true
+	return c.room.Load()
+}
+
+// LastActive reports when the client last sent a message or command.
+func (c *Client) LastActive() time.Time {
+	return time.Unix(0, c.lastActive.Load())
+}
+
+func (c *Client) markActive(t time.Time) {
+	c.lastActive.Store(t.UnixNano())
+}
+
 // Send returns the outbound message channel for the client.
-func (c *Client) Send() <-chan string {
+func (c *Client) Send() <-chan Message {
 	return c.send
 }
 
-// tryDeliver places a message onto the outbound channel without blocking.
-func (c *Client) tryDeliver(msg string) {
+// tryDeliver places a message onto the outbound channel without blocking,
+// counting it as missed when the queue is full.
+func (c *Client) tryDeliver(msg Message) {
+	if !c.enqueue(msg) {
+		c.missed.Add(1)
+	}
+}
+
+// enqueue attempts a non-blocking send and reports whether it succeeded.
+func (c *Client) enqueue(msg Message) bool {
 	select {
 	case c.send <- msg:
+		c.queued(msg)
+		return true
 	default:
-		// Drop queued messages when the receiver is too slow; keeps the room responsive.
+		return false
+	}
+}
+
+func (c *Client) queued(msg Message) {
+	c.queuedBytes.Add(int64(msg.size()))
+	c.notify()
+}
+
+// dequeued updates queue accounting after the relay takes msg off the channel.
+func (c *Client) dequeued(msg Message) {
+	c.queuedBytes.Add(-int64(msg.size()))
+}
+
+// closeSend closes the outbound channel and wakes the relay so it can finish.
+func (c *Client) closeSend() {
+	close(c.send)
+	c.notify()
+}
+
+// setNotifier registers fn to be called whenever the outbound queue changes.
+func (c *Client) setNotifier(fn func()) {
+	c.notifier.Store(&fn)
+}
+
+func (c *Client) notify() {
+	if fn := c.notifier.Load(); fn != nil {
+		(*fn)()
 	}
 }
+
+// setDisconnectHandler registers fn to end the client's session when the room
+// decides to drop it.
+func (c *Client) setDisconnectHandler(fn func(exit *sshserver.SessionExit)) {
+	c.onDisconnect.Store(&fn)
+}
+
+// disconnect asks the owning session to end with exit. It never blocks the
+// caller.
+func (c *Client) disconnect(exit *sshserver.SessionExit) {
+	c.disconnectOnce.Do(func() {
+		if fn := c.onDisconnect.Load(); fn != nil {
+			go (*fn)(exit)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+)
+
+// clusterLocateTimeout bounds how long /cluster whois waits for peers.
+const clusterLocateTimeout = 3 * time.Second
+
+// WithCluster attaches this node's view of the cluster to the room. Rooms
+// pinned to other nodes cannot be created here.
+func WithCluster(c *cluster.Cluster) RoomOption {
+	return func(r *Room) {
+		r.cluster = c
+	}
+}
+
+// roomElsewhereError reports a room pinned to another node.
+type roomElsewhereError struct {
+	room string
+	node cluster.Node
+}
+
+func (e roomElsewhereError) Error() string {
+	return fmt.Sprintf("#%s is hosted on %s; connect to %s to join it", e.room, e.node.ID, e.node.Addr)
+}
+
+// checkLocal returns an error when name is pinned to another node.
+func (m *RoomManager) checkLocal(name string) error {
+	c := m.lobby.cluster
+	if c.Local(name) {
+		return nil
+	}
+	node, _ := c.RoomNode(name)
+	return roomElsewhereError{room: name, node: node}
+}
+
+// Whereabouts lists the rooms on this node where a user named username is
+// connected.
+func (m *RoomManager) Whereabouts(username string) []string {
+	var rooms []string
+	for _, room := range m.Rooms() {
+		if _, ok := room.FindClient(username); ok {
+			rooms = append(rooms, room.Name())
+		}
+	}
+	return rooms
+}
+
+// runCluster shows the cluster layout or finds a user: /cluster [whois <user>].
+func runCluster(s *session, args string) error {
+	c := s.room().cluster
+	if c == nil {
+		return s.printSystem("this server is not part of a cluster")
+	}
+
+	sub, rest, _ := strings.Cut(args, " ")
+	switch strings.ToLower(sub) {
+	case "":
+		return s.printSystem(clusterInfoLines(c)...)
+	case "whois":
+		if user := strings.TrimSpace(rest); user != "" {
+			return runClusterWhois(s, c, user)
+		}
+	}
+	return s.printSystem("usage: /cluster [whois <user>]")
+}
+
+func clusterInfoLines(c *cluster.Cluster) []string {
+	self := c.Self()
+	lines := []string{fmt.Sprintf("This is node %s (%s).", self.ID, self.Addr), "Nodes:"}
+	for _, node := range c.Nodes() {
+		line := fmt.Sprintf("  %-12s %s", node.ID, node.Addr)
+		if node.ID == self.ID {
+			line += "  (this node)"
+		}
+		lines = append(lines, line)
+	}
+
+	affinity := c.Affinity()
+	if len(affinity) > 0 {
+		lines = append(lines, "Pinned rooms:")
+		rooms := make([]string, 0, len(affinity))
+		for room := range affinity {
+			rooms = append(rooms, room)
+		}
+		sort.Strings(rooms)
+		for _, room := range rooms {
+			lines = append(lines, fmt.Sprintf("  #%-16s %s", room, affinity[room]))
+		}
+	}
+
+	if c.Replicating() {
+		lines = append(lines, "Replication:")
+		for _, st := range c.ReplicationStatus() {
+			line := fmt.Sprintf("  %-12s sent %d, queued %d, dropped %d, failed %d", st.Node, st.Sent, st.Queued, st.Dropped, st.Failed)
+			if st.LastError != "" {
+				line += " (last error: " + st.LastError + ")"
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func runClusterWhois(s *session, c *cluster.Cluster, user string) error {
+	var dir cluster.Directory
+	if manager := s.room().manager; manager != nil {
+		dir = manager.Whereabouts
+	} else {
+		room := s.room()
+		dir = func(username string) []string {
+			if _, ok := room.FindClient(username); ok {
+				return []string{room.Name()}
+			}
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterLocateTimeout)
+	defer cancel()
+	locations, err := c.Locate(ctx, dir, user)
+
+	var lines []string
+	if len(locations) == 0 {
+		lines = append(lines, fmt.Sprintf("%s is not connected to any node that answered", user))
+	}
+	for _, loc := range locations {
+		lines = append(lines, fmt.Sprintf("%s is on node %s in #%s", loc.User, loc.Node, loc.Room))
+	}
+	if err != nil {
+		lines = append(lines, err.Error())
+	}
+	return s.printSystem(lines...)
+}
@@ -0,0 +1,63 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+)
+
+func newTestCluster(t *testing.T) *cluster.Cluster {
+	t.Helper()
+	c, err := cluster.New("a", []cluster.Node{
+		{ID: "a", Addr: "chat-a:2222"},
+		{ID: "b", Addr: "chat-b:2222"},
+	}, cluster.WithAffinity(map[string]string{"dev": "b", "ops": "a"}))
+	require.NoError(t, err)
+	return c
+}
+
+func TestClusterCommand(t *testing.T) {
+	sess, out := newCommandTestSession(NewRoom(), ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/cluster"))
+	require.Contains(t, out.String(), "not part of a cluster")
+
+	m := newTestManager(WithRoomOptions(WithCluster(newTestCluster(t))))
+	require.NoError(t, m.Ensure("dev", "ops"))
+	sess, out = newCommandTestSession(m.Lobby(), ClientInfo{Username: "alice"})
+
+	require.NoError(t, sess.runCommand("/cluster"))
+	require.Contains(t, out.String(), "This is node a (chat-a:2222).")
+	require.Contains(t, out.String(), "chat-a:2222  (this node)")
+	require.Regexp(t, `#dev\s+b`, out.String())
+
+	require.NoError(t, sess.runCommand("/join ops"))
+	out.Reset()
+	require.NoError(t, sess.runCommand("/cluster whois alice"))
+	require.Contains(t, out.String(), "alice is on node a in #ops")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/cluster whois bob"))
+	require.Contains(t, out.String(), "bob is not connected to any node that answered")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/cluster whois"))
+	require.Contains(t, out.String(), "usage: /cluster")
+}
+
+func TestPinnedRoomsStayOnTheirNode(t *testing.T) {
+	m := newTestManager(WithRoomOptions(WithCluster(newTestCluster(t))))
+	require.NoError(t, m.Ensure("dev", "ops", "random"))
+	_, ok := m.Room("dev")
+	require.False(t, ok, "rooms pinned elsewhere are not created at startup")
+	require.Len(t, m.Rooms(), 3)
+
+	sess, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/join #Dev"))
+	require.Contains(t, out.String(), "#dev is hosted on b; connect to chat-b:2222 to join it")
+	require.Equal(t, "lobby", sess.room().Name())
+
+	require.Equal(t, []string{"lobby"}, m.Whereabouts("alice"))
+	require.Empty(t, m.Whereabouts("bob"))
+}
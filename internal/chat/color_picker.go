@@ -20,6 +20,26 @@ var defaultColorPalette = []string{
 	"\033[36m", // Cyan
 }
 
+var colorNames = map[string]string{
+	"\033[31m": "red",
+	"\033[32m": "green",
+	"\033[33m": "yellow",
+	"\033[34m": "blue",
+	"\033[35m": "magenta",
+	"\033[36m": "cyan",
+}
+
+// colorName returns a human-readable name for an ANSI color sequence.
+func colorName(code string) string {
+	if code == "" {
+		return "default"
+	}
+	if name, ok := colorNames[code]; ok {
+		return name
+	}
+	return "custom"
+}
+
 func newRandomColorPicker(palette []string) ColorPicker {
 	if len(palette) == 0 {
 		return nil
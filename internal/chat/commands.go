@@ -0,0 +1,697 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ledzpl/schat/pkg/telnet"
+	"github.com/ledzpl/schat/pkg/webgateway"
+)
+
+// errPermissionDenied is reported when a non-operator runs an operator command.
+var errPermissionDenied = errors.New("permission denied")
+
+// memstatsTopSessions limits how many sessions /memstats lists individually.
+const memstatsTopSessions = 5
+
+// command is a slash command available in the chat prompt. The help fields
+// feed /help and /help <command>.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	section helpSection
+	// examples are sample invocations shown by /help <command>.
+	examples []string
+	operator bool
+	// owner marks commands whose changes are limited to the room owner.
+	owner bool
+	run   func(s *session, args string) error
+}
+
+// commandSet indexes commands by name while keeping registration order for /help.
+type commandSet struct {
+	ordered []*command
+	byName  map[string]*command
+}
+
+func newCommandSet(cmds ...*command) *commandSet {
+	set := &commandSet{byName: make(map[string]*command, len(cmds))}
+	for _, cmd := range cmds {
+		set.ordered = append(set.ordered, cmd)
+		set.byName[cmd.name] = cmd
+	}
+	return set
+}
+
+func (c *commandSet) lookup(name string) (*command, bool) {
+	cmd, ok := c.byName[name]
+	return cmd, ok
+}
+
+var builtinCommands = newCommandSet(
+	&command{
+		name:     "help",
+		usage:    "/help [next | <section> | <command>]",
+		summary:  "page through commands, or show one command in detail",
+		section:  sectionGeneral,
+		examples: []string{"/help", "/help moderation", "/help join"},
+		run:      runHelp,
+	},
+	&command{
+		name:     "who",
+		usage:    "/who",
+		summary:  "list online users with join and idle times",
+		section:  sectionGeneral,
+		examples: []string{"/who"},
+		run:      runWho,
+	},
+	&command{
+		name:     "whois",
+		usage:    "/whois <user>",
+		summary:  "show details about a user",
+		section:  sectionGeneral,
+		examples: []string{"/whois bob"},
+		run:      runWhois,
+	},
+	&command{
+		name:     "msg",
+		usage:    "/msg <user> <text>",
+		summary:  "send a private message",
+		section:  sectionGeneral,
+		examples: []string{"/msg bob lunch?"},
+		run:      runMsg,
+	},
+	&command{
+		name:     "me",
+		usage:    "/me <action>",
+		summary:  "describe what you are doing, e.g. /me waves",
+		section:  sectionGeneral,
+		examples: []string{"/me waves"},
+		run:      runMe,
+	},
+	&command{
+		name:     "edit",
+		usage:    "/edit <text>",
+		summary:  "replace the text of your last message",
+		section:  sectionGeneral,
+		examples: []string{"/edit deploying at 5pm, not 4pm"},
+		run:      runEdit,
+	},
+	&command{
+		name:     "delete",
+		usage:    "/delete",
+		summary:  "retract your last message",
+		section:  sectionGeneral,
+		examples: []string{"/delete"},
+		run:      runDelete,
+	},
+	&command{
+		name:     "reply",
+		usage:    "/reply <id> <text>",
+		summary:  "answer a recent message, quoting it; /set ids on shows IDs",
+		section:  sectionGeneral,
+		examples: []string{"/reply k3f9 agreed, ship it"},
+		run:      runReply,
+	},
+	&command{
+		name:     "react",
+		usage:    "/react <id> <emoji-or-word>",
+		summary:  "react to a recent message; /set ids on shows IDs",
+		section:  sectionGeneral,
+		examples: []string{"/react k3f9 👍", "/react #k3f9 lol"},
+		run:      runReact,
+	},
+	&command{
+		name:     "away",
+		usage:    "/away [reason]",
+		summary:  "mark yourself away",
+		section:  sectionPreferences,
+		examples: []string{"/away", "/away in a meeting"},
+		run:      runAway,
+	},
+	&command{
+		name:     "back",
+		usage:    "/back",
+		summary:  "clear your away status",
+		section:  sectionPreferences,
+		examples: []string{"/back"},
+		run:      runBack,
+	},
+	&command{
+		name:     "search",
+		usage:    "/search <text>",
+		summary:  "search this room's stored history (/search next pages)",
+		section:  sectionGeneral,
+		examples: []string{"/search deploy", "/search next"},
+		run:      runSearch,
+	},
+	&command{
+		name:     "recording",
+		usage:    "/recording",
+		summary:  "show what the server keeps about this room and for how long",
+		section:  sectionGeneral,
+		examples: []string{"/recording"},
+		run:      runRecording,
+	},
+	&command{
+		name:     "rooms",
+		usage:    "/rooms [all]",
+		summary:  "list rooms; all includes archived ones",
+		section:  sectionGeneral,
+		examples: []string{"/rooms", "/rooms all"},
+		run:      runRooms,
+	},
+	&command{
+		name:     "join",
+		usage:    "/join <room>",
+		summary:  "switch rooms, creating the room if needed",
+		section:  sectionGeneral,
+		examples: []string{"/join dev"},
+		run:      runJoin,
+	},
+	&command{
+		name:     "room",
+		usage:    "/room [transfer <user> | delete | unarchive]",
+		summary:  "show this room, transfer or delete it (owner), or revive it when archived",
+		section:  sectionModeration,
+		examples: []string{"/room", "/room transfer bob", "/room delete", "/room unarchive"},
+		owner:    true,
+		run:      runRoom,
+	},
+	&command{
+		name:     "roomconfig",
+		usage:    "/roomconfig [<notice> <template>|off|default]",
+		summary:  "show or customise join, leave, away, and back notices (owner)",
+		section:  sectionModeration,
+		examples: []string{"/roomconfig", "/roomconfig join {user} is here", "/roomconfig leave off"},
+		owner:    true,
+		run:      runRoomConfig,
+	},
+	&command{
+		name:     "motd",
+		usage:    "/motd [updated]",
+		summary:  "show the message of the day, or tell everyone it changed (operator)",
+		section:  sectionModeration,
+		examples: []string{"/motd", "/motd updated"},
+		run:      runMOTD,
+	},
+	&command{
+		name:     "topic",
+		usage:    "/topic [<text> | clear]",
+		summary:  "show or set this room's topic (owner)",
+		section:  sectionModeration,
+		examples: []string{"/topic", "/topic release on Friday", "/topic clear"},
+		owner:    true,
+		run:      runTopic,
+	},
+	&command{
+		name:     "stats",
+		usage:    "/stats",
+		summary:  "show server totals and bridge health",
+		section:  sectionGeneral,
+		examples: []string{"/stats"},
+		run:      runStats,
+	},
+	&command{
+		name:     "approve",
+		usage:    "/approve <id> [comment]",
+		summary:  "approve a prompt an external system posted in this room",
+		section:  sectionGeneral,
+		examples: []string{"/approve 42", "/approve 42 go ahead"},
+		run:      runApprove,
+	},
+	&command{
+		name:     "deny",
+		usage:    "/deny <id> [comment]",
+		summary:  "deny a prompt an external system posted in this room",
+		section:  sectionGeneral,
+		examples: []string{"/deny 42", "/deny 42 not during the freeze"},
+		run:      runDeny,
+	},
+	&command{
+		name:     "prompts",
+		usage:    "/prompts",
+		summary:  "list the open prompts in this room",
+		section:  sectionGeneral,
+		examples: []string{"/prompts"},
+		run:      runPrompts,
+	},
+	&command{
+		name:     "version",
+		usage:    "/version",
+		summary:  "show which schat build the server is running",
+		section:  sectionGeneral,
+		examples: []string{"/version"},
+		run:      runVersion,
+	},
+	&command{
+		name:     "cluster",
+		usage:    "/cluster [whois <user>]",
+		summary:  "show cluster nodes, or find which node a user is on",
+		section:  sectionGeneral,
+		examples: []string{"/cluster", "/cluster whois bob"},
+		run:      runCluster,
+	},
+	&command{
+		name:     "translate",
+		usage:    "/translate [on <lang> | off]",
+		summary:  "show machine translations of others' messages",
+		section:  sectionPreferences,
+		examples: []string{"/translate", "/translate on en", "/translate off"},
+		run:      runTranslate,
+	},
+	&command{
+		name:     "notifytest",
+		usage:    "/notifytest",
+		summary:  "send a test event to your notification listeners",
+		section:  sectionPreferences,
+		examples: []string{"/notifytest"},
+		run:      runNotifyTest,
+	},
+	&command{
+		name:     "prompt",
+		usage:    "/prompt [<text> | reset]",
+		summary:  "show or change the text before your input line",
+		section:  sectionPreferences,
+		examples: []string{"/prompt", `/prompt "❯ "`, "/prompt reset"},
+		run:      runPrompt,
+	},
+	&command{
+		name:     "set",
+		usage:    "/set [<name> [<value>]]",
+		summary:  "list your preferences or change color, timestamps, bell, theme, colors, prompt, or statusbar",
+		section:  sectionPreferences,
+		examples: []string{"/set", "/set color cyan", "/set timestamps relative", "/set timestamps hidden", "/set bell on"},
+		run:      runSet,
+	},
+	&command{
+		name:     "theme",
+		usage:    "/theme [<name> | colors <auto | 16 | 256 | truecolor>]",
+		summary:  "show or change your color theme and how many colors your terminal draws",
+		section:  sectionPreferences,
+		examples: []string{"/theme", "/theme solarized", "/theme colors truecolor", "/theme colors auto"},
+		run:      runTheme,
+	},
+	&command{
+		name:     "statusbar",
+		usage:    "/statusbar [top | bottom]",
+		summary:  "show or move the status bar",
+		section:  sectionPreferences,
+		examples: []string{"/statusbar", "/statusbar bottom"},
+		run:      runStatusBar,
+	},
+	&command{
+		name:     "keys",
+		usage:    "/keys [<action> [<key>... | default] | reset]",
+		summary:  "show or remap key bindings, e.g. ctrl+o to switch rooms",
+		section:  sectionPreferences,
+		examples: []string{"/keys", "/keys room ctrl+x", "/keys quit ctrl+c ctrl+d", "/keys room default", "/keys reset"},
+		run:      runKeys,
+	},
+	&command{
+		name:     "ignore",
+		usage:    "/ignore [<user>]",
+		summary:  "list the users you ignore, or stop seeing a user's messages",
+		section:  sectionPreferences,
+		examples: []string{"/ignore", "/ignore spammer"},
+		run:      runIgnore,
+	},
+	&command{
+		name:     "unignore",
+		usage:    "/unignore <user>",
+		summary:  "see an ignored user's messages again",
+		section:  sectionPreferences,
+		examples: []string{"/unignore spammer"},
+		run:      runUnignore,
+	},
+	&command{
+		name:     "highlight",
+		usage:    "/highlight [<word>]",
+		summary:  "list your highlights, or ring the bell and bold a word when it comes up",
+		section:  sectionPreferences,
+		examples: []string{"/highlight", "/highlight deploy"},
+		run:      runHighlight,
+	},
+	&command{
+		name:     "unhighlight",
+		usage:    "/unhighlight <word>",
+		summary:  "stop highlighting a word",
+		section:  sectionPreferences,
+		examples: []string{"/unhighlight deploy"},
+		run:      runUnhighlight,
+	},
+	&command{
+		name:     "register",
+		usage:    "/register <password>",
+		summary:  "protect your username with a password so nobody else can use it",
+		section:  sectionPreferences,
+		examples: []string{"/register correct-horse-battery"},
+		run:      runRegister,
+	},
+	&command{
+		name:     "token",
+		usage:    "/token create|list|revoke",
+		summary:  "manage API tokens for bots and integrations",
+		section:  sectionPreferences,
+		examples: []string{"/token create read-only ci-bot", "/token list"},
+		run:      runToken,
+	},
+	&command{
+		name:     "files",
+		usage:    "/files [rm <id>]",
+		summary:  "list files shared in this room or remove one of yours",
+		section:  sectionGeneral,
+		examples: []string{"/files", "/files rm 3f2a9c1b7d4e"},
+		run:      runFiles,
+	},
+	&command{
+		name:     "upload",
+		usage:    "/upload [name]",
+		summary:  "show how to share a file in this room",
+		section:  sectionGeneral,
+		examples: []string{"/upload notes.txt"},
+		run:      runUpload,
+	},
+	&command{
+		name:     "download",
+		usage:    "/download <id>",
+		summary:  "show how to download a shared file",
+		section:  sectionGeneral,
+		examples: []string{"/download 3f2a9c1b7d4e"},
+		run:      runDownload,
+	},
+	&command{
+		name:     "memstats",
+		usage:    "/memstats",
+		summary:  "show room, session, and process memory usage",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/memstats"},
+		run:      runMemstats,
+	},
+	&command{
+		name:     "probes",
+		usage:    "/probes",
+		summary:  "show the results of the delivery probes",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/probes"},
+		run:      runProbes,
+	},
+	&command{
+		name:     "announce",
+		usage:    "/announce [list | add <schedule> [#room] <text> | rm <id> | now [#room] <text>]",
+		summary:  "schedule system messages, e.g. maintenance reminders, or post one now",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/announce add 0 9 * * 1-5 #dev stand-up in 5 minutes", "/announce add @every 2h remember to stretch", "/announce rm 2", "/announce now restarting at 18:00"},
+		run:      runAnnounce,
+	},
+	&command{
+		name:     "feature",
+		usage:    "/feature [<flag> on|off|reset [global]]",
+		summary:  "list or toggle feature flags",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/feature", "/feature reactions off", "/feature bridges on global", "/feature reactions reset"},
+		run:      runFeature,
+	},
+	&command{
+		name:     "wordfilter",
+		usage:    "/wordfilter [reload]",
+		summary:  "show the word filter or re-read its word file",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/wordfilter", "/wordfilter reload"},
+		run:      runWordFilter,
+	},
+	&command{
+		name:     "automod",
+		usage:    "/automod [pardon <user>]",
+		summary:  "show automod's latest verdicts or lift a user's strikes, mute, and ban",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/automod", "/automod pardon alice"},
+		run:      runAutomod,
+	},
+	&command{
+		name:     "audit",
+		usage:    "/audit [<user>]",
+		summary:  "list the latest moderation and administrative actions, or those involving a user",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/audit", "/audit mallory"},
+		run:      runAudit,
+	},
+	&command{
+		name:     "ban",
+		usage:    "/ban <user|address|range|SHA256:key> [<duration>] [reason]",
+		summary:  "ban a user, key, address, or CIDR range, for good or for a while, and disconnect them",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/ban mallory 7d spamming links", "/ban 203.0.113.0/24 botnet", "/ban SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s"},
+		run:      runBan,
+	},
+	&command{
+		name:     "unban",
+		usage:    "/unban <user|address|range|SHA256:key>",
+		summary:  "lift a ban",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/unban mallory", "/unban 203.0.113.0/24"},
+		run:      runUnban,
+	},
+	&command{
+		name:     "ban-list",
+		usage:    "/ban-list",
+		summary:  "list the bans in force",
+		operator: true,
+		section:  sectionModeration,
+		examples: []string{"/ban-list"},
+		run:      runBanList,
+	},
+)
+
+// isCommand reports whether the submitted line should be dispatched as a command.
+func isCommand(text string) bool {
+	return strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//")
+}
+
+// unescapeCommand drops the slash doubled to send a line starting with "/" as
+// a message, keeping any whitespace typed before it.
+func unescapeCommand(text string) string {
+	body := strings.TrimLeftFunc(text, unicode.IsSpace)
+	if !strings.HasPrefix(body, "//") {
+		return text
+	}
+	return text[:len(text)-len(body)] + body[1:]
+}
+
+// runCommandLine runs a command the user typed. The user counts as active
+// only once it has run, so /away and /back see an auto-away rather than the
+// "is back" the activity would announce first.
+func (s *session) runCommandLine(line string) error {
+	err := s.runCommand(line)
+	s.room().touch(s.client)
+	return err
+}
+
+// runCommand parses and executes a slash command line for the session.
+func (s *session) runCommand(line string) error {
+	name, args, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+	args = strings.TrimSpace(args)
+
+	cmd, ok := s.commands.lookup(strings.ToLower(name))
+	if !ok {
+		return s.printSystem(fmt.Sprintf("unknown command /%s (try /help)", name))
+	}
+	if cmd.operator && !s.client.Operator {
+		s.log.Warn("chat: operator command denied", "command", cmd.name, "room", s.room().Name())
+		return s.printSystem(fmt.Sprintf("/%s: %v", cmd.name, errPermissionDenied))
+	}
+	s.log.Debug("chat: command", "command", cmd.name, "room", s.room().Name())
+	return cmd.run(s, args)
+}
+
+func runWho(s *session, _ string) error {
+	clients := s.room().Clients()
+	now := s.room().now()
+
+	lines := []string{fmt.Sprintf("%d online in #%s:", len(clients), s.room().Name())}
+	for _, client := range clients {
+		line := fmt.Sprintf("  %-16s joined %s  idle %s",
+			client.Username, client.JoinedAt.Format("15:04:05"), formatIdle(now.Sub(client.LastActive())))
+		if p := client.Presence(); p.Away {
+			line += "  " + describeAway(p)
+		}
+		switch client.ClientVersion {
+		case webgateway.ClientVersion:
+			line += "  via web"
+		case telnet.ClientVersion:
+			line += "  via telnet"
+		}
+		lines = append(lines, line)
+	}
+
+	remote, err := s.room().elsewhere()
+	if err != nil {
+		lines = append(lines, "other servers could not be listed: "+err.Error())
+	}
+	if len(remote) > 0 {
+		lines = append(lines, fmt.Sprintf("%d on other servers:", len(remote)))
+		for _, m := range remote {
+			lines = append(lines, fmt.Sprintf("  %-16s on %s", m.User, m.Node))
+		}
+	}
+	return s.printSystem(lines...)
+}
+
+func runWhois(s *session, args string) error {
+	if args == "" {
+		return s.printSystem("usage: /whois <user>")
+	}
+	client, ok := s.room().FindClient(args)
+	if !ok {
+		return s.printSystem(fmt.Sprintf("no such user: %s", args))
+	}
+
+	now := s.room().now()
+	lines := []string{
+		fmt.Sprintf("%s (%s)", client.Username, client.ID),
+		fmt.Sprintf("  room:     #%s", s.room().Name()),
+		fmt.Sprintf("  color:    %s", colorName(client.Color)),
+		fmt.Sprintf("  joined:   %s (idle %s)", client.JoinedAt.Format(timestampFormat), formatIdle(now.Sub(client.LastActive()))),
+		fmt.Sprintf("  client:   %s", valueOr(client.ClientVersion, "unknown")),
+	}
+	if p := client.Presence(); p.Away {
+		lines = append(lines, fmt.Sprintf("  presence: %s since %s", describeAway(p), p.Since.Format("15:04:05")))
+	}
+	if client.Registered() {
+		lines = append(lines, fmt.Sprintf("  auth:     %s", client.AuthMethod))
+	}
+	if client.Operator {
+		lines = append(lines, "  operator: yes")
+	}
+	if s.client.Operator {
+		lines = append(lines, fmt.Sprintf("  address:  %s", valueOr(client.RemoteAddr, "unknown")))
+	}
+	return s.printSystem(lines...)
+}
+
+func runMsg(s *session, args string) error {
+	to, text, _ := strings.Cut(args, " ")
+	text = strings.TrimSpace(text)
+	if to == "" || text == "" {
+		return s.printSystem("usage: /msg <user> <text>")
+	}
+
+	msg, recipient, err := s.room().SendDirect(s.client.ID, to, text)
+	if err != nil {
+		return s.printSystem(fmt.Sprintf("/msg: %v: %s", err, to))
+	}
+	if err := s.printMessage(s.renderer.Render(msg)); err != nil {
+		return err
+	}
+	if err := s.noteTruncated(text); err != nil {
+		return err
+	}
+	if p := recipient.Presence(); p.Away {
+		return s.printSystem(fmt.Sprintf("%s is %s", recipient.Username, describeAway(p)))
+	}
+	return nil
+}
+
+func runMe(s *session, args string) error {
+	if args == "" {
+		return s.printSystem("usage: /me <action>")
+	}
+	msg, err := s.room().Action(s.client.ID, s.client.Username, args)
+	if err != nil {
+		return s.printSystem("message not sent: " + err.Error())
+	}
+	if err := s.printMessage(s.renderer.Render(msg)); err != nil {
+		return err
+	}
+	return s.noteTruncated(args)
+}
+
+func runAway(s *session, args string) error {
+	if err := s.room().SetAway(s.client.ID, args); err != nil {
+		return s.printSystem(fmt.Sprintf("/away: %v", err))
+	}
+	return s.printSystem("you are marked away; /back to return")
+}
+
+func runBack(s *session, _ string) error {
+	if !s.client.Presence().Away {
+		return s.printSystem("you are not away")
+	}
+	return s.room().SetBack(s.client.ID)
+}
+
+func describeAway(p Presence) string {
+	if p.Reason == "" {
+		return "away"
+	}
+	return "away: " + p.Reason
+}
+
+func runMemstats(s *session, _ string) error {
+	stats := s.room().MemoryStats()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	lines := []string{
+		fmt.Sprintf("room: %d clients, queued %d msgs (%s), history %d msgs (%s), input buffers %s",
+			stats.Clients, stats.QueuedMessages, formatBytes(stats.QueuedBytes),
+			stats.HistoryMessages, formatBytes(stats.HistoryBytes), formatBytes(stats.InputBytes)),
+		fmt.Sprintf("process: heap %s, sys %s, goroutines %d",
+			formatBytes(int64(mem.HeapAlloc)), formatBytes(int64(mem.Sys)), runtime.NumGoroutine()),
+	}
+	for i, sess := range stats.Sessions {
+		if i == memstatsTopSessions {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %s (%s): queued %d msgs (%s), input %s",
+			sess.Username, sess.ClientID, sess.QueuedMessages, formatBytes(sess.QueuedBytes), formatBytes(sess.InputBytes)))
+	}
+	return s.printSystem(lines...)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatIdle renders a coarse duration such as "42s", "5m", or "3h12m".
+func formatIdle(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
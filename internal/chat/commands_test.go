@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+func TestWhoListsOnlineUsers(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithClock(func() time.Time { return now }))
+
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	room.Join(ClientInfo{Username: "bob"})
+	now = now.Add(3 * time.Minute)
+
+	require.NoError(t, sess.runCommand("/who"))
+	require.Contains(t, out.String(), "2 online in #lobby")
+	require.Contains(t, out.String(), "alice")
+	require.Contains(t, out.String(), "bob")
+	require.Contains(t, out.String(), "idle 3m")
+}
+
+func TestWhoisHidesAddressFromNonOperators(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{color: "\033[32m"}), WithOperators("root"))
+	room.Join(ClientInfo{Username: "bob", RemoteAddr: "203.0.113.7:5555", ClientVersion: "SSH-2.0-OpenSSH_9.6"})
+
+	guest, guestOut := newCommandTestSession(room, ClientInfo{Username: "guest"})
+	require.NoError(t, guest.runCommand("/whois bob"))
+	require.Contains(t, guestOut.String(), "SSH-2.0-OpenSSH_9.6")
+	require.Contains(t, guestOut.String(), "green")
+	require.NotContains(t, guestOut.String(), "203.0.113.7")
+
+	op, opOut := newCommandTestSession(room, ClientInfo{Username: "root", Account: true})
+	require.NoError(t, op.runCommand("/whois bob"))
+	require.Contains(t, opOut.String(), "203.0.113.7:5555")
+}
+
+func TestOperatorCommandsRequirePrivileges(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "guest"})
+
+	require.NoError(t, sess.runCommand("/memstats"))
+	require.Contains(t, out.String(), errPermissionDenied.Error())
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/nope"))
+	require.Contains(t, out.String(), "unknown command /nope")
+}
+
+// newCommandTestSession joins info to room and returns a session whose terminal
+// output is captured in the returned buffer.
+func newCommandTestSession(room *Room, info ClientInfo) (*session, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	sess := newSession(context.Background(), room, info, nil, nil)
+	sess.ui = tui.NewScreen(out)
+	sess.client = room.Join(info)
+	return sess, out
+}
+
+func TestMeCommand(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	bob := room.AddClient("bob")
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	drainChannel(bob.Send())
+
+	require.NoError(t, sess.runCommand("/me"))
+	require.Contains(t, out.String(), "usage: /me <action>")
+
+	require.NoError(t, sess.runCommand("/me waves"))
+	require.Contains(t, out.String(), "* alice waves")
+	msg := <-bob.Send()
+	require.Equal(t, KindAction, msg.Kind)
+	require.Equal(t, "alice", msg.SenderName)
+}
+
+func TestUnescapeCommand(t *testing.T) {
+	cases := map[string]string{
+		"//foo":        "/foo",
+		"  //foo":      "  /foo",
+		"/// three":    "// three",
+		"hello // bye": "hello // bye",
+		"  plain":      "  plain",
+	}
+	for text, want := range cases {
+		require.Equal(t, want, unescapeCommand(text), text)
+	}
+}
@@ -0,0 +1,163 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Markers shown in place of, or after, messages their sender changed.
+const (
+	editedMarker  = "(edited)"
+	deletedMarker = "(message deleted)"
+)
+
+var (
+	errNothingToChange = errors.New("you have not sent a message to change")
+	errMessageGone     = errors.New("the message is no longer in the room's history")
+)
+
+// sentMessage is the last chat or action message a client sent.
+type sentMessage struct {
+	room *Room
+	id   uint64
+}
+
+// nextMessageID returns an ID greater than any the room handed out before.
+// IDs start from the message's Unix time in nanoseconds, so they keep
+// increasing across restarts and stored records never share one.
+func (r *Room) nextMessageID(ts time.Time) uint64 {
+	for {
+		last := r.lastMessageID.Load()
+		id := max(last+1, uint64(ts.UnixNano()))
+		if r.lastMessageID.CompareAndSwap(last, id) {
+			return id
+		}
+	}
+}
+
+// ownMessage returns the retained message with id, provided senderID sent it
+// and has not deleted it.
+func (r *Room) ownMessage(senderID string, id uint64) (Message, error) {
+	msg, ok := r.history.Find(id)
+	if id == 0 || !ok || msg.Deleted {
+		return Message{}, errMessageGone
+	}
+	if msg.SenderID != senderID {
+		return Message{}, errNothingToChange
+	}
+	return msg, nil
+}
+
+// EditMessage replaces the body of the sender's message with id, then tells
+// every client with an edit event, which it returns as delivered. The new text
+// passes through the plugins like any other message.
+func (r *Room) EditMessage(senderID string, id uint64, text string) (Message, error) {
+	if _, archived := r.Archived(); archived {
+		return Message{}, errRoomArchived
+	}
+	orig, err := r.ownMessage(senderID, id)
+	if err != nil {
+		return Message{}, err
+	}
+	ev, err := r.filterMessage(Message{
+		ID:          id,
+		Timestamp:   r.now(),
+		SenderID:    senderID,
+		SenderName:  orig.SenderName,
+		SenderColor: orig.SenderColor,
+		Body:        r.cleanBody(text),
+		Kind:        KindEdit,
+		ReplyTo:     orig.ReplyTo,
+		ReplyName:   orig.ReplyName,
+		ReplyQuote:  orig.ReplyQuote,
+	})
+	if err != nil {
+		return Message{}, err
+	}
+
+	r.mu.RLock()
+	r.history.Update(id, func(msg *Message) {
+		msg.Body, msg.Edited = ev.Body, true
+	})
+	r.deliverLocked(senderID, ev)
+	r.mu.RUnlock()
+
+	if r.store != nil {
+		if err := r.store.Edit(context.Background(), r.name, id, ev.Body); err != nil {
+			r.logger.Error("chat: persist edit failed", "room", r.name, "err", err)
+		}
+	}
+	return ev, nil
+}
+
+// DeleteMessage retracts the sender's message with id, leaving a tombstone in
+// the room history, and tells every client with a delete event, which it
+// returns as delivered. The stored record is removed.
+func (r *Room) DeleteMessage(senderID string, id uint64) (Message, error) {
+	orig, err := r.ownMessage(senderID, id)
+	if err != nil {
+		return Message{}, err
+	}
+	ev := Message{
+		ID:          id,
+		Timestamp:   r.now(),
+		SenderID:    senderID,
+		SenderName:  orig.SenderName,
+		SenderColor: orig.SenderColor,
+		Kind:        KindDelete,
+	}
+
+	r.mu.RLock()
+	r.history.Update(id, func(msg *Message) {
+		msg.Body, msg.Edited, msg.Deleted = "", false, true
+	})
+	r.deliverLocked(senderID, ev)
+	r.mu.RUnlock()
+
+	if r.store != nil {
+		if err := r.store.Delete(context.Background(), r.name, id); err != nil {
+			r.logger.Error("chat: persist delete failed", "room", r.name, "err", err)
+		}
+	}
+	return ev, nil
+}
+
+// lastSent returns the message /edit and /delete change.
+func (s *session) lastSent() (*sentMessage, error) {
+	sent := s.client.lastSent.Load()
+	if sent == nil {
+		return nil, errNothingToChange
+	}
+	return sent, nil
+}
+
+// runEdit replaces the text of the user's most recent message: /edit <text>.
+func runEdit(s *session, args string) error {
+	text := strings.TrimSpace(args)
+	if text == "" {
+		return s.printSystem("usage: /edit <text>")
+	}
+	sent, err := s.lastSent()
+	if err == nil {
+		var msg Message
+		if msg, err = sent.room.EditMessage(s.client.ID, sent.id, text); err == nil {
+			return s.printMessage(s.renderer.Render(msg))
+		}
+	}
+	return s.printSystem("/edit: " + err.Error())
+}
+
+// runDelete retracts the user's most recent message: /delete.
+func runDelete(s *session, _ string) error {
+	sent, err := s.lastSent()
+	if err == nil {
+		var msg Message
+		if msg, err = sent.room.DeleteMessage(s.client.ID, sent.id); err == nil {
+			s.client.lastSent.CompareAndSwap(sent, nil)
+			return s.printMessage(s.renderer.Render(msg))
+		}
+	}
+	return s.printSystem("/delete: " + err.Error())
+}
@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestMessageIDsIncrease(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithClock(func() time.Time { return now }))
+	alice := room.AddClient("alice")
+
+	first, err := room.Broadcast(alice.ID, "alice", "one")
+	require.NoError(t, err)
+	second, err := room.Action(alice.ID, "alice", "waves")
+	require.NoError(t, err)
+	require.Equal(t, uint64(now.UnixNano()), first.ID, "IDs start from the clock")
+	require.Equal(t, first.ID+1, second.ID, "and stay unique when it does not move")
+}
+
+func TestEditMessage(t *testing.T) {
+	st := store.NewMemory()
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithStore(st))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	msg, err := room.Broadcast(alice.ID, "alice", "deploy at 4")
+	require.NoError(t, err)
+	drainChannel(bob.Send())
+	drainChannel(alice.Send())
+
+	_, err = room.EditMessage(bob.ID, msg.ID, "mine now")
+	require.ErrorIs(t, err, errNothingToChange, "only the sender may edit")
+
+	ev, err := room.EditMessage(alice.ID, msg.ID, "deploy at 5")
+	require.NoError(t, err)
+	require.Equal(t, KindEdit, ev.Kind)
+	require.Equal(t, msg.ID, ev.ID)
+	require.Equal(t, "alice", ev.SenderName)
+	require.Equal(t, ev, <-bob.Send())
+	require.Empty(t, alice.Send(), "the sender echoes its own edit")
+
+	kept, ok := room.history.Find(msg.ID)
+	require.True(t, ok)
+	require.Equal(t, "deploy at 5", kept.Body)
+	require.True(t, kept.Edited)
+
+	found, err := room.Search(context.Background(), "deploy", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "deploy at 5", found[0].Body)
+	require.True(t, found[0].Edited)
+	require.Equal(t, "[0001-01-01 00:00:00] alice: deploy at 5 (edited)", formatSearchResult(Message{SenderName: "alice", Body: "deploy at 5", Edited: true}))
+}
+
+func TestDeleteMessage(t *testing.T) {
+	st := store.NewMemory()
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithStore(st))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	msg, err := room.Broadcast(alice.ID, "alice", "password: hunter2")
+	require.NoError(t, err)
+	drainChannel(bob.Send())
+
+	ev, err := room.DeleteMessage(alice.ID, msg.ID)
+	require.NoError(t, err)
+	require.Equal(t, KindDelete, ev.Kind)
+	require.Equal(t, msg.ID, ev.ID)
+	require.Empty(t, ev.Body)
+	require.Equal(t, ev, <-bob.Send())
+
+	kept, ok := room.history.Find(msg.ID)
+	require.True(t, ok, "a tombstone stays in the history")
+	require.True(t, kept.Deleted)
+	require.Empty(t, kept.Body)
+	found, err := room.Search(context.Background(), "hunter2", 10, 0)
+	require.NoError(t, err)
+	require.Empty(t, found, "the stored message is removed")
+
+	_, err = room.DeleteMessage(alice.ID, msg.ID)
+	require.ErrorIs(t, err, errMessageGone)
+	_, err = room.EditMessage(alice.ID, msg.ID, "back again")
+	require.ErrorIs(t, err, errMessageGone)
+}
+
+func TestEditMessageOutOfHistory(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithHistorySize(1))
+	alice := room.AddClient("alice")
+	msg, err := room.Broadcast(alice.ID, "alice", "first")
+	require.NoError(t, err)
+	_, err = room.Broadcast(alice.ID, "alice", "second")
+	require.NoError(t, err)
+
+	_, err = room.EditMessage(alice.ID, msg.ID, "too late")
+	require.ErrorIs(t, err, errMessageGone)
+}
+
+func TestEditAndDeleteCommands(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	bob := room.AddClient("bob")
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	require.NoError(t, sess.runCommand("/edit"))
+	require.Contains(t, out.String(), "usage: /edit <text>")
+	require.NoError(t, sess.runCommand("/edit hello"))
+	require.Contains(t, out.String(), "/edit: you have not sent a message to change")
+
+	require.NoError(t, sess.broadcastLine("helo"))
+	drainChannel(bob.Send())
+	out.Reset()
+	require.NoError(t, sess.runCommand("/edit hello"))
+	require.Contains(t, out.String(), "alice: hello (edited)")
+	require.Contains(t, newMessageRenderer().Render(<-bob.Send()), "alice: hello (edited)")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/delete"))
+	require.Contains(t, out.String(), "alice: (message deleted)")
+	require.Equal(t, KindDelete, (<-bob.Send()).Kind)
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/delete"))
+	require.Contains(t, out.String(), "/delete: you have not sent a message to change")
+}
@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/audit"
+	"github.com/ledzpl/schat/pkg/features"
+)
+
+// WithFeatures attaches the deployment's feature flags to the room.
+func WithFeatures(set *features.Set) RoomOption {
+	return func(r *Room) {
+		r.features = set
+	}
+}
+
+// FeatureEnabled reports whether flag is on for this room.
+func (r *Room) FeatureEnabled(flag features.Flag) bool {
+	return r.features.Enabled(flag, r.name)
+}
+
+// runFeature lists flags or toggles one: /feature <flag> on|off|reset [global].
+// Changes apply to the current room unless "global" is given.
+func runFeature(s *session, args string) error {
+	set := s.room().features
+	if set == nil {
+		return s.printSystem("feature flags are not configured")
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		lines := []string{fmt.Sprintf("Feature flags in #%s:", s.room().Name())}
+		for _, flag := range features.Known() {
+			state := "off"
+			if s.room().FeatureEnabled(flag) {
+				state = "on"
+			}
+			lines = append(lines, fmt.Sprintf("  %-12s %-3s  %s", flag, state, flag.Describe()))
+		}
+		return s.printSystem(lines...)
+	}
+	if len(fields) < 2 || len(fields) > 3 || (len(fields) == 3 && fields[2] != "global") {
+		return s.printSystem("usage: /feature [<flag> on|off|reset [global]]")
+	}
+
+	flag, err := features.Lookup(fields[0])
+	if err != nil {
+		return s.printSystem(fmt.Sprintf("/feature: %v", err))
+	}
+	room, scope := s.room().Name(), "#"+s.room().Name()
+	if len(fields) == 3 {
+		room, scope = "", "all rooms"
+	}
+
+	switch strings.ToLower(fields[1]) {
+	case "on":
+		err = set.Set(room, flag, true)
+	case "off":
+		err = set.Set(room, flag, false)
+	case "reset":
+		set.Reset(room, flag)
+	default:
+		return s.printSystem("usage: /feature [<flag> on|off|reset [global]]")
+	}
+	if err != nil {
+		return s.printSystem(fmt.Sprintf("/feature: %v", err))
+	}
+	s.room().audit(audit.Entry{Actor: s.client.Username, Action: audit.Feature, Target: string(flag), Room: room,
+		Reason: strings.ToLower(fields[1]) + " for " + scope})
+	return s.printSystem(fmt.Sprintf("%s %s for %s", flag, strings.ToLower(fields[1]), scope))
+}
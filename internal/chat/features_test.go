@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/features"
+)
+
+func TestFeatureCommandTogglesRoomAndGlobal(t *testing.T) {
+	set := features.New(nil)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithOperators("root"), WithFeatures(set))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "root", Account: true})
+
+	require.NoError(t, sess.runCommand("/feature reactions on"))
+	require.Contains(t, out.String(), "reactions on for #lobby")
+	require.True(t, room.FeatureEnabled(features.Reactions))
+	require.False(t, set.Enabled(features.Reactions, "other"))
+
+	require.NoError(t, sess.runCommand("/feature bridges on global"))
+	require.True(t, set.Enabled(features.Bridges, "other"))
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/feature"))
+	require.Regexp(t, `reactions\s+on`, out.String())
+	require.Regexp(t, `web-gateway\s+off`, out.String())
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/feature teleport on"))
+	require.Contains(t, out.String(), "unknown flag")
+
+	require.NoError(t, sess.runCommand("/feature reactions reset"))
+	require.False(t, room.FeatureEnabled(features.Reactions))
+}
+
+func TestFeatureCommandWithoutFlags(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithOperators("root"))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "root", Account: true})
+
+	require.NoError(t, sess.runCommand("/feature"))
+	require.Contains(t, out.String(), "not configured")
+	require.False(t, room.FeatureEnabled(features.Reactions))
+}
@@ -0,0 +1,202 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/fileshare"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+var errFilesDisabled = errors.New("file sharing is not enabled on this server")
+
+// WithFiles enables file sharing backed by store. Users push files with
+// "ssh host upload <name> [#room] < file" and fetch them with
+// "ssh host download <id>"; /files lists what a room has.
+func WithFiles(store *fileshare.Store) RoomOption {
+	return func(r *Room) {
+		r.files = store
+	}
+}
+
+// fileRequest reports whether req execs a file command, returning the command
+// line. Other exec requests are left to be refused.
+func (s *session) fileRequest(req *Request) (string, bool) {
+	if req.Type != RequestExec || s.home.files == nil {
+		return "", false
+	}
+	name, _, _ := strings.Cut(strings.TrimSpace(req.Command), " ")
+	if name != "upload" && name != "download" {
+		return "", false
+	}
+	return strings.TrimSpace(req.Command), true
+}
+
+// serveFileCommand runs an upload or download like a shell command: data on
+// stdin or stdout, errors on stderr, and an exit status.
+func (s *session) serveFileCommand() error {
+	name, args, _ := strings.Cut(s.exec, " ")
+	fields := strings.Fields(args)
+	log := s.log.With("username", s.info.Username, "command", name)
+
+	var err error
+	switch {
+	case name == "upload" && len(fields) > 0:
+		room := ""
+		if last := fields[len(fields)-1]; len(fields) > 1 && strings.HasPrefix(last, "#") {
+			room, fields = last, fields[:len(fields)-1]
+		}
+		err = s.uploadFile(log, strings.Join(fields, " "), room)
+	case name == "download" && len(fields) == 1:
+		err = s.downloadFile(log, fields[0])
+	default:
+		err = errors.New("usage: upload <name> [#room] < file, or download <id> > file")
+	}
+	if err != nil {
+		fmt.Fprintf(stderr(s.channel), "schat: %v\n", err)
+		return sshserver.Exit(sshserver.ExitFailed, err)
+	}
+	return nil
+}
+
+// uploadFile stores stdin as name and announces it in roomName, or the lobby
+// when it is empty. The user must be in that room, and shares the file under
+// the name they joined it as.
+func (s *session) uploadFile(log *slog.Logger, name, roomName string) error {
+	if s.info.AuthMethod == "" {
+		return errors.New("sign in with a password, key, or OIDC to share files")
+	}
+	room := s.home
+	if roomName != "" {
+		manager := s.home.manager
+		if manager == nil {
+			return errRoomsDisabled
+		}
+		var ok bool
+		if room, ok = manager.Room(strings.TrimPrefix(roomName, "#")); !ok {
+			return fmt.Errorf("%w: %s", errNoSuchRoom, roomName)
+		}
+	}
+	member, ok := s.uploader(room)
+	if !ok {
+		return fmt.Errorf("join #%s to share files there", room.Name())
+	}
+
+	store := s.home.files
+	f, err := store.Put(member.Username, room.Name(), name, s.channel)
+	if errors.Is(err, fileshare.ErrTooLarge) {
+		return fmt.Errorf("%w (limit %s)", err, fileshare.FormatSize(store.MaxBytes()))
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("chat: file shared", "room", room.Name(), "file", f.ID, "name", f.Name, "bytes", f.Size)
+	room.broadcastSystem(fmt.Sprintf("%s shared %s (%s); /download %s", f.Owner, f.Name, fileshare.FormatSize(f.Size), f.ID))
+	fmt.Fprintf(s.channel, "shared %s in #%s as %s until %s\n", f.Name, room.Name(), f.ID, f.Expires.Format(timestampFormat))
+	return nil
+}
+
+// uploader finds the user's chat session in room: one signed in the same way
+// under the same name or, failing that, with the same key, which a saved key
+// identity may have joined under another name.
+func (s *session) uploader(room *Room) (*Client, bool) {
+	name := sshserver.CanonicalUsername(s.info.Username)
+	key := s.info.KeyFingerprint
+	var sameKey *Client
+	for _, client := range room.Clients() {
+		if !client.Registered() || key != "" && client.KeyFingerprint != key {
+			continue
+		}
+		if client.Username == name {
+			return client, true
+		}
+		if key != "" && sameKey == nil {
+			sameKey = client
+		}
+	}
+	return sameKey, sameKey != nil
+}
+
+// downloadFile streams a shared file to stdout.
+func (s *session) downloadFile(log *slog.Logger, id string) error {
+	f, data, err := s.home.files.Open(id)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(s.channel, data); err != nil {
+		return sshserver.Exit(sshserver.ExitClientGone, err)
+	}
+	log.Info("chat: file downloaded", "file", f.ID, "bytes", f.Size)
+	return nil
+}
+
+// runFiles lists the files shared in the room or removes one of yours:
+// /files [rm <id>].
+func runFiles(s *session, args string) error {
+	store := s.room().files
+	if store == nil {
+		return s.printSystem(errFilesDisabled.Error())
+	}
+
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		files := store.List(s.room().Name())
+		if len(files) == 0 {
+			return s.printSystem(fmt.Sprintf("no files shared in #%s; /upload shows how to share one", s.room().Name()))
+		}
+		now := s.room().now()
+		lines := []string{fmt.Sprintf("Files in #%s:", s.room().Name())}
+		for _, f := range files {
+			lines = append(lines, fmt.Sprintf("  %s  %-24s %9s  by %s, expires in %s",
+				f.ID, f.Name, fileshare.FormatSize(f.Size), f.Owner, formatIdle(f.Expires.Sub(now))))
+		}
+		return s.printSystem(lines...)
+	case len(fields) == 2 && fields[0] == "rm":
+		if err := store.Delete(s.client.Username, fields[1]); err != nil {
+			return s.printSystem("/files: you have not shared " + fields[1])
+		}
+		return s.printSystem("removed " + fields[1])
+	default:
+		return s.printSystem("usage: /files [rm <id>]")
+	}
+}
+
+// runUpload explains how to share a file in the current room: /upload [name].
+func runUpload(s *session, args string) error {
+	store := s.room().files
+	if store == nil {
+		return s.printSystem(errFilesDisabled.Error())
+	}
+	name := fileshare.CleanName(args)
+	if name == "" {
+		name = "<name>"
+	}
+	return s.printSystem(
+		fmt.Sprintf("to share a file in #%s (up to %s), run from your own shell:", s.room().Name(), fileshare.FormatSize(store.MaxBytes())),
+		fmt.Sprintf("  ssh %s@<this server> upload %s #%s < <file>", s.client.Username, name, s.room().Name()),
+	)
+}
+
+// runDownload explains how to fetch a shared file: /download <id>.
+func runDownload(s *session, args string) error {
+	store := s.room().files
+	if store == nil {
+		return s.printSystem(errFilesDisabled.Error())
+	}
+	id := strings.TrimSpace(args)
+	if id == "" {
+		return s.printSystem("usage: /download <id>; /files lists ids")
+	}
+	f, _, err := store.Open(id)
+	if err != nil {
+		return s.printSystem(fmt.Sprintf("/download: %v", err))
+	}
+	return s.printSystem(
+		fmt.Sprintf("%s (%s) from %s; run from your own shell:", f.Name, fileshare.FormatSize(f.Size), f.Owner),
+		fmt.Sprintf("  ssh %s@<this server> download %s > %s", s.client.Username, f.ID, f.Name),
+	)
+}
@@ -0,0 +1,152 @@
+package chat
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/fileshare"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// dialUser connects to room as user, authenticated with a key when signedIn.
+func dialUser(t *testing.T, room *Room, user string, signedIn bool) *ssh.Client {
+	t.Helper()
+	return dialSSHWith(t, room, user, &ssh.ServerConfig{
+		NoClientAuth: true,
+		NoClientAuthCallback: func(ssh.ConnMetadata) (*ssh.Permissions, error) {
+			if !signedIn {
+				return nil, nil
+			}
+			return &ssh.Permissions{Extensions: map[string]string{sshserver.ExtAuthMethod: "publickey"}}, nil
+		},
+	})
+}
+
+// execRun runs command with stdin and returns its stdout, stderr, and exit
+// status.
+func execRun(t *testing.T, client *ssh.Client, command, stdin string) (string, string, int) {
+	t.Helper()
+	sess, err := client.NewSession()
+	require.NoError(t, err)
+	defer sess.Close()
+
+	var stdout, stderr strings.Builder
+	sess.Stdin = strings.NewReader(stdin)
+	sess.Stdout, sess.Stderr = &stdout, &stderr
+	err = sess.Run(command)
+	var exit *ssh.ExitError
+	if errors.As(err, &exit) {
+		return stdout.String(), stderr.String(), exit.ExitStatus()
+	}
+	require.NoError(t, err)
+	return stdout.String(), stderr.String(), 0
+}
+
+func TestFileUploadAndDownload(t *testing.T) {
+	store := fileshare.New(16, 1024, time.Hour)
+	m := newTestManager(WithRoomOptions(WithFiles(store)))
+	dev, err := m.Create("dev", "")
+	require.NoError(t, err)
+	bob := dev.AddClient("bob")
+	alice := dialUser(t, m.Lobby(), "alice", true)
+	_, errOut, status := execRun(t, alice, "upload my notes.txt #dev", "buy milk")
+	require.Equal(t, 1, status)
+	require.Equal(t, "schat: join #dev to share files there\n", errOut)
+	require.Empty(t, store.List("dev"))
+
+	dev.Join(ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	drainChannel(bob.Send())
+	out, errOut, status := execRun(t, alice, "upload my notes.txt #dev", "buy milk")
+	require.Zero(t, status, errOut)
+	id := regexp.MustCompile(`as ([0-9a-f]+) until`).FindStringSubmatch(out)
+	require.Len(t, id, 2, out)
+	require.Contains(t, out, "shared my_notes.txt in #dev")
+	require.Equal(t, "alice shared my_notes.txt (8 B); /download "+id[1], (<-bob.Send()).Body)
+
+	out, errOut, status = execRun(t, dialUser(t, m.Lobby(), "carol", false), "download "+id[1], "")
+	require.Zero(t, status, errOut)
+	require.Equal(t, "buy milk", out, "anyone with the id may download")
+
+	_, errOut, status = execRun(t, alice, "upload big.bin #dev", strings.Repeat("x", 17))
+	require.Equal(t, 1, status)
+	require.Equal(t, "schat: fileshare: file is too large (limit 16 B)\n", errOut)
+
+	_, errOut, status = execRun(t, alice, "download 000000000000", "")
+	require.Equal(t, 1, status)
+	require.Equal(t, "schat: fileshare: no such file\n", errOut)
+
+	_, errOut, status = execRun(t, alice, "upload x #nowhere", "x")
+	require.Equal(t, 1, status)
+	require.Equal(t, "schat: no such room: #nowhere\n", errOut)
+
+	_, errOut, status = execRun(t, alice, "upload", "")
+	require.Equal(t, 1, status)
+	require.Contains(t, errOut, "usage: upload <name> [#room] < file")
+}
+
+func TestFileUploadNeedsSignIn(t *testing.T) {
+	store := fileshare.New(16, 1024, time.Hour)
+	room := NewRoom(WithFiles(store))
+
+	_, errOut, status := execRun(t, dialUser(t, room, "guest", false), "upload a.txt", "hi")
+	require.Equal(t, 1, status)
+	require.Contains(t, errOut, "sign in with a password, key, or OIDC to share files")
+	require.Empty(t, store.List("lobby"))
+}
+
+func TestFileExecRefusedWhenDisabled(t *testing.T) {
+	sess, err := dialUser(t, NewRoom(), "alice", true).NewSession()
+	require.NoError(t, err)
+	defer sess.Close()
+	require.Error(t, sess.Run("upload a.txt"), "the exec request is refused")
+}
+
+func TestFilesCommands(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	store := fileshare.New(1<<20, 1<<20, 2*time.Hour, fileshare.WithClock(func() time.Time { return now }))
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithClock(func() time.Time { return now }), WithFiles(store))
+	f, err := store.Put("alice", "lobby", "notes.txt", strings.NewReader("buy milk"))
+	require.NoError(t, err)
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "bob"})
+
+	require.NoError(t, sess.runCommand("/files"))
+	require.Regexp(t, f.ID+`  notes\.txt +8 B  by alice, expires in 2h00m`, out.String())
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/download "+f.ID))
+	require.Contains(t, out.String(), "notes.txt (8 B) from alice; run from your own shell:")
+	require.Contains(t, out.String(), "ssh bob@<this server> download "+f.ID+" > notes.txt")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/upload"))
+	require.Contains(t, out.String(), "to share a file in #lobby (up to 1.0 MB)")
+	require.Contains(t, out.String(), "ssh bob@<this server> upload <name> #lobby < <file>")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/files rm "+f.ID))
+	require.Contains(t, out.String(), "/files: you have not shared "+f.ID)
+	alice, aliceOut := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	require.NoError(t, alice.runCommand("/files rm "+f.ID))
+	require.Contains(t, aliceOut.String(), "removed "+f.ID)
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/files"))
+	require.Contains(t, out.String(), "no files shared in #lobby")
+}
+
+func TestFilesCommandsWhenDisabled(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "bob"})
+
+	for _, cmd := range []string{"/files", "/upload", "/download abc"} {
+		out.Reset()
+		require.NoError(t, sess.runCommand(cmd))
+		require.Contains(t, out.String(), "file sharing is not enabled on this server", cmd)
+	}
+}
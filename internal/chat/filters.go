@@ -0,0 +1,299 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Keys of the filter preferences kept in the store, each a comma-separated
+// list.
+const (
+	ignoreSetting    = "ignore"
+	highlightSetting = "highlight"
+)
+
+const (
+	// maxFilterEntries bounds how many users one can ignore and how many
+	// words one can highlight.
+	maxFilterEntries = 50
+	// maxHighlightRunes bounds one highlighted word.
+	maxHighlightRunes = 32
+	seqBold           = "\033[1m"
+)
+
+var (
+	errBadHighlight   = fmt.Errorf("a highlight is one word of at most %d characters, without commas", maxHighlightRunes)
+	errTooManyFilters = fmt.Errorf("at most %d entries are kept", maxFilterEntries)
+	errIgnoreSelf     = errors.New("you cannot ignore yourself")
+)
+
+// messageFilters are one session's filters over the messages it is sent:
+// users whose messages it does not show and words it highlights. The read
+// loop changes them while the relay applies them.
+type messageFilters struct {
+	mu sync.RWMutex
+	// ignored holds lower-cased usernames.
+	ignored    map[string]bool
+	highlights []string
+}
+
+func newMessageFilters() *messageFilters {
+	return &messageFilters{ignored: make(map[string]bool)}
+}
+
+// hides reports whether msg comes from an ignored user. System messages
+// always get through.
+func (f *messageFilters) hides(msg Message) bool {
+	if f == nil || msg.Kind == KindSystem || msg.SenderName == "" {
+		return false
+	}
+	return f.ignores(msg.SenderName)
+}
+
+func (f *messageFilters) ignores(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ignored[strings.ToLower(name)]
+}
+
+// ignore adds name to the ignored users, reporting false if it was already.
+func (f *messageFilters) ignore(name string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name = strings.ToLower(name)
+	if f.ignored[name] {
+		return false, nil
+	}
+	if len(f.ignored) >= maxFilterEntries {
+		return false, errTooManyFilters
+	}
+	f.ignored[name] = true
+	return true, nil
+}
+
+// unignore removes name from the ignored users, reporting whether it was
+// there.
+func (f *messageFilters) unignore(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name = strings.ToLower(name)
+	if !f.ignored[name] {
+		return false
+	}
+	delete(f.ignored, name)
+	return true
+}
+
+// ignoredUsers returns the ignored usernames, sorted.
+func (f *messageFilters) ignoredUsers() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	names := make([]string, 0, len(f.ignored))
+	for name := range f.ignored {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// visibleTypists drops ignored users from the names typing in the room.
+func (f *messageFilters) visibleTypists(names []string) []string {
+	return slices.DeleteFunc(names, f.ignores)
+}
+
+func validHighlight(word string) bool {
+	n := utf8.RuneCountInString(word)
+	return n > 0 && n <= maxHighlightRunes && !strings.ContainsAny(word, ",") &&
+		!strings.ContainsFunc(word, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) })
+}
+
+// highlight adds word to the highlighted words, reporting false if it was
+// already.
+func (f *messageFilters) highlight(word string) (bool, error) {
+	if !validHighlight(word) {
+		return false, errBadHighlight
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if slices.ContainsFunc(f.highlights, func(w string) bool { return strings.EqualFold(w, word) }) {
+		return false, nil
+	}
+	if len(f.highlights) >= maxFilterEntries {
+		return false, errTooManyFilters
+	}
+	f.highlights = append(f.highlights, word)
+	return true, nil
+}
+
+// unhighlight removes word from the highlighted words, reporting whether it
+// was there.
+func (f *messageFilters) unhighlight(word string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.highlights)
+	f.highlights = slices.DeleteFunc(f.highlights, func(w string) bool { return strings.EqualFold(w, word) })
+	return len(f.highlights) < n
+}
+
+// highlightedWords returns the highlighted words in the order they were
+// added.
+func (f *messageFilters) highlightedWords() []string {
+	if f == nil {
+		return nil
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return slices.Clone(f.highlights)
+}
+
+// settings adds the filters to a user's saved preferences.
+func (f *messageFilters) settings(settings map[string]string) {
+	if users := f.ignoredUsers(); len(users) > 0 {
+		settings[ignoreSetting] = strings.Join(users, ",")
+	}
+	if words := f.highlightedWords(); len(words) > 0 {
+		settings[highlightSetting] = strings.Join(words, ",")
+	}
+}
+
+// load restores the filters from a user's saved preferences, skipping
+// entries that are no longer valid.
+func (f *messageFilters) load(settings map[string]string) {
+	for _, name := range strings.Split(settings[ignoreSetting], ",") {
+		if name != "" {
+			_, _ = f.ignore(name)
+		}
+	}
+	for _, word := range strings.Split(settings[highlightSetting], ",") {
+		if word != "" {
+			_, _ = f.highlight(word)
+		}
+	}
+}
+
+// highlightWords wraps every whole-word, case-insensitive occurrence of words
+// in body in style, returning the new body and whether any was found.
+func highlightWords(body string, words []string, style string) (string, bool) {
+	var b strings.Builder
+	last, hit := 0, false
+	for i := 0; i < len(body); {
+		if n := matchWord(body, i, words); n > 0 {
+			b.WriteString(body[last:i])
+			b.WriteString(style)
+			b.WriteString(body[i : i+n])
+			b.WriteString(colorReset)
+			i += n
+			last, hit = i, true
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(body[i:])
+		i += size
+	}
+	if !hit {
+		return body, false
+	}
+	b.WriteString(body[last:])
+	return b.String(), true
+}
+
+// matchWord returns the length of the word starting at body[i] that is one
+// of words, or 0.
+func matchWord(body string, i int, words []string) int {
+	if i > 0 {
+		prev, _ := utf8.DecodeLastRuneInString(body[:i])
+		if isWordRune(prev) {
+			return 0
+		}
+	}
+	for _, w := range words {
+		end := i + len(w)
+		if end > len(body) || !strings.EqualFold(body[i:end], w) {
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(body[end:]); end < len(body) && isWordRune(next) {
+			continue
+		}
+		return len(w)
+	}
+	return 0
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// runIgnore lists the users whose messages the session hides, or hides one
+// more: /ignore [<user>].
+func runIgnore(s *session, args string) error {
+	if args == "" {
+		users := s.prefs.filters.ignoredUsers()
+		if len(users) == 0 {
+			return s.printSystem("you are not ignoring anyone")
+		}
+		return s.printSystem("ignoring: " + strings.Join(users, ", "))
+	}
+	name := strings.TrimPrefix(args, "@")
+	if name == "" || strings.ContainsAny(name, ", ") {
+		return s.printSystem("usage: /ignore [<user>]")
+	}
+	if strings.EqualFold(name, s.client.Username) {
+		return s.printSystem("/ignore: " + errIgnoreSelf.Error())
+	}
+	added, err := s.prefs.filters.ignore(name)
+	if err != nil {
+		return s.printSystem("/ignore: " + err.Error())
+	}
+	if !added {
+		return s.printSystem("you are already ignoring " + name)
+	}
+	return s.printSystem("ignoring " + name + "; /unignore " + name + " shows their messages again" + s.savePreferences())
+}
+
+// runUnignore shows a user's messages again: /unignore <user>.
+func runUnignore(s *session, args string) error {
+	if args == "" {
+		return s.printSystem("usage: /unignore <user>")
+	}
+	name := strings.TrimPrefix(args, "@")
+	if !s.prefs.filters.unignore(name) {
+		return s.printSystem("you are not ignoring " + name)
+	}
+	return s.printSystem("no longer ignoring " + name + s.savePreferences())
+}
+
+// runHighlight lists the words that ring the bell, or adds one:
+// /highlight [<word>].
+func runHighlight(s *session, args string) error {
+	if args == "" {
+		words := s.prefs.filters.highlightedWords()
+		if len(words) == 0 {
+			return s.printSystem("no words are highlighted")
+		}
+		return s.printSystem("highlighting: " + strings.Join(words, ", "))
+	}
+	added, err := s.prefs.filters.highlight(args)
+	if err != nil {
+		return s.printSystem("/highlight: " + err.Error())
+	}
+	if !added {
+		return s.printSystem(args + " is already highlighted")
+	}
+	return s.printSystem("highlighting " + args + s.savePreferences())
+}
+
+// runUnhighlight stops highlighting a word: /unhighlight <word>.
+func runUnhighlight(s *session, args string) error {
+	if args == "" {
+		return s.printSystem("usage: /unhighlight <word>")
+	}
+	if !s.prefs.filters.unhighlight(args) {
+		return s.printSystem(args + " is not highlighted")
+	}
+	return s.printSystem("no longer highlighting " + args + s.savePreferences())
+}
@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestHighlightWords(t *testing.T) {
+	got, hit := highlightWords("Deploy done; redeploy later, deploy!", []string{"deploy"}, "<")
+	require.True(t, hit)
+	require.Equal(t, "<Deploy"+colorReset+" done; redeploy later, <deploy"+colorReset+"!", got)
+	_, hit = highlightWords("deployment", []string{"deploy"}, "<")
+	require.False(t, hit, "only whole words match")
+	_, hit = highlightWords("anything", nil, "<")
+	require.False(t, hit)
+}
+
+func TestMessageFilters(t *testing.T) {
+	f := newMessageFilters()
+	added, err := f.ignore("Bob")
+	require.NoError(t, err)
+	require.True(t, added)
+	added, err = f.ignore("bob")
+	require.NoError(t, err)
+	require.False(t, added)
+	require.True(t, f.hides(Message{Kind: KindChat, SenderName: "BOB"}))
+	require.True(t, f.hides(Message{Kind: KindTyping, SenderName: "bob"}))
+	require.False(t, f.hides(Message{Kind: KindSystem, SenderName: "bob", Body: "bob joined the chat"}))
+	require.Equal(t, []string{"carol"}, f.visibleTypists([]string{"bob", "carol"}))
+
+	_, err = f.highlight("two words")
+	require.ErrorIs(t, err, errBadHighlight)
+	_, err = f.highlight("a,b")
+	require.ErrorIs(t, err, errBadHighlight)
+	added, err = f.highlight("deploy")
+	require.NoError(t, err)
+	require.True(t, added)
+
+	settings := map[string]string{}
+	f.settings(settings)
+	require.Equal(t, map[string]string{ignoreSetting: "bob", highlightSetting: "deploy"}, settings)
+	loaded := newMessageFilters()
+	loaded.load(settings)
+	require.Equal(t, []string{"bob"}, loaded.ignoredUsers())
+	require.Equal(t, []string{"deploy"}, loaded.highlightedWords())
+
+	require.True(t, f.unignore("BOB"))
+	require.False(t, f.unignore("bob"))
+	require.True(t, f.unhighlight("Deploy"))
+	require.Empty(t, f.highlightedWords())
+}
+
+func TestIgnoreHidesMessages(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	bob := room.AddClient("bob")
+	carol := room.AddClient("carol")
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	sess.renderer.setViewer("alice", "")
+
+	require.NoError(t, sess.runCommand("/ignore alice"))
+	require.Contains(t, out.String(), "/ignore: "+errIgnoreSelf.Error())
+	require.NoError(t, sess.runCommand("/ignore @bob"))
+	require.Contains(t, out.String(), "ignoring bob; /unignore bob shows their messages again (this session only; the server does not save preferences)")
+	require.NoError(t, sess.runCommand("/highlight deploy"))
+	drainChannel(sess.client.Send())
+	out.Reset()
+
+	_, err := room.Broadcast(bob.ID, "bob", "buy my stuff")
+	require.NoError(t, err)
+	_, err = room.Broadcast(carol.ID, "carol", "time to deploy")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sess.relayMessage(<-sess.client.Send()))
+	}
+	require.NotContains(t, out.String(), "buy my stuff")
+	require.Contains(t, out.String(), "carol: time to "+seqBold+"deploy"+colorReset+seqBell)
+
+	require.NoError(t, sess.runCommand("/unignore bob"))
+	_, err = room.Broadcast(bob.ID, "bob", "sorry")
+	require.NoError(t, err)
+	require.NoError(t, sess.relayMessage(<-sess.client.Send()))
+	require.Contains(t, out.String(), "bob: sorry")
+}
+
+func TestFiltersPersistForRegisteredUsers(t *testing.T) {
+	st := store.NewMemory()
+	room := NewRoom(WithStore(st))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	require.NoError(t, sess.runCommand("/ignore bob"))
+	require.NoError(t, sess.runCommand("/highlight outage"))
+	require.NoError(t, sess.runCommand("/highlight"))
+	require.Contains(t, out.String(), "highlighting: outage")
+
+	settings, err := st.UserSettings(context.Background(), "alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{ignoreSetting: "bob", highlightSetting: "outage"}, settings)
+
+	next, out := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	next.loadPreferences()
+	require.NoError(t, next.runCommand("/ignore"))
+	require.Contains(t, out.String(), "ignoring: bob")
+}
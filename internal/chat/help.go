@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// helpSection groups commands in /help.
+type helpSection string
+
+const (
+	sectionGeneral     helpSection = "general"
+	sectionModeration  helpSection = "moderation"
+	sectionPreferences helpSection = "preferences"
+)
+
+// helpSections is the order sections are paged through.
+var helpSections = []helpSection{sectionGeneral, sectionModeration, sectionPreferences}
+
+// helpPageSize bounds the commands listed per /help page so a page fits on
+// small terminals.
+const helpPageSize = 10
+
+// helpPage is one screen of /help.
+type helpPage struct {
+	section helpSection
+	cmds    []*command
+}
+
+// helpPages splits the commands visible to the caller into pages, starting a
+// new page for every section.
+func (c *commandSet) helpPages(operator bool) []helpPage {
+	var pages []helpPage
+	for _, section := range helpSections {
+		var cmds []*command
+		for _, cmd := range c.ordered {
+			if cmd.section == section && (!cmd.operator || operator) {
+				cmds = append(cmds, cmd)
+			}
+		}
+		for len(cmds) > 0 {
+			n := min(len(cmds), helpPageSize)
+			pages = append(pages, helpPage{section: section, cmds: cmds[:n]})
+			cmds = cmds[n:]
+		}
+	}
+	return pages
+}
+
+// runHelp pages through the commands: /help starts over, /help next turns the
+// page, /help <section> jumps to a section, and /help <command> shows the
+// command's usage, permissions, and examples.
+func runHelp(s *session, args string) error {
+	pages := s.commands.helpPages(s.client.Operator)
+	topic := strings.ToLower(strings.TrimPrefix(args, "/"))
+
+	page := 0
+	switch topic {
+	case "":
+	case "next":
+		page = s.helpPage
+		if page >= len(pages) {
+			page = 0
+		}
+	default:
+		if cmd, ok := s.commands.lookup(topic); ok && (!cmd.operator || s.client.Operator) {
+			return s.printSystem(describeCommand(cmd)...)
+		}
+		page = -1
+		for i, p := range pages {
+			if string(p.section) == topic {
+				page = i
+				break
+			}
+		}
+		if page < 0 {
+			return s.printSystem(fmt.Sprintf("/help: no command or section %q (sections: %s)", args, joinSections()))
+		}
+	}
+
+	p := pages[page]
+	lines := []string{fmt.Sprintf("%s commands (page %d/%d):", p.section, page+1, len(pages))}
+	for _, cmd := range p.cmds {
+		lines = append(lines, fmt.Sprintf("  %-12s %s", "/"+cmd.name, cmd.summary))
+	}
+	s.helpPage = page + 1
+	if s.helpPage < len(pages) {
+		lines = append(lines, fmt.Sprintf("/help next for %s, /help <command> for details", pages[s.helpPage].section))
+	} else {
+		lines = append(lines, "/help <command> for details")
+	}
+	return s.printSystem(lines...)
+}
+
+// describeCommand renders /help <command> from the command's metadata.
+func describeCommand(cmd *command) []string {
+	permission := "everyone"
+	switch {
+	case cmd.operator:
+		permission = "server operators"
+	case cmd.owner:
+		permission = "everyone; changes need the room owner or an operator"
+	}
+	lines := []string{
+		fmt.Sprintf("/%s - %s", cmd.name, cmd.summary),
+		"  usage:      " + cmd.usage,
+		"  section:    " + string(cmd.section),
+		"  permission: " + permission,
+	}
+	if len(cmd.examples) > 0 {
+		lines = append(lines, "  examples:")
+		for _, example := range cmd.examples {
+			lines = append(lines, "    "+example)
+		}
+	}
+	return lines
+}
+
+func joinSections() string {
+	names := make([]string, len(helpSections))
+	for i, section := range helpSections {
+		names[i] = string(section)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinCommandsHaveHelp(t *testing.T) {
+	for _, cmd := range builtinCommands.ordered {
+		require.Contains(t, helpSections, cmd.section, "/%s has no help section", cmd.name)
+		require.NotEmpty(t, cmd.examples, "/%s has no examples", cmd.name)
+		for _, example := range cmd.examples {
+			require.Regexp(t, `^/`+cmd.name+`( |$)`, example)
+		}
+	}
+}
+
+func TestHelpPages(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "guest"})
+
+	require.NoError(t, sess.runCommand("/help"))
+	require.Contains(t, out.String(), "general commands (page 1/6):")
+	require.Contains(t, out.String(), "/help next for general")
+
+	cases := []struct {
+		args string
+		want string
+	}{
+		{"/help next", "general commands (page 2/6):"},
+		{"/help next", "general commands (page 3/6):"},
+		{"/help next", "moderation commands (page 4/6):"},
+		{"/help next", "preferences commands (page 5/6):"},
+		{"/help next", "preferences commands (page 6/6):"},
+		{"/help next", "general commands (page 1/6):"},
+		{"/help Preferences", "preferences commands (page 5/6):"},
+		{"/help bogus", `no command or section "bogus" (sections: general, moderation, preferences)`},
+	}
+	for _, tc := range cases {
+		out.Reset()
+		require.NoError(t, sess.runCommand(tc.args))
+		require.Contains(t, out.String(), tc.want, tc.args)
+	}
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/help moderation"))
+	require.Contains(t, out.String(), "/topic")
+	require.NotContains(t, out.String(), "/memstats", "operator commands are hidden")
+}
+
+func TestHelpCommandDetail(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithOperators("root"))
+	guest, guestOut := newCommandTestSession(room, ClientInfo{Username: "guest"})
+
+	require.NoError(t, guest.runCommand("/help /topic"))
+	require.Contains(t, guestOut.String(), "/topic - show or set this room's topic (owner)")
+	require.Contains(t, guestOut.String(), "usage:      /topic [<text> | clear]")
+	require.Contains(t, guestOut.String(), "section:    moderation")
+	require.Contains(t, guestOut.String(), "permission: everyone; changes need the room owner or an operator")
+	require.Contains(t, guestOut.String(), "    /topic clear")
+
+	guestOut.Reset()
+	require.NoError(t, guest.runCommand("/help memstats"))
+	require.Contains(t, guestOut.String(), `no command or section "memstats"`)
+
+	op, opOut := newCommandTestSession(room, ClientInfo{Username: "root", Account: true})
+	require.NoError(t, op.runCommand("/help memstats"))
+	require.Contains(t, opOut.String(), "permission: server operators")
+	require.NoError(t, op.runCommand("/help moderation"))
+	require.Contains(t, opOut.String(), "/memstats")
+}
+
+func TestHelpPagesSplitLongSections(t *testing.T) {
+	var cmds []*command
+	for i := 0; i < helpPageSize+2; i++ {
+		cmds = append(cmds, &command{name: string(rune('a' + i)), section: sectionGeneral})
+	}
+	cmds = append(cmds, &command{name: "op", section: sectionModeration, operator: true})
+	set := newCommandSet(cmds...)
+
+	pages := set.helpPages(false)
+	require.Len(t, pages, 2)
+	require.Len(t, pages[0].cmds, helpPageSize)
+	require.Len(t, pages[1].cmds, 2)
+	require.Len(t, set.helpPages(true), 3)
+}
@@ -0,0 +1,99 @@
+package chat
+
+import "sync"
+
+const defaultHistorySize = 100
+
+// history keeps the most recent room messages in a fixed-size ring.
+type history struct {
+	mu    sync.RWMutex
+	buf   []Message
+	start int
+	count int
+	bytes int64
+}
+
+func newHistory(size int) *history {
+	if size < 0 {
+		size = 0
+	}
+	return &history{buf: make([]Message, size)}
+}
+
+func (h *history) Add(msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.buf) == 0 {
+		return
+	}
+
+	idx := (h.start + h.count) % len(h.buf)
+	if h.count == len(h.buf) {
+		h.bytes -= int64(h.buf[h.start].size())
+		h.start = (h.start + 1) % len(h.buf)
+	} else {
+		h.count++
+	}
+	h.buf[idx] = msg
+	h.bytes += int64(msg.size())
+}
+
+// Update applies fn to the retained message with id and returns the result.
+// It reports false when the message has left the buffer.
+func (h *history) Update(id uint64, fn func(*Message)) (Message, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := h.count - 1; i >= 0; i-- {
+		msg := &h.buf[(h.start+i)%len(h.buf)]
+		if msg.ID != id {
+			continue
+		}
+		h.bytes -= int64(msg.size())
+		fn(msg)
+		h.bytes += int64(msg.size())
+		return *msg, true
+	}
+	return Message{}, false
+}
+
+// Find returns the retained message with id.
+func (h *history) Find(id uint64) (Message, bool) {
+	return h.Last(func(msg Message) bool { return msg.ID == id })
+}
+
+// Last returns the newest retained message match accepts.
+func (h *history) Last(match func(Message) bool) (Message, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for i := h.count - 1; i >= 0; i-- {
+		if msg := h.buf[(h.start+i)%len(h.buf)]; match(msg) {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// Recent returns up to n of the newest messages, oldest first. n <= 0 returns all.
+func (h *history) Recent(n int) []Message {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if n <= 0 || n > h.count {
+		n = h.count
+	}
+	out := make([]Message, 0, n)
+	for i := h.count - n; i < h.count; i++ {
+		out = append(out, h.buf[(h.start+i)%len(h.buf)])
+	}
+	return out
+}
+
+// Stats reports how many messages are retained and their approximate footprint.
+func (h *history) Stats() (messages int, bytes int64) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.count, h.bytes
+}
@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// WithIdentities gives users who sign in with a public key the username,
+// color, and operator status saved for that key, whatever SSH username they
+// connect as.
+func WithIdentities(ids *sshserver.Identities) RoomOption {
+	return func(r *Room) {
+		r.identities = ids
+	}
+}
+
+// identify applies the profile saved for the key info signed in with, creating
+// it on the key's first visit. Account logins keep their name, which the
+// account password or key already proved.
+func (r *Room) identify(info ClientInfo) ClientInfo {
+	if r.identities == nil || info.KeyFingerprint == "" || info.Account {
+		return info
+	}
+	registered := func(user string) bool {
+		return r.accounts != nil && r.accounts.Registered(user)
+	}
+	want := sshserver.Profile{User: info.Username}
+	if color := r.nextColor(); color != "" {
+		want.Color = colorName(color)
+	}
+	profile, err := r.identities.Claim(info.KeyFingerprint, want, registered)
+	if err != nil {
+		r.logger.Error("chat: key identity failed", "fingerprint", info.KeyFingerprint, "err", err)
+		return info
+	}
+	if profile.User != info.Username && registered(profile.User) {
+		// Someone registered the name after the key claimed it; the account
+		// wins, and the key is left with the name it connected as.
+		r.logger.Warn("chat: key identity names a registered account", "fingerprint", info.KeyFingerprint, "user", profile.User)
+		return info
+	}
+	info.Username = profile.User
+	info.Color = colorCode(profile.Color)
+	info.Operator = info.Operator || profile.Operator
+	info.keyBound = true
+	return info
+}
+
+// colorCode returns the ANSI sequence of a color name from colorName, or ""
+// for names it does not know.
+func colorCode(name string) string {
+	for code, n := range colorNames {
+		if n == name {
+			return code
+		}
+	}
+	return ""
+}
+
+// showIdentity tells a user who connected as requested which name their key
+// gave them instead.
+func (r *Room) showIdentity(client *Client, requested string) {
+	if requested == "" || client.Username == requested {
+		return
+	}
+	client.deliver(Message{
+		Timestamp: r.now(),
+		Body:      fmt.Sprintf("your key is known here as %s, so you joined as %s rather than %s", client.Username, client.Username, requested),
+		Kind:      KindSystem,
+	}, r.backpressure, r.backpressureTimeout)
+}
@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+func TestIdentifyKeepsNameAndColorPerKey(t *testing.T) {
+	dir := t.TempDir()
+	ids, err := sshserver.OpenIdentities(filepath.Join(dir, "identities.json"))
+	require.NoError(t, err)
+	accounts, err := sshserver.OpenAccounts(filepath.Join(dir, "accounts.json"))
+	require.NoError(t, err)
+	picker := &staticColorPicker{color: "\033[36m"}
+	room := NewRoom(WithColorPicker(picker), WithIdentities(ids), WithAccounts(accounts))
+
+	first := room.identify(ClientInfo{Username: "alice", AuthMethod: "publickey", KeyFingerprint: "SHA256:alice"})
+	require.Equal(t, "alice", first.Username)
+	require.Equal(t, "\033[36m", first.Color)
+
+	// Reconnecting with the same key under another SSH username.
+	picker.color = "\033[31m"
+	info := room.identify(ClientInfo{Username: "root", AuthMethod: "publickey", KeyFingerprint: "SHA256:alice"})
+	require.Equal(t, "alice", info.Username)
+	client := room.Join(info)
+	require.Equal(t, "alice", client.Username)
+	require.Equal(t, "\033[36m", client.Color)
+	room.showIdentity(client, "root")
+	require.Contains(t, (<-client.Send()).Body, "joined the chat")
+	require.Contains(t, (<-client.Send()).Body, "your key is known here as alice, so you joined as alice rather than root")
+
+	other := room.identify(ClientInfo{Username: "alice", AuthMethod: "publickey", KeyFingerprint: "SHA256:other"})
+	require.Equal(t, "alice-2", other.Username, "another key cannot take the name")
+
+	// Without a key, or after an account login, names are left alone.
+	require.Equal(t, "alice", room.identify(ClientInfo{Username: "alice"}).Username)
+	require.Equal(t, "bob", room.identify(ClientInfo{Username: "bob", KeyFingerprint: "SHA256:alice", Account: true}).Username)
+
+	// A name registered after the key claimed it belongs to the account.
+	require.NoError(t, accounts.Register("alice-2", "correct horse", ""))
+	require.Equal(t, "mallory", room.identify(ClientInfo{Username: "mallory", KeyFingerprint: "SHA256:other"}).Username)
+}
+
+func TestIdentifyRestoresOperatorStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"fingerprint": "SHA256:carol", "user": "carol", "operator": true}]`), 0o600))
+	ids, err := sshserver.OpenIdentities(path)
+	require.NoError(t, err)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithIdentities(ids), WithOperators("alice"))
+
+	info := room.identify(ClientInfo{Username: "c", KeyFingerprint: "SHA256:carol"})
+	require.Equal(t, "carol", info.Username)
+	require.True(t, room.Join(info).Operator, "the profile makes the key an operator")
+
+	info = room.identify(ClientInfo{Username: "alice", KeyFingerprint: "SHA256:alice"})
+	require.True(t, room.Join(info).Operator)
+	info = room.identify(ClientInfo{Username: "guest", KeyFingerprint: "SHA256:alice"})
+	require.True(t, room.Join(info).Operator, "operator status follows the key's name")
+	require.False(t, room.Join(ClientInfo{Username: "guest"}).Operator)
+	require.False(t, room.Join(ClientInfo{Username: "alice"}).Operator, "only the key that holds the name is an operator")
+}
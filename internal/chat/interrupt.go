@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// InterruptPolicy decides what the cancel key (Ctrl+C by default) does.
+type InterruptPolicy int
+
+const (
+	// InterruptDouble clears the input line and quits when pressed twice in a
+	// row, like most chat clients.
+	InterruptDouble InterruptPolicy = iota
+	// InterruptQuit quits at once.
+	InterruptQuit
+	// InterruptClear only clears the input line; the quit key still quits.
+	InterruptClear
+)
+
+var interruptPolicyNames = map[InterruptPolicy]string{
+	InterruptDouble: "double",
+	InterruptQuit:   "quit",
+	InterruptClear:  "clear",
+}
+
+// String returns the flag-friendly name of the policy.
+func (p InterruptPolicy) String() string {
+	if name, ok := interruptPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("InterruptPolicy(%d)", int(p))
+}
+
+// ParseInterruptPolicy converts a policy name such as "double" into a policy.
+func ParseInterruptPolicy(name string) (InterruptPolicy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for policy, candidate := range interruptPolicyNames {
+		if candidate == name {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("chat: unknown interrupt policy %q", name)
+}
+
+// WithInterrupt selects what the cancel key does; the default is
+// InterruptDouble.
+func WithInterrupt(policy InterruptPolicy) RoomOption {
+	return func(r *Room) {
+		r.interrupt = policy
+	}
+}
+
+// cancelInput handles the cancel key and reports whether the session should
+// end.
+func (s *session) cancelInput(key tui.Key) (bool, error) {
+	policy := s.room().interrupt
+	if policy == InterruptQuit || (policy == InterruptDouble && s.cancelArmed) {
+		return true, s.handleControl(key.Label())
+	}
+	if err := s.handleControl(key.Label()); err != nil {
+		return false, err
+	}
+	if policy != InterruptDouble {
+		return false, nil
+	}
+	s.cancelArmed = true
+	return false, s.printSystem("press " + keyTitle(key) + " again to quit")
+}
+
+// keyTitle spells key the way hints do, e.g. "Ctrl+C".
+func keyTitle(key tui.Key) string {
+	if label := key.Label(); strings.HasPrefix(label, "^") {
+		return "Ctrl+" + label[1:]
+	}
+	return key.String()
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+func TestInterruptPolicies(t *testing.T) {
+	cases := []struct {
+		policy InterruptPolicy
+		// quits reports whether each press of ctrl+c ends the session.
+		quits []bool
+		hint  bool
+	}{
+		{policy: InterruptDouble, quits: []bool{false, true}, hint: true},
+		{policy: InterruptQuit, quits: []bool{true}},
+		{policy: InterruptClear, quits: []bool{false, false, false}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			room := NewRoom(WithInterrupt(tc.policy))
+			sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+			for _, r := range "draft" {
+				_, err := sess.processEvent(tui.KeyEvent(r))
+				require.NoError(t, err)
+			}
+
+			for i, want := range tc.quits {
+				done, err := sess.processEvent(tui.KeyEvent(rune(keyCtrlC)))
+				require.NoError(t, err)
+				require.Equal(t, want, done, "press %d", i+1)
+				require.Empty(t, sess.buffer.Snapshot(), "the input line is cleared")
+			}
+			require.Contains(t, out.String(), "^C")
+			if tc.hint {
+				require.Contains(t, out.String(), "[system] press Ctrl+C again to quit")
+			} else {
+				require.NotContains(t, out.String(), "again to quit")
+			}
+		})
+	}
+}
+
+func TestInterruptNeedsConsecutivePresses(t *testing.T) {
+	room := NewRoom()
+	sess, _ := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	for _, r := range []rune{rune(keyCtrlC), 'x', rune(keyCtrlC)} {
+		done, err := sess.processEvent(tui.KeyEvent(r))
+		require.NoError(t, err)
+		require.False(t, done, "typing in between disarms the second press")
+	}
+	done, err := sess.processEvent(tui.KeyEvent(rune(keyCtrlC)))
+	require.NoError(t, err)
+	require.True(t, done)
+}
+
+func TestParseInterruptPolicy(t *testing.T) {
+	for policy, name := range interruptPolicyNames {
+		got, err := ParseInterruptPolicy(" " + name + " ")
+		require.NoError(t, err)
+		require.Equal(t, policy, got)
+	}
+	_, err := ParseInterruptPolicy("twice")
+	require.EqualError(t, err, `chat: unknown interrupt policy "twice"`)
+}
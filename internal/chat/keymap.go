@@ -0,0 +1,381 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// keyAction is what a bound key does instead of typing.
+type keyAction string
+
+const (
+	keyCancel   keyAction = "cancel"
+	keyQuit     keyAction = "quit"
+	keyClear    keyAction = "clear"
+	keyPager    keyAction = "pager"
+	keyRoom     keyAction = "room"
+	keyComplete keyAction = "complete"
+)
+
+// keyActions lists the bindable actions in /keys order.
+var keyActions = []struct {
+	action  keyAction
+	summary string
+}{
+	{keyCancel, "clear the input line; press twice to quit"},
+	{keyQuit, "leave the chat"},
+	{keyClear, "clear the screen"},
+	{keyPager, "show the next page of /search or /help"},
+	{keyRoom, "switch to the next room in /rooms"},
+	{keyComplete, "complete a command or username"},
+}
+
+func parseKeyAction(name string) (keyAction, error) {
+	for _, a := range keyActions {
+		if string(a.action) == strings.ToLower(name) {
+			return a.action, nil
+		}
+	}
+	return "", fmt.Errorf("unknown key action %q", name)
+}
+
+// keymap binds keys to actions. It is replaced rather than changed, so the
+// server's defaults can be shared by every session.
+type keymap struct {
+	bindings map[keyAction][]tui.Key
+}
+
+func defaultKeymap() keymap {
+	return keymap{bindings: map[keyAction][]tui.Key{
+		keyCancel:   {0x03}, // ctrl+c
+		keyQuit:     {0x04}, // ctrl+d
+		keyClear:    {0x0c}, // ctrl+l
+		keyPager:    {0x0e}, // ctrl+n
+		keyRoom:     {0x0f}, // ctrl+o
+		keyComplete: {tui.KeyTab},
+	}}
+}
+
+// lookup returns the action bound to key.
+func (k keymap) lookup(key tui.Key) (keyAction, bool) {
+	for action, keys := range k.bindings {
+		for _, bound := range keys {
+			if bound == key {
+				return action, true
+			}
+		}
+	}
+	return "", false
+}
+
+// with returns a copy of k with action bound to keys only. A key bound to
+// another action is refused rather than silently moved.
+func (k keymap) with(action keyAction, keys []tui.Key) (keymap, error) {
+	if len(keys) == 0 {
+		return k, fmt.Errorf("%s needs at least one key", action)
+	}
+	for _, key := range keys {
+		if other, ok := k.lookup(key); ok && other != action {
+			return k, fmt.Errorf("%s is bound to %s", key, other)
+		}
+	}
+	next := keymap{bindings: make(map[keyAction][]tui.Key, len(k.bindings))}
+	for a, bound := range k.bindings {
+		next.bindings[a] = bound
+	}
+	next.bindings[action] = append([]tui.Key(nil), keys...)
+	return next, nil
+}
+
+// describe lists the keys bound to action, e.g. "ctrl+c ctrl+d".
+func (k keymap) describe(action keyAction) string {
+	return formatKeys(k.bindings[action])
+}
+
+func formatKeys(keys []tui.Key) string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.String()
+	}
+	return strings.Join(names, " ")
+}
+
+// parseKeys reads space-separated key names, dropping repeats.
+func parseKeys(spec string) ([]tui.Key, error) {
+	var keys []tui.Key
+	seen := make(map[tui.Key]bool)
+	for _, name := range strings.Fields(spec) {
+		key, err := tui.ParseKey(name)
+		if err != nil {
+			return nil, errors.New(strings.TrimPrefix(err.Error(), "tui: "))
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// KeyPolicy is the operator's say over key bindings: the defaults every
+// session starts with and the actions users may not remap.
+type KeyPolicy struct {
+	defaults keymap
+	locked   map[keyAction]bool
+}
+
+// ParseKeyPolicy reads the key settings from the server configuration.
+// bindings maps action names to space-separated keys, e.g.
+// {"room": "ctrl+x"}, replacing those defaults; locked names actions users
+// may not remap.
+func ParseKeyPolicy(bindings map[string]string, locked []string) (KeyPolicy, error) {
+	policy := KeyPolicy{defaults: defaultKeymap(), locked: make(map[keyAction]bool)}
+	// Apply in a fixed order so conflicts are reported the same way each time.
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		action, err := parseKeyAction(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		keys, err := parseKeys(bindings[name])
+		if err == nil {
+			policy.defaults, err = policy.defaults.with(action, keys)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	for _, name := range locked {
+		action, err := parseKeyAction(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		policy.locked[action] = true
+	}
+	if err := errors.Join(errs...); err != nil {
+		return KeyPolicy{}, fmt.Errorf("chat: keys: %w", err)
+	}
+	return policy, nil
+}
+
+// WithKeyPolicy sets the default key bindings and the ones users may not
+// change.
+func WithKeyPolicy(p KeyPolicy) RoomOption {
+	return func(r *Room) {
+		r.keys = p
+	}
+}
+
+// keymap returns the bindings sessions start with.
+func (p KeyPolicy) keymap() keymap {
+	if p.defaults.bindings == nil {
+		return defaultKeymap()
+	}
+	return p.defaults
+}
+
+// applyKeyPreferences layers a user's saved bindings over the server's,
+// skipping actions the operator has since locked or bindings that no longer
+// fit.
+func (s *session) applyKeyPreferences() {
+	policy := s.room().keys
+	s.keys = policy.keymap()
+	for _, a := range keyActions {
+		keys, ok := s.prefs.keys[a.action]
+		if !ok || policy.locked[a.action] {
+			continue
+		}
+		next, err := s.keys.with(a.action, keys)
+		if err != nil {
+			s.log.Warn("chat: ignoring saved key binding", "action", a.action, "err", err)
+			continue
+		}
+		s.keys = next
+	}
+}
+
+// runKeyAction performs the action bound to key. It returns true when the
+// read loop should end.
+func (s *session) runKeyAction(action keyAction, key tui.Key) (bool, error) {
+	switch action {
+	case keyCancel:
+		return s.cancelInput(key)
+	case keyQuit:
+		return s.quitInput(key)
+	case keyClear:
+		if err := s.ui.ClearScreen(); err != nil {
+			return false, err
+		}
+		return false, s.renderPrompt()
+	case keyPager:
+		if s.search != nil && s.search.room == s.room() {
+			return false, s.runCommand("/search next")
+		}
+		return false, s.runCommand("/help next")
+	case keyRoom:
+		return false, s.switchRoom()
+	case keyComplete:
+		return false, s.completeInput()
+	}
+	return false, nil
+}
+
+// switchRoom moves the session to the room after its own in /rooms order,
+// skipping archived rooms as /rooms does.
+func (s *session) switchRoom() error {
+	current := s.room()
+	manager := current.manager
+	if manager == nil {
+		return s.printSystem(errRoomsDisabled.Error())
+	}
+	var rooms []*Room
+	for _, room := range manager.Rooms() {
+		if _, archived := room.Archived(); (!archived && room.visibleTo(s.client)) || room == current {
+			rooms = append(rooms, room)
+		}
+	}
+	next := current
+	for i, room := range rooms {
+		if room == current {
+			next = rooms[(i+1)%len(rooms)]
+			break
+		}
+	}
+	if next == current {
+		return s.printSystem("there is no other room; /join <room> creates one")
+	}
+	if err := manager.Move(s.client, next); err != nil {
+		return s.printSystem(fmt.Sprintf("#%s: %v", next.Name(), err))
+	}
+	return s.showUnread()
+}
+
+// completeInput completes the word before the cursor: a command name at the
+// start of the line, otherwise the name of someone in the room. An ambiguous
+// word is extended as far as the candidates agree and then listed.
+func (s *session) completeInput() error {
+	line := s.buffer.Snapshot()
+	start := strings.LastIndexByte(line, ' ') + 1
+	word := line[start:]
+	if word == "" {
+		return nil
+	}
+
+	var candidates []string
+	if start == 0 && strings.HasPrefix(word, "/") {
+		for _, cmd := range s.commands.ordered {
+			if !cmd.operator || s.client.Operator {
+				candidates = append(candidates, "/"+cmd.name)
+			}
+		}
+	} else {
+		at := ""
+		if strings.HasPrefix(word, "@") {
+			at = "@"
+		}
+		for _, client := range s.room().Clients() {
+			candidates = append(candidates, at+client.Username)
+		}
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	completed := commonPrefix(matches)
+	if len(matches) == 1 {
+		completed += " "
+	}
+	if len(completed) > len(word) {
+		for _, r := range completed[len(word):] {
+			s.buffer.Append(r)
+		}
+		return s.renderPrompt()
+	}
+	sort.Strings(matches)
+	return s.printSystem("matches: " + strings.Join(matches, " "))
+}
+
+// commonPrefix returns the longest prefix shared by every string in list,
+// cut on a rune boundary.
+func commonPrefix(list []string) string {
+	prefix := list[0]
+	for _, s := range list[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// runKeys shows or remaps the session's key bindings.
+func runKeys(s *session, args string) error {
+	policy := s.room().keys
+	name, spec, _ := strings.Cut(args, " ")
+	spec = strings.TrimSpace(spec)
+
+	switch {
+	case name == "":
+		lines := []string{"key bindings:"}
+		for _, a := range keyActions {
+			line := fmt.Sprintf("  %-9s %-16s %s", a.action, s.keys.describe(a.action), a.summary)
+			if policy.locked[a.action] {
+				line += " (locked)"
+			}
+			lines = append(lines, line)
+		}
+		return s.printSystem(lines...)
+	case strings.EqualFold(name, "reset") && spec == "":
+		s.prefs.keys = nil
+		s.applyKeyPreferences()
+		return s.printSystem("key bindings reset" + s.savePreferences())
+	}
+
+	action, err := parseKeyAction(name)
+	if err != nil {
+		return s.printSystem("/keys: " + err.Error())
+	}
+	if spec == "" {
+		return s.printSystem(fmt.Sprintf("%s: %s", action, s.keys.describe(action)))
+	}
+	if policy.locked[action] {
+		return s.printSystem(fmt.Sprintf("/keys: the server does not let %s be remapped", action))
+	}
+	if strings.EqualFold(spec, "default") {
+		delete(s.prefs.keys, action)
+		s.applyKeyPreferences()
+		return s.printSystem(fmt.Sprintf("%s restored to %s", action, s.keys.describe(action)) + s.savePreferences())
+	}
+	keys, err := parseKeys(spec)
+	if err != nil {
+		return s.printSystem("/keys: " + err.Error())
+	}
+	next, err := s.keys.with(action, keys)
+	if err != nil {
+		return s.printSystem("/keys: " + err.Error())
+	}
+	s.keys = next
+	if s.prefs.keys == nil {
+		s.prefs.keys = make(map[keyAction][]tui.Key)
+	}
+	s.prefs.keys[action] = keys
+	return s.printSystem(fmt.Sprintf("%s bound to %s", action, formatKeys(keys)) + s.savePreferences())
+}
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+const (
+	keyCtrlC tui.Key = 0x03
+	keyCtrlL tui.Key = 0x0c
+	keyCtrlO tui.Key = 0x0f
+	keyCtrlX tui.Key = 0x18
+)
+
+func TestParseKeyPolicy(t *testing.T) {
+	policy, err := ParseKeyPolicy(map[string]string{"room": "ctrl+x ^x"}, []string{"quit"})
+	require.NoError(t, err)
+	require.Equal(t, []tui.Key{keyCtrlX}, policy.keymap().bindings[keyRoom])
+	require.True(t, policy.locked[keyQuit])
+	action, ok := policy.keymap().lookup(keyCtrlO)
+	require.False(t, ok, "ctrl+o is no longer bound, got %q", action)
+
+	_, err = ParseKeyPolicy(map[string]string{"room": "ctrl+l", "clear": "alt+l", "jump": "ctrl+j"}, []string{"exit"})
+	require.ErrorContains(t, err, `chat: keys: `)
+	require.ErrorContains(t, err, `room: ctrl+l is bound to clear`)
+	require.ErrorContains(t, err, `clear: unknown key "alt+l" (want ctrl+<letter> or tab)`)
+	require.ErrorContains(t, err, `unknown key action "jump"`)
+	require.ErrorContains(t, err, `unknown key action "exit"`)
+
+	var zero KeyPolicy
+	require.Equal(t, defaultKeymap(), zero.keymap())
+}
+
+func TestKeyActions(t *testing.T) {
+	m := newTestManager()
+	_, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	m.Lobby().AddClient("bob")
+	sess, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "alice"})
+
+	press := func(keys ...rune) bool {
+		t.Helper()
+		var done bool
+		for _, r := range keys {
+			done, err = sess.processEvent(tui.KeyEvent(r))
+			require.NoError(t, err)
+		}
+		return done
+	}
+
+	press([]rune("/he")...)
+	press('\t')
+	require.Equal(t, "/help ", sess.buffer.Snapshot(), "a unique command completes")
+	sess.buffer.Reset()
+
+	press([]rune("/t")...)
+	press('\t')
+	require.Equal(t, "/t", sess.buffer.Snapshot())
+	require.Contains(t, out.String(), "matches: /theme /token /topic /translate")
+	sess.buffer.Reset()
+
+	press([]rune("hi @b")...)
+	press('\t')
+	require.Equal(t, "hi @bob ", sess.buffer.Snapshot(), "usernames complete after the first word")
+	sess.buffer.Reset()
+
+	press(rune(keyCtrlO))
+	require.Equal(t, "dev", sess.room().Name())
+	press(rune(keyCtrlO))
+	require.Equal(t, "lobby", sess.room().Name(), "switching wraps around")
+
+	out.Reset()
+	press(rune(keyCtrlL))
+	require.Contains(t, out.String(), "\033[2J", "the screen is cleared")
+
+	require.True(t, press(0x04), "ctrl+d quits")
+	require.Contains(t, out.String(), "^D")
+}
+
+func TestKeysCommand(t *testing.T) {
+	st := store.NewMemory()
+	policy, err := ParseKeyPolicy(nil, []string{"quit"})
+	require.NoError(t, err)
+	room := NewRoom(WithStore(st), WithKeyPolicy(policy))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "password"})
+
+	require.NoError(t, sess.runCommand("/keys"))
+	require.Regexp(t, `quit +ctrl\+d +leave the chat \(locked\)`, out.String())
+	require.NoError(t, sess.runCommand("/keys quit ctrl+q"))
+	require.Contains(t, out.String(), "/keys: the server does not let quit be remapped")
+	require.NoError(t, sess.runCommand("/keys room ctrl+l"))
+	require.Contains(t, out.String(), "/keys: ctrl+l is bound to clear")
+	require.NoError(t, sess.runCommand("/keys room ctrl+h"))
+	require.Contains(t, out.String(), "/keys: ctrl+h is backspace and cannot be bound")
+
+	require.NoError(t, sess.runCommand("/keys room ctrl+x"))
+	require.Contains(t, out.String(), "room bound to ctrl+x")
+	action, ok := sess.keys.lookup(keyCtrlX)
+	require.True(t, ok)
+	require.Equal(t, keyRoom, action)
+	_, ok = sess.keys.lookup(keyCtrlO)
+	require.False(t, ok)
+
+	settings, err := st.UserSettings(context.Background(), "alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"key.room": "ctrl+x"}, settings)
+
+	next, _ := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "password"})
+	next.loadPreferences()
+	action, ok = next.keys.lookup(keyCtrlX)
+	require.True(t, ok, "saved bindings apply to the next session")
+	require.Equal(t, keyRoom, action)
+
+	require.NoError(t, sess.runCommand("/keys room default"))
+	require.Contains(t, out.String(), "room restored to ctrl+o")
+	require.NoError(t, sess.runCommand("/keys reset"))
+	require.Contains(t, out.String(), "key bindings reset")
+	settings, err = st.UserSettings(context.Background(), "alice")
+	require.NoError(t, err)
+	require.Empty(t, settings)
+}
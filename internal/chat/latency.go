@@ -0,0 +1,185 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// keepaliveRequest is the global request OpenSSH servers send to check on
+	// a client. Clients answer it, usually with a failure, which is all the
+	// round trip needs.
+	keepaliveRequest = "keepalive@openssh.com"
+	// latencyProbeInterval is how often a session's round-trip time is
+	// measured. A keepalive still unanswered at the next one counts as lost.
+	latencyProbeInterval = 10 * time.Second
+	// lossWindow is how many recent keepalives the loss rate is taken over.
+	lossWindow = 10
+	// lossyLost is how many of them may go unanswered before the user is
+	// warned that their connection is too lossy for interactive use.
+	lossyLost = 3
+	// slowRTT is the smoothed round-trip time the user is warned about.
+	slowRTT = time.Second
+)
+
+// pinger sends SSH global requests; *ssh.ServerConn is one.
+type pinger interface {
+	SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error)
+}
+
+// connQuality tracks the round-trip time and keepalive loss of one
+// connection.
+type connQuality struct {
+	mu sync.Mutex
+	// rtt is the smoothed round-trip time, zero before the first reply.
+	rtt time.Duration
+	// answered holds the outcome of the last lossWindow keepalives.
+	answered []bool
+	// warned is set while the user has been told their connection is poor.
+	warned bool
+}
+
+// reply records a keepalive answered after rtt; late replies, already
+// counted as lost, only update the round-trip time.
+func (q *connQuality) reply(rtt time.Duration, late bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.rtt == 0 {
+		q.rtt = rtt
+	} else {
+		q.rtt = (7*q.rtt + rtt) / 8
+	}
+	if !late {
+		q.record(true)
+	}
+}
+
+// lost records a keepalive that went unanswered.
+func (q *connQuality) lost() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.record(false)
+}
+
+func (q *connQuality) record(answered bool) {
+	q.answered = append(q.answered, answered)
+	if len(q.answered) > lossWindow {
+		q.answered = q.answered[len(q.answered)-lossWindow:]
+	}
+}
+
+// lostCount returns how many recent keepalives went unanswered, and of how
+// many. The caller holds mu.
+func (q *connQuality) lostCount() (int, int) {
+	lost := 0
+	for _, ok := range q.answered {
+		if !ok {
+			lost++
+		}
+	}
+	return lost, len(q.answered)
+}
+
+// indicator returns the status line's view of the connection, such as
+// "rtt 42ms" or "rtt 310ms, 30% loss", or "" before anything is known.
+func (q *connQuality) indicator() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	lost, total := q.lostCount()
+	if q.rtt == 0 && lost == 0 {
+		return ""
+	}
+	text := "rtt ?"
+	switch {
+	case q.rtt >= time.Millisecond:
+		text = "rtt " + q.rtt.Round(time.Millisecond).String()
+	case q.rtt > 0:
+		text = "rtt <1ms"
+	}
+	if lost > 0 {
+		text += fmt.Sprintf(", %d%% loss", lost*100/total)
+	}
+	return text
+}
+
+// warning returns what to tell the user when their connection became poor
+// or recovered since the last call, or "".
+func (q *connQuality) warning() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	lost, total := q.lostCount()
+	poor := lost >= lossyLost || q.rtt >= slowRTT
+	switch {
+	case poor && !q.warned:
+		q.warned = true
+		if lost >= lossyLost {
+			return fmt.Sprintf("your connection is unstable: %d of the last %d keepalives went unanswered; typing may lag and the session may drop", lost, total)
+		}
+		return fmt.Sprintf("your connection is slow: messages take about %s to reach you; typing may lag", q.rtt.Round(time.Millisecond))
+	case !poor && q.warned:
+		q.warned = false
+		return "your connection has recovered"
+	}
+	return ""
+}
+
+// startLatencyProbe measures the session's round-trip time until it ends.
+func (s *session) startLatencyProbe() {
+	if s.conn == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.stopProbe = cancel
+	ticker := time.NewTicker(latencyProbeInterval)
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		defer ticker.Stop()
+		s.watchLatency(ctx, ticker.C)
+	}()
+}
+
+// watchLatency sends a keepalive now and on every tick, redrawing the status
+// line as the measurements change and warning the user about a poor
+// connection. Only one keepalive is outstanding at a time; each tick it stays
+// unanswered counts as a lost one.
+func (s *session) watchLatency(ctx context.Context, tick <-chan time.Time) {
+	replies := make(chan error, 1)
+	var sent time.Time
+	var late bool
+	send := func() {
+		sent, late = time.Now(), false
+		go func() {
+			_, _, err := s.conn.SendRequest(keepaliveRequest, true, nil)
+			replies <- err
+		}()
+	}
+	send()
+	for {
+		before := s.quality.indicator()
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-replies:
+			if err != nil {
+				return
+			}
+			s.quality.reply(time.Since(sent), late)
+			sent = time.Time{}
+		case <-tick:
+			if sent.IsZero() {
+				send()
+				continue
+			}
+			s.quality.lost()
+			late = true
+		}
+		if warning := s.quality.warning(); warning != "" {
+			_ = s.printSystem(warning)
+		} else if s.quality.indicator() != before {
+			_ = s.renderPrompt()
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnQuality(t *testing.T) {
+	var q connQuality
+	require.Empty(t, q.indicator())
+	require.Empty(t, q.warning())
+
+	q.reply(300*time.Microsecond, false)
+	require.Equal(t, "rtt <1ms", q.indicator())
+	q = connQuality{}
+	q.reply(40*time.Millisecond, false)
+	require.Equal(t, "rtt 40ms", q.indicator())
+	q.reply(120*time.Millisecond, false)
+	require.Equal(t, "rtt 50ms", q.indicator(), "the round-trip time is smoothed")
+	require.Empty(t, q.warning())
+
+	for i := 0; i < lossyLost; i++ {
+		q.lost()
+	}
+	require.Equal(t, "rtt 50ms, 60% loss", q.indicator())
+	require.Equal(t, "your connection is unstable: 3 of the last 5 keepalives went unanswered; typing may lag and the session may drop", q.warning())
+	require.Empty(t, q.warning(), "users are warned once")
+
+	q.reply(2*time.Second, true)
+	require.Equal(t, "rtt 294ms, 60% loss", q.indicator(), "late replies are not counted as answered")
+	for i := 0; i < lossWindow; i++ {
+		q.reply(40*time.Millisecond, false)
+	}
+	require.NotContains(t, q.indicator(), "loss")
+	require.Equal(t, "your connection has recovered", q.warning())
+}
+
+func TestConnQualitySlow(t *testing.T) {
+	var q connQuality
+	q.reply(1500*time.Millisecond, false)
+	require.Equal(t, "your connection is slow: messages take about 1.5s to reach you; typing may lag", q.warning())
+}
+
+// heldPinger answers each keepalive when the test says so.
+type heldPinger struct {
+	sent    chan struct{}
+	release chan struct{}
+}
+
+func (p *heldPinger) SendRequest(name string, wantReply bool, _ []byte) (bool, []byte, error) {
+	if name != keepaliveRequest || !wantReply {
+		return false, nil, nil
+	}
+	p.sent <- struct{}{}
+	<-p.release
+	return false, nil, nil
+}
+
+func TestWatchLatency(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	p := &heldPinger{sent: make(chan struct{}, 1), release: make(chan struct{})}
+	sess.conn = p
+	tick := make(chan time.Time)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sess.watchLatency(ctx, tick)
+		close(done)
+	}()
+
+	<-p.sent
+	p.release <- struct{}{}
+	require.Eventually(t, func() bool { return strings.HasPrefix(sess.quality.indicator(), "rtt ") }, time.Second, time.Millisecond)
+
+	tick <- time.Now()
+	<-p.sent
+	for i := 0; i < lossyLost; i++ {
+		tick <- time.Now()
+	}
+	p.release <- struct{}{}
+	cancel()
+	<-done
+
+	require.Contains(t, sess.quality.indicator(), "75% loss")
+	require.Contains(t, out.String(), "3 of the last 4 keepalives went unanswered")
+	require.Contains(t, sess.header(), "| rtt ")
+}
@@ -1,11 +1,22 @@
 package chat
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// bytesPerRune is the in-memory size of one buffered rune.
+const bytesPerRune = 4
 
 // lineBuffer stores the user's current input line with concurrency protection.
 type lineBuffer struct {
 	mu   sync.RWMutex
 	data []rune
+
+	// gauge, when set, mirrors the buffer's allocated size for memory reporting.
+	gauge *atomic.Int64
 }
 
 func newLineBuffer(capacity int) *lineBuffer {
@@ -20,14 +31,29 @@ func newLineBuffer(capacity int) *lineBuffer {
 func (b *lineBuffer) Append(r rune) {
 	b.mu.Lock()
 	b.data = append(b.data, r)
+	b.updateGaugeLocked()
 	b.mu.Unlock()
 }
 
-func (b *lineBuffer) TrimLast() {
+// trackSize reports the buffer's allocated bytes into gauge from now on.
+func (b *lineBuffer) trackSize(gauge *atomic.Int64) {
 	b.mu.Lock()
-	if n := len(b.data); n > 0 {
-		b.data = b.data[:n-1]
+	b.gauge = gauge
+	b.updateGaugeLocked()
+	b.mu.Unlock()
+}
+
+func (b *lineBuffer) updateGaugeLocked() {
+	if b.gauge != nil {
+		b.gauge.Store(int64(cap(b.data) * bytesPerRune))
 	}
+}
+
+// TrimLast removes the last user-perceived character: the base rune together with
+// any combining marks, variation selectors, or ZWJ-joined emoji that follow it.
+func (b *lineBuffer) TrimLast() {
+	b.mu.Lock()
+	b.data = b.data[:lastClusterStart(b.data)]
 	b.mu.Unlock()
 }
 
@@ -50,3 +76,46 @@ func (b *lineBuffer) Snapshot() string {
 	defer b.mu.RUnlock()
 	return string(b.data)
 }
+
+// Len returns the number of buffered runes.
+func (b *lineBuffer) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.data)
+}
+
+// Empty reports whether nothing is buffered.
+func (b *lineBuffer) Empty() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.data) == 0
+}
+
+// Width returns the number of terminal columns the buffered text occupies.
+func (b *lineBuffer) Width() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	width := 0
+	for _, r := range b.data {
+		width += tui.RuneWidth(r)
+	}
+	return width
+}
+
+// lastClusterStart returns the index where the trailing character cluster begins.
+func lastClusterStart(data []rune) int {
+	i := len(data)
+	for i > 0 {
+		i--
+		if tui.IsZeroWidth(data[i]) {
+			continue
+		}
+		if i > 0 && data[i-1] == tui.ZeroWidthJoiner {
+			i--
+			continue
+		}
+		return i
+	}
+	return 0
+}
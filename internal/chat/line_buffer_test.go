@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/tui"
 )
 
 func TestLineBufferBasicOperations(t *testing.T) {
@@ -26,3 +28,29 @@ func TestLineBufferBasicOperations(t *testing.T) {
 	buf.Reset()
 	require.Equal(t, "", buf.Snapshot())
 }
+
+func TestLineBufferTrimLastRemovesWholeCluster(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "wide rune", input: "a한", want: "a"},
+		{name: "combining mark", input: "xé", want: "x"},
+		{name: "variation selector", input: "a❤️", want: "a"},
+		{name: "zwj sequence", input: "a👨‍👩‍👧", want: "a"},
+		{name: "skin tone", input: "b👍🏽", want: "b"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := newLineBuffer(8)
+			for _, r := range tc.input {
+				buf.Append(r)
+			}
+			buf.TrimLast()
+			require.Equal(t, tc.want, buf.Snapshot())
+			require.Equal(t, tui.StringWidth(tc.want), buf.Width())
+		})
+	}
+}
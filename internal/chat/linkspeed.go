@@ -0,0 +1,138 @@
+package chat
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// stalledWrite is how long a write to the channel may block before it
+	// counts as stalled. SSH channel writes block while the client's window
+	// is exhausted, which is what a link too slow for the output looks like.
+	stalledWrite = 250 * time.Millisecond
+	// linkWindow is how many recent writes the link's speed is judged by.
+	linkWindow = 16
+	// slowStalls is how many of them must stall before the session switches
+	// to compact display; it switches back once none of them do.
+	slowStalls = 4
+	// compactBatch bounds how many lines a slow session writes in one frame.
+	compactBatch = 16
+)
+
+// linkMonitor times the writes to a session's channel to tell when the
+// client cannot keep up with its output.
+type linkMonitor struct {
+	out io.Writer
+
+	mu sync.Mutex
+	// stalled holds whether each of the last linkWindow writes stalled.
+	stalled []bool
+	slow    bool
+}
+
+func newLinkMonitor(out io.Writer) *linkMonitor {
+	return &linkMonitor{out: out}
+}
+
+func (m *linkMonitor) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := m.out.Write(p)
+	m.observe(time.Since(start))
+	return n, err
+}
+
+// observe records a write that took d.
+func (m *linkMonitor) observe(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stalled = append(m.stalled, d >= stalledWrite)
+	if len(m.stalled) > linkWindow {
+		m.stalled = m.stalled[len(m.stalled)-linkWindow:]
+	}
+	stalls := 0
+	for _, s := range m.stalled {
+		if s {
+			stalls++
+		}
+	}
+	switch {
+	case stalls >= slowStalls:
+		m.slow = true
+	case stalls == 0 && len(m.stalled) == linkWindow:
+		m.slow = false
+	}
+}
+
+// Slow reports whether the link is currently too slow for full rendering.
+func (m *linkMonitor) Slow() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.slow
+}
+
+// relayMessage writes one message from the room to the session, unless it
+// comes from a user the session ignores. On a slow
+// link lines are drawn compact and gathered into one frame until the queue
+// runs dry, and typing indicators are not redrawn at all.
+func (s *session) relayMessage(msg Message) error {
+	if s.prefs.filters.hides(msg) {
+		return nil
+	}
+	if err := s.adaptToLink(); err != nil {
+		return err
+	}
+	s.countDirect(msg)
+	compact := s.renderer.compact.Load()
+	if msg.Kind == KindTyping {
+		if compact {
+			return nil
+		}
+		return s.renderPrompt()
+	}
+	if compact {
+		s.pending = append(s.pending, s.renderer.Render(msg))
+		if len(s.client.send) == 0 || len(s.pending) >= compactBatch {
+			if err := s.flushPending(); err != nil {
+				return err
+			}
+		}
+	} else if err := s.printMessage(s.renderer.Render(msg)); err != nil {
+		return err
+	}
+	s.queueTranslation(msg)
+	return nil
+}
+
+// flushPending writes the lines gathered on a slow link in one frame.
+func (s *session) flushPending() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	lines := strings.Join(s.pending, "\r\n")
+	s.pending = s.pending[:0]
+	return s.printMessage(lines)
+}
+
+// adaptToLink switches the session between compact and full display as its
+// link slows down and recovers, telling the user either way.
+func (s *session) adaptToLink() error {
+	slow := s.link.Slow()
+	if slow == s.renderer.compact.Load() {
+		return nil
+	}
+	if err := s.flushPending(); err != nil {
+		return err
+	}
+	s.renderer.compact.Store(slow)
+	if slow {
+		s.log.Info("chat: slow link, switching to compact display")
+		return s.printSystem("your connection cannot keep up: switching to compact display until it recovers")
+	}
+	s.log.Info("chat: link recovered, restoring full display")
+	return s.printSystem("your connection has caught up: full display restored")
+}
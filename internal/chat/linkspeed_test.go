@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkMonitor(t *testing.T) {
+	m := newLinkMonitor(nil)
+	for i := 0; i < slowStalls-1; i++ {
+		m.observe(stalledWrite)
+	}
+	require.False(t, m.Slow())
+	m.observe(time.Second)
+	require.True(t, m.Slow())
+
+	for i := 0; i < linkWindow-1; i++ {
+		m.observe(time.Millisecond)
+	}
+	require.True(t, m.Slow(), "one stalled write is still in the window")
+	m.observe(time.Millisecond)
+	require.False(t, m.Slow())
+}
+
+func TestCompactRendering(t *testing.T) {
+	r := newMessageRenderer()
+	r.setViewer("alice", "\033[32m")
+	msg := Message{Kind: KindChat, SenderName: "bob", SenderColor: "\033[31m", Body: "hi @alice", Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	require.Contains(t, r.Render(msg), "03:04:05] ")
+
+	r.compact.Store(true)
+	require.Equal(t, "bob: hi "+seqInverse+"@alice"+colorReset+seqBell, r.Render(msg))
+	require.Equal(t, "[system] note", r.Render(Message{Kind: KindSystem, Body: "note"}))
+}
+
+func TestSlowLinkBatchesDelivery(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	bob := room.AddClient("bob")
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	sess.link = newLinkMonitor(nil)
+	for i := 0; i < slowStalls; i++ {
+		sess.link.observe(stalledWrite)
+	}
+	drainChannel(sess.client.Send())
+
+	for _, body := range []string{"one", "two", "three"} {
+		_, err := room.Broadcast(bob.ID, "bob", body)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sess.relayMessage(<-sess.client.Send()))
+	}
+	require.Contains(t, out.String(), "switching to compact display")
+	require.Contains(t, out.String(), "bob: one\r\nbob: two\r\nbob: three\r\n", "queued lines are written in one frame")
+	require.NotContains(t, out.String(), "bob: one\r\n\033", "the prompt is not redrawn between them")
+
+	out.Reset()
+	for i := 0; i < linkWindow; i++ {
+		sess.link.observe(time.Millisecond)
+	}
+	_, err := room.Broadcast(bob.ID, "bob", "four")
+	require.NoError(t, err)
+	require.NoError(t, sess.relayMessage(<-sess.client.Send()))
+	require.Contains(t, out.String(), "full display restored")
+	require.Contains(t, out.String(), "] bob: four", "timestamps are back")
+}
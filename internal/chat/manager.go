@@ -0,0 +1,333 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/audit"
+)
+
+// maxRoomNameLength bounds room names so they fit in status and list output.
+const maxRoomNameLength = 32
+
+var (
+	errRoomExists     = errors.New("room already exists")
+	errNoSuchRoom     = errors.New("no such room")
+	errNotRoomManager = errors.New("only the room owner or an operator can do that")
+	errLobbyProtected = errors.New("the lobby cannot be transferred or deleted")
+	errRoomsDisabled  = errors.New("this server has a single room")
+)
+
+// RoomManager owns the set of rooms on a server. The lobby always exists;
+// other rooms are created on demand and owned by their creator.
+type RoomManager struct {
+	mu    sync.RWMutex
+	rooms map[string]*Room
+	lobby *Room
+
+	roomOpts []RoomOption
+	relay    *relayPool
+	notifier *notifier
+	watchers *watchers
+	sequence atomic.Uint64
+	archive  ArchivePolicy
+	// announcer posts scheduled announcements from Run.
+	announcer announcer
+	// prober is set by WithProbes and runs from Run.
+	prober *prober
+	// prompts is set by WithPrompts; Run expires them.
+	prompts *prompts
+	// inactiveAfter is how long a room may sit idle before Run archives it.
+	inactiveAfter time.Duration
+	// settings holds the latest Reload, applied over roomOpts for new rooms.
+	settings *Settings
+	// serverLog is set by WithServerLog; Run streams it into #server-log.
+	serverLog *ServerLog
+	// roomBackpressure is set by WithRoomBackpressure, keyed by room name.
+	roomBackpressure map[string]BackpressurePolicy
+}
+
+// ManagerOption customises RoomManager construction.
+type ManagerOption func(*RoomManager)
+
+// WithRoomOptions applies opts to every room the manager creates, the lobby
+// included.
+func WithRoomOptions(opts ...RoomOption) ManagerOption {
+	return func(m *RoomManager) {
+		m.roomOpts = append(m.roomOpts, opts...)
+	}
+}
+
+// NewRoomManager constructs a manager holding only the lobby.
+func NewRoomManager(opts ...ManagerOption) *RoomManager {
+	m := &RoomManager{rooms: make(map[string]*Room), notifier: newNotifier(), watchers: newWatchers()}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(m)
+		}
+	}
+
+	m.lobby = m.newRoom(nil)
+	m.relay = m.lobby.relay
+	m.rooms[m.lobby.Name()] = m.lobby
+	m.addServerLogRoom()
+	return m
+}
+
+// newRoom builds a room sharing the manager's relay workers, notifier,
+// watchers, and ID sequence.
+func (m *RoomManager) newRoom(extra []RoomOption) *Room {
+	opts := append(append([]RoomOption{}, m.roomOpts...), extra...)
+	opts = append(opts, func(r *Room) {
+		r.manager = m
+		r.sequence = &m.sequence
+		r.relay = m.relay
+		r.notifier = m.notifier
+		r.watchers = m.watchers
+		if policy, ok := m.roomBackpressure[normalizeRoomName(r.name)]; ok {
+			r.backpressure = policy
+		}
+	})
+	room := NewRoom(opts...)
+	if m.settings != nil {
+		room.reload(*m.settings)
+	}
+	return room
+}
+
+// Lobby returns the default room every session joins first.
+func (m *RoomManager) Lobby() *Room {
+	return m.lobby
+}
+
+// Room looks up a room by name.
+func (m *RoomManager) Room(name string) (*Room, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	room, ok := m.rooms[normalizeRoomName(name)]
+	return room, ok
+}
+
+// Rooms returns every room ordered by name, lobby first.
+func (m *RoomManager) Rooms() []*Room {
+	m.mu.RLock()
+	rooms := make([]*Room, 0, len(m.rooms))
+	for _, room := range m.rooms {
+		rooms = append(rooms, room)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(rooms, func(i, j int) bool {
+		if (rooms[i] == m.lobby) != (rooms[j] == m.lobby) {
+			return rooms[i] == m.lobby
+		}
+		return rooms[i].Name() < rooms[j].Name()
+	})
+	return rooms
+}
+
+// Create adds a room owned by owner.
+func (m *RoomManager) Create(name, owner string) (*Room, error) {
+	name = normalizeRoomName(name)
+	if err := validateRoomName(name); err != nil {
+		return nil, err
+	}
+	if err := m.checkLocal(name); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.rooms[name]; exists {
+		return nil, errRoomExists
+	}
+	room := m.newRoom([]RoomOption{WithName(name), func(r *Room) { r.owner = owner }})
+	m.rooms[name] = room
+	room.logger.Info("chat: room created", "room", name, "owner", owner)
+	return room, nil
+}
+
+// Move takes client out of its current room and into to, announcing the
+// change in both. It does nothing once the client's session has ended.
+func (m *RoomManager) Move(client *Client, to *Room) error {
+	client.membership.Lock()
+	defer client.membership.Unlock()
+
+	from := client.room.Load()
+	if client.left || from == to {
+		return nil
+	}
+	if !to.visibleTo(client) {
+		return errOperatorsOnly
+	}
+	if !to.admit(client) {
+		return errNoSuchRoom
+	}
+	if from != nil {
+		if _, ok := from.release(client.ID); ok {
+			from.announce(noticeLeave, fmt.Sprintf("%s left for #%s", client.Username, to.Name()), map[string]string{"user": client.Username})
+			from.pluginsLeft(client)
+		}
+		to.logger.Debug("chat: room changed", "username", client.Username, "from", from.Name(), "room", to.Name())
+	}
+	return nil
+}
+
+// Transfer hands ownership of room to the member named newOwner.
+func (m *RoomManager) Transfer(room *Room, actor *Client, newOwner string) error {
+	if room == m.lobby {
+		return errLobbyProtected
+	}
+	if room.serverLog {
+		return errServerLogBuiltin
+	}
+	if !room.canManage(actor) {
+		return errNotRoomManager
+	}
+	target, ok := room.FindClient(newOwner)
+	if !ok {
+		return errNoSuchUser
+	}
+
+	room.mu.Lock()
+	room.owner = target.Username
+	room.mu.Unlock()
+
+	room.broadcastSystem(fmt.Sprintf("%s transferred ownership of #%s to %s", actor.Username, room.Name(), target.Username))
+	room.audit(audit.Entry{Actor: actor.Username, Action: audit.Transfer, Target: target.Username})
+	return nil
+}
+
+// Delete archives the room's history according to the archive policy, removes
+// the room, and moves its members to the lobby.
+func (m *RoomManager) Delete(room *Room, actor *Client) error {
+	if room == m.lobby {
+		return errLobbyProtected
+	}
+	if room.serverLog {
+		return errServerLogBuiltin
+	}
+	if !room.canManage(actor) {
+		return errNotRoomManager
+	}
+
+	m.mu.Lock()
+	if m.rooms[room.Name()] != room {
+		m.mu.Unlock()
+		return errNoSuchRoom
+	}
+	delete(m.rooms, room.Name())
+	m.mu.Unlock()
+
+	if err := m.archive.store(room.Name(), room.history.Recent(0), room.now()); err != nil {
+		m.mu.Lock()
+		m.rooms[room.Name()] = room
+		m.mu.Unlock()
+		return err
+	}
+
+	room.audit(audit.Entry{Actor: actor.Username, Action: audit.Delete})
+	room.broadcastSystem(fmt.Sprintf("#%s was deleted by %s; moving everyone to #%s", room.Name(), actor.Username, m.lobby.Name()))
+	room.mu.Lock()
+	room.deleted = true
+	room.mu.Unlock()
+	room.clearSettings()
+	for _, client := range room.Clients() {
+		_ = m.Move(client, m.lobby)
+	}
+	return nil
+}
+
+// Run performs background maintenance for every room until ctx is cancelled.
+func (m *RoomManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(presenceCheckInterval)
+	defer ticker.Stop()
+	announce := time.NewTicker(announceCheckInterval)
+	defer announce.Stop()
+	if m.prober != nil {
+		go m.probeLoop(ctx)
+	}
+	if m.serverLog != nil {
+		go m.streamServerLog(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, room := range m.Rooms() {
+				room.markIdleAway()
+			}
+			m.archiveInactive(m.lobby.now())
+		case <-announce.C:
+			now := m.lobby.now()
+			m.postAnnouncements(now)
+			m.expirePrompts(now)
+		}
+	}
+}
+
+// MemoryStats sums MemoryStats across all rooms.
+func (m *RoomManager) MemoryStats() MemoryStats {
+	var total MemoryStats
+	for _, room := range m.Rooms() {
+		stats := room.MemoryStats()
+		total.Clients += stats.Clients
+		total.QueuedBytes += stats.QueuedBytes
+		total.QueuedMessages += stats.QueuedMessages
+		total.HistoryBytes += stats.HistoryBytes
+		total.HistoryMessages += stats.HistoryMessages
+		total.InputBytes += stats.InputBytes
+		total.Sessions = append(total.Sessions, stats.Sessions...)
+	}
+	sortSessionStats(total.Sessions)
+	return total
+}
+
+// Owner returns the username owning the room, or "" for the lobby and
+// standalone rooms.
+func (r *Room) Owner() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.owner
+}
+
+// visibleTo reports whether client may see and join the room.
+func (r *Room) visibleTo(client *Client) bool {
+	return !r.serverLog || client.Operator
+}
+
+// canManage reports whether client may transfer or delete the room. Owner
+// rights need a sign-in that proved the owner's name, since anyone may join
+// under a name nobody registered.
+func (r *Room) canManage(client *Client) bool {
+	if client.Operator {
+		return true
+	}
+	owner := r.Owner()
+	return owner != "" && owner == client.Username && client.nameProved
+}
+
+func normalizeRoomName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+}
+
+func validateRoomName(name string) error {
+	if name == "" || len(name) > maxRoomNameLength {
+		return fmt.Errorf("room names must be 1-%d characters", maxRoomNameLength)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return errors.New("room names may only use letters, digits, '-' and '_'")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager(opts ...ManagerOption) *RoomManager {
+	return NewRoomManager(append([]ManagerOption{WithRoomOptions(WithColorPicker(&staticColorPicker{}))}, opts...)...)
+}
+
+func TestManagerCreateAndMove(t *testing.T) {
+	m := newTestManager()
+	alice := m.Lobby().AddClient("alice")
+	bob := m.Lobby().AddClient("bob")
+	drainChannel(alice.Send())
+	drainChannel(bob.Send())
+
+	dev, err := m.Create("#Dev", "alice")
+	require.NoError(t, err)
+	require.Equal(t, "dev", dev.Name())
+	require.Equal(t, "alice", dev.Owner())
+
+	_, err = m.Create("dev", "bob")
+	require.ErrorIs(t, err, errRoomExists)
+	_, err = m.Create("no spaces", "bob")
+	require.Error(t, err)
+
+	require.NoError(t, m.Move(alice, dev))
+	require.Same(t, dev, alice.Room())
+	require.Equal(t, 1, m.Lobby().ClientCount())
+	require.Equal(t, "alice left for #dev", (<-bob.Send()).Body)
+	require.Equal(t, "alice joined the chat", (<-alice.Send()).Body)
+
+	carol := dev.AddClient("carol")
+	require.NotEqual(t, alice.ID, carol.ID, "client IDs stay unique across rooms")
+
+	rooms := m.Rooms()
+	require.Len(t, rooms, 2)
+	require.Same(t, m.Lobby(), rooms[0])
+}
+
+func TestManagerMoveAfterLeaveIsIgnored(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "")
+	require.NoError(t, err)
+
+	alice := m.Lobby().AddClient("alice")
+	alice.leave().RemoveClient(alice.ID)
+
+	require.NoError(t, m.Move(alice, dev))
+	require.Zero(t, dev.ClientCount())
+}
+
+func TestManagerTransferRequiresOwnerOrOperator(t *testing.T) {
+	m := newTestManager(WithRoomOptions(WithOperators("root")))
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+
+	alice := dev.AddClient("alice")
+	bob := dev.AddClient("bob")
+	root := dev.AddClient("root")
+	drainChannel(bob.Send())
+
+	require.ErrorIs(t, m.Transfer(dev, bob, "bob"), errNotRoomManager)
+	require.ErrorIs(t, m.Transfer(dev, alice, "nobody"), errNoSuchUser)
+
+	require.NoError(t, m.Transfer(dev, alice, "bob"))
+	require.Equal(t, "bob", dev.Owner())
+	require.Equal(t, "alice transferred ownership of #dev to bob", (<-bob.Send()).Body)
+
+	require.ErrorIs(t, m.Transfer(dev, alice, "alice"), errNotRoomManager, "the previous owner lost their rights")
+	require.NoError(t, m.Transfer(dev, root, "alice"), "operators can always transfer")
+
+	require.ErrorIs(t, m.Transfer(m.Lobby(), root, "alice"), errLobbyProtected)
+}
+
+func TestManagerOwnerRightsNeedAProvedName(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+
+	// Without a sign-in that proves it, anyone can join under the name alice.
+	impostor := dev.Join(ClientInfo{Username: "alice", AuthMethod: "none"})
+	require.Equal(t, "alice", impostor.Username)
+
+	require.ErrorIs(t, m.Transfer(dev, impostor, "alice"), errNotRoomManager)
+	require.ErrorIs(t, dev.SetTopic(impostor, "mine now"), errNotRoomManager)
+	require.ErrorIs(t, m.Delete(dev, impostor), errNotRoomManager)
+	_, ok := m.Room("dev")
+	require.True(t, ok)
+	require.Equal(t, "alice", dev.Owner())
+}
+
+func TestManagerDeleteMovesMembersToLobby(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+
+	alice := dev.AddClient("alice")
+	bob := dev.AddClient("bob")
+	dev.Broadcast(alice.ID, "alice", "bye all")
+	drainChannel(bob.Send())
+
+	require.ErrorIs(t, m.Delete(dev, bob), errNotRoomManager)
+	require.NoError(t, m.Delete(dev, alice))
+
+	_, ok := m.Room("dev")
+	require.False(t, ok)
+	require.Same(t, m.Lobby(), alice.Room())
+	require.Same(t, m.Lobby(), bob.Room())
+	require.Equal(t, 2, m.Lobby().ClientCount())
+	require.Equal(t, "#dev was deleted by alice; moving everyone to #lobby", (<-bob.Send()).Body)
+
+	require.ErrorIs(t, m.Move(bob, dev), errNoSuchRoom, "deleted rooms accept no new members")
+	require.ErrorIs(t, m.Delete(m.Lobby(), alice), errLobbyProtected)
+}
+
+func TestManagerMemoryStatsSumsRooms(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "")
+	require.NoError(t, err)
+
+	m.Lobby().AddClient("alice")
+	dev.AddClient("bob")
+
+	stats := m.MemoryStats()
+	require.Equal(t, 2, stats.Clients)
+	require.Len(t, stats.Sessions, 2)
+}
@@ -0,0 +1,57 @@
+package chat
+
+import "sort"
+
+// MemoryStats summarises the memory a room holds on behalf of its clients.
+type MemoryStats struct {
+	Clients         int                  `json:"clients"`
+	QueuedBytes     int64                `json:"queued_bytes"`
+	QueuedMessages  int                  `json:"queued_messages"`
+	HistoryBytes    int64                `json:"history_bytes"`
+	HistoryMessages int                  `json:"history_messages"`
+	InputBytes      int64                `json:"input_bytes"`
+	Sessions        []SessionMemoryStats `json:"sessions"`
+}
+
+// SessionMemoryStats reports per-session queue and input buffer usage.
+type SessionMemoryStats struct {
+	ClientID       string `json:"client_id"`
+	Username       string `json:"username"`
+	QueuedBytes    int64  `json:"queued_bytes"`
+	QueuedMessages int    `json:"queued_messages"`
+	InputBytes     int64  `json:"input_bytes"`
+}
+
+// MemoryStats returns a snapshot of queued, history, and input buffer usage.
+// Sessions are ordered by total footprint, largest first.
+func (r *Room) MemoryStats() MemoryStats {
+	var stats MemoryStats
+	stats.HistoryMessages, stats.HistoryBytes = r.history.Stats()
+
+	r.mu.RLock()
+	for _, client := range r.clients {
+		session := SessionMemoryStats{
+			ClientID:       client.ID,
+			Username:       client.Username,
+			QueuedBytes:    client.queuedBytes.Load(),
+			QueuedMessages: len(client.send),
+			InputBytes:     client.inputBytes.Load(),
+		}
+		stats.Sessions = append(stats.Sessions, session)
+		stats.QueuedBytes += session.QueuedBytes
+		stats.QueuedMessages += session.QueuedMessages
+		stats.InputBytes += session.InputBytes
+	}
+	r.mu.RUnlock()
+
+	stats.Clients = len(stats.Sessions)
+	sortSessionStats(stats.Sessions)
+	return stats
+}
+
+func sortSessionStats(sessions []SessionMemoryStats) {
+	sort.Slice(sessions, func(i, j int) bool {
+		a, b := sessions[i], sessions[j]
+		return a.QueuedBytes+a.InputBytes > b.QueuedBytes+b.InputBytes
+	})
+}
@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	seqInverse = "\033[7m"
+	seqBell    = "\a"
+)
+
+// mention is an @name token located at body[start:end].
+type mention struct {
+	start, end int
+	name       string
+}
+
+// findMentions returns every @name token in body. A mention must start the text
+// or follow whitespace/punctuation so e-mail addresses are not matched.
+func findMentions(body string) []mention {
+	var found []mention
+	for i := 0; i < len(body); i++ {
+		if body[i] != '@' {
+			continue
+		}
+		if i > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(body[:i])
+			if isMentionRune(prev) {
+				continue
+			}
+		}
+
+		end := i + 1
+		for end < len(body) {
+			r, size := utf8.DecodeRuneInString(body[end:])
+			if !isMentionRune(r) {
+				break
+			}
+			end += size
+		}
+		// Trailing dots are sentence punctuation, not part of the name.
+		for end > i+1 && body[end-1] == '.' {
+			end--
+		}
+		if end > i+1 {
+			found = append(found, mention{start: i, end: end, name: body[i+1 : end]})
+		}
+		i = end - 1
+	}
+	return found
+}
+
+func isMentionRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
+
+// highlightMentions wraps every @mention of name in style, returning the new
+// body and whether any mention was found.
+func highlightMentions(body, name, style string) (string, bool) {
+	var b strings.Builder
+	last, hit := 0, false
+	for _, m := range findMentions(body) {
+		if !strings.EqualFold(m.name, name) {
+			continue
+		}
+		b.WriteString(body[last:m.start])
+		b.WriteString(style)
+		b.WriteString(body[m.start:m.end])
+		b.WriteString(colorReset)
+		last, hit = m.end, true
+	}
+	if !hit {
+		return body, false
+	}
+	b.WriteString(body[last:])
+	return b.String(), true
+}
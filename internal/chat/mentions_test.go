@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindMentions(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "single", body: "hi @alice", want: []string{"alice"}},
+		{name: "multiple", body: "@bob and @carol-2, look", want: []string{"bob", "carol-2"}},
+		{name: "trailing period", body: "thanks @dave.", want: []string{"dave"}},
+		{name: "email ignored", body: "mail me at x@example.com", want: nil},
+		{name: "bare at", body: "meet @ noon", want: nil},
+		{name: "unicode name", body: "@민수 안녕", want: []string{"민수"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, m := range findMentions(tc.body) {
+				got = append(got, m.name)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRendererHighlightsViewerMentions(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	renderer := newMessageRenderer()
+	renderer.setViewer("alice", "\033[32m")
+
+	line := renderer.Render(Message{Timestamp: ts, SenderName: "bob", Body: "ping @Alice!", Kind: KindChat})
+	require.Equal(t, "[2024-05-01 09:30:00] bob: ping \033[32m\033[7m@Alice\033[0m!\a", line)
+
+	line = renderer.Render(Message{Timestamp: ts, SenderName: "bob", Body: "ping @carol", Kind: KindChat})
+	require.Equal(t, "[2024-05-01 09:30:00] bob: ping @carol", line)
+
+	line = renderer.Render(Message{Timestamp: ts, SenderName: "alice", Body: "I am @alice", Kind: KindChat})
+	require.NotContains(t, line, seqBell, "own messages do not ring")
+}
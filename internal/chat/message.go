@@ -0,0 +1,132 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// MessageKind distinguishes the different message types flowing through a room.
+type MessageKind int
+
+const (
+	// KindChat is a regular line typed by a participant.
+	KindChat MessageKind = iota
+	// KindSystem is a server-generated notice such as joins and leaves.
+	KindSystem
+	// KindDirect is a private message delivered to a single recipient.
+	KindDirect
+	// KindAction is an emote sent with /me, shown as "* alice waves".
+	KindAction
+	// KindTyping tells sessions that the room's typing indicator changed. It
+	// only triggers a status line redraw and is never shown or stored.
+	KindTyping
+	// KindEdit replaces the body of the earlier message its ID names.
+	KindEdit
+	// KindDelete retracts the earlier message its ID names.
+	KindDelete
+	// KindReaction tells clients someone reacted to the earlier message its
+	// ID names; Body is the reaction.
+	KindReaction
+)
+
+// String returns the lowercase name of the kind, suitable for logs.
+func (k MessageKind) String() string {
+	switch k {
+	case KindChat:
+		return "chat"
+	case KindSystem:
+		return "system"
+	case KindDirect:
+		return "direct"
+	case KindAction:
+		return "action"
+	case KindTyping:
+		return "typing"
+	case KindEdit:
+		return "edit"
+	case KindDelete:
+		return "delete"
+	case KindReaction:
+		return "reaction"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the kind by name.
+func (k MessageKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a kind name produced by MarshalText.
+func (k *MessageKind) UnmarshalText(text []byte) error {
+	for _, kind := range []MessageKind{KindChat, KindSystem, KindDirect, KindAction, KindTyping, KindEdit, KindDelete, KindReaction} {
+		if kind.String() == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("chat: unknown message kind %q", text)
+}
+
+// Message is a single event broadcast to the room. Rendering to terminal text is
+// left to each session so clients can format, filter, or log it independently.
+type Message struct {
+	// ID identifies chat and action messages within their room. Edit,
+	// delete, and reaction events carry the ID of the message they change.
+	ID          uint64      `json:"id,omitempty"`
+	Timestamp   time.Time   `json:"timestamp"`
+	SenderID    string      `json:"sender_id,omitempty"`
+	SenderName  string      `json:"sender_name,omitempty"`
+	SenderColor string      `json:"-"`
+	Body        string      `json:"body"`
+	Kind        MessageKind `json:"kind"`
+
+	// RecipientID and RecipientName are set for KindDirect messages.
+	RecipientID   string `json:"recipient_id,omitempty"`
+	RecipientName string `json:"recipient_name,omitempty"`
+
+	// Bridge names the bridge a message relayed from another network arrived
+	// through.
+	Bridge string `json:"bridge,omitempty"`
+	// Node names the cluster node a message replicated from another node was
+	// posted on.
+	Node string `json:"node,omitempty"`
+
+	// ReplyTo is the ID of the message this one answers. ReplyName and
+	// ReplyQuote are its sender and the start of its text, quoted when the
+	// reply is shown.
+	ReplyTo    uint64 `json:"reply_to,omitempty"`
+	ReplyName  string `json:"reply_name,omitempty"`
+	ReplyQuote string `json:"reply_quote,omitempty"`
+
+	// Edited and Deleted mark messages in the room history that their
+	// sender changed with /edit or retracted with /delete.
+	Edited  bool `json:"edited,omitempty"`
+	Deleted bool `json:"deleted,omitempty"`
+
+	// Reactions are the /react counts of a message in the room history, and
+	// the updated counts on a reaction event.
+	Reactions []Reaction `json:"reactions,omitempty"`
+
+	// Notice is set on system messages that machine clients may act on. Such
+	// messages are never stored.
+	Notice Notice `json:"-"`
+}
+
+// messageOverhead approximates the fixed in-memory cost of a Message value.
+var messageOverhead = int(unsafe.Sizeof(Message{}))
+
+// size estimates the bytes a message occupies in queues and history buffers.
+func (m Message) size() int {
+	size := messageOverhead + len(m.SenderID) + len(m.SenderName) + len(m.SenderColor) + len(m.Body) +
+		len(m.RecipientID) + len(m.RecipientName) + len(m.Bridge) + len(m.Node) + len(m.ReplyName) + len(m.ReplyQuote)
+	for _, r := range m.Reactions {
+		size += len(r.Emoji)
+		for _, user := range r.Users {
+			size += len(user)
+		}
+	}
+	return size
+}
@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/ledzpl/schat/pkg/buildinfo"
+)
+
+const defaultServerName = "schat"
+
+// defaultMOTD reproduces the built-in greeting when no MOTD file is configured.
+const defaultMOTD = `Welcome to {{.ServerName}}, {{.Username}}!
+Type messages and press enter to chat. Ctrl+D to exit.`
+
+// MOTDData is the data available to MOTD templates.
+type MOTDData struct {
+	Username   string
+	UserCount  int
+	ServerName string
+	Room       string
+	// Version is the running schat release, e.g. "v1.2.0".
+	Version string
+}
+
+// MOTD is a message of the day shown to each user after joining. It is a
+// text/template with MOTDData fields such as {{.Username}} and {{.UserCount}}.
+type MOTD struct {
+	tmpl *template.Template
+}
+
+// ParseMOTD compiles text as an MOTD template.
+func ParseMOTD(text string) (*MOTD, error) {
+	tmpl, err := template.New("motd").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("chat: parse motd: %w", err)
+	}
+	m := &MOTD{tmpl: tmpl}
+	// Catch references to unknown fields at load time rather than on every join.
+	if _, err := m.Render(MOTDData{}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadMOTD reads and compiles the MOTD template at path.
+func LoadMOTD(path string) (*MOTD, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("chat: read motd %q: %w", path, err)
+	}
+	return ParseMOTD(string(data))
+}
+
+// Render executes the template and returns its output split into lines, with
+// trailing blank lines removed.
+func (m *MOTD) Render(data MOTDData) ([]string, error) {
+	var buf bytes.Buffer
+	if err := m.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("chat: render motd: %w", err)
+	}
+
+	text := strings.TrimRight(strings.ReplaceAll(buf.String(), "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+func mustParseMOTD(text string) *MOTD {
+	m, err := ParseMOTD(text)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// WithServerName sets the server name exposed to MOTD templates.
+func WithServerName(name string) RoomOption {
+	return func(r *Room) {
+		if name != "" {
+			r.serverName = name
+		}
+	}
+}
+
+// WithMOTD replaces the default greeting shown to users after they join.
+func WithMOTD(m *MOTD) RoomOption {
+	return func(r *Room) {
+		if m != nil {
+			r.motd = m
+		}
+	}
+}
+
+// WithGoodbye sets a line shown to users as they quit; "" shows none.
+func WithGoodbye(text string) RoomOption {
+	return func(r *Room) {
+		r.goodbye = stripControl(text)
+	}
+}
+
+// greeting renders the MOTD for client.
+func (r *Room) greeting(client *Client) ([]string, error) {
+	r.mu.RLock()
+	motd, serverName := r.motd, r.serverName
+	r.mu.RUnlock()
+
+	return motd.Render(MOTDData{
+		Username:   client.Username,
+		UserCount:  r.ClientCount(),
+		ServerName: serverName,
+		Room:       r.name,
+		Version:    buildinfo.Get().Version,
+	})
+}
+
+// motdUpdatedHint is what connected users see when an operator marks the MOTD
+// as updated, instead of the whole MOTD being pushed at them.
+const motdUpdatedHint = "MOTD updated, type /motd to read it"
+
+// hint shows text to the room's current members only: it is neither kept in
+// the history nor persisted, so later joiners never see it.
+func (r *Room) hint(text string) int {
+	msg := Message{Timestamp: r.now(), Body: text, Kind: KindSystem}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.deliverLocked("", msg)
+	return len(r.clients)
+}
+
+// announceMOTDUpdate hints every connected user that the MOTD changed and
+// returns how many were told. Users are in one room at a time, so each sees
+// the hint once.
+func (r *Room) announceMOTDUpdate() int {
+	rooms := []*Room{r}
+	if r.manager != nil {
+		rooms = r.manager.Rooms()
+	}
+	told := 0
+	for _, room := range rooms {
+		told += room.hint(motdUpdatedHint)
+	}
+	return told
+}
+
+// runMOTD re-shows the message of the day, or lets an operator tell everyone
+// online that it changed.
+func runMOTD(s *session, args string) error {
+	switch strings.ToLower(args) {
+	case "":
+		lines, err := s.room().greeting(s.client)
+		if err != nil {
+			return s.printSystem(fmt.Sprintf("/motd: %v", err))
+		}
+		if len(lines) == 0 {
+			return s.printSystem("there is no message of the day")
+		}
+		for _, line := range lines {
+			if err := s.printMessage(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "updated":
+		if !s.client.Operator {
+			return s.printSystem(fmt.Sprintf("/motd updated: %v", errPermissionDenied))
+		}
+		told := s.room().announceMOTDUpdate()
+		s.log.Info("chat: motd update announced", "users", told)
+		return s.printSystem(fmt.Sprintf("told %d connected users the MOTD was updated", told))
+	default:
+		return s.printSystem("usage: /motd [updated]")
+	}
+}
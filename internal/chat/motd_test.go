@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMOTDRender(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "variables",
+			text: "Hi {{.Username}} on {{.ServerName}}/{{.Room}}, {{.UserCount}} online\n",
+			want: []string{"Hi alice on example/lobby, 2 online"},
+		},
+		{
+			name: "crlf and trailing blank lines",
+			text: "one\r\ntwo\r\n\r\n",
+			want: []string{"one", "two"},
+		},
+		{
+			name: "empty",
+			text: "",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseMOTD(tt.text)
+			require.NoError(t, err)
+			lines, err := m.Render(MOTDData{Username: "alice", UserCount: 2, ServerName: "example", Room: "lobby"})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, lines)
+		})
+	}
+}
+
+func TestParseMOTDRejectsBadTemplates(t *testing.T) {
+	_, err := ParseMOTD("{{.Username")
+	require.Error(t, err)
+
+	_, err = ParseMOTD("{{.Nickname}}")
+	require.Error(t, err, "unknown fields are caught at load time")
+}
+
+func TestLoadMOTD(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "motd.txt")
+	require.NoError(t, os.WriteFile(path, []byte("Welcome {{.Username}}"), 0o600))
+
+	m, err := LoadMOTD(path)
+	require.NoError(t, err)
+	lines, err := m.Render(MOTDData{Username: "bob"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Welcome bob"}, lines)
+
+	_, err = LoadMOTD(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
+
+func TestRoomGreetingUsesMOTD(t *testing.T) {
+	room := NewRoom(WithServerName("example"), WithMOTD(mustParseMOTD("{{.ServerName}}: {{.Username}} ({{.UserCount}})")))
+	alice := room.AddClient("alice")
+
+	lines, err := room.greeting(alice)
+	require.NoError(t, err)
+	require.Equal(t, []string{"example: alice (1)"}, lines)
+
+	lines, err = NewRoom().greeting(alice)
+	require.NoError(t, err)
+	require.Equal(t, "Welcome to schat, alice!", lines[0])
+}
+
+func TestMOTDCommand(t *testing.T) {
+	room := NewRoom(WithMOTD(mustParseMOTD("Hello {{.Username}}\nBe nice")))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	require.NoError(t, sess.runCommand("/motd"))
+	require.Contains(t, out.String(), "Hello alice")
+	require.Contains(t, out.String(), "Be nice")
+
+	require.NoError(t, sess.runCommand("/motd updated"))
+	require.Contains(t, out.String(), "/motd updated: permission denied")
+	require.NoError(t, sess.runCommand("/motd again"))
+	require.Contains(t, out.String(), "usage: /motd [updated]")
+
+	empty := NewRoom(WithMOTD(mustParseMOTD("")))
+	sess, out = newCommandTestSession(empty, ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/motd"))
+	require.Contains(t, out.String(), "there is no message of the day")
+}
+
+func TestMOTDUpdatedHintsEveryRoomOnce(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "")
+	require.NoError(t, err)
+	bob := m.Lobby().AddClient("bob")
+	carol := dev.AddClient("carol")
+	drainChannel(bob.Send())
+	drainChannel(carol.Send())
+
+	op, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "op", Operator: true})
+	drainChannel(bob.Send())
+	require.NoError(t, op.runCommand("/motd updated"))
+	require.Contains(t, out.String(), "told 3 connected users the MOTD was updated")
+
+	for _, client := range []*Client{bob, carol} {
+		require.Equal(t, motdUpdatedHint, (<-client.Send()).Body)
+		require.Empty(t, client.Send(), "the hint is sent once, not the whole MOTD")
+	}
+	for _, msg := range m.Lobby().history.Recent(0) {
+		require.NotEqual(t, motdUpdatedHint, msg.Body, "later joiners never see the hint")
+	}
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/botclient"
+)
+
+// EventNotice carries a server notice on the event stream; Code says which.
+// The codes are the ones bots see, e.g. botclient.NoticeUpgrade.
+const EventNotice = "notice"
+
+// Notice marks a system message that machine clients may act on. Bots receive
+// it as a notice event rather than a message.
+type Notice struct {
+	Code string
+	// Version is the release an upgrade installs, if known.
+	Version string
+	// Deadline is when an upgrade expects the server to go away; zero when
+	// unknown.
+	Deadline time.Time
+}
+
+// UpgradeNotice announces that the server is about to be replaced, e.g. by a
+// new release during a rolling upgrade.
+type UpgradeNotice struct {
+	// Version is the release replacing this server, if known.
+	Version string
+	// Deadline is when the server expects to go away; zero when unknown.
+	Deadline time.Time
+}
+
+// text is what people see, e.g. "this server is being upgraded to v1.3.0 in
+// 30s; you will be disconnected, reconnect to continue".
+func (n UpgradeNotice) text(now time.Time) string {
+	text := "this server is being upgraded"
+	if n.Version != "" {
+		text += " to " + n.Version
+	}
+	if !n.Deadline.IsZero() {
+		if wait := n.Deadline.Sub(now).Round(time.Second); wait > 0 {
+			text += " in " + wait.String()
+		}
+	}
+	return text + "; you will be disconnected, reconnect to continue"
+}
+
+// AnnounceUpgrade warns every connected user, bot, and event listener that the
+// server is about to be replaced, and returns how many were told. Upgrade
+// notices are not kept in the history.
+func (m *RoomManager) AnnounceUpgrade(n UpgradeNotice) int {
+	now := m.lobby.now()
+	text := n.text(now)
+	notice := Notice{Code: botclient.NoticeUpgrade, Version: n.Version, Deadline: n.Deadline}
+
+	told := 0
+	for _, room := range m.Rooms() {
+		msg := Message{Timestamp: now, Body: text, Kind: KindSystem, Notice: notice}
+		room.mu.RLock()
+		for _, client := range room.clients {
+			client.deliver(msg, room.backpressure, room.backpressureTimeout)
+			told++
+		}
+		room.mu.RUnlock()
+	}
+	ev := Event{Version: EventsVersion, Type: EventNotice, Time: now, Code: notice.Code, ServerVersion: n.Version, Summary: "schat upgrade", Body: text}
+	if !n.Deadline.IsZero() {
+		ev.Deadline = &n.Deadline
+	}
+	told += m.lobby.notifier.broadcast(ev)
+
+	m.lobby.logger.Warn("chat: upgrade announced", "version", n.Version, "deadline", n.Deadline, "notified", told)
+	return told
+}
+
+// UpgradeHandler announces an upgrade on POST, e.g. from a deploy script
+// before the server is replaced: version names the new release and in is how
+// long until this server goes away ("30s"). Both are optional. The handler
+// does not authenticate; serve it behind something that does.
+func (m *RoomManager) UpgradeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n := UpgradeNotice{Version: r.FormValue("version")}
+		if in := r.FormValue("in"); in != "" {
+			wait, err := time.ParseDuration(in)
+			if err != nil || wait < 0 {
+				http.Error(w, fmt.Sprintf("bad in %q: want a duration like 30s", in), http.StatusBadRequest)
+				return
+			}
+			n.Deadline = m.lobby.now().Add(wait)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"notified": m.AnnounceUpgrade(n)})
+	})
+}
+
+// protocolEnv records the protocol version a machine client declared with
+// botclient.ProtocolEnv.
+func (s *session) protocolEnv(req *Request) {
+	if req.Name != botclient.ProtocolEnv {
+		return
+	}
+	if v, err := strconv.Atoi(req.Value); err == nil && v > 0 {
+		s.protocol.Store(int32(v))
+	}
+}
+
+// protocolNotice compares the protocol version the client declared with the
+// server's version of the named protocol. It returns the notice code and text
+// for a mismatch, and logs it, or returns "" when they match.
+func (s *session) protocolNotice(name string, current int) (string, string) {
+	declared := int(s.protocol.Load())
+	if declared == 0 {
+		declared = 1
+	}
+	var code, text string
+	switch {
+	case declared < current:
+		code = botclient.NoticeProtocolOutdated
+		text = fmt.Sprintf("this client speaks %s protocol v%d but the server speaks v%d; upgrade the client, as it may ignore or misread newer events", name, declared, current)
+	case declared > current:
+		code = botclient.NoticeProtocolNewer
+		text = fmt.Sprintf("this client speaks %s protocol v%d but the server only v%d; newer features are unavailable until the server is upgraded", name, declared, current)
+	default:
+		return "", ""
+	}
+	s.log.Warn("chat: machine client protocol mismatch", "protocol", name, "client_version", declared, "server_version", current)
+	return code, text
+}
@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/botclient"
+)
+
+func TestAnnounceUpgrade(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	m := newTestManager(WithRoomOptions(WithClock(func() time.Time { return ts })))
+	dev, err := m.Create("dev", "bob")
+	require.NoError(t, err)
+	alice := m.Lobby().AddClient("alice")
+	bob := dev.AddClient("bob")
+	events, unsubscribe := m.notifier.subscribe("carol")
+	defer unsubscribe()
+	bot := dialBot(t, m.Lobby(), "karma")
+	notices := make(chan botclient.Notice, 1)
+	bot.OnNotice(func(n botclient.Notice) { notices <- n })
+	drainChannel(alice.Send())
+	drainChannel(bob.Send())
+
+	deadline := ts.Add(30 * time.Second)
+	require.Equal(t, 4, m.AnnounceUpgrade(UpgradeNotice{Version: "v1.3.0", Deadline: deadline}))
+
+	text := "this server is being upgraded to v1.3.0 in 30s; you will be disconnected, reconnect to continue"
+	msg := <-bob.Send()
+	require.Equal(t, text, msg.Body)
+	require.Equal(t, KindSystem, msg.Kind)
+	require.Equal(t, Notice{Code: botclient.NoticeUpgrade, Version: "v1.3.0", Deadline: deadline}, msg.Notice)
+	require.Equal(t, text, (<-alice.Send()).Body)
+
+	ev := <-events
+	require.Equal(t, EventNotice, ev.Type)
+	require.Equal(t, botclient.NoticeUpgrade, ev.Code)
+	require.Equal(t, "v1.3.0", ev.ServerVersion)
+	require.Equal(t, deadline, *ev.Deadline)
+
+	select {
+	case n := <-notices:
+		require.Equal(t, botclient.NoticeUpgrade, n.Code)
+		require.Equal(t, "v1.3.0", n.Version)
+		require.True(t, deadline.Equal(n.Deadline))
+		require.Equal(t, text, n.Text)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the bot got no upgrade notice")
+	}
+	for _, kept := range m.Lobby().history.Recent(100) {
+		require.NotEqual(t, text, kept.Body, "upgrade notices are not kept")
+	}
+
+	require.Equal(t, "this server is being upgraded; you will be disconnected, reconnect to continue", UpgradeNotice{}.text(ts))
+}
+
+func TestUpgradeHandler(t *testing.T) {
+	m := newTestManager()
+	alice := m.Lobby().AddClient("alice")
+	drainChannel(alice.Send())
+	handler := m.UpgradeHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/upgrade", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/debug/upgrade", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = post(url.Values{"in": {"soon"}})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = post(url.Values{"version": {"v2.0.0"}, "in": {"1m"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"notified": 1}`, rec.Body.String())
+	require.Contains(t, (<-alice.Send()).Body, "upgraded to v2.0.0 in 1m0s")
+}
+
+func TestProtocolMismatchWarnsMachineClients(t *testing.T) {
+	m := newTestManager()
+	conn := dialSSHWith(t, m.Lobby(), "karma", accountConfig())
+
+	bot, err := conn.NewSession()
+	require.NoError(t, err)
+	stdout, err := bot.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, bot.Setenv(botclient.ProtocolEnv, "2"))
+	require.NoError(t, bot.RequestSubsystem(botclient.Subsystem))
+	lines := bufio.NewScanner(stdout)
+	var events []botclient.Event
+	for len(events) < 2 && lines.Scan() {
+		var ev botclient.Event
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &ev))
+		events = append(events, ev)
+	}
+	require.Len(t, events, 2)
+	require.Equal(t, botclient.EventReady, events[0].Type)
+	require.Equal(t, botclient.EventNotice, events[1].Type)
+	require.Equal(t, botclient.NoticeProtocolNewer, events[1].Code)
+	require.Contains(t, events[1].Body, "this client speaks schat-bot protocol v2 but the server only v1")
+
+	listener, err := conn.NewSession()
+	require.NoError(t, err)
+	stdout, err = listener.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, listener.Setenv(botclient.ProtocolEnv, "3"))
+	require.NoError(t, listener.RequestSubsystem(EventsSubsystem))
+	lines = bufio.NewScanner(stdout)
+	require.True(t, lines.Scan())
+	var ev Event
+	require.NoError(t, json.Unmarshal(lines.Bytes(), &ev))
+	require.Equal(t, EventNotice, ev.Type)
+	require.Equal(t, botclient.NoticeProtocolNewer, ev.Code)
+	require.Contains(t, ev.Body, "schat-events protocol v3 but the server only v1")
+}
@@ -0,0 +1,222 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// EventsSubsystem is the SSH subsystem that streams notification events for
+// the authenticated user as JSON Lines, e.g. "ssh -s host schat-events".
+// docs/events.md documents the schema.
+const EventsSubsystem = "schat-events"
+
+// EventsVersion is sent with every event and bumped on incompatible changes.
+const EventsVersion = 1
+
+// Event types.
+const (
+	EventMention = "mention"
+	EventDirect  = "direct"
+	EventTest    = "test"
+)
+
+// eventQueueSize bounds undelivered events per listener; a listener that falls
+// further behind misses events rather than slowing the chat down.
+const eventQueueSize = 16
+
+// Event is a notification for a user, shaped for desktop notifications and
+// text-to-speech sidecars.
+type Event struct {
+	Version int       `json:"v"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Room    string    `json:"room,omitempty"`
+	From    string    `json:"from,omitempty"`
+	// Summary is a short plain-text line suitable as a notification title or
+	// for reading aloud.
+	Summary string `json:"summary"`
+	Body    string `json:"body"`
+	// Code, ServerVersion, and Deadline describe notice events, as in the bot
+	// protocol.
+	Code          string     `json:"code,omitempty"`
+	ServerVersion string     `json:"server_version,omitempty"`
+	Deadline      *time.Time `json:"deadline,omitempty"`
+}
+
+// notifier fans events out to the event streams of each user. Rooms under one
+// manager share it so mentions reach listeners wherever the user is.
+type notifier struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan Event]struct{}
+}
+
+func newNotifier() *notifier {
+	return &notifier{subs: make(map[string]map[chan Event]struct{})}
+}
+
+// subscribe registers a listener for username's events. The returned func
+// removes it.
+func (n *notifier) subscribe(username string) (<-chan Event, func()) {
+	ch := make(chan Event, eventQueueSize)
+	n.mu.Lock()
+	if n.subs[username] == nil {
+		n.subs[username] = make(map[chan Event]struct{})
+	}
+	n.subs[username][ch] = struct{}{}
+	n.mu.Unlock()
+
+	return ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.subs[username], ch)
+		if len(n.subs[username]) == 0 {
+			delete(n.subs, username)
+		}
+	}
+}
+
+// publish sends ev to username's listeners and returns how many there are.
+func (n *notifier) publish(username string, ev Event) int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	for ch := range n.subs[username] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	return len(n.subs[username])
+}
+
+// broadcast sends ev to every listener and returns how many there are.
+func (n *notifier) broadcast(ev Event) int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	count := 0
+	for _, subs := range n.subs {
+		for ch := range subs {
+			select {
+			case ch <- ev:
+			default:
+			}
+			count++
+		}
+	}
+	return count
+}
+
+// mentioned returns the listening users @mentioned in body, except sender.
+func (n *notifier) mentioned(body, sender string) []string {
+	mentions := findMentions(body)
+	if len(mentions) == 0 {
+		return nil
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var users []string
+	for username := range n.subs {
+		if username == sender {
+			continue
+		}
+		for _, m := range mentions {
+			if strings.EqualFold(m.name, username) {
+				users = append(users, username)
+				break
+			}
+		}
+	}
+	return users
+}
+
+// notify stamps ev and publishes it to username's listeners.
+func (r *Room) notify(username string, ev Event) int {
+	ev.Version = EventsVersion
+	ev.Time = r.now()
+	return r.notifier.publish(username, ev)
+}
+
+// notifyMentions tells listening users they were @mentioned in msg.
+func (r *Room) notifyMentions(msg Message) {
+	for _, username := range r.notifier.mentioned(msg.Body, msg.SenderName) {
+		r.notify(username, Event{
+			Type:    EventMention,
+			Room:    r.name,
+			From:    msg.SenderName,
+			Summary: fmt.Sprintf("%s mentioned you in #%s", msg.SenderName, r.name),
+			Body:    msg.Body,
+		})
+	}
+}
+
+// isEventsRequest reports whether req asks for the event stream subsystem.
+func isEventsRequest(req *Request) bool {
+	return req.Type == RequestSubsystem && req.Name == EventsSubsystem
+}
+
+// streamEvents writes the user's notification events to the channel as JSON
+// Lines until the client closes it. Only sessions that proved their name get
+// a stream, since anyone may sign in under a name nobody registered.
+func (s *session) streamEvents() error {
+	if err := s.home.checkBanned(s.info); err != nil {
+		fmt.Fprintf(stderr(s.channel), "schat: %v\n", err)
+		return err
+	}
+	// A saved key identity may rename the user, as it does in the shell.
+	s.info = s.home.identify(s.info)
+	if !s.info.Account && !s.info.keyBound {
+		s.log.Info("chat: event stream refused", "username", stripControl(s.info.Username))
+		err := fmt.Errorf("sign in to %s with its account, password file entry, saved key, or OIDC to stream its events", s.info.Username)
+		fmt.Fprintf(stderr(s.channel), "schat: %v\n", err)
+		return sshserver.Exit(sshserver.ExitFailed, err)
+	}
+	events, unsubscribe := s.home.notifier.subscribe(s.info.Username)
+	defer unsubscribe()
+	s.log.Info("chat: event stream opened", "username", s.info.Username)
+
+	// Input is ignored; the stream lasts until the channel closes, even if the
+	// sidecar's stdin is /dev/null. Like the request pump, the reader ends when
+	// the channel does.
+	go func() {
+		_, _ = io.Copy(io.Discard, s.channel)
+	}()
+
+	enc := json.NewEncoder(s.channel)
+	if code, text := s.protocolNotice(EventsSubsystem, EventsVersion); code != "" {
+		if err := enc.Encode(Event{Version: EventsVersion, Type: EventNotice, Time: s.home.now(), Code: code, Summary: "schat protocol mismatch", Body: text}); err != nil {
+			return nil
+		}
+	}
+	for {
+		select {
+		case <-s.requestsDone:
+			return nil
+		case <-s.ctx.Done():
+			return nil
+		case ev := <-events:
+			if err := enc.Encode(ev); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// runNotifyTest sends a test event to the user's own listeners.
+func runNotifyTest(s *session, _ string) error {
+	n := s.room().notify(s.client.Username, Event{
+		Type:    EventTest,
+		Room:    s.room().Name(),
+		Summary: "schat test notification",
+		Body:    "If you can see or hear this, notifications are working.",
+	})
+	if n == 0 {
+		return s.printSystem(fmt.Sprintf("no notification listeners for %s; start one with: ssh -s <host> %s", s.client.Username, EventsSubsystem))
+	}
+	return s.printSystem(fmt.Sprintf("sent a test notification to %d listener(s)", n))
+}
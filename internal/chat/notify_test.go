@@ -0,0 +1,151 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// accountConfig signs every connection in to the account of its SSH
+// username, as --accounts-file does after checking the password.
+func accountConfig() *ssh.ServerConfig {
+	return &ssh.ServerConfig{
+		NoClientAuth: true,
+		NoClientAuthCallback: func(ssh.ConnMetadata) (*ssh.Permissions, error) {
+			return &ssh.Permissions{Extensions: map[string]string{
+				sshserver.ExtAuthMethod: "password",
+				sshserver.ExtAccount:    "1",
+			}}, nil
+		},
+	}
+}
+
+func TestNotifierMentions(t *testing.T) {
+	n := newNotifier()
+	_, stopAlice := n.subscribe("alice")
+	defer stopAlice()
+	_, stopBob := n.subscribe("bob")
+	defer stopBob()
+
+	tests := []struct {
+		body   string
+		sender string
+		want   []string
+	}{
+		{body: "hi @alice", sender: "carol", want: []string{"alice"}},
+		{body: "hi @ALICE and @alice", sender: "carol", want: []string{"alice"}},
+		{body: "@bob, @alice: lunch?", sender: "carol", want: []string{"alice", "bob"}},
+		{body: "note to self @alice", sender: "alice", want: nil},
+		{body: "mail alice@example.com", sender: "carol", want: nil},
+		{body: "hi @dave", sender: "carol", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			require.ElementsMatch(t, tt.want, n.mentioned(tt.body, tt.sender))
+		})
+	}
+}
+
+func TestNotifierPublish(t *testing.T) {
+	n := newNotifier()
+	require.Zero(t, n.publish("alice", Event{Type: EventTest}))
+
+	events, stop := n.subscribe("alice")
+	require.Equal(t, 1, n.publish("alice", Event{Type: EventTest}))
+	require.Equal(t, EventTest, (<-events).Type)
+
+	for i := 0; i < eventQueueSize+5; i++ {
+		n.publish("alice", Event{Type: EventTest})
+	}
+	require.Len(t, events, eventQueueSize, "slow listeners drop events instead of blocking")
+
+	stop()
+	require.Zero(t, n.publish("alice", Event{Type: EventTest}))
+	require.Empty(t, n.subs)
+}
+
+func TestNotifyTestCommand(t *testing.T) {
+	room := NewRoom()
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	require.NoError(t, sess.runCommand("/notifytest"))
+	require.Contains(t, out.String(), "no notification listeners for alice; start one with: ssh -s <host> schat-events")
+
+	events, stop := room.notifier.subscribe("alice")
+	defer stop()
+	require.NoError(t, sess.runCommand("/notifytest"))
+	require.Contains(t, out.String(), "sent a test notification to 1 listener(s)")
+	ev := <-events
+	require.Equal(t, EventTest, ev.Type)
+	require.Equal(t, EventsVersion, ev.Version)
+	require.Equal(t, "lobby", ev.Room)
+}
+
+// TestEventsSubsystem streams events over SSH as a sidecar would.
+func TestEventsSubsystem(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	m := newTestManager(WithRoomOptions(WithClock(func() time.Time { return ts })))
+	dev, err := m.Create("dev", "bob")
+	require.NoError(t, err)
+
+	sess, err := dialSSHWith(t, m.Lobby(), "alice", accountConfig()).NewSession()
+	require.NoError(t, err)
+	stdout, err := sess.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, sess.RequestSubsystem(EventsSubsystem))
+	require.Eventually(t, func() bool {
+		m.notifier.mu.RLock()
+		defer m.notifier.mu.RUnlock()
+		return len(m.notifier.subs["alice"]) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	bob := dev.AddClient("bob")
+	m.Lobby().AddClient("alice")
+	dev.Broadcast(bob.ID, "bob", "@alice can you review?")
+	dev.Broadcast(bob.ID, "bob", "no mention here")
+	_, _, err = m.Lobby().SendDirect(m.Lobby().AddClient("carol").ID, "alice", "psst")
+	require.NoError(t, err)
+
+	lines := bufio.NewScanner(stdout)
+	var got []map[string]any
+	for len(got) < 2 && lines.Scan() {
+		var ev map[string]any
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &ev))
+		got = append(got, ev)
+	}
+	require.Equal(t, []map[string]any{
+		{"v": 1.0, "type": "mention", "time": "2024-05-01T09:30:00Z", "room": "dev", "from": "bob", "summary": "bob mentioned you in #dev", "body": "@alice can you review?"},
+		{"v": 1.0, "type": "direct", "time": "2024-05-01T09:30:00Z", "from": "carol", "summary": "carol sent you a direct message", "body": "psst"},
+	}, got)
+}
+
+// TestEventsSubsystemNeedsAProvedName keeps an unproven name from reading
+// someone else's mentions and direct messages.
+func TestEventsSubsystemNeedsAProvedName(t *testing.T) {
+	m := newTestManager()
+	sess, err := dialSSH(t, m.Lobby(), "alice").NewSession()
+	require.NoError(t, err)
+	stdout, err := sess.StdoutPipe()
+	require.NoError(t, err)
+	stderr, err := sess.StderrPipe()
+	require.NoError(t, err)
+	require.NoError(t, sess.RequestSubsystem(EventsSubsystem))
+
+	out, err := io.ReadAll(stdout)
+	require.NoError(t, err)
+	require.Empty(t, out)
+	msg, err := io.ReadAll(stderr)
+	require.NoError(t, err)
+	require.Contains(t, string(msg), "sign in to alice with its account")
+
+	m.notifier.mu.RLock()
+	defer m.notifier.mu.RUnlock()
+	require.Empty(t, m.notifier.subs["alice"])
+}
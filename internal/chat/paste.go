@@ -0,0 +1,154 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledzpl/schat/pkg/fileshare"
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// maxInputRunes bounds the input line, pasted text included; input past it
+// is dropped.
+const maxInputRunes = 64 << 10
+
+// pasteSnippetLines is the most lines a paste may have and still be sent as
+// one message; longer pastes are shared as a snippet where file sharing
+// allows.
+const pasteSnippetLines = 10
+
+// pasteJoiner stands for a pasted line break in the input line and in the
+// message a paste collapses into.
+const pasteJoiner = " ⏎ "
+
+// pasteName is the file name snippets are shared under.
+const pasteName = "paste.txt"
+
+// WithMaxMessageLength caps message bodies at n runes, cutting off the rest;
+// 0, the default, is unlimited.
+func WithMaxMessageLength(n int) RoomOption {
+	return func(r *Room) {
+		if n >= 0 {
+			r.maxMessageLength = n
+		}
+	}
+}
+
+// cleanBody removes escape sequences from a message body and cuts it to the
+// room's length limit.
+func (r *Room) cleanBody(text string) string {
+	text, _ = cutRunes(tui.Sanitize(text), r.maxMessageLength)
+	return text
+}
+
+// cutRunes cuts text to n runes, reporting how many were cut off. n of 0 cuts
+// nothing.
+func cutRunes(text string, n int) (string, int) {
+	count := utf8.RuneCountInString(text)
+	if n <= 0 || count <= n {
+		return text, 0
+	}
+	i := 0
+	for pos := range text {
+		if i == n {
+			return text[:pos], count - n
+		}
+		i++
+	}
+	return text, 0
+}
+
+// noteTruncated tells the user how much of text, which was just sent, the
+// room's length limit cut off.
+func (s *session) noteTruncated(text string) error {
+	limit := s.room().maxMessageLength
+	if _, cut := cutRunes(tui.Sanitize(text), limit); cut > 0 {
+		return s.printSystem(fmt.Sprintf("message cut to the %d character limit; the last %d were not sent", limit, cut))
+	}
+	return nil
+}
+
+// appendInput adds r to the input line unless it is full.
+func (s *session) appendInput(r rune) {
+	if s.buffer.Len() < maxInputRunes {
+		s.buffer.Append(r)
+	}
+}
+
+// pasteEvent adds ev, part of a bracketed paste, to the input line. Line
+// breaks are kept rather than sending the line, and control keys do nothing.
+// The prompt is redrawn once the paste ends.
+func (s *session) pasteEvent(ev tui.Event) {
+	switch {
+	case ev.Kind == tui.EventRune:
+		s.appendInput(ev.Rune)
+	case ev.Kind == tui.EventEnter:
+		s.appendInput('\n')
+	case ev.Kind == tui.EventControl && ev.Rune == '\t':
+		s.appendInput(' ')
+	}
+}
+
+// typedAfter reports whether events hold more text. Text after a line break
+// in the same read was pasted, as nobody types that fast.
+func typedAfter(events []tui.Event) bool {
+	for _, ev := range events {
+		if ev.Kind == tui.EventRune {
+			return true
+		}
+	}
+	return false
+}
+
+// submitPaste sends an input line holding pasted line breaks: one line as
+// typed, a few as one message with the breaks marked, and more, or more than
+// the length limit allows, as a snippet file where file sharing allows.
+func (s *session) submitPaste(text string) error {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" || len(lines) > 0 {
+			lines = append(lines, strings.TrimRight(line, " "))
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	switch len(lines) {
+	case 0:
+		return s.renderPrompt()
+	case 1:
+		return s.submitText(lines[0])
+	}
+
+	s.room().touch(s.client)
+	collapsed := strings.Join(lines, pasteJoiner)
+	_, cut := cutRunes(collapsed, s.room().maxMessageLength)
+	if store := s.room().files; store != nil && s.info.AuthMethod != "" && (len(lines) > pasteSnippetLines || cut > 0) {
+		return s.sharePaste(store, strings.Join(lines, "\n")+"\n", len(lines))
+	}
+	return s.broadcastLine(collapsed)
+}
+
+// sharePaste shares text as a snippet in the session's room, announced as
+// uploads are.
+func (s *session) sharePaste(store *fileshare.Store, text string, lines int) error {
+	room := s.room()
+	f, err := store.Put(s.client.Username, room.Name(), pasteName, strings.NewReader(text))
+	if errors.Is(err, fileshare.ErrTooLarge) {
+		err = fmt.Errorf("%w (limit %s)", err, fileshare.FormatSize(store.MaxBytes()))
+	}
+	if err != nil {
+		return s.printSystem("paste not shared: " + err.Error())
+	}
+	s.log.Info("chat: paste shared", "room", room.Name(), "file", f.ID, "lines", lines, "bytes", f.Size)
+	room.broadcastSystem(fmt.Sprintf("%s pasted %d lines as %s (%s); /download %s", f.Owner, lines, f.Name, fileshare.FormatSize(f.Size), f.ID))
+	return nil
+}
+
+// inputLine is the input line as drawn: pasted line breaks are marked and
+// /register passwords masked.
+func (s *session) inputLine() string {
+	return maskInput(strings.ReplaceAll(s.buffer.Snapshot(), "\n", pasteJoiner))
+}
@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/fileshare"
+)
+
+// chatBodies returns the bodies of the chat messages queued for c.
+func chatBodies(c *Client) []string {
+	var bodies []string
+	for {
+		select {
+		case msg := <-c.Send():
+			if msg.Kind == KindChat {
+				bodies = append(bodies, msg.Body)
+			}
+		default:
+			return bodies
+		}
+	}
+}
+
+func TestBracketedPasteIsOneMessage(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	bob := room.AddClient("bob")
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	drainChannel(bob.Send())
+
+	require.False(t, typeInput(t, sess, "\x1b[200~first line\r\n\tsecond line\r\n\x1b[201~"))
+	require.Empty(t, chatBodies(bob), "pasted line breaks do not send")
+	require.Contains(t, out.String(), "first line ⏎  second line ⏎ ", "the input line marks them")
+
+	require.False(t, typeInput(t, sess, "\r"))
+	require.Equal(t, []string{"first line ⏎  second line"}, chatBodies(bob))
+}
+
+func TestRapidLinesArePasted(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	bob := room.AddClient("bob")
+	sess, _ := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	drainChannel(bob.Send())
+
+	require.False(t, typeInput(t, sess, "one\rtwo\r/nick three\r"))
+	require.Equal(t, []string{"one ⏎ two ⏎ /nick three"}, chatBodies(bob), "lines read at once are one message, never a command")
+
+	require.False(t, typeInput(t, sess, "\n\nsolo\n"))
+	require.Equal(t, []string{"solo"}, chatBodies(bob), "blank lines around a single line are dropped")
+}
+
+func TestLongPasteIsSharedAsSnippet(t *testing.T) {
+	store := fileshare.New(1<<20, 1<<20, time.Hour)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithFiles(store))
+	bob := room.AddClient("bob")
+	sess, _ := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "password"})
+	drainChannel(bob.Send())
+
+	lines := make([]string, pasteSnippetLines+2)
+	for i := range lines {
+		lines[i] = strings.Repeat("x", i+1)
+	}
+	require.False(t, typeInput(t, sess, "\x1b[200~"+strings.Join(lines, "\r")+"\x1b[201~\r"))
+
+	files := store.List(room.Name())
+	require.Len(t, files, 1)
+	require.Equal(t, pasteName, files[0].Name)
+	_, data, err := store.Open(files[0].ID)
+	require.NoError(t, err)
+	content, err := io.ReadAll(data)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(lines, "\n")+"\n", string(content))
+
+	msg := <-bob.Send()
+	for msg.Kind == KindTyping {
+		msg = <-bob.Send()
+	}
+	require.Equal(t, KindSystem, msg.Kind)
+	require.Contains(t, msg.Body, "alice pasted 12 lines as paste.txt")
+	require.Contains(t, msg.Body, "/download "+files[0].ID)
+
+	anon, _ := newCommandTestSession(room, ClientInfo{Username: "carol"})
+	drainChannel(bob.Send())
+	require.False(t, typeInput(t, anon, "\x1b[200~"+strings.Join(lines, "\r")+"\x1b[201~\r"))
+	require.Len(t, store.List(room.Name()), 1, "anonymous users cannot share files")
+	bodies := chatBodies(bob)
+	require.Len(t, bodies, 1, "their paste is sent as one message: %q", bodies)
+}
+
+func TestMaxMessageLength(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithMaxMessageLength(5))
+	bob := room.AddClient("bob")
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	drainChannel(bob.Send())
+
+	require.False(t, typeInput(t, sess, "héllo world\r"))
+	require.Equal(t, []string{"héllo"}, chatBodies(bob))
+	require.Contains(t, out.String(), "[system] message cut to the 5 character limit; the last 6 were not sent")
+
+	out.Reset()
+	require.False(t, typeInput(t, sess, "short\r"))
+	require.NotContains(t, out.String(), "cut to")
+
+	require.NoError(t, sess.runCommand("/me waves wildly"))
+	require.Contains(t, out.String(), "the last 7 were not sent")
+	msg, err := room.Broadcast("", "webhook", "0123456789")
+	require.NoError(t, err)
+	require.Equal(t, "01234", msg.Body, "every path is cut")
+}
+
+func TestInputLineIsBounded(t *testing.T) {
+	room := NewRoom()
+	sess, _ := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	require.False(t, typeInput(t, sess, "\x1b[200~"+strings.Repeat("y", maxInputRunes+10)+"\x1b[201~"))
+	require.Equal(t, maxInputRunes, sess.buffer.Len())
+}
@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+// WithStore persists room chat and system messages to st. Direct messages
+// are never stored.
+func WithStore(st store.Store) RoomOption {
+	return func(r *Room) {
+		r.store = st
+	}
+}
+
+// WithLogger sets where the room and its sessions log lifecycle events and
+// background errors such as failed writes to the store.
+func WithLogger(logger *slog.Logger) RoomOption {
+	return func(r *Room) {
+		if logger != nil {
+			r.logger = logger
+		}
+	}
+}
+
+func (r *Room) persist(msg Message) {
+	if r.store == nil || msg.Kind == KindDirect || r.serverLog {
+		return
+	}
+	err := r.store.Append(context.Background(), store.Record{
+		Room:      r.name,
+		ID:        msg.ID,
+		Timestamp: msg.Timestamp,
+		Kind:      msg.Kind.String(),
+		Sender:    msg.SenderName,
+		Body:      msg.Body,
+	})
+	if err != nil {
+		r.logger.Error("chat: persist message failed", "room", r.name, "err", err)
+	}
+}
+
+// Search returns stored messages in this room containing text, newest first.
+func (r *Room) Search(ctx context.Context, text string, limit, offset int) ([]Message, error) {
+	if r.store == nil {
+		return nil, errNoStore
+	}
+	records, err := r.store.Search(ctx, store.Query{Room: r.name, Text: text, Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]Message, 0, len(records))
+	for _, rec := range records {
+		var kind MessageKind
+		if err := kind.UnmarshalText([]byte(rec.Kind)); err != nil {
+			kind = KindSystem
+		}
+		msgs = append(msgs, Message{
+			ID:         rec.ID,
+			Timestamp:  rec.Timestamp,
+			SenderName: rec.Sender,
+			Body:       rec.Body,
+			Kind:       kind,
+			Edited:     rec.Edited,
+		})
+	}
+	return msgs, nil
+}
+
+// searchPageSize is how many results /search shows at a time.
+const searchPageSize = 10
+
+// errNoStore is reported by Search when the room has no persistent store.
+var errNoStore = errors.New("message history is not persisted on this server")
+
+// searchState remembers the last /search so "/search next" can page through it.
+type searchState struct {
+	room   *Room
+	query  string
+	offset int
+}
+
+// runSearch shows stored messages matching a query: /search <text> starts a
+// search and /search next shows the following page.
+func runSearch(s *session, args string) error {
+	room := s.room()
+	if args == "" {
+		return s.printSystem("usage: /search <text> | /search next")
+	}
+
+	state := &searchState{room: room, query: args}
+	if args == "next" {
+		if s.search == nil || s.search.room != room {
+			return s.printSystem("no search to continue; try /search <text>")
+		}
+		state = s.search
+	}
+
+	msgs, err := room.Search(context.Background(), state.query, searchPageSize+1, state.offset)
+	if err != nil {
+		return s.printSystem(fmt.Sprintf("/search: %v", err))
+	}
+	more := len(msgs) > searchPageSize
+	if more {
+		msgs = msgs[:searchPageSize]
+	}
+	if len(msgs) == 0 {
+		s.search = nil
+		if state.offset > 0 {
+			return s.printSystem("no more results")
+		}
+		return s.printSystem(fmt.Sprintf("no messages in #%s match %q", room.Name(), state.query))
+	}
+
+	lines := []string{fmt.Sprintf("results %d-%d for %q in #%s, newest first:",
+		state.offset+1, state.offset+len(msgs), state.query, room.Name())}
+	for _, msg := range msgs {
+		lines = append(lines, "  "+formatSearchResult(msg))
+	}
+
+	state.offset += len(msgs)
+	s.search = nil
+	if more {
+		s.search = state
+		lines = append(lines, "/search next for more")
+	}
+	return s.printSystem(lines...)
+}
+
+// formatSearchResult renders a stored message as plain text, without colors
+// or mention bells.
+func formatSearchResult(msg Message) string {
+	ts := msg.Timestamp.Format(timestampFormat)
+	edited := ""
+	if msg.Edited {
+		edited = " " + editedMarker
+	}
+	switch msg.Kind {
+	case KindSystem:
+		return fmt.Sprintf("[%s] %s", ts, msg.Body)
+	case KindAction:
+		return fmt.Sprintf("[%s] * %s %s%s", ts, msg.SenderName, msg.Body, edited)
+	}
+	return fmt.Sprintf("[%s] %s: %s%s", ts, msg.SenderName, msg.Body, edited)
+}
@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestRoomPersistsChatAndSystemMessages(t *testing.T) {
+	st := store.NewMemory()
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithStore(st))
+	alice := room.AddClient("alice")
+	room.AddClient("bob")
+
+	room.Broadcast(alice.ID, "alice", "hello there")
+	_, _, err := room.SendDirect(alice.ID, "bob", "secret hello")
+	require.NoError(t, err)
+
+	msgs, err := room.Search(context.Background(), "hello", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1, "direct messages are not stored")
+	require.Equal(t, KindChat, msgs[0].Kind)
+	require.Equal(t, "alice", msgs[0].SenderName)
+
+	msgs, err = room.Search(context.Background(), "joined", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	require.Equal(t, KindSystem, msgs[0].Kind)
+
+	_, err = NewRoom().Search(context.Background(), "x", 1, 0)
+	require.ErrorIs(t, err, errNoStore)
+}
+
+func TestSearchCommandPages(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithStore(store.NewMemory()), WithClock(func() time.Time { return now }))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	for i := 1; i <= searchPageSize+2; i++ {
+		room.Broadcast(sess.client.ID, "alice", fmt.Sprintf("build %d passed", i))
+	}
+
+	require.NoError(t, sess.runCommand("/search BUILD"))
+	require.Contains(t, out.String(), `results 1-10 for "BUILD" in #lobby`)
+	require.Contains(t, out.String(), "[2024-05-01 09:00:00] alice: build 12 passed")
+	require.Contains(t, out.String(), "/search next for more")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/search next"))
+	require.Contains(t, out.String(), "results 11-12")
+	require.Contains(t, out.String(), "build 1 passed")
+	require.NotContains(t, out.String(), "for more")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/search next"))
+	require.Contains(t, out.String(), "no search to continue")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/search nothing-matches"))
+	require.Contains(t, out.String(), "no messages in #lobby match")
+}
+
+func TestSearchCommandWithoutStore(t *testing.T) {
+	sess, out := newCommandTestSession(NewRoom(), ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/search hi"))
+	require.Contains(t, out.String(), errNoStore.Error())
+}
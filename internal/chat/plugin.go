@@ -0,0 +1,79 @@
+package chat
+
+// Plugin hooks into a room's traffic so features such as profanity filters,
+// link unfurling, or audit logging can be added without changing the room
+// itself. Plugins are registered with WithPlugins when rooms are built and
+// must be safe for concurrent use: hooks run on the goroutine of whoever
+// caused the event, never with the room locked, so they may call back into
+// the room. Embed NopPlugin to implement only the hooks you need.
+type Plugin interface {
+	// OnJoin is called after client enters room.
+	OnJoin(room *Room, client *Client)
+	// OnLeave is called after client leaves room, whether it disconnected or
+	// moved to another room.
+	OnLeave(room *Room, client *Client)
+	// OnMessage is called before a chat, action, or direct message is
+	// delivered. It returns the message to deliver, usually with only Body
+	// changed, or an error to suppress it; the sender is shown the error.
+	OnMessage(room *Room, msg Message) (Message, error)
+}
+
+// NopPlugin implements every Plugin hook as a no-op.
+type NopPlugin struct{}
+
+// OnJoin does nothing.
+func (NopPlugin) OnJoin(*Room, *Client) {}
+
+// OnLeave does nothing.
+func (NopPlugin) OnLeave(*Room, *Client) {}
+
+// OnMessage passes msg through unchanged.
+func (NopPlugin) OnMessage(_ *Room, msg Message) (Message, error) { return msg, nil }
+
+// MessageFilter adapts a function to a Plugin that only sees messages.
+type MessageFilter func(room *Room, msg Message) (Message, error)
+
+// OnJoin does nothing.
+func (MessageFilter) OnJoin(*Room, *Client) {}
+
+// OnLeave does nothing.
+func (MessageFilter) OnLeave(*Room, *Client) {}
+
+// OnMessage calls f.
+func (f MessageFilter) OnMessage(room *Room, msg Message) (Message, error) { return f(room, msg) }
+
+// WithPlugins adds plugins to the room. Message hooks run in the order given,
+// each seeing the previous one's result; the first error stops the chain.
+func WithPlugins(plugins ...Plugin) RoomOption {
+	return func(r *Room) {
+		for _, p := range plugins {
+			if p != nil {
+				r.plugins = append(r.plugins, p)
+			}
+		}
+	}
+}
+
+// filterMessage runs msg through the message hooks.
+func (r *Room) filterMessage(msg Message) (Message, error) {
+	for _, p := range r.plugins {
+		var err error
+		if msg, err = p.OnMessage(r, msg); err != nil {
+			r.logger.Debug("chat: message suppressed by plugin", "room", r.name, "username", msg.SenderName, "kind", msg.Kind, "err", err)
+			return Message{}, err
+		}
+	}
+	return msg, nil
+}
+
+func (r *Room) pluginsJoined(client *Client) {
+	for _, p := range r.plugins {
+		p.OnJoin(r, client)
+	}
+}
+
+func (r *Room) pluginsLeft(client *Client) {
+	for _, p := range r.plugins {
+		p.OnLeave(r, client)
+	}
+}
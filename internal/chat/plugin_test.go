@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// presenceLog records join and leave hooks.
+type presenceLog struct {
+	NopPlugin
+	mu     sync.Mutex
+	events []string
+}
+
+func (p *presenceLog) OnJoin(room *Room, client *Client) {
+	p.add("join " + client.Username + " #" + room.Name())
+}
+
+func (p *presenceLog) OnLeave(room *Room, client *Client) {
+	p.add("leave " + client.Username + " #" + room.Name())
+}
+
+func (p *presenceLog) add(event string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+}
+
+var errSpam = errors.New("looks like spam")
+
+// censor masks one word and suppresses messages that mention spam.
+var censor = MessageFilter(func(_ *Room, msg Message) (Message, error) {
+	if strings.Contains(msg.Body, "spam") {
+		return msg, errSpam
+	}
+	msg.Body = strings.ReplaceAll(msg.Body, "darn", "****")
+	return msg, nil
+})
+
+func TestPluginsFilterMessages(t *testing.T) {
+	shout := MessageFilter(func(_ *Room, msg Message) (Message, error) {
+		msg.Body = strings.ToUpper(msg.Body)
+		return msg, nil
+	})
+	room := NewRoom(WithPlugins(censor, nil, shout))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	drainChannel(alice.Send())
+	drainChannel(bob.Send())
+
+	msg, err := room.Broadcast(alice.ID, "alice", "darn it")
+	require.NoError(t, err)
+	require.Equal(t, "**** IT", msg.Body, "filters run in order")
+	require.Equal(t, "**** IT", (<-bob.Send()).Body)
+
+	_, err = room.Action(alice.ID, "alice", "sells spam")
+	require.ErrorIs(t, err, errSpam)
+	_, _, err = room.SendDirect(alice.ID, "bob", "spam offer")
+	require.ErrorIs(t, err, errSpam)
+	msg, _, err = room.SendDirect(alice.ID, "bob", "darn")
+	require.NoError(t, err)
+	require.Equal(t, "****", msg.Body)
+	require.Equal(t, "****", (<-bob.Send()).Body)
+	require.Empty(t, bob.Send(), "suppressed messages are never delivered")
+	require.Len(t, room.history.Recent(0), 3, "or recorded")
+}
+
+func TestPluginSuppressionIsShownToSender(t *testing.T) {
+	room := NewRoom(WithPlugins(censor))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	require.NoError(t, sess.broadcastLine("cheap spam"))
+	require.Contains(t, out.String(), "[system] message not sent: looks like spam")
+	require.NoError(t, sess.runCommand("/me spams"))
+	require.Contains(t, out.String(), "[system] message not sent: looks like spam")
+}
+
+func TestPluginsSeeJoinsAndLeaves(t *testing.T) {
+	log := &presenceLog{}
+	m := newTestManager(WithRoomOptions(WithPlugins(log)))
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+
+	alice := m.Lobby().AddClient("alice")
+	require.NoError(t, m.Move(alice, dev))
+	dev.RemoveClient(alice.ID)
+
+	require.Equal(t, []string{"join alice #lobby", "join alice #dev", "leave alice #lobby", "leave alice #dev"}, log.events)
+}
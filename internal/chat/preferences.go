@@ -0,0 +1,399 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// Keys of the per-user preferences kept in the store.
+const (
+	promptSetting     = "prompt"
+	statusBarSetting  = "status_bar"
+	colorSetting      = "color"
+	timestampsSetting = "timestamps"
+	bellSetting       = "bell"
+	// keySettingPrefix precedes an action name, e.g. "key.room": "ctrl+x".
+	keySettingPrefix = "key."
+)
+
+// maxPromptWidth bounds a custom prompt in display columns; the screen cuts it
+// further on narrow terminals.
+const maxPromptWidth = 16
+
+// preferences are a user's display choices, saved across sessions for
+// registered users.
+type preferences struct {
+	prompt    string
+	statusBar tui.StatusPosition
+	// color is the name the user is shown in, or "" for one the server picks.
+	color string
+	// timestamps is how messages show the time they were sent.
+	timestamps timestampMode
+	// bell rings the terminal bell when the user is mentioned.
+	bell bool
+	// ids shows the short message IDs /reply takes.
+	ids bool
+	// theme colors names and system lines; colors overrides the color depth
+	// detected from the terminal.
+	theme  *theme
+	colors colorDepth
+	// keys are the user's remapped actions, layered over the server's keymap.
+	keys map[keyAction][]tui.Key
+	// filters are the users the session ignores and the words it highlights.
+	filters *messageFilters
+}
+
+func defaultPreferences() preferences {
+	return preferences{prompt: tui.DefaultPrompt, statusBar: tui.StatusTop, bell: true, theme: defaultTheme(), filters: newMessageFilters()}
+}
+
+// settings returns the preferences that differ from the defaults.
+func (p preferences) settings() map[string]string {
+	settings := make(map[string]string)
+	if p.prompt != tui.DefaultPrompt {
+		settings[promptSetting] = p.prompt
+	}
+	if p.statusBar != tui.StatusTop {
+		settings[statusBarSetting] = p.statusBar.String()
+	}
+	if p.color != "" {
+		settings[colorSetting] = p.color
+	}
+	if p.timestamps != timestampsAbsolute {
+		settings[timestampsSetting] = p.timestamps.String()
+	}
+	if !p.bell {
+		settings[bellSetting] = formatSwitch(false)
+	}
+	if p.ids {
+		settings[idsSetting] = formatSwitch(true)
+	}
+	if p.theme != defaultTheme() {
+		settings[themeSetting] = p.theme.name
+	}
+	if p.colors != depthAuto {
+		settings[colorsSetting] = p.colors.String()
+	}
+	for action, keys := range p.keys {
+		settings[keySettingPrefix+string(action)] = formatKeys(keys)
+	}
+	p.filters.settings(settings)
+	return settings
+}
+
+// parsePrompt accepts a prompt as typed, optionally in double quotes so it can
+// end in a space: /prompt "❯ ".
+func parsePrompt(text string) (string, error) {
+	if len(text) >= 2 && strings.HasPrefix(text, `"`) && strings.HasSuffix(text, `"`) {
+		unquoted, err := strconv.Unquote(text)
+		if err != nil {
+			return "", fmt.Errorf("bad quoting in %s", text)
+		}
+		text = unquoted
+	}
+	return text, validatePrompt(text)
+}
+
+func validatePrompt(prompt string) error {
+	if stripControl(prompt) != prompt {
+		return errors.New("the prompt cannot contain control characters")
+	}
+	if tui.StringWidth(prompt) > maxPromptWidth {
+		return fmt.Errorf("the prompt can be at most %d columns wide", maxPromptWidth)
+	}
+	return nil
+}
+
+func parseStatusBar(name string) (tui.StatusPosition, error) {
+	switch strings.ToLower(name) {
+	case "top":
+		return tui.StatusTop, nil
+	case "bottom":
+		return tui.StatusBottom, nil
+	default:
+		return tui.StatusTop, fmt.Errorf("unknown position %q (want top or bottom)", name)
+	}
+}
+
+func parseColor(name string) (string, error) {
+	name = strings.ToLower(name)
+	if name == "auto" {
+		return "", nil
+	}
+	if colorCode(name) != "" {
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown color %q (want %s, or auto)", name, strings.Join(colorChoices(), ", "))
+}
+
+// colorChoices returns the color names users may pick, in palette order.
+func colorChoices() []string {
+	names := make([]string, 0, len(defaultColorPalette))
+	for _, code := range defaultColorPalette {
+		names = append(names, colorNames[code])
+	}
+	return names
+}
+
+func parseSwitch(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown value %q (want on or off)", value)
+	}
+}
+
+func formatSwitch(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// loadPreferences applies the preferences saved for a registered user. Guests
+// always start with the defaults, since anyone may take a guest name. It runs
+// before the user joins, so a saved color is what the room first sees.
+func (s *session) loadPreferences() {
+	st := s.room().store
+	if st == nil || s.info.AuthMethod == "" {
+		return
+	}
+	settings, err := st.UserSettings(context.Background(), s.info.Username)
+	if err != nil {
+		s.log.Error("chat: load preferences failed", "err", err)
+		return
+	}
+	if value, ok := settings[promptSetting]; ok {
+		if err := validatePrompt(value); err != nil {
+			s.log.Warn("chat: ignoring saved prompt", "err", err)
+		} else {
+			s.prefs.prompt = value
+		}
+	}
+	if value, ok := settings[statusBarSetting]; ok {
+		if pos, err := parseStatusBar(value); err != nil {
+			s.log.Warn("chat: ignoring saved status bar position", "err", err)
+		} else {
+			s.prefs.statusBar = pos
+		}
+	}
+	if value, ok := settings[colorSetting]; ok {
+		if color, err := parseColor(value); err != nil {
+			s.log.Warn("chat: ignoring saved color", "err", err)
+		} else {
+			s.prefs.color = color
+		}
+	}
+	if value, ok := settings[timestampsSetting]; ok {
+		if mode, err := parseTimestampMode(value); err != nil {
+			s.log.Warn("chat: ignoring saved timestamp mode", "err", err)
+		} else {
+			s.prefs.timestamps = mode
+		}
+	}
+	if value, ok := settings[bellSetting]; ok {
+		if on, err := parseSwitch(value); err != nil {
+			s.log.Warn("chat: ignoring saved bell preference", "err", err)
+		} else {
+			s.prefs.bell = on
+		}
+	}
+	if value, ok := settings[idsSetting]; ok {
+		if on, err := parseSwitch(value); err != nil {
+			s.log.Warn("chat: ignoring saved message ID preference", "err", err)
+		} else {
+			s.prefs.ids = on
+		}
+	}
+	if value, ok := settings[themeSetting]; ok {
+		if t, err := parseTheme(value); err != nil {
+			s.log.Warn("chat: ignoring saved theme", "err", err)
+		} else {
+			s.prefs.theme = t
+		}
+	}
+	if value, ok := settings[colorsSetting]; ok {
+		if depth, err := parseColorDepth(value); err != nil {
+			s.log.Warn("chat: ignoring saved color depth", "err", err)
+		} else {
+			s.prefs.colors = depth
+		}
+	}
+	s.prefs.filters.load(settings)
+	for key, value := range settings {
+		name, ok := strings.CutPrefix(key, keySettingPrefix)
+		if !ok {
+			continue
+		}
+		action, err := parseKeyAction(name)
+		if err == nil {
+			var keys []tui.Key
+			if keys, err = parseKeys(value); err == nil {
+				if s.prefs.keys == nil {
+					s.prefs.keys = make(map[keyAction][]tui.Key)
+				}
+				s.prefs.keys[action] = keys
+			}
+		}
+		if err != nil {
+			s.log.Warn("chat: ignoring saved key binding", "setting", key, "err", err)
+		}
+	}
+	s.ui.SetPrompt(s.prefs.prompt)
+	s.ui.SetStatusPosition(s.prefs.statusBar)
+	s.renderer.setOptions(s.prefs.timestamps, s.prefs.bell)
+	s.renderer.showIDs = s.prefs.ids
+	s.applyKeyPreferences()
+}
+
+// savePreferences persists the session's preferences and returns a note for
+// the user when they will not outlive the session.
+func (s *session) savePreferences() string {
+	st := s.room().store
+	if st == nil {
+		return " (this session only; the server does not save preferences)"
+	}
+	if !s.client.Registered() {
+		return " (this session only; sign in to keep preferences)"
+	}
+	if err := st.SaveUserSettings(context.Background(), s.client.Username, s.prefs.settings()); err != nil {
+		s.log.Error("chat: save preferences failed", "err", err)
+		return " (applies now but could not be saved)"
+	}
+	return ""
+}
+
+// runPrompt shows or changes the text before the input line.
+func runPrompt(s *session, args string) error {
+	switch {
+	case args == "":
+		return s.printSystem("your prompt is " + strconv.Quote(s.prefs.prompt))
+	case strings.EqualFold(args, "reset"):
+		s.prefs.prompt = tui.DefaultPrompt
+	default:
+		prompt, err := parsePrompt(args)
+		if err != nil {
+			return s.printSystem("/prompt: " + err.Error())
+		}
+		s.prefs.prompt = prompt
+	}
+	s.ui.SetPrompt(s.prefs.prompt)
+	return s.printSystem("prompt set to " + strconv.Quote(s.prefs.prompt) + s.savePreferences())
+}
+
+// runStatusBar shows or changes where the status bar is drawn.
+func runStatusBar(s *session, args string) error {
+	if args == "" {
+		return s.printSystem("the status bar is at the " + s.prefs.statusBar.String())
+	}
+	pos, err := parseStatusBar(args)
+	if err != nil {
+		return s.printSystem("/statusbar: " + err.Error())
+	}
+	s.prefs.statusBar = pos
+	s.ui.SetStatusPosition(pos)
+	return s.printSystem("status bar moved to the " + pos.String() + s.savePreferences())
+}
+
+// runSet lists the user's preferences or changes one:
+// /set [<name> [<value>]].
+func runSet(s *session, args string) error {
+	name, value, _ := strings.Cut(strings.TrimSpace(args), " ")
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(name) {
+	case "":
+		return s.printSystem(
+			"Your preferences:",
+			"  color       "+s.colorPreference(),
+			"  timestamps  "+s.prefs.timestamps.String(),
+			"  bell        "+formatSwitch(s.prefs.bell),
+			"  ids         "+formatSwitch(s.prefs.ids),
+			"  theme       "+s.prefs.theme.name,
+			"  colors      "+s.colorsPreference(),
+			"  prompt      "+strconv.Quote(s.prefs.prompt),
+			"  statusbar   "+s.prefs.statusBar.String(),
+		)
+	case "color", "colour":
+		return s.setColor(value)
+	case "timestamps":
+		return s.setTimestamps(value)
+	case "bell":
+		return s.setBell(value)
+	case "ids":
+		return s.setIDs(value)
+	case "theme":
+		return runTheme(s, value)
+	case "colors", "colours":
+		return runTheme(s, strings.TrimSpace("colors "+value))
+	case "prompt":
+		return runPrompt(s, value)
+	case "statusbar":
+		return runStatusBar(s, value)
+	default:
+		return s.printSystem(fmt.Sprintf("/set: unknown preference %q (want color, timestamps, bell, ids, theme, colors, prompt, or statusbar)", name))
+	}
+}
+
+func (s *session) colorPreference() string {
+	if s.prefs.color == "" {
+		return "auto (" + colorName(s.client.Color) + ")"
+	}
+	return s.prefs.color
+}
+
+// setColor saves the color the user is shown in. Other sessions read a
+// client's color without locking, so it changes from the next session.
+func (s *session) setColor(value string) error {
+	if value == "" {
+		return s.printSystem("your color is " + s.colorPreference())
+	}
+	color, err := parseColor(value)
+	if err != nil {
+		return s.printSystem("/set color: " + err.Error())
+	}
+	if s.room().store == nil || !s.client.Registered() {
+		return s.printSystem("/set color: colors can only be chosen by signed-in users on a server that saves preferences")
+	}
+	s.prefs.color = color
+	if note := s.savePreferences(); note != "" {
+		return s.printSystem("/set color: could not save your color")
+	}
+	if color == "" {
+		color = "auto"
+	}
+	return s.printSystem("color set to " + color + "; it applies from your next session")
+}
+
+func (s *session) setTimestamps(value string) error {
+	if value == "" {
+		return s.printSystem("timestamps: " + s.prefs.timestamps.String())
+	}
+	mode, err := parseTimestampMode(value)
+	if err != nil {
+		return s.printSystem("/set timestamps: " + err.Error())
+	}
+	s.prefs.timestamps = mode
+	s.renderer.setOptions(s.prefs.timestamps, s.prefs.bell)
+	return s.printSystem("timestamps set to " + mode.String() + s.savePreferences())
+}
+
+func (s *session) setBell(value string) error {
+	if value == "" {
+		return s.printSystem("bell: " + formatSwitch(s.prefs.bell))
+	}
+	on, err := parseSwitch(value)
+	if err != nil {
+		return s.printSystem("/set bell: " + err.Error())
+	}
+	s.prefs.bell = on
+	s.renderer.setOptions(s.prefs.timestamps, s.prefs.bell)
+	return s.printSystem("bell turned " + formatSwitch(on) + s.savePreferences())
+}
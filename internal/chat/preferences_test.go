@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+func TestParsePrompt(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "$", want: "$"},
+		{in: `"❯ "`, want: "❯ "},
+		{in: `""`, want: ""},
+		{in: `"a\tb"`, err: "the prompt cannot contain control characters"},
+		{in: `"unterminated\"`, err: `bad quoting in "unterminated\"`},
+		{in: "한국어한국어한국어>", err: "the prompt can be at most 16 columns wide"},
+	}
+	for _, tc := range cases {
+		got, err := parsePrompt(tc.in)
+		if tc.err != "" {
+			require.EqualError(t, err, tc.err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.want, got, tc.in)
+	}
+}
+
+func TestPreferencesPersistForRegisteredUsers(t *testing.T) {
+	st := store.NewMemory()
+	room := NewRoom(WithStore(st))
+
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	require.NoError(t, sess.runCommand(`/prompt "❯ "`))
+	require.Contains(t, out.String(), `prompt set to "❯ "`)
+	require.NoError(t, sess.runCommand("/statusbar bottom"))
+	require.Contains(t, out.String(), "status bar moved to the bottom")
+	require.NoError(t, sess.runCommand("/statusbar left"))
+	require.Contains(t, out.String(), `/statusbar: unknown position "left" (want top or bottom)`)
+
+	settings, err := st.UserSettings(context.Background(), "alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"prompt": "❯ ", "status_bar": "bottom"}, settings)
+
+	next, out := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	next.loadPreferences()
+	require.Equal(t, preferences{prompt: "❯ ", statusBar: tui.StatusBottom, bell: true, theme: defaultTheme(), filters: newMessageFilters()}, next.prefs)
+	require.NoError(t, next.runCommand("/prompt"))
+	require.Contains(t, out.String(), `your prompt is "❯ "`)
+	require.Contains(t, out.String(), "\r❯ ", "the prompt is drawn")
+
+	require.NoError(t, next.runCommand("/prompt reset"))
+	require.NoError(t, next.runCommand("/statusbar top"))
+	settings, err = st.UserSettings(context.Background(), "alice")
+	require.NoError(t, err)
+	require.Empty(t, settings, "defaults are not stored")
+}
+
+func TestPreferencesForGuests(t *testing.T) {
+	st := store.NewMemory()
+	room := NewRoom(WithStore(st))
+	require.NoError(t, st.SaveUserSettings(context.Background(), "guest", map[string]string{"prompt": "$ "}))
+
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "guest"})
+	sess.loadPreferences()
+	require.Equal(t, defaultPreferences(), sess.prefs, "a guest name does not pick up saved preferences")
+
+	require.NoError(t, sess.runCommand("/prompt %"))
+	require.Contains(t, out.String(), `prompt set to "%" (this session only; sign in to keep preferences)`)
+	settings, err := st.UserSettings(context.Background(), "guest")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"prompt": "$ "}, settings)
+}
+
+func TestSetCommand(t *testing.T) {
+	st := store.NewMemory()
+	room := NewRoom(WithStore(st), WithColorPicker(&staticColorPicker{color: "\033[31m"}))
+
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "password"})
+	require.NoError(t, sess.runCommand("/set"))
+	require.Contains(t, out.String(), "color       auto (red)")
+	require.Contains(t, out.String(), "timestamps  absolute")
+	require.Contains(t, out.String(), `prompt      "> "`)
+
+	require.NoError(t, sess.runCommand("/set color teal"))
+	require.Contains(t, out.String(), `/set color: unknown color "teal" (want red, green, yellow, blue, magenta, cyan, or auto)`)
+	require.NoError(t, sess.runCommand("/set color Cyan"))
+	require.Contains(t, out.String(), "color set to cyan; it applies from your next session")
+	require.NoError(t, sess.runCommand("/set timestamps sometimes"))
+	require.Contains(t, out.String(), `/set timestamps: unknown mode "sometimes" (want absolute, relative, hidden)`)
+	require.NoError(t, sess.runCommand("/set timestamps off"))
+	require.Contains(t, out.String(), "timestamps set to hidden")
+	require.NoError(t, sess.runCommand("/set bell maybe"))
+	require.Contains(t, out.String(), `/set bell: unknown value "maybe" (want on or off)`)
+	require.NoError(t, sess.runCommand("/set bell off"))
+	require.NoError(t, sess.runCommand("/set volume 11"))
+	require.Contains(t, out.String(), `/set: unknown preference "volume"`)
+	require.NoError(t, sess.runCommand("/set statusbar bottom"))
+	require.Contains(t, out.String(), "status bar moved to the bottom")
+
+	settings, err := st.UserSettings(context.Background(), "alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"color": "cyan", "timestamps": "hidden", "bell": "off", "status_bar": "bottom"}, settings)
+
+	next, _ := newSessionWithStoredPreferences(room, ClientInfo{Username: "alice", AuthMethod: "password"})
+	require.Equal(t, "\033[36m", next.client.Color, "the saved color is used from the start of the session")
+	require.Equal(t, "alice: hi @alice", next.renderer.Render(Message{Timestamp: time.Now(), SenderName: "alice", Body: "hi @alice"}))
+	line := next.renderer.Render(Message{Timestamp: time.Now(), SenderName: "bob", Body: "ping @alice"})
+	require.True(t, strings.HasPrefix(line, "bob: ping "), line)
+	require.NotContains(t, line, seqBell, "the bell is off")
+
+	require.NoError(t, next.runCommand("/set color auto"))
+	settings, err = st.UserSettings(context.Background(), "alice")
+	require.NoError(t, err)
+	require.NotContains(t, settings, "color")
+}
+
+func TestSetColorForGuests(t *testing.T) {
+	room := NewRoom(WithStore(store.NewMemory()))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "guest"})
+	require.NoError(t, sess.runCommand("/set color blue"))
+	require.Contains(t, out.String(), "colors can only be chosen by signed-in users")
+	require.NoError(t, sess.runCommand("/set timestamps off"))
+	require.Contains(t, out.String(), "timestamps set to hidden (this session only; sign in to keep preferences)")
+}
+
+// newSessionWithStoredPreferences sets up a session the way a connection
+// does, loading saved preferences before joining.
+func newSessionWithStoredPreferences(room *Room, info ClientInfo) (*session, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	sess := newSession(context.Background(), room, info, nil, nil)
+	sess.ui = tui.NewScreen(out)
+	sess.initClient()
+	return sess, out
+}
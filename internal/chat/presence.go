@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// autoAwayReason is shown for clients marked away by the idle checker.
+const autoAwayReason = "idle"
+
+// presenceCheckInterval is how often Run scans for idle clients.
+const presenceCheckInterval = 30 * time.Second
+
+// errNoSuchUser is returned when a command targets a username that is not online.
+var errNoSuchUser = errors.New("no such user")
+
+// Presence describes whether a client is at the keyboard.
+type Presence struct {
+	Away   bool
+	Reason string
+	Since  time.Time
+	// Auto marks presence set by the idle checker; activity clears it.
+	Auto bool
+}
+
+// Presence returns the client's current presence.
+func (c *Client) Presence() Presence {
+	c.presenceMu.Lock()
+	defer c.presenceMu.Unlock()
+	return c.presence
+}
+
+// setPresence replaces the presence and reports whether the away state changed.
+func (c *Client) setPresence(p Presence) bool {
+	c.presenceMu.Lock()
+	defer c.presenceMu.Unlock()
+
+	changed := c.presence.Away != p.Away || (p.Away && c.presence.Reason != p.Reason)
+	c.presence = p
+	return changed
+}
+
+// WithAutoAway marks clients away after they have been idle for d. Zero disables it.
+// The check runs from Room.Run.
+func WithAutoAway(d time.Duration) RoomOption {
+	return func(r *Room) {
+		if d >= 0 {
+			r.autoAway = d
+		}
+	}
+}
+
+// SetAway marks the client away with an optional reason and notifies the room.
+func (r *Room) SetAway(clientID, reason string) error {
+	return r.updatePresence(clientID, Presence{Away: true, Reason: reason, Since: r.now()})
+}
+
+// SetBack clears the client's away status and notifies the room.
+func (r *Room) SetBack(clientID string) error {
+	return r.updatePresence(clientID, Presence{Since: r.now()})
+}
+
+func (r *Room) updatePresence(clientID string, p Presence) error {
+	client, ok := r.client(clientID)
+	if !ok {
+		return errNoSuchUser
+	}
+	if !client.setPresence(p) {
+		return nil
+	}
+
+	vars := map[string]string{"user": client.Username, "reason": p.Reason}
+	switch {
+	case !p.Away:
+		r.announce(noticeBack, fmt.Sprintf("%s is back", client.Username), vars)
+	case p.Reason != "":
+		r.announce(noticeAway, fmt.Sprintf("%s is away: %s", client.Username, p.Reason), vars)
+	default:
+		r.announce(noticeAway, fmt.Sprintf("%s is away", client.Username), vars)
+	}
+	return nil
+}
+
+// touch records activity for the client, returning it from auto-away if needed.
+func (r *Room) touch(client *Client) {
+	client.markActive(r.now())
+	if p := client.Presence(); p.Away && p.Auto {
+		_ = r.SetBack(client.ID)
+	}
+}
+
+// Run performs periodic room maintenance such as auto-away until ctx is done.
+func (r *Room) Run(ctx context.Context) {
+	ticker := time.NewTicker(presenceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.markIdleAway()
+		}
+	}
+}
+
+// markIdleAway sets every client idle longer than the auto-away threshold away.
+func (r *Room) markIdleAway() {
+	r.mu.RLock()
+	threshold := r.autoAway
+	r.mu.RUnlock()
+	if threshold <= 0 {
+		return
+	}
+
+	now := r.now()
+	for _, client := range r.Clients() {
+		if client.Presence().Away || now.Sub(client.LastActive()) < threshold {
+			continue
+		}
+		_ = r.updatePresence(client.ID, Presence{Away: true, Reason: autoAwayReason, Since: now, Auto: true})
+	}
+}
@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresenceAwayAndBackNotifyRoom(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	drainChannel(bob.Send())
+
+	require.NoError(t, room.SetAway(alice.ID, "lunch"))
+	require.True(t, alice.Presence().Away)
+	require.Equal(t, "alice is away: lunch", (<-bob.Send()).Body)
+
+	require.NoError(t, room.SetAway(alice.ID, "lunch"), "repeating the same status is a no-op")
+	require.NoError(t, room.SetBack(alice.ID))
+	require.Equal(t, "alice is back", (<-bob.Send()).Body)
+
+	require.ErrorIs(t, room.SetAway("missing", ""), errNoSuchUser)
+}
+
+func TestAutoAwayAndReturnOnActivity(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	room := NewRoom(
+		WithColorPicker(&staticColorPicker{}),
+		WithClock(func() time.Time { return now }),
+		WithAutoAway(10*time.Minute),
+	)
+	alice := room.AddClient("alice")
+
+	now = now.Add(5 * time.Minute)
+	room.markIdleAway()
+	require.False(t, alice.Presence().Away)
+
+	now = now.Add(10 * time.Minute)
+	room.markIdleAway()
+	require.Equal(t, Presence{Away: true, Reason: autoAwayReason, Since: now, Auto: true}, alice.Presence())
+
+	room.touch(alice)
+	require.False(t, alice.Presence().Away)
+}
+
+func TestAwayCommandsFromAutoAway(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	room := NewRoom(
+		WithColorPicker(&staticColorPicker{}),
+		WithClock(func() time.Time { return now }),
+		WithAutoAway(10*time.Minute),
+	)
+	bob := room.AddClient("bob")
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	now = now.Add(15 * time.Minute)
+	room.markIdleAway()
+	drainChannel(bob.Send())
+	require.NoError(t, sess.submitText("/back"))
+	require.NotContains(t, out.String(), "you are not away")
+	require.Equal(t, "alice is back", (<-bob.Send()).Body)
+	require.False(t, sess.client.Presence().Away)
+
+	now = now.Add(15 * time.Minute)
+	room.markIdleAway()
+	drainChannel(bob.Send())
+	require.NoError(t, sess.submitText("/away lunch"))
+	require.Equal(t, "alice is away: lunch", (<-bob.Send()).Body, "no \"is back\" first")
+	require.Equal(t, Presence{Away: true, Reason: "lunch", Since: now}, sess.client.Presence())
+}
+
+func TestSendDirectReachesOnlyRecipient(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	carol := room.AddClient("carol")
+	for _, c := range []*Client{alice, bob, carol} {
+		drainChannel(c.Send())
+	}
+
+	msg, recipient, err := room.SendDirect(alice.ID, "bob", "psst")
+	require.NoError(t, err)
+	require.Equal(t, bob, recipient)
+	require.Equal(t, KindDirect, msg.Kind)
+	require.Equal(t, msg, <-bob.Send())
+	require.Empty(t, carol.Send())
+
+	_, _, err = room.SendDirect(alice.ID, "dave", "hi")
+	require.ErrorIs(t, err, errNoSuchUser)
+}
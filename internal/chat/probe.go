@@ -0,0 +1,282 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+// defaultProbeTimeout bounds each probe when ProbePolicy leaves it unset.
+const defaultProbeTimeout = 5 * time.Second
+
+// probeUsername names the virtual clients of room probes.
+const probeUsername = "probe"
+
+var errProbeTimeout = errors.New("no delivery before the timeout")
+
+// ProbePolicy configures the canary probes RoomManager.Run sends through the
+// delivery pipeline. A zero Interval disables them.
+type ProbePolicy struct {
+	Interval time.Duration
+	// Timeout is how long a probe may take before it counts as failed.
+	Timeout time.Duration
+}
+
+// ProbeStatus is the health of one probe target: a room ("room:#dev"), a
+// cluster peer ("cluster:b"), or a bridge ("bridge:irc").
+type ProbeStatus struct {
+	Target string `json:"target"`
+	OK     bool   `json:"ok"`
+	// Latency is how long the last successful probe took.
+	Latency   time.Duration `json:"latency_ns"`
+	Sent      int64         `json:"sent"`
+	Failed    int64         `json:"failed"`
+	LastError string        `json:"last_error,omitempty"`
+	At        time.Time     `json:"at"`
+}
+
+// prober records probe results and notices when targets start or stop
+// failing.
+type prober struct {
+	policy ProbePolicy
+	seq    atomic.Uint64
+
+	mu     sync.Mutex
+	status map[string]*ProbeStatus
+}
+
+// WithProbes sends a canary message through every room's relay, and queries
+// every cluster peer, each interval. Failures and recoveries are logged and
+// shown to online operators; results are available from ProbeStatus.
+func WithProbes(policy ProbePolicy) ManagerOption {
+	return func(m *RoomManager) {
+		if policy.Interval <= 0 {
+			return
+		}
+		if policy.Timeout <= 0 {
+			policy.Timeout = defaultProbeTimeout
+		}
+		m.prober = &prober{policy: policy, status: make(map[string]*ProbeStatus)}
+	}
+}
+
+// record stores a probe result and reports whether the target changed between
+// healthy and failing. A target failing on its first probe counts as a change.
+func (p *prober) record(target string, latency time.Duration, err error, at time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st, seen := p.status[target]
+	if !seen {
+		st = &ProbeStatus{Target: target}
+		p.status[target] = st
+	}
+	wasOK := st.OK
+	st.Sent++
+	st.At = at
+	if err != nil {
+		st.OK = false
+		st.Failed++
+		st.LastError = err.Error()
+		return wasOK || !seen
+	}
+	st.OK, st.Latency, st.LastError = true, latency, ""
+	return !wasOK && seen
+}
+
+// forget drops targets that were not probed in the last round, e.g. deleted
+// rooms and removed bridges.
+func (p *prober) forget(keep map[string]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for target := range p.status {
+		if !keep[target] {
+			delete(p.status, target)
+		}
+	}
+}
+
+func (p *prober) snapshot() []ProbeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]ProbeStatus, 0, len(p.status))
+	for _, st := range p.status {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out
+}
+
+// ProbeStatus returns the latest result for every probe target, ordered by
+// target, or nil when probes are disabled.
+func (m *RoomManager) ProbeStatus() []ProbeStatus {
+	if m.prober == nil {
+		return nil
+	}
+	return m.prober.snapshot()
+}
+
+// probeLoop probes every target each interval until ctx is cancelled. The
+// first round waits an interval so bridges have time to connect.
+func (m *RoomManager) probeLoop(ctx context.Context) {
+	ticker := time.NewTicker(m.prober.policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.probe(ctx)
+		}
+	}
+}
+
+// probeResult is the outcome of probing one target.
+type probeResult struct {
+	target  string
+	latency time.Duration
+	err     error
+}
+
+// probe runs one round of probes concurrently and records the results.
+func (m *RoomManager) probe(ctx context.Context) {
+	timeout := m.prober.policy.Timeout
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []probeResult
+	)
+	run := func(target string, fn func() (time.Duration, error)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency, err := fn()
+			mu.Lock()
+			results = append(results, probeResult{target, latency, err})
+			mu.Unlock()
+		}()
+	}
+	for _, room := range m.Rooms() {
+		room := room
+		run("room:#"+room.Name(), func() (time.Duration, error) {
+			return room.probe(m.prober.seq.Add(1), timeout)
+		})
+	}
+	node := m.lobby.cluster
+	for _, peer := range node.Peers() {
+		id := peer.ID
+		run("cluster:"+id, func() (time.Duration, error) {
+			return node.Ping(ctx, id)
+		})
+	}
+	wg.Wait()
+	// Bridges talk to other networks, where a canary would be seen by real
+	// people, so they are judged by their connection state instead.
+	for _, st := range m.lobby.bridges.Status() {
+		var err error
+		if st.State != bridge.StateConnected {
+			err = fmt.Errorf("bridge is %s", st.State)
+			if st.LastError != "" {
+				err = fmt.Errorf("%w: %s", err, st.LastError)
+			}
+		}
+		results = append(results, probeResult{target: "bridge:" + st.Name, err: err})
+	}
+
+	now := m.lobby.now()
+	keep := make(map[string]bool, len(results))
+	sort.Slice(results, func(i, j int) bool { return results[i].target < results[j].target })
+	for _, res := range results {
+		keep[res.target] = true
+		if !m.prober.record(res.target, res.latency, res.err, now) {
+			continue
+		}
+		if res.err != nil {
+			m.lobby.logger.Warn("chat: probe failed", "target", res.target, "error", res.err)
+			m.alertOperators(fmt.Sprintf("probe: %s is failing: %v", res.target, res.err))
+		} else {
+			m.lobby.logger.Info("chat: probe recovered", "target", res.target, "latency", res.latency)
+			m.alertOperators(fmt.Sprintf("probe: %s recovered (%s)", res.target, res.latency.Round(time.Millisecond)))
+		}
+	}
+	m.prober.forget(keep)
+}
+
+// probe delivers a canary message to a virtual client that is not a member of
+// the room, through the same lock, backpressure policy, and relay workers as
+// real messages, and measures how long it takes to reach the client's handler.
+func (r *Room) probe(seq uint64, timeout time.Duration) (time.Duration, error) {
+	id := fmt.Sprintf("probe-%d", seq)
+	client := newClientWithQueue(id, probeUsername, "", 1)
+	body := fmt.Sprintf("probe %d", seq)
+	delivered := make(chan struct{}, 1)
+	r.relay.attach(client, func(msg Message) error {
+		if msg.Body == body {
+			delivered <- struct{}{}
+		}
+		return nil
+	})
+	// A probe that timed out may still be queued behind a stuck worker, which
+	// drops the client once it gets to it.
+	defer client.closeSend()
+
+	start := time.Now()
+	r.mu.RLock()
+	client.deliver(Message{Timestamp: r.now(), Body: body, Kind: KindSystem}, r.backpressure, r.backpressureTimeout)
+	r.mu.RUnlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-delivered:
+		return time.Since(start), nil
+	case <-timer.C:
+		return 0, errProbeTimeout
+	}
+}
+
+// alertOperators shows a system message to every online operator.
+func (m *RoomManager) alertOperators(text string) {
+	for _, room := range m.Rooms() {
+		msg := Message{Timestamp: room.now(), Body: text, Kind: KindSystem}
+		room.mu.RLock()
+		for _, client := range room.clients {
+			if client.Operator {
+				client.deliver(msg, room.backpressure, room.backpressureTimeout)
+			}
+		}
+		room.mu.RUnlock()
+	}
+}
+
+// runProbes shows the latest probe results: /probes.
+func runProbes(s *session, _ string) error {
+	manager := s.room().manager
+	if manager == nil {
+		return s.printSystem("/probes: " + errRoomsDisabled.Error())
+	}
+	if manager.prober == nil {
+		return s.printSystem("delivery probes are disabled on this server")
+	}
+	list := manager.ProbeStatus()
+	if len(list) == 0 {
+		return s.printSystem("delivery probes have not run yet")
+	}
+	lines := []string{"Delivery probes:"}
+	for _, st := range list {
+		state := "ok " + st.Latency.Round(time.Microsecond).String()
+		if !st.OK {
+			state = "FAILING: " + st.LastError
+		}
+		lines = append(lines, fmt.Sprintf("  %-20s %s (%d/%d failed)", st.Target, state, st.Failed, st.Sent))
+	}
+	return s.printSystem(lines...)
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+func TestProbeRoomsAndAlertOperators(t *testing.T) {
+	m := newTestManager(
+		WithRoomOptions(WithRelayWorkers(1)),
+		WithProbes(ProbePolicy{Interval: time.Minute, Timeout: 50 * time.Millisecond}),
+	)
+	_, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	op := m.Lobby().Join(ClientInfo{Username: "root", Operator: true})
+	bob := m.Lobby().AddClient("bob")
+	drainChannel(op.Send())
+	drainChannel(bob.Send())
+
+	m.probe(context.Background())
+	status := m.ProbeStatus()
+	require.Len(t, status, 2)
+	for _, st := range status {
+		require.True(t, st.OK, st.Target)
+		require.EqualValues(t, 1, st.Sent)
+	}
+	require.Equal(t, "room:#dev", status[0].Target)
+	require.Empty(t, op.Send(), "healthy probes are silent")
+
+	// Wedge the only relay worker behind a session that never finishes writing.
+	release := make(chan struct{})
+	stuck := newClient("stuck", "stuck", "")
+	m.relay.attach(stuck, func(Message) error {
+		<-release
+		return nil
+	})
+	stuck.tryDeliver(Message{Body: "hello"})
+
+	m.probe(context.Background())
+	for _, st := range m.ProbeStatus() {
+		require.False(t, st.OK, st.Target)
+		require.Equal(t, errProbeTimeout.Error(), st.LastError)
+	}
+	require.Equal(t, "probe: room:#dev is failing: no delivery before the timeout", (<-op.Send()).Body)
+	require.Equal(t, "probe: room:#lobby is failing: no delivery before the timeout", (<-op.Send()).Body)
+	require.Empty(t, bob.Send(), "only operators are alerted")
+
+	m.probe(context.Background())
+	require.Empty(t, op.Send(), "failing targets alert once")
+
+	close(release)
+	require.Eventually(t, func() bool {
+		m.probe(context.Background())
+		return m.ProbeStatus()[1].OK
+	}, time.Second, 10*time.Millisecond)
+	require.Contains(t, (<-op.Send()).Body, "probe: room:#dev recovered")
+}
+
+func TestProbeBridges(t *testing.T) {
+	sup := bridge.NewSupervisor()
+	require.NoError(t, sup.Add(&recordingRelay{name: "irc"}))
+	m := newTestManager(
+		WithRoomOptions(WithBridges(sup)),
+		WithProbes(ProbePolicy{Interval: time.Minute}),
+	)
+
+	m.probe(context.Background())
+	status := m.ProbeStatus()
+	require.Len(t, status, 2)
+	require.Equal(t, "bridge:irc", status[0].Target)
+	require.False(t, status[0].OK)
+	require.Equal(t, "bridge is stopped", status[0].LastError)
+	require.True(t, status[1].OK)
+}
+
+func TestProbesCommand(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "root", Operator: true})
+	require.NoError(t, sess.runCommand("/probes"))
+	require.Contains(t, out.String(), "/probes: "+errRoomsDisabled.Error())
+
+	m := newTestManager(WithProbes(ProbePolicy{Interval: time.Minute}))
+	sess, out = newCommandTestSession(m.Lobby(), ClientInfo{Username: "root", Operator: true})
+	require.NoError(t, sess.runCommand("/probes"))
+	require.Contains(t, out.String(), "delivery probes have not run yet")
+
+	m.probe(context.Background())
+	require.NoError(t, sess.runCommand("/probes"))
+	require.Contains(t, out.String(), "Delivery probes:")
+	require.Regexp(t, `room:#lobby\s+ok \S+ \(0/1 failed\)`, out.String())
+
+	m = newTestManager()
+	sess, out = newCommandTestSession(m.Lobby(), ClientInfo{Username: "root", Operator: true})
+	require.NoError(t, sess.runCommand("/probes"))
+	require.Contains(t, out.String(), "delivery probes are disabled")
+	require.Nil(t, m.ProbeStatus())
+}
@@ -0,0 +1,242 @@
+package chat
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/webhook"
+)
+
+// PromptSystem is an external system allowed to post prompts, e.g. a deploy
+// pipeline asking "Deploy 1.2.3? reply /approve 42".
+type PromptSystem struct {
+	Name string
+	// Rooms are the rooms it may prompt.
+	Rooms []string
+	// Approvers may answer its prompts, and only when signed in with a
+	// credential; empty lets anyone in the room answer.
+	Approvers []string
+	// Replies delivers the answers to the system's callback.
+	Replies *webhook.Dispatcher
+}
+
+func (p PromptSystem) allows(room string) bool {
+	for _, r := range p.Rooms {
+		if normalizeRoomName(r) == room {
+			return true
+		}
+	}
+	return false
+}
+
+func (p PromptSystem) mayAnswer(client *Client) bool {
+	if len(p.Approvers) == 0 {
+		return true
+	}
+	if !client.Registered() {
+		return false
+	}
+	for _, name := range p.Approvers {
+		if name == client.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// openPrompt is a prompt waiting for an answer.
+type openPrompt struct {
+	webhook.Prompt
+	ID      int64
+	Expires time.Time
+}
+
+// prompts tracks the open prompts of a RoomManager.
+type prompts struct {
+	systems map[string]PromptSystem
+
+	mu     sync.Mutex
+	lastID int64
+	open   map[int64]*openPrompt
+}
+
+// WithPrompts lets systems post prompts through the webhook endpoint that
+// users answer with /approve and /deny.
+func WithPrompts(systems ...PromptSystem) ManagerOption {
+	return func(m *RoomManager) {
+		if len(systems) == 0 {
+			return
+		}
+		m.prompts = &prompts{systems: make(map[string]PromptSystem), open: make(map[int64]*openPrompt)}
+		for _, sys := range systems {
+			m.prompts.systems[sys.Name] = sys
+		}
+	}
+}
+
+// take removes and returns prompt id.
+func (p *prompts) take(id int64) (*openPrompt, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prompt, ok := p.open[id]
+	delete(p.open, id)
+	return prompt, ok
+}
+
+// PostPrompt posts a prompt received on the webhook endpoint into its room
+// and tracks it until it is answered or expires.
+func (m *RoomManager) PostPrompt(p webhook.Prompt) (webhook.PromptReceipt, error) {
+	if m.prompts == nil {
+		return webhook.PromptReceipt{}, webhook.ErrUnknownSystem
+	}
+	sys, ok := m.prompts.systems[p.System]
+	if !ok || !sys.allows(normalizeRoomName(p.Room)) {
+		return webhook.PromptReceipt{}, webhook.ErrUnknownSystem
+	}
+	room, ok := m.Room(p.Room)
+	if !ok {
+		return webhook.PromptReceipt{}, fmt.Errorf("%w: %s", webhook.ErrUnknownRoom, p.Room)
+	}
+
+	m.prompts.mu.Lock()
+	m.prompts.lastID++
+	prompt := &openPrompt{Prompt: p, ID: m.prompts.lastID, Expires: room.now().Add(p.Lifetime())}
+	prompt.Room = room.Name()
+	m.prompts.open[prompt.ID] = prompt
+	m.prompts.mu.Unlock()
+
+	for _, line := range strings.Split(p.Text, "\n") {
+		if line = strings.TrimSpace(stripControl(line)); line != "" {
+			if _, err := room.Broadcast("", p.User, line); err != nil {
+				m.prompts.take(prompt.ID)
+				return webhook.PromptReceipt{}, err
+			}
+		}
+	}
+	room.broadcastSystem(fmt.Sprintf("reply /approve %d or /deny %d (expires in %s)", prompt.ID, prompt.ID, p.Lifetime()))
+	m.lobby.logger.Info("chat: prompt posted", "id", prompt.ID, "system", p.System, "room", prompt.Room, "ref", p.Ref)
+	return webhook.PromptReceipt{ID: prompt.ID, Expires: prompt.Expires}, nil
+}
+
+// expirePrompts closes the prompts whose time is up and tells their systems.
+func (m *RoomManager) expirePrompts(now time.Time) {
+	if m.prompts == nil {
+		return
+	}
+	m.prompts.mu.Lock()
+	var expired []*openPrompt
+	for id, prompt := range m.prompts.open {
+		if !now.Before(prompt.Expires) {
+			expired = append(expired, prompt)
+			delete(m.prompts.open, id)
+		}
+	}
+	m.prompts.mu.Unlock()
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ID < expired[j].ID })
+	for _, prompt := range expired {
+		m.closePrompt(prompt, webhook.Reply{Decision: webhook.DecisionExpired, Time: now})
+		if room, ok := m.Room(prompt.Room); ok {
+			room.broadcastSystem(fmt.Sprintf("prompt #%d from %s expired without an answer", prompt.ID, prompt.System))
+		}
+	}
+}
+
+// closePrompt sends the system its reply and records the decision in the log.
+func (m *RoomManager) closePrompt(prompt *openPrompt, reply webhook.Reply) {
+	reply.ID, reply.Ref, reply.System, reply.Room = prompt.ID, prompt.Ref, prompt.System, prompt.Room
+	m.prompts.systems[prompt.System].Replies.SendReply(reply)
+	m.lobby.logger.Info("chat: prompt closed", "audit", true, "id", prompt.ID, "system", prompt.System, "room", prompt.Room,
+		"ref", prompt.Ref, "decision", reply.Decision, "user", reply.User, "auth_method", reply.AuthMethod, "comment", reply.Comment)
+}
+
+// runApprove answers a prompt: /approve <id> [comment].
+func runApprove(s *session, args string) error {
+	return s.answerPrompt("approve", webhook.DecisionApprove, "approved", args)
+}
+
+// runDeny answers a prompt: /deny <id> [comment].
+func runDeny(s *session, args string) error {
+	return s.answerPrompt("deny", webhook.DecisionDeny, "denied", args)
+}
+
+func (s *session) answerPrompt(command, decision, verb, args string) error {
+	room := s.room()
+	manager := room.manager
+	if manager == nil || manager.prompts == nil {
+		return s.printSystem("no systems may post prompts on this server")
+	}
+	idText, comment, _ := strings.Cut(strings.TrimSpace(args), " ")
+	id, err := strconv.ParseInt(strings.TrimPrefix(idText, "#"), 10, 64)
+	if err != nil {
+		return s.printSystem(fmt.Sprintf("usage: /%s <id> [comment]", command))
+	}
+	comment = strings.TrimSpace(stripControl(comment))
+
+	p := manager.prompts
+	p.mu.Lock()
+	prompt, ok := p.open[id]
+	var problem string
+	switch {
+	case !ok:
+		problem = fmt.Sprintf("/%s: there is no open prompt #%d", command, id)
+	case prompt.Room != room.Name():
+		problem = fmt.Sprintf("/%s: prompt #%d was posted in #%s; answer it there", command, id, prompt.Room)
+	case !p.systems[prompt.System].mayAnswer(s.client):
+		problem = fmt.Sprintf("/%s: only %s may answer prompts from %s", command, strings.Join(p.systems[prompt.System].Approvers, ", "), prompt.System)
+	default:
+		delete(p.open, id)
+	}
+	p.mu.Unlock()
+	if problem != "" {
+		return s.printSystem(problem)
+	}
+
+	manager.closePrompt(prompt, webhook.Reply{
+		Decision:   decision,
+		User:       s.client.Username,
+		AuthMethod: s.client.AuthMethod,
+		Comment:    comment,
+		Time:       room.now(),
+	})
+	text := fmt.Sprintf("%s %s prompt #%d from %s", s.client.Username, verb, id, prompt.System)
+	if comment != "" {
+		text += ": " + comment
+	}
+	room.broadcastSystem(text)
+	return nil
+}
+
+// runPrompts lists the open prompts in the current room: /prompts.
+func runPrompts(s *session, _ string) error {
+	room := s.room()
+	manager := room.manager
+	if manager == nil || manager.prompts == nil {
+		return s.printSystem("no systems may post prompts on this server")
+	}
+	p := manager.prompts
+	p.mu.Lock()
+	var list []openPrompt
+	for _, prompt := range p.open {
+		if prompt.Room == room.Name() {
+			list = append(list, *prompt)
+		}
+	}
+	p.mu.Unlock()
+	if len(list) == 0 {
+		return s.printSystem(fmt.Sprintf("no open prompts in #%s", room.Name()))
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	now := room.now()
+	lines := []string{fmt.Sprintf("Open prompts in #%s:", room.Name())}
+	for _, prompt := range list {
+		first, _, _ := strings.Cut(prompt.Text, "\n")
+		lines = append(lines, fmt.Sprintf("  #%d %s: %s (expires in %s)", prompt.ID, prompt.System, first, prompt.Expires.Sub(now).Round(time.Second)))
+	}
+	return s.printSystem(lines...)
+}
@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/webhook"
+)
+
+// replyRecorder collects the replies a prompt system receives.
+type replyRecorder struct {
+	mu      sync.Mutex
+	replies []webhook.Reply
+}
+
+func newReplyRecorder(t *testing.T) (*replyRecorder, *webhook.Dispatcher) {
+	t.Helper()
+	rec := &replyRecorder{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reply webhook.Reply
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&reply))
+		rec.mu.Lock()
+		rec.replies = append(rec.replies, reply)
+		rec.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	d := webhook.NewDispatcher("s3cret", []string{srv.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go d.Run(ctx)
+	return rec, d
+}
+
+func (r *replyRecorder) wait(t *testing.T, n int) []webhook.Reply {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.replies) >= n
+	}, 5*time.Second, 5*time.Millisecond)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]webhook.Reply(nil), r.replies...)
+}
+
+func TestPromptApproval(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	rec, replies := newReplyRecorder(t)
+	m := newTestManager(
+		WithRoomOptions(WithClock(func() time.Time { return now })),
+		WithPrompts(PromptSystem{Name: "deploy", Rooms: []string{"#ops"}, Approvers: []string{"alice"}, Replies: replies}),
+	)
+	ops, err := m.Create("ops", "")
+	require.NoError(t, err)
+
+	_, err = m.PostPrompt(webhook.Prompt{System: "deploy", Room: "lobby", User: "deploy", Text: "Deploy?"})
+	require.ErrorIs(t, err, webhook.ErrUnknownSystem, "the system may not prompt the lobby")
+	_, err = m.PostPrompt(webhook.Prompt{System: "ci", Room: "ops", User: "ci", Text: "Deploy?"})
+	require.ErrorIs(t, err, webhook.ErrUnknownSystem)
+
+	bob, bobOut := newCommandTestSession(ops, ClientInfo{Username: "bob", AuthMethod: "password"})
+	guest, guestOut := newCommandTestSession(ops, ClientInfo{Username: "alice"})
+	alice, aliceOut := newCommandTestSession(ops, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	watcher := ops.AddClient("carol")
+	drainChannel(watcher.Send())
+
+	receipt, err := m.PostPrompt(webhook.Prompt{System: "deploy", Room: "#ops", User: "deploy", Text: "Deploy 1.2.3\nto production?", Ref: "run-7", TTL: "10m"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), receipt.ID)
+	require.Equal(t, now.Add(10*time.Minute), receipt.Expires)
+	require.Equal(t, "Deploy 1.2.3", (<-watcher.Send()).Body)
+	require.Equal(t, "to production?", (<-watcher.Send()).Body)
+	require.Equal(t, "reply /approve 1 or /deny 1 (expires in 10m0s)", (<-watcher.Send()).Body)
+
+	require.NoError(t, bob.runCommand("/prompts"))
+	require.Contains(t, bobOut.String(), "#1 deploy: Deploy 1.2.3 (expires in 10m0s)")
+	require.NoError(t, bob.runCommand("/approve 1"))
+	require.Contains(t, bobOut.String(), "/approve: only alice may answer prompts from deploy")
+	require.NoError(t, guest.runCommand("/approve 1"))
+	require.Contains(t, guestOut.String(), "only alice may answer", "approvers must sign in with a credential")
+	require.NoError(t, alice.runCommand("/approve x"))
+	require.Contains(t, aliceOut.String(), "usage: /approve <id> [comment]")
+
+	require.NoError(t, alice.runCommand("/approve #1 ship it"))
+	require.Equal(t, "alice approved prompt #1 from deploy: ship it", (<-watcher.Send()).Body)
+	require.NoError(t, alice.runCommand("/deny 1"))
+	require.Contains(t, aliceOut.String(), "/deny: there is no open prompt #1", "the first answer wins")
+
+	got := rec.wait(t, 1)
+	require.Equal(t, webhook.Reply{
+		V:          webhook.Version,
+		ID:         1,
+		Ref:        "run-7",
+		System:     "deploy",
+		Room:       "ops",
+		Decision:   webhook.DecisionApprove,
+		User:       "alice",
+		AuthMethod: "publickey",
+		Comment:    "ship it",
+		Time:       now,
+	}, got[0])
+}
+
+func TestPromptAnsweredInItsRoomAndExpires(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	rec, replies := newReplyRecorder(t)
+	m := newTestManager(
+		WithRoomOptions(WithClock(func() time.Time { return now })),
+		WithPrompts(PromptSystem{Name: "deploy", Rooms: []string{"ops"}, Replies: replies}),
+	)
+	ops, err := m.Create("ops", "")
+	require.NoError(t, err)
+	watcher := ops.AddClient("carol")
+	drainChannel(watcher.Send())
+
+	first, err := m.PostPrompt(webhook.Prompt{System: "deploy", Room: "ops", User: "deploy", Text: "Deploy?", TTL: "1m"})
+	require.NoError(t, err)
+	second, err := m.PostPrompt(webhook.Prompt{System: "deploy", Room: "ops", User: "deploy", Text: "Roll back?", TTL: "1h"})
+	require.NoError(t, err)
+	drainChannel(watcher.Send())
+
+	lobby, lobbyOut := newCommandTestSession(m.Lobby(), ClientInfo{Username: "bob"})
+	require.NoError(t, lobby.runCommand("/deny 1"))
+	require.Contains(t, lobbyOut.String(), "prompt #1 was posted in #ops; answer it there")
+
+	m.expirePrompts(now.Add(30 * time.Second))
+	require.Empty(t, watcher.Send())
+	m.expirePrompts(now.Add(time.Minute))
+	require.Equal(t, "prompt #1 from deploy expired without an answer", (<-watcher.Send()).Body)
+
+	bob, _ := newCommandTestSession(ops, ClientInfo{Username: "bob"})
+	drainChannel(watcher.Send())
+	require.NoError(t, bob.runCommand("/deny 2 not now"))
+	require.Equal(t, "bob denied prompt #2 from deploy: not now", (<-watcher.Send()).Body)
+
+	got := rec.wait(t, 2)
+	require.Equal(t, first.ID, got[0].ID)
+	require.Equal(t, webhook.DecisionExpired, got[0].Decision)
+	require.Empty(t, got[0].User)
+	require.Equal(t, second.ID, got[1].ID)
+	require.Equal(t, webhook.DecisionDeny, got[1].Decision)
+}
+
+func TestPromptsDisabled(t *testing.T) {
+	m := newTestManager()
+	_, err := m.PostPrompt(webhook.Prompt{System: "deploy", Room: "lobby", User: "deploy", Text: "Deploy?"})
+	require.ErrorIs(t, err, webhook.ErrUnknownSystem)
+
+	sess, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/approve 1"))
+	require.Contains(t, out.String(), "no systems may post prompts on this server")
+}
@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// quitInput handles the quit key and reports whether the session should end.
+// With unsent text in the input line it asks what to do with it first.
+func (s *session) quitInput(key tui.Key) (bool, error) {
+	if strings.TrimSpace(s.buffer.Snapshot()) == "" {
+		return true, s.handleControl(key.Label())
+	}
+	s.quitKey = key
+	return false, s.printSystem("you have unsent text: press s or Enter to send it and quit, d or " +
+		keyTitle(key) + " to discard it and quit, or c to keep editing")
+}
+
+// answerQuit reads the answer to quitInput's question. Keys that are not an
+// answer are ignored.
+func (s *session) answerQuit(ev tui.Event) (bool, error) {
+	key := s.quitKey
+	var action keyAction
+	if ev.Kind == tui.EventControl {
+		action, _ = s.keys.lookup(tui.Key(ev.Rune))
+	}
+	r := unicode.ToLower(ev.Rune)
+	if ev.Kind != tui.EventRune {
+		r = 0
+	}
+	switch {
+	case r == 's' || ev.Kind == tui.EventEnter:
+		s.quitKey = 0
+		if err := s.submitLine(); err != nil {
+			return false, err
+		}
+		return true, s.handleControl(key.Label())
+	case r == 'd' || action == keyQuit:
+		s.quitKey = 0
+		return true, s.handleControl(key.Label())
+	case r == 'c' || action == keyCancel:
+		s.quitKey = 0
+		return false, s.printSystem("quit cancelled")
+	}
+	return false, nil
+}
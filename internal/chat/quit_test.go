@@ -0,0 +1,85 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+func TestQuitAsksAboutUnsentText(t *testing.T) {
+	cases := []struct {
+		name    string
+		answer  []rune
+		quits   bool
+		sent    bool
+		notice  string
+		draft   string
+		ignored bool
+	}{
+		{name: "send", answer: []rune{'s'}, quits: true, sent: true},
+		{name: "enter sends", answer: []rune{'\n'}, quits: true, sent: true},
+		{name: "discard", answer: []rune{'D'}, quits: true},
+		{name: "quit key discards", answer: []rune{0x04}, quits: true},
+		{name: "cancel", answer: []rune{'c'}, notice: "quit cancelled", draft: "half a thou"},
+		{name: "cancel key", answer: []rune{rune(keyCtrlC)}, notice: "quit cancelled", draft: "half a thou"},
+		{name: "other keys are ignored", answer: []rune{'x', '\x1b'}, draft: "half a thou", ignored: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			room := NewRoom(WithColorPicker(&staticColorPicker{}))
+			sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+			for _, r := range "half a thou" {
+				_, err := sess.processEvent(tui.KeyEvent(r))
+				require.NoError(t, err)
+			}
+
+			done, err := sess.processEvent(tui.KeyEvent(0x04))
+			require.NoError(t, err)
+			require.False(t, done, "unsent text needs an answer first")
+			require.Contains(t, out.String(), "[system] you have unsent text: press s or Enter to send it and quit, d or Ctrl+D to discard it")
+
+			for _, r := range tc.answer {
+				done, err = sess.processEvent(tui.KeyEvent(r))
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.quits, done)
+			if tc.sent {
+				require.Contains(t, out.String(), "alice: half a thou")
+			} else {
+				require.NotContains(t, out.String(), "alice: half a thou")
+			}
+			if tc.notice != "" {
+				require.Contains(t, out.String(), tc.notice)
+			}
+			require.Equal(t, tc.draft, sess.buffer.Snapshot())
+			require.Equal(t, tc.ignored, sess.quitKey != 0, "still waiting for an answer")
+		})
+	}
+}
+
+func TestQuitWithEmptyInputLeavesAtOnce(t *testing.T) {
+	room := NewRoom()
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	_, err := sess.processEvent(tui.KeyEvent(' '))
+	require.NoError(t, err)
+
+	done, err := sess.processEvent(tui.KeyEvent(0x04))
+	require.NoError(t, err)
+	require.True(t, done)
+	require.NotContains(t, out.String(), "unsent text")
+}
+
+func TestEOFDropsUnsentText(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	for _, r := range "partial" {
+		_, err := sess.processEvent(tui.KeyEvent(r))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, sess.handleEOF())
+	require.NotContains(t, out.String(), "alice: partial")
+	require.Empty(t, sess.buffer.Snapshot())
+}
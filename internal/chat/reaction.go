@@ -0,0 +1,140 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledzpl/schat/pkg/features"
+)
+
+// maxReactionRunes bounds a reaction, which is one emoji or a short word.
+const maxReactionRunes = 16
+
+// maxReactions bounds how many different reactions one message collects.
+const maxReactions = 20
+
+var (
+	errReactionsOff     = errors.New("reactions are turned off in this room")
+	errBadReaction      = fmt.Errorf("a reaction is one emoji or word of up to %d characters", maxReactionRunes)
+	errAlreadyReacted   = errors.New("you already reacted that way")
+	errTooManyReactions = fmt.Errorf("that message already has %d different reactions", maxReactions)
+)
+
+// Reaction is one emoji or word people reacted to a message with, and who.
+type Reaction struct {
+	Emoji string   `json:"emoji"`
+	Users []string `json:"users"`
+}
+
+// validReaction reports whether text can be used as a reaction.
+func validReaction(text string) bool {
+	if text == "" || utf8.RuneCountInString(text) > maxReactionRunes {
+		return false
+	}
+	return !strings.ContainsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+}
+
+// addReaction records user reacting with emoji, keeping reactions in the
+// order they were first used.
+func addReaction(reactions []Reaction, emoji, user string) ([]Reaction, error) {
+	i := slices.IndexFunc(reactions, func(r Reaction) bool { return r.Emoji == emoji })
+	if i < 0 {
+		if len(reactions) >= maxReactions {
+			return reactions, errTooManyReactions
+		}
+		return append(slices.Clone(reactions), Reaction{Emoji: emoji, Users: []string{user}}), nil
+	}
+	if slices.Contains(reactions[i].Users, user) {
+		return reactions, errAlreadyReacted
+	}
+	reactions = slices.Clone(reactions)
+	reactions[i].Users = append(slices.Clone(reactions[i].Users), user)
+	return reactions, nil
+}
+
+// React adds the sender's reaction to the recent message with the short ID
+// to, then tells every client with a reaction event, which it returns as
+// delivered. The counts are kept with the message in the room history, so
+// they show when it is replayed.
+func (r *Room) React(senderID, senderName, to, emoji string) (Message, error) {
+	if _, archived := r.Archived(); archived {
+		return Message{}, errRoomArchived
+	}
+	if !r.FeatureEnabled(features.Reactions) {
+		return Message{}, errReactionsOff
+	}
+	if !validReaction(emoji) {
+		return Message{}, errBadReaction
+	}
+	orig, ok := r.findShort(to)
+	if !ok {
+		return Message{}, errNoSuchMessage
+	}
+	ev := Message{
+		ID:         orig.ID,
+		Timestamp:  r.now(),
+		SenderID:   senderID,
+		SenderName: senderName,
+		Body:       emoji,
+		Kind:       KindReaction,
+	}
+	if sender, ok := r.client(senderID); ok {
+		ev.SenderName = sender.Username
+		ev.SenderColor = sender.Color
+	}
+	ev, err := r.filterMessage(ev)
+	if err != nil {
+		return Message{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	updated, found := r.history.Update(orig.ID, func(msg *Message) {
+		if msg.Deleted {
+			err = errMessageGone
+			return
+		}
+		msg.Reactions, err = addReaction(msg.Reactions, ev.Body, ev.SenderName)
+	})
+	if !found {
+		err = errMessageGone
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	ev.Reactions = updated.Reactions
+	r.deliverLocked(senderID, ev)
+	return ev, nil
+}
+
+// reactionSummary returns the counts shown after a message people reacted
+// to, such as "  [👍 2 lol 1]".
+func reactionSummary(reactions []Reaction) string {
+	if len(reactions) == 0 {
+		return ""
+	}
+	parts := make([]string, len(reactions))
+	for i, r := range reactions {
+		parts[i] = fmt.Sprintf("%s %d", r.Emoji, len(r.Users))
+	}
+	return "  [" + strings.Join(parts, " ") + "]"
+}
+
+// runReact reacts to a recent message: /react <id> <emoji-or-word>.
+func runReact(s *session, args string) error {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return s.printSystem("usage: /react <id> <emoji-or-word> (/set ids on shows message IDs)")
+	}
+	msg, err := s.room().React(s.client.ID, s.client.Username, fields[0], fields[1])
+	if err != nil {
+		return s.printSystem("/react: " + err.Error())
+	}
+	return s.printMessage(s.renderer.Render(msg))
+}
@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ledzpl/schat/pkg/features"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidReaction(t *testing.T) {
+	for _, ok := range []string{"👍", "lol", "🎉", "ㅋㅋ"} {
+		require.True(t, validReaction(ok), ok)
+	}
+	for _, bad := range []string{"", "two words", "tab\there", strings.Repeat("a", maxReactionRunes+1)} {
+		require.False(t, validReaction(bad), bad)
+	}
+}
+
+func TestRoomReact(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithFeatures(features.New(map[features.Flag]bool{features.Reactions: true})))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	orig, err := room.Broadcast(alice.ID, "alice", "deployed")
+	require.NoError(t, err)
+	drainChannel(alice.Send())
+	drainChannel(bob.Send())
+	short := shortID(orig.ID)
+
+	_, err = room.React(bob.ID, "bob", "zzzz", "👍")
+	require.ErrorIs(t, err, errNoSuchMessage)
+	_, err = room.React(bob.ID, "bob", short, "not one")
+	require.ErrorIs(t, err, errBadReaction)
+
+	ev, err := room.React(bob.ID, "bob", "#"+short, "👍")
+	require.NoError(t, err)
+	require.Equal(t, KindReaction, ev.Kind)
+	require.Equal(t, orig.ID, ev.ID)
+	require.Equal(t, ev, <-alice.Send())
+	_, err = room.React(bob.ID, "bob", short, "👍")
+	require.ErrorIs(t, err, errAlreadyReacted)
+	_, err = room.React(alice.ID, "alice", short, "👍")
+	require.NoError(t, err)
+	ev, err = room.React(alice.ID, "alice", short, "lol")
+	require.NoError(t, err)
+	require.Equal(t, []Reaction{{Emoji: "👍", Users: []string{"bob", "alice"}}, {Emoji: "lol", Users: []string{"alice"}}}, ev.Reactions)
+
+	r := newMessageRenderer()
+	r.setOptions(timestampsHidden, false)
+	require.Equal(t, "alice reacted lol to #"+short, r.Render(ev))
+	replay := room.history.Recent(0)
+	require.Equal(t, "alice: deployed  [👍 2 lol 1]", r.Render(replay[len(replay)-1]), "late joiners see the counts")
+
+	_, err = room.DeleteMessage(alice.ID, orig.ID)
+	require.NoError(t, err)
+	_, err = room.React(bob.ID, "bob", short, "🎉")
+	require.ErrorIs(t, err, errNoSuchMessage)
+}
+
+func TestRoomReactNeedsFeature(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	alice := room.AddClient("alice")
+	orig, err := room.Broadcast(alice.ID, "alice", "hi")
+	require.NoError(t, err)
+	_, err = room.React(alice.ID, "alice", shortID(orig.ID), "👋")
+	require.ErrorIs(t, err, errReactionsOff)
+}
+
+func TestAddReactionLimit(t *testing.T) {
+	var reactions []Reaction
+	var err error
+	for i := 0; i < maxReactions; i++ {
+		reactions, err = addReaction(reactions, strings.Repeat("x", i+1), "alice")
+		require.NoError(t, err)
+	}
+	_, err = addReaction(reactions, "y", "bob")
+	require.ErrorIs(t, err, errTooManyReactions)
+	_, err = addReaction(reactions, "x", "bob")
+	require.NoError(t, err, "existing reactions can still be joined")
+}
+
+func TestReactCommand(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithFeatures(features.New(map[features.Flag]bool{features.Reactions: true})))
+	alice := room.AddClient("alice")
+	orig, err := room.Broadcast(alice.ID, "alice", "hi")
+	require.NoError(t, err)
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "bob"})
+
+	require.NoError(t, sess.runCommand("/react"))
+	require.Contains(t, out.String(), "usage: /react <id> <emoji-or-word>")
+	require.NoError(t, sess.runCommand("/react "+shortID(orig.ID)+" 👋"))
+	require.Contains(t, out.String(), "bob reacted 👋 to #"+shortID(orig.ID))
+}
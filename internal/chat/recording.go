@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/fileshare"
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+// recordingIndicator marks the status line of rooms whose history outlives
+// the server process.
+const recordingIndicator = "[REC]"
+
+// WithHistoryRetention tells users how long the store keeps messages; zero
+// means until an operator removes them. Pruning is up to the caller.
+func WithHistoryRetention(d time.Duration) RoomOption {
+	return func(r *Room) {
+		r.historyRetention = d
+	}
+}
+
+// archived reports whether the room's history is written to disk when the
+// room is deleted.
+func (r *Room) archived() bool {
+	return r.manager != nil && r.manager.archive.Dir != "" && r != r.manager.lobby
+}
+
+// Recorded reports whether the room's messages are kept beyond memory, in
+// the store or in an archive when the room is deleted.
+func (r *Room) Recorded() bool {
+	return !r.serverLog && (r.store != nil || r.archived())
+}
+
+// runRecording describes what the server keeps about the current room and
+// for how long: /recording.
+func runRecording(s *session, _ string) error {
+	room := s.room()
+	name := room.Name()
+	if !room.Recorded() {
+		lines := []string{
+			fmt.Sprintf("#%s is not recorded: the last %d messages stay in memory for people who join later and are gone when the server restarts", name, room.historySize),
+			"  direct messages are never saved",
+		}
+		return s.printSystem(append(lines, s.recordingExtras()...)...)
+	}
+
+	lines := []string{fmt.Sprintf("#%s is recorded %s:", name, recordingIndicator)}
+	if room.store != nil {
+		where := "the server database"
+		if _, ok := room.store.(*store.Encrypted); ok {
+			where = "the server database, encrypted,"
+		}
+		lines = append(lines, fmt.Sprintf("  chat messages, /me actions, and notices are saved to %s %s; /search finds them",
+			where, formatRetention(room.historyRetention)))
+	}
+	if room.archived() {
+		where := "to disk"
+		if room.manager.archive.Encrypt != nil {
+			where = "to disk, encrypted,"
+		}
+		lines = append(lines, fmt.Sprintf("  if #%s is deleted, its last %d messages are archived %s %s",
+			name, room.historySize, where, formatRetention(room.manager.archive.Retention)))
+	}
+	lines = append(lines, "  direct messages are never saved")
+	return s.printSystem(append(lines, s.recordingExtras()...)...)
+}
+
+// recordingExtras describes what is kept about the user outside the room's
+// messages.
+func (s *session) recordingExtras() []string {
+	room := s.room()
+	var lines []string
+	if room.store != nil {
+		if s.client.Registered() {
+			lines = append(lines, "  your /prompt, /statusbar, and /keys preferences are saved until you change them")
+		} else {
+			lines = append(lines, "  your preferences last only this session because you are not signed in")
+		}
+	}
+	if room.files != nil {
+		lines = append(lines, fmt.Sprintf("  shared files are kept in memory, up to %s each, until they expire", fileshare.FormatSize(room.files.MaxBytes())))
+	}
+	return lines
+}
+
+// formatRetention renders a retention period as a phrase, e.g. "for 30 days".
+func formatRetention(d time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case d <= 0:
+		return "until an operator removes them"
+	case d == day:
+		return "for 1 day"
+	case d%day == 0:
+		return fmt.Sprintf("for %d days", d/day)
+	}
+	return "for " + d.String()
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestRecordingWithoutPersistence(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithHistorySize(50))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	require.Equal(t, "#lobby | 1 online", sess.header())
+	require.NoError(t, sess.runCommand("/recording"))
+	require.Contains(t, out.String(), "#lobby is not recorded: the last 50 messages stay in memory")
+	require.Contains(t, out.String(), "direct messages are never saved")
+	require.NotContains(t, out.String(), recordingIndicator)
+}
+
+func TestRecordingWithStore(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithStore(store.NewMemory()), WithHistoryRetention(30*24*time.Hour))
+	guest, guestOut := newCommandTestSession(room, ClientInfo{Username: "guest"})
+	alice, aliceOut := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+
+	require.Equal(t, "#lobby [REC] | 2 online", guest.header())
+	require.NoError(t, guest.runCommand("/recording"))
+	require.Contains(t, guestOut.String(), "#lobby is recorded [REC]:")
+	require.Contains(t, guestOut.String(), "saved to the server database for 30 days; /search finds them")
+	require.Contains(t, guestOut.String(), "your preferences last only this session because you are not signed in")
+	require.NotContains(t, guestOut.String(), "archived")
+
+	require.NoError(t, alice.runCommand("/recording"))
+	require.Contains(t, aliceOut.String(), "preferences are saved until you change them")
+}
+
+func TestRecordingEncryptedStore(t *testing.T) {
+	st, err := store.NewEncrypted(store.NewMemory(), []byte("0123456789abcdef"))
+	require.NoError(t, err)
+	m := newTestManager(WithRoomOptions(WithStore(st)), WithArchive(ArchivePolicy{Dir: t.TempDir(), Encrypt: st}))
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	sess, out := newCommandTestSession(dev, ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/recording"))
+	require.Contains(t, out.String(), "saved to the server database, encrypted, until an operator removes them; /search finds them")
+	require.Contains(t, out.String(), "if #dev is deleted, its last 100 messages are archived to disk, encrypted, until an operator removes them")
+}
+
+func TestRecordingArchivedRooms(t *testing.T) {
+	m := newTestManager(WithArchive(ArchivePolicy{Dir: t.TempDir()}))
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	require.False(t, m.Lobby().Recorded(), "the lobby is never deleted, so never archived")
+	require.True(t, dev.Recorded())
+
+	sess, out := newCommandTestSession(dev, ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/recording"))
+	require.Contains(t, out.String(), "if #dev is deleted, its last 100 messages are archived to disk until an operator removes them")
+	require.NotContains(t, out.String(), "database")
+}
+
+func TestFormatRetention(t *testing.T) {
+	require.Equal(t, "until an operator removes them", formatRetention(0))
+	require.Equal(t, "for 1 day", formatRetention(24*time.Hour))
+	require.Equal(t, "for 7 days", formatRetention(7*24*time.Hour))
+	require.Equal(t, "for 36h0m0s", formatRetention(36*time.Hour))
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// registerPrefix starts the input lines whose arguments are masked on screen.
+const registerPrefix = "/register "
+
+// WithAccounts enables /register, which protects usernames with a password
+// kept in accounts.
+func WithAccounts(accounts *sshserver.Accounts) RoomOption {
+	return func(r *Room) {
+		r.accounts = accounts
+	}
+}
+
+// runRegister claims the session's username with a password:
+// /register <password>. Changing the password of a registered name needs a
+// session that signed in with it.
+func runRegister(s *session, args string) error {
+	accounts := s.room().accounts
+	if accounts == nil {
+		return s.printSystem("accounts are not enabled on this server")
+	}
+	name := s.client.Username
+	registered := accounts.Registered(name)
+	if args == "" {
+		state := fmt.Sprintf("%s is not registered", name)
+		if registered {
+			state = fmt.Sprintf("%s is registered", name)
+		}
+		return s.printSystem("usage: /register <password>", "  "+state)
+	}
+	if registered && !s.info.Account {
+		return s.printSystem(fmt.Sprintf("/register: %s is already registered; sign in with its password or key to change the password", name))
+	}
+
+	if err := accounts.Register(name, args, s.info.KeyFingerprint); err != nil {
+		return s.printSystem(fmt.Sprintf("/register: %v", strings.TrimPrefix(err.Error(), "sshserver: ")))
+	}
+	s.log.Info("chat: account registered", "changed", registered)
+
+	lines := []string{fmt.Sprintf("registered %s: from now on this name signs in only with this password", name)}
+	if registered {
+		lines[0] = fmt.Sprintf("changed the password of %s", name)
+	}
+	if s.info.KeyFingerprint != "" {
+		lines = append(lines, "  or the key you signed in with ("+s.info.KeyFingerprint+")")
+	}
+	if !s.info.Account {
+		lines = append(lines, "  reconnect and enter the password when ssh asks for it")
+	}
+	return s.printSystem(lines...)
+}
+
+// maskInput hides the password being typed after /register.
+func maskInput(line string) string {
+	if len(line) < len(registerPrefix) || !strings.EqualFold(line[:len(registerPrefix)], registerPrefix) {
+		return line
+	}
+	rest := line[len(registerPrefix):]
+	return line[:len(registerPrefix)] + strings.Repeat("*", len([]rune(rest)))
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+func TestRegisterCommand(t *testing.T) {
+	accounts, err := sshserver.OpenAccounts(filepath.Join(t.TempDir(), "accounts.json"))
+	require.NoError(t, err)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithAccounts(accounts))
+
+	guest, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	require.NoError(t, guest.runCommand("/register"))
+	require.Contains(t, out.String(), "alice is not registered")
+	require.NoError(t, guest.runCommand("/register short"))
+	require.Contains(t, out.String(), "/register: passwords must be at least 8 characters")
+	require.False(t, accounts.Registered("alice"))
+
+	require.NoError(t, guest.runCommand("/register correct horse"))
+	require.Contains(t, out.String(), "registered alice: from now on this name signs in only with this password")
+	require.Contains(t, out.String(), "reconnect and enter the password")
+	require.True(t, accounts.Registered("alice"))
+
+	// Another anonymous session cannot join as the name, let alone take it over.
+	impostor, _ := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	require.Equal(t, impostor.client.ID, impostor.client.Username)
+	require.Contains(t, (<-impostor.client.Send()).Body, "the name is registered; sign in with its password or key")
+
+	owner, ownerOut := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey", Account: true, KeyFingerprint: "SHA256:abc"})
+	require.NoError(t, owner.runCommand("/register battery staple"))
+	require.Contains(t, ownerOut.String(), "changed the password of alice")
+	require.Contains(t, ownerOut.String(), "or the key you signed in with (SHA256:abc)")
+	require.NotContains(t, ownerOut.String(), "reconnect")
+}
+
+func TestRegisterDisabled(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/register correct horse"))
+	require.Contains(t, out.String(), "accounts are not enabled on this server")
+}
+
+func TestMaskInput(t *testing.T) {
+	require.Equal(t, "/register *****", maskInput("/register s3crt"))
+	require.Equal(t, "/REGISTER ***", maskInput("/REGISTER 비밀번"))
+	require.Equal(t, "/register", maskInput("/register"))
+	require.Equal(t, "/registered", maskInput("/registered"))
+	require.Equal(t, "hello", maskInput("hello"))
+}
@@ -0,0 +1,213 @@
+package chat
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// relayBatchSize bounds how many queued messages a worker writes for one client
+// before yielding to the next ready client on the same shard.
+const relayBatchSize = 32
+
+// relayWriteTimeout is how long a write may block before its worker leaves
+// the rest of the shard to a new one and stays with the blocked client alone.
+const relayWriteTimeout = 2 * time.Second
+
+// relayPool multiplexes outbound delivery for many clients onto a fixed set of
+// worker goroutines. Each client is pinned to one shard, so its messages are
+// still written in order by a single goroutine, while idle clients cost no
+// goroutine at all.
+type relayPool struct {
+	shards []*relayShard
+	next   atomic.Uint64
+	start  sync.Once
+}
+
+func newRelayPool(workers int) *relayPool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0) * 4
+	}
+	pool := &relayPool{shards: make([]*relayShard, workers)}
+	for i := range pool.shards {
+		pool.shards[i] = &relayShard{signal: make(chan struct{}, 1), writeTimeout: relayWriteTimeout}
+	}
+	return pool
+}
+
+// attach starts relaying the client's queued messages to handle. The returned
+// target's Done channel closes once the client's queue is closed and drained,
+// or as soon as handle returns an error.
+func (p *relayPool) attach(client *Client, handle func(Message) error) *relayTarget {
+	p.start.Do(func() {
+		for _, shard := range p.shards {
+			shard.startWorker()
+		}
+	})
+
+	shard := p.shards[p.next.Add(1)%uint64(len(p.shards))]
+	target := &relayTarget{
+		client: client,
+		handle: handle,
+		shard:  shard,
+		done:   make(chan struct{}),
+	}
+	client.setNotifier(target.schedule)
+	// Pick up anything queued before the notifier was installed.
+	target.schedule()
+	return target
+}
+
+// relayShard is one worker goroutine with its queue of clients ready to write.
+// The queue is unbounded so broadcasters never block on a busy shard. A
+// worker whose write blocks for writeTimeout is replaced, so one stuck client
+// holds up only itself.
+type relayShard struct {
+	mu     sync.Mutex
+	ready  []*relayTarget
+	signal chan struct{}
+
+	writeTimeout time.Duration
+}
+
+func (s *relayShard) enqueue(t *relayTarget) {
+	s.mu.Lock()
+	s.ready = append(s.ready, t)
+	s.mu.Unlock()
+	s.wake()
+}
+
+func (s *relayShard) wake() {
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// relayWorker drains the ready clients of a shard until one of its writes
+// outlasts the shard's writeTimeout. It is then retired: a new worker takes
+// over the shard, and this one returns once the blocked client is drained.
+type relayWorker struct {
+	shard   *relayShard
+	stalled *time.Timer
+	retired atomic.Bool
+}
+
+func (s *relayShard) startWorker() {
+	w := &relayWorker{shard: s}
+	w.stalled = time.AfterFunc(time.Hour, w.retire)
+	w.stalled.Stop()
+	go w.run()
+}
+
+func (w *relayWorker) retire() {
+	w.retired.Store(true)
+	w.shard.startWorker()
+	// The clients this worker had yet to get to are waiting.
+	w.shard.wake()
+}
+
+func (w *relayWorker) run() {
+	s := w.shard
+	for range s.signal {
+		for {
+			s.mu.Lock()
+			if len(s.ready) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			t := s.ready[0]
+			s.ready[0] = nil
+			s.ready = s.ready[1:]
+			s.mu.Unlock()
+
+			t.drain(w)
+			if w.retired.Load() {
+				return
+			}
+		}
+	}
+}
+
+// write hands msg to t, starting the clock on the write.
+func (w *relayWorker) write(t *relayTarget, msg Message) error {
+	w.stalled.Reset(w.shard.writeTimeout)
+	defer w.stalled.Stop()
+	return t.handle(msg)
+}
+
+// relayTarget binds a client queue to the function that writes to its session.
+type relayTarget struct {
+	client *Client
+	handle func(Message) error
+	shard  *relayShard
+
+	// draining is held by the worker writing to the client, as a retired
+	// worker may still be when a new one picks the client up.
+	draining  sync.Mutex
+	scheduled atomic.Bool
+	finished  atomic.Bool
+	done      chan struct{}
+}
+
+// Done is closed once no further messages will be relayed to the session.
+func (t *relayTarget) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *relayTarget) schedule() {
+	if t.finished.Load() {
+		return
+	}
+	if t.scheduled.CompareAndSwap(false, true) {
+		t.shard.enqueue(t)
+	}
+}
+
+func (t *relayTarget) drain(w *relayWorker) {
+	if t.finished.Load() {
+		return
+	}
+	// Clear the flag before reading so a message queued mid-drain reschedules us.
+	t.scheduled.Store(false)
+	if !t.draining.TryLock() {
+		// A retired worker is still writing; it reschedules us when done.
+		return
+	}
+	defer func() {
+		t.draining.Unlock()
+		if len(t.client.send) > 0 {
+			t.schedule()
+		}
+	}()
+
+	for i := 0; i < relayBatchSize; i++ {
+		select {
+		case msg, ok := <-t.client.send:
+			if !ok {
+				t.finish()
+				return
+			}
+			t.client.dequeued(msg)
+			if n := t.client.takeMissed(); n > 0 {
+				if err := w.write(t, missedNotice(n, msg.Timestamp)); err != nil {
+					t.finish()
+					return
+				}
+			}
+			if err := w.write(t, msg); err != nil {
+				t.finish()
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (t *relayTarget) finish() {
+	if t.finished.CompareAndSwap(false, true) {
+		close(t.done)
+	}
+}
@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayPoolDeliversInOrderPerClient(t *testing.T) {
+	pool := newRelayPool(2)
+
+	const clients = 8
+	const perClient = 10
+
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	targets := make([]*relayTarget, 0, clients)
+	queued := make([]*Client, 0, clients)
+
+	for i := 0; i < clients; i++ {
+		client := newClient(string(rune('a'+i)), "user", "")
+		targets = append(targets, pool.attach(client, func(msg Message) error {
+			mu.Lock()
+			received[client.ID] = append(received[client.ID], msg.Body)
+			mu.Unlock()
+			return nil
+		}))
+		queued = append(queued, client)
+	}
+
+	for n := 0; n < perClient; n++ {
+		for _, client := range queued {
+			client.tryDeliver(Message{Body: string(rune('0' + n))})
+		}
+	}
+	for _, client := range queued {
+		client.closeSend()
+	}
+	for _, target := range targets {
+		waitDone(t, target)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, client := range queued {
+		require.Equal(t, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, received[client.ID])
+	}
+}
+
+func TestRelayTargetStopsOnHandlerError(t *testing.T) {
+	pool := newRelayPool(1)
+	client := newClient("id", "user", "")
+
+	calls := 0
+	target := pool.attach(client, func(Message) error {
+		calls++
+		return errors.New("write failed")
+	})
+
+	client.tryDeliver(Message{Body: "one"})
+	client.tryDeliver(Message{Body: "two"})
+
+	waitDone(t, target)
+	require.Equal(t, 1, calls)
+}
+
+func waitDone(t *testing.T, target *relayTarget) {
+	t.Helper()
+	select {
+	case <-target.Done():
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for relay to finish")
+	}
+}
+
+func TestRelayShardSurvivesABlockedWriter(t *testing.T) {
+	pool := newRelayPool(1)
+	pool.shards[0].writeTimeout = 20 * time.Millisecond
+
+	unblock := make(chan struct{})
+	slow := newClient("slow", "slow", "")
+	slowGot := make(chan string, 4)
+	slowTarget := pool.attach(slow, func(msg Message) error {
+		<-unblock
+		slowGot <- msg.Body
+		return nil
+	})
+	fast := newClient("fast", "fast", "")
+	fastGot := make(chan string, 4)
+	pool.attach(fast, func(msg Message) error {
+		fastGot <- msg.Body
+		return nil
+	})
+
+	slow.tryDeliver(Message{Body: "one"})
+	slow.tryDeliver(Message{Body: "two"})
+	fast.tryDeliver(Message{Body: "hi"})
+	select {
+	case body := <-fastGot:
+		require.Equal(t, "hi", body)
+	case <-time.After(time.Second):
+		t.Fatal("a blocked writer held up the rest of its shard")
+	}
+
+	close(unblock)
+	require.Equal(t, "one", <-slowGot)
+	require.Equal(t, "two", <-slowGot, "the blocked client keeps its order")
+	slow.tryDeliver(Message{Body: "three"})
+	require.Equal(t, "three", <-slowGot)
+	fast.tryDeliver(Message{Body: "again"})
+	require.Equal(t, "again", <-fastGot)
+	slow.closeSend()
+	waitDone(t, slowTarget)
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"errors"
+	"time"
+)
+
+// Settings are the room options that can change while the server runs.
+type Settings struct {
+	ServerName string
+	// MOTD nil restores the built-in greeting.
+	MOTD      *MOTD
+	Operators []string
+	AutoAway  time.Duration
+}
+
+// Reload applies s to every room and to rooms created later. Operator changes
+// apply to sessions that join after the reload; connected users keep the
+// privileges they joined with.
+func (m *RoomManager) Reload(s Settings) {
+	m.mu.Lock()
+	m.settings = &s
+	rooms := make([]*Room, 0, len(m.rooms))
+	for _, room := range m.rooms {
+		rooms = append(rooms, room)
+	}
+	m.mu.Unlock()
+
+	for _, room := range rooms {
+		room.reload(s)
+	}
+}
+
+// Ensure creates each named room that does not exist yet, skipping rooms
+// pinned to other cluster nodes. Rooms created this way have no owner, so only
+// operators can manage them.
+func (m *RoomManager) Ensure(names ...string) error {
+	for _, name := range names {
+		if !m.lobby.cluster.Local(name) {
+			continue
+		}
+		if _, err := m.Create(name, ""); err != nil && !errors.Is(err, errRoomExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Room) reload(s Settings) {
+	operators := make(map[string]struct{}, len(s.Operators))
+	for _, name := range s.Operators {
+		if name != "" {
+			operators[name] = struct{}{}
+		}
+	}
+	motd := s.MOTD
+	if motd == nil {
+		motd = mustParseMOTD(defaultMOTD)
+	}
+	serverName := s.ServerName
+	if serverName == "" {
+		serverName = defaultServerName
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.serverName = serverName
+	r.motd = motd
+	r.operators = operators
+	r.autoAway = s.AutoAway
+}
@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomManagerReload(t *testing.T) {
+	m := newTestManager(WithRoomOptions(WithOperators("alice"), WithAutoAway(time.Hour)))
+	_, err := m.Create("dev", "")
+	require.NoError(t, err)
+	alice := m.Lobby().AddClient("alice")
+	require.True(t, alice.Operator)
+
+	m.Reload(Settings{
+		ServerName: "example",
+		MOTD:       mustParseMOTD("{{.ServerName}} #{{.Room}} for {{.Username}}"),
+		Operators:  []string{"bob"},
+		AutoAway:   time.Minute,
+	})
+
+	dev, _ := m.Room("dev")
+	bob := dev.AddClient("bob")
+	require.True(t, bob.Operator, "new joins use the reloaded operator list")
+	require.False(t, dev.AddClient("alice").Operator)
+	require.True(t, alice.Operator, "connected users keep their privileges")
+
+	lines, err := dev.greeting(bob)
+	require.NoError(t, err)
+	require.Equal(t, []string{"example #dev for bob"}, lines)
+
+	ops, err := m.Create("ops", "bob")
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, ops.autoAway, "rooms created after a reload use it too")
+	lines, err = ops.greeting(bob)
+	require.NoError(t, err)
+	require.Equal(t, []string{"example #ops for bob"}, lines)
+
+	m.Reload(Settings{})
+	lines, err = dev.greeting(bob)
+	require.NoError(t, err)
+	require.Contains(t, lines[0], "Welcome to schat, bob!", "empty settings restore the defaults")
+}
+
+func TestRoomManagerEnsure(t *testing.T) {
+	m := newTestManager()
+	require.NoError(t, m.Ensure("dev", "#Ops"))
+	require.NoError(t, m.Ensure("dev"), "existing rooms are left alone")
+
+	ops, ok := m.Room("ops")
+	require.True(t, ok)
+	require.Empty(t, ops.Owner())
+	require.Len(t, m.Rooms(), 3)
+
+	require.Error(t, m.Ensure("bad name"))
+}
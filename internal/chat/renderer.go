@@ -0,0 +1,185 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const colorReset = "\033[0m"
+const timestampFormat = "2006-01-02 15:04:05"
+
+// timestampMode is how the renderer shows when a message was sent.
+type timestampMode int
+
+const (
+	// timestampsAbsolute shows the date and time, e.g. [2024-05-01 09:30:00].
+	timestampsAbsolute timestampMode = iota
+	// timestampsRelative shows the age when drawn, e.g. [2m ago].
+	timestampsRelative
+	// timestampsHidden leaves timestamps out.
+	timestampsHidden
+)
+
+var timestampModeNames = []string{"absolute", "relative", "hidden"}
+
+func (m timestampMode) String() string {
+	return timestampModeNames[m]
+}
+
+// parseTimestampMode accepts a mode name, or on and off for absolute and
+// hidden.
+func parseTimestampMode(name string) (timestampMode, error) {
+	switch name = strings.ToLower(name); name {
+	case "on":
+		return timestampsAbsolute, nil
+	case "off":
+		return timestampsHidden, nil
+	}
+	for i, n := range timestampModeNames {
+		if n == name {
+			return timestampMode(i), nil
+		}
+	}
+	return timestampsAbsolute, fmt.Errorf("unknown mode %q (want %s)", name, strings.Join(timestampModeNames, ", "))
+}
+
+// relativeTime renders the age of a message coarsely, e.g. "2m ago".
+func relativeTime(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// messageRenderer turns structured room messages into terminal lines for one session.
+type messageRenderer struct {
+	// viewer is the username of the session's own client; @mentions of it are
+	// highlighted in viewerColor and ring the terminal bell.
+	viewer      string
+	viewerColor string
+	// timestamps is how lines show the time; bell rings on mentions.
+	timestamps timestampMode
+	bell       bool
+	// showIDs prefixes messages with the short IDs /reply takes.
+	showIDs bool
+	// now dates relative timestamps.
+	now func() time.Time
+	// theme shades colors for a terminal of the given depth.
+	theme *theme
+	depth colorDepth
+	// filters holds the words highlighted for the viewer.
+	filters *messageFilters
+	// compact drops timestamps and colors for links too slow for them.
+	compact atomic.Bool
+}
+
+func newMessageRenderer() *messageRenderer {
+	return &messageRenderer{bell: true, now: time.Now, theme: defaultTheme(), depth: depth16}
+}
+
+// setOptions applies the viewer's display preferences.
+func (r *messageRenderer) setOptions(timestamps timestampMode, bell bool) {
+	r.timestamps = timestamps
+	r.bell = bell
+}
+
+// setTheme applies the viewer's theme at their terminal's color depth.
+func (r *messageRenderer) setTheme(t *theme, depth colorDepth) {
+	r.theme = t
+	r.depth = depth
+}
+
+// setViewer tells the renderer whose terminal it draws for.
+func (r *messageRenderer) setViewer(name, color string) {
+	r.viewer = name
+	r.viewerColor = color
+}
+
+// Render formats msg as a single terminal line.
+func (r *messageRenderer) Render(msg Message) string {
+	var ts string
+	switch {
+	case r.compact.Load():
+		// Slow links are spared the timestamps.
+	case r.timestamps == timestampsAbsolute:
+		ts = "[" + msg.Timestamp.Format(timestampFormat) + "] "
+	case r.timestamps == timestampsRelative:
+		ts = "[" + relativeTime(r.now().Sub(msg.Timestamp)) + "] "
+	}
+
+	if r.showIDs && msg.ID != 0 {
+		ts += "#" + shortID(msg.ID) + " "
+	}
+	if msg.Deleted || msg.Kind == KindDelete {
+		return fmt.Sprintf("%s%s: %s", ts, r.senderLabel(msg), deletedMarker)
+	}
+	edited := ""
+	if msg.Edited || msg.Kind == KindEdit {
+		edited = " " + editedMarker
+	}
+
+	switch msg.Kind {
+	case KindSystem:
+		return fmt.Sprintf("%s%s %s", ts, r.systemTag(), msg.Body)
+	case KindReaction:
+		return fmt.Sprintf("%s%s reacted %s to #%s", ts, r.senderLabel(msg), msg.Body, shortID(msg.ID))
+	case KindDirect:
+		body, bell := r.body(msg)
+		return fmt.Sprintf("%s[dm] %s -> %s: %s", ts, r.senderLabel(msg), msg.RecipientName, body) + bell
+	case KindAction:
+		body, bell := r.body(msg)
+		return fmt.Sprintf("%s* %s %s%s%s", ts, r.senderLabel(msg), body, edited, reactionSummary(msg.Reactions)) + bell
+	default:
+		body, bell := r.body(msg)
+		return fmt.Sprintf("%s%s: %s%s%s%s", ts, r.senderLabel(msg), replyQuote(msg), body, edited, reactionSummary(msg.Reactions)) + bell
+	}
+}
+
+// body highlights mentions of the viewer and the words they watch for, and
+// returns the bell to ring, if any. Users are not alerted by their own
+// messages.
+func (r *messageRenderer) body(msg Message) (string, string) {
+	if r.viewer == "" || msg.SenderName == r.viewer {
+		return msg.Body, ""
+	}
+	body, word := highlightWords(msg.Body, r.filters.highlightedWords(), seqBold)
+	highlight := seqInverse
+	if !r.compact.Load() {
+		highlight = r.theme.paint(r.viewerColor, r.depth) + highlight
+	}
+	body, hit := highlightMentions(body, r.viewer, highlight)
+	if !(hit || word) || !r.bell {
+		return body, ""
+	}
+	return body, seqBell
+}
+
+// replyQuote returns the snippet a reply shows of the message it answers.
+func replyQuote(msg Message) string {
+	if msg.ReplyTo == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[re %s: \"%s\"] ", msg.ReplyName, msg.ReplyQuote)
+}
+
+func (r *messageRenderer) senderLabel(msg Message) string {
+	if msg.SenderColor == "" || r.compact.Load() {
+		return msg.SenderName
+	}
+	return fmt.Sprintf("%s%s%s", r.theme.paint(msg.SenderColor, r.depth), msg.SenderName, colorReset)
+}
+
+func (r *messageRenderer) systemTag() string {
+	if r.theme == nil || r.theme.system == nil || r.compact.Load() {
+		return "[system]"
+	}
+	return r.theme.system.sequence(r.depth) + "[system]" + colorReset
+}
@@ -0,0 +1,70 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRendererRender(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{
+			name: "chat without color",
+			msg:  Message{Timestamp: ts, SenderName: "alice", Body: "hi", Kind: KindChat},
+			want: "[2024-05-01 09:30:00] alice: hi",
+		},
+		{
+			name: "chat with color",
+			msg:  Message{Timestamp: ts, SenderName: "bob", SenderColor: "\033[31m", Body: "yo", Kind: KindChat},
+			want: "[2024-05-01 09:30:00] \033[31mbob\033[0m: yo",
+		},
+		{
+			name: "action",
+			msg:  Message{Timestamp: ts, SenderName: "bob", SenderColor: "\033[31m", Body: "waves", Kind: KindAction},
+			want: "[2024-05-01 09:30:00] * \033[31mbob\033[0m waves",
+		},
+		{
+			name: "system",
+			msg:  Message{Timestamp: ts, Body: "carol joined the chat", Kind: KindSystem},
+			want: "[2024-05-01 09:30:00] [system] carol joined the chat",
+		},
+	}
+
+	renderer := newMessageRenderer()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, renderer.Render(tc.msg))
+		})
+	}
+}
+
+func TestMessageRendererTimestampModes(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	renderer := newMessageRenderer()
+	renderer.now = func() time.Time { return now }
+	msg := func(age time.Duration) Message {
+		return Message{Timestamp: now.Add(-age), SenderName: "alice", Body: "hi", Kind: KindChat}
+	}
+
+	renderer.setOptions(timestampsRelative, true)
+	require.Equal(t, "[just now] alice: hi", renderer.Render(msg(20*time.Second)))
+	require.Equal(t, "[2m ago] alice: hi", renderer.Render(msg(2*time.Minute+10*time.Second)))
+	require.Equal(t, "[3h ago] alice: hi", renderer.Render(msg(3*time.Hour)))
+	require.Equal(t, "[2d ago] [system] hi", renderer.Render(Message{Timestamp: now.Add(-50 * time.Hour), Body: "hi", Kind: KindSystem}))
+
+	renderer.setOptions(timestampsHidden, true)
+	require.Equal(t, "alice: hi", renderer.Render(msg(time.Hour)))
+
+	for in, want := range map[string]timestampMode{"on": timestampsAbsolute, "Relative": timestampsRelative, "off": timestampsHidden, "hidden": timestampsHidden} {
+		got, err := parseTimestampMode(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+}
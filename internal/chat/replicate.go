@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+)
+
+// replicate hands a chat or action message posted on this node to the
+// other cluster nodes and to the servers sharing the room backend.
+func (r *Room) replicate(msg Message) {
+	if msg.Node != "" || r.serverLog {
+		return
+	}
+	ev := cluster.Event{
+		Room:   r.name,
+		Time:   msg.Timestamp,
+		User:   msg.SenderName,
+		Text:   msg.Body,
+		Action: msg.Kind == KindAction,
+	}
+	r.cluster.Replicate(ev)
+	r.shared.Publish(ev)
+}
+
+// PostReplicated delivers a message posted on another cluster node, or on a
+// server sharing the room backend, to its room, creating the room when nobody
+// has joined it here yet.
+func (m *RoomManager) PostReplicated(ev cluster.Event) error {
+	room, ok := m.Room(ev.Room)
+	if !ok {
+		if err := m.Ensure(ev.Room); err != nil {
+			return err
+		}
+		if room, ok = m.Room(ev.Room); !ok {
+			return fmt.Errorf("chat: no room %q for node %s", ev.Room, ev.Node)
+		}
+	}
+	kind := KindChat
+	if ev.Action {
+		kind = KindAction
+	}
+	_, err := room.broadcastMessage(Message{
+		Timestamp:  ev.Time,
+		SenderName: ev.User,
+		Body:       ev.Text,
+		Kind:       kind,
+		Node:       ev.Node,
+	})
+	return err
+}
@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+)
+
+func TestReplicationBetweenNodes(t *testing.T) {
+	managers := make(map[string]*RoomManager)
+	servers := make(map[string]*httptest.Server)
+	var clusters []*cluster.Cluster
+	for _, id := range []string{"a", "b"} {
+		id := id
+		servers[id] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			managers[id].lobby.cluster.EventsHandler(managers[id].PostReplicated).ServeHTTP(w, r)
+		}))
+		defer servers[id].Close()
+	}
+	nodes := []cluster.Node{{ID: "a", Admin: servers["a"].URL}, {ID: "b", Admin: servers["b"].URL}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, id := range []string{"a", "b"} {
+		c, err := cluster.New(id, nodes, cluster.WithReplication(true))
+		require.NoError(t, err)
+		clusters = append(clusters, c)
+		managers[id] = newTestManager(WithRoomOptions(WithCluster(c)))
+		go c.Run(ctx)
+	}
+
+	devA, err := managers["a"].Create("dev", "alice")
+	require.NoError(t, err)
+	alice := devA.AddClient("alice")
+	drainChannel(alice.Send())
+
+	_, err = devA.Broadcast(alice.ID, "alice", "hello from a")
+	require.NoError(t, err)
+	var devB *Room
+	require.Eventually(t, func() bool {
+		devB, _ = managers["b"].Room("dev")
+		return devB != nil && len(devB.history.Recent(10)) > 0
+	}, 5*time.Second, 10*time.Millisecond, "the room is created on b for the first message")
+	msg := devB.history.Recent(1)[0]
+	require.Equal(t, "alice", msg.SenderName)
+	require.Equal(t, "hello from a", msg.Body)
+	require.Equal(t, "a", msg.Node)
+	require.Empty(t, devB.Owner())
+
+	bob := devB.AddClient("bob")
+	drainChannel(bob.Send())
+	drainChannel(alice.Send())
+	_, err = devB.Action(bob.ID, "bob", "waves")
+	require.NoError(t, err)
+	got := <-alice.Send()
+	require.Equal(t, KindAction, got.Kind)
+	require.Equal(t, "bob", got.SenderName)
+	require.Equal(t, "waves", got.Body)
+	require.Equal(t, "b", got.Node)
+
+	require.Eventually(t, func() bool {
+		return clusters[0].ReplicationStatus()[0].Sent == 1 && clusters[1].ReplicationStatus()[0].Sent == 1
+	}, 5*time.Second, 10*time.Millisecond, "replicated messages are not sent back")
+	time.Sleep(50 * time.Millisecond)
+	require.Len(t, devA.history.Recent(10), 3, "alice's join, her message, and bob's action")
+	require.Zero(t, len(bob.Send()), "bob does not get his own action back")
+
+	sess, out := newCommandTestSession(devA, ClientInfo{Username: "carol"})
+	require.NoError(t, sess.runCommand("/cluster"))
+	require.Contains(t, out.String(), "Replication:")
+	require.Regexp(t, `b\s+sent 1, queued 0, dropped 0, failed 0`, out.String())
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// idsSetting is the key of the preference that shows message IDs.
+const idsSetting = "ids"
+
+// shortIDLength is how many base-36 digits a short message ID has.
+const shortIDLength = 4
+
+// maxQuoteRunes bounds the snippet of the original a reply quotes.
+const maxQuoteRunes = 40
+
+var errNoSuchMessage = errors.New("no recent message in this room has that ID")
+
+// shortID returns the few characters users type to refer to the message with
+// id. IDs are scrambled first, so messages sent close together do not share
+// a prefix. Short IDs can repeat, but rarely within a room's recent history,
+// and the newest message with one wins.
+func shortID(id uint64) string {
+	id ^= id >> 30
+	id *= 0xbf58476d1ce4e5b9
+	id ^= id >> 27
+	id *= 0x94d049bb133111eb
+	id ^= id >> 31
+	const space = 36 * 36 * 36 * 36
+	s := strconv.FormatUint(id%space, 36)
+	return strings.Repeat("0", shortIDLength-len(s)) + s
+}
+
+// quoteSnippet returns the start of body for quoting in a reply.
+func quoteSnippet(body string) string {
+	if utf8.RuneCountInString(body) <= maxQuoteRunes {
+		return body
+	}
+	runes := []rune(body)
+	return strings.TrimSpace(string(runes[:maxQuoteRunes-1])) + "…"
+}
+
+// findShort returns the newest chat or action message in the history whose
+// short ID is short, with or without a leading "#".
+func (r *Room) findShort(short string) (Message, bool) {
+	short = strings.ToLower(strings.TrimPrefix(short, "#"))
+	return r.history.Last(func(msg Message) bool {
+		return msg.ID != 0 && !msg.Deleted && (msg.Kind == KindChat || msg.Kind == KindAction) && shortID(msg.ID) == short
+	})
+}
+
+// Reply delivers a chat message from the sender that answers the recent
+// message with the short ID to, quoting the start of it.
+func (r *Room) Reply(senderID, senderName, to, text string) (Message, error) {
+	orig, ok := r.findShort(to)
+	if !ok {
+		return Message{}, errNoSuchMessage
+	}
+	return r.broadcastMessage(Message{
+		Timestamp:  r.now(),
+		SenderID:   senderID,
+		SenderName: senderName,
+		Body:       text,
+		Kind:       KindChat,
+		ReplyTo:    orig.ID,
+		ReplyName:  orig.SenderName,
+		ReplyQuote: quoteSnippet(orig.Body),
+	})
+}
+
+// runReply answers a recent message: /reply <id> <text>.
+func runReply(s *session, args string) error {
+	to, text, _ := strings.Cut(strings.TrimSpace(args), " ")
+	text = strings.TrimSpace(text)
+	if to == "" || text == "" {
+		return s.printSystem("usage: /reply <id> <text> (/set ids on shows message IDs)")
+	}
+	msg, err := s.room().Reply(s.client.ID, s.client.Username, to, text)
+	if err != nil {
+		return s.printSystem("/reply: " + err.Error())
+	}
+	if err := s.printMessage(s.renderer.Render(msg)); err != nil {
+		return err
+	}
+	return s.noteTruncated(text)
+}
+
+// setIDs shows or hides the short IDs of messages.
+func (s *session) setIDs(value string) error {
+	if value == "" {
+		return s.printSystem("ids: " + formatSwitch(s.prefs.ids))
+	}
+	on, err := parseSwitch(value)
+	if err != nil {
+		return s.printSystem("/set ids: " + err.Error())
+	}
+	s.prefs.ids = on
+	s.renderer.showIDs = on
+	return s.printSystem("message IDs turned " + formatSwitch(on) + s.savePreferences())
+}
@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortID(t *testing.T) {
+	base := uint64(time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC).UnixNano())
+	seen := make(map[string]bool)
+	for id := base; id < base+50; id++ {
+		short := shortID(id)
+		require.Len(t, short, shortIDLength)
+		require.Equal(t, short, strings.ToLower(short))
+		seen[short] = true
+	}
+	require.Len(t, seen, 50, "consecutive IDs get different short IDs")
+	require.Equal(t, shortID(base), shortID(base), "short IDs are stable")
+}
+
+func TestQuoteSnippet(t *testing.T) {
+	require.Equal(t, "short", quoteSnippet("short"))
+	long := quoteSnippet(strings.Repeat("가", 60))
+	require.Equal(t, maxQuoteRunes, len([]rune(long)))
+	require.True(t, strings.HasSuffix(long, "…"))
+}
+
+func TestRoomReply(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	orig, err := room.Broadcast(alice.ID, "alice", "should we ship the release candidate to everyone today?")
+	require.NoError(t, err)
+	drainChannel(bob.Send())
+	drainChannel(alice.Send())
+
+	_, err = room.Reply(bob.ID, "bob", "zzzz", "yes")
+	require.ErrorIs(t, err, errNoSuchMessage)
+
+	reply, err := room.Reply(bob.ID, "bob", "#"+strings.ToUpper(shortID(orig.ID)), "yes, ship it")
+	require.NoError(t, err)
+	require.Equal(t, KindChat, reply.Kind)
+	require.Equal(t, orig.ID, reply.ReplyTo)
+	require.Equal(t, "alice", reply.ReplyName)
+	require.Equal(t, "should we ship the release candidate to…", reply.ReplyQuote)
+	require.Equal(t, reply, <-alice.Send())
+
+	r := newMessageRenderer()
+	r.setOptions(timestampsHidden, false)
+	require.Equal(t, `bob: [re alice: "should we ship the release candidate to…"] yes, ship it`, r.Render(reply))
+
+	r.showIDs = true
+	require.Equal(t, "#"+shortID(reply.ID)+" bob: "+replyQuote(reply)+"yes, ship it", r.Render(reply))
+	require.Equal(t, "[system] hi", r.Render(Message{Kind: KindSystem, Body: "hi"}), "messages without IDs show none")
+
+	_, err = room.DeleteMessage(alice.ID, orig.ID)
+	require.NoError(t, err)
+	_, err = room.Reply(bob.ID, "bob", shortID(orig.ID), "too late")
+	require.ErrorIs(t, err, errNoSuchMessage, "deleted messages cannot be answered")
+}
+
+func TestReplyCommandAndIDsPreference(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	alice := room.AddClient("alice")
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "bob"})
+	orig, err := room.Broadcast(alice.ID, "alice", "lunch?")
+	require.NoError(t, err)
+
+	require.NoError(t, sess.runCommand("/reply "+shortID(orig.ID)))
+	require.Contains(t, out.String(), "usage: /reply <id> <text>")
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/reply "+shortID(orig.ID)+" sure"))
+	require.Contains(t, out.String(), `bob: [re alice: "lunch?"] sure`)
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/set ids on"))
+	require.Contains(t, out.String(), "message IDs turned on")
+	require.True(t, sess.renderer.showIDs)
+	require.Equal(t, "on", sess.prefs.settings()[idsSetting])
+
+	out.Reset()
+	require.NoError(t, sess.broadcastLine("see you there"))
+	require.Regexp(t, `#[0-9a-z]{4} bob: see you there`, out.String())
+}
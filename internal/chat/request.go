@@ -0,0 +1,40 @@
+package chat
+
+// Request types a session handles, named as in SSH (RFC 4254).
+const (
+	RequestShell        = "shell"
+	RequestPTY          = "pty-req"
+	RequestWindowChange = "window-change"
+	RequestEnv          = "env"
+	RequestExec         = "exec"
+	RequestSubsystem    = "subsystem"
+	RequestSignal       = "signal"
+)
+
+// Request is a control request from the client, sent beside the byte stream:
+// asking for a shell, a subsystem, or a command, describing the terminal, or
+// setting a variable. Transports decode their own requests into Requests, as
+// sshRequests does for SSH channel requests, so sessions do not depend on
+// the transport and tests can drive them with plain values.
+type Request struct {
+	Type string
+	// Term, Cols, and Rows describe the terminal, on pty-req and
+	// window-change; Term is only sent with pty-req.
+	Term string
+	Cols int
+	Rows int
+	// Name and Value are the variable set by env; Name alone names the
+	// subsystem asked for.
+	Name  string
+	Value string
+	// Command is the command line of exec.
+	Command string
+	// Answer replies to the request; nil when the transport expects none.
+	Answer func(ok bool)
+}
+
+func (r *Request) reply(ok bool) {
+	if r.Answer != nil {
+		r.Answer(ok)
+	}
+}
@@ -0,0 +1,97 @@
+package chat
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSessionOverPipes(t *testing.T) {
+	m := newTestManager()
+	alice := m.Lobby().AddClient("alice")
+	drainChannel(alice.Send())
+
+	server, client := newMemPipe()
+	screen := newVTScreen(60, 12)
+	go func() { _, _ = io.Copy(screen, client) }()
+	requests := make(chan *Request)
+	done := make(chan error, 1)
+	go func() {
+		done <- newSession(context.Background(), m.Lobby(), ClientInfo{Username: "pipe", SessionID: "pipe-1"}, server, requests).run()
+	}()
+
+	replies := make(chan bool, 1)
+	answer := func(ok bool) { replies <- ok }
+	for _, req := range []*Request{
+		{Type: RequestPTY, Term: "xterm", Cols: 60, Rows: 12},
+		{Type: RequestEnv, Name: "COLORTERM", Value: "truecolor"},
+		{Type: "x11-req"},
+		{Type: RequestShell},
+	} {
+		req.Answer = answer
+		requests <- req
+		require.Equal(t, req.Type != "x11-req", <-replies, req.Type)
+	}
+	require.Eventually(t, func() bool { return strings.Contains(screen.String(), "Welcome to schat, pipe!") }, 2*time.Second, 5*time.Millisecond, "%s", screen)
+
+	drainChannel(alice.Send())
+	_, err := client.Write([]byte("piped in\r"))
+	require.NoError(t, err)
+	for chat := false; !chat; {
+		select {
+		case msg := <-alice.Send():
+			if chat = msg.Kind == KindChat; chat {
+				require.Equal(t, "pipe", msg.SenderName)
+				require.Equal(t, "piped in", msg.Body)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("the message was not broadcast")
+		}
+	}
+
+	_, err = m.Lobby().Broadcast(alice.ID, "alice", "seen through the pipe")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return strings.Contains(screen.String(), "seen through the pipe") }, 2*time.Second, 5*time.Millisecond, "%s", screen)
+
+	close(requests)
+	require.NoError(t, client.Close())
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the session did not end")
+	}
+}
+
+func TestDecodeSSHRequest(t *testing.T) {
+	pty := decodeSSHRequest(&ssh.Request{Type: "pty-req", Payload: ssh.Marshal(struct {
+		Term                             string
+		Columns, Rows, WidthPx, HeightPx uint32
+		Modes                            string
+	}{Term: "xterm-256color", Columns: 100, Rows: 30})})
+	require.Equal(t, Request{Type: RequestPTY, Term: "xterm-256color", Cols: 100, Rows: 30}, *stripAnswer(pty))
+
+	win := decodeSSHRequest(&ssh.Request{Type: "window-change", Payload: ssh.Marshal(struct{ Columns, Rows, WidthPx, HeightPx uint32 }{120, 40, 0, 0})})
+	require.Equal(t, Request{Type: RequestWindowChange, Cols: 120, Rows: 40}, *stripAnswer(win))
+
+	env := decodeSSHRequest(&ssh.Request{Type: "env", Payload: ssh.Marshal(struct{ Name, Value string }{"LANG", "C"})})
+	require.Equal(t, Request{Type: RequestEnv, Name: "LANG", Value: "C"}, *stripAnswer(env))
+
+	sub := decodeSSHRequest(&ssh.Request{Type: "subsystem", Payload: ssh.Marshal(struct{ Name string }{EventsSubsystem})})
+	require.True(t, isEventsRequest(sub))
+
+	exec := decodeSSHRequest(&ssh.Request{Type: "exec", Payload: ssh.Marshal(struct{ Command string }{"download abc"})})
+	require.Equal(t, "download abc", exec.Command)
+
+	bad := decodeSSHRequest(&ssh.Request{Type: "env", Payload: []byte{1}})
+	require.Equal(t, Request{Type: RequestEnv}, *stripAnswer(bad), "payloads that do not decode leave the fields empty")
+}
+
+func stripAnswer(r *Request) *Request {
+	r.Answer = nil
+	return r
+}
@@ -2,23 +2,117 @@ package chat
 
 import (
 	"fmt"
+	"log/slog"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/ledzpl/schat/pkg/audit"
+	"github.com/ledzpl/schat/pkg/automod"
+	"github.com/ledzpl/schat/pkg/bans"
+	"github.com/ledzpl/schat/pkg/bridge"
+	"github.com/ledzpl/schat/pkg/cluster"
+	"github.com/ledzpl/schat/pkg/features"
+	"github.com/ledzpl/schat/pkg/fileshare"
+	"github.com/ledzpl/schat/pkg/roomstate"
+	"github.com/ledzpl/schat/pkg/sshserver"
+	"github.com/ledzpl/schat/pkg/store"
+	"github.com/ledzpl/schat/pkg/tokens"
+	"github.com/ledzpl/schat/pkg/translate"
+	"github.com/ledzpl/schat/pkg/tui"
+	"github.com/ledzpl/schat/pkg/webhook"
+	"github.com/ledzpl/schat/pkg/wordfilter"
 )
 
+const defaultRoomName = "lobby"
+
 // Room manages the set of connected clients and message fan-out.
 type Room struct {
+	name string
+
 	mu      sync.RWMutex
 	clients map[string]*Client
 
-	sequence atomic.Uint64
+	// sequence numbers client IDs; rooms under one manager share it so IDs stay
+	// unique as clients move between rooms.
+	sequence *atomic.Uint64
 	clock    func() time.Time
 	colors   ColorPicker
-}
 
-const colorReset = "\033[0m"
-const timestampFormat = "2006-01-02 15:04:05"
+	relayWorkers int
+	relay        *relayPool
+	notifier     *notifier
+	watchers     *watchers
+
+	queueSize   int
+	historySize int
+	history     *history
+	operators   map[string]struct{}
+
+	backpressure        BackpressurePolicy
+	backpressureTimeout time.Duration
+
+	autoAway time.Duration
+	// maxMessageLength caps message bodies in runes; 0 is unlimited.
+	maxMessageLength int
+
+	serverName string
+	motd       *MOTD
+	statusBar  *StatusBar
+	goodbye    string
+
+	// templates holds /roomconfig notice overrides; "" disables a notice.
+	templates map[string]string
+	// topic is set with /topic and shown in the status line.
+	topic string
+	// archivedAt is when the room was archived for inactivity; zero while it
+	// is in use.
+	archivedAt time.Time
+	// lastActivity is when the room was created, joined, or written in, in
+	// Unix nanoseconds.
+	lastActivity atomic.Int64
+	// lastMessageID is the ID of the newest chat or action message.
+	lastMessageID atomic.Uint64
+	// seen maps registered users who left the room to the lastMessageID they
+	// left at, so their unread messages can be replayed when they return.
+	seen   map[string]uint64
+	typing *typingTracker
+	// saveMu orders writes of the room's settings to the store.
+	saveMu sync.Mutex
+
+	features *features.Set
+	cluster  *cluster.Cluster
+	backend  roomstate.Backend
+	// shared is the room's presence and messages as backend keeps them.
+	shared     roomstate.Room
+	bridges    *bridge.Supervisor
+	tokens     *tokens.Store
+	accounts   *sshserver.Accounts
+	identities *sshserver.Identities
+	keys       KeyPolicy
+	interrupt  InterruptPolicy
+	plugins    []Plugin
+	translator *translate.Translator
+	wordFilter *wordfilter.Filter
+	automod    *automod.Engine
+	auditLog   *audit.Log
+	bans       *bans.List
+	files      *fileshare.Store
+	store      store.Store
+	// historyRetention is how long store keeps messages, shown by /recording.
+	historyRetention time.Duration
+	webhooks         *webhook.Dispatcher
+	logger           *slog.Logger
+
+	// manager is set for rooms created by a RoomManager.
+	manager *RoomManager
+	owner   string
+	deleted bool
+	// serverLog marks #server-log, which only operators see and nobody writes
+	// in.
+	serverLog bool
+}
 
 // RoomOption customises room construction.
 type RoomOption func(*Room)
@@ -26,9 +120,23 @@ type RoomOption func(*Room)
 // NewRoom constructs an empty chat room.
 func NewRoom(opts ...RoomOption) *Room {
 	room := &Room{
-		clients: make(map[string]*Client),
-		clock:   time.Now,
-		colors:  newRandomColorPicker(defaultColorPalette),
+		name:        defaultRoomName,
+		clients:     make(map[string]*Client),
+		clock:       time.Now,
+		colors:      newRandomColorPicker(defaultColorPalette),
+		queueSize:   defaultQueueSize,
+		historySize: defaultHistorySize,
+		operators:   make(map[string]struct{}),
+		templates:   make(map[string]string),
+		typing:      newTypingTracker(),
+
+		backpressure:        DropOldest,
+		backpressureTimeout: defaultBackpressureTimeout,
+
+		logger:     slog.Default(),
+		serverName: defaultServerName,
+		motd:       mustParseMOTD(defaultMOTD),
+		statusBar:  mustParseStatusBar(nil, nil),
 	}
 
 	for _, opt := range opts {
@@ -36,10 +144,38 @@ func NewRoom(opts ...RoomOption) *Room {
 			opt(room)
 		}
 	}
+	if room.sequence == nil {
+		room.sequence = new(atomic.Uint64)
+	}
+	if room.relay == nil {
+		room.relay = newRelayPool(room.relayWorkers)
+	}
+	if room.notifier == nil {
+		room.notifier = newNotifier()
+	}
+	if room.watchers == nil {
+		room.watchers = newWatchers()
+	}
+	if room.backend == nil {
+		room.backend = roomstate.NewMemory("")
+	}
+	room.shared = room.backend.Room(room.name)
+	room.history = newHistory(room.historySize)
+	room.markActivity(room.now())
+	room.loadSettings()
 
 	return room
 }
 
+// WithName sets the room's display name.
+func WithName(name string) RoomOption {
+	return func(r *Room) {
+		if name != "" {
+			r.name = name
+		}
+	}
+}
+
 // WithClock overrides the clock used for timestamps. Primarily useful in tests.
 func WithClock(clock func() time.Time) RoomOption {
 	return func(r *Room) {
@@ -58,6 +194,52 @@ func WithColorPicker(picker ColorPicker) RoomOption {
 	}
 }
 
+// WithRelayWorkers sets how many goroutines share outbound delivery to sessions.
+// Zero selects a default based on GOMAXPROCS.
+func WithRelayWorkers(n int) RoomOption {
+	return func(r *Room) {
+		if n > 0 {
+			r.relayWorkers = n
+		}
+	}
+}
+
+// WithQueueSize sets the per-client outbound queue length.
+func WithQueueSize(n int) RoomOption {
+	return func(r *Room) {
+		if n > 0 {
+			r.queueSize = n
+		}
+	}
+}
+
+// WithHistorySize sets how many recent messages the room retains in memory.
+func WithHistorySize(n int) RoomOption {
+	return func(r *Room) {
+		if n >= 0 {
+			r.historySize = n
+		}
+	}
+}
+
+// WithOperators grants operator privileges to the listed usernames when a user
+// proves the name: by signing in to it (ClientInfo.Account) or with a key
+// whose saved identity it is. Anyone can connect under a bare name.
+func WithOperators(usernames ...string) RoomOption {
+	return func(r *Room) {
+		for _, name := range usernames {
+			if name != "" {
+				r.operators[name] = struct{}{}
+			}
+		}
+	}
+}
+
+// Name returns the room's display name.
+func (r *Room) Name() string {
+	return r.name
+}
+
 // ClientCount returns the number of active clients in the room.
 func (r *Room) ClientCount() int {
 	r.mu.RLock()
@@ -65,80 +247,289 @@ func (r *Room) ClientCount() int {
 	return len(r.clients)
 }
 
-// AddClient registers a new client and returns it. The caller is responsible for
+// AddClient registers a new client and returns it. The caller vouches for the
+// username, as if the client had signed in to it, and is responsible for
 // removing the client when the session ends.
 func (r *Room) AddClient(username string) *Client {
+	return r.Join(ClientInfo{Username: username, Account: true})
+}
+
+// Join registers a client described by info and announces it to the room. The
+// username is normalized; one that is unusable or looks like someone else's
+// is replaced by the client's ID, and the client is told why. The caller is
+// responsible for removing the client when the session ends.
+func (r *Room) Join(info ClientInfo) *Client {
 	id := fmt.Sprintf("user-%03d", r.sequence.Add(1))
-	if username == "" {
-		username = id
+	username := id
+	var rejected error
+	if info.Username != "" {
+		if name, err := r.checkUsername(info.Username, info.Account); err != nil {
+			r.logger.Warn("chat: username rejected", "username", stripControl(info.Username), "err", err)
+			rejected = err
+		} else {
+			username = name
+		}
 	}
 
-	client := newClient(id, username, r.nextColor())
+	color := info.Color
+	if color == "" {
+		color = r.nextColor()
+	}
+	client := newClientWithQueue(id, username, color, r.queueSize)
+	r.mu.RLock()
+	_, listed := r.operators[username]
+	r.mu.RUnlock()
+	// A name refused above falls back to the client's ID, which proves nothing.
+	client.nameProved = rejected == nil && (info.Account || info.keyBound)
+	client.Operator = info.Operator || listed && client.nameProved
+	client.AuthMethod = info.AuthMethod
+	client.KeyFingerprint = info.KeyFingerprint
+	client.RemoteAddr = info.RemoteAddr
+	client.ClientVersion = info.ClientVersion
+	client.JoinedAt = r.now()
+	client.markActive(client.JoinedAt)
 
+	if rejected != nil {
+		r.showRejectedName(client, info.Username, rejected)
+	}
+	r.admit(client)
+	return client
+}
+
+// admit adds an existing client to the room and announces it. It fails once
+// the room has been deleted.
+func (r *Room) admit(client *Client) bool {
 	r.mu.Lock()
-	r.clients[id] = client
+	if r.deleted {
+		r.mu.Unlock()
+		return false
+	}
+	r.clients[client.ID] = client
+	client.room.Store(r)
 	r.mu.Unlock()
+	if !r.serverLog {
+		r.shared.Join(client.Username)
+	}
 
-	r.broadcastSystem(fmt.Sprintf("%s joined the chat", client.Username))
-	return client
+	r.markActivity(r.now())
+	r.collectUnread(client)
+	r.announce(noticeJoin, fmt.Sprintf("%s joined the chat", client.Username), map[string]string{"user": client.Username})
+	r.showTopic(client)
+	r.showArchived(client)
+	r.pluginsJoined(client)
+	return true
 }
 
-// RemoveClient unregisters the client and closes its outbound channel.
-func (r *Room) RemoveClient(id string) {
-	var client *Client
-
+// release removes the client from the room without closing its queue and
+// reports whether it was present.
+func (r *Room) release(id string) (*Client, bool) {
 	r.mu.Lock()
-	if existing, ok := r.clients[id]; ok {
-		client = existing
+	client, ok := r.clients[id]
+	if ok {
 		delete(r.clients, id)
+		r.clearTyping(id)
+		r.markSeen(client)
 	}
 	r.mu.Unlock()
 
-	if client != nil {
-		close(client.send)
-		r.broadcastSystem(fmt.Sprintf("%s left the chat", client.Username))
+	if ok && !r.serverLog {
+		r.shared.Leave(client.Username)
 	}
+	return client, ok
 }
 
-// Broadcast delivers a message from the sender to all connected clients and returns the formatted line.
-func (r *Room) Broadcast(senderID, senderName, text string) string {
-	ts := r.timestamp()
+// Clients returns the connected clients ordered by join time.
+func (r *Room) Clients() []*Client {
+	r.mu.RLock()
+	clients := make([]*Client, 0, len(r.clients))
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].JoinedAt.Equal(clients[j].JoinedAt) {
+			return clients[i].ID < clients[j].ID
+		}
+		return clients[i].JoinedAt.Before(clients[j].JoinedAt)
+	})
+	return clients
+}
 
+// FindClient looks up a connected client by username.
+func (r *Room) FindClient(username string) (*Client, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	msg := fmt.Sprintf("[%s] %s: %s", ts, r.senderLabelLocked(senderID, senderName), text)
-	r.deliverLocked(senderID, msg)
-
-	return msg
+	for _, client := range r.clients {
+		if client.Username == username {
+			return client, true
+		}
+	}
+	return nil, false
 }
 
-func (r *Room) broadcastSystem(text string) {
-	ts := r.timestamp()
-	msg := fmt.Sprintf("[%s] [system] %s", ts, text)
-
+func (r *Room) client(id string) (*Client, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	r.deliverLocked("", msg)
+	client, ok := r.clients[id]
+	return client, ok
+}
+
+// RemoveClient unregisters the client and closes its outbound channel.
+func (r *Room) RemoveClient(id string) {
+	if client, ok := r.release(id); ok {
+		client.closeSend()
+		r.announce(noticeLeave, fmt.Sprintf("%s left the chat", client.Username), map[string]string{"user": client.Username})
+		r.pluginsLeft(client)
+	}
 }
 
-func (r *Room) senderLabelLocked(senderID, fallbackName string) string {
-	if sender, ok := r.clients[senderID]; ok {
-		if sender.Color == "" {
-			return sender.Username
+// Broadcast delivers a message from the sender to all connected clients and
+// returns it as delivered. It fails when a plugin suppresses the message.
+func (r *Room) Broadcast(senderID, senderName, text string) (Message, error) {
+	return r.broadcastFrom(senderID, senderName, text, KindChat)
+}
+
+// Action delivers a /me emote from the sender to all connected clients and
+// returns it as delivered. It fails when a plugin suppresses the message.
+func (r *Room) Action(senderID, senderName, text string) (Message, error) {
+	return r.broadcastFrom(senderID, senderName, text, KindAction)
+}
+
+func (r *Room) broadcastFrom(senderID, senderName, text string, kind MessageKind) (Message, error) {
+	return r.broadcastMessage(Message{
+		Timestamp:  r.now(),
+		SenderID:   senderID,
+		SenderName: senderName,
+		Body:       text,
+		Kind:       kind,
+	})
+}
+
+// broadcastMessage passes a chat or action message through the plugins,
+// delivers it to every client except its sender, then records and relays it.
+// Escape sequences in the body, and in the names of senders from bridges
+// and other nodes, are removed first, and the body is cut to the room's
+// length limit.
+func (r *Room) broadcastMessage(msg Message) (Message, error) {
+	if _, archived := r.Archived(); archived {
+		return Message{}, errRoomArchived
+	}
+	if r.serverLog {
+		return Message{}, errServerLogReadOnly
+	}
+	msg.Body, msg.SenderName = r.cleanBody(msg.Body), tui.Sanitize(msg.SenderName)
+	r.markActivity(msg.Timestamp)
+	if sender, ok := r.client(msg.SenderID); ok {
+		msg.SenderName = sender.Username
+		msg.SenderColor = sender.Color
+		sender.markActive(msg.Timestamp)
+	}
+	// Messages replicated from another node passed its plugins there.
+	if msg.Node == "" {
+		var err error
+		if msg, err = r.filterMessage(msg); err != nil {
+			return Message{}, err
 		}
-		return fmt.Sprintf("%s%s%s", sender.Color, sender.Username, colorReset)
 	}
-	return fallbackName
+	msg.ID = r.nextMessageID(msg.Timestamp)
+
+	r.mu.RLock()
+	r.history.Add(msg)
+	r.deliverLocked(msg.SenderID, msg)
+	r.mu.RUnlock()
+	if sender, ok := r.client(msg.SenderID); ok {
+		sender.lastSent.Store(&sentMessage{room: r, id: msg.ID})
+	}
+
+	r.persist(msg)
+	r.sendWebhooks(msg)
+	r.watchers.publish(r.name, msg)
+	r.relayToBridges(msg)
+	r.replicate(msg)
+	r.notifyMentions(msg)
+	return msg, nil
 }
 
-func (r *Room) deliverLocked(excludeID, msg string) {
+// SendDirect delivers a private message from the sender to the named user only.
+// It returns the message and the recipient so the caller can echo it and
+// surface the recipient's presence.
+func (r *Room) SendDirect(senderID, recipientName, text string) (Message, *Client, error) {
+	msg := Message{
+		Timestamp: r.now(),
+		SenderID:  senderID,
+		Body:      r.cleanBody(text),
+		Kind:      KindDirect,
+	}
+
+	recipient, ok := r.FindClient(recipientName)
+	if !ok {
+		return Message{}, nil, errNoSuchUser
+	}
+	if sender, ok := r.client(senderID); ok {
+		msg.SenderName = sender.Username
+		msg.SenderColor = sender.Color
+	}
+	msg.RecipientID = recipient.ID
+	msg.RecipientName = recipient.Username
+	msg, err := r.filterMessage(msg)
+	if err != nil {
+		return Message{}, nil, err
+	}
+
+	r.mu.RLock()
+	// The recipient may have left while the plugins ran.
+	present := r.clients[recipient.ID] == recipient
+	if present {
+		recipient.deliver(msg, r.backpressure, r.backpressureTimeout)
+	}
+	r.mu.RUnlock()
+	if !present {
+		return Message{}, nil, errNoSuchUser
+	}
+	r.notify(recipient.Username, Event{
+		Type:    EventDirect,
+		From:    msg.SenderName,
+		Summary: msg.SenderName + " sent you a direct message",
+		Body:    msg.Body,
+	})
+	return msg, recipient, nil
+}
+
+func (r *Room) broadcastSystem(text string) {
+	msg := Message{
+		Timestamp: r.now(),
+		Body:      text,
+		Kind:      KindSystem,
+	}
+
+	r.mu.RLock()
+	r.history.Add(msg)
+	r.deliverLocked("", msg)
+	r.mu.RUnlock()
+
+	r.persist(msg)
+	r.sendWebhooks(msg)
+	r.watchers.publish(r.name, msg)
+}
+
+func (r *Room) deliverLocked(excludeID string, msg Message) {
+	var blocked []*Client
 	for id, client := range r.clients {
 		if id == excludeID {
 			continue
 		}
-		client.tryDeliver(msg)
+		if r.backpressure == BlockWithTimeout {
+			// Queue for everyone first, then wait for the slow ones together.
+			if !client.enqueue(msg) {
+				blocked = append(blocked, client)
+			}
+			continue
+		}
+		client.deliver(msg, r.backpressure, r.backpressureTimeout)
 	}
+	blockAll(blocked, msg, r.backpressureTimeout)
 }
 
 func (r *Room) nextColor() string {
@@ -148,9 +539,9 @@ func (r *Room) nextColor() string {
 	return r.colors.Next()
 }
 
-func (r *Room) timestamp() string {
+func (r *Room) now() time.Time {
 	if r.clock == nil {
-		return time.Now().Format(timestampFormat)
+		return time.Now()
 	}
-	return r.clock().Format(timestampFormat)
+	return r.clock()
 }
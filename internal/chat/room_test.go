@@ -1,10 +1,13 @@
 package chat
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
 )
 
 func TestRoomBroadcastDeliversToOtherClients(t *testing.T) {
@@ -19,9 +22,11 @@ func TestRoomBroadcastDeliversToOtherClients(t *testing.T) {
 	drainChannel(alice.Send())
 	drainChannel(bob.Send())
 
-	msg := room.Broadcast(alice.ID, alice.Username, "hello world")
-	require.Contains(t, msg, "hello world")
-	require.Contains(t, msg, "alice")
+	msg, err := room.Broadcast(alice.ID, alice.Username, "hello world")
+	require.NoError(t, err)
+	require.Equal(t, "hello world", msg.Body)
+	require.Equal(t, "alice", msg.SenderName)
+	require.Equal(t, KindChat, msg.Kind)
 
 	select {
 	case delivered := <-bob.Send():
@@ -32,7 +37,7 @@ func TestRoomBroadcastDeliversToOtherClients(t *testing.T) {
 
 	select {
 	case unexpected := <-alice.Send():
-		t.Fatalf("sender should not receive message, got %q", unexpected)
+		t.Fatalf("sender should not receive message, got %+v", unexpected)
 	default:
 	}
 }
@@ -52,7 +57,7 @@ func TestRoomRemoveClientClosesChannel(t *testing.T) {
 	}
 }
 
-func drainChannel(ch <-chan string) {
+func drainChannel(ch <-chan Message) {
 	for {
 		select {
 		case <-ch:
@@ -69,3 +74,84 @@ type staticColorPicker struct {
 func (p *staticColorPicker) Next() string {
 	return p.color
 }
+
+func TestRoomMemoryStatsTracksQueuesAndHistory(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithHistorySize(2))
+
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	drainChannel(alice.Send())
+	drainChannel(bob.Send())
+
+	room.Broadcast(alice.ID, alice.Username, "one")
+	room.Broadcast(alice.ID, alice.Username, "two")
+	msg, err := room.Broadcast(alice.ID, alice.Username, "three")
+	require.NoError(t, err)
+
+	stats := room.MemoryStats()
+	require.Equal(t, 2, stats.Clients)
+	require.Equal(t, 2, stats.HistoryMessages, "history is capped")
+	require.Equal(t, 3, stats.QueuedMessages, "bob has three queued messages")
+	require.Positive(t, stats.QueuedBytes)
+	require.Equal(t, "bob", stats.Sessions[0].Username)
+
+	recent := room.history.Recent(0)
+	require.Len(t, recent, 2)
+	require.Equal(t, msg, recent[1])
+}
+
+func TestRoomJoinGrantsListedOperators(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithOperators("root"))
+
+	require.True(t, room.Join(ClientInfo{Username: "root", Account: true}).Operator)
+	require.False(t, room.Join(ClientInfo{Username: "root"}).Operator, "a bare name proves nothing")
+	require.False(t, room.Join(ClientInfo{Username: "root", AuthMethod: "publickey", KeyFingerprint: "SHA256:any"}).Operator)
+	require.False(t, room.Join(ClientInfo{Username: "guest", Account: true}).Operator)
+	require.True(t, room.Join(ClientInfo{Username: "admin", Operator: true}).Operator)
+}
+
+func TestActionIsItsOwnKind(t *testing.T) {
+	st := store.NewMemory()
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithStore(st))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	drainChannel(bob.Send())
+
+	sent, err := room.Action(alice.ID, "alice", "waves at @bob")
+	require.NoError(t, err)
+	require.Equal(t, KindAction, sent.Kind)
+	got := <-bob.Send()
+	require.Equal(t, KindAction, got.Kind)
+	require.Equal(t, "waves at @bob", got.Body)
+
+	text, err := got.Kind.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "action", string(text))
+	var kind MessageKind
+	require.NoError(t, kind.UnmarshalText(text))
+	require.Equal(t, KindAction, kind)
+
+	stored, err := room.Search(context.Background(), "waves", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	require.Equal(t, KindAction, stored[0].Kind)
+	require.Equal(t, "[0001-01-01 00:00:00] * alice waves at @bob", formatSearchResult(Message{SenderName: "alice", Body: "waves at @bob", Kind: KindAction}))
+}
+
+func TestBroadcastStripsEscapeSequences(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	alice := room.AddClient("alice")
+	alice.Color = "\033[31m"
+	bob := room.AddClient("bob")
+	drainChannel(bob.Send())
+
+	_, err := room.Broadcast(alice.ID, "alice", "\x1b[2J\x1b[H\x1b]0;owned\x07hi \x1b[5mthere\x1b[0m\u009b6n")
+	require.NoError(t, err)
+	got := <-bob.Send()
+	require.Equal(t, "hi there", got.Body)
+	require.Contains(t, newMessageRenderer().Render(got), "\033[31malice\033[0m: hi there", "the sender's color is kept")
+
+	_, _, err = room.SendDirect(alice.ID, "bob", "psst\x1bc")
+	require.NoError(t, err)
+	require.Equal(t, "psst", (<-bob.Send()).Body)
+}
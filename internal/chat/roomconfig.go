@@ -0,0 +1,295 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Notice events whose text rooms can customise with /roomconfig.
+const (
+	noticeJoin  = "join"
+	noticeLeave = "leave"
+	noticeAway  = "away"
+	noticeBack  = "back"
+)
+
+// noticePlaceholders lists, in /roomconfig order, the placeholders each
+// customisable notice accepts.
+var noticePlaceholders = []struct {
+	event        string
+	placeholders []string
+}{
+	{noticeJoin, []string{"user", "room"}},
+	{noticeLeave, []string{"user", "room"}},
+	{noticeAway, []string{"user", "room", "reason"}},
+	{noticeBack, []string{"user", "room"}},
+}
+
+// maxTemplateLength bounds custom templates so notices stay short.
+const maxTemplateLength = 200
+
+// templateSettingPrefix namespaces templates among a room's persisted settings.
+const templateSettingPrefix = "template."
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{([a-z]+)\}`)
+
+	errUnknownNotice = errors.New("unknown notice; try join, leave, away, or back")
+)
+
+// parseTemplate validates a custom template for event. Templates are plain
+// text: control characters, which could smuggle terminal escape sequences, are
+// rejected, and only the event's placeholders may be used.
+func parseTemplate(event, text string) (string, error) {
+	allowed, ok := placeholdersFor(event)
+	if !ok {
+		return "", errUnknownNotice
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", errors.New("template must not be empty; use off to disable the notice")
+	}
+	if len(text) > maxTemplateLength {
+		return "", fmt.Errorf("templates are limited to %d bytes", maxTemplateLength)
+	}
+	if strings.IndexFunc(text, unicode.IsControl) >= 0 {
+		return "", errors.New("templates cannot contain control characters")
+	}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if !containsString(allowed, m[1]) {
+			return "", fmt.Errorf("unknown placeholder %s; %s notices accept {%s}", m[0], event, strings.Join(allowed, "}, {"))
+		}
+	}
+	return text, nil
+}
+
+func placeholdersFor(event string) ([]string, bool) {
+	for _, n := range noticePlaceholders {
+		if n.event == event {
+			return n.placeholders, true
+		}
+	}
+	return nil, false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// expandTemplate fills in placeholders in one pass, so values that look like
+// placeholders are never expanded themselves. Control characters are dropped
+// from values.
+func expandTemplate(tmpl string, vars map[string]string) string {
+	pairs := make([]string, 0, 2*len(vars))
+	for name, value := range vars {
+		pairs = append(pairs, "{"+name+"}", stripControl(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(tmpl)
+}
+
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// announce broadcasts the notice for event: the room's custom template when
+// one is set, otherwise fallback. Disabled notices are not sent.
+func (r *Room) announce(event, fallback string, vars map[string]string) {
+	r.mu.RLock()
+	tmpl, custom := r.templates[event]
+	r.mu.RUnlock()
+
+	switch {
+	case !custom:
+		r.broadcastSystem(fallback)
+	case tmpl != "":
+		vars["room"] = r.name
+		r.broadcastSystem(expandTemplate(tmpl, vars))
+	}
+}
+
+// SetTemplate customises the notice for event; an empty tmpl disables it.
+func (r *Room) SetTemplate(event, tmpl string) error {
+	if tmpl != "" {
+		var err error
+		if tmpl, err = parseTemplate(event, tmpl); err != nil {
+			return err
+		}
+	} else if _, ok := placeholdersFor(event); !ok {
+		return errUnknownNotice
+	}
+
+	r.mu.Lock()
+	r.templates[event] = tmpl
+	r.mu.Unlock()
+	return r.saveSettings()
+}
+
+// ResetTemplate restores the built-in notice for event.
+func (r *Room) ResetTemplate(event string) error {
+	if _, ok := placeholdersFor(event); !ok {
+		return errUnknownNotice
+	}
+	r.mu.Lock()
+	delete(r.templates, event)
+	r.mu.Unlock()
+	return r.saveSettings()
+}
+
+// Template returns the custom template for event and whether one is set. An
+// empty template means the notice is disabled.
+func (r *Room) Template(event string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tmpl, ok := r.templates[event]
+	return tmpl, ok
+}
+
+// settingsLocked returns the room settings to persist. r.mu must be held.
+func (r *Room) settingsLocked() map[string]string {
+	settings := make(map[string]string, len(r.templates)+1)
+	for event, tmpl := range r.templates {
+		settings[templateSettingPrefix+event] = tmpl
+	}
+	if r.topic != "" {
+		settings[topicSetting] = r.topic
+	}
+	if !r.archivedAt.IsZero() {
+		settings[archivedSetting] = r.archivedAt.UTC().Format(time.RFC3339)
+	}
+	return settings
+}
+
+// saveSettings persists the room's settings when the room has a store.
+func (r *Room) saveSettings() error {
+	if r.store == nil {
+		return nil
+	}
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+
+	r.mu.RLock()
+	settings := r.settingsLocked()
+	r.mu.RUnlock()
+	if err := r.store.SaveRoomSettings(context.Background(), r.name, settings); err != nil {
+		r.logger.Error("chat: save room settings failed", "room", r.name, "err", err)
+		return errors.New("the change applies now but could not be saved")
+	}
+	return nil
+}
+
+// loadSettings restores settings saved by an earlier room of the same name.
+func (r *Room) loadSettings() {
+	if r.store == nil {
+		return
+	}
+	settings, err := r.store.RoomSettings(context.Background(), r.name)
+	if err != nil {
+		r.logger.Error("chat: load room settings failed", "room", r.name, "err", err)
+		return
+	}
+	for key, value := range settings {
+		if key == archivedSetting {
+			if at, err := time.Parse(time.RFC3339, value); err != nil {
+				r.logger.Warn("chat: ignoring saved archive time", "room", r.name, "err", err)
+			} else {
+				r.archivedAt = at
+			}
+			continue
+		}
+		if key == topicSetting {
+			if topic, err := parseTopic(value); err != nil {
+				r.logger.Warn("chat: ignoring saved topic", "room", r.name, "err", err)
+			} else {
+				r.topic = topic
+			}
+			continue
+		}
+		event, ok := strings.CutPrefix(key, templateSettingPrefix)
+		if !ok {
+			continue
+		}
+		if value != "" {
+			if _, err := parseTemplate(event, value); err != nil {
+				r.logger.Warn("chat: ignoring saved template", "room", r.name, "event", event, "err", err)
+				continue
+			}
+		}
+		r.templates[event] = value
+	}
+}
+
+// clearSettings forgets the persisted settings of a deleted room so a new
+// room with the same name starts fresh.
+func (r *Room) clearSettings() {
+	if r.store == nil {
+		return
+	}
+	if err := r.store.SaveRoomSettings(context.Background(), r.name, nil); err != nil {
+		r.logger.Error("chat: clear room settings failed", "room", r.name, "err", err)
+	}
+}
+
+// runRoomConfig shows or changes the current room's notice templates.
+func runRoomConfig(s *session, args string) error {
+	room := s.room()
+	event, value, _ := strings.Cut(args, " ")
+	event = strings.ToLower(event)
+	value = strings.TrimSpace(value)
+
+	if event == "" {
+		lines := []string{fmt.Sprintf("#%s notices:", room.Name())}
+		for _, n := range noticePlaceholders {
+			line := fmt.Sprintf("  %-6s default", n.event)
+			if tmpl, ok := room.Template(n.event); ok && tmpl == "" {
+				line = fmt.Sprintf("  %-6s off", n.event)
+			} else if ok {
+				line = fmt.Sprintf("  %-6s %s", n.event, tmpl)
+			}
+			lines = append(lines, line+fmt.Sprintf("  ({%s})", strings.Join(n.placeholders, "}, {")))
+		}
+		return s.printSystem(lines...)
+	}
+	if value == "" {
+		return s.printSystem("usage: /roomconfig [<join|leave|away|back> <template> | off | default]")
+	}
+	if !room.canManage(s.client) {
+		return s.printSystem(fmt.Sprintf("/roomconfig: %v", errNotRoomManager))
+	}
+
+	var err error
+	switch value {
+	case "off":
+		err = room.SetTemplate(event, "")
+	case "default":
+		err = room.ResetTemplate(event)
+	default:
+		err = room.SetTemplate(event, value)
+	}
+	if err != nil {
+		return s.printSystem(fmt.Sprintf("/roomconfig: %v", err))
+	}
+	switch value {
+	case "off":
+		return s.printSystem(fmt.Sprintf("%s notices are off in #%s", event, room.Name()))
+	case "default":
+		return s.printSystem(fmt.Sprintf("%s notices in #%s use the default text", event, room.Name()))
+	default:
+		tmpl, _ := room.Template(event)
+		return s.printSystem(fmt.Sprintf("%s notices in #%s: %s", event, room.Name(), tmpl))
+	}
+}
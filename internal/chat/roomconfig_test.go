@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		event, text string
+		want        string
+		err         string
+	}{
+		{event: "join", text: "  → {user} arrived in #{room} ", want: "→ {user} arrived in #{room}"},
+		{event: "away", text: "{user} stepped out ({reason})", want: "{user} stepped out ({reason})"},
+		{event: "back", text: "{user} is back: {reason}", err: "unknown placeholder {reason}; back notices accept {user}, {room}"},
+		{event: "join", text: "{user} \x1b[31mjoined", err: "control characters"},
+		{event: "join", text: "", err: "must not be empty"},
+		{event: "topic", text: "{user}", err: "unknown notice"},
+		{event: "join", text: "literal {braces} and { user }", err: "unknown placeholder {braces}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event+" "+tt.text, func(t *testing.T) {
+			got, err := parseTemplate(tt.event, tt.text)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRoomTemplates(t *testing.T) {
+	room := NewRoom(WithName("dev"))
+	watcher := room.AddClient("watcher")
+	drainChannel(watcher.Send())
+
+	require.NoError(t, room.SetTemplate(noticeJoin, "{user} arrived in #{room}"))
+	require.NoError(t, room.SetTemplate(noticeLeave, ""))
+	require.NoError(t, room.SetTemplate(noticeAway, "{user} stepped out ({reason})"))
+
+	alice := room.AddClient("{room}\x1b[2J")
+	require.Equal(t, "{room}[2J arrived in #dev", (<-watcher.Send()).Body, "values are neither expanded nor allowed to carry escapes")
+	require.NoError(t, room.SetAway(alice.ID, "lunch"))
+	require.Equal(t, "{room}[2J stepped out (lunch)", (<-watcher.Send()).Body)
+	require.NoError(t, room.SetBack(alice.ID))
+	require.Equal(t, "{room}[2J is back", (<-watcher.Send()).Body, "notices without a template keep the built-in text, and names lose their escapes on joining")
+
+	room.RemoveClient(alice.ID)
+	require.Empty(t, watcher.Send(), "disabled notices are not sent")
+
+	require.NoError(t, room.ResetTemplate(noticeJoin))
+	room.AddClient("bob")
+	require.Equal(t, "bob joined the chat", (<-watcher.Send()).Body)
+}
+
+func TestRoomTemplatesPersist(t *testing.T) {
+	st := store.NewMemory()
+	m := newTestManager(WithRoomOptions(WithStore(st)))
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	require.NoError(t, dev.SetTemplate(noticeJoin, "hi {user}"))
+	require.NoError(t, dev.SetTemplate(noticeLeave, ""))
+
+	restarted := newTestManager(WithRoomOptions(WithStore(st)))
+	dev, err = restarted.Create("dev", "alice")
+	require.NoError(t, err)
+	tmpl, ok := dev.Template(noticeJoin)
+	require.True(t, ok)
+	require.Equal(t, "hi {user}", tmpl)
+	tmpl, ok = dev.Template(noticeLeave)
+	require.True(t, ok)
+	require.Empty(t, tmpl)
+
+	owner := dev.AddClient("alice")
+	require.NoError(t, restarted.Delete(dev, owner))
+	settings, err := st.RoomSettings(context.Background(), "dev")
+	require.NoError(t, err)
+	require.Empty(t, settings, "deleting a room forgets its settings")
+}
+
+func TestRoomConfigCommand(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+
+	owner, out := newCommandTestSession(dev, ClientInfo{Username: "alice", Account: true})
+	require.NoError(t, owner.runCommand("/roomconfig join → {user} is here"))
+	require.Contains(t, out.String(), "join notices in #dev: → {user} is here")
+	require.NoError(t, owner.runCommand("/roomconfig leave off"))
+	require.Contains(t, out.String(), "leave notices are off in #dev")
+	require.NoError(t, owner.runCommand("/roomconfig join {nick}"))
+	require.Contains(t, out.String(), "/roomconfig: unknown placeholder {nick}")
+
+	out.Reset()
+	require.NoError(t, owner.runCommand("/roomconfig"))
+	require.Contains(t, out.String(), "join   → {user} is here  ({user}, {room})")
+	require.Contains(t, out.String(), "leave  off")
+	require.Contains(t, out.String(), "away   default  ({user}, {room}, {reason})")
+
+	member, out := newCommandTestSession(dev, ClientInfo{Username: "bob"})
+	require.NoError(t, member.runCommand("/roomconfig join hi"))
+	require.Contains(t, out.String(), "/roomconfig: only the room owner or an operator can do that")
+	require.NoError(t, member.runCommand("/roomconfig join"))
+	require.Contains(t, out.String(), "usage: /roomconfig")
+}
@@ -0,0 +1,153 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// deleteConfirmWindow is how long "/room delete confirm" stays valid.
+const deleteConfirmWindow = 30 * time.Second
+
+// pendingDelete records a /room delete awaiting confirmation.
+type pendingDelete struct {
+	room    *Room
+	expires time.Time
+}
+
+// runRooms lists the rooms; archived ones only with /rooms all.
+func runRooms(s *session, args string) error {
+	manager := s.room().manager
+	if manager == nil {
+		return s.printSystem(errRoomsDisabled.Error())
+	}
+	all := strings.EqualFold(args, "all")
+	if args != "" && !all {
+		return s.printSystem("usage: /rooms [all]")
+	}
+
+	var lines []string
+	hidden := 0
+	for _, room := range manager.Rooms() {
+		if !room.visibleTo(s.client) {
+			continue
+		}
+		at, archived := room.Archived()
+		if archived && !all {
+			hidden++
+			continue
+		}
+		line := fmt.Sprintf("  #%-16s %d online", room.Name(), room.ClientCount())
+		if owner := room.Owner(); owner != "" {
+			line += "  owner " + owner
+		}
+		if archived {
+			line += "  archived " + at.Format(time.DateOnly)
+		}
+		lines = append(lines, line)
+	}
+	lines = append([]string{fmt.Sprintf("%d rooms:", len(lines))}, lines...)
+	if hidden > 0 {
+		lines = append(lines, fmt.Sprintf("%d archived rooms not shown; /rooms all to list them", hidden))
+	}
+	return s.printSystem(lines...)
+}
+
+// runJoin moves the session to a room, creating it with the caller as owner
+// when it does not exist yet.
+func runJoin(s *session, args string) error {
+	manager := s.room().manager
+	if manager == nil {
+		return s.printSystem(errRoomsDisabled.Error())
+	}
+	if args == "" {
+		return s.printSystem("usage: /join <room>")
+	}
+
+	room, ok := manager.Room(args)
+	if !ok {
+		var err error
+		if room, err = manager.Create(args, s.client.Username); err != nil {
+			return s.printSystem(fmt.Sprintf("/join: %v", err))
+		}
+	}
+	if room == s.room() {
+		return s.printSystem(fmt.Sprintf("you are already in #%s", room.Name()))
+	}
+	if err := manager.Move(s.client, room); err != nil {
+		return s.printSystem(fmt.Sprintf("/join: %v", err))
+	}
+	return s.showUnread()
+}
+
+// runRoom shows the current room or runs an ownership subcommand.
+func runRoom(s *session, args string) error {
+	room := s.room()
+	sub, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch strings.ToLower(sub) {
+	case "":
+		lines := []string{fmt.Sprintf("#%s: %d online", room.Name(), room.ClientCount())}
+		if owner := room.Owner(); owner != "" {
+			lines = append(lines, "  owner: "+owner)
+		}
+		if at, archived := room.Archived(); archived {
+			lines = append(lines, "  archived: "+at.Format(time.DateOnly)+" (read-only; /room unarchive to revive it)")
+		}
+		return s.printSystem(lines...)
+	case "transfer":
+		return runRoomTransfer(s, room, rest)
+	case "delete":
+		return runRoomDelete(s, room, rest)
+	case "unarchive":
+		return runRoomUnarchive(s, room)
+	default:
+		return s.printSystem("usage: /room [transfer <user> | delete [confirm] | unarchive]")
+	}
+}
+
+func runRoomTransfer(s *session, room *Room, to string) error {
+	if room.manager == nil {
+		return s.printSystem(errRoomsDisabled.Error())
+	}
+	if to == "" {
+		return s.printSystem("usage: /room transfer <user>")
+	}
+	if err := room.manager.Transfer(room, s.client, to); err != nil {
+		return s.printSystem(fmt.Sprintf("/room transfer: %v", err))
+	}
+	return nil
+}
+
+func runRoomDelete(s *session, room *Room, arg string) error {
+	manager := room.manager
+	if manager == nil {
+		return s.printSystem(errRoomsDisabled.Error())
+	}
+	if room == manager.Lobby() {
+		return s.printSystem(fmt.Sprintf("/room delete: %v", errLobbyProtected))
+	}
+	if !room.canManage(s.client) {
+		return s.printSystem(fmt.Sprintf("/room delete: %v", errNotRoomManager))
+	}
+
+	now := room.now()
+	if arg != "confirm" {
+		s.pendingDelete = &pendingDelete{room: room, expires: now.Add(deleteConfirmWindow)}
+		return s.printSystem(
+			fmt.Sprintf("this deletes #%s and moves its %d members to #%s", room.Name(), room.ClientCount(), manager.Lobby().Name()),
+			fmt.Sprintf("type /room delete confirm within %s to proceed", deleteConfirmWindow),
+		)
+	}
+
+	pending := s.pendingDelete
+	s.pendingDelete = nil
+	if pending == nil || pending.room != room || now.After(pending.expires) {
+		return s.printSystem("nothing to confirm; run /room delete first")
+	}
+	if err := manager.Delete(room, s.client); err != nil {
+		return s.printSystem(fmt.Sprintf("/room delete: %v", err))
+	}
+	return nil
+}
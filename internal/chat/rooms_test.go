@@ -0,0 +1,74 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinCreatesAndSwitchesRooms(t *testing.T) {
+	m := newTestManager()
+	sess, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "alice"})
+
+	require.NoError(t, sess.runCommand("/join #dev"))
+	require.Equal(t, "dev", sess.room().Name())
+	require.Equal(t, "alice", sess.room().Owner())
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/rooms"))
+	require.Contains(t, out.String(), "#lobby")
+	require.Regexp(t, `#dev\s+1 online  owner alice`, out.String())
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/join dev"))
+	require.Contains(t, out.String(), "already in #dev")
+}
+
+func TestRoomDeleteNeedsConfirmation(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	m := newTestManager(WithRoomOptions(WithClock(func() time.Time { return now })))
+	sess, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "alice", Account: true})
+	require.NoError(t, sess.runCommand("/join dev"))
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/room delete confirm"))
+	require.Contains(t, out.String(), "nothing to confirm")
+
+	require.NoError(t, sess.runCommand("/room delete"))
+	require.Contains(t, out.String(), "type /room delete confirm")
+	now = now.Add(time.Minute)
+	require.NoError(t, sess.runCommand("/room delete confirm"))
+	require.Equal(t, "dev", sess.room().Name(), "confirmation expired")
+
+	require.NoError(t, sess.runCommand("/room delete"))
+	require.NoError(t, sess.runCommand("/room delete confirm"))
+	require.Same(t, m.Lobby(), sess.room())
+	_, ok := m.Room("dev")
+	require.False(t, ok)
+}
+
+func TestRoomCommandsPermissions(t *testing.T) {
+	m := newTestManager()
+	owner, _ := newCommandTestSession(m.Lobby(), ClientInfo{Username: "alice", Account: true})
+	require.NoError(t, owner.runCommand("/join dev"))
+
+	guest, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "bob"})
+	require.NoError(t, guest.runCommand("/join dev"))
+
+	require.NoError(t, guest.runCommand("/room delete"))
+	require.Contains(t, out.String(), errNotRoomManager.Error())
+
+	require.NoError(t, owner.runCommand("/room transfer bob"))
+	require.Equal(t, "bob", guest.room().Owner())
+
+	out.Reset()
+	require.NoError(t, guest.runCommand("/room"))
+	require.Contains(t, out.String(), "owner: bob")
+}
+
+func TestRoomCommandsWithoutManager(t *testing.T) {
+	sess, out := newCommandTestSession(NewRoom(), ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/join dev"))
+	require.Contains(t, out.String(), errRoomsDisabled.Error())
+}
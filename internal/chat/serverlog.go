@@ -0,0 +1,166 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// serverLogRoomName is the room ServerLog streams into.
+const serverLogRoomName = "server-log"
+
+// serverLogBuffer is how many log lines wait for the room before new ones are
+// dropped.
+const serverLogBuffer = 256
+
+var (
+	errOperatorsOnly     = errors.New("only operators can join #" + serverLogRoomName)
+	errServerLogReadOnly = errors.New("#" + serverLogRoomName + " is read-only")
+	errServerLogBuiltin  = errors.New("#" + serverLogRoomName + " cannot be transferred or deleted")
+)
+
+// ServerLog streams server log records into #server-log, a room only
+// operators may join, so they can watch the server without a shell on its
+// host. Lines are never stored, relayed, or sent to webhooks.
+type ServerLog struct {
+	level   slog.LevelVar
+	lines   chan Message
+	dropped atomic.Int64
+}
+
+// NewServerLog streams records at level and above.
+func NewServerLog(level slog.Level) *ServerLog {
+	l := &ServerLog{lines: make(chan Message, serverLogBuffer)}
+	l.level.Set(level)
+	return l
+}
+
+// SetLevel changes the minimum level streamed, e.g. on a config reload.
+func (l *ServerLog) SetLevel(level slog.Level) {
+	l.level.Set(level)
+}
+
+// Handler returns a handler that passes every record to next and copies
+// those at the streamed level into the room.
+func (l *ServerLog) Handler(next slog.Handler) slog.Handler {
+	return &serverLogHandler{
+		next: next,
+		log:  l,
+		text: slog.NewTextHandler(serverLogWriter{l}, &slog.HandlerOptions{
+			Level: &l.level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				// Messages carry their own time.
+				if len(groups) == 0 && a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}),
+	}
+}
+
+// serverLogHandler tees records between the server's handler and the room.
+type serverLogHandler struct {
+	next slog.Handler
+	log  *ServerLog
+	text slog.Handler
+}
+
+func (h *serverLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level) || h.text.Enabled(ctx, level)
+}
+
+func (h *serverLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.next.Enabled(ctx, r.Level) {
+		err = h.next.Handle(ctx, r)
+	}
+	if h.text.Enabled(ctx, r.Level) && !aboutServerLog(r) {
+		_ = h.text.Handle(ctx, r)
+	}
+	return err
+}
+
+func (h *serverLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &serverLogHandler{next: h.next.WithAttrs(attrs), log: h.log, text: h.text.WithAttrs(attrs)}
+}
+
+func (h *serverLogHandler) WithGroup(name string) slog.Handler {
+	return &serverLogHandler{next: h.next.WithGroup(name), log: h.log, text: h.text.WithGroup(name)}
+}
+
+// aboutServerLog reports whether r concerns the log room itself, which would
+// otherwise feed back into it.
+func aboutServerLog(r slog.Record) bool {
+	about := false
+	r.Attrs(func(a slog.Attr) bool {
+		about = a.Key == "room" && a.Value.String() == serverLogRoomName
+		return !about
+	})
+	return about
+}
+
+// serverLogWriter queues each line the text handler writes as a message.
+type serverLogWriter struct {
+	log *ServerLog
+}
+
+func (w serverLogWriter) Write(p []byte) (int, error) {
+	msg := Message{Timestamp: time.Now(), Body: strings.TrimRight(string(p), "\n"), Kind: KindSystem}
+	select {
+	case w.log.lines <- msg:
+	default:
+		w.log.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// WithServerLog adds #server-log to the manager and streams l into it while
+// Run runs.
+func WithServerLog(l *ServerLog) ManagerOption {
+	return func(m *RoomManager) {
+		m.serverLog = l
+	}
+}
+
+// addServerLogRoom creates #server-log when the manager streams a log.
+func (m *RoomManager) addServerLogRoom() {
+	if m.serverLog == nil {
+		return
+	}
+	room := m.newRoom([]RoomOption{WithName(serverLogRoomName), func(r *Room) { r.serverLog = true }})
+	m.rooms[room.Name()] = room
+}
+
+// streamServerLog posts queued log lines into #server-log until ctx is
+// cancelled.
+func (m *RoomManager) streamServerLog(ctx context.Context) {
+	room, ok := m.Room(serverLogRoomName)
+	if !ok {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-m.serverLog.lines:
+			if n := m.serverLog.dropped.Swap(0); n > 0 {
+				room.postLog(Message{Timestamp: msg.Timestamp, Body: fmt.Sprintf("%d log lines were dropped while the room caught up", n), Kind: KindSystem})
+			}
+			room.postLog(msg)
+		}
+	}
+}
+
+// postLog shows a log line to the operators in the room and keeps it in the
+// room's history, without storing or relaying it.
+func (r *Room) postLog(msg Message) {
+	r.mu.RLock()
+	r.history.Add(msg)
+	r.deliverLocked("", msg)
+	r.mu.RUnlock()
+}
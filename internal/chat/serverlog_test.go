@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/store"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveMessage(t *testing.T, ch <-chan Message) Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message arrived")
+		return Message{}
+	}
+}
+
+func TestServerLogRoomIsForOperators(t *testing.T) {
+	m := newTestManager(WithServerLog(NewServerLog(slog.LevelWarn)))
+	op, opOut := newCommandTestSession(m.Lobby(), ClientInfo{Username: "root", Operator: true})
+	guest, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "bob"})
+
+	require.NoError(t, guest.runCommand("/join server-log"))
+	require.Contains(t, out.String(), errOperatorsOnly.Error())
+	require.Same(t, m.Lobby(), guest.room())
+	out.Reset()
+	require.NoError(t, guest.runCommand("/rooms"))
+	require.NotContains(t, out.String(), "server-log")
+
+	require.NoError(t, op.runCommand("/rooms"))
+	require.Contains(t, opOut.String(), "#server-log")
+	require.NoError(t, op.runCommand("/join #server-log"))
+	require.Equal(t, serverLogRoomName, op.room().Name())
+
+	opOut.Reset()
+	require.NoError(t, op.broadcastLine("hello?"))
+	require.Contains(t, opOut.String(), errServerLogReadOnly.Error())
+	require.ErrorIs(t, m.Delete(op.room(), op.client), errServerLogBuiltin)
+	require.ErrorIs(t, m.Transfer(op.room(), op.client, "root"), errServerLogBuiltin)
+}
+
+func TestServerLogStreamsRecords(t *testing.T) {
+	l := NewServerLog(slog.LevelWarn)
+	db := store.NewMemory()
+	m := newTestManager(WithServerLog(l), WithRoomOptions(WithStore(db)))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	op, _ := newCommandTestSession(m.Lobby(), ClientInfo{Username: "root", Operator: true})
+	require.NoError(t, op.runCommand("/join server-log"))
+	drainChannel(op.client.Send())
+
+	var server bytes.Buffer
+	logger := slog.New(l.Handler(slog.NewTextHandler(&server, nil)))
+	logger.Info("user joined", "username", "bob")
+	logger.Debug("chat: room changed", "room", serverLogRoomName)
+	logger.Warn("disk nearly full", "free", "1%")
+
+	msg := receiveMessage(t, op.client.Send())
+	require.Equal(t, KindSystem, msg.Kind)
+	require.Equal(t, `level=WARN msg="disk nearly full" free=1%`, msg.Body)
+	require.Contains(t, server.String(), "user joined", "the server's own log keeps every record")
+
+	l.SetLevel(slog.LevelInfo)
+	logger.Info("chat: room changed", "room", serverLogRoomName)
+	logger.With("node", "a").Info("user left", "username", "bob")
+	msg = receiveMessage(t, op.client.Send())
+	require.Equal(t, `level=INFO msg="user left" node=a username=bob`, msg.Body)
+
+	records, err := db.Search(context.Background(), store.Query{Room: serverLogRoomName})
+	require.NoError(t, err)
+	require.Empty(t, records, "log lines are not stored")
+}
+
+func TestServerLogReportsDroppedLines(t *testing.T) {
+	l := NewServerLog(slog.LevelWarn)
+	m := newTestManager(WithServerLog(l))
+	logger := slog.New(l.Handler(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+	for i := 0; i < serverLogBuffer+3; i++ {
+		logger.Error("flood")
+	}
+
+	op, _ := newCommandTestSession(m.Lobby(), ClientInfo{Username: "root", Operator: true})
+	require.NoError(t, op.runCommand("/join server-log"))
+	drainChannel(op.client.Send())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	msg := receiveMessage(t, op.client.Send())
+	require.Equal(t, "3 log lines were dropped while the room caught up", msg.Body)
+}
+
+func TestNoServerLogRoomByDefault(t *testing.T) {
+	_, ok := newTestManager().Room(serverLogRoomName)
+	require.False(t, ok)
+}
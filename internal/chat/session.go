@@ -1,110 +1,311 @@
 package chat
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"strings"
 	"sync"
-	"unicode"
+	"sync/atomic"
+	"time"
 
-	"golang.org/x/crypto/ssh"
+	"github.com/ledzpl/schat/pkg/botclient"
+	"github.com/ledzpl/schat/pkg/sshserver"
+	"github.com/ledzpl/schat/pkg/tui"
+	"github.com/ledzpl/schat/pkg/webgateway"
 )
 
-const (
-	ctrlC      = 0x03
-	ctrlD      = 0x04
-	backspace  = '\b'
-	deleteChar = 0x7f
-)
+// relayDrainTimeout bounds how long a finished session waits for its last
+// messages to be written before giving up on the client.
+const relayDrainTimeout = time.Second
 
-// errShellNotRequested indicates the SSH client closed the request stream without asking for a shell.
-var errShellNotRequested = errors.New("shell request not received before channel closed")
+// disconnectNoticeTimeout bounds how long a dropped client is given to receive
+// the reason before its channel closes.
+const disconnectNoticeTimeout = time.Second
 
-// HandleSession wires an SSH channel to the chat room.
-func HandleSession(room *Room, conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) {
-	newSession(room, conn.User(), channel, requests).run()
-}
+// errShellNotRequested indicates the client closed the request stream without asking for a shell.
+var errShellNotRequested = errors.New("shell request not received before channel closed")
 
 type session struct {
-	room     *Room
-	username string
-
-	channel  ssh.Channel
-	requests <-chan *ssh.Request
-
-	client *Client
-	buffer *lineBuffer
-	writer *sessionWriter
-	ui     *terminalUI
+	// ctx ends the session when done, e.g. as the server shuts down.
+	ctx context.Context
+	// home is the room the session joins first; room() tracks later moves.
+	home *Room
+	info ClientInfo
+	log  *slog.Logger
+
+	channel  Channel
+	requests <-chan *Request
+	// web is the browser of a web session, which has no channel.
+	web webgateway.Conn
+	// conn carries the keepalives that measure quality; nil in tests.
+	conn      pinger
+	quality   connQuality
+	stopProbe context.CancelFunc
+	// stopClock ends the status bar clock, if one runs.
+	stopClock context.CancelFunc
+	// unreadDMs counts direct messages since the user last sent a line.
+	unreadDMs atomic.Int32
+	// requestsDone is closed once the client closes the channel.
+	requestsDone chan struct{}
+
+	client   *Client
+	buffer   *lineBuffer
+	ui       *tui.Screen
+	renderer *messageRenderer
+	relay    *relayTarget
+	commands *commandSet
+	// link watches how fast the client takes output; nil in tests.
+	link *linkMonitor
+	// pending holds lines a slow link gets in the next frame; only touched
+	// by the relay.
+	pending []string
+
+	// pendingDelete and search are only touched from the read loop.
+	pendingDelete *pendingDelete
+	search        *searchState
+	// helpPage is the page "/help next" shows.
+	helpPage int
+	// prefs are the display preferences applied to ui and keys.
+	prefs preferences
+	// keys maps control keys to actions for the read loop.
+	keys keymap
+	// cancelArmed is set when the last key pressed was cancel, so pressing it
+	// again quits.
+	cancelArmed bool
+	// quitKey is the quit key waiting for an answer about unsent text, or 0.
+	quitKey tui.Key
+	// pasting is set between the markers of a bracketed paste.
+	pasting bool
+	// typingSent is when the session last announced that it is typing.
+	typingSent time.Time
+
+	// dropped is why the room disconnected the client, if it did.
+	dropped atomic.Pointer[sshserver.SessionExit]
+	// input feeds the read loop from the channel.
+	input       *io.PipeWriter
+	inputReader *io.PipeReader
+
+	translation *sessionTranslation
+	// subsystem is set when the client asked for a subsystem instead of a shell.
+	subsystem string
+	// exec is the file command the client ran instead of a shell, if any.
+	exec string
+	// protocol is the protocol version a machine client declared, or 0.
+	protocol atomic.Int32
+	// colorTerm is the COLORTERM the client sent, if any.
+	colorTerm atomic.Value
 
 	workers sync.WaitGroup
 	cleanup sync.Once
 }
 
-func newSession(room *Room, username string, channel ssh.Channel, requests <-chan *ssh.Request) *session {
-	return &session{
-		room:     room,
-		username: username,
-		channel:  channel,
-		requests: requests,
-		buffer:   newLineBuffer(128),
+func newSession(ctx context.Context, room *Room, info ClientInfo, channel Channel, requests <-chan *Request) *session {
+	inputReader, input := io.Pipe()
+	s := &session{
+		ctx:          ctx,
+		input:        input,
+		inputReader:  inputReader,
+		home:         room,
+		info:         info,
+		log:          room.logger.With("session_id", info.SessionID, "remote_addr", info.RemoteAddr),
+		channel:      channel,
+		requests:     requests,
+		requestsDone: make(chan struct{}),
+		buffer:       newLineBuffer(128),
+		renderer:     newMessageRenderer(),
+		commands:     builtinCommands,
+		translation:  newSessionTranslation(),
+		prefs:        defaultPreferences(),
+		keys:         room.keys.keymap(),
 	}
+	s.renderer.filters = s.prefs.filters
+	return s
 }
 
-func (s *session) run() {
+func (s *session) run() error {
 	defer s.cleanupSession()
 
-	err := s.setup()
-	if err != nil {
-		if !errors.Is(err, errShellNotRequested) {
-			s.printSystemError(err)
+	s.initUI()
+	if err := s.awaitShell(); err != nil {
+		var exit *sshserver.SessionExit
+		if errors.As(err, &exit) {
+			return exit
 		}
-		return
+		return sshserver.Exit(sshserver.ExitClientGone, err)
+	}
+	if s.exec != "" {
+		return s.serveFileCommand()
+	}
+	switch s.subsystem {
+	case EventsSubsystem:
+		if err := s.streamEvents(); err != nil {
+			return err
+		}
+		if s.ctx.Err() != nil {
+			return sshserver.ContextExit(s.ctx)
+		}
+		return sshserver.Exit(sshserver.ExitClientGone, nil)
+	case botclient.Subsystem:
+		return s.serveBot()
 	}
+	return s.serveShell()
+}
 
-	if err := s.readLoop(); err != nil {
+// serveShell runs the interactive chat until the user leaves.
+func (s *session) serveShell() error {
+	if err := s.setup(); err != nil {
+		s.printSystemError(err)
+		return s.exitFor(err)
+	}
+
+	err := s.readLoop()
+	if err != nil {
 		s.handleReadError(err)
 	}
+	s.finish(err)
+	return s.exitFor(err)
+}
+
+// finish tears the terminal down after the read loop ended with err. The
+// session leaves its room first so no more messages are drawn, then users who
+// quit see the goodbye line.
+func (s *session) finish(err error) {
+	s.cleanupSession()
+	goodbye := ""
+	if err == nil && s.dropped.Load() == nil {
+		goodbye = s.home.goodbye
+	}
+	_ = s.ui.Finish(goodbye)
 }
 
-func (s *session) setup() error {
-	s.initUI()
+// exitFor reports how the session ended after the read loop or setup returned
+// err. Being dropped by the room wins over the I/O error it causes.
+func (s *session) exitFor(err error) error {
+	if exit := s.dropped.Load(); exit != nil {
+		return exit
+	}
+	return err
+}
 
-	if err := s.initClient(); err != nil {
+func (s *session) setup() error {
+	if err := s.home.checkBanned(s.info); err != nil {
 		return err
 	}
-
-	return s.initTerminal()
+	s.initClient()
+	s.startLatencyProbe()
+	if err := s.initTerminal(); err != nil {
+		return err
+	}
+	s.startStatusClock()
+	// Messages wait in the client's queue until the terminal is ready and
+	// the user has seen what they missed.
+	if err := s.showUnread(); err != nil {
+		return err
+	}
+	s.startOutboundRelay()
+	return nil
 }
 
 func (s *session) initUI() {
-	s.writer = newSessionWriter(s.channel)
-	s.ui = newTerminalUI(s.writer)
+	s.link = newLinkMonitor(s.channel)
+	s.ui = tui.NewScreen(s.link)
 }
 
-func (s *session) initClient() error {
-	if err := s.awaitShell(); err != nil {
-		return fmt.Errorf("await shell: %w", err)
+func (s *session) initClient() {
+	requested := s.info.Username
+	s.info = s.home.identify(s.info)
+	s.loadPreferences()
+	s.applyTheme()
+	if s.prefs.color != "" {
+		s.info.Color = colorCode(s.prefs.color)
+	}
+	s.client = s.home.Join(s.info)
+	if s.info.Username != requested {
+		s.home.showIdentity(s.client, requested)
+	}
+	s.log = s.log.With("username", s.client.Username)
+	s.log.Info("chat: session joined", "room", s.home.Name(), "auth_method", s.client.AuthMethod, "operator", s.client.Operator)
+	s.buffer.trackSize(&s.client.inputBytes)
+	s.renderer.setViewer(s.client.Username, s.client.Color)
+	s.renderer.now = s.home.now
+	s.client.setDisconnectHandler(s.disconnect)
+}
+
+// disconnect ends an interactive session for exit, telling the user why.
+func (s *session) disconnect(exit *sshserver.SessionExit) {
+	s.dropped.Store(exit)
+	// Best effort: a client too slow to keep up may never read the notice.
+	shown := make(chan struct{})
+	go func() {
+		_ = s.printSystem("disconnected: " + exit.Error())
+		close(shown)
+	}()
+	select {
+	case <-shown:
+		// Leave the channel open so the server can send the exit status.
+		s.input.CloseWithError(exit)
+	case <-time.After(disconnectNoticeTimeout):
+		_ = s.channel.Close()
 	}
+}
 
-	s.client = s.room.AddClient(s.username)
-	s.startOutboundRelay()
-	return nil
+// dropInput ends a session reading its input for exit without a notice.
+func (s *session) dropInput(exit *sshserver.SessionExit) {
+	s.dropped.Store(exit)
+	s.input.CloseWithError(exit)
+}
+
+// dropOnDone ends the session with drop once its context is done, unless the
+// client is gone anyway or the room already dropped it. The returned func
+// stops watching.
+func (s *session) dropOnDone(drop func(*sshserver.SessionExit)) func() bool {
+	return context.AfterFunc(s.ctx, func() {
+		if exit := sshserver.ContextExit(s.ctx); exit.Reason != sshserver.ExitClientGone && s.dropped.Load() == nil {
+			drop(exit)
+		}
+	})
 }
 
 func (s *session) initTerminal() error {
 	if err := s.ui.ClearScreen(); err != nil {
 		return fmt.Errorf("prepare terminal: %w", err)
 	}
+	if err := s.ui.EnablePaste(); err != nil {
+		return fmt.Errorf("prepare terminal: %w", err)
+	}
 
 	return s.sendGreeting()
 }
 
-// awaitShell drains SSH channel requests and blocks until the client requests a shell.
+// awaitShell drains SSH channel requests and blocks until the client requests a
+// shell, the event stream subsystem, the bot subsystem, or a file command.
 func (s *session) awaitShell() error {
-	for req := range s.requests {
+	for {
+		var req *Request
+		select {
+		case <-s.ctx.Done():
+			return sshserver.ContextExit(s.ctx)
+		case r, ok := <-s.requests:
+			if !ok {
+				return errShellNotRequested
+			}
+			req = r
+		}
+		if command, ok := s.fileRequest(req); ok {
+			s.exec = command
+			req.reply(true)
+			s.startRequestPump()
+			return nil
+		}
+		if isEventsRequest(req) || isBotRequest(req) {
+			s.subsystem = req.Name
+			req.reply(true)
+			s.startRequestPump()
+			return nil
+		}
 		if !s.handleRequest(req) {
 			continue
 		}
@@ -112,26 +313,37 @@ func (s *session) awaitShell() error {
 		s.startRequestPump()
 		return nil
 	}
-	return errShellNotRequested
 }
 
-func (s *session) handleRequest(req *ssh.Request) bool {
+func (s *session) handleRequest(req *Request) bool {
 	switch req.Type {
-	case "shell":
-		req.Reply(true, nil)
+	case RequestShell:
+		req.reply(true)
 		return true
-	case "pty-req", "env", "window-change", "signal":
-		req.Reply(true, nil)
+	case RequestPTY:
+		s.ui.SetWidth(req.Cols)
+		s.ui.SetTerm(req.Term)
+		req.reply(true)
+	case RequestWindowChange:
+		s.ui.SetWidth(req.Cols)
+		req.reply(true)
+	case RequestEnv:
+		s.protocolEnv(req)
+		s.terminalEnv(req)
+		req.reply(true)
+	case RequestSignal:
+		req.reply(true)
 	default:
-		req.Reply(false, nil)
+		req.reply(false)
 	}
 	return false
 }
 
+// startRequestPump serves the remaining channel requests. The pump is not
+// waited for: it ends when the server closes the channel after the session.
 func (s *session) startRequestPump() {
-	s.workers.Add(1)
 	go func() {
-		defer s.workers.Done()
+		defer close(s.requestsDone)
 		for req := range s.requests {
 			s.handleRequest(req)
 		}
@@ -139,191 +351,248 @@ func (s *session) startRequestPump() {
 }
 
 func (s *session) startOutboundRelay() {
-	s.workers.Add(1)
-	go func() {
-		defer s.workers.Done()
-		for msg := range s.client.Send() {
-			if err := s.printMessage(msg); err != nil {
-				return
-			}
-		}
-	}()
+	s.relay = s.home.relay.attach(s.client, s.relayMessage)
 }
 
 func (s *session) sendGreeting() error {
-	if err := s.printMessage(fmt.Sprintf("Welcome to schat, %s!", s.client.Username)); err != nil {
+	lines, err := s.room().greeting(s.client)
+	if err != nil {
 		return err
 	}
-	return s.printMessage("Type messages and press enter to chat. Ctrl+D to exit.")
+	if len(lines) == 0 {
+		return s.renderPrompt()
+	}
+	for _, line := range lines {
+		if err := s.printMessage(line); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *session) readLoop() error {
-	reader := bufio.NewReader(s.channel)
-
+	defer s.dropOnDone(s.disconnect)()
+	// Reading through a pipe lets the disconnect handler end the loop without
+	// closing the channel.
+	go func() {
+		_, err := io.Copy(s.input, s.channel)
+		s.input.CloseWithError(err)
+	}()
+	var parser tui.InputParser
+	var events []tui.Event
+	buf := make([]byte, 4096)
 	for {
-		r, _, err := reader.ReadRune()
+		n, err := s.inputReader.Read(buf)
+		events = parser.Feed(events[:0], buf[:n])
+		terminate, perr := s.processInput(events)
+		if perr != nil {
+			return perr
+		}
+		if terminate {
+			return nil
+		}
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				return s.handleEOF()
 			}
 			return err
 		}
+	}
+}
 
-		terminate, err := s.processRune(reader, r)
-		if err != nil {
-			return err
+// processInput handles the events of one read, returning true when the
+// caller should end the read loop. A line break with more text after it in
+// the same read is kept in the input line, as pasted, rather than sending it.
+func (s *session) processInput(events []tui.Event) (bool, error) {
+	for i, ev := range events {
+		if ev.Kind == tui.EventEnter && !s.pasting && s.quitKey == 0 && typedAfter(events[i+1:]) {
+			s.appendInput('\n')
+			continue
 		}
-		if terminate {
-			return nil
+		if terminate, err := s.processEvent(ev); err != nil || terminate {
+			return terminate, err
 		}
 	}
+	return false, nil
 }
 
-// processRune handles interactive input keeping the buffer, screen, and control flow in sync.
-// It returns true when the caller should end the read loop.
-func (s *session) processRune(reader *bufio.Reader, r rune) (bool, error) {
-	if label, terminate := terminationControlLabel(r); terminate {
-		if err := s.handleControl(label); err != nil {
-			return true, err
-		}
-		return true, nil
+// processEvent handles a key press keeping the buffer, screen, and control
+// flow in sync. It returns true when the caller should end the read loop.
+func (s *session) processEvent(ev tui.Event) (bool, error) {
+	switch {
+	case ev.Kind == tui.EventPasteStart:
+		s.pasting = true
+		return false, nil
+	case ev.Kind == tui.EventPasteEnd:
+		s.pasting = false
+		s.updateTyping()
+		return false, s.renderPrompt()
+	case s.pasting:
+		s.pasteEvent(ev)
+		return false, nil
+	}
+	if s.quitKey != 0 {
+		return s.answerQuit(ev)
+	}
+	var action keyAction
+	var bound bool
+	if ev.Kind == tui.EventControl {
+		action, bound = s.keys.lookup(tui.Key(ev.Rune))
+	}
+	if action != keyCancel {
+		s.cancelArmed = false
+	}
+	if bound {
+		return s.runKeyAction(action, tui.Key(ev.Rune))
 	}
 
-	switch {
-	case isEnterKey(r):
-		return false, s.handleEnter(reader, r)
-	case isEraseKey(r):
+	switch ev.Kind {
+	case tui.EventEnter:
+		return false, s.submitLine()
+	case tui.EventErase:
 		s.buffer.TrimLast()
+		s.updateTyping()
 		return false, s.renderPrompt()
-	case unicode.IsPrint(r):
-		s.buffer.Append(r)
+	case tui.EventRune:
+		s.appendInput(ev.Rune)
+		s.updateTyping()
 		return false, s.renderPrompt()
 	}
 
 	return false, nil
 }
 
-func (s *session) handleEnter(reader *bufio.Reader, r rune) error {
-	if r == '\r' {
-		discardPendingLineFeed(reader)
+func (s *session) submitLine() error {
+	text := s.buffer.Drain()
+	s.stopTyping()
+	if strings.TrimSpace(text) != "" {
+		s.unreadDMs.Store(0)
 	}
-	return s.submitLine()
+	if strings.Contains(text, "\n") {
+		return s.submitPaste(text)
+	}
+	return s.submitText(text)
 }
 
-func (s *session) submitLine() error {
-	text := s.buffer.Drain()
-	if strings.TrimSpace(text) == "" {
+// submitText runs text as a command or sends it as a message.
+func (s *session) submitText(text string) error {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
 		return s.renderPrompt()
 	}
-	return s.broadcastLine(text)
+	if isCommand(trimmed) {
+		return s.runCommandLine(trimmed)
+	}
+	s.room().touch(s.client)
+	return s.broadcastLine(unescapeCommand(text))
 }
 
+// handleEOF ends the session when the client closes its input. There is no
+// way to ask about unsent text any more, so it is dropped rather than sent.
 func (s *session) handleEOF() error {
-	return s.broadcastLine(s.buffer.Drain())
+	if text := strings.TrimSpace(s.buffer.Drain()); text != "" {
+		s.log.Debug("chat: unsent input discarded at end of input", "bytes", len(text))
+	}
+	return nil
 }
 
 func (s *session) handleControl(label string) error {
 	s.buffer.Reset()
-	if err := s.ui.DisplayControlAck(label); err != nil {
-		return err
-	}
-	return s.renderPrompt()
+	s.stopTyping()
+	header := s.header()
+	return s.ui.DisplayControlAck(label, header, s.inputLine())
 }
 
 func (s *session) broadcastLine(text string) error {
 	if trimmed := strings.TrimSpace(text); trimmed != "" {
-		if msg := s.room.Broadcast(s.client.ID, s.client.Username, trimmed); msg != "" {
-			return s.printMessage(msg)
+		msg, err := s.room().Broadcast(s.client.ID, s.client.Username, trimmed)
+		if err != nil {
+			return s.printSystem("message not sent: " + err.Error())
+		}
+		if err := s.printMessage(s.renderer.Render(msg)); err != nil {
+			return err
 		}
+		return s.noteTruncated(trimmed)
 	}
 	return nil
 }
 
 func (s *session) renderPrompt() error {
-	header := fmt.Sprintf("Users online: %d", s.room.ClientCount())
-	return s.ui.UpdatePrompt(header, s.buffer.Snapshot())
+	header := s.header()
+	return s.ui.UpdatePrompt(header, s.inputLine())
 }
 
 func (s *session) printMessage(msg string) error {
-	if err := s.ui.DisplayMessage(msg); err != nil {
-		return err
+	if s.web != nil {
+		return s.printWeb(msg)
 	}
-
-	return s.renderPrompt()
+	header := s.header()
+	return s.ui.DisplayMessage(msg, header, s.inputLine())
 }
 
 func (s *session) cleanupSession() {
 	s.cleanup.Do(func() {
 		if s.client != nil {
-			s.room.RemoveClient(s.client.ID)
+			room := s.client.leave()
+			room.RemoveClient(s.client.ID)
+			s.log.Info("chat: session left", "room", room.Name(), "duration", room.now().Sub(s.client.JoinedAt).Round(time.Second))
+		}
+		if s.relay != nil {
+			select {
+			case <-s.relay.Done():
+			case <-time.After(relayDrainTimeout):
+				// The client stopped reading; closing the channel unblocks the relay.
+				if s.web != nil {
+					_ = s.web.Close()
+				} else {
+					_ = s.channel.Close()
+				}
+				<-s.relay.Done()
+			}
+		}
+		s.translation.cancel()
+		if s.stopProbe != nil {
+			s.stopProbe()
 		}
-		if s.channel != nil {
-			_ = s.channel.Close()
+		if s.stopClock != nil {
+			s.stopClock()
 		}
 		s.workers.Wait()
 	})
 }
 
-type sessionWriter struct {
-	mu sync.Mutex
-	ch ssh.Channel
-}
-
-func newSessionWriter(ch ssh.Channel) *sessionWriter {
-	return &sessionWriter{ch: ch}
-}
-
-func (w *sessionWriter) writeString(s string) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	_, err := io.WriteString(w.ch, s)
-	return err
+// room returns the room the session's client is currently in.
+func (s *session) room() *Room {
+	if s.client == nil {
+		return s.home
+	}
+	return s.client.Room()
 }
 
 func (s *session) handleReadError(err error) {
+	var exit *sshserver.SessionExit
 	switch {
-	case errors.Is(err, io.EOF):
+	case errors.Is(err, io.EOF), errors.As(err, &exit):
 		return
 	default:
+		s.log.Warn("chat: session read failed", "err", err)
 		s.printSystemError(fmt.Errorf("read error: %w", err))
 	}
 }
 
 func (s *session) printSystemError(err error) {
-	_ = s.printMessage(fmt.Sprintf("[system] %v", err))
-}
-
-func terminationControlLabel(r rune) (string, bool) {
-	switch r {
-	case ctrlC:
-		return "^C", true
-	case ctrlD:
-		return "^D", true
-	default:
-		return "", false
-	}
-}
-
-func isEnterKey(r rune) bool {
-	return r == '\r' || r == '\n'
-}
-
-func isEraseKey(r rune) bool {
-	return r == backspace || r == deleteChar
+	_ = s.printSystem(err.Error())
 }
 
-func discardPendingLineFeed(reader *bufio.Reader) {
-	if reader.Buffered() == 0 {
-		return
-	}
-
-	next, _, err := reader.ReadRune()
-	if err != nil {
-		return
+// printSystem shows server notices to this session only.
+func (s *session) printSystem(lines ...string) error {
+	if s.web != nil {
+		return s.printWeb(lines...)
 	}
-
-	if next != '\n' {
-		_ = reader.UnreadRune()
+	for _, line := range lines {
+		if err := s.printMessage("[system] " + line); err != nil {
+			return err
+		}
 	}
+	return nil
 }
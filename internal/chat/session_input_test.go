@@ -0,0 +1,55 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// typeInput feeds raw terminal input to sess as readLoop does, reporting
+// whether the session asked to end.
+func typeInput(t *testing.T, sess *session, input string) bool {
+	t.Helper()
+	var parser tui.InputParser
+	done, err := sess.processInput(parser.Feed(nil, []byte(input)))
+	require.NoError(t, err)
+	return done
+}
+
+func TestEscapeSequencesAreNotTyped(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	require.False(t, typeInput(t, sess, "he\x1b[Dl\x1bOAlo\x1b[3~"))
+	require.Equal(t, "hello", sess.buffer.Snapshot(), "arrow and delete keys leave no [A or ~ behind")
+
+	require.False(t, typeInput(t, sess, "\r\n"))
+	require.Equal(t, 1, strings.Count(out.String(), "alice: hello"), "CR LF sends once")
+	require.Empty(t, sess.buffer.Snapshot())
+}
+
+// FuzzSessionInput types arbitrary input into a session without running
+// commands, checking only input runes reach the input line.
+func FuzzSessionInput(f *testing.F) {
+	for _, seed := range []string{"hi\x7f\x7fyo", "\x1b[A\x1b[1;5Cx", "\x03draft\x03", "\t\x0c\x1bb", "\xff\xe2\x82"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		sess, _ := newCommandTestSession(NewRoom(), ClientInfo{Username: "alice"})
+		var parser tui.InputParser
+		for _, ev := range parser.Feed(nil, []byte(input)) {
+			if ev.Kind == tui.EventEnter || ev.Kind == tui.EventControl {
+				continue
+			}
+			_, err := sess.processEvent(ev)
+			require.NoError(t, err)
+		}
+		for _, r := range sess.buffer.Snapshot() {
+			require.True(t, unicode.IsPrint(r) || r == tui.ZeroWidthJoiner, "%q in the input line", r)
+		}
+	})
+}
@@ -0,0 +1,320 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+const (
+	transcriptCols = 60
+	transcriptRows = 12
+)
+
+// TestSessionTranscript drives two full SSH sessions over in-memory connections
+// into virtual terminals and asserts on what each user ends up seeing.
+func TestSessionTranscript(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithClock(func() time.Time { return ts }))
+
+	alice := dialTranscript(t, room, "alice")
+	alice.waitFor(t, "Welcome to schat, alice!")
+
+	bob := dialTranscript(t, room, "bob")
+	bob.waitFor(t, "Welcome to schat, bob!")
+	alice.waitFor(t, "[system] bob joined the chat")
+
+	bob.typeText(t, "hello alice\r")
+	alice.waitFor(t, "bob: hello alice")
+
+	alice.typeText(t, "draft")
+	alice.waitFor(t, "> draft")
+
+	screen := alice.screen.String()
+	lines := strings.Split(screen, "\n")
+	require.Regexp(t, `^#lobby +2 online( \| rtt \S+)?$`, lines[0], "status line stays on the top row")
+	require.Equal(t, "> draft", lines[len(lines)-1], "prompt stays below the messages")
+	require.Contains(t, screen, "[2024-05-01 09:30:00] bob: hello alice")
+
+	bob.typeText(t, "\x04")
+	alice.waitFor(t, "[system] bob left the chat")
+	alice.waitFor(t, " 1 online")
+	alice.waitFor(t, "| rtt ")
+}
+
+// TestSessionSaysGoodbye checks a user who quits sees the goodbye line on a
+// clean prompt row and ssh exits with status 0.
+func TestSessionSaysGoodbye(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithGoodbye("Bye, see you soon!"))
+
+	alice := dialTranscript(t, room, "alice")
+	alice.waitFor(t, "Welcome to schat, alice!")
+	alice.typeText(t, "\x04")
+	alice.waitFor(t, "Bye, see you soon!")
+	require.NoError(t, alice.session.Wait(), "a clean quit exits with status 0")
+
+	require.NotRegexp(t, `(?m)^> *$`, alice.screen.String(), "the prompt is erased")
+}
+
+// TestSessionEndsOnShutdown checks a session whose context ends, as when the
+// server shuts down, tells the user why and exits with status 1.
+func TestSessionEndsOnShutdown(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithGoodbye("Bye, see you soon!"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sess, err := dialSSHContext(t, ctx, room, "alice", &ssh.ServerConfig{NoClientAuth: true}).NewSession()
+	require.NoError(t, err)
+	alice := attachTranscript(t, sess)
+	alice.waitFor(t, "Welcome to schat, alice!")
+
+	cancel()
+	alice.waitFor(t, "disconnected: server is shutting down")
+	var exit *ssh.ExitError
+	require.ErrorAs(t, alice.session.Wait(), &exit)
+	require.Equal(t, 1, exit.ExitStatus())
+	require.NotContains(t, alice.screen.String(), "Bye, see you soon!", "only users who quit get the goodbye")
+	require.Zero(t, room.ClientCount())
+}
+
+// TestSessionLogsStructuredFields checks session lifecycle logs carry the
+// fields operators filter on.
+func TestSessionLogsStructuredFields(t *testing.T) {
+	logs := &lockedBuffer{}
+	logger := slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithLogger(logger))
+
+	alice := dialTranscript(t, room, "alice")
+	alice.waitFor(t, "Welcome to schat, alice!")
+	alice.typeText(t, "/who\r")
+	alice.waitFor(t, "alice")
+	alice.typeText(t, "\x04")
+	require.Eventually(t, func() bool { return strings.Contains(logs.String(), "chat: session left") }, 2*time.Second, 10*time.Millisecond)
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 3)
+	for i, msg := range []string{"chat: session joined", "chat: command", "chat: session left"} {
+		require.Equal(t, msg, records[i]["msg"])
+		require.Equal(t, "alice", records[i]["username"])
+		require.Equal(t, "mem", records[i]["remote_addr"])
+		require.Equal(t, "lobby", records[i]["room"])
+		require.Len(t, records[i]["session_id"], 16)
+	}
+	require.Equal(t, "who", records[1]["command"])
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type transcriptClient struct {
+	session *ssh.Session
+	screen  *vtScreen
+	stdin   io.Writer
+}
+
+func dialTranscript(t *testing.T, room *Room, user string) *transcriptClient {
+	t.Helper()
+
+	sess, err := dialSSH(t, room, user).NewSession()
+	require.NoError(t, err)
+	return attachTranscript(t, sess)
+}
+
+// attachTranscript starts a shell on sess drawn into a virtual terminal.
+func attachTranscript(t *testing.T, sess *ssh.Session) *transcriptClient {
+	t.Helper()
+
+	screen := newVTScreen(transcriptCols, transcriptRows)
+	sess.Stdout = screen
+	stdin, err := sess.StdinPipe()
+	require.NoError(t, err)
+
+	require.NoError(t, sess.RequestPty("xterm", transcriptRows, transcriptCols, ssh.TerminalModes{}))
+	require.NoError(t, sess.Shell())
+
+	return &transcriptClient{session: sess, screen: screen, stdin: stdin}
+}
+
+// dialSSH connects to room over an in-memory SSH connection as user.
+func dialSSH(t *testing.T, room *Room, user string) *ssh.Client {
+	t.Helper()
+
+	return dialSSHWith(t, room, user, &ssh.ServerConfig{NoClientAuth: true})
+}
+
+// dialSSHWith is dialSSH with a custom server config, e.g. to grant
+// permissions through NoClientAuthCallback.
+func dialSSHWith(t *testing.T, room *Room, user string, cfg *ssh.ServerConfig) *ssh.Client {
+	t.Helper()
+
+	return dialSSHContext(t, context.Background(), room, user, cfg)
+}
+
+// dialSSHContext is dialSSHWith with sessions that end once ctx is done.
+func dialSSHContext(t *testing.T, ctx context.Context, room *Room, user string, cfg *ssh.ServerConfig) *ssh.Client {
+	t.Helper()
+
+	serverConn, clientConn := newMemPipe()
+	go serveTranscript(ctx, t, room, serverConn, cfg)
+
+	conn, chans, reqs, err := ssh.NewClientConn(clientConn, "pipe", &ssh.ClientConfig{
+		User:            user,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.NoError(t, err)
+	client := ssh.NewClient(conn, chans, reqs)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func serveTranscript(ctx context.Context, t *testing.T, room *Room, nc net.Conn, cfg *ssh.ServerConfig) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cfg.AddHostKey(signer)
+
+	conn, chans, reqs, err := ssh.NewServerConn(nc, cfg)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			sshserver.CloseSession(channel, HandleSession(ctx, room, conn, channel, requests))
+		}()
+	}
+}
+
+func (c *transcriptClient) typeText(t *testing.T, text string) {
+	t.Helper()
+	_, err := io.WriteString(c.stdin, text)
+	require.NoError(t, err)
+}
+
+func (c *transcriptClient) waitFor(t *testing.T, text string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return strings.Contains(c.screen.String(), text)
+	}, 2*time.Second, 5*time.Millisecond, "screen never showed %q:\n%s", text, c.screen)
+}
+
+// memPipe is an in-memory, buffered full-duplex connection. Unlike net.Pipe,
+// writes never wait for the peer to read, so both ends of an SSH handshake can
+// send their version banners at the same time.
+type memPipe struct {
+	in, out *memBuffer
+}
+
+func newMemPipe() (net.Conn, net.Conn) {
+	a, b := newMemBuffer(), newMemBuffer()
+	return &memPipe{in: a, out: b}, &memPipe{in: b, out: a}
+}
+
+func (p *memPipe) Read(b []byte) (int, error)  { return p.in.read(b) }
+func (p *memPipe) Write(b []byte) (int, error) { return p.out.write(b) }
+
+func (p *memPipe) Close() error {
+	p.in.close()
+	p.out.close()
+	return nil
+}
+
+func (p *memPipe) LocalAddr() net.Addr              { return memAddr{} }
+func (p *memPipe) RemoteAddr() net.Addr             { return memAddr{} }
+func (p *memPipe) SetDeadline(time.Time) error      { return nil }
+func (p *memPipe) SetReadDeadline(time.Time) error  { return nil }
+func (p *memPipe) SetWriteDeadline(time.Time) error { return nil }
+
+type memAddr struct{}
+
+func (memAddr) Network() string { return "mem" }
+func (memAddr) String() string  { return "mem" }
+
+type memBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	data   bytes.Buffer
+	closed bool
+}
+
+func newMemBuffer() *memBuffer {
+	b := &memBuffer{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *memBuffer) read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.data.Len() == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if b.data.Len() == 0 {
+		return 0, io.EOF
+	}
+	return b.data.Read(p)
+}
+
+func (b *memBuffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	b.cond.Broadcast()
+	return b.data.Write(p)
+}
+
+func (b *memBuffer) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"context"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// HandleSession wires an SSH channel to the chat room and returns how the
+// session ended, following the sshserver.SessionHandler contract. The session
+// ends, telling the user why, once ctx is done.
+func HandleSession(ctx context.Context, room *Room, conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) error {
+	info := ClientInfo{
+		Username:      conn.User(),
+		RemoteAddr:    conn.RemoteAddr().String(),
+		ClientVersion: string(conn.ClientVersion()),
+		SessionID:     sshserver.SessionID(conn),
+	}
+	if conn.Permissions != nil {
+		info.AuthMethod = conn.Permissions.Extensions[sshserver.ExtAuthMethod]
+		info.Account = conn.Permissions.Extensions[sshserver.ExtAccount] != ""
+		info.KeyFingerprint = conn.Permissions.Extensions[sshserver.ExtKeyFingerprint]
+		if name := conn.Permissions.Extensions[sshserver.ExtOIDCUsername]; name != "" {
+			info.Username = name
+		}
+		if conn.Permissions.Extensions[sshserver.ExtAdmin] != "" {
+			return serveAdmin(ctx, room, info, channel, requests, conn.Permissions.Extensions[sshserver.ExtKeyFingerprint])
+		}
+	}
+	s := newSession(ctx, room, info, channel, sshRequests(ctx, requests))
+	s.conn = conn
+	return s.run()
+}
+
+// sshRequests decodes SSH channel requests into Requests until in closes.
+// Requests arriving once ctx is done, with no session left to take them, are
+// refused.
+func sshRequests(ctx context.Context, in <-chan *ssh.Request) <-chan *Request {
+	out := make(chan *Request)
+	go func() {
+		defer close(out)
+		for req := range in {
+			select {
+			case out <- decodeSSHRequest(req):
+			case <-ctx.Done():
+				_ = req.Reply(false, nil)
+			}
+		}
+	}()
+	return out
+}
+
+// decodeSSHRequest unpacks the RFC 4254 payload of req. Payloads that do not
+// decode leave the fields empty.
+func decodeSSHRequest(req *ssh.Request) *Request {
+	r := &Request{Type: req.Type, Answer: func(ok bool) { _ = req.Reply(ok, nil) }}
+	switch req.Type {
+	case RequestPTY:
+		var pty struct {
+			Term                             string
+			Columns, Rows, WidthPx, HeightPx uint32
+			Modes                            string
+		}
+		if ssh.Unmarshal(req.Payload, &pty) == nil {
+			r.Term, r.Cols, r.Rows = pty.Term, int(pty.Columns), int(pty.Rows)
+		}
+	case RequestWindowChange:
+		var win struct{ Columns, Rows, WidthPx, HeightPx uint32 }
+		if ssh.Unmarshal(req.Payload, &win) == nil {
+			r.Cols, r.Rows = int(win.Columns), int(win.Rows)
+		}
+	case RequestEnv:
+		var kv struct{ Name, Value string }
+		if ssh.Unmarshal(req.Payload, &kv) == nil {
+			r.Name, r.Value = kv.Name, kv.Value
+		}
+	case RequestSubsystem:
+		var sub struct{ Name string }
+		if ssh.Unmarshal(req.Payload, &sub) == nil {
+			r.Name = sub.Name
+		}
+	case RequestExec:
+		var exec struct{ Command string }
+		if ssh.Unmarshal(req.Payload, &exec) == nil {
+			r.Command = exec.Command
+		}
+	}
+	return r
+}
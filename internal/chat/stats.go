@@ -0,0 +1,52 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+// WithBridges attaches the bridge supervisor whose health /stats reports.
+func WithBridges(s *bridge.Supervisor) RoomOption {
+	return func(r *Room) {
+		r.bridges = s
+	}
+}
+
+func runStats(s *session, _ string) error {
+	rooms := []*Room{s.room()}
+	if manager := s.room().manager; manager != nil {
+		rooms = manager.Rooms()
+	}
+	users := 0
+	for _, room := range rooms {
+		users += room.ClientCount()
+	}
+
+	lines := []string{fmt.Sprintf("%d users in %d rooms", users, len(rooms))}
+	status := s.room().bridges.Status()
+	if len(status) == 0 {
+		return s.printSystem(append(lines, "no bridges configured")...)
+	}
+	lines = append(lines, "Bridges:")
+	now := s.room().now()
+	for _, st := range status {
+		lines = append(lines, "  "+formatBridgeStatus(st, now))
+	}
+	return s.printSystem(lines...)
+}
+
+func formatBridgeStatus(st bridge.Status, now time.Time) string {
+	line := fmt.Sprintf("%-10s %s for %s", st.Name, st.State, formatIdle(now.Sub(st.Since)))
+	if !st.NextAttempt.IsZero() {
+		line += fmt.Sprintf(", retry in %s", formatIdle(st.NextAttempt.Sub(now)))
+	}
+	if st.Failures > 0 && st.State != bridge.StateConnected {
+		line += fmt.Sprintf(" (%d failures: %s)", st.Failures, st.LastError)
+	}
+	if st.Reconnects > 0 {
+		line += fmt.Sprintf(" [%d reconnects]", st.Reconnects)
+	}
+	return line
+}
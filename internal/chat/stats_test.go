@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+type failingConnector struct{}
+
+func (failingConnector) Name() string { return "irc" }
+
+func (failingConnector) Run(context.Context, func()) error {
+	return errors.New("connection refused")
+}
+
+func TestStatsCommand(t *testing.T) {
+	m := newTestManager()
+	_, err := m.Create("dev", "bob")
+	require.NoError(t, err)
+	m.Lobby().AddClient("bob")
+	sess, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "alice"})
+
+	require.NoError(t, sess.runCommand("/stats"))
+	require.Contains(t, out.String(), "2 users in 2 rooms")
+	require.Contains(t, out.String(), "no bridges configured")
+}
+
+func TestStatsShowsBridgeHealth(t *testing.T) {
+	sup := bridge.NewSupervisor(bridge.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), bridge.WithBackoff(bridge.Backoff{Initial: time.Hour, Max: time.Hour, Multiplier: 1}))
+	require.NoError(t, sup.Add(failingConnector{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sup.Run(ctx)
+	require.Eventually(t, func() bool { return sup.Status()[0].State == bridge.StateBackoff }, 2*time.Second, time.Millisecond)
+
+	sess, out := newCommandTestSession(NewRoom(WithBridges(sup)), ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/stats"))
+	require.Contains(t, out.String(), "1 users in 1 rooms")
+	require.Regexp(t, `irc\s+backoff for \d+s, retry in (59m|1h00m) \(1 failures: connection refused\)`, out.String())
+}
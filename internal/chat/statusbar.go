@@ -0,0 +1,185 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// DefaultStatusLeft and DefaultStatusRight are the segments of the status bar
+// unless WithStatusBar changes them.
+var (
+	DefaultStatusLeft = []string{
+		"#{{.Room}}{{if .Recording}} " + recordingIndicator + "{{end}}",
+		"{{.Topic}}",
+		"{{.Typing}}",
+	}
+	DefaultStatusRight = []string{
+		"{{with .UnreadDMs}}{{.}} unread DM{{if gt . 1}}s{{end}}{{end}}",
+		"{{.Users}} online",
+		"{{.Latency}}",
+	}
+)
+
+// StatusData is the data available to status bar templates.
+type StatusData struct {
+	Room  string
+	Topic string
+	// Users is how many users are in the room.
+	Users     int
+	Recording bool
+	// Typing names who else is typing, e.g. "alice is typing…".
+	Typing string
+	// UnreadDMs counts the direct messages received since the user last
+	// sent a line.
+	UnreadDMs int
+	// Latency is the connection's round-trip time and loss, e.g. "rtt 42ms".
+	Latency string
+	// Clock is the time as "15:04"; Time is the same for other formats.
+	Clock string
+	Time  time.Time
+}
+
+// StatusBar is the status line drawn above the chat. Each segment is a
+// text/template with StatusData fields such as {{.Room}} and {{.Users}};
+// segments that render empty are left out, and those that do not fit the
+// terminal are dropped as tui.LayoutStatus describes.
+type StatusBar struct {
+	left, right []*template.Template
+	// clock is set when a segment shows the time, so sessions redraw it.
+	clock bool
+}
+
+// ParseStatusBar compiles the left and right segment templates. A nil side
+// keeps its default.
+func ParseStatusBar(left, right []string) (*StatusBar, error) {
+	if left == nil {
+		left = DefaultStatusLeft
+	}
+	if right == nil {
+		right = DefaultStatusRight
+	}
+	b := &StatusBar{}
+	var err error
+	if b.left, err = b.parse("left", left); err != nil {
+		return nil, err
+	}
+	if b.right, err = b.parse("right", right); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *StatusBar) parse(side string, texts []string) ([]*template.Template, error) {
+	tmpls := make([]*template.Template, 0, len(texts))
+	for i, text := range texts {
+		tmpl, err := template.New(fmt.Sprintf("%s[%d]", side, i)).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("chat: parse status bar: %w", err)
+		}
+		// Catch references to unknown fields at load time rather than on every redraw.
+		if err := tmpl.Execute(&bytes.Buffer{}, StatusData{}); err != nil {
+			return nil, fmt.Errorf("chat: parse status bar: %w", err)
+		}
+		if strings.Contains(text, ".Clock") || strings.Contains(text, ".Time") {
+			b.clock = true
+		}
+		tmpls = append(tmpls, tmpl)
+	}
+	return tmpls, nil
+}
+
+// Render lays the bar out cols columns wide, or unaligned when cols is 0.
+// Segments that fail to render are left out.
+func (b *StatusBar) Render(data StatusData, cols int) string {
+	return tui.LayoutStatus(renderSegments(b.left, data), renderSegments(b.right, data), cols)
+}
+
+func renderSegments(tmpls []*template.Template, data StatusData) []string {
+	segments := make([]string, 0, len(tmpls))
+	var buf bytes.Buffer
+	for _, tmpl := range tmpls {
+		buf.Reset()
+		if err := tmpl.Execute(&buf, data); err == nil {
+			segments = append(segments, strings.TrimSpace(tui.Sanitize(buf.String())))
+		}
+	}
+	return segments
+}
+
+func mustParseStatusBar(left, right []string) *StatusBar {
+	b, err := ParseStatusBar(left, right)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// WithStatusBar replaces the default status bar.
+func WithStatusBar(b *StatusBar) RoomOption {
+	return func(r *Room) {
+		if b != nil {
+			r.statusBar = b
+		}
+	}
+}
+
+// header returns the status line for the session's current room.
+func (s *session) header() string {
+	room := s.room()
+	now := room.now()
+	data := StatusData{
+		Room:      room.Name(),
+		Topic:     room.Topic(),
+		Users:     room.ClientCount(),
+		Recording: room.Recorded(),
+		Typing:    describeTypists(s.prefs.filters.visibleTypists(room.Typists(s.client.ID))),
+		UnreadDMs: int(s.unreadDMs.Load()),
+		Latency:   s.quality.indicator(),
+		Clock:     now.Format("15:04"),
+		Time:      now,
+	}
+	cols := 0
+	if s.ui != nil {
+		cols = s.ui.Width()
+	}
+	return room.statusBar.Render(data, cols)
+}
+
+// countDirect counts msg toward the unread direct messages shown in the
+// status bar if someone else sent it to the user.
+func (s *session) countDirect(msg Message) {
+	if msg.Kind == KindDirect && msg.SenderID != s.client.ID {
+		s.unreadDMs.Add(1)
+	}
+}
+
+// startStatusClock redraws the status line as each minute starts while the
+// home room's status bar shows the time.
+func (s *session) startStatusClock() {
+	if !s.home.statusBar.clock {
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.stopClock = cancel
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		timer := time.NewTimer(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute)))
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-timer.C:
+				_ = s.renderPrompt()
+				timer.Reset(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+			}
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusBarTemplates(t *testing.T) {
+	bar, err := ParseStatusBar([]string{"{{.Users}} here", "{{.Topic}}"}, []string{"{{.Clock}}"})
+	require.NoError(t, err)
+	require.True(t, bar.clock, "sessions redraw bars that show the time")
+
+	now := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	room := NewRoom(WithStatusBar(bar), WithClock(func() time.Time { return now }))
+	sess, _ := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	require.Equal(t, "1 here | 09:30", sess.header(), "empty segments are left out")
+
+	sess.ui.SetWidth(20)
+	require.Equal(t, "1 here        09:30", sess.header(), "the right segments align to the terminal width")
+
+	bar, err = ParseStatusBar(nil, []string{})
+	require.NoError(t, err)
+	require.False(t, bar.clock)
+	require.Equal(t, "#lobby", bar.Render(StatusData{Room: "lobby", Users: 3}, 0), "a nil side keeps its default")
+
+	_, err = ParseStatusBar([]string{"{{.Users"}, nil)
+	require.ErrorContains(t, err, "chat: parse status bar")
+	_, err = ParseStatusBar(nil, []string{"{{.Nope}}"})
+	require.ErrorContains(t, err, "Nope", "unknown fields fail at load time")
+}
+
+func TestStatusBarCountsUnreadDirectMessages(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	alice, _ := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	bob, _ := newCommandTestSession(room, ClientInfo{Username: "bob"})
+	drainChannel(alice.client.Send())
+
+	for _, text := range []string{"/msg alice hi", "/msg alice you there?"} {
+		require.NoError(t, bob.runCommand(text))
+		msg := <-alice.client.Send()
+		require.NoError(t, alice.relayMessage(msg))
+	}
+	require.Equal(t, "#lobby | 2 unread DMs | 2 online", alice.header())
+
+	require.NoError(t, alice.relayMessage(Message{Kind: KindDirect, SenderID: alice.client.ID, Body: "echo"}))
+	require.Contains(t, alice.header(), "2 unread DMs", "the user's own messages are not counted")
+
+	require.False(t, typeInput(t, alice, "\r"))
+	require.Contains(t, alice.header(), "2 unread DMs", "an empty line is not a reply")
+	require.False(t, typeInput(t, alice, "/msg bob yes\r"))
+	require.Equal(t, "#lobby | 2 online", alice.header(), "sending a line marks them read")
+}
@@ -0,0 +1,233 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Keys of the theme preferences kept in the store.
+const (
+	themeSetting  = "theme"
+	colorsSetting = "colors"
+)
+
+// colorDepth is how many colors a terminal can draw.
+type colorDepth int
+
+const (
+	// depthAuto detects the depth from the client's TERM and COLORTERM.
+	depthAuto colorDepth = iota
+	depth16
+	depth256
+	depthTrue
+)
+
+var colorDepthNames = []string{"auto", "16", "256", "truecolor"}
+
+func (d colorDepth) String() string {
+	return colorDepthNames[d]
+}
+
+func parseColorDepth(name string) (colorDepth, error) {
+	switch name = strings.ToLower(name); name {
+	case "24bit", "direct":
+		return depthTrue, nil
+	}
+	for i, n := range colorDepthNames {
+		if n == name {
+			return colorDepth(i), nil
+		}
+	}
+	return depthAuto, fmt.Errorf("unknown color depth %q (want %s)", name, strings.Join(colorDepthNames, ", "))
+}
+
+// detectColorDepth guesses what a terminal can draw from the TERM it sent in
+// its "pty-req" and the COLORTERM it sent as an "env" request. Terminals that
+// say nothing get the 16 colors every terminal supports.
+func detectColorDepth(term, colorTerm string) colorDepth {
+	term, colorTerm = strings.ToLower(term), strings.ToLower(colorTerm)
+	switch {
+	case colorTerm == "truecolor" || colorTerm == "24bit",
+		strings.Contains(term, "truecolor"), strings.Contains(term, "24bit"), strings.HasSuffix(term, "-direct"):
+		return depthTrue
+	case strings.Contains(term, "256color"):
+		return depth256
+	default:
+		return depth16
+	}
+}
+
+// themeColor is one color of a theme at every depth.
+type themeColor struct {
+	// basic is the SGR parameter for 16-color terminals, e.g. "91".
+	basic string
+	// xterm is the index in the 256-color palette.
+	xterm uint8
+	rgb   [3]uint8
+}
+
+// sequence returns the escape sequence that selects c on a terminal of
+// depth d.
+func (c themeColor) sequence(d colorDepth) string {
+	switch d {
+	case depthTrue:
+		return fmt.Sprintf("\033[38;2;%d;%d;%dm", c.rgb[0], c.rgb[1], c.rgb[2])
+	case depth256:
+		return fmt.Sprintf("\033[38;5;%dm", c.xterm)
+	default:
+		return "\033[" + c.basic + "m"
+	}
+}
+
+// theme decides how a session draws names and system lines. Clients are
+// assigned one of the colorNames; a theme maps each to a shade that suits
+// its background.
+type theme struct {
+	name string
+	// senders maps color names to how they are drawn; nil draws the plain
+	// ANSI colors.
+	senders map[string]themeColor
+	// system tints the [system] tag, if set.
+	system *themeColor
+}
+
+// themes are the presets /theme offers. The first is the default.
+var themes = []*theme{
+	{name: "default"},
+	{
+		name: "dark",
+		senders: map[string]themeColor{
+			"red":     {"91", 203, [3]uint8{255, 95, 95}},
+			"green":   {"92", 114, [3]uint8{135, 215, 135}},
+			"yellow":  {"93", 221, [3]uint8{255, 215, 95}},
+			"blue":    {"94", 111, [3]uint8{135, 175, 255}},
+			"magenta": {"95", 176, [3]uint8{215, 135, 215}},
+			"cyan":    {"96", 80, [3]uint8{95, 215, 215}},
+		},
+		system: &themeColor{"90", 245, [3]uint8{138, 138, 138}},
+	},
+	{
+		name: "light",
+		senders: map[string]themeColor{
+			"red":     {"31", 124, [3]uint8{175, 0, 0}},
+			"green":   {"32", 28, [3]uint8{0, 135, 0}},
+			"yellow":  {"33", 136, [3]uint8{175, 135, 0}},
+			"blue":    {"34", 25, [3]uint8{0, 95, 175}},
+			"magenta": {"35", 90, [3]uint8{135, 0, 135}},
+			"cyan":    {"36", 30, [3]uint8{0, 135, 135}},
+		},
+		system: &themeColor{"90", 242, [3]uint8{108, 108, 108}},
+	},
+	{
+		name: "solarized",
+		senders: map[string]themeColor{
+			"red":     {"31", 160, [3]uint8{220, 50, 47}},
+			"green":   {"32", 64, [3]uint8{133, 153, 0}},
+			"yellow":  {"33", 136, [3]uint8{181, 137, 0}},
+			"blue":    {"34", 33, [3]uint8{38, 139, 210}},
+			"magenta": {"35", 125, [3]uint8{211, 54, 130}},
+			"cyan":    {"36", 37, [3]uint8{42, 161, 152}},
+		},
+		system: &themeColor{"90", 240, [3]uint8{88, 110, 117}},
+	},
+}
+
+func defaultTheme() *theme {
+	return themes[0]
+}
+
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for _, t := range themes {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+func parseTheme(name string) (*theme, error) {
+	name = strings.ToLower(name)
+	for _, t := range themes {
+		if t.name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown theme %q (want %s)", name, strings.Join(themeNames(), ", "))
+}
+
+// paint returns the sequence that draws the ANSI color code on a terminal of
+// depth d. Codes the theme does not know are passed through.
+func (t *theme) paint(code string, d colorDepth) string {
+	if t == nil || t.senders == nil {
+		return code
+	}
+	c, ok := t.senders[colorNames[code]]
+	if !ok {
+		return code
+	}
+	return c.sequence(d)
+}
+
+// terminalEnv records the COLORTERM a client sent, which truecolor terminals
+// use to advertise themselves.
+func (s *session) terminalEnv(req *Request) {
+	if req.Name == "COLORTERM" {
+		s.colorTerm.Store(req.Value)
+	}
+}
+
+// colorDepth returns the depth the user chose, or the one their terminal
+// advertised.
+func (s *session) colorDepth() colorDepth {
+	if s.prefs.colors != depthAuto {
+		return s.prefs.colors
+	}
+	colorTerm, _ := s.colorTerm.Load().(string)
+	return detectColorDepth(s.ui.Term(), colorTerm)
+}
+
+// applyTheme draws the session with the user's theme at its color depth.
+func (s *session) applyTheme() {
+	s.renderer.setTheme(s.prefs.theme, s.colorDepth())
+}
+
+// runTheme shows or changes how the session is colored:
+// /theme [<name> | colors <depth>].
+func runTheme(s *session, args string) error {
+	name, value, _ := strings.Cut(strings.TrimSpace(args), " ")
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(name) {
+	case "":
+		return s.printSystem(
+			"theme: "+s.prefs.theme.name,
+			"colors: "+s.colorsPreference(),
+			"themes: "+strings.Join(themeNames(), ", "),
+		)
+	case "colors", "colours":
+		if value == "" {
+			return s.printSystem("colors: " + s.colorsPreference())
+		}
+		depth, err := parseColorDepth(value)
+		if err != nil {
+			return s.printSystem("/theme colors: " + err.Error())
+		}
+		s.prefs.colors = depth
+		s.applyTheme()
+		return s.printSystem("colors set to " + s.colorsPreference() + s.savePreferences())
+	default:
+		t, err := parseTheme(name)
+		if err != nil {
+			return s.printSystem("/theme: " + err.Error())
+		}
+		s.prefs.theme = t
+		s.applyTheme()
+		return s.printSystem("theme set to " + t.name + s.savePreferences())
+	}
+}
+
+// colorsPreference describes the color depth in use, e.g. "auto (256)".
+func (s *session) colorsPreference() string {
+	if s.prefs.colors == depthAuto {
+		return "auto (" + s.colorDepth().String() + ")"
+	}
+	return s.prefs.colors.String()
+}
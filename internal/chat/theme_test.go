@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestDetectColorDepth(t *testing.T) {
+	cases := []struct {
+		term, colorTerm string
+		want            colorDepth
+	}{
+		{"", "", depth16},
+		{"xterm", "", depth16},
+		{"xterm-256color", "", depth256},
+		{"screen-256color", "", depth256},
+		{"xterm-256color", "truecolor", depthTrue},
+		{"xterm", "24bit", depthTrue},
+		{"xterm-direct", "", depthTrue},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.want, detectColorDepth(tc.term, tc.colorTerm), "%s %s", tc.term, tc.colorTerm)
+	}
+}
+
+func TestThemeRendering(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	msg := Message{Timestamp: ts, SenderName: "bob", SenderColor: "\033[31m", Body: "hi @alice", Kind: KindChat}
+	dark, err := parseTheme("dark")
+	require.NoError(t, err)
+
+	renderer := newMessageRenderer()
+	renderer.setOptions(timestampsHidden, false)
+	renderer.setViewer("alice", "\033[34m")
+	require.Equal(t, "\033[31mbob\033[0m: hi \033[34m\033[7m@alice\033[0m", renderer.Render(msg), "the default theme draws the plain colors")
+
+	renderer.setTheme(dark, depth16)
+	require.Equal(t, "\033[91mbob\033[0m: hi \033[94m\033[7m@alice\033[0m", renderer.Render(msg))
+	require.Equal(t, "\033[90m[system]\033[0m joined", renderer.Render(Message{Body: "joined", Kind: KindSystem}))
+
+	renderer.setTheme(dark, depth256)
+	require.Equal(t, "\033[38;5;203mbob\033[0m: hi \033[38;5;111m\033[7m@alice\033[0m", renderer.Render(msg))
+
+	renderer.setTheme(dark, depthTrue)
+	require.Equal(t, "\033[38;2;255;95;95mbob\033[0m: hi \033[38;2;135;175;255m\033[7m@alice\033[0m", renderer.Render(msg))
+
+	msg.SenderColor = "\033[1;31m"
+	require.Equal(t, "\033[1;31mbob\033[0m: hi \033[38;2;135;175;255m\033[7m@alice\033[0m", renderer.Render(msg), "unknown codes are passed through")
+}
+
+func TestThemeCommand(t *testing.T) {
+	st := store.NewMemory()
+	room := NewRoom(WithStore(st))
+
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	sess.handleRequest(&Request{Type: RequestPTY, Term: "xterm-256color", Cols: 80, Rows: 24})
+	require.NoError(t, sess.runCommand("/theme"))
+	require.Contains(t, out.String(), "theme: default")
+	require.Contains(t, out.String(), "colors: auto (256)")
+	require.Contains(t, out.String(), "themes: default, dark, light, solarized")
+
+	sess.handleRequest(&Request{Type: RequestEnv, Name: "COLORTERM", Value: "truecolor"})
+	require.NoError(t, sess.runCommand("/theme colors"))
+	require.Contains(t, out.String(), "colors: auto (truecolor)")
+
+	require.NoError(t, sess.runCommand("/theme neon"))
+	require.Contains(t, out.String(), `/theme: unknown theme "neon" (want default, dark, light, solarized)`)
+	require.NoError(t, sess.runCommand("/theme colors 88"))
+	require.Contains(t, out.String(), `/theme colors: unknown color depth "88" (want auto, 16, 256, truecolor)`)
+
+	require.NoError(t, sess.runCommand("/theme Solarized"))
+	require.Contains(t, out.String(), "theme set to solarized")
+	require.NoError(t, sess.runCommand("/set colors 256"))
+	require.Contains(t, out.String(), "colors set to 256")
+	require.Equal(t, "solarized", sess.renderer.theme.name)
+	require.Equal(t, depth256, sess.renderer.depth)
+
+	settings, err := st.UserSettings(context.Background(), "alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"theme": "solarized", "colors": "256"}, settings)
+
+	next, _ := newSessionWithStoredPreferences(room, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	require.Equal(t, "solarized", next.renderer.theme.name)
+	require.Equal(t, depth256, next.renderer.depth)
+
+	guest, out := newCommandTestSession(room, ClientInfo{Username: "carol"})
+	require.NoError(t, guest.runCommand("/theme light"))
+	require.Contains(t, out.String(), "theme set to light (this session only; sign in to keep preferences)")
+}
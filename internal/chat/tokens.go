@@ -0,0 +1,73 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/tokens"
+)
+
+const tokenUsage = "usage: /token create <read-only|read-write> [label] | /token list | /token revoke <id>"
+
+// WithTokens enables /token using store for API token storage.
+func WithTokens(store *tokens.Store) RoomOption {
+	return func(r *Room) {
+		r.tokens = store
+	}
+}
+
+// runToken lets users who proved their name manage its API tokens. A token
+// signs its holder in under that name, so a credential that admits any name,
+// such as an authorized key without an identity, is not enough.
+func runToken(s *session, args string) error {
+	store := s.room().tokens
+	if store == nil {
+		return s.printSystem("API tokens are not enabled on this server")
+	}
+	if !s.client.nameProved {
+		return s.printSystem("/token: sign in to " + s.client.Username + " with its account, password file entry, saved key, or OIDC to manage API tokens")
+	}
+
+	sub, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+	owner := s.client.Username
+
+	switch strings.ToLower(sub) {
+	case "create":
+		scopeName, label, _ := strings.Cut(rest, " ")
+		scope, err := tokens.ParseScope(scopeName)
+		if err != nil {
+			return s.printSystem(tokenUsage)
+		}
+		tok, secret, err := store.Create(owner, scope, strings.TrimSpace(label))
+		if err != nil {
+			return s.printSystem(fmt.Sprintf("/token: %v", err))
+		}
+		return s.printSystem(
+			fmt.Sprintf("created %s token %s", tok.Scope, tok.ID),
+			"  "+secret,
+			"copy it now; it will not be shown again",
+		)
+	case "list":
+		list := store.List(owner)
+		if len(list) == 0 {
+			return s.printSystem("you have no API tokens")
+		}
+		lines := []string{fmt.Sprintf("%d API token(s):", len(list))}
+		for _, tok := range list {
+			lines = append(lines, fmt.Sprintf("  %s  %-10s created %s  %s",
+				tok.ID, tok.Scope, tok.CreatedAt.Format(timestampFormat), tok.Label))
+		}
+		return s.printSystem(lines...)
+	case "revoke":
+		if rest == "" {
+			return s.printSystem(tokenUsage)
+		}
+		if err := store.Revoke(owner, rest); err != nil {
+			return s.printSystem(fmt.Sprintf("/token: %v: %s", err, rest))
+		}
+		return s.printSystem(fmt.Sprintf("revoked token %s", rest))
+	default:
+		return s.printSystem(tokenUsage)
+	}
+}
@@ -0,0 +1,56 @@
+package chat
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/tokens"
+)
+
+func TestTokenCommandLifecycle(t *testing.T) {
+	store := tokens.NewStore()
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithTokens(store))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey", Account: true})
+
+	require.NoError(t, sess.runCommand("/token create read-only ci bot"))
+	secret := regexp.MustCompile(`schat_[0-9a-f]+_[A-Za-z0-9_-]+`).FindString(out.String())
+	require.NotEmpty(t, secret)
+
+	tok, err := store.Verify(secret)
+	require.NoError(t, err)
+	require.Equal(t, "alice", tok.Owner)
+	require.Equal(t, "ci bot", tok.Label)
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/token list"))
+	require.Contains(t, out.String(), tok.ID)
+	require.NotContains(t, out.String(), secret)
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/token revoke "+tok.ID))
+	require.Contains(t, out.String(), "revoked token "+tok.ID)
+	require.Empty(t, store.List("alice"))
+
+	out.Reset()
+	require.NoError(t, sess.runCommand("/token create admin"))
+	require.Contains(t, out.String(), "usage: /token")
+}
+
+func TestTokenCommandRequiresRegisteredUser(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithTokens(tokens.NewStore()))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "guest"})
+
+	require.NoError(t, sess.runCommand("/token create read-only"))
+	require.Contains(t, out.String(), "sign in")
+
+	anyName, anyOut := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	require.NoError(t, anyName.runCommand("/token create read-write"))
+	require.Contains(t, anyOut.String(), "sign in to alice", "an authorized key admits any name")
+	require.Empty(t, room.tokens.List("alice"))
+
+	disabled, disabledOut := newCommandTestSession(NewRoom(), ClientInfo{Username: "alice", AuthMethod: "password"})
+	require.NoError(t, disabled.runCommand("/token list"))
+	require.Contains(t, disabledOut.String(), "not enabled")
+}
@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ledzpl/schat/pkg/audit"
+)
+
+// maxTopicLength bounds room topics so they fit the status line.
+const maxTopicLength = 200
+
+// topicSetting is the room settings key holding the topic.
+const topicSetting = "topic"
+
+// parseTopic validates a room topic. Like notice templates, topics are shown
+// verbatim to every member, so control characters are rejected.
+func parseTopic(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if len(text) > maxTopicLength {
+		return "", fmt.Errorf("topics are limited to %d bytes", maxTopicLength)
+	}
+	if strings.IndexFunc(text, unicode.IsControl) >= 0 {
+		return "", errors.New("topics cannot contain control characters")
+	}
+	return text, nil
+}
+
+// Topic returns the room topic, or "" when none is set.
+func (r *Room) Topic() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.topic
+}
+
+// SetTopic changes the room topic on behalf of actor and tells the room; an
+// empty topic clears it. Only the room owner or an operator may do this.
+func (r *Room) SetTopic(actor *Client, topic string) error {
+	if !r.canManage(actor) {
+		return errNotRoomManager
+	}
+	topic, err := parseTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.topic = topic
+	r.mu.Unlock()
+
+	if topic == "" {
+		r.broadcastSystem(fmt.Sprintf("%s cleared the topic of #%s", actor.Username, r.name))
+		r.audit(audit.Entry{Actor: actor.Username, Action: audit.Topic, Reason: "cleared"})
+	} else {
+		r.broadcastSystem(fmt.Sprintf("%s set the topic of #%s: %s", actor.Username, r.name, topic))
+		r.audit(audit.Entry{Actor: actor.Username, Action: audit.Topic, Reason: "set to " + topic})
+	}
+	return r.saveSettings()
+}
+
+// showTopic tells a member who just arrived what the room is about.
+func (r *Room) showTopic(client *Client) {
+	topic := r.Topic()
+	if topic == "" {
+		return
+	}
+	client.deliver(Message{
+		Timestamp: r.now(),
+		Body:      fmt.Sprintf("Topic for #%s: %s", r.name, topic),
+		Kind:      KindSystem,
+	}, r.backpressure, r.backpressureTimeout)
+}
+
+// runTopic shows or changes the current room's topic.
+func runTopic(s *session, args string) error {
+	room := s.room()
+	switch args {
+	case "":
+		if topic := room.Topic(); topic != "" {
+			return s.printSystem(fmt.Sprintf("Topic for #%s: %s", room.Name(), topic))
+		}
+		return s.printSystem(fmt.Sprintf("#%s has no topic", room.Name()))
+	case "clear":
+		args = ""
+	}
+	if err := room.SetTopic(s.client, args); err != nil {
+		return s.printSystem(fmt.Sprintf("/topic: %v", err))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestParseTopic(t *testing.T) {
+	tests := []struct {
+		name, text string
+		want       string
+		err        string
+	}{
+		{name: "trimmed", text: "  release day  ", want: "release day"},
+		{name: "empty clears", text: " ", want: ""},
+		{name: "escape", text: "red \x1b[31malert", err: "control characters"},
+		{name: "too long", text: strings.Repeat("x", maxTopicLength+1), err: "limited to 200 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTopic(tt.text)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRoomSetTopic(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	alice := dev.AddClient("alice")
+	bob := dev.AddClient("bob")
+	drainChannel(alice.Send())
+	drainChannel(bob.Send())
+
+	require.ErrorIs(t, dev.SetTopic(bob, "mine now"), errNotRoomManager)
+	require.Empty(t, dev.Topic())
+
+	require.NoError(t, dev.SetTopic(alice, "  release day "))
+	require.Equal(t, "release day", dev.Topic())
+	require.Equal(t, "alice set the topic of #dev: release day", (<-bob.Send()).Body)
+
+	carol := dev.AddClient("carol")
+	require.Equal(t, "carol joined the chat", (<-carol.Send()).Body)
+	shown := <-carol.Send()
+	require.Equal(t, KindSystem, shown.Kind)
+	require.Equal(t, "Topic for #dev: release day", shown.Body, "members see the topic when they arrive")
+	drainChannel(bob.Send())
+	require.Empty(t, bob.Send(), "only the newcomer is told the topic")
+
+	require.NoError(t, dev.SetTopic(alice, ""))
+	require.Empty(t, dev.Topic())
+	require.Equal(t, "alice cleared the topic of #dev", (<-bob.Send()).Body)
+}
+
+func TestRoomTopicPersists(t *testing.T) {
+	st := store.NewMemory()
+	m := newTestManager(WithRoomOptions(WithStore(st)))
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+	require.NoError(t, dev.SetTopic(dev.AddClient("alice"), "release day"))
+	require.NoError(t, dev.SetTemplate(noticeJoin, "hi {user}"))
+
+	restarted := newTestManager(WithRoomOptions(WithStore(st)))
+	dev, err = restarted.Create("dev", "alice")
+	require.NoError(t, err)
+	require.Equal(t, "release day", dev.Topic())
+	tmpl, ok := dev.Template(noticeJoin)
+	require.True(t, ok, "topics and templates are saved side by side")
+	require.Equal(t, "hi {user}", tmpl)
+}
+
+func TestTopicCommand(t *testing.T) {
+	m := newTestManager()
+	dev, err := m.Create("dev", "alice")
+	require.NoError(t, err)
+
+	owner, out := newCommandTestSession(dev, ClientInfo{Username: "alice", Account: true})
+	require.NoError(t, owner.runCommand("/topic"))
+	require.Contains(t, out.String(), "#dev has no topic")
+	require.Equal(t, "#dev | 1 online", owner.header())
+
+	require.NoError(t, owner.runCommand("/topic ship it"))
+	require.NoError(t, owner.runCommand("/topic"))
+	require.Contains(t, out.String(), "Topic for #dev: ship it")
+	require.Equal(t, "#dev | ship it | 1 online", owner.header())
+
+	member, out := newCommandTestSession(dev, ClientInfo{Username: "bob"})
+	require.NoError(t, member.runCommand("/topic mine"))
+	require.Contains(t, out.String(), "/topic: only the room owner or an operator can do that")
+
+	require.NoError(t, owner.runCommand("/topic clear"))
+	require.Empty(t, dev.Topic())
+}
+
+func TestTopicShownOnConnect(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	op := room.AddClient("op")
+	op.Operator = true
+	require.NoError(t, room.SetTopic(op, "be kind"))
+
+	alice := dialTranscript(t, room, "alice")
+	alice.waitFor(t, "Welcome to schat, alice!")
+	alice.waitFor(t, "[system] Topic for #lobby: be kind")
+	alice.waitFor(t, "#lobby | be kind ")
+}
@@ -0,0 +1,147 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ledzpl/schat/pkg/translate"
+	"github.com/ledzpl/schat/pkg/tui"
+)
+
+// translationQueueSize bounds the messages waiting to be translated for one
+// session; further messages are left untranslated until it drains.
+const translationQueueSize = 32
+
+// maxTranslationRunes caps a translation shown to the user; a provider should
+// never need more, whatever the room's own length limit.
+const maxTranslationRunes = 4 << 10
+
+// WithTranslator enables /translate using t.
+func WithTranslator(t *translate.Translator) RoomOption {
+	return func(r *Room) {
+		r.translator = t
+	}
+}
+
+// sessionTranslation delivers machine-translated copies of other users'
+// messages to one session. Translation runs on its own goroutine so slow
+// providers never hold up the shared relay workers.
+type sessionTranslation struct {
+	target atomic.Pointer[string]
+	queue  chan Message
+	ctx    context.Context
+	cancel context.CancelFunc
+	start  sync.Once
+}
+
+func newSessionTranslation() *sessionTranslation {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &sessionTranslation{
+		queue:  make(chan Message, translationQueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// targetLanguage returns the language messages are translated into, or "" when
+// translation is off.
+func (t *sessionTranslation) targetLanguage() string {
+	if target := t.target.Load(); target != nil {
+		return *target
+	}
+	return ""
+}
+
+// queueTranslation schedules msg for translation when the session asked for it.
+func (s *session) queueTranslation(msg Message) {
+	if (msg.Kind != KindChat && msg.Kind != KindAction) || msg.SenderID == s.client.ID || s.translation.targetLanguage() == "" {
+		return
+	}
+	select {
+	case s.translation.queue <- msg:
+	default:
+	}
+}
+
+func (s *session) startTranslationWorker() {
+	t := s.translation
+	t.start.Do(func() {
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			for {
+				select {
+				case <-t.ctx.Done():
+					return
+				case msg := <-t.queue:
+					if err := s.translateMessage(msg); err != nil {
+						return
+					}
+				}
+			}
+		}()
+	})
+}
+
+// translateMessage prints the translation of msg beneath the original.
+func (s *session) translateMessage(msg Message) error {
+	target := s.translation.targetLanguage()
+	translator := s.room().translator
+	if target == "" || translator == nil {
+		return nil
+	}
+
+	text, err := translator.Translate(s.translation.ctx, msg.Body, target)
+	switch {
+	case err == nil:
+		if text == msg.Body {
+			return nil
+		}
+		// The provider's text reaches the terminal like a message body, so it
+		// gets the same cleaning.
+		text, _ = cutRunes(tui.Sanitize(text), maxTranslationRunes)
+		if msg.Kind == KindAction {
+			return s.printMessage(fmt.Sprintf("  ↳ [%s] * %s %s", target, msg.SenderName, text))
+		}
+		return s.printMessage(fmt.Sprintf("  ↳ [%s] %s: %s", target, msg.SenderName, text))
+	case s.translation.ctx.Err() != nil:
+		return err
+	case errors.Is(err, translate.ErrRateLimited):
+		return s.printMessage(fmt.Sprintf("  ↳ [%s] (not translated: server translation limit reached)", target))
+	default:
+		s.log.Warn("chat: translation failed", "target", target, "err", err)
+		return s.printMessage(fmt.Sprintf("  ↳ [%s] (translation failed)", target))
+	}
+}
+
+// runTranslate turns machine translation of other users' messages on or off.
+func runTranslate(s *session, args string) error {
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		if target := s.translation.targetLanguage(); target != "" {
+			return s.printSystem(fmt.Sprintf("translating messages into %s; /translate off to stop", target))
+		}
+		return s.printSystem("translation is off; /translate on <language> to enable it")
+	case fields[0] == "on" && len(fields) == 2:
+		if s.room().translator == nil {
+			return s.printSystem("/translate: translation is not configured on this server")
+		}
+		target, err := translate.ParseLanguage(fields[1])
+		if err != nil {
+			return s.printSystem(fmt.Sprintf("/translate: %v", err))
+		}
+		s.translation.target.Store(&target)
+		s.startTranslationWorker()
+		return s.printSystem(fmt.Sprintf("translating messages from others into %s", target))
+	case fields[0] == "off" && len(fields) == 1:
+		s.translation.target.Store(nil)
+		return s.printSystem("translation is off")
+	default:
+		return s.printSystem("usage: /translate [on <language> | off]")
+	}
+}
@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/translate"
+)
+
+// dictionaryProvider translates a fixed set of English phrases.
+type dictionaryProvider map[string]string
+
+func (d dictionaryProvider) Translate(_ context.Context, text, target string) (string, error) {
+	if out, ok := d[target+":"+text]; ok {
+		return out, nil
+	}
+	return text, nil
+}
+
+func TestTranslateCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		room  *Room
+		cmds  []string
+		wants []string
+	}{
+		{
+			name:  "off by default",
+			room:  NewRoom(WithTranslator(translate.New(dictionaryProvider{}))),
+			cmds:  []string{"/translate"},
+			wants: []string{"translation is off; /translate on <language> to enable it"},
+		},
+		{
+			name:  "on and off",
+			room:  NewRoom(WithTranslator(translate.New(dictionaryProvider{}))),
+			cmds:  []string{"/translate on es", "/translate", "/translate off"},
+			wants: []string{"translating messages from others into es", "translating messages into es; /translate off to stop", "translation is off"},
+		},
+		{
+			name:  "not configured",
+			room:  NewRoom(),
+			cmds:  []string{"/translate on es"},
+			wants: []string{"/translate: translation is not configured on this server"},
+		},
+		{
+			name:  "invalid language",
+			room:  NewRoom(WithTranslator(translate.New(dictionaryProvider{}))),
+			cmds:  []string{"/translate on Spanish"},
+			wants: []string{`/translate: translate: invalid language code "Spanish"`},
+		},
+		{
+			name:  "usage",
+			room:  NewRoom(),
+			cmds:  []string{"/translate es"},
+			wants: []string{"usage: /translate [on <language> | off]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess, out := newCommandTestSession(tt.room, ClientInfo{Username: "alice"})
+			defer sess.translation.cancel()
+			for _, cmd := range tt.cmds {
+				require.NoError(t, sess.runCommand(cmd))
+			}
+			for _, want := range tt.wants {
+				require.Contains(t, out.String(), want)
+			}
+		})
+	}
+}
+
+func TestTranslationShownBeneathOriginal(t *testing.T) {
+	provider := dictionaryProvider{"es:good morning": "buenos días"}
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithTranslator(translate.New(provider)))
+
+	alice := dialTranscript(t, room, "alice")
+	alice.waitFor(t, "Welcome to schat, alice!")
+	alice.typeText(t, "/translate on es\r")
+	alice.waitFor(t, "translating messages from others into es")
+
+	bob := dialTranscript(t, room, "bob")
+	alice.waitFor(t, "[system] bob joined the chat")
+	bob.typeText(t, "good morning\r")
+	alice.waitFor(t, "  ↳ [es] bob: buenos días")
+
+	lines := strings.Split(alice.screen.String(), "\n")
+	for i, line := range lines {
+		if strings.Contains(line, "↳") {
+			require.Contains(t, lines[i-1], "bob: good morning")
+		}
+	}
+
+	alice.typeText(t, "hello bob\r")
+	bob.waitFor(t, "alice: hello bob")
+	require.NotContains(t, bob.screen.String(), "↳", "only sessions that opted in see translations")
+}
+
+func TestTranslationIsSanitizedAndCapped(t *testing.T) {
+	provider := dictionaryProvider{"es:hi": "\033]0;pwned\007hola " + strings.Repeat("x", 2*maxTranslationRunes)}
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithTranslator(translate.New(provider)))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	target := "es"
+	sess.translation.target.Store(&target)
+
+	require.NoError(t, sess.translateMessage(Message{Kind: KindChat, SenderName: "bob", Body: "hi"}))
+	require.Contains(t, out.String(), "↳ [es] bob: ")
+	require.Contains(t, out.String(), "hola x")
+	require.NotContains(t, out.String(), "\033]")
+	require.NotContains(t, out.String(), "\007")
+	require.Less(t, strings.Count(out.String(), "x"), maxTranslationRunes)
+}
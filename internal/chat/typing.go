@@ -0,0 +1,161 @@
+package chat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// typingRefresh throttles typing events: a session that keeps typing
+	// renews its indicator at most this often.
+	typingRefresh = 3 * time.Second
+	// typingTTL is how long an indicator lasts without a renewal, so it fades
+	// once someone stops typing without sending or erasing the line.
+	typingTTL = 2 * typingRefresh
+	// maxNamedTypists is how many typists the status line names before it
+	// only counts them.
+	maxNamedTypists = 3
+)
+
+// typingTracker records who is typing in a room, keyed by client ID.
+type typingTracker struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	typists map[string]*typist
+}
+
+type typist struct {
+	name  string
+	gen   uint64
+	timer *time.Timer
+}
+
+func newTypingTracker() *typingTracker {
+	return &typingTracker{ttl: typingTTL, typists: make(map[string]*typist)}
+}
+
+// SetTyping starts or stops client's typing indicator. Other members are
+// signalled only when the indicator appears or disappears; renewals just push
+// back its expiry.
+func (r *Room) SetTyping(client *Client, typing bool) {
+	t := r.typing
+	t.mu.Lock()
+	current, was := t.typists[client.ID]
+	switch {
+	case typing && was:
+		current.gen++
+		current.timer.Stop()
+		current.timer = r.expireTypingAfter(client.ID, current.gen)
+	case typing:
+		t.typists[client.ID] = &typist{name: client.Username, timer: r.expireTypingAfter(client.ID, 0)}
+	case was:
+		current.timer.Stop()
+		delete(t.typists, client.ID)
+	}
+	t.mu.Unlock()
+
+	if typing != was {
+		r.signalTyping(client.ID)
+	}
+}
+
+func (r *Room) expireTypingAfter(id string, gen uint64) *time.Timer {
+	return time.AfterFunc(r.typing.ttl, func() {
+		t := r.typing
+		t.mu.Lock()
+		current, ok := t.typists[id]
+		expired := ok && current.gen == gen
+		if expired {
+			delete(t.typists, id)
+		}
+		t.mu.Unlock()
+
+		if expired {
+			r.signalTyping(id)
+		}
+	})
+}
+
+// clearTyping drops id's indicator without signalling, for clients leaving
+// the room; their leave notice redraws everyone's status line anyway.
+func (r *Room) clearTyping(id string) {
+	t := r.typing
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, ok := t.typists[id]; ok {
+		current.timer.Stop()
+		delete(t.typists, id)
+	}
+}
+
+// Typists returns the names of members typing, other than excludeID, sorted.
+func (r *Room) Typists(excludeID string) []string {
+	t := r.typing
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.typists))
+	for id, typist := range t.typists {
+		if id != excludeID {
+			names = append(names, typist.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// signalTyping asks every member but excludeID to redraw its status line.
+// The signal is best effort: it is skipped for full queues rather than
+// displacing real messages.
+func (r *Room) signalTyping(excludeID string) {
+	msg := Message{Timestamp: r.now(), Kind: KindTyping}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for id, client := range r.clients {
+		if id != excludeID {
+			client.enqueue(msg)
+		}
+	}
+}
+
+// describeTypists renders the typing part of the status line.
+func describeTypists(names []string) string {
+	switch {
+	case len(names) == 0:
+		return ""
+	case len(names) == 1:
+		return names[0] + " is typing…"
+	case len(names) <= maxNamedTypists:
+		return strings.Join(names, ", ") + " are typing…"
+	default:
+		return fmt.Sprintf("%d people are typing…", len(names))
+	}
+}
+
+// updateTyping announces or withdraws the session's typing indicator after
+// its input line changed, throttled to one renewal per typingRefresh.
+func (s *session) updateTyping() {
+	if s.buffer.Empty() {
+		s.stopTyping()
+		return
+	}
+	now := s.room().now()
+	if !s.typingSent.IsZero() && now.Sub(s.typingSent) < typingRefresh {
+		return
+	}
+	s.typingSent = now
+	s.room().SetTyping(s.client, true)
+}
+
+// stopTyping withdraws the session's typing indicator, if it announced one.
+func (s *session) stopTyping() {
+	if s.typingSent.IsZero() {
+		return
+	}
+	s.typingSent = time.Time{}
+	s.room().SetTyping(s.client, false)
+}
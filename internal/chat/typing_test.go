@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribeTypists(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{names: nil, want: ""},
+		{names: []string{"alice"}, want: "alice is typing…"},
+		{names: []string{"alice", "bob"}, want: "alice, bob are typing…"},
+		{names: []string{"alice", "bob", "carol"}, want: "alice, bob, carol are typing…"},
+		{names: []string{"alice", "bob", "carol", "dave"}, want: "4 people are typing…"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, describeTypists(tt.names))
+	}
+}
+
+func TestRoomSetTyping(t *testing.T) {
+	room := NewRoom()
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	drainChannel(alice.Send())
+	drainChannel(bob.Send())
+
+	room.SetTyping(alice, true)
+	require.Equal(t, KindTyping, (<-bob.Send()).Kind)
+	require.Empty(t, alice.Send(), "typists are not signalled about themselves")
+	require.Equal(t, []string{"alice"}, room.Typists(bob.ID))
+	require.Empty(t, room.Typists(alice.ID))
+
+	room.SetTyping(alice, true)
+	require.Empty(t, bob.Send(), "renewals do not signal again")
+
+	room.SetTyping(bob, true)
+	drainChannel(alice.Send())
+	require.Equal(t, []string{"alice", "bob"}, room.Typists(""))
+
+	room.SetTyping(alice, false)
+	require.Equal(t, KindTyping, (<-bob.Send()).Kind)
+	require.Equal(t, []string{"bob"}, room.Typists(""))
+
+	room.RemoveClient(bob.ID)
+	require.Empty(t, room.Typists(""), "leaving clears the indicator")
+}
+
+func TestTypingIndicatorExpires(t *testing.T) {
+	room := NewRoom()
+	room.typing.ttl = 20 * time.Millisecond
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	drainChannel(bob.Send())
+
+	room.SetTyping(alice, true)
+	require.Equal(t, KindTyping, (<-bob.Send()).Kind)
+	select {
+	case msg := <-bob.Send():
+		require.Equal(t, KindTyping, msg.Kind)
+	case <-time.After(time.Second):
+		t.Fatal("typing indicator never expired")
+	}
+	require.Empty(t, room.Typists(""))
+}
+
+func TestTypingIndicatorInStatusLine(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+
+	alice := dialTranscript(t, room, "alice")
+	alice.waitFor(t, "Welcome to schat, alice!")
+	bob := dialTranscript(t, room, "bob")
+	bob.waitFor(t, "Welcome to schat, bob!")
+
+	alice.typeText(t, "hel")
+	bob.waitFor(t, "#lobby | alice is typing… ")
+	require.NotContains(t, alice.screen.String(), "typing", "typists do not see themselves")
+
+	alice.typeText(t, "lo\r")
+	bob.waitFor(t, "alice: hello")
+	require.Eventually(t, func() bool {
+		status := strings.SplitN(bob.screen.String(), "\n", 2)[0]
+		return !strings.Contains(status, "typing") && strings.Contains(status, " 2 online")
+	}, 2*time.Second, 5*time.Millisecond, "sending clears the indicator")
+}
@@ -0,0 +1,87 @@
+package chat
+
+import "fmt"
+
+// unreadDivider separates the messages a returning user missed from the
+// ones they had already seen.
+const unreadDivider = "--- unread messages below ---"
+
+// maxUnreadReplay bounds how many missed messages are replayed on join.
+const maxUnreadReplay = 50
+
+// unreadReplay is what a registered user missed in a room while away from
+// it, waiting for their session to show it.
+type unreadReplay struct {
+	messages []Message
+	// older is how many earlier missed messages did not fit.
+	older int
+}
+
+// markSeen remembers the newest message a registered client could have seen
+// in the room, as they leave it. Guests are not tracked, since anyone may
+// take a guest name. The caller holds r.mu.
+func (r *Room) markSeen(client *Client) {
+	if !client.Registered() {
+		return
+	}
+	if r.seen == nil {
+		r.seen = make(map[string]uint64)
+	}
+	r.seen[client.Username] = r.lastMessageID.Load()
+}
+
+// collectUnread hands a registered client rejoining the room the chat and
+// action messages in its history they have not seen, oldest first.
+func (r *Room) collectUnread(client *Client) {
+	client.unread.Store(nil)
+	if !client.Registered() {
+		return
+	}
+	r.mu.RLock()
+	seen, ok := r.seen[client.Username]
+	r.mu.RUnlock()
+	if !ok {
+		return
+	}
+	var missed []Message
+	for _, msg := range r.history.Recent(0) {
+		if msg.ID > seen && !msg.Deleted && (msg.Kind == KindChat || msg.Kind == KindAction) {
+			missed = append(missed, msg)
+		}
+	}
+	if len(missed) == 0 {
+		return
+	}
+	replay := &unreadReplay{messages: missed}
+	if len(missed) > maxUnreadReplay {
+		replay.messages = missed[len(missed)-maxUnreadReplay:]
+		replay.older = len(missed) - maxUnreadReplay
+	}
+	client.unread.Store(replay)
+}
+
+// showUnread prints what the user missed in their room since they were last
+// in it, below a divider.
+func (s *session) showUnread() error {
+	replay := s.client.unread.Swap(nil)
+	if replay == nil {
+		return nil
+	}
+	if replay.older > 0 {
+		if err := s.printSystem(fmt.Sprintf("%d earlier unread messages are not shown", replay.older)); err != nil {
+			return err
+		}
+	}
+	if err := s.printMessage(unreadDivider); err != nil {
+		return err
+	}
+	for _, msg := range replay.messages {
+		if s.prefs.filters.hides(msg) {
+			continue
+		}
+		if err := s.printMessage(s.renderer.Render(msg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
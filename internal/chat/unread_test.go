@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnreadAfterRejoin(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	bob := room.AddClient("bob")
+	alice := room.Join(ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	_, err := room.Broadcast(bob.ID, "bob", "seen before leaving")
+	require.NoError(t, err)
+	room.RemoveClient(alice.ID)
+
+	_, err = room.Broadcast(bob.ID, "bob", "while you were away")
+	require.NoError(t, err)
+	_, err = room.Action(bob.ID, "bob", "waves")
+	require.NoError(t, err)
+	gone, err := room.Broadcast(bob.ID, "bob", "oops")
+	require.NoError(t, err)
+	_, err = room.DeleteMessage(bob.ID, gone.ID)
+	require.NoError(t, err)
+
+	alice = room.Join(ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	replay := alice.unread.Load()
+	require.NotNil(t, replay)
+	require.Len(t, replay.messages, 2)
+	require.Equal(t, "while you were away", replay.messages[0].Body)
+	require.Equal(t, KindAction, replay.messages[1].Kind)
+
+	room.RemoveClient(alice.ID)
+	alice = room.Join(ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	require.Nil(t, alice.unread.Load(), "nothing new since the last visit")
+}
+
+func TestUnreadNotTrackedForGuests(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+	bob := room.AddClient("bob")
+	carol := room.AddClient("carol")
+	room.RemoveClient(carol.ID)
+	_, err := room.Broadcast(bob.ID, "bob", "hi")
+	require.NoError(t, err)
+
+	carol = room.AddClient("carol")
+	require.Nil(t, carol.unread.Load())
+}
+
+func TestShowUnread(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithHistorySize(maxUnreadReplay+10))
+	bob := room.AddClient("bob")
+	alice := room.Join(ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	room.RemoveClient(alice.ID)
+	for i := 1; i <= maxUnreadReplay+2; i++ {
+		_, err := room.Broadcast(bob.ID, "bob", fmt.Sprintf("message %d", i))
+		require.NoError(t, err)
+	}
+
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice", AuthMethod: "publickey"})
+	sess.renderer.setOptions(timestampsHidden, false)
+	require.NoError(t, sess.showUnread())
+	require.Contains(t, out.String(), "2 earlier unread messages are not shown")
+	require.Contains(t, out.String(), unreadDivider)
+	require.NotContains(t, out.String(), "message 2\r\n")
+	require.Contains(t, out.String(), "bob: message 3")
+	require.Contains(t, out.String(), fmt.Sprintf("bob: message %d", maxUnreadReplay+2))
+
+	out.Reset()
+	require.NoError(t, sess.showUnread())
+	require.Empty(t, out.String(), "the replay is shown once")
+}
+
+func TestUnreadDividerOnReconnect(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}))
+
+	bob := dialTranscript(t, room, "bob")
+	bob.waitFor(t, "Welcome to schat, bob!")
+	first, err := dialUser(t, room, "alice", true).NewSession()
+	require.NoError(t, err)
+	require.NoError(t, first.Shell())
+	bob.waitFor(t, "alice joined the chat")
+	_ = first.Close()
+	bob.waitFor(t, "alice left the chat")
+
+	bob.typeText(t, "did you see the release notes?\r")
+	bob.waitFor(t, "bob: did you see the release notes?")
+
+	sess, err := dialUser(t, room, "alice", true).NewSession()
+	require.NoError(t, err)
+	alice := attachTranscript(t, sess)
+	alice.waitFor(t, unreadDivider)
+	alice.waitFor(t, "bob: did you see the release notes?")
+}
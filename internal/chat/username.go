@@ -0,0 +1,154 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// maxUsernameLength bounds usernames in characters.
+const maxUsernameLength = 32
+
+// errRegisteredName refuses a registered account's name to someone who did
+// not sign in to it.
+var errRegisteredName = errors.New("the name is registered; sign in with its password or key")
+
+// confusableScripts are the scripts whose letters are easily mistaken for one
+// another. A name may use any one of them, but not a mix.
+var confusableScripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+}
+
+// confusables maps letters that look like Latin ones to the letter they
+// imitate, after lowercasing.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j',
+	'к': 'k', 'ӏ': 'l', 'м': 'm', 'п': 'n', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'г': 'r',
+	'ѕ': 's', 'т': 't', 'ц': 'u', 'ѵ': 'v', 'ԝ': 'w', 'х': 'x', 'у': 'y',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y',
+	// Digits and lookalike Latin letters
+	'0': 'o', '1': 'l', 'ı': 'i', 'ℓ': 'l',
+}
+
+// normalizeUsername returns name in NFC with control and invisible formatting
+// characters removed, or an error when what is left would render badly or
+// could pass for another user.
+func normalizeUsername(name string) (string, error) {
+	name = sshserver.CanonicalUsername(name)
+	switch {
+	case name == "":
+		return "", errors.New("the name is empty")
+	case utf8.RuneCountInString(name) > maxUsernameLength:
+		return "", fmt.Errorf("the name is longer than %d characters", maxUsernameLength)
+	case strings.IndexFunc(name, unicode.IsSpace) >= 0:
+		return "", errors.New("the name contains spaces")
+	}
+	if a, b, mixed := mixedScripts(name); mixed {
+		return "", fmt.Errorf("the name mixes %s and %s letters", a, b)
+	}
+	return name, nil
+}
+
+// mixedScripts reports the first two confusable scripts name uses letters
+// from, if it uses more than one.
+func mixedScripts(name string) (string, string, bool) {
+	first := ""
+	for _, r := range name {
+		for _, script := range confusableScripts {
+			if !unicode.Is(script.table, r) {
+				continue
+			}
+			if first == "" {
+				first = script.name
+			} else if script.name != first {
+				return first, script.name, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// usernameSkeleton folds case and lookalike letters, so two names with the
+// same skeleton look alike on screen.
+func usernameSkeleton(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r == 'I' {
+			// A capital I looks like a lowercase l in most fonts.
+			r = 'l'
+		}
+		r = unicode.ToLower(r)
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return strings.ReplaceAll(b.String(), "rn", "m")
+}
+
+// checkUsername normalizes a name someone asked to join as, and rejects it
+// when it is a registered account the client did not sign in to, or looks
+// like, but is not, the name of someone already online.
+func (r *Room) checkUsername(name string, account bool) (string, error) {
+	name, err := normalizeUsername(name)
+	if err != nil {
+		return "", err
+	}
+	if !account && r.accounts != nil && r.accounts.Registered(name) {
+		return "", errRegisteredName
+	}
+	rooms := []*Room{r}
+	if r.manager != nil {
+		rooms = r.manager.Rooms()
+	}
+	skeleton := usernameSkeleton(name)
+	for _, room := range rooms {
+		for _, client := range room.Clients() {
+			if client.Username != name && usernameSkeleton(client.Username) == skeleton {
+				return "", fmt.Errorf("the name looks too much like %s, who is online", client.Username)
+			}
+		}
+	}
+	return name, nil
+}
+
+// showRejectedName tells a user why they joined under a generated name.
+func (r *Room) showRejectedName(client *Client, requested string, err error) {
+	client.deliver(Message{
+		Timestamp: r.now(),
+		Body:      fmt.Sprintf("the name %q was not accepted: %v; you joined as %s", stripControl(requested), err, client.Username),
+		Kind:      KindSystem,
+	}, r.backpressure, r.backpressureTimeout)
+}
+
+// CheckGuestName reports why a user who did not sign in, such as one picking a
+// name at the telnet prompt or an anonymous browser, may not take name: it is
+// unusable, registered to an account, or listed as an operator's.
+func (r *Room) CheckGuestName(name string) error {
+	name, err := normalizeUsername(name)
+	if err != nil {
+		return err
+	}
+	if r.accounts != nil && r.accounts.Registered(name) {
+		return errRegisteredName
+	}
+	r.mu.RLock()
+	_, listed := r.operators[name]
+	r.mu.RUnlock()
+	if listed {
+		return errors.New("the name belongs to an operator")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	cases := []struct {
+		in, want, err string
+	}{
+		{in: "alice", want: "alice"},
+		{in: "  bob\x1b[31m ", want: "bob[31m"},
+		{in: "cafe\u0301", want: "caf\u00e9"},
+		{in: "ev\u200be", want: "eve"},
+		{in: "\u202eevil", want: "evil"},
+		{in: "철수", want: "철수"},
+		{in: "Δημήτρης", want: "Δημήτρης"},
+		{in: "\x07\u200b", err: "the name is empty"},
+		{in: strings.Repeat("a", 33), err: "the name is longer than 32 characters"},
+		{in: "john doe", err: "the name contains spaces"},
+		{in: "аlice", err: "the name mixes Cyrillic and Latin letters"},
+	}
+	for _, tc := range cases {
+		got, err := normalizeUsername(tc.in)
+		if tc.err != "" {
+			require.EqualError(t, err, tc.err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.want, got, tc.in)
+	}
+}
+
+func TestUsernameSkeleton(t *testing.T) {
+	require.Equal(t, usernameSkeleton("alice"), usernameSkeleton("aIice"))
+	require.Equal(t, usernameSkeleton("bob"), usernameSkeleton("B0B"))
+	require.Equal(t, usernameSkeleton("modern"), usernameSkeleton("rnodern"))
+	require.Equal(t, usernameSkeleton("ops"), usernameSkeleton("орѕ"), "all-Cyrillic lookalikes")
+	require.NotEqual(t, usernameSkeleton("alice"), usernameSkeleton("alicia"))
+}
+
+func TestJoinRejectsLookalikeNames(t *testing.T) {
+	m := newTestManager()
+	require.NoError(t, m.Ensure("dev"))
+	dev, ok := m.Room("dev")
+	require.True(t, ok)
+	alice := m.lobby.AddClient("alice")
+	drainChannel(alice.Send())
+
+	again := dev.AddClient("alice")
+	require.Equal(t, "alice", again.Username, "the same name may sign in twice")
+
+	imposter := dev.AddClient("aIice")
+	require.Equal(t, imposter.ID, imposter.Username)
+	require.Equal(t, `the name "aIice" was not accepted: the name looks too much like alice, who is online; you joined as `+imposter.ID, (<-imposter.Send()).Body)
+
+	cyrillic := dev.AddClient("аlice")
+	require.Contains(t, (<-cyrillic.Send()).Body, "the name mixes Cyrillic and Latin letters")
+	require.Equal(t, cyrillic.ID, cyrillic.Username)
+
+	composed := dev.AddClient("jose\u0301")
+	require.Equal(t, "jos\u00e9", composed.Username, "names are stored composed")
+}
+
+func TestJoinRefusesRegisteredNamesWithoutTheAccount(t *testing.T) {
+	accounts, err := sshserver.OpenAccounts(filepath.Join(t.TempDir(), "accounts.json"))
+	require.NoError(t, err)
+	require.NoError(t, accounts.Register("alice", "correct horse", ""))
+	room := NewRoom(WithAccounts(accounts))
+
+	for _, name := range []string{"alice", "alice\u200b", " alice"} {
+		guest := room.Join(ClientInfo{Username: name})
+		require.Equal(t, guest.ID, guest.Username, "%q", name)
+		require.Contains(t, (<-guest.Send()).Body, "the name is registered; sign in with its password or key")
+	}
+
+	owner := room.Join(ClientInfo{Username: "alice", AuthMethod: "password", Account: true})
+	require.Equal(t, "alice", owner.Username)
+}
+
+func TestCheckGuestName(t *testing.T) {
+	accounts, err := sshserver.OpenAccounts(filepath.Join(t.TempDir(), "accounts.json"))
+	require.NoError(t, err)
+	require.NoError(t, accounts.Register("alice", "correct horse", ""))
+	room := NewRoom(WithAccounts(accounts), WithOperators("root"))
+
+	require.NoError(t, room.CheckGuestName("bob"))
+	require.ErrorIs(t, room.CheckGuestName("alice\u200b"), errRegisteredName)
+	require.ErrorContains(t, room.CheckGuestName("root"), "operator")
+	require.ErrorContains(t, room.CheckGuestName("two words"), "spaces")
+}
+
+func TestOIDCSignInJoinsUnderTheVerifiedName(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithOperators("alice@example.com"))
+	client := dialSSHWith(t, room, "root", &ssh.ServerConfig{
+		NoClientAuth: true,
+		NoClientAuthCallback: func(ssh.ConnMetadata) (*ssh.Permissions, error) {
+			return &ssh.Permissions{Extensions: map[string]string{
+				sshserver.ExtAuthMethod:   "oidc",
+				sshserver.ExtOIDCUsername: "alice@example.com",
+				sshserver.ExtAccount:      "1",
+			}}, nil
+		},
+	})
+	sess, err := client.NewSession()
+	require.NoError(t, err)
+	sess.Stdout = io.Discard
+	_, err = sess.StdinPipe() // an open stdin keeps the session joined
+	require.NoError(t, err)
+	require.NoError(t, sess.RequestPty("xterm", transcriptRows, transcriptCols, ssh.TerminalModes{}))
+	require.NoError(t, sess.Shell())
+	require.Eventually(t, func() bool { return room.ClientCount() == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	joined := room.Clients()[0]
+	require.Equal(t, "alice@example.com", joined.Username, "the SSH username is ignored")
+	require.True(t, joined.Operator)
+}
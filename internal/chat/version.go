@@ -0,0 +1,8 @@
+package chat
+
+import "github.com/ledzpl/schat/pkg/buildinfo"
+
+// runVersion shows the server's build: /version.
+func runVersion(s *session, _ string) error {
+	return s.printSystem(buildinfo.Get().String())
+}
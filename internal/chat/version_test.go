@@ -0,0 +1,33 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/buildinfo"
+)
+
+func TestVersionCommand(t *testing.T) {
+	old := buildinfo.Version
+	buildinfo.Version = "v1.2.0"
+	t.Cleanup(func() { buildinfo.Version = old })
+
+	room := NewRoom()
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+	require.NoError(t, sess.runCommand("/version"))
+	require.Contains(t, out.String(), "schat v1.2.0 (")
+}
+
+func TestMOTDShowsVersion(t *testing.T) {
+	old := buildinfo.Version
+	buildinfo.Version = "v1.2.0"
+	t.Cleanup(func() { buildinfo.Version = old })
+
+	motd, err := ParseMOTD("{{.ServerName}} {{.Version}}")
+	require.NoError(t, err)
+	room := NewRoom(WithMOTD(motd))
+	lines, err := room.greeting(room.AddClient("alice"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"schat v1.2.0"}, lines)
+}
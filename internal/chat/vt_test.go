@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hinshun/vt10x"
+)
+
+// vtScreen is a vt10x terminal that session output is drawn into. vt10x
+// gives every rune one column, so screens checked here hold narrow text.
+type vtScreen struct {
+	term vt10x.Terminal
+
+	mu sync.Mutex
+	// partial holds the start of a rune split across writes, which vt10x
+	// would drop.
+	partial []byte
+}
+
+func newVTScreen(cols, rows int) *vtScreen {
+	return &vtScreen{term: vt10x.New(vt10x.WithSize(cols, rows))}
+}
+
+func (s *vtScreen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := append(s.partial, p...)
+	n := len(data)
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				n = len(data) - i
+			}
+			break
+		}
+	}
+	if _, err := s.term.Write(data[:n]); err != nil {
+		return 0, err
+	}
+	s.partial = append([]byte(nil), data[n:]...)
+	return len(p), nil
+}
+
+// String dumps the screen one row per line, trimming trailing blanks.
+func (s *vtScreen) String() string {
+	lines := strings.Split(s.term.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Cursor returns the zero-based cursor column and row.
+func (s *vtScreen) Cursor() (x, y int) {
+	s.term.Lock()
+	defer s.term.Unlock()
+	cur := s.term.Cursor()
+	return cur.X, cur.Y
+}
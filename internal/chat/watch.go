@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"sync"
+
+	"github.com/ledzpl/schat/pkg/adminapi"
+)
+
+// watchQueueSize bounds how far a watcher may fall behind before it misses
+// messages.
+const watchQueueSize = 256
+
+// watchers fans the messages posted in rooms out to control API streams.
+// Rooms under one manager share it so a stream of every room also sees rooms
+// created after it started.
+type watchers struct {
+	mu sync.RWMutex
+	// subs maps each watcher to the room it follows, or "" for every room.
+	subs map[chan adminapi.Message]string
+}
+
+func newWatchers() *watchers {
+	return &watchers{subs: make(map[chan adminapi.Message]string)}
+}
+
+// watch registers a watcher of room, or of every room when room is "". The
+// returned func removes it.
+func (w *watchers) watch(room string) (<-chan adminapi.Message, func()) {
+	ch := make(chan adminapi.Message, watchQueueSize)
+	w.mu.Lock()
+	w.subs[ch] = room
+	w.mu.Unlock()
+
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs, ch)
+	}
+}
+
+// publish hands msg, posted in room, to its watchers without waiting for
+// any of them.
+func (w *watchers) publish(room string, msg Message) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if len(w.subs) == 0 {
+		return
+	}
+	watched := adminapi.Message{
+		Room: room,
+		ID:   msg.ID,
+		Time: msg.Timestamp,
+		Kind: msg.Kind.String(),
+		From: msg.SenderName,
+		Body: msg.Body,
+	}
+	for ch, want := range w.subs {
+		if want != "" && want != room {
+			continue
+		}
+		select {
+		case ch <- watched:
+		default:
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/features"
+	"github.com/ledzpl/schat/pkg/sshserver"
+	"github.com/ledzpl/schat/pkg/tui"
+	"github.com/ledzpl/schat/pkg/webgateway"
+)
+
+// errReadOnlyWeb answers lines typed in a session signed in with a read-only
+// token.
+var errReadOnlyWeb = errors.New("this token is read-only; sign in with a read-write token to chat")
+
+// errWebGatewayDisabled refuses browsers while the web-gateway feature flag is
+// off in the room they would join.
+var errWebGatewayDisabled = errors.New("web access is turned off on this server")
+
+// escapeSequence matches the terminal escapes rendered lines carry.
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// HandleWebSession joins a browser signed in through pkg/webgateway to room
+// and runs its session until the browser leaves or ctx is done. Web sessions
+// share rooms with SSH sessions and show in /who; lines starting with "/" run
+// the same commands, whose output comes back as system lines. Browsers are
+// refused while the web-gateway feature flag is off in room.
+func HandleWebSession(ctx context.Context, room *Room, conn webgateway.Conn) error {
+	user := conn.User()
+	info := ClientInfo{
+		Username:      user.Name,
+		AuthMethod:    user.AuthMethod,
+		Account:       user.Account,
+		RemoteAddr:    user.RemoteAddr,
+		ClientVersion: webgateway.ClientVersion,
+		SessionID:     user.SessionID,
+	}
+	s := newSession(ctx, room, info, nil, nil)
+	s.web = conn
+	// Commands that redraw the terminal draw nowhere.
+	s.ui = tui.NewScreen(io.Discard)
+	return s.serveWeb(user.ReadOnly)
+}
+
+func (s *session) serveWeb(readOnly bool) error {
+	defer s.cleanupSession()
+	if err := s.home.checkBanned(s.info); err != nil {
+		s.printSystemError(err)
+		return err
+	}
+	if !s.home.FeatureEnabled(features.WebGateway) {
+		s.log.Info("chat: web session refused", "username", stripControl(s.info.Username), "room", s.home.Name())
+		s.printSystemError(errWebGatewayDisabled)
+		return sshserver.Exit(sshserver.ExitFailed, errWebGatewayDisabled)
+	}
+	s.client = s.home.Join(s.info)
+	s.log = s.log.With("username", s.client.Username)
+	s.log.Info("chat: web session joined", "room", s.home.Name(), "auth_method", s.client.AuthMethod, "read_only", readOnly)
+	s.renderer.setViewer(s.client.Username, s.client.Color)
+	s.renderer.now = s.home.now
+	s.client.setDisconnectHandler(s.dropWeb)
+
+	if err := s.web.Send(webgateway.Event{
+		Type: webgateway.EventReady,
+		Time: s.room().now(),
+		User: s.client.Username,
+		Room: s.room().Name(),
+	}); err != nil {
+		return s.exitFor(sshserver.Exit(sshserver.ExitClientGone, err))
+	}
+	if err := s.sendGreeting(); err != nil {
+		return s.exitFor(sshserver.Exit(sshserver.ExitClientGone, err))
+	}
+	s.relay = s.home.relay.attach(s.client, s.relayWeb)
+
+	defer s.dropOnDone(s.dropWeb)()
+	for {
+		line, err := s.web.Receive()
+		if errors.Is(err, io.EOF) {
+			return s.exitFor(nil)
+		}
+		if err != nil {
+			return s.exitFor(sshserver.Exit(sshserver.ExitClientGone, err))
+		}
+		text := strings.TrimSpace(stripControl(line))
+		switch {
+		case text == "":
+			continue
+		case readOnly:
+			err = s.printSystem(errReadOnlyWeb.Error())
+		case isCommand(text):
+			err = s.runCommandLine(text)
+		default:
+			s.room().touch(s.client)
+			err = s.postWeb(unescapeCommand(text))
+		}
+		if err != nil {
+			return s.exitFor(sshserver.Exit(sshserver.ExitClientGone, err))
+		}
+	}
+}
+
+// postWeb broadcasts a line typed in the browser and shows it there, as
+// broadcastLine does in a terminal.
+func (s *session) postWeb(text string) error {
+	msg, err := s.room().Broadcast(s.client.ID, s.client.Username, text)
+	if err != nil {
+		return s.printSystem("message not sent: " + err.Error())
+	}
+	return s.web.Send(s.webEvent(msg))
+}
+
+// relayWeb sends a message delivered to the client to the browser. Messages
+// the browser cannot show as such, like edits and reactions, go as the line
+// a terminal would show.
+func (s *session) relayWeb(msg Message) error {
+	if s.prefs.filters.hides(msg) {
+		return nil
+	}
+	switch msg.Kind {
+	case KindTyping:
+		return nil
+	case KindChat, KindAction, KindDirect, KindSystem:
+		return s.web.Send(s.webEvent(msg))
+	}
+	return s.printMessage(s.renderer.Render(msg))
+}
+
+// webEvent converts a message into its browser form.
+func (s *session) webEvent(msg Message) webgateway.Event {
+	ev := webgateway.Event{
+		Type: webgateway.EventMessage,
+		Time: msg.Timestamp,
+		Room: s.room().Name(),
+		From: msg.SenderName,
+		Kind: msg.Kind.String(),
+		Body: msg.Body,
+	}
+	if msg.Kind == KindDirect {
+		ev.Room = ""
+	}
+	return ev
+}
+
+// printWeb shows lines of terminal output in the browser.
+func (s *session) printWeb(lines ...string) error {
+	now := s.room().now()
+	for _, line := range lines {
+		for _, l := range strings.Split(line, "\n") {
+			l = escapeSequence.ReplaceAllString(strings.TrimRight(l, "\r"), "")
+			if err := s.web.Send(webgateway.Event{Type: webgateway.EventSystem, Time: now, Body: l}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dropWeb ends a web session for exit, telling the user why.
+func (s *session) dropWeb(exit *sshserver.SessionExit) {
+	s.dropped.Store(exit)
+	go func() {
+		_ = s.printSystem("disconnected: " + exit.Error())
+		_ = s.web.Close()
+	}()
+}
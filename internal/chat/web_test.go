@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/features"
+	"github.com/ledzpl/schat/pkg/sshserver"
+	"github.com/ledzpl/schat/pkg/webgateway"
+)
+
+// fakeWebConn is a browser driven by the test.
+type fakeWebConn struct {
+	user  webgateway.User
+	lines chan string
+	done  chan struct{}
+	once  sync.Once
+
+	mu     sync.Mutex
+	events []webgateway.Event
+}
+
+func newFakeWebConn(user webgateway.User) *fakeWebConn {
+	return &fakeWebConn{user: user, lines: make(chan string), done: make(chan struct{})}
+}
+
+func (c *fakeWebConn) User() webgateway.User { return c.user }
+
+func (c *fakeWebConn) Receive() (string, error) {
+	select {
+	case line := <-c.lines:
+		return line, nil
+	case <-c.done:
+		return "", io.EOF
+	}
+}
+
+func (c *fakeWebConn) Send(ev webgateway.Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, ev)
+	return nil
+}
+
+func (c *fakeWebConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+// find waits for an event of type typ whose body contains text.
+func (c *fakeWebConn) find(t *testing.T, typ, text string) webgateway.Event {
+	t.Helper()
+	var found webgateway.Event
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, ev := range c.events {
+			if ev.Type == typ && strings.Contains(ev.Body, text) {
+				found = ev
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 5*time.Millisecond, "no %s event %q", typ, text)
+	return found
+}
+
+// webFeatures turns the web-gateway flag on, as --web-addr does.
+func webFeatures() *features.Set {
+	return features.New(map[features.Flag]bool{features.WebGateway: true})
+}
+
+// startWebSession runs a web session for conn in room until the test ends.
+func startWebSession(t *testing.T, room *Room, conn *fakeWebConn) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- HandleWebSession(context.Background(), room, conn) }()
+	t.Cleanup(func() {
+		_ = conn.Close()
+		<-done
+	})
+	conn.find(t, webgateway.EventReady, "")
+}
+
+func TestWebSessionSharesRoom(t *testing.T) {
+	m := newTestManager(WithRoomOptions(WithFeatures(webFeatures())))
+	alice := m.Lobby().AddClient("alice")
+	drainChannel(alice.Send())
+
+	conn := newFakeWebConn(webgateway.User{Name: "wendy", AuthMethod: "token", Account: true, SessionID: "web-1"})
+	startWebSession(t, m.Lobby(), conn)
+	require.Equal(t, "lobby", conn.find(t, webgateway.EventReady, "").Room)
+
+	sess, out := newCommandTestSession(m.Lobby(), ClientInfo{Username: "carol"})
+	require.NoError(t, sess.runCommand("/who"))
+	require.Regexp(t, `wendy\s+joined .* via web`, out.String())
+
+	_, err := m.Lobby().Broadcast(alice.ID, "alice", "hi from ssh")
+	require.NoError(t, err)
+	ev := conn.find(t, webgateway.EventMessage, "hi from ssh")
+	require.Equal(t, "alice", ev.From)
+	require.Equal(t, "chat", ev.Kind)
+
+	drainChannel(alice.Send())
+	conn.lines <- "hi from the\x1b[2J web"
+	got := <-alice.Send()
+	require.Equal(t, "wendy", got.SenderName)
+	require.Equal(t, "hi from the[2J web", got.Body)
+	require.Equal(t, "wendy", conn.find(t, webgateway.EventMessage, "hi from the").From, "the sender sees its own message")
+
+	conn.lines <- "/who"
+	conn.find(t, webgateway.EventSystem, "online in #lobby")
+}
+
+func TestWebSessionReadOnly(t *testing.T) {
+	m := newTestManager(WithRoomOptions(WithFeatures(webFeatures())))
+	alice := m.Lobby().AddClient("alice")
+	drainChannel(alice.Send())
+
+	conn := newFakeWebConn(webgateway.User{Name: "lurker", AuthMethod: "token", ReadOnly: true})
+	startWebSession(t, m.Lobby(), conn)
+	conn.lines <- "hello?"
+	conn.find(t, webgateway.EventSystem, "read-only")
+	for _, msg := range m.Lobby().history.Recent(10) {
+		require.NotEqual(t, KindChat, msg.Kind)
+	}
+}
+
+func TestWebSessionLeaves(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithFeatures(webFeatures()))
+	conn := newFakeWebConn(webgateway.User{Name: "wendy"})
+	done := make(chan error, 1)
+	go func() { done <- HandleWebSession(context.Background(), room, conn) }()
+	conn.find(t, webgateway.EventReady, "")
+	require.Equal(t, 1, room.ClientCount())
+
+	require.NoError(t, conn.Close())
+	require.NoError(t, <-done)
+	require.Zero(t, room.ClientCount())
+}
+
+func TestWebSessionNeedsTheFeatureFlag(t *testing.T) {
+	set := webFeatures()
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithFeatures(set))
+	require.NoError(t, set.Set(room.Name(), features.WebGateway, false))
+
+	conn := newFakeWebConn(webgateway.User{Name: "wendy"})
+	err := HandleWebSession(context.Background(), room, conn)
+	require.Equal(t, sshserver.ExitFailed, sshserver.ExitFor(err).Reason)
+	conn.find(t, webgateway.EventSystem, "web access is turned off")
+	require.Zero(t, room.ClientCount())
+
+	set.Reset(room.Name(), features.WebGateway)
+	startWebSession(t, room, conn)
+	require.Equal(t, 1, room.ClientCount())
+}
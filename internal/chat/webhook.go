@@ -0,0 +1,49 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/webhook"
+)
+
+// WithWebhooks sends the room's chat and system messages to the outbound
+// webhooks of d.
+func WithWebhooks(d *webhook.Dispatcher) RoomOption {
+	return func(r *Room) {
+		r.webhooks = d
+	}
+}
+
+func (r *Room) sendWebhooks(msg Message) {
+	if r.webhooks == nil || r.serverLog || msg.Node != "" {
+		return
+	}
+	r.webhooks.Send(webhook.Event{
+		Room: r.name,
+		Time: msg.Timestamp,
+		Kind: msg.Kind.String(),
+		From: msg.SenderName,
+		Body: msg.Body,
+	})
+}
+
+// PostWebhook injects a message received on the inbound webhook endpoint
+// into its room, one chat message per line of text. Lines a plugin suppresses
+// are skipped and reported together.
+func (m *RoomManager) PostWebhook(msg webhook.Message) error {
+	room, ok := m.Room(msg.Room)
+	if !ok {
+		return fmt.Errorf("%w: %s", webhook.ErrUnknownRoom, msg.Room)
+	}
+	var errs []error
+	for _, line := range strings.Split(msg.Text, "\n") {
+		if line = strings.TrimSpace(stripControl(line)); line != "" {
+			if _, err := room.Broadcast("", msg.User, line); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
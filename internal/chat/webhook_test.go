@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/webhook"
+)
+
+func TestRoomSendsBroadcastsToWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhook.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev webhook.Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	d := webhook.NewDispatcher("s3cret", []string{srv.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithWebhooks(d), WithName("dev"))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	room.Broadcast(alice.ID, "alice", "hello")
+	_, _, err := room.SendDirect(alice.ID, "bob", "secret")
+	require.NoError(t, err)
+	room.RemoveClient(bob.ID)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 4
+	}, 5*time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var got []string
+	for _, ev := range events {
+		require.Equal(t, "dev", ev.Room)
+		got = append(got, ev.Kind+" "+ev.From+": "+ev.Body)
+	}
+	require.Equal(t, []string{
+		"system : alice joined the chat",
+		"system : bob joined the chat",
+		"chat alice: hello",
+		"system : bob left the chat",
+	}, got, "direct messages are not sent")
+}
+
+func TestPostWebhook(t *testing.T) {
+	m := newTestManager()
+	alice := m.Lobby().AddClient("alice")
+	drainChannel(alice.Send())
+
+	require.NoError(t, m.PostWebhook(webhook.Message{Room: "lobby", User: "ci", Text: "build #12 failed\n\n3 tests\a failing"}))
+	var got []string
+	for i := 0; i < 2; i++ {
+		msg := <-alice.Send()
+		require.Equal(t, KindChat, msg.Kind)
+		require.Equal(t, "ci", msg.SenderName)
+		got = append(got, msg.Body)
+	}
+	require.Equal(t, []string{"build #12 failed", "3 tests failing"}, got)
+
+	err := m.PostWebhook(webhook.Message{Room: "ops", User: "ci", Text: "hi"})
+	require.ErrorIs(t, err, webhook.ErrUnknownRoom)
+}
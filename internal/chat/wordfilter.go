@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/features"
+	"github.com/ledzpl/schat/pkg/wordfilter"
+)
+
+var errFilteredWord = errors.New("it contains a filtered word")
+
+// WithWordFilter masks or blocks the words in f. It applies in rooms where the
+// word-filter feature flag is on.
+func WithWordFilter(f *wordfilter.Filter) RoomOption {
+	return func(r *Room) {
+		if f == nil {
+			return
+		}
+		r.wordFilter = f
+		r.plugins = append(r.plugins, MessageFilter(func(room *Room, msg Message) (Message, error) {
+			if !room.FeatureEnabled(features.WordFilter) {
+				return msg, nil
+			}
+			list := f.List()
+			if f.Action() == wordfilter.Block {
+				if list.Contains(msg.Body) {
+					return msg, errFilteredWord
+				}
+				return msg, nil
+			}
+			msg.Body = list.Mask(msg.Body)
+			return msg, nil
+		}))
+	}
+}
+
+// runWordFilter shows the word filter's state or re-reads its word file:
+// /wordfilter [reload].
+func runWordFilter(s *session, args string) error {
+	f := s.room().wordFilter
+	if f == nil {
+		return s.printSystem("the word filter is not configured")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(args)) {
+	case "":
+		state := "off"
+		if s.room().FeatureEnabled(features.WordFilter) {
+			state = "on"
+		}
+		source := "configuration"
+		if f.File() != "" {
+			source = "configuration and " + f.File()
+		}
+		return s.printSystem(
+			fmt.Sprintf("word filter: %s in #%s (toggle with /feature %s on|off)", state, s.room().Name(), features.WordFilter),
+			fmt.Sprintf("  action: %s; words: %d from %s", f.Action(), f.List().Len(), source),
+		)
+	case "reload":
+		n, err := f.Reload()
+		if err != nil {
+			s.log.Warn("chat: word filter reload failed", "err", err)
+			return s.printSystem(fmt.Sprintf("/wordfilter: %v (keeping the previous list)", err))
+		}
+		s.log.Info("chat: word filter reloaded", "words", n)
+		return s.printSystem(fmt.Sprintf("word filter reloaded; words: %d", n))
+	default:
+		return s.printSystem("usage: /wordfilter [reload]")
+	}
+}
@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/features"
+	"github.com/ledzpl/schat/pkg/wordfilter"
+)
+
+func newWordFilter(t *testing.T, action wordfilter.Action, words ...string) *wordfilter.Filter {
+	t.Helper()
+	f, err := wordfilter.New("", words, action)
+	require.NoError(t, err)
+	return f
+}
+
+func TestWordFilterMasksWhenEnabled(t *testing.T) {
+	set := features.New(map[features.Flag]bool{features.WordFilter: true})
+	room := NewRoom(WithFeatures(set), WithWordFilter(newWordFilter(t, wordfilter.Mask, "darn")))
+	alice := room.AddClient("alice")
+	bob := room.AddClient("bob")
+	drainChannel(alice.Send())
+	drainChannel(bob.Send())
+
+	msg, err := room.Broadcast(alice.ID, "alice", "darn it")
+	require.NoError(t, err)
+	require.Equal(t, "**** it", msg.Body)
+	require.Equal(t, "**** it", (<-bob.Send()).Body)
+
+	require.NoError(t, set.Set(room.Name(), features.WordFilter, false))
+	msg, err = room.Broadcast(alice.ID, "alice", "darn it")
+	require.NoError(t, err)
+	require.Equal(t, "darn it", msg.Body, "the filter is off for this room")
+}
+
+func TestWordFilterBlocks(t *testing.T) {
+	set := features.New(map[features.Flag]bool{features.WordFilter: true})
+	room := NewRoom(WithFeatures(set), WithWordFilter(newWordFilter(t, wordfilter.Block, "darn")))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "alice"})
+
+	require.NoError(t, sess.broadcastLine("well darn"))
+	require.Contains(t, out.String(), "[system] message not sent: it contains a filtered word")
+	require.NotContains(t, out.String(), "<alice> well darn")
+	_, err := room.Broadcast(sess.client.ID, "alice", "all fine")
+	require.NoError(t, err)
+}
+
+func TestWordFilterCommandReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(path, []byte("darn\n"), 0o600))
+	f, err := wordfilter.New(path, nil, wordfilter.Mask)
+	require.NoError(t, err)
+
+	set := features.New(map[features.Flag]bool{features.WordFilter: true})
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithOperators("root"), WithFeatures(set), WithWordFilter(f))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "root", Account: true})
+
+	require.NoError(t, sess.runCommand("/wordfilter"))
+	require.Contains(t, out.String(), "word filter: on in #lobby")
+	require.Contains(t, out.String(), "action: mask; words: 1 from configuration and "+path)
+
+	require.NoError(t, os.WriteFile(path, []byte("darn\nheck\n"), 0o600))
+	out.Reset()
+	require.NoError(t, sess.runCommand("/wordfilter reload"))
+	require.Contains(t, out.String(), "word filter reloaded; words: 2")
+	msg, err := room.Broadcast(sess.client.ID, "root", "heck")
+	require.NoError(t, err)
+	require.Equal(t, "****", msg.Body)
+
+	require.NoError(t, os.Remove(path))
+	out.Reset()
+	require.NoError(t, sess.runCommand("/wordfilter reload"))
+	require.Contains(t, out.String(), "keeping the previous list")
+}
+
+func TestWordFilterCommandWithoutFilter(t *testing.T) {
+	room := NewRoom(WithColorPicker(&staticColorPicker{}), WithOperators("root"))
+	sess, out := newCommandTestSession(room, ClientInfo{Username: "root", Account: true})
+
+	require.NoError(t, sess.runCommand("/wordfilter reload"))
+	require.Contains(t, out.String(), "the word filter is not configured")
+}
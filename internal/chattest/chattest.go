@@ -0,0 +1,296 @@
+// Package chattest runs chat sessions in process for end-to-end tests. Each
+// client talks to a real session over an in-memory pipe, so tests type into
+// the terminal and read what it draws without sockets, SSH handshakes, or
+// host keys:
+//
+//	srv := chattest.New(t)
+//	alice, bob := srv.JoinAs("alice"), srv.JoinAs("bob")
+//	alice.Type("hello\r")
+//	bob.ExpectMessage("alice: hello")
+package chattest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hinshun/vt10x"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/internal/chat"
+)
+
+// Terminal size clients start with unless WithSize says otherwise.
+const (
+	DefaultCols = 80
+	DefaultRows = 24
+)
+
+// Timeout bounds how long expectations wait for the session.
+var Timeout = 2 * time.Second
+
+// ClientVersion is reported for harness clients, as "SSH-2.0-..." is for SSH.
+const ClientVersion = "chattest"
+
+// Server is a room manager whose sessions run in process.
+type Server struct {
+	t      testing.TB
+	rooms  *chat.RoomManager
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New returns a server with a fresh room manager built from opts. Its
+// sessions end when the test does.
+func New(t testing.TB, opts ...chat.ManagerOption) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{t: t, rooms: chat.NewRoomManager(opts...), ctx: ctx, cancel: cancel}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+// Rooms returns the server's room manager, e.g. to create rooms or post as
+// the system.
+func (s *Server) Rooms() *chat.RoomManager { return s.rooms }
+
+// Shutdown ends every session, telling users why, as stopping the server
+// does.
+func (s *Server) Shutdown() { s.cancel() }
+
+// ClientOption configures a client joined with JoinAs.
+type ClientOption func(*Client)
+
+// WithSize sets the terminal size the client starts with.
+func WithSize(cols, rows int) ClientOption {
+	return func(c *Client) { c.cols, c.rows = cols, rows }
+}
+
+// WithInfo adjusts what the session is told about the client, e.g. its
+// authentication method or operator status.
+func WithInfo(fn func(*chat.ClientInfo)) ClientOption {
+	return func(c *Client) { fn(&c.info) }
+}
+
+// JoinAs starts a session for name in the lobby and waits until its
+// terminal is drawn. The session ends when the test does if it has not already.
+func (s *Server) JoinAs(name string, opts ...ClientOption) *Client {
+	s.t.Helper()
+	c := &Client{
+		t:    s.t,
+		cols: DefaultCols,
+		rows: DefaultRows,
+		info: chat.ClientInfo{
+			Username:      name,
+			RemoteAddr:    "pipe",
+			ClientVersion: ClientVersion,
+			SessionID:     "chattest-" + name,
+		},
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.screen = vt10x.New(vt10x.WithSize(c.cols, c.rows))
+
+	server, client := net.Pipe()
+	c.conn = client
+	go c.read()
+	go func() {
+		defer close(c.done)
+		c.err = chat.HandleTerminalSession(s.ctx, s.rooms.Lobby(), c.info, &channel{Conn: server, cols: c.cols, rows: c.rows})
+		_ = server.Close()
+	}()
+	s.t.Cleanup(func() { _ = c.Leave() })
+
+	// The session prints its first line, the welcome or why it was refused,
+	// once it has joined the room or given up.
+	require.Eventually(s.t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.lines) > 0
+	}, Timeout, time.Millisecond, "%s did not join", name)
+	return c
+}
+
+// Client is one user's terminal, attached to a session by JoinAs.
+type Client struct {
+	t      testing.TB
+	info   chat.ClientInfo
+	cols   int
+	rows   int
+	conn   net.Conn
+	screen vt10x.Terminal
+
+	mu sync.Mutex
+	// lines are the finished lines written so far, without escape
+	// sequences; partial holds the line still being written.
+	lines   []string
+	partial []byte
+	// seen counts the lines ExpectMessage has moved past.
+	seen int
+
+	done chan struct{}
+	err  error
+}
+
+// escapeSequence matches the CSI and two-byte escapes the terminal UI
+// writes.
+var escapeSequence = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|[@-Z\\-_]|[0-9=>])`)
+
+func (c *Client) read() {
+	buf := make([]byte, 4096)
+	// pending holds the start of a rune split across reads, which vt10x
+	// would drop.
+	var pending []byte
+	for {
+		n, err := c.conn.Read(buf)
+		if n > 0 {
+			pending = append(pending, buf[:n]...)
+			whole := completeRunes(pending)
+			_, _ = c.screen.Write(pending[:whole])
+			pending = append(pending[:0], pending[whole:]...)
+			c.record(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// completeRunes returns the length of p without a rune cut off at its end.
+func completeRunes(p []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(p); i++ {
+		if utf8.RuneStart(p[len(p)-i]) {
+			if !utf8.FullRune(p[len(p)-i:]) {
+				return len(p) - i
+			}
+			break
+		}
+	}
+	return len(p)
+}
+
+// record splits output into lines. The UI redraws a row by returning the
+// cursor to its start, so only the text after a line's last carriage return
+// is kept.
+func (c *Client) record(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.partial = append(c.partial, p...)
+	for {
+		i := strings.Index(string(c.partial), "\r\n")
+		if i < 0 {
+			return
+		}
+		line := escapeSequence.ReplaceAllString(string(c.partial[:i]), "")
+		if j := strings.LastIndexByte(line, '\r'); j >= 0 {
+			line = line[j+1:]
+		}
+		c.lines = append(c.lines, line)
+		c.partial = c.partial[i+2:]
+	}
+}
+
+// Type sends text as keystrokes; end it with "\r" to press Enter.
+func (c *Client) Type(text string) {
+	c.t.Helper()
+	_, err := io.WriteString(c.conn, text)
+	require.NoError(c.t, err, "typing %q", text)
+}
+
+// ExpectMessage waits for a line containing text to be printed after the
+// lines earlier expectations matched, and returns it. Expectations thus
+// follow the order messages arrive in.
+func (c *Client) ExpectMessage(text string) string {
+	c.t.Helper()
+	var found string
+	require.Eventually(c.t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i := c.seen; i < len(c.lines); i++ {
+			if strings.Contains(c.lines[i], text) {
+				found, c.seen = c.lines[i], i+1
+				return true
+			}
+		}
+		return false
+	}, Timeout, time.Millisecond, "%s never saw %q; got:\n%s", c.info.Username, text, c.Transcript())
+	return found
+}
+
+// ExpectNoMessage fails if a line containing text is printed within wait,
+// after the lines earlier expectations matched.
+func (c *Client) ExpectNoMessage(text string, wait time.Duration) {
+	c.t.Helper()
+	require.Never(c.t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, line := range c.lines[c.seen:] {
+			if strings.Contains(line, text) {
+				return true
+			}
+		}
+		return false
+	}, wait, time.Millisecond, "%s saw %q", c.info.Username, text)
+}
+
+// Transcript returns every line printed so far.
+func (c *Client) Transcript() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.Join(c.lines, "\n")
+}
+
+// Screen returns what the terminal shows now, one row per line, without
+// trailing blanks. The terminal gives every rune one column.
+func (c *Client) Screen() string {
+	lines := strings.Split(c.screen.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Wait waits for the session to end on its own, e.g. after typing /quit, and
+// returns how it ended.
+func (c *Client) Wait() error {
+	c.t.Helper()
+	select {
+	case <-c.done:
+		return c.err
+	case <-time.After(Timeout):
+		require.FailNow(c.t, "the session did not end", "%s's session is still running", c.info.Username)
+		return nil
+	}
+}
+
+// Leave hangs up and waits for the session to end, returning how it ended.
+// Hanging up is not an error.
+func (c *Client) Leave() error {
+	_ = c.conn.Close()
+	<-c.done
+	if errors.Is(c.err, io.EOF) || errors.Is(c.err, io.ErrClosedPipe) {
+		return nil
+	}
+	return c.err
+}
+
+// channel is the session's end of the pipe. It reports the client's
+// terminal size, as telnet connections do.
+type channel struct {
+	net.Conn
+	cols, rows int
+}
+
+func (ch *channel) OnResize(fn func(cols, rows int)) { fn(ch.cols, ch.rows) }
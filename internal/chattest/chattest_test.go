@@ -0,0 +1,57 @@
+package chattest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/internal/chat"
+)
+
+func TestConversation(t *testing.T) {
+	srv := New(t)
+	alice := srv.JoinAs("alice")
+	alice.ExpectMessage("Welcome to schat, alice!")
+
+	bob := srv.JoinAs("bob")
+	bob.ExpectMessage("Welcome to schat, bob!")
+	alice.ExpectMessage("[system] bob joined the chat")
+
+	bob.Type("hello alice\r")
+	alice.ExpectMessage("bob: hello alice")
+	bob.ExpectMessage("bob: hello alice")
+
+	alice.Type("/who\r")
+	alice.ExpectMessage("bob")
+	require.Contains(t, alice.Screen(), " 2 online")
+
+	require.NoError(t, bob.Leave())
+	alice.ExpectMessage("[system] bob left the chat")
+	alice.ExpectNoMessage("bob:", 50*time.Millisecond)
+}
+
+func TestExpectationsFollowArrival(t *testing.T) {
+	srv := New(t)
+	alice := srv.JoinAs("alice")
+	for _, text := range []string{"one", "two", "three"} {
+		alice.Type(text + "\r")
+	}
+	line := alice.ExpectMessage("alice: two")
+	require.Contains(t, line, "alice: two")
+	alice.ExpectMessage("alice: three")
+	alice.ExpectNoMessage("alice: one", 20*time.Millisecond)
+}
+
+func TestQuitAndShutdown(t *testing.T) {
+	srv := New(t, chat.WithRoomOptions(chat.WithGoodbye("bye now")))
+	alice := srv.JoinAs("alice")
+	alice.Type("\x04")
+	alice.ExpectMessage("bye now")
+	require.NoError(t, alice.Wait())
+
+	bob := srv.JoinAs("bob", WithSize(60, 12), WithInfo(func(info *chat.ClientInfo) { info.AuthMethod = "password" }))
+	srv.Shutdown()
+	bob.ExpectMessage("disconnected: server is shutting down")
+	require.Error(t, bob.Wait())
+}
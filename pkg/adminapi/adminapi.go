@@ -0,0 +1,289 @@
+// Package adminapi serves an HTTP API for operators and their tooling: health
+// and readiness probes for load balancers and orchestrators, JSON listings of
+// the sessions, rooms, and recent messages of a server, and endpoints that
+// kick users or post announcements. Everything but the probes requires a
+// bearer token.
+package adminapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actor is the name kicks and announcements made through the API are shown
+// and audited under.
+const Actor = "admin-api"
+
+const (
+	// maxBodySize bounds request bodies.
+	maxBodySize = 64 << 10
+	// DefaultMessageLimit is how many messages /api/messages returns when the
+	// request does not say.
+	DefaultMessageLimit = 50
+)
+
+var (
+	// ErrUnknownRoom is returned by a Backend for rooms that do not exist; the
+	// handler answers it with 404.
+	ErrUnknownRoom = errors.New("adminapi: unknown room")
+	// ErrUnknownUser is returned by a Backend asked to kick a user who is not
+	// connected; the handler answers it with 404.
+	ErrUnknownUser = errors.New("adminapi: no such user")
+)
+
+// Session is one connected chat session.
+type Session struct {
+	ID            string    `json:"id"`
+	User          string    `json:"user"`
+	Room          string    `json:"room"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	ClientVersion string    `json:"client_version,omitempty"`
+	AuthMethod    string    `json:"auth_method,omitempty"`
+	Operator      bool      `json:"operator,omitempty"`
+	JoinedAt      time.Time `json:"joined_at"`
+	LastActive    time.Time `json:"last_active"`
+}
+
+// Room is one chat room.
+type Room struct {
+	Name         string    `json:"name"`
+	Topic        string    `json:"topic,omitempty"`
+	Owner        string    `json:"owner,omitempty"`
+	Members      int       `json:"members"`
+	Archived     bool      `json:"archived,omitempty"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// Message is one message posted in a room.
+type Message struct {
+	Room string    `json:"room,omitempty"`
+	ID   uint64    `json:"id,omitempty"`
+	Time time.Time `json:"time"`
+	// Kind is the message kind, e.g. "chat", "action", or "system".
+	Kind    string `json:"kind"`
+	From    string `json:"from,omitempty"`
+	Body    string `json:"body"`
+	Edited  bool   `json:"edited,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// Backend is the server the API reports on and acts upon.
+type Backend interface {
+	Sessions() []Session
+	Rooms() []Room
+	// Messages returns up to limit of the newest messages of room, oldest
+	// first, or ErrUnknownRoom.
+	Messages(room string, limit int) ([]Message, error)
+	// Kick disconnects every session of user, telling the room why, and
+	// returns how many there were, or ErrUnknownUser.
+	Kick(actor, user, reason string) (int, error)
+	// Announce posts text to every room and returns how many there are.
+	Announce(actor, text string) int
+}
+
+// Check reports why the server cannot take traffic, or nil when it can.
+type Check func() error
+
+// Option configures Handler.
+type Option func(*api)
+
+// WithReadiness adds a check /readyz runs, reported under name.
+func WithReadiness(name string, check Check) Option {
+	return func(a *api) {
+		a.checks = append(a.checks, namedCheck{name: name, check: check})
+	}
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type api struct {
+	token   string
+	backend Backend
+	checks  []namedCheck
+}
+
+// Handler serves the API:
+//
+//	GET  /healthz                   200 while the process serves HTTP
+//	GET  /readyz                    200 once every readiness check passes, else 503
+//	GET  /api/sessions              connected sessions
+//	GET  /api/rooms                 rooms
+//	GET  /api/messages?room=&limit= recent messages of a room
+//	POST /api/kick                  {"user": "...", "reason": "..."}
+//	POST /api/announce              {"text": "..."}
+//
+// The /api endpoints need an "Authorization: Bearer <token>" header; an empty
+// token locks them.
+func Handler(token string, backend Backend, opts ...Option) http.Handler {
+	a := &api{token: token, backend: backend}
+	for _, opt := range opts {
+		opt(a)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", a.healthz)
+	mux.HandleFunc("/readyz", a.readyz)
+	mux.Handle("/api/sessions", a.authorized(http.MethodGet, a.sessions))
+	mux.Handle("/api/rooms", a.authorized(http.MethodGet, a.rooms))
+	mux.Handle("/api/messages", a.authorized(http.MethodGet, a.messages))
+	mux.Handle("/api/kick", a.authorized(http.MethodPost, a.kick))
+	mux.Handle("/api/announce", a.authorized(http.MethodPost, a.announce))
+	return mux
+}
+
+// authorized admits requests with method and the bearer token to next.
+func (a *api) authorized(method string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorize(w, r, a.token) {
+			return
+		}
+		next(w, r)
+	})
+}
+
+// RequireToken guards endpoints served outside Handler, such as the debug
+// endpoints on the metrics port: GET and HEAD requests pass to next, and any
+// other method needs the same bearer token as the /api endpoints. An empty
+// token locks them.
+func RequireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !authorize(w, r, token) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize reports whether r carries the bearer token, answering 401 when it
+// does not.
+func authorize(w http.ResponseWriter, r *http.Request, want string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || want == "" || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="schat"`)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (a *api) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (a *api) readyz(w http.ResponseWriter, _ *http.Request) {
+	status, code := "ready", http.StatusOK
+	failed := make(map[string]string)
+	for _, c := range a.checks {
+		if err := c.check(); err != nil {
+			failed[c.name] = err.Error()
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	body := map[string]any{"status": status}
+	if len(failed) > 0 {
+		body["failed"] = failed
+	}
+	writeJSON(w, code, body)
+}
+
+func (a *api) sessions(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.backend.Sessions())
+}
+
+func (a *api) rooms(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.backend.Rooms())
+}
+
+func (a *api) messages(w http.ResponseWriter, r *http.Request) {
+	room := strings.TrimPrefix(r.URL.Query().Get("room"), "#")
+	if room == "" {
+		http.Error(w, "room is required", http.StatusBadRequest)
+		return
+	}
+	limit := DefaultMessageLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("bad limit %q: want a positive number", s), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	msgs, err := a.backend.Messages(room, limit)
+	if errors.Is(err, ErrUnknownRoom) {
+		http.Error(w, fmt.Sprintf("unknown room %q", room), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, msgs)
+}
+
+func (a *api) kick(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		User   string `json:"user"`
+		Reason string `json:"reason"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.User = strings.TrimSpace(req.User); req.User == "" {
+		http.Error(w, "user is required", http.StatusBadRequest)
+		return
+	}
+	kicked, err := a.backend.Kick(Actor, req.User, strings.TrimSpace(req.Reason))
+	if errors.Is(err, ErrUnknownUser) {
+		http.Error(w, fmt.Sprintf("no such user %q", req.User), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"kicked": kicked})
+}
+
+func (a *api) announce(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Text = strings.TrimSpace(req.Text); req.Text == "" {
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"rooms": a.backend.Announce(Actor, req.Text)})
+}
+
+// readJSON decodes the request body into v, answering the request itself and
+// returning false when it cannot.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		http.Error(w, fmt.Sprintf("invalid JSON: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,175 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackend struct {
+	kicked    []string
+	announced []string
+}
+
+func (b *fakeBackend) Sessions() []Session {
+	return []Session{{ID: "s1", User: "alice", Room: "lobby"}}
+}
+
+func (b *fakeBackend) Rooms() []Room {
+	return []Room{{Name: "lobby", Members: 1}}
+}
+
+func (b *fakeBackend) Messages(room string, limit int) ([]Message, error) {
+	if room != "lobby" {
+		return nil, ErrUnknownRoom
+	}
+	msgs := []Message{{ID: 1, Kind: "chat", From: "alice", Body: "one"}, {ID: 2, Kind: "chat", From: "alice", Body: "two"}}
+	if limit < len(msgs) {
+		msgs = msgs[len(msgs)-limit:]
+	}
+	return msgs, nil
+}
+
+func (b *fakeBackend) Kick(actor, user, reason string) (int, error) {
+	if user != "alice" {
+		return 0, ErrUnknownUser
+	}
+	b.kicked = append(b.kicked, actor+" "+user+" "+reason)
+	return 1, nil
+}
+
+func (b *fakeBackend) Announce(actor, text string) int {
+	b.announced = append(b.announced, actor+" "+text)
+	return 3
+}
+
+func TestHandler(t *testing.T) {
+	backend := &fakeBackend{}
+	handler := Handler("s3cret", backend)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		want   int
+		resp   string
+	}{
+		{name: "health", method: http.MethodGet, path: "/healthz", want: http.StatusOK, resp: `{"status":"ok"}`},
+		{name: "ready without checks", method: http.MethodGet, path: "/readyz", want: http.StatusOK, resp: `{"status":"ready"}`},
+		{name: "no token", method: http.MethodGet, path: "/api/sessions", want: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, path: "/api/sessions", token: "wrong", want: http.StatusUnauthorized},
+		{name: "sessions", method: http.MethodGet, path: "/api/sessions", token: "s3cret", want: http.StatusOK, resp: `[{"id":"s1","user":"alice","room":"lobby","joined_at":"0001-01-01T00:00:00Z","last_active":"0001-01-01T00:00:00Z"}]`},
+		{name: "rooms", method: http.MethodGet, path: "/api/rooms", token: "s3cret", want: http.StatusOK, resp: `[{"name":"lobby","members":1,"last_activity":"0001-01-01T00:00:00Z"}]`},
+		{name: "wrong method", method: http.MethodPost, path: "/api/rooms", token: "s3cret", want: http.StatusMethodNotAllowed},
+		{name: "messages", method: http.MethodGet, path: "/api/messages?room=%23lobby&limit=1", token: "s3cret", want: http.StatusOK, resp: `[{"id":2,"time":"0001-01-01T00:00:00Z","kind":"chat","from":"alice","body":"two"}]`},
+		{name: "messages without room", method: http.MethodGet, path: "/api/messages", token: "s3cret", want: http.StatusBadRequest},
+		{name: "messages bad limit", method: http.MethodGet, path: "/api/messages?room=lobby&limit=0", token: "s3cret", want: http.StatusBadRequest},
+		{name: "messages unknown room", method: http.MethodGet, path: "/api/messages?room=ops", token: "s3cret", want: http.StatusNotFound},
+		{name: "kick", method: http.MethodPost, path: "/api/kick", body: `{"user":"alice","reason":" spam "}`, token: "s3cret", want: http.StatusOK, resp: `{"kicked":1}`},
+		{name: "kick unknown user", method: http.MethodPost, path: "/api/kick", body: `{"user":"bob"}`, token: "s3cret", want: http.StatusNotFound},
+		{name: "kick without user", method: http.MethodPost, path: "/api/kick", body: `{}`, token: "s3cret", want: http.StatusBadRequest},
+		{name: "kick bad json", method: http.MethodPost, path: "/api/kick", body: `{`, token: "s3cret", want: http.StatusBadRequest},
+		{name: "announce", method: http.MethodPost, path: "/api/announce", body: `{"text":"maintenance at 10"}`, token: "s3cret", want: http.StatusOK, resp: `{"rooms":3}`},
+		{name: "announce without text", method: http.MethodPost, path: "/api/announce", body: `{"text":" "}`, token: "s3cret", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+			if tt.resp != "" {
+				require.JSONEq(t, tt.resp, rec.Body.String())
+			}
+		})
+	}
+
+	require.Equal(t, []string{"admin-api alice spam"}, backend.kicked)
+	require.Equal(t, []string{"admin-api maintenance at 10"}, backend.announced)
+}
+
+func TestHandlerWithoutTokenLocksAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	Handler("", &fakeBackend{}).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestRequireToken(t *testing.T) {
+	var served []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = append(served, r.Method)
+	})
+	for _, token := range []string{"s3cret", ""} {
+		served = nil
+		handler := RequireToken(token, next)
+		for _, tt := range []struct {
+			method, auth string
+			want         int
+		}{
+			{method: http.MethodGet, want: http.StatusOK},
+			{method: http.MethodPost, want: http.StatusUnauthorized},
+			{method: http.MethodDelete, auth: "Bearer wrong", want: http.StatusUnauthorized},
+			{method: http.MethodPost, auth: "Bearer ", want: http.StatusUnauthorized},
+			{method: http.MethodDelete, auth: "Bearer s3cret", want: http.StatusOK},
+		} {
+			req := httptest.NewRequest(tt.method, "/debug/features", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			want := tt.want
+			if token == "" && tt.method != http.MethodGet {
+				want = http.StatusUnauthorized
+			}
+			require.Equal(t, want, rec.Code, "token %q: %s %s", token, tt.method, tt.auth)
+		}
+		if token == "" {
+			require.Equal(t, []string{http.MethodGet}, served, "an empty token locks changes")
+		} else {
+			require.Equal(t, []string{http.MethodGet, http.MethodDelete}, served)
+		}
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	var serving bool
+	handler := Handler("s3cret", &fakeBackend{},
+		WithReadiness("ssh", func() error {
+			if !serving {
+				return errors.New("not accepting connections")
+			}
+			return nil
+		}),
+		WithReadiness("store", func() error { return nil }),
+	)
+
+	get := func() (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+
+	code, body := get()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, map[string]any{"status": "unavailable", "failed": map[string]any{"ssh": "not accepting connections"}}, body)
+
+	serving = true
+	code, body = get()
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]any{"status": "ready"}, body)
+}
@@ -0,0 +1,155 @@
+// Package audit keeps an append-only trail of moderation and administrative
+// actions, such as kicks, bans, topic changes, and config reloads. Entries are
+// written to a file as JSON lines and never rewritten; the latest are also
+// kept in memory so operators can review them without reading the file.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action names what was done.
+type Action string
+
+// Recorded actions.
+const (
+	Kick     Action = "kick"
+	Ban      Action = "ban"
+	Unban    Action = "unban"
+	Mute     Action = "mute"
+	Warn     Action = "warn"
+	Pardon   Action = "pardon"
+	Topic    Action = "topic"
+	Feature  Action = "feature"
+	Transfer Action = "transfer"
+	Delete   Action = "delete-room"
+	Reload   Action = "reload"
+)
+
+// Entry is one recorded action.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action Action    `json:"action"`
+	Target string    `json:"target,omitempty"`
+	Room   string    `json:"room,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Involves reports whether name is the entry's actor or target.
+func (e Entry) Involves(name string) bool {
+	return strings.EqualFold(e.Actor, name) || strings.EqualFold(e.Target, name)
+}
+
+// keep is how many entries a Log holds in memory.
+const keep = 500
+
+// Log appends entries to a file and remembers the latest. It is safe for
+// concurrent use.
+type Log struct {
+	mu     sync.Mutex
+	file   *os.File
+	recent []Entry
+}
+
+// Open returns a log appending to path, loading its latest entries. Lines
+// that do not parse, such as one torn by a crash, are left alone and skipped.
+// An empty path keeps entries in memory only.
+func Open(path string) (*Log, error) {
+	l := &Log{}
+	if path == "" {
+		return l, nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err == nil {
+			l.remember(e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("audit: read %s: %w", path, err)
+	}
+	// Start on a fresh line if the last write was cut short.
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			if _, err := f.Write([]byte{'\n'}); err != nil {
+				_ = f.Close()
+				return nil, fmt.Errorf("audit: %w", err)
+			}
+		}
+	}
+	l.file = f
+	return l, nil
+}
+
+// Record appends e, stamping it with the current time if it has none.
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remember(e)
+	if l.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+func (l *Log) remember(e Entry) {
+	l.recent = append(l.recent, e)
+	if len(l.recent) > keep {
+		l.recent = append(l.recent[:0], l.recent[len(l.recent)-keep:]...)
+	}
+}
+
+// Recent returns up to n of the latest entries for which match is true, or
+// all of them when match is nil, oldest first.
+func (l *Log) Recent(n int, match func(Entry) bool) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []Entry
+	for i := len(l.recent) - 1; i >= 0 && len(out) < n; i-- {
+		if match == nil || match(l.recent[i]) {
+			out = append(out, l.recent[i])
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// Close closes the file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogAppendsAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	require.NoError(t, err)
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, l.Record(Entry{Time: at, Actor: "root", Action: Kick, Target: "mallory", Room: "lobby", Reason: "spam"}))
+	require.NoError(t, l.Record(Entry{Time: at.Add(time.Second), Actor: "alice", Action: Topic, Room: "dev", Reason: "release day"}))
+	require.NoError(t, l.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(data), "\n"))
+	require.Contains(t, string(data), `"action":"kick","target":"mallory"`)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	l, err = Open(path)
+	require.NoError(t, err)
+	defer l.Close()
+	require.NoError(t, l.Record(Entry{Actor: "config", Action: Reload}))
+	recent := l.Recent(10, nil)
+	require.Len(t, recent, 3)
+	require.Equal(t, "mallory", recent[0].Target)
+	require.Equal(t, Reload, recent[2].Action)
+	require.False(t, recent[2].Time.IsZero(), "entries are stamped")
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 3, strings.Count(string(data), "\n"), "reopening appends")
+}
+
+func TestRecentFilters(t *testing.T) {
+	l, err := Open("")
+	require.NoError(t, err)
+	for i := 0; i < keep+10; i++ {
+		require.NoError(t, l.Record(Entry{Actor: "root", Action: Kick, Target: "bob"}))
+	}
+	require.NoError(t, l.Record(Entry{Actor: "automod", Action: Mute, Target: "Mallory"}))
+	require.NoError(t, l.Record(Entry{Actor: "mallory", Action: Topic}))
+
+	require.Len(t, l.Recent(keep*2, nil), keep)
+	got := l.Recent(5, func(e Entry) bool { return e.Involves("mallory") })
+	require.Len(t, got, 2)
+	require.Equal(t, Mute, got[0].Action)
+	require.Len(t, l.Recent(3, nil), 3)
+}
+
+func TestOpenSkipsTornLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(path, []byte("{\"actor\":\"root\",\"action\":\"kick\"}\n{\"actor\":\"ro"), 0o600))
+	l, err := Open(path)
+	require.NoError(t, err)
+	require.Len(t, l.Recent(10, nil), 1)
+	require.NoError(t, l.Record(Entry{Actor: "root", Action: Ban}))
+	require.NoError(t, l.Close())
+
+	l, err = Open(path)
+	require.NoError(t, err)
+	defer l.Close()
+	require.Len(t, l.Recent(10, nil), 2, "the new entry starts on its own line")
+}
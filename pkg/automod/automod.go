@@ -0,0 +1,347 @@
+// Package automod spots chat abuse, such as flooding a room with the same
+// line, shouting, link spam, or rejoining over and over, and decides how to
+// answer it. Each offence is a strike against the user; strikes walk up a
+// ladder of actions, typically warn, mute, kick, then a temporary ban, and
+// expire after a while without new ones. The package only keeps score; the
+// caller carries the actions out.
+package automod
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Rule names a kind of abuse.
+type Rule string
+
+// Rules the engine checks.
+const (
+	Repeat Rule = "repeat"
+	Caps   Rule = "caps"
+	Links  Rule = "links"
+	Flood  Rule = "flood"
+)
+
+var ruleReasons = map[Rule]string{
+	Repeat: "repeating the same message",
+	Caps:   "excessive capitals",
+	Links:  "posting too many links",
+	Flood:  "joining and leaving too often",
+}
+
+// Reason describes the rule for the user who broke it.
+func (r Rule) Reason() string {
+	return ruleReasons[r]
+}
+
+// Action is what a strike costs the user.
+type Action string
+
+// Actions in order of severity.
+const (
+	Warn Action = "warn"
+	Mute Action = "mute"
+	Kick Action = "kick"
+	Ban  Action = "ban"
+)
+
+// ParseActions reads a strike ladder such as ["warn", "mute", "kick", "ban"];
+// the nth strike takes the nth action, and strikes past the end take the last.
+func ParseActions(names []string) ([]Action, error) {
+	if len(names) == 0 {
+		return nil, errNoActions
+	}
+	actions := make([]Action, 0, len(names))
+	for _, name := range names {
+		a := Action(strings.ToLower(strings.TrimSpace(name)))
+		switch a {
+		case Warn, Mute, Kick, Ban:
+		default:
+			return nil, fmt.Errorf("automod: unknown action %q (want warn, mute, kick, or ban)", name)
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// Config sets the thresholds of the rules. A zero count or ratio turns its
+// rule off.
+type Config struct {
+	// Repeats identical messages within RepeatWindow break the repeat rule.
+	Repeats      int
+	RepeatWindow time.Duration
+	// A message with at least CapsMinLetters letters, of which more than
+	// CapsRatio are capitals, breaks the caps rule.
+	CapsRatio      float64
+	CapsMinLetters int
+	// More than LinkCount links within LinkWindow break the links rule.
+	LinkCount  int
+	LinkWindow time.Duration
+	// Joins joins and leaves within JoinWindow break the flood rule.
+	Joins      int
+	JoinWindow time.Duration
+	// Actions is the strike ladder.
+	Actions []Action
+	// MuteFor and BanFor are how long mutes and bans last.
+	MuteFor time.Duration
+	BanFor  time.Duration
+	// StrikeWindow is how long a strike counts against the user.
+	StrikeWindow time.Duration
+}
+
+// Verdict is the engine's answer to an offence.
+type Verdict struct {
+	Rule   Rule
+	Action Action
+	// Strike is how many strikes the user now has.
+	Strike int
+	// Until is when a mute or ban ends.
+	Until time.Time
+}
+
+// Entry is one offence in the engine's audit trail.
+type Entry struct {
+	Time time.Time
+	User string
+	Room string
+	Verdict
+}
+
+var errNoActions = errors.New("automod: no actions")
+
+// auditSize is how many entries Recent keeps.
+const auditSize = 50
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// Engine keeps score of every user's recent activity and strikes. It is safe
+// for concurrent use.
+type Engine struct {
+	cfg Config
+
+	mu     sync.Mutex
+	users  map[string]*record
+	banned map[string]time.Time
+	audit  []Entry
+}
+
+// record is what the engine remembers about one user.
+type record struct {
+	// messages are the recent normalized bodies and when they were sent.
+	messages []stamped
+	links    []time.Time
+	presence []time.Time
+	strikes  []time.Time
+	muted    time.Time
+}
+
+type stamped struct {
+	at   time.Time
+	body string
+}
+
+// New returns an engine enforcing cfg.
+func New(cfg Config) (*Engine, error) {
+	if len(cfg.Actions) == 0 {
+		return nil, errNoActions
+	}
+	if cfg.CapsRatio < 0 || cfg.CapsRatio > 1 {
+		return nil, fmt.Errorf("automod: caps ratio %v is not between 0 and 1", cfg.CapsRatio)
+	}
+	if cfg.Repeats < 0 || cfg.CapsMinLetters < 0 || cfg.LinkCount < 0 || cfg.Joins < 0 {
+		return nil, errors.New("automod: thresholds must not be negative")
+	}
+	for _, d := range []time.Duration{cfg.RepeatWindow, cfg.LinkWindow, cfg.JoinWindow, cfg.MuteFor, cfg.BanFor, cfg.StrikeWindow} {
+		if d < 0 {
+			return nil, errors.New("automod: durations must not be negative")
+		}
+	}
+	return &Engine{cfg: cfg, users: make(map[string]*record), banned: make(map[string]time.Time)}, nil
+}
+
+func (e *Engine) record(user string) *record {
+	key := strings.ToLower(user)
+	rec, ok := e.users[key]
+	if !ok {
+		rec = &record{}
+		e.users[key] = rec
+	}
+	return rec
+}
+
+// Message checks a message user sent to room at the given time, reporting a
+// verdict if it breaks a rule.
+func (e *Engine) Message(user, room, body string, at time.Time) (Verdict, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rec := e.record(user)
+
+	if e.cfg.Repeats > 0 {
+		norm := strings.ToLower(strings.Join(strings.Fields(body), " "))
+		rec.messages = append(since(rec.messages, at.Add(-e.cfg.RepeatWindow)), stamped{at: at, body: norm})
+		same := 0
+		for _, m := range rec.messages {
+			if m.body == norm {
+				same++
+			}
+		}
+		if same >= e.cfg.Repeats {
+			return e.strike(user, room, rec, Repeat, at), true
+		}
+	}
+	if e.cfg.CapsRatio > 0 && shouting(body, e.cfg.CapsRatio, e.cfg.CapsMinLetters) {
+		return e.strike(user, room, rec, Caps, at), true
+	}
+	if e.cfg.LinkCount > 0 {
+		if n := len(linkPattern.FindAllStringIndex(body, -1)); n > 0 {
+			rec.links = within(rec.links, at.Add(-e.cfg.LinkWindow))
+			for i := 0; i < n; i++ {
+				rec.links = append(rec.links, at)
+			}
+			if len(rec.links) > e.cfg.LinkCount {
+				return e.strike(user, room, rec, Links, at), true
+			}
+		}
+	}
+	return Verdict{}, false
+}
+
+// Presence records that user joined or left room at the given time, reporting
+// a verdict if they are flooding.
+func (e *Engine) Presence(user, room string, at time.Time) (Verdict, bool) {
+	if e.cfg.Joins <= 0 {
+		return Verdict{}, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rec := e.record(user)
+	rec.presence = append(within(rec.presence, at.Add(-e.cfg.JoinWindow)), at)
+	if len(rec.presence) < e.cfg.Joins {
+		return Verdict{}, false
+	}
+	// Start over so the same burst is not punished twice.
+	rec.presence = rec.presence[:0]
+	return e.strike(user, room, rec, Flood, at), true
+}
+
+// strike adds a strike against user and applies the action it earns.
+func (e *Engine) strike(user, room string, rec *record, rule Rule, at time.Time) Verdict {
+	rec.strikes = append(within(rec.strikes, at.Add(-e.cfg.StrikeWindow)), at)
+	n := len(rec.strikes)
+	v := Verdict{Rule: rule, Strike: n, Action: e.cfg.Actions[min(n, len(e.cfg.Actions))-1]}
+	switch v.Action {
+	case Mute:
+		v.Until = at.Add(e.cfg.MuteFor)
+		rec.muted = v.Until
+	case Ban:
+		v.Until = at.Add(e.cfg.BanFor)
+		e.banned[strings.ToLower(user)] = v.Until
+	}
+	e.audit = append(e.audit, Entry{Time: at, User: user, Room: room, Verdict: v})
+	if len(e.audit) > auditSize {
+		e.audit = e.audit[len(e.audit)-auditSize:]
+	}
+	return v
+}
+
+// Muted reports whether user is muted at the given time, and until when.
+func (e *Engine) Muted(user string, at time.Time) (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rec, ok := e.users[strings.ToLower(user)]
+	if !ok || !at.Before(rec.muted) {
+		return time.Time{}, false
+	}
+	return rec.muted, true
+}
+
+// Ban bars key, a username or a network address, until the given time.
+func (e *Engine) Ban(key string, until time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.banned[strings.ToLower(key)] = until
+}
+
+// Banned reports whether any of keys is banned at the given time, and until
+// when.
+func (e *Engine) Banned(at time.Time, keys ...string) (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var until time.Time
+	for _, key := range keys {
+		key = strings.ToLower(key)
+		end, ok := e.banned[key]
+		if !ok {
+			continue
+		}
+		if !at.Before(end) {
+			delete(e.banned, key)
+			continue
+		}
+		if end.After(until) {
+			until = end
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// Pardon clears user's strikes, mute, and ban, reporting whether there was
+// anything to clear. Addresses they were banned from stay banned.
+func (e *Engine) Pardon(user string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := strings.ToLower(user)
+	_, banned := e.banned[key]
+	delete(e.banned, key)
+	rec, ok := e.users[key]
+	if ok {
+		delete(e.users, key)
+	}
+	return banned || ok && (len(rec.strikes) > 0 || !rec.muted.IsZero())
+}
+
+// Recent returns the latest offences, oldest first.
+func (e *Engine) Recent() []Entry {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Entry(nil), e.audit...)
+}
+
+// shouting reports whether more than ratio of body's letters are capitals,
+// counting only bodies with at least minLetters cased letters.
+func shouting(body string, ratio float64, minLetters int) bool {
+	letters, upper := 0, 0
+	for _, r := range body {
+		if !unicode.IsLetter(r) || unicode.IsUpper(r) == unicode.IsLower(r) {
+			continue
+		}
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	return letters > 0 && letters >= minLetters && float64(upper) > ratio*float64(letters)
+}
+
+// within drops the times before cutoff.
+func within(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return append(times[:0], times[i:]...)
+}
+
+// since drops the messages sent before cutoff.
+func since(messages []stamped, cutoff time.Time) []stamped {
+	i := 0
+	for i < len(messages) && messages[i].at.Before(cutoff) {
+		i++
+	}
+	return append(messages[:0], messages[i:]...)
+}
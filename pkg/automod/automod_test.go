@@ -0,0 +1,154 @@
+package automod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newEngine(t *testing.T, cfg Config) *Engine {
+	t.Helper()
+	if cfg.Actions == nil {
+		cfg.Actions = []Action{Warn, Mute, Kick, Ban}
+	}
+	if cfg.StrikeWindow == 0 {
+		cfg.StrikeWindow = time.Hour
+	}
+	e, err := New(cfg)
+	require.NoError(t, err)
+	return e
+}
+
+func TestParseActions(t *testing.T) {
+	actions, err := ParseActions([]string{"warn", " MUTE ", "ban"})
+	require.NoError(t, err)
+	require.Equal(t, []Action{Warn, Mute, Ban}, actions)
+
+	_, err = ParseActions([]string{"warn", "shame"})
+	require.ErrorContains(t, err, `unknown action "shame"`)
+	_, err = ParseActions(nil)
+	require.Error(t, err)
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	_, err := New(Config{})
+	require.Error(t, err)
+	_, err = New(Config{Actions: []Action{Warn}, CapsRatio: 1.5})
+	require.ErrorContains(t, err, "caps ratio")
+	_, err = New(Config{Actions: []Action{Warn}, MuteFor: -time.Second})
+	require.Error(t, err)
+}
+
+func TestRepeatRule(t *testing.T) {
+	e := newEngine(t, Config{Repeats: 3, RepeatWindow: 30 * time.Second})
+	_, hit := e.Message("alice", "lobby", "buy now", start)
+	require.False(t, hit)
+	_, hit = e.Message("alice", "lobby", "something else", start.Add(time.Second))
+	require.False(t, hit)
+	_, hit = e.Message("alice", "lobby", "Buy  now", start.Add(2*time.Second))
+	require.False(t, hit)
+	v, hit := e.Message("alice", "lobby", "buy now", start.Add(3*time.Second))
+	require.True(t, hit, "case and spacing are ignored")
+	require.Equal(t, Verdict{Rule: Repeat, Action: Warn, Strike: 1}, v)
+
+	_, hit = e.Message("bob", "lobby", "buy now", start.Add(3*time.Second))
+	require.False(t, hit, "users are scored apart")
+
+	e = newEngine(t, Config{Repeats: 2, RepeatWindow: 30 * time.Second})
+	_, hit = e.Message("alice", "lobby", "hi", start)
+	require.False(t, hit)
+	_, hit = e.Message("alice", "lobby", "hi", start.Add(time.Minute))
+	require.False(t, hit, "the first one left the window")
+}
+
+func TestCapsRule(t *testing.T) {
+	e := newEngine(t, Config{CapsRatio: 0.7, CapsMinLetters: 8})
+	_, hit := e.Message("alice", "lobby", "OK LOL", start)
+	require.False(t, hit, "short messages are not shouting")
+	_, hit = e.Message("alice", "lobby", "I read the RFC and the API docs", start)
+	require.False(t, hit)
+	v, hit := e.Message("alice", "lobby", "WHY IS NOBODY ANSWERING ME", start)
+	require.True(t, hit)
+	require.Equal(t, Caps, v.Rule)
+	_, hit = e.Message("alice", "lobby", "안녕하세요 여러분 반갑습니다", start)
+	require.False(t, hit, "uncased scripts never shout")
+}
+
+func TestLinksRule(t *testing.T) {
+	e := newEngine(t, Config{LinkCount: 2, LinkWindow: time.Minute})
+	_, hit := e.Message("alice", "lobby", "see https://a.example and www.b.example", start)
+	require.False(t, hit)
+	v, hit := e.Message("alice", "lobby", "also http://c.example", start.Add(time.Second))
+	require.True(t, hit)
+	require.Equal(t, Links, v.Rule)
+
+	_, hit = e.Message("bob", "lobby", "https://a.example", start)
+	require.False(t, hit)
+	_, hit = e.Message("bob", "lobby", "https://b.example https://c.example", start.Add(2*time.Minute))
+	require.False(t, hit, "old links left the window")
+}
+
+func TestFloodRule(t *testing.T) {
+	e := newEngine(t, Config{Joins: 3, JoinWindow: time.Minute})
+	for i := 0; i < 2; i++ {
+		_, hit := e.Presence("alice", "lobby", start.Add(time.Duration(i)*time.Second))
+		require.False(t, hit)
+	}
+	v, hit := e.Presence("alice", "lobby", start.Add(2*time.Second))
+	require.True(t, hit)
+	require.Equal(t, Flood, v.Rule)
+	_, hit = e.Presence("alice", "lobby", start.Add(3*time.Second))
+	require.False(t, hit, "the burst was already punished")
+}
+
+func TestStrikeLadder(t *testing.T) {
+	e := newEngine(t, Config{CapsRatio: 0.5, MuteFor: 5 * time.Minute, BanFor: time.Hour})
+	shout := func(at time.Time) Verdict {
+		v, hit := e.Message("alice", "lobby", "STOP IT", at)
+		require.True(t, hit)
+		return v
+	}
+
+	require.Equal(t, Warn, shout(start).Action)
+	v := shout(start.Add(time.Second))
+	require.Equal(t, Mute, v.Action)
+	require.Equal(t, start.Add(time.Second+5*time.Minute), v.Until)
+	until, muted := e.Muted("ALICE", start.Add(time.Minute))
+	require.True(t, muted)
+	require.Equal(t, v.Until, until)
+	_, muted = e.Muted("alice", v.Until)
+	require.False(t, muted)
+
+	require.Equal(t, Kick, shout(start.Add(2*time.Second)).Action)
+	v = shout(start.Add(3 * time.Second))
+	require.Equal(t, Ban, v.Action)
+	require.Equal(t, 4, v.Strike)
+	_, banned := e.Banned(start.Add(time.Minute), "someone", "alice")
+	require.True(t, banned)
+	require.Equal(t, Ban, shout(start.Add(4*time.Second)).Action, "the last action repeats")
+
+	require.Equal(t, Warn, shout(start.Add(3*time.Hour)).Action, "strikes expire")
+
+	require.Len(t, e.Recent(), 6)
+	require.Equal(t, "alice", e.Recent()[0].User)
+}
+
+func TestBanAndPardon(t *testing.T) {
+	e := newEngine(t, Config{CapsRatio: 0.5})
+	e.Ban("192.0.2.7", start.Add(time.Hour))
+	until, banned := e.Banned(start, "mallory", "192.0.2.7")
+	require.True(t, banned)
+	require.Equal(t, start.Add(time.Hour), until)
+	_, banned = e.Banned(start.Add(time.Hour), "192.0.2.7")
+	require.False(t, banned, "bans end")
+
+	require.False(t, e.Pardon("alice"))
+	_, hit := e.Message("alice", "lobby", "STOP IT", start)
+	require.True(t, hit)
+	require.True(t, e.Pardon("Alice"))
+	v, _ := e.Message("alice", "lobby", "STOP IT", start)
+	require.Equal(t, 1, v.Strike, "strikes were cleared")
+}
@@ -0,0 +1,400 @@
+// Package backup writes a server's data directory to a single archive and
+// restores it. An archive is a gzipped tar of the directory, optionally
+// encrypted with a passphrase, ending in a manifest of every file's size,
+// mode, and SHA-256, which Restore and Verify check before trusting it.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestName is the archive entry holding the Manifest. It comes last.
+const ManifestName = "MANIFEST.json"
+
+// manifestVersion is the archive layout version.
+const manifestVersion = 1
+
+// Manifest describes the files in a backup.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Files   []File    `json:"files"`
+}
+
+// File is one file in a backup, at a slash-separated path relative to the
+// data directory.
+type File struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256"`
+}
+
+// Size returns the total size of the files.
+func (m *Manifest) Size() int64 {
+	var total int64
+	for _, f := range m.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// Option customises Create, Restore, and Verify.
+type Option func(*options)
+
+type options struct {
+	passphrase []byte
+	snapshots  map[string]func(dst string) error
+	clock      func() time.Time
+}
+
+// WithPassphrase encrypts a new backup with AES-256-GCM under a key derived
+// from passphrase, or decrypts one being read. An empty passphrase does
+// nothing.
+func WithPassphrase(passphrase []byte) Option {
+	return func(o *options) {
+		o.passphrase = passphrase
+	}
+}
+
+// WithSnapshot copies the file at rel, relative to the data directory, by
+// calling snapshot with a temporary path to write it to, instead of reading
+// it directly. Use it for files a running server may be writing, such as a
+// SQLite database; its -wal, -shm, and -journal files are then left out.
+func WithSnapshot(rel string, snapshot func(dst string) error) Option {
+	return func(o *options) {
+		if o.snapshots == nil {
+			o.snapshots = make(map[string]func(string) error)
+		}
+		o.snapshots[filepath.ToSlash(rel)] = snapshot
+	}
+}
+
+// WithClock sets the clock that dates new backups.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.clock = now
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{clock: time.Now}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Create writes a backup of dir to w and returns its manifest.
+func Create(w io.Writer, dir string, opts ...Option) (*Manifest, error) {
+	o := newOptions(opts)
+	paths, err := listFiles(dir, o.snapshots)
+	if err != nil {
+		return nil, err
+	}
+
+	out := w
+	var enc *encryptWriter
+	if len(o.passphrase) > 0 {
+		if enc, err = newEncryptWriter(w, o.passphrase); err != nil {
+			return nil, err
+		}
+		out = enc
+	}
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	manifest := &Manifest{Version: manifestVersion, Created: o.clock().UTC()}
+	for _, rel := range paths {
+		f, err := addFile(tw, dir, rel, o.snapshots[rel])
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, f)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("backup: encode manifest: %w", err)
+	}
+	hdr := &tar.Header{Name: ManifestName, Mode: 0o600, Size: int64(len(data)), ModTime: manifest.Created, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, fmt.Errorf("backup: write: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, fmt.Errorf("backup: write: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("backup: write: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("backup: write: %w", err)
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return nil, fmt.Errorf("backup: write: %w", err)
+		}
+	}
+	return manifest, nil
+}
+
+// listFiles returns the regular files under dir as sorted slash-separated
+// relative paths, leaving out the side files of snapshotted databases.
+func listFiles(dir string, snapshots map[string]func(string) error) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for db := range snapshots {
+			for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+				if rel == db+suffix {
+					return nil
+				}
+			}
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("backup: read %s: %w", dir, err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// addFile writes one file to tw, hashing it on the way.
+func addFile(tw *tar.Writer, dir, rel string, snapshot func(string) error) (File, error) {
+	src := filepath.Join(dir, filepath.FromSlash(rel))
+	info, err := os.Stat(src)
+	if err != nil {
+		return File{}, fmt.Errorf("backup: %w", err)
+	}
+	if snapshot != nil {
+		tmp, err := os.MkdirTemp("", "schat-snapshot-*")
+		if err != nil {
+			return File{}, fmt.Errorf("backup: snapshot %s: %w", rel, err)
+		}
+		defer os.RemoveAll(tmp)
+		src = filepath.Join(tmp, path.Base(rel))
+		if err := snapshot(src); err != nil {
+			return File{}, fmt.Errorf("backup: snapshot %s: %w", rel, err)
+		}
+		mode := info.Mode()
+		if info, err = os.Stat(src); err != nil {
+			return File{}, fmt.Errorf("backup: snapshot %s: %w", rel, err)
+		}
+		info = modeInfo{info, mode}
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return File{}, fmt.Errorf("backup: %w", err)
+	}
+	defer f.Close()
+	hdr := &tar.Header{
+		Name:     rel,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return File{}, fmt.Errorf("backup: write %s: %w", rel, err)
+	}
+	// Files the server appends to, such as room archives, are cut at the size
+	// they had when listed.
+	h := sha256.New()
+	if _, err := io.CopyN(tw, io.TeeReader(f, h), info.Size()); err != nil {
+		return File{}, fmt.Errorf("backup: write %s: %w", rel, err)
+	}
+	return File{Path: rel, Size: info.Size(), Mode: info.Mode().Perm(), SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// modeInfo keeps a snapshot's size and time but the original file's mode.
+type modeInfo struct {
+	fs.FileInfo
+	mode fs.FileMode
+}
+
+func (m modeInfo) Mode() fs.FileMode { return m.mode }
+
+// Verify reads a whole backup and checks every file against its manifest.
+func Verify(r io.Reader, opts ...Option) (*Manifest, error) {
+	return read(r, newOptions(opts), func(string, fs.FileMode, io.Reader) error { return nil })
+}
+
+// Restore extracts a backup into dir, which must be missing or empty. The
+// files are written to a temporary directory next to dir and moved into
+// place only once they match the manifest, so a damaged backup leaves dir
+// untouched.
+func Restore(r io.Reader, dir string, opts ...Option) (*Manifest, error) {
+	entries, err := os.ReadDir(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("backup: restore: %w", err)
+	case len(entries) > 0:
+		return nil, fmt.Errorf("backup: restore: %s is not empty; move it aside first", dir)
+	}
+	parent := filepath.Dir(filepath.Clean(dir))
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, fmt.Errorf("backup: restore: %w", err)
+	}
+	tmp, err := os.MkdirTemp(parent, ".schat-restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("backup: restore: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	manifest, err := read(r, newOptions(opts), func(rel string, mode fs.FileMode, content io.Reader) error {
+		dst := filepath.Join(tmp, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, content); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("backup: restore: %w", err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, fmt.Errorf("backup: restore: %w", err)
+	}
+	return manifest, nil
+}
+
+// read walks the files of a backup, handing each to extract, and checks them
+// against the manifest at the end.
+func read(r io.Reader, o *options, extract func(rel string, mode fs.FileMode, content io.Reader) error) (*Manifest, error) {
+	plain, err := openStream(r, o.passphrase)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(plain)
+	if err != nil {
+		return nil, fmt.Errorf("backup: not a schat backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	seen := make(map[string]File)
+	var manifest *Manifest
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, readError(err)
+		}
+		if manifest != nil {
+			return nil, fmt.Errorf("backup: %s is followed by %s", ManifestName, hdr.Name)
+		}
+		if hdr.Name == ManifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("backup: bad manifest: %w", err)
+			}
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg || !safePath(hdr.Name) {
+			return nil, fmt.Errorf("backup: unexpected entry %q", hdr.Name)
+		}
+		if _, dup := seen[hdr.Name]; dup {
+			return nil, fmt.Errorf("backup: %s appears twice", hdr.Name)
+		}
+		h := sha256.New()
+		counter := &countingReader{r: io.TeeReader(tr, h)}
+		mode := fs.FileMode(hdr.Mode).Perm()
+		if err := extract(hdr.Name, mode, counter); err != nil {
+			return nil, fmt.Errorf("backup: restore %s: %w", hdr.Name, readError(err))
+		}
+		// Drain what extract did not read, so the hash covers the whole file.
+		if _, err := io.Copy(io.Discard, counter); err != nil {
+			return nil, readError(err)
+		}
+		seen[hdr.Name] = File{Path: hdr.Name, Size: counter.n, Mode: mode, SHA256: hex.EncodeToString(h.Sum(nil))}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("backup: %s is missing; the backup is incomplete", ManifestName)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("backup: unsupported backup version %d", manifest.Version)
+	}
+	for _, want := range manifest.Files {
+		got, ok := seen[want.Path]
+		if !ok {
+			return nil, fmt.Errorf("backup: %s is listed in the manifest but missing", want.Path)
+		}
+		if got != want {
+			return nil, fmt.Errorf("backup: %s does not match the manifest", want.Path)
+		}
+		delete(seen, want.Path)
+	}
+	if len(seen) > 0 {
+		extra := make([]string, 0, len(seen))
+		for rel := range seen {
+			extra = append(extra, rel)
+		}
+		sort.Strings(extra)
+		return nil, fmt.Errorf("backup: %s is not listed in the manifest", strings.Join(extra, ", "))
+	}
+	return manifest, nil
+}
+
+// readError keeps decryption errors recognisable through the gzip and tar
+// readers.
+func readError(err error) error {
+	if errors.Is(err, ErrPassphrase) || errors.Is(err, errTruncated) {
+		return err
+	}
+	return fmt.Errorf("backup: corrupted backup: %w", err)
+}
+
+// safePath reports whether name stays inside the directory it is extracted
+// to.
+func safePath(name string) bool {
+	return name != "" && name == path.Clean(name) && !path.IsAbs(name) && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
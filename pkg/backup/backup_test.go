@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeDataDir fills a data directory like a server's.
+func writeDataDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ssh_host_key"), []byte("private key"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "schat.db"), []byte("live database"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "schat.db-wal"), []byte("wal"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "archive"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "archive", "dev.jsonl"), bytes.Repeat([]byte("history\n"), 20000), 0o600))
+	return dir
+}
+
+func snapshotDB(dst string) error {
+	return os.WriteFile(dst, []byte("database snapshot"), 0o600)
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	for name, passphrase := range map[string][]byte{"plain": nil, "encrypted": []byte("correct horse")} {
+		t.Run(name, func(t *testing.T) {
+			src := writeDataDir(t)
+			var buf bytes.Buffer
+			manifest, err := Create(&buf, src, WithPassphrase(passphrase), WithSnapshot("schat.db", snapshotDB), WithClock(func() time.Time { return created }))
+			require.NoError(t, err)
+			require.Equal(t, created, manifest.Created)
+			paths := make([]string, 0, len(manifest.Files))
+			for _, f := range manifest.Files {
+				paths = append(paths, f.Path)
+			}
+			require.Equal(t, []string{"archive/dev.jsonl", "schat.db", "ssh_host_key"}, paths, "the WAL is covered by the snapshot")
+			require.Equal(t, passphrase != nil, bytes.HasPrefix(buf.Bytes(), []byte(encryptedMagic)))
+
+			verified, err := Verify(bytes.NewReader(buf.Bytes()), WithPassphrase(passphrase))
+			require.NoError(t, err)
+			require.Equal(t, manifest, verified)
+
+			dst := filepath.Join(t.TempDir(), "restored")
+			_, err = Restore(bytes.NewReader(buf.Bytes()), dst, WithPassphrase(passphrase))
+			require.NoError(t, err)
+			data, err := os.ReadFile(filepath.Join(dst, "schat.db"))
+			require.NoError(t, err)
+			require.Equal(t, "database snapshot", string(data))
+			info, err := os.Stat(filepath.Join(dst, "schat.db"))
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o644), info.Mode().Perm(), "the original mode is kept")
+			data, err = os.ReadFile(filepath.Join(dst, "archive", "dev.jsonl"))
+			require.NoError(t, err)
+			require.Len(t, data, 8*20000)
+
+			_, err = Restore(bytes.NewReader(buf.Bytes()), dst, WithPassphrase(passphrase))
+			require.ErrorContains(t, err, "is not empty; move it aside first")
+		})
+	}
+}
+
+func TestEncryptedBackupRejectsTampering(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Create(&buf, writeDataDir(t), WithPassphrase([]byte("correct horse")))
+	require.NoError(t, err)
+	backup := buf.Bytes()
+
+	_, err = Verify(bytes.NewReader(backup))
+	require.ErrorIs(t, err, ErrPassphraseRequired)
+	_, err = Verify(bytes.NewReader(backup), WithPassphrase([]byte("wrong")))
+	require.ErrorIs(t, err, ErrPassphrase)
+
+	flipped := bytes.Clone(backup)
+	flipped[len(flipped)/2] ^= 1
+	_, err = Verify(bytes.NewReader(flipped), WithPassphrase([]byte("correct horse")))
+	require.ErrorIs(t, err, ErrPassphrase)
+
+	_, err = Verify(bytes.NewReader(backup[:len(backup)-100]), WithPassphrase([]byte("correct horse")))
+	require.Error(t, err)
+
+	dst := filepath.Join(t.TempDir(), "restored")
+	_, err = Restore(bytes.NewReader(flipped), dst, WithPassphrase([]byte("correct horse")))
+	require.Error(t, err)
+	require.NoDirExists(t, dst, "a damaged backup leaves nothing behind")
+}
+
+func TestPlainBackupRejectsTruncation(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Create(&buf, writeDataDir(t))
+	require.NoError(t, err)
+
+	_, err = Verify(bytes.NewReader(buf.Bytes()[:buf.Len()/2]))
+	require.Error(t, err)
+	_, err = Verify(bytes.NewReader([]byte("not a backup")))
+	require.ErrorContains(t, err, "not a schat backup")
+}
+
+func TestSafePath(t *testing.T) {
+	for _, ok := range []string{"schat.db", "archive/dev.jsonl"} {
+		require.True(t, safePath(ok), ok)
+	}
+	for _, bad := range []string{"", "../etc/passwd", "/etc/passwd", "a/../../b", "./a", ".."} {
+		require.False(t, safePath(bad), bad)
+	}
+}
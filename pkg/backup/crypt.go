@@ -0,0 +1,204 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedMagic starts every encrypted backup; plain backups start with the
+// gzip header instead.
+const encryptedMagic = "schat-backup-enc1\n"
+
+// chunkSize is how much plaintext each sealed chunk holds.
+const chunkSize = 64 << 10
+
+const saltSize = 16
+
+var (
+	// ErrPassphrase is returned when an encrypted backup is read without a
+	// passphrase or with the wrong one, or was tampered with.
+	ErrPassphrase = errors.New("backup: wrong passphrase or corrupted backup")
+	// ErrPassphraseRequired is returned when an encrypted backup is read
+	// without a passphrase.
+	ErrPassphraseRequired = errors.New("backup: the backup is encrypted; a passphrase is required")
+	errTruncated          = errors.New("backup: encrypted backup is truncated")
+)
+
+// deriveKey stretches passphrase into an AES-256-GCM cipher.
+func deriveKey(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("backup: derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("backup: derive key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce numbers chunks, so they cannot be reordered. The key is fresh
+// for every backup, so the counter never repeats under one key.
+func chunkNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// chunkAAD marks the last chunk, so a backup cut short at a chunk boundary is
+// still detected.
+func chunkAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptWriter seals everything written to it in numbered chunks.
+type encryptWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	seq  uint64
+	buf  []byte
+}
+
+func newEncryptWriter(w io.Writer, passphrase []byte) (*encryptWriter, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("backup: encrypt: %w", err)
+	}
+	aead, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, encryptedMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		if len(e.buf) == cap(e.buf) {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close seals what is left as the final chunk. It does not close the
+// underlying writer.
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.aead, e.seq), e.buf, chunkAAD(final))
+	e.seq++
+	e.buf = e.buf[:0]
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader opens the chunks written by encryptWriter.
+type decryptReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	seq   uint64
+	buf   []byte
+	final bool
+}
+
+func newDecryptReader(r io.Reader, passphrase []byte) (*decryptReader, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, errTruncated
+	}
+	aead, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.final {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		return errTruncated
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > chunkSize+uint32(d.aead.Overhead()) {
+		return ErrPassphrase
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return errTruncated
+	}
+	nonce := chunkNonce(d.aead, d.seq)
+	plain, err := d.aead.Open(nil, nonce, sealed, chunkAAD(false))
+	if err != nil {
+		if plain, err = d.aead.Open(nil, nonce, sealed, chunkAAD(true)); err != nil {
+			return ErrPassphrase
+		}
+		d.final = true
+		if extra, _ := d.r.Read(make([]byte, 1)); extra > 0 {
+			return errors.New("backup: data after the end of the encrypted backup")
+		}
+	}
+	d.seq++
+	d.buf = plain
+	return nil
+}
+
+// openStream returns the plaintext of a backup, decrypting it if it starts
+// with encryptedMagic.
+func openStream(r io.Reader, passphrase []byte) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(encryptedMagic))
+	if err != nil || !bytes.Equal(head, []byte(encryptedMagic)) {
+		return br, nil
+	}
+	if len(passphrase) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+	_, _ = br.Discard(len(encryptedMagic))
+	return newDecryptReader(br, passphrase)
+}
@@ -0,0 +1,287 @@
+// Package bans keeps the users, public keys, and networks that may not
+// connect, persisted to a JSON file so bans survive restarts.
+package bans
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind is what a ban matches.
+type Kind string
+
+// Ban kinds.
+const (
+	// User matches a username, ignoring case.
+	User Kind = "user"
+	// Key matches a public key by its SHA256 fingerprint.
+	Key Kind = "key"
+	// Net matches an IP address or a CIDR range.
+	Net Kind = "net"
+)
+
+// keyPrefix starts the fingerprints ssh.FingerprintSHA256 returns.
+const keyPrefix = "SHA256:"
+
+// ErrNotFound is returned when lifting a ban that does not exist.
+var ErrNotFound = errors.New("bans: no such ban")
+
+// Entry is one ban.
+type Entry struct {
+	Kind   Kind   `json:"kind"`
+	Value  string `json:"value"`
+	By     string `json:"by,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Created is when the ban was added; a zero Until never expires.
+	Created time.Time `json:"created"`
+	Until   time.Time `json:"until"`
+}
+
+// Expired reports whether the ban has run out at the given time.
+func (e Entry) Expired(at time.Time) bool {
+	return !e.Until.IsZero() && !at.Before(e.Until)
+}
+
+// String renders the target, e.g. "net 203.0.113.0/24".
+func (e Entry) String() string {
+	return string(e.Kind) + " " + e.Value
+}
+
+// ParseTarget classifies a ban target: a key fingerprint starting with
+// "SHA256:", an IP address or CIDR range, or otherwise a username. Addresses
+// and ranges are returned in canonical form.
+func ParseTarget(target string) (Kind, string, error) {
+	target = strings.TrimPrefix(strings.TrimSpace(target), "@")
+	switch {
+	case target == "":
+		return "", "", errors.New("bans: empty target")
+	case strings.HasPrefix(target, keyPrefix):
+		if len(target) == len(keyPrefix) {
+			return "", "", fmt.Errorf("bans: empty key fingerprint %q", target)
+		}
+		return Key, target, nil
+	case strings.Contains(target, "/"):
+		prefix, err := netip.ParsePrefix(target)
+		if err != nil {
+			return "", "", fmt.Errorf("bans: invalid CIDR range %q", target)
+		}
+		return Net, prefix.Masked().String(), nil
+	}
+	if addr, err := netip.ParseAddr(target); err == nil {
+		return Net, addr.Unmap().String(), nil
+	}
+	if strings.ContainsAny(target, " \t:") {
+		return "", "", fmt.Errorf("bans: invalid username %q", target)
+	}
+	return User, target, nil
+}
+
+// List holds the bans in memory and, when opened with a path, saves them after
+// every change.
+type List struct {
+	path string
+
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+// Open loads the ban file at path, starting empty when it does not exist. An
+// empty path keeps bans in memory only.
+func Open(path string) (*List, error) {
+	l := &List{path: path, entries: make(map[string]Entry)}
+	if path == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bans: read %q: %w", path, err)
+	}
+	var list []Entry
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("bans: parse %q: %w", path, err)
+	}
+	for _, e := range list {
+		kind, value, err := ParseTarget(e.Value)
+		if err != nil || kind != e.Kind {
+			return nil, fmt.Errorf("bans: %q: invalid %s ban %q", path, e.Kind, e.Value)
+		}
+		e.Value = value
+		l.entries[entryKey(kind, value)] = e
+	}
+	return l, nil
+}
+
+func entryKey(kind Kind, value string) string {
+	if kind == User {
+		value = strings.ToLower(value)
+	}
+	return string(kind) + " " + value
+}
+
+// Add bans the target of e, replacing an earlier ban of the same target.
+// e.Kind may be left empty to classify e.Value with ParseTarget. It returns
+// the ban as stored.
+func (l *List) Add(e Entry, at time.Time) (Entry, error) {
+	kind, value, err := ParseTarget(e.Value)
+	if err != nil {
+		return Entry{}, err
+	}
+	if e.Kind != "" && e.Kind != kind {
+		return Entry{}, fmt.Errorf("bans: %q is not a %s", e.Value, e.Kind)
+	}
+	e.Kind, e.Value = kind, value
+	if e.Created.IsZero() {
+		e.Created = at.UTC()
+	}
+	if e.Expired(at) {
+		return Entry{}, errors.New("bans: the ban has already expired")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := entryKey(kind, value)
+	prev, existed := l.entries[key]
+	l.entries[key] = e
+	if err := l.saveLocked(at); err != nil {
+		if existed {
+			l.entries[key] = prev
+		} else {
+			delete(l.entries, key)
+		}
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Remove lifts the ban of target, returning it.
+func (l *List) Remove(target string, at time.Time) (Entry, error) {
+	kind, value, err := ParseTarget(target)
+	if err != nil {
+		return Entry{}, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := entryKey(kind, value)
+	e, ok := l.entries[key]
+	if !ok || e.Expired(at) {
+		return Entry{}, fmt.Errorf("%w on %s %s", ErrNotFound, kind, value)
+	}
+	delete(l.entries, key)
+	if err := l.saveLocked(at); err != nil {
+		l.entries[key] = e
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Entries returns the bans in force at the given time, oldest first.
+func (l *List) Entries(at time.Time) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	list := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		if !e.Expired(at) {
+			list = append(list, e)
+		}
+	}
+	sortEntries(list)
+	return list
+}
+
+// Check returns the ban in force at the given time that matches any of user,
+// the key fingerprint, or addr. Empty or invalid arguments match nothing.
+func (l *List) Check(at time.Time, user, fingerprint string, addr netip.Addr) (Entry, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if user != "" {
+		if e, ok := l.entries[entryKey(User, user)]; ok && !e.Expired(at) {
+			return e, true
+		}
+	}
+	if fingerprint != "" {
+		if e, ok := l.entries[entryKey(Key, fingerprint)]; ok && !e.Expired(at) {
+			return e, true
+		}
+	}
+	if !addr.IsValid() {
+		return Entry{}, false
+	}
+	addr = addr.Unmap()
+	for _, e := range l.entries {
+		if e.Kind != Net || e.Expired(at) {
+			continue
+		}
+		if matchesNet(e.Value, addr) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+func matchesNet(value string, addr netip.Addr) bool {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Contains(addr)
+	}
+	banned, err := netip.ParseAddr(value)
+	return err == nil && banned == addr
+}
+
+func sortEntries(list []Entry) {
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Created.Equal(list[j].Created) {
+			return list[i].Created.Before(list[j].Created)
+		}
+		return list[i].String() < list[j].String()
+	})
+}
+
+// saveLocked writes the bans in force to the file, dropping expired ones.
+func (l *List) saveLocked(at time.Time) error {
+	for key, e := range l.entries {
+		if e.Expired(at) {
+			delete(l.entries, key)
+		}
+	}
+	if l.path == "" {
+		return nil
+	}
+
+	list := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		list = append(list, e)
+	}
+	sortEntries(list)
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("bans: encode: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".bans-*")
+	if err != nil {
+		return fmt.Errorf("bans: save %q: %w", l.path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("bans: save %q: %w", l.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("bans: save %q: %w", l.path, err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("bans: save %q: %w", l.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package bans
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget(t *testing.T) {
+	cases := []struct {
+		in    string
+		kind  Kind
+		value string
+		err   bool
+	}{
+		{in: "@mallory", kind: User, value: "mallory"},
+		{in: "SHA256:abc", kind: Key, value: "SHA256:abc"},
+		{in: "203.0.113.7", kind: Net, value: "203.0.113.7"},
+		{in: "203.0.113.7/24", kind: Net, value: "203.0.113.0/24"},
+		{in: "2001:db8::1/32", kind: Net, value: "2001:db8::/32"},
+		{in: "::ffff:10.0.0.1", kind: Net, value: "10.0.0.1"},
+		{in: "10.0.0.0/33", err: true},
+		{in: "SHA256:", err: true},
+		{in: "", err: true},
+		{in: "a:b", err: true},
+	}
+	for _, tc := range cases {
+		kind, value, err := ParseTarget(tc.in)
+		if tc.err {
+			require.Error(t, err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.kind, kind, tc.in)
+		require.Equal(t, tc.value, value, tc.in)
+	}
+}
+
+func TestListCheck(t *testing.T) {
+	l, err := Open("")
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	_, err = l.Add(Entry{Value: "Mallory", By: "root", Reason: "spam"}, now)
+	require.NoError(t, err)
+	_, err = l.Add(Entry{Value: "SHA256:abc"}, now)
+	require.NoError(t, err)
+	_, err = l.Add(Entry{Value: "198.51.100.0/24", Until: now.Add(time.Hour)}, now)
+	require.NoError(t, err)
+	_, err = l.Add(Entry{Kind: Key, Value: "alice"}, now)
+	require.ErrorContains(t, err, `"alice" is not a key`)
+
+	e, ok := l.Check(now, "mallory", "", netip.Addr{})
+	require.True(t, ok, "usernames ignore case")
+	require.Equal(t, "spam", e.Reason)
+	_, ok = l.Check(now, "alice", "SHA256:abc", netip.Addr{})
+	require.True(t, ok)
+	e, ok = l.Check(now, "alice", "", netip.MustParseAddr("::ffff:198.51.100.9"))
+	require.True(t, ok)
+	require.Equal(t, "net 198.51.100.0/24", e.String())
+	_, ok = l.Check(now.Add(time.Hour), "alice", "", netip.MustParseAddr("198.51.100.9"))
+	require.False(t, ok, "temporary bans expire")
+	_, ok = l.Check(now, "alice", "SHA256:other", netip.MustParseAddr("192.0.2.1"))
+	require.False(t, ok)
+
+	require.Len(t, l.Entries(now), 3)
+	require.Len(t, l.Entries(now.Add(2*time.Hour)), 2)
+
+	removed, err := l.Remove("@MALLORY", now)
+	require.NoError(t, err)
+	require.Equal(t, "Mallory", removed.Value, "the ban keeps the name as given")
+	_, err = l.Remove("mallory", now)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestListPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	l, err := Open(path)
+	require.NoError(t, err)
+	_, err = l.Add(Entry{Value: "10.0.0.0/8", By: "root"}, now)
+	require.NoError(t, err)
+	_, err = l.Add(Entry{Value: "bob", Until: now.Add(time.Minute)}, now)
+	require.NoError(t, err)
+
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	require.Equal(t, l.Entries(now), reopened.Entries(now))
+	_, ok := reopened.Check(now, "", "", netip.MustParseAddr("10.1.2.3"))
+	require.True(t, ok)
+
+	// Saving drops bans that have run out.
+	_, err = reopened.Add(Entry{Value: "carol"}, now.Add(time.Hour))
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), `"bob"`)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"kind":"net","value":"nonsense"}]`), 0o600))
+	_, err = Open(path)
+	require.ErrorContains(t, err, `invalid net ban "nonsense"`)
+}
@@ -0,0 +1,441 @@
+// Package botclient lets Go programs take part in schat as headless clients.
+// A bot connects over SSH like any user, but to the schat-bot subsystem,
+// which exchanges JSON Lines instead of drawing a terminal screen:
+//
+//	bot, err := botclient.Connect(ctx, "chat.example.com:2222", "karma",
+//		botclient.WithPublicKey(signer),
+//		botclient.WithHostKeyCallback(callback))
+//	if err != nil {
+//		return err
+//	}
+//	defer bot.Close()
+//	bot.OnMessage(func(msg botclient.Message) {
+//		if strings.HasSuffix(msg.Text, "++") {
+//			_ = bot.Send(ctx, "karma noted")
+//		}
+//	})
+//	return bot.Join(ctx, "dev")
+package botclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrClosed is returned for requests made after the connection ended.
+var ErrClosed = errors.New("botclient: connection closed")
+
+// maxEventBytes bounds one event line from the server.
+const maxEventBytes = 1 << 20
+
+// Message is a message the bot received.
+type Message struct {
+	// ID identifies chat and action messages in their room. KindEdit,
+	// KindDelete, and KindReaction messages carry the ID of the message they
+	// change.
+	ID   uint64
+	Time time.Time
+	Room string
+	From string
+	// Kind is KindChat, KindAction, KindSystem, KindDirect, KindEdit,
+	// KindDelete, or KindReaction.
+	Kind string
+	Text string
+	// ReplyTo is the ID of the message a reply answers, zero otherwise.
+	ReplyTo uint64
+}
+
+// Notice is a server notice the bot may act on, such as an upcoming upgrade.
+type Notice struct {
+	Time time.Time
+	// Code is NoticeUpgrade, NoticeProtocolOutdated, or NoticeProtocolNewer.
+	Code string
+	Text string
+	// Version is the release an upgrade installs, if known.
+	Version string
+	// Deadline is when an upgrade expects the server to go away; zero when
+	// unknown.
+	Deadline time.Time
+}
+
+// Client is a connected bot. Its methods are safe for concurrent use.
+type Client struct {
+	conn    *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu       sync.Mutex
+	user     string
+	room     string
+	nextID   int64
+	pending  map[int64]chan Event
+	handlers []func(Message)
+	notices  []func(Notice)
+	// queue holds message and notice events waiting for the handlers.
+	queue  []Event
+	queued *sync.Cond
+	err    error
+
+	readyc chan struct{}
+	done   chan struct{}
+}
+
+// Option customises Connect.
+type Option func(*options)
+
+type options struct {
+	auth            []ssh.AuthMethod
+	hostKeyCallback ssh.HostKeyCallback
+	dial            func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// WithPublicKey authenticates with signer.
+func WithPublicKey(signer ssh.Signer) Option {
+	return func(o *options) {
+		o.auth = append(o.auth, ssh.PublicKeys(signer))
+	}
+}
+
+// WithPassword authenticates with a password.
+func WithPassword(password string) Option {
+	return func(o *options) {
+		o.auth = append(o.auth, ssh.Password(password))
+	}
+}
+
+// WithHostKeyCallback verifies the server's host key. It is required; use
+// ssh.FixedHostKey or golang.org/x/crypto/ssh/knownhosts.
+func WithHostKeyCallback(callback ssh.HostKeyCallback) Option {
+	return func(o *options) {
+		o.hostKeyCallback = callback
+	}
+}
+
+// WithDialer replaces the TCP dialer, e.g. to connect through a proxy.
+func WithDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(o *options) {
+		if dial != nil {
+			o.dial = dial
+		}
+	}
+}
+
+// Connect signs in to the server at addr as user and opens the bot
+// subsystem. The bot starts in the server's lobby.
+func Connect(ctx context.Context, addr, user string, opts ...Option) (*Client, error) {
+	o := options{dial: (&net.Dialer{}).DialContext}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	if o.hostKeyCallback == nil {
+		return nil, errors.New("botclient: no host key callback; use WithHostKeyCallback")
+	}
+
+	nc, err := o.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("botclient: %w", err)
+	}
+	// The SSH handshake has no context; bound it by ctx through the deadline.
+	stop := context.AfterFunc(ctx, func() { nc.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+	conn, chans, reqs, err := ssh.NewClientConn(nc, addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            o.auth,
+		HostKeyCallback: o.hostKeyCallback,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("botclient: %w", contextErr(ctx, err))
+	}
+	c, err := start(ssh.NewClient(conn, chans, reqs))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	select {
+	case <-c.readyc:
+		return c, nil
+	case <-c.done:
+		return nil, c.Err()
+	case <-ctx.Done():
+		c.Close()
+		return nil, fmt.Errorf("botclient: %w", ctx.Err())
+	}
+}
+
+// start opens the subsystem on conn and starts reading events.
+func start(conn *ssh.Client) (*Client, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("botclient: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("botclient: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("botclient: %w", err)
+	}
+	// Best effort: servers that do not accept the variable assume version 1.
+	_ = session.Setenv(ProtocolEnv, strconv.Itoa(Version))
+	if err := session.RequestSubsystem(Subsystem); err != nil {
+		return nil, fmt.Errorf("botclient: request %s subsystem: %w", Subsystem, err)
+	}
+
+	c := &Client{
+		conn:    conn,
+		session: session,
+		stdin:   stdin,
+		enc:     json.NewEncoder(stdin),
+		pending: make(map[int64]chan Event),
+		readyc:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	c.queued = sync.NewCond(&c.mu)
+	go c.readLoop(stdout)
+	go c.dispatchLoop()
+	return c, nil
+}
+
+// User returns the username the server assigned to the bot.
+func (c *Client) User() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user
+}
+
+// Room returns the room the bot is in.
+func (c *Client) Room() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.room
+}
+
+// OnMessage registers fn for every message the bot receives from now on; the
+// bot's own messages are not echoed back. Handlers run one message at a time
+// on a goroutine of their own, so they may call Send and the other methods.
+func (c *Client) OnMessage(fn func(Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers = append(c.handlers, fn)
+}
+
+// OnNotice registers fn for every server notice from now on, e.g. to
+// reconnect elsewhere before an upgrade. Notices are dispatched in order with
+// messages, on the same goroutine.
+func (c *Client) OnNotice(fn func(Notice)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notices = append(c.notices, fn)
+}
+
+// Send says text in the bot's room.
+func (c *Client) Send(ctx context.Context, text string) error {
+	_, err := c.request(ctx, Request{Type: RequestSend, Text: text})
+	return err
+}
+
+// Action sends a /me emote such as "waves".
+func (c *Client) Action(ctx context.Context, text string) error {
+	_, err := c.request(ctx, Request{Type: RequestAction, Text: text})
+	return err
+}
+
+// Direct sends a private message to a user in the bot's room.
+func (c *Client) Direct(ctx context.Context, to, text string) error {
+	_, err := c.request(ctx, Request{Type: RequestDirect, To: to, Text: text})
+	return err
+}
+
+// Join moves the bot to room, creating it if needed.
+func (c *Client) Join(ctx context.Context, room string) error {
+	ev, err := c.request(ctx, Request{Type: RequestJoin, Room: room})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.room = ev.Room
+	c.mu.Unlock()
+	return nil
+}
+
+// request sends req and waits for the server's answer.
+func (c *Client) request(ctx context.Context, req Request) (Event, error) {
+	reply := make(chan Event, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return Event{}, c.err
+	}
+	c.nextID++
+	req.ID = c.nextID
+	c.pending[req.ID] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, req.ID)
+		c.mu.Unlock()
+	}()
+
+	c.writeMu.Lock()
+	err := c.enc.Encode(req)
+	c.writeMu.Unlock()
+	if err != nil {
+		return Event{}, fmt.Errorf("botclient: %w", err)
+	}
+
+	select {
+	case ev := <-reply:
+		if ev.Type == EventError {
+			return ev, fmt.Errorf("botclient: %s: %s", req.Type, ev.Error)
+		}
+		return ev, nil
+	case <-c.done:
+		return Event{}, c.Err()
+	case <-ctx.Done():
+		return Event{}, fmt.Errorf("botclient: %w", ctx.Err())
+	}
+}
+
+// readLoop routes events until the server closes the stream.
+func (c *Client) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxEventBytes)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			c.fail(fmt.Errorf("bad event: %w", err))
+			return
+		}
+		if ev.Type == EventError && ev.ID == 0 {
+			// The server refused the bot, e.g. for a ban, and is hanging up.
+			c.fail(errors.New(ev.Error))
+			return
+		}
+		c.handle(ev)
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = ErrClosed
+	}
+	c.fail(err)
+}
+
+func (c *Client) handle(ev Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch ev.Type {
+	case EventReady:
+		if c.user == "" {
+			c.user, c.room = ev.User, ev.Room
+			close(c.readyc)
+		}
+	case EventOK, EventError:
+		if reply, ok := c.pending[ev.ID]; ok {
+			reply <- ev
+		}
+	case EventMessage:
+		if ev.Kind != KindDirect {
+			// The server may move the bot, e.g. when its room is deleted.
+			c.room = ev.Room
+		}
+		c.queue = append(c.queue, ev)
+		c.queued.Signal()
+	case EventNotice:
+		c.queue = append(c.queue, ev)
+		c.queued.Signal()
+	}
+}
+
+// dispatchLoop hands queued messages and notices to the handlers, so a
+// handler waiting on a reply never blocks the reader that delivers it.
+func (c *Client) dispatchLoop() {
+	for {
+		c.mu.Lock()
+		for len(c.queue) == 0 && c.err == nil {
+			c.queued.Wait()
+		}
+		if len(c.queue) == 0 {
+			c.mu.Unlock()
+			return
+		}
+		ev := c.queue[0]
+		c.queue = c.queue[1:]
+		handlers, notices := c.handlers, c.notices
+		c.mu.Unlock()
+
+		if ev.Type == EventNotice {
+			notice := Notice{Time: ev.Time, Code: ev.Code, Text: ev.Body, Version: ev.ServerVersion}
+			if ev.Deadline != nil {
+				notice.Deadline = *ev.Deadline
+			}
+			for _, fn := range notices {
+				fn(notice)
+			}
+			continue
+		}
+		msg := Message{ID: ev.Message, Time: ev.Time, Room: ev.Room, From: ev.From, Kind: ev.Kind, Text: ev.Body, ReplyTo: ev.ReplyTo}
+		for _, fn := range handlers {
+			fn(msg)
+		}
+	}
+}
+
+// fail records why the connection ended and releases everyone waiting.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if !errors.Is(err, ErrClosed) {
+		err = fmt.Errorf("%w: %v", ErrClosed, err)
+	}
+	c.err = err
+	close(c.done)
+	c.queued.Broadcast()
+	c.conn.Close()
+}
+
+// Done is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err reports why the connection ended, or nil while it is open.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close disconnects the bot.
+func (c *Client) Close() error {
+	c.stdin.Close()
+	c.fail(ErrClosed)
+	return nil
+}
+
+func contextErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
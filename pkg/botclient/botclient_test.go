@@ -0,0 +1,192 @@
+package botclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeServer accepts one bot and runs serve on its subsystem channel with the
+// environment the bot set.
+func fakeServer(t *testing.T, serve func(ch ssh.Channel, env map[string]string)) (string, ssh.PublicKey) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn, chans, reqs, err := ssh.NewServerConn(nc, cfg)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go ssh.DiscardRequests(reqs)
+		for newChannel := range chans {
+			ch, requests, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			env := make(map[string]string)
+			req := <-requests
+			for req.Type == "env" {
+				var kv struct{ Name, Value string }
+				if ssh.Unmarshal(req.Payload, &kv) == nil {
+					env[kv.Name] = kv.Value
+				}
+				req.Reply(true, nil)
+				req = <-requests
+			}
+			var sub struct{ Name string }
+			ok := ssh.Unmarshal(req.Payload, &sub) == nil && sub.Name == Subsystem
+			req.Reply(ok, nil)
+			go ssh.DiscardRequests(requests)
+			if ok {
+				serve(ch, env)
+			}
+			ch.Close()
+		}
+	}()
+	return ln.Addr().String(), signer.PublicKey()
+}
+
+func connect(t *testing.T, addr string, key ssh.PublicKey) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Connect(ctx, addr, "bot", WithHostKeyCallback(ssh.FixedHostKey(key)))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestHandlersMayCallBack(t *testing.T) {
+	addr, key := fakeServer(t, func(ch ssh.Channel, _ map[string]string) {
+		enc := json.NewEncoder(ch)
+		enc.Encode(Event{V: Version, Type: EventReady, User: "bot_2", Room: "lobby"})
+		scanner := bufio.NewScanner(ch)
+		for scanner.Scan() {
+			var req Request
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &req))
+			if req.Text == "fail" {
+				enc.Encode(Event{V: Version, Type: EventError, ID: req.ID, Error: "nope"})
+				continue
+			}
+			enc.Encode(Event{V: Version, Type: EventOK, ID: req.ID, Room: "lobby"})
+			body := req.Type + " " + req.Text
+			if req.Text == "hello" {
+				body = "ping"
+			}
+			enc.Encode(Event{V: Version, Type: EventMessage, Room: "lobby", From: "alice", Kind: KindChat, Body: body})
+		}
+	})
+	c := connect(t, addr, key)
+	require.Equal(t, "bot_2", c.User())
+
+	got := make(chan Message, 4)
+	c.OnMessage(func(msg Message) {
+		if msg.Text == "ping" {
+			// Waiting for the reply here must not stall the reader.
+			require.NoError(t, c.Send(context.Background(), "pong"))
+		}
+		got <- msg
+	})
+	require.NoError(t, c.Send(context.Background(), "hello"))
+	var texts []string
+	for len(texts) < 2 {
+		select {
+		case msg := <-got:
+			texts = append(texts, msg.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got only %q", texts)
+		}
+	}
+	require.Equal(t, []string{"ping", "send pong"}, texts)
+
+	require.EqualError(t, c.Action(context.Background(), "fail"), "botclient: action: nope")
+}
+
+func TestConnectRequiresHostKeyCheck(t *testing.T) {
+	_, err := Connect(context.Background(), "127.0.0.1:1", "bot")
+	require.ErrorContains(t, err, "WithHostKeyCallback")
+}
+
+func TestConnectionLoss(t *testing.T) {
+	addr, key := fakeServer(t, func(ch ssh.Channel, _ map[string]string) {
+		json.NewEncoder(ch).Encode(Event{V: Version, Type: EventReady, User: "bot", Room: "lobby"})
+		ch.Write([]byte("not json\n"))
+	})
+	c := connect(t, addr, key)
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed")
+	}
+	require.ErrorIs(t, c.Err(), ErrClosed)
+	require.ErrorContains(t, c.Err(), "bad event")
+	require.ErrorIs(t, c.Join(context.Background(), "dev"), ErrClosed)
+}
+
+func TestConnectRefused(t *testing.T) {
+	addr, key := fakeServer(t, func(ch ssh.Channel, _ map[string]string) {
+		json.NewEncoder(ch).Encode(Event{V: Version, Type: EventError, Error: "you are banned"})
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := Connect(ctx, addr, "bot", WithHostKeyCallback(ssh.FixedHostKey(key)))
+	require.ErrorIs(t, err, ErrClosed)
+	require.ErrorContains(t, err, "you are banned")
+}
+
+func TestNoticesAndProtocolVersion(t *testing.T) {
+	deadline := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	declared := make(chan string, 1)
+	addr, key := fakeServer(t, func(ch ssh.Channel, env map[string]string) {
+		declared <- env[ProtocolEnv]
+		enc := json.NewEncoder(ch)
+		enc.Encode(Event{V: Version, Type: EventReady, User: "bot", Room: "lobby"})
+		scanner := bufio.NewScanner(ch)
+		scanner.Scan()
+		var req Request
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &req))
+		enc.Encode(Event{V: Version, Type: EventOK, ID: req.ID, Room: "lobby"})
+		enc.Encode(Event{V: Version, Type: EventMessage, Room: "lobby", Kind: KindSystem, Body: "first"})
+		enc.Encode(Event{V: Version, Type: EventNotice, Code: NoticeUpgrade, Body: "upgrading", ServerVersion: "v1.3.0", Deadline: &deadline})
+		scanner.Scan()
+	})
+	c := connect(t, addr, key)
+	require.Equal(t, "1", <-declared)
+
+	var order []string
+	done := make(chan Notice, 1)
+	c.OnMessage(func(msg Message) { order = append(order, msg.Text) })
+	c.OnNotice(func(n Notice) {
+		order = append(order, n.Text)
+		done <- n
+	})
+	require.NoError(t, c.Send(context.Background(), "hi"))
+	select {
+	case n := <-done:
+		require.Equal(t, Notice{Code: NoticeUpgrade, Text: "upgrading", Version: "v1.3.0", Deadline: deadline}, n)
+		require.Equal(t, []string{"first", "upgrading"}, order)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notice")
+	}
+}
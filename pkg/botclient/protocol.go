@@ -0,0 +1,105 @@
+package botclient
+
+import "time"
+
+// Subsystem is the SSH subsystem bots connect to, e.g.
+// "ssh -s host schat-bot". It speaks JSON Lines in both directions instead
+// of drawing a terminal screen; docs/bots.md documents the protocol.
+const Subsystem = "schat-bot"
+
+// Version is sent with every event and bumped on incompatible changes.
+const Version = 1
+
+// ProtocolEnv is the environment variable machine clients set to the protocol
+// version they speak, e.g. "ssh -o SetEnv=SCHAT_PROTOCOL=1 -s host schat-bot".
+// The server sends a notice event to clients whose version differs from its
+// own. Clients that do not set it are taken to speak version 1.
+const ProtocolEnv = "SCHAT_PROTOCOL"
+
+// Event types sent by the server.
+const (
+	// EventReady is sent once after connecting, naming the bot's user and
+	// room.
+	EventReady = "ready"
+	// EventMessage carries a chat, action, system, or direct message.
+	EventMessage = "message"
+	// EventOK and EventError answer the request with the same ID.
+	EventOK    = "ok"
+	EventError = "error"
+	// EventNotice carries a server notice the bot may act on; Code says which.
+	EventNotice = "notice"
+)
+
+// Notice codes.
+const (
+	// NoticeUpgrade warns that the server is about to be replaced, e.g. by a
+	// new release; reconnect once it goes away.
+	NoticeUpgrade = "upgrade"
+	// NoticeProtocolOutdated warns that the client speaks an older protocol
+	// version than the server.
+	NoticeProtocolOutdated = "protocol_outdated"
+	// NoticeProtocolNewer warns that the client speaks a newer protocol
+	// version than the server, as happens mid-upgrade.
+	NoticeProtocolNewer = "protocol_newer"
+)
+
+// Request types sent by the bot.
+const (
+	RequestSend   = "send"
+	RequestAction = "action"
+	RequestDirect = "direct"
+	RequestJoin   = "join"
+)
+
+// Message kinds.
+const (
+	KindChat   = "chat"
+	KindAction = "action"
+	KindSystem = "system"
+	KindDirect = "direct"
+	KindEdit   = "edit"
+	KindDelete = "delete"
+	// KindReaction carries the reaction in Body and the ID of the message
+	// reacted to in Message.
+	KindReaction = "reaction"
+)
+
+// Event is one line from the server.
+type Event struct {
+	V    int       `json:"v"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// ID is the request an ok or error event answers; zero for events the
+	// bot did not ask for.
+	ID   int64  `json:"id,omitempty"`
+	Room string `json:"room,omitempty"`
+	From string `json:"from,omitempty"`
+	// User is the bot's own username in ready events.
+	User string `json:"user,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Body string `json:"body,omitempty"`
+	// Message identifies chat and action messages in their room; edit and
+	// delete events name the message they change.
+	Message uint64 `json:"message,omitempty"`
+	// ReplyTo is the message a /reply answers.
+	ReplyTo uint64 `json:"reply_to,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Code identifies the notice in notice events.
+	Code string `json:"code,omitempty"`
+	// ServerVersion is the release an upgrade notice installs, if known.
+	ServerVersion string `json:"server_version,omitempty"`
+	// Deadline is when an upgrade notice expects the server to go away.
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// Request is one line from the bot. The server answers every request with an
+// ok or error event carrying the same ID.
+type Request struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	// Room is the room to join.
+	Room string `json:"room,omitempty"`
+	// To is the recipient of a direct message.
+	To   string `json:"to,omitempty"`
+	Text string `json:"text,omitempty"`
+}
@@ -0,0 +1,42 @@
+package bridge
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes reconnect delays that grow exponentially up to Max. Jitter
+// spreads retries by up to that fraction of the delay so bridges that dropped
+// together do not reconnect in lockstep.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// DefaultBackoff starts at one second and settles at five minutes.
+var DefaultBackoff = Backoff{
+	Initial:    time.Second,
+	Max:        5 * time.Minute,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Delay returns the wait before the attempt-th retry, counting from 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := float64(b.Initial)
+	for i := 1; i < attempt && delay < float64(b.Max); i++ {
+		delay *= b.Multiplier
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,296 @@
+// Package bridge supervises connections to external chat services. Every
+// integration runs under the same reconnect, backoff, and circuit breaker
+// policy, isolated from the others so one flapping bridge cannot starve or
+// crash the rest.
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Connector is one integration, such as an IRC or Matrix bridge.
+type Connector interface {
+	// Name identifies the bridge in status output and logs.
+	Name() string
+	// Run connects and serves until ctx is cancelled or the connection is
+	// lost. It calls ready once the connection is usable so the supervisor can
+	// tell a dropped session from a failed connect.
+	Run(ctx context.Context, ready func()) error
+}
+
+// State is where a bridge is in its lifecycle.
+type State string
+
+// Bridge states reported in Status.
+const (
+	StateConnecting State = "connecting"
+	StateConnected  State = "connected"
+	StateBackoff    State = "backoff"
+	// StateOpen means the circuit breaker tripped and retries are paused.
+	StateOpen    State = "circuit-open"
+	StateStopped State = "stopped"
+)
+
+// Status is a snapshot of one bridge's health.
+type Status struct {
+	Name  string    `json:"name"`
+	State State     `json:"state"`
+	Since time.Time `json:"since"`
+	// Failures counts consecutive failed or short-lived connections.
+	Failures int `json:"failures"`
+	// Reconnects counts every connection attempt after the first.
+	Reconnects  int       `json:"reconnects"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+}
+
+// Supervisor runs connectors and reconnects them when they fail.
+type Supervisor struct {
+	backoff     Backoff
+	threshold   int
+	cooldown    time.Duration
+	stableAfter time.Duration
+	logger      *slog.Logger
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu       sync.Mutex
+	bridges  map[string]*Status
+	relays   []Relay
+	pending  []Connector
+	ctx      context.Context
+	workers  sync.WaitGroup
+	started  bool
+	shutdown bool
+}
+
+// Option customises a Supervisor.
+type Option func(*Supervisor)
+
+// WithBackoff sets the reconnect delay policy.
+func WithBackoff(b Backoff) Option {
+	return func(s *Supervisor) {
+		if b.Initial > 0 {
+			s.backoff = b
+		}
+	}
+}
+
+// WithBreaker pauses a bridge for cooldown after threshold consecutive
+// failures, then allows a single trial connection.
+func WithBreaker(threshold int, cooldown time.Duration) Option {
+	return func(s *Supervisor) {
+		if threshold > 0 && cooldown > 0 {
+			s.threshold, s.cooldown = threshold, cooldown
+		}
+	}
+}
+
+// WithStableAfter sets how long a connection must last before it counts as a
+// success. Shorter sessions count as failures, which is how flapping trips
+// the breaker.
+func WithStableAfter(d time.Duration) Option {
+	return func(s *Supervisor) {
+		if d >= 0 {
+			s.stableAfter = d
+		}
+	}
+}
+
+// WithLogger sets the destination for reconnect and breaker logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Supervisor) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// NewSupervisor constructs a Supervisor with no bridges.
+func NewSupervisor(opts ...Option) *Supervisor {
+	s := &Supervisor{
+		backoff:     DefaultBackoff,
+		threshold:   5,
+		cooldown:    10 * time.Minute,
+		stableAfter: 30 * time.Second,
+		logger:      slog.Default(),
+		now:         time.Now,
+		sleep:       sleepContext,
+		bridges:     make(map[string]*Status),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// Add registers a connector. Bridges added after Run start immediately.
+func (s *Supervisor) Add(c Connector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := c.Name()
+	if _, dup := s.bridges[name]; dup {
+		return fmt.Errorf("bridge: duplicate bridge %q", name)
+	}
+	s.bridges[name] = &Status{Name: name, State: StateStopped, Since: s.now()}
+	if r, ok := c.(Relay); ok {
+		// Copied on write so Publish can iterate without holding the lock.
+		s.relays = append(s.relays[:len(s.relays):len(s.relays)], r)
+	}
+	if s.started && !s.shutdown {
+		s.start(c)
+	} else {
+		s.pending = append(s.pending, c)
+	}
+	return nil
+}
+
+// Run starts every bridge and blocks until ctx is cancelled and all of them
+// have stopped.
+func (s *Supervisor) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx, s.started = ctx, true
+	for _, c := range s.pending {
+		s.start(c)
+	}
+	s.pending = nil
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	s.mu.Lock()
+	s.shutdown = true
+	s.mu.Unlock()
+	s.workers.Wait()
+}
+
+// Status returns a snapshot of every bridge ordered by name.
+func (s *Supervisor) Status() []Status {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Status, 0, len(s.bridges))
+	for _, st := range s.bridges {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// start launches c's supervision loop; s.mu must be held.
+func (s *Supervisor) start(c Connector) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.supervise(s.ctx, c)
+	}()
+}
+
+func (s *Supervisor) supervise(ctx context.Context, c Connector) {
+	name := c.Name()
+	defer s.update(name, func(st *Status) { st.State, st.NextAttempt = StateStopped, time.Time{} })
+
+	for attempt := 0; ; attempt++ {
+		if ctx.Err() != nil {
+			return
+		}
+		if attempt > 0 {
+			s.update(name, func(st *Status) { st.Reconnects++ })
+		}
+		s.update(name, func(st *Status) { st.State = StateConnecting })
+
+		connectedAt, err := s.runOnce(ctx, c)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("connection closed")
+		}
+
+		stable := !connectedAt.IsZero() && s.now().Sub(connectedAt) >= s.stableAfter
+		var failures int
+		s.update(name, func(st *Status) {
+			if stable {
+				st.Failures = 0
+			}
+			st.Failures++
+			st.LastError = err.Error()
+			failures = st.Failures
+		})
+
+		delay, state := s.backoff.Delay(failures), StateBackoff
+		if failures >= s.threshold {
+			delay, state = s.cooldown, StateOpen
+			s.logger.Warn("bridge: circuit open", "bridge", name, "failures", failures, "retry_in", delay, "err", err)
+		} else {
+			s.logger.Info("bridge: disconnected", "bridge", name, "retry_in", delay.Round(time.Millisecond), "err", err)
+		}
+		s.update(name, func(st *Status) { st.State, st.NextAttempt = state, s.now().Add(delay) })
+		if s.sleep(ctx, delay) != nil {
+			return
+		}
+		s.update(name, func(st *Status) { st.NextAttempt = time.Time{} })
+	}
+}
+
+// runOnce runs one connection, converting a panic into an error so a broken
+// bridge cannot take the server down. It returns when the connection became
+// ready, or the zero time if it never did.
+func (s *Supervisor) runOnce(ctx context.Context, c Connector) (connectedAt time.Time, err error) {
+	name := c.Name()
+	var connected atomic.Int64
+	var once sync.Once
+	ready := func() {
+		once.Do(func() {
+			connected.Store(s.now().UnixNano())
+			s.update(name, func(st *Status) { st.State = StateConnected })
+			s.logger.Info("bridge: connected", "bridge", name)
+		})
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if ns := connected.Load(); ns != 0 {
+			connectedAt = time.Unix(0, ns)
+		}
+	}()
+	return time.Time{}, c.Run(ctx, ready)
+}
+
+// update applies fn to the named bridge's status, stamping state changes.
+func (s *Supervisor) update(name string, fn func(*Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.bridges[name]
+	before := st.State
+	fn(st)
+	if st.State != before {
+		st.Since = s.now()
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
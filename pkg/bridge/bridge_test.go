@@ -0,0 +1,188 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2}
+	require.Equal(t, time.Second, b.Delay(0))
+	require.Equal(t, time.Second, b.Delay(1))
+	require.Equal(t, 4*time.Second, b.Delay(3))
+	require.Equal(t, 10*time.Second, b.Delay(50), "capped at Max")
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.Delay(2)
+		require.GreaterOrEqual(t, d, time.Second)
+		require.LessOrEqual(t, d, 3*time.Second)
+	}
+}
+
+// scripted is a connector that plays one step per connection attempt and then
+// stays connected until cancelled.
+type scripted struct {
+	name  string
+	steps []func(ready func()) error
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func (c *scripted) Name() string { return c.name }
+
+func (c *scripted) Run(ctx context.Context, ready func()) error {
+	c.mu.Lock()
+	n := c.attempts
+	c.attempts++
+	c.mu.Unlock()
+
+	if n < len(c.steps) {
+		return c.steps[n](ready)
+	}
+	ready()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func fail(err error) func(func()) error {
+	return func(func()) error { return err }
+}
+
+// testClock drives a Supervisor without real sleeps: each backoff advances the
+// clock instantly and is recorded per bridge.
+type testClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newTestSupervisor(clock *testClock, opts ...Option) *Supervisor {
+	s := NewSupervisor(append([]Option{WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)...)
+	s.now = func() time.Time {
+		clock.mu.Lock()
+		defer clock.mu.Unlock()
+		return clock.now
+	}
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		clock.mu.Lock()
+		clock.now = clock.now.Add(d)
+		clock.sleeps = append(clock.sleeps, d)
+		clock.mu.Unlock()
+		return ctx.Err()
+	}
+	return s
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *testClock) recorded() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+func runUntil(t *testing.T, s *Supervisor, done func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, done, 2*time.Second, time.Millisecond)
+	cancel()
+	<-stopped
+}
+
+func connected(s *Supervisor, name string) func() bool {
+	return func() bool {
+		for _, st := range s.Status() {
+			if st.Name == name {
+				return st.State == StateConnected
+			}
+		}
+		return false
+	}
+}
+
+func TestSupervisorBacksOffAndOpensCircuit(t *testing.T) {
+	clock := &testClock{now: time.Unix(0, 0)}
+	s := newTestSupervisor(clock,
+		WithBackoff(Backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2}),
+		WithBreaker(3, time.Hour),
+	)
+	refused := errors.New("connection refused")
+	irc := &scripted{name: "irc", steps: []func(func()) error{fail(refused), fail(refused), fail(refused)}}
+	require.NoError(t, s.Add(irc))
+	require.Error(t, s.Add(&scripted{name: "irc"}), "names are unique")
+
+	runUntil(t, s, connected(s, "irc"))
+
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Second, time.Hour}, clock.recorded(),
+		"the third failure trips the breaker for the cooldown")
+	st := s.Status()[0]
+	require.Equal(t, StateStopped, st.State)
+	require.Equal(t, 3, st.Reconnects)
+	require.Equal(t, 3, st.Failures)
+	require.Equal(t, "connection refused", st.LastError)
+}
+
+func TestSupervisorTreatsFlappingAsFailure(t *testing.T) {
+	clock := &testClock{now: time.Unix(0, 0)}
+	s := newTestSupervisor(clock,
+		WithBackoff(Backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2}),
+		WithBreaker(2, time.Hour),
+		WithStableAfter(time.Minute),
+	)
+	flap := func(ready func()) error {
+		ready()
+		return errors.New("reset by peer")
+	}
+	stable := func(ready func()) error {
+		ready()
+		clock.advance(2 * time.Minute)
+		return errors.New("server restart")
+	}
+	require.NoError(t, s.Add(&scripted{name: "matrix", steps: []func(func()) error{flap, flap, stable}}))
+
+	runUntil(t, s, connected(s, "matrix"))
+
+	require.Equal(t, []time.Duration{time.Second, time.Hour, time.Second}, clock.recorded(),
+		"short sessions trip the breaker; a stable one resets the streak")
+	require.Equal(t, 1, s.Status()[0].Failures)
+}
+
+func TestSupervisorIsolatesPanics(t *testing.T) {
+	clock := &testClock{now: time.Unix(0, 0)}
+	s := newTestSupervisor(clock, WithBreaker(1, time.Hour))
+	require.NoError(t, s.Add(&scripted{name: "slack", steps: []func(func()) error{
+		func(func()) error { panic("nil map") },
+	}}))
+	require.NoError(t, s.Add(&scripted{name: "push"}))
+
+	runUntil(t, s, func() bool { return connected(s, "slack")() && connected(s, "push")() })
+
+	status := s.Status()
+	require.Equal(t, "push", status[0].Name)
+	require.Zero(t, status[0].Failures)
+	require.Equal(t, "slack", status[1].Name)
+	require.Equal(t, "panic: nil map", status[1].LastError)
+}
+
+func TestNilSupervisorStatus(t *testing.T) {
+	var s *Supervisor
+	require.Empty(t, s.Status())
+}
@@ -0,0 +1,315 @@
+// Package irc mirrors schat rooms to IRC channels. The bridge signs in to an
+// IRC server as a single bot nickname, relays room messages to the mapped
+// channel as "<alice> hello", and posts channel messages into the room under
+// "nick@network" names. Reconnects are left to the bridge.Supervisor.
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+const (
+	// maxTextBytes keeps PRIVMSG lines under the 512 byte IRC limit once the
+	// server adds our prefix.
+	maxTextBytes = 400
+	// defaultQueueSize bounds the room messages held while disconnected.
+	defaultQueueSize = 256
+	// registerTimeout bounds the wait for the server's welcome.
+	registerTimeout = 30 * time.Second
+)
+
+// Config describes one IRC network.
+type Config struct {
+	// Name identifies the network in status output and in the display names
+	// of IRC users, e.g. "libera" shows bob as "bob@libera".
+	Name string
+	// Server is the host:port to connect to.
+	Server string
+	TLS    bool
+	// Nick is the bot's nickname; "_" is appended while it is taken.
+	Nick string
+	// Password is sent with PASS when set.
+	Password string
+	// Channels maps IRC channels to schat room names.
+	Channels map[string]string
+}
+
+// Bridge is a bridge.Relay for one IRC network.
+type Bridge struct {
+	cfg   Config
+	post  func(bridge.Message) error
+	rooms map[string][]string // room -> channels
+
+	out          chan bridge.Message
+	lineInterval time.Duration
+	logger       *slog.Logger
+	dial         func(ctx context.Context) (net.Conn, error)
+}
+
+// Option customises a Bridge.
+type Option func(*Bridge)
+
+// WithLogger sets the destination for protocol logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(b *Bridge) {
+		if logger != nil {
+			b.logger = logger
+		}
+	}
+}
+
+// WithLineInterval spaces out lines sent to the server so the bot is not
+// disconnected for flooding.
+func WithLineInterval(d time.Duration) Option {
+	return func(b *Bridge) {
+		if d >= 0 {
+			b.lineInterval = d
+		}
+	}
+}
+
+// New returns a bridge for cfg that hands channel messages to post.
+func New(cfg Config, post func(bridge.Message) error, opts ...Option) *Bridge {
+	b := &Bridge{
+		cfg:          cfg,
+		post:         post,
+		rooms:        make(map[string][]string),
+		out:          make(chan bridge.Message, defaultQueueSize),
+		lineInterval: 500 * time.Millisecond,
+		logger:       slog.Default(),
+	}
+	for channel, room := range cfg.Channels {
+		b.rooms[room] = append(b.rooms[room], channel)
+	}
+	b.dial = b.dialServer
+	for _, opt := range opts {
+		if opt != nil {
+			opt(b)
+		}
+	}
+	return b
+}
+
+// Name implements bridge.Connector.
+func (b *Bridge) Name() string {
+	return "irc:" + b.cfg.Name
+}
+
+// Relay implements bridge.Relay. Messages for rooms without a channel are
+// ignored; when the queue is full they are dropped.
+func (b *Bridge) Relay(msg bridge.Message) {
+	if len(b.rooms[msg.Room]) == 0 {
+		return
+	}
+	select {
+	case b.out <- msg:
+	default:
+		b.logger.Warn("irc: queue full, dropping message", "bridge", b.Name(), "room", msg.Room)
+	}
+}
+
+func (b *Bridge) dialServer(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	if b.cfg.TLS {
+		host, _, _ := net.SplitHostPort(b.cfg.Server)
+		td := tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: host}}
+		return td.DialContext(ctx, "tcp", b.cfg.Server)
+	}
+	return d.DialContext(ctx, "tcp", b.cfg.Server)
+}
+
+// Run implements bridge.Connector: it signs in, joins the channels, and
+// relays in both directions until ctx is cancelled or the connection drops.
+func (b *Bridge) Run(ctx context.Context, ready func()) error {
+	conn, err := b.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("irc: %w", err)
+	}
+	l := &link{Bridge: b, conn: conn, nick: b.cfg.Nick, done: make(chan struct{})}
+	defer l.close()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.close()
+		case <-l.done:
+		}
+	}()
+	welcome := time.AfterFunc(registerTimeout, func() {
+		l.fail(errors.New("irc: no welcome from server"))
+	})
+	defer welcome.Stop()
+
+	if b.cfg.Password != "" {
+		l.send("PASS " + b.cfg.Password)
+	}
+	l.send("NICK " + l.nick)
+	l.send("USER " + b.cfg.Nick + " 0 * :schat bridge")
+
+	err = l.read(func() {
+		welcome.Stop()
+		for channel := range b.cfg.Channels {
+			l.send("JOIN " + channel)
+		}
+		ready()
+		go l.writeLoop()
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// link is one connection to the server.
+type link struct {
+	*Bridge
+	conn net.Conn
+
+	nick       string
+	registered bool
+
+	writeMu sync.Mutex
+
+	closeOnce sync.Once
+	done      chan struct{}
+	errMu     sync.Mutex
+	err       error
+}
+
+// read handles server lines until the connection ends, calling welcome once
+// registration succeeds.
+func (l *link) read(welcome func()) error {
+	scanner := bufio.NewScanner(l.conn)
+	scanner.Buffer(make([]byte, 4096), 64<<10)
+	for scanner.Scan() {
+		msg := parseLine(scanner.Text())
+		switch msg.command {
+		case "PING":
+			l.send("PONG :" + msg.param(0))
+		case "001":
+			l.registered = true
+			l.nick = msg.param(0)
+			welcome()
+		case "433", "432":
+			if !l.registered {
+				l.nick += "_"
+				l.send("NICK " + l.nick)
+			}
+		case "NICK":
+			if msg.nick == l.nick {
+				l.nick = msg.param(0)
+			}
+		case "ERROR":
+			l.fail(fmt.Errorf("irc: server closed the link: %s", msg.param(0)))
+		case "471", "473", "474", "475":
+			l.logger.Warn("irc: cannot join channel", "bridge", l.Name(), "channel", msg.param(1), "reason", msg.param(2))
+		case "PRIVMSG":
+			l.handlePrivmsg(msg)
+		}
+	}
+
+	l.errMu.Lock()
+	defer l.errMu.Unlock()
+	switch {
+	case l.err != nil:
+		return l.err
+	case scanner.Err() != nil:
+		return fmt.Errorf("irc: %w", scanner.Err())
+	default:
+		return fmt.Errorf("irc: %w", io.EOF)
+	}
+}
+
+// handlePrivmsg posts a channel message into its room. Private messages to
+// the bot and our own echoes are ignored.
+func (l *link) handlePrivmsg(msg message) {
+	room, ok := l.cfg.Channels[msg.param(0)]
+	if !ok || msg.nick == "" || strings.EqualFold(msg.nick, l.nick) {
+		return
+	}
+	text, action := ctcpAction(msg.param(1))
+	if strings.HasPrefix(text, "\x01") {
+		return // other CTCP requests
+	}
+	text = strings.TrimSpace(stripFormatting(text))
+	if text == "" {
+		return
+	}
+	err := l.post(bridge.Message{
+		Room:   room,
+		User:   msg.nick + "@" + l.cfg.Name,
+		Text:   text,
+		Action: action,
+		Origin: l.Name(),
+	})
+	if err != nil {
+		l.logger.Debug("irc: message not posted", "bridge", l.Name(), "room", room, "err", err)
+	}
+}
+
+// writeLoop relays queued room messages until the connection ends.
+func (l *link) writeLoop() {
+	for {
+		select {
+		case <-l.done:
+			return
+		case msg := <-l.out:
+			for _, channel := range l.rooms[msg.Room] {
+				for _, line := range formatRelay(msg) {
+					l.send("PRIVMSG " + channel + " :" + line)
+					select {
+					case <-l.done:
+						return
+					case <-time.After(l.lineInterval):
+					}
+				}
+			}
+		}
+	}
+}
+
+// formatRelay renders a room message as IRC text lines.
+func formatRelay(msg bridge.Message) []string {
+	text := "<" + msg.User + "> " + oneLine(msg.Text)
+	if msg.Action {
+		text = "* " + msg.User + " " + oneLine(msg.Text)
+	}
+	return splitText(text, maxTextBytes)
+}
+
+func (l *link) send(line string) {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+	if _, err := io.WriteString(l.conn, line+"\r\n"); err != nil {
+		l.fail(fmt.Errorf("irc: %w", err))
+	}
+}
+
+// fail records the first error and closes the connection.
+func (l *link) fail(err error) {
+	l.errMu.Lock()
+	if l.err == nil {
+		l.err = err
+	}
+	l.errMu.Unlock()
+	l.close()
+}
+
+func (l *link) close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.conn.Close()
+	})
+}
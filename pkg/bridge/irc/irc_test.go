@@ -0,0 +1,140 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+func relayMsg(user, text string, action bool) bridge.Message {
+	return bridge.Message{Room: "lobby", User: user, Text: text, Action: action}
+}
+
+// fakeServer is the server end of a bridge connection.
+type fakeServer struct {
+	t     *testing.T
+	conn  net.Conn
+	lines *bufio.Scanner
+}
+
+func (s *fakeServer) expect(want string) {
+	s.t.Helper()
+	require.NoError(s.t, s.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.True(s.t, s.lines.Scan(), "waiting for %q", want)
+	require.Equal(s.t, want, s.lines.Text())
+}
+
+func (s *fakeServer) send(line string) {
+	s.t.Helper()
+	_, err := io.WriteString(s.conn, line+"\r\n")
+	require.NoError(s.t, err)
+}
+
+type posted struct {
+	mu   sync.Mutex
+	msgs []bridge.Message
+}
+
+func (p *posted) post(msg bridge.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+func (p *posted) get() []bridge.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]bridge.Message(nil), p.msgs...)
+}
+
+func startBridge(t *testing.T, cfg Config, post func(bridge.Message) error) (*Bridge, *fakeServer, chan struct{}, chan error) {
+	t.Helper()
+	client, server := net.Pipe()
+	b := New(cfg, post, WithLineInterval(0), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	b.dial = func(context.Context) (net.Conn, error) { return client, nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx, func() { close(ready) }) }()
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+		<-done
+	})
+	return b, &fakeServer{t: t, conn: server, lines: bufio.NewScanner(server)}, ready, done
+}
+
+func TestBridgeMirrorsMessages(t *testing.T) {
+	var got posted
+	b, srv, ready, _ := startBridge(t, Config{
+		Name:     "libera",
+		Nick:     "schatbot",
+		Password: "hunter2",
+		Channels: map[string]string{"#schat": "lobby"},
+	}, got.post)
+	require.Equal(t, "irc:libera", b.Name())
+
+	srv.expect("PASS hunter2")
+	srv.expect("NICK schatbot")
+	srv.expect("USER schatbot 0 * :schat bridge")
+	srv.send(":server 433 * schatbot :Nickname is already in use")
+	srv.expect("NICK schatbot_")
+	srv.send(":server 001 schatbot_ :Welcome")
+	srv.expect("JOIN #schat")
+	<-ready
+
+	srv.send("PING :server")
+	srv.expect("PONG :server")
+
+	srv.send(":bob!~bob@host PRIVMSG #schat :\x02hello\x02 everyone")
+	srv.send(":bob!~bob@host PRIVMSG #schat :\x01ACTION waves\x01")
+	srv.send(":bob!~bob@host PRIVMSG #schat :\x01VERSION\x01")
+	srv.send(":bob!~bob@host PRIVMSG schatbot_ :private")
+	srv.send(":carol!~c@host PRIVMSG #other :wrong channel")
+	srv.send(":schatbot_!~s@host PRIVMSG #schat :<alice> own echo")
+
+	b.Relay(bridge.Message{Room: "lobby", User: "alice", Text: "hi from schat"})
+	b.Relay(bridge.Message{Room: "dev", User: "alice", Text: "not bridged"})
+	b.Relay(bridge.Message{Room: "lobby", User: "alice", Text: "waves back", Action: true})
+	srv.expect("PRIVMSG #schat :<alice> hi from schat")
+	srv.expect("PRIVMSG #schat :* alice waves back")
+
+	require.Eventually(t, func() bool { return len(got.get()) == 2 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, []bridge.Message{
+		{Room: "lobby", User: "bob@libera", Text: "hello everyone", Origin: "irc:libera"},
+		{Room: "lobby", User: "bob@libera", Text: "waves", Action: true, Origin: "irc:libera"},
+	}, got.get())
+}
+
+func TestBridgeReportsLostConnection(t *testing.T) {
+	_, srv, ready, done := startBridge(t, Config{Name: "libera", Nick: "schatbot", Channels: map[string]string{"#schat": "lobby"}}, (&posted{}).post)
+	srv.expect("NICK schatbot")
+	srv.expect("USER schatbot 0 * :schat bridge")
+	srv.send(":server 001 schatbot :Welcome")
+	srv.expect("JOIN #schat")
+	<-ready
+
+	srv.send("ERROR :Closing Link: flooding")
+	err := <-done
+	require.ErrorContains(t, err, "Closing Link: flooding")
+	done <- err
+}
+
+func TestBridgeDialFailure(t *testing.T) {
+	b := New(Config{Name: "libera", Nick: "schatbot"}, (&posted{}).post)
+	b.dial = func(context.Context) (net.Conn, error) { return nil, errors.New("connection refused") }
+	err := b.Run(context.Background(), func() { t.Fatal("not ready") })
+	require.ErrorContains(t, err, "irc: connection refused")
+}
@@ -0,0 +1,146 @@
+package irc
+
+import (
+	"strings"
+	"unicode"
+)
+
+// message is one parsed IRC protocol line (RFC 1459 with IRCv3 tags, which
+// are skipped).
+type message struct {
+	// nick is the sender's nickname from the prefix, or the server name.
+	nick    string
+	command string
+	params  []string
+}
+
+// parseLine parses a line without its trailing CRLF.
+func parseLine(line string) message {
+	var msg message
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "@") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+	if strings.HasPrefix(line, ":") {
+		var prefix string
+		prefix, line, _ = strings.Cut(line[1:], " ")
+		msg.nick, _, _ = strings.Cut(prefix, "!")
+	}
+	line = strings.TrimLeft(line, " ")
+	msg.command, line, _ = strings.Cut(line, " ")
+	msg.command = strings.ToUpper(msg.command)
+	for line != "" {
+		line = strings.TrimLeft(line, " ")
+		if strings.HasPrefix(line, ":") {
+			msg.params = append(msg.params, line[1:])
+			break
+		}
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		if param != "" {
+			msg.params = append(msg.params, param)
+		}
+	}
+	return msg
+}
+
+// param returns the i-th parameter, or "" if there are fewer.
+func (m message) param(i int) string {
+	if i < len(m.params) {
+		return m.params[i]
+	}
+	return ""
+}
+
+// ctcpAction unwraps a CTCP ACTION ("/me") PRIVMSG body.
+func ctcpAction(text string) (string, bool) {
+	if !strings.HasPrefix(text, "\x01ACTION ") {
+		return text, false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(text, "\x01ACTION "), "\x01"), true
+}
+
+// stripFormatting removes mIRC bold, color, italic, and similar codes along
+// with any other control characters.
+func stripFormatting(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case 0x03: // color: up to two digits, optionally ",bg" with up to two more
+			i += skipDigits(text[i+1:])
+			if i+2 < len(text) && text[i+1] == ',' && isDigit(text[i+2]) {
+				i++
+				i += skipDigits(text[i+1:])
+			}
+		case 0x04: // hex color: six hex digits, optionally ",rrggbb"
+			i += skipHex(text[i+1:])
+			if i+2 < len(text) && text[i+1] == ',' {
+				i++
+				i += skipHex(text[i+1:])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, b.String())
+}
+
+func skipDigits(s string) int {
+	n := 0
+	for n < 2 && n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return n
+}
+
+func skipHex(s string) int {
+	n := 0
+	for n < 6 && n < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[n]) >= 0 {
+		n++
+	}
+	return n
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// oneLine flattens text so it cannot smuggle extra protocol lines.
+func oneLine(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r' || r == '\n':
+			return ' '
+		case r == 0:
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// splitText cuts text into pieces of at most max bytes, preferring spaces
+// and never splitting a UTF-8 sequence.
+func splitText(text string, max int) []string {
+	var parts []string
+	for len(text) > max {
+		cut := max
+		for cut > 0 && !isRuneStart(text[cut]) {
+			cut--
+		}
+		if space := strings.LastIndexByte(text[:cut], ' '); space > max/2 {
+			cut = space
+		}
+		parts = append(parts, text[:cut])
+		text = strings.TrimLeft(text[cut:], " ")
+	}
+	return append(parts, text)
+}
+
+func isRuneStart(c byte) bool {
+	return c&0xC0 != 0x80
+}
@@ -0,0 +1,56 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	cases := []struct {
+		line string
+		want message
+	}{
+		{line: "PING :tantalum.libera.chat", want: message{command: "PING", params: []string{"tantalum.libera.chat"}}},
+		{line: ":bob!~bob@host PRIVMSG #schat :hello there\r\n", want: message{nick: "bob", command: "PRIVMSG", params: []string{"#schat", "hello there"}}},
+		{line: "@time=2024-05-01T09:30:00Z :bob!~bob@host privmsg #schat ::)", want: message{nick: "bob", command: "PRIVMSG", params: []string{"#schat", ":)"}}},
+		{line: ":server 001 schatbot :Welcome", want: message{nick: "server", command: "001", params: []string{"schatbot", "Welcome"}}},
+		{line: ":server 433 * schatbot :Nickname is already in use", want: message{nick: "server", command: "433", params: []string{"*", "schatbot", "Nickname is already in use"}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.line, func(t *testing.T) {
+			require.Equal(t, tc.want, parseLine(tc.line))
+		})
+	}
+}
+
+func TestStripFormatting(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "\x02bold\x02 \x1ditalic\x1d \x1funder\x1f", want: "bold italic under"},
+		{in: "\x0304red\x03 \x0312,01blue on black\x03 \x033,x", want: "red blue on black ,x"},
+		{in: "\x04ff0000hex\x04 done\x0f", want: "hex done"},
+		{in: "2\x03\x032 apples", want: "2 apples"},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.want, stripFormatting(tc.in), "%q", tc.in)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	require.Equal(t, []string{"short"}, splitText("short", 10))
+	require.Equal(t, []string{"the quick", "brown fox"}, splitText("the quick brown fox", 10))
+	require.Equal(t, []string{"abcdefghij", "klm"}, splitText("abcdefghijklm", 10))
+
+	parts := splitText(strings.Repeat("한", 5), 7)
+	require.Equal(t, []string{"한한", "한한", "한"}, parts, "runes are never cut")
+}
+
+func TestFormatRelay(t *testing.T) {
+	require.Equal(t, []string{"<alice> hi  QUIT :bye"}, formatRelay(relayMsg("alice", "hi\r\nQUIT :bye", false)),
+		"line breaks cannot inject commands")
+	require.Equal(t, []string{"* alice waves"}, formatRelay(relayMsg("alice", "waves", true)))
+}
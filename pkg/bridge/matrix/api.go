@@ -0,0 +1,126 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxResponseBytes bounds homeserver responses; a busy /sync stays well
+// below it.
+const maxResponseBytes = 8 << 20
+
+// event is the subset of a Matrix room event the bridge reads.
+type event struct {
+	Type     string          `json:"type"`
+	EventID  string          `json:"event_id"`
+	Sender   string          `json:"sender"`
+	StateKey *string         `json:"state_key,omitempty"`
+	Content  json.RawMessage `json:"content"`
+	Unsigned struct {
+		TransactionID string `json:"transaction_id"`
+	} `json:"unsigned"`
+}
+
+type messageContent struct {
+	MsgType    string          `json:"msgtype"`
+	Body       string          `json:"body"`
+	NewContent json.RawMessage `json:"m.new_content,omitempty"`
+}
+
+type memberContent struct {
+	Membership  string `json:"membership"`
+	DisplayName string `json:"displayname"`
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			State struct {
+				Events []event `json:"events"`
+			} `json:"state"`
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+	} `json:"rooms"`
+}
+
+// apiError is an error response from the homeserver.
+type apiError struct {
+	Status     int
+	Code       string `json:"errcode"`
+	Message    string `json:"error"`
+	RetryAfter int    `json:"retry_after_ms"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("matrix: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// do calls a client-server API endpoint, encoding in as the JSON body when
+// set and decoding the response into out when set.
+func (b *Bridge) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	u := strings.TrimSuffix(b.cfg.Homeserver, "/") + "/_matrix/client/v3" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("matrix: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("matrix: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+b.cfg.AccessToken)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("matrix: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("matrix: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &apiError{Status: resp.StatusCode}
+		_ = json.Unmarshal(data, apiErr)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("matrix: %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// retryAfter reports how long to wait before retrying a rate-limited call.
+func retryAfter(err error) (time.Duration, bool) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if apiErr.RetryAfter <= 0 {
+		return time.Second, true
+	}
+	return time.Duration(apiErr.RetryAfter) * time.Millisecond, true
+}
@@ -0,0 +1,405 @@
+// Package matrix mirrors schat rooms to Matrix rooms. The bridge runs in
+// client mode: it signs in to a homeserver as one bot account with an access
+// token, relays room messages as "<alice> hello", and posts Matrix messages
+// into the room under "displayname@network" names. Reconnects are left to the
+// bridge.Supervisor.
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+const (
+	// defaultQueueSize bounds the room messages held while disconnected.
+	defaultQueueSize = 256
+	// seenEvents is how many recent event IDs are remembered to drop events
+	// the homeserver delivers twice.
+	seenEvents = 1024
+	// maxNameLength bounds display names shown in schat.
+	maxNameLength = 32
+	// sendAttempts bounds retries of a rate-limited send.
+	sendAttempts = 3
+)
+
+// initialFilter skips room history on the first sync, so only messages sent
+// after the bridge starts are relayed. Room state, and with it the members'
+// display names, is still returned.
+const initialFilter = `{"room":{"timeline":{"limit":0}}}`
+
+// Config describes one Matrix account.
+type Config struct {
+	// Name identifies the network in status output and in the display names
+	// of Matrix users, e.g. "matrix" shows Bob as "Bob@matrix".
+	Name string
+	// Homeserver is the base URL, e.g. "https://matrix.example.org".
+	Homeserver  string
+	AccessToken string
+	// Rooms maps Matrix room IDs or aliases to schat room names. The bot
+	// joins each of them on connect.
+	Rooms map[string]string
+}
+
+// Bridge is a bridge.Relay for one Matrix account.
+type Bridge struct {
+	cfg  Config
+	post func(bridge.Message) error
+
+	out         chan bridge.Message
+	client      *http.Client
+	syncTimeout time.Duration
+	logger      *slog.Logger
+
+	// since, seen, and names carry over between connections so a reconnect
+	// resumes where the last sync stopped; only Run touches them.
+	since string
+	seen  *eventSet
+	// names holds members' display names per Matrix room.
+	names map[string]map[string]string
+
+	txnPrefix string
+	txn       atomic.Uint64
+}
+
+// Option customises a Bridge.
+type Option func(*Bridge)
+
+// WithLogger sets the destination for protocol logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(b *Bridge) {
+		if logger != nil {
+			b.logger = logger
+		}
+	}
+}
+
+// WithHTTPClient sets the client used to reach the homeserver.
+func WithHTTPClient(client *http.Client) Option {
+	return func(b *Bridge) {
+		if client != nil {
+			b.client = client
+		}
+	}
+}
+
+// WithSyncTimeout sets how long each /sync long poll waits for events.
+func WithSyncTimeout(d time.Duration) Option {
+	return func(b *Bridge) {
+		if d >= 0 {
+			b.syncTimeout = d
+		}
+	}
+}
+
+// New returns a bridge for cfg that hands Matrix messages to post.
+func New(cfg Config, post func(bridge.Message) error, opts ...Option) *Bridge {
+	b := &Bridge{
+		cfg:         cfg,
+		post:        post,
+		out:         make(chan bridge.Message, defaultQueueSize),
+		client:      http.DefaultClient,
+		syncTimeout: 30 * time.Second,
+		logger:      slog.Default(),
+		seen:        newEventSet(seenEvents),
+		names:       make(map[string]map[string]string),
+		txnPrefix:   "schat" + strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(b)
+		}
+	}
+	return b
+}
+
+// Name implements bridge.Connector.
+func (b *Bridge) Name() string {
+	return "matrix:" + b.cfg.Name
+}
+
+// Relay implements bridge.Relay. Messages for rooms without a Matrix room are
+// ignored; when the queue is full they are dropped.
+func (b *Bridge) Relay(msg bridge.Message) {
+	if !b.bridges(msg.Room) {
+		return
+	}
+	select {
+	case b.out <- msg:
+	default:
+		b.logger.Warn("matrix: queue full, dropping message", "bridge", b.Name(), "room", msg.Room)
+	}
+}
+
+func (b *Bridge) bridges(room string) bool {
+	for _, r := range b.cfg.Rooms {
+		if r == room {
+			return true
+		}
+	}
+	return false
+}
+
+// Run implements bridge.Connector: it checks the token, joins the rooms, and
+// relays in both directions until ctx is cancelled or a sync fails.
+func (b *Bridge) Run(ctx context.Context, ready func()) error {
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := b.do(ctx, http.MethodGet, "/account/whoami", nil, nil, &whoami); err != nil {
+		return err
+	}
+	s := &session{
+		Bridge:  b,
+		userID:  whoami.UserID,
+		rooms:   make(map[string]string),
+		targets: make(map[string][]string),
+	}
+	for alias, room := range b.cfg.Rooms {
+		var joined struct {
+			RoomID string `json:"room_id"`
+		}
+		if err := b.do(ctx, http.MethodPost, "/join/"+url.PathEscape(alias), nil, struct{}{}, &joined); err != nil {
+			return fmt.Errorf("matrix: join %s: %w", alias, err)
+		}
+		s.rooms[joined.RoomID] = room
+		s.targets[room] = append(s.targets[room], joined.RoomID)
+	}
+
+	if b.since == "" {
+		if err := s.sync(ctx, initialFilter, 0); err != nil {
+			return err
+		}
+	}
+	ready()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.writeLoop(ctx)
+	for {
+		if err := s.sync(ctx, "", b.syncTimeout); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
+
+// session is the state of one connection.
+type session struct {
+	*Bridge
+	userID string
+	// rooms maps joined Matrix room IDs to schat rooms, and targets the
+	// other way.
+	rooms   map[string]string
+	targets map[string][]string
+}
+
+// sync fetches and handles the events since the last sync.
+func (s *session) sync(ctx context.Context, filter string, timeout time.Duration) error {
+	query := url.Values{"timeout": {strconv.FormatInt(timeout.Milliseconds(), 10)}}
+	if s.since != "" {
+		query.Set("since", s.since)
+	}
+	if filter != "" {
+		query.Set("filter", filter)
+	}
+	// The homeserver holds the request for up to timeout; allow it some slack
+	// before giving up on a silent connection.
+	ctx, cancel := context.WithTimeout(ctx, timeout+30*time.Second)
+	defer cancel()
+
+	var resp syncResponse
+	if err := s.do(ctx, http.MethodGet, "/sync", query, nil, &resp); err != nil {
+		return err
+	}
+	for roomID, joined := range resp.Rooms.Join {
+		room, ok := s.rooms[roomID]
+		if !ok {
+			continue
+		}
+		for _, ev := range joined.State.Events {
+			s.handleMember(roomID, ev)
+		}
+		for _, ev := range joined.Timeline.Events {
+			s.handleEvent(roomID, room, ev)
+		}
+	}
+	s.since = resp.NextBatch
+	return nil
+}
+
+// handleMember records display name changes.
+func (s *session) handleMember(roomID string, ev event) {
+	if ev.Type != "m.room.member" || ev.StateKey == nil {
+		return
+	}
+	var content memberContent
+	if json.Unmarshal(ev.Content, &content) != nil {
+		return
+	}
+	if s.names[roomID] == nil {
+		s.names[roomID] = make(map[string]string)
+	}
+	if content.Membership == "join" && content.DisplayName != "" {
+		s.names[roomID][*ev.StateKey] = content.DisplayName
+	} else {
+		delete(s.names[roomID], *ev.StateKey)
+	}
+}
+
+// handleEvent posts a text or emote message into room. The bot's own
+// messages, edits, notices from other bots, and events already seen are
+// skipped.
+func (s *session) handleEvent(roomID, room string, ev event) {
+	s.handleMember(roomID, ev)
+	if ev.Type != "m.room.message" || ev.Sender == s.userID || !s.seen.add(ev.EventID) {
+		return
+	}
+	var content messageContent
+	if json.Unmarshal(ev.Content, &content) != nil || content.NewContent != nil {
+		return
+	}
+	var action bool
+	switch content.MsgType {
+	case "m.text":
+	case "m.emote":
+		action = true
+	default:
+		return
+	}
+
+	user := s.displayName(roomID, ev.Sender) + "@" + s.cfg.Name
+	for _, line := range strings.Split(stripReplyFallback(content.Body), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		err := s.post(bridge.Message{Room: room, User: user, Text: line, Action: action, Origin: s.Name()})
+		if err != nil {
+			s.logger.Debug("matrix: message not posted", "bridge", s.Name(), "room", room, "err", err)
+			return
+		}
+	}
+}
+
+// displayName returns the sender's display name in the room, or the
+// localpart of their user ID, as a single schat-friendly word.
+func (s *session) displayName(roomID, userID string) string {
+	name := s.names[roomID][userID]
+	if name == "" {
+		name, _, _ = strings.Cut(strings.TrimPrefix(userID, "@"), ":")
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return '_'
+		case unicode.IsControl(r), r == '@':
+			return -1
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+	return name
+}
+
+// writeLoop relays queued room messages until ctx is cancelled.
+func (s *session) writeLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-s.out:
+			for _, roomID := range s.targets[msg.Room] {
+				if err := s.send(ctx, roomID, formatRelay(msg)); err != nil && ctx.Err() == nil {
+					s.logger.Warn("matrix: send failed", "bridge", s.Name(), "room", msg.Room, "err", err)
+				}
+			}
+		}
+	}
+}
+
+// send posts a text message to a Matrix room, waiting out rate limits.
+func (s *session) send(ctx context.Context, roomID, text string) error {
+	txn := s.txnPrefix + "." + strconv.FormatUint(s.txn.Add(1), 10)
+	path := "/rooms/" + url.PathEscape(roomID) + "/send/m.room.message/" + txn
+	content := messageContent{MsgType: "m.text", Body: text}
+	var err error
+	for attempt := 0; attempt < sendAttempts; attempt++ {
+		// Retrying with the same transaction ID cannot post twice.
+		if err = s.do(ctx, http.MethodPut, path, nil, content, nil); err == nil {
+			return nil
+		}
+		wait, ok := retryAfter(err)
+		if !ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return err
+}
+
+// formatRelay renders a room message as Matrix text.
+func formatRelay(msg bridge.Message) string {
+	if msg.Action {
+		return "* " + msg.User + " " + msg.Text
+	}
+	return "<" + msg.User + "> " + msg.Text
+}
+
+// stripReplyFallback removes the quoted "> <@bob:example.org> ..." lines
+// clients put at the top of replies.
+func stripReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, ">") {
+			return strings.Join(lines[i:], "\n")
+		}
+	}
+	return ""
+}
+
+// eventSet remembers the most recent event IDs.
+type eventSet struct {
+	ids  map[string]struct{}
+	ring []string
+	next int
+}
+
+func newEventSet(size int) *eventSet {
+	return &eventSet{ids: make(map[string]struct{}, size), ring: make([]string, size)}
+}
+
+// add records id and reports whether it was new.
+func (e *eventSet) add(id string) bool {
+	if id == "" {
+		return true
+	}
+	if _, ok := e.ids[id]; ok {
+		return false
+	}
+	delete(e.ids, e.ring[e.next])
+	e.ring[e.next] = id
+	e.ids[id] = struct{}{}
+	e.next = (e.next + 1) % len(e.ring)
+	return true
+}
@@ -0,0 +1,246 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+const roomID = "!abc:example.org"
+
+// fakeHomeserver serves the client-server endpoints the bridge uses. Each
+// /sync after the first returns the next queued batch of timeline events.
+type fakeHomeserver struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	batches  [][]any
+	syncs    []string
+	sent     []string
+	sendPath []string
+	limited  int
+}
+
+func (h *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	require.Equal(h.t, "Bearer tok", r.Header.Get("Authorization"))
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/_matrix/client/v3")
+	switch {
+	case path == "/account/whoami":
+		writeJSON(w, map[string]string{"user_id": "@bot:example.org"})
+	case path == "/join/%23schat:example.org":
+		writeJSON(w, map[string]string{"room_id": roomID})
+	case path == "/sync":
+		h.sync(w, r)
+	case strings.HasPrefix(path, "/rooms/"+strings.ReplaceAll(roomID, "!", "%21")+"/send/m.room.message/"):
+		var content messageContent
+		require.NoError(h.t, json.NewDecoder(r.Body).Decode(&content))
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.sendPath = append(h.sendPath, path)
+		if h.limited > 0 {
+			h.limited--
+			w.WriteHeader(http.StatusTooManyRequests)
+			writeJSON(w, map[string]any{"errcode": "M_LIMIT_EXCEEDED", "retry_after_ms": 1})
+			return
+		}
+		h.sent = append(h.sent, content.MsgType+" "+content.Body)
+		writeJSON(w, map[string]string{"event_id": "$sent"})
+	default:
+		h.t.Errorf("unexpected request %s %s", r.Method, path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (h *fakeHomeserver) sync(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.syncs = append(h.syncs, r.URL.Query().Get("since"))
+	first := len(h.syncs) == 1
+	var events []any
+	if !first && len(h.batches) > 0 {
+		events, h.batches = h.batches[0], h.batches[1:]
+	}
+	h.mu.Unlock()
+
+	join := map[string]any{"timeline": map[string]any{"events": events}}
+	if first {
+		require.Contains(h.t, r.URL.Query().Get("filter"), `"limit":0`)
+		join["state"] = map[string]any{"events": []any{member("@dave:example.org", "Dave Jones")}}
+	} else if events == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+	writeJSON(w, map[string]any{
+		"next_batch": "s" + r.URL.Query().Get("since"),
+		"rooms":      map[string]any{"join": map[string]any{roomID: join}},
+	})
+}
+
+func (h *fakeHomeserver) sentBodies() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.sent...)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func member(user, name string) map[string]any {
+	return map[string]any{
+		"type": "m.room.member", "sender": user, "state_key": user, "event_id": "$m" + user,
+		"content": map[string]any{"membership": "join", "displayname": name},
+	}
+}
+
+func text(id, sender, msgtype, body string) map[string]any {
+	return map[string]any{
+		"type": "m.room.message", "sender": sender, "event_id": id,
+		"content": map[string]any{"msgtype": msgtype, "body": body},
+	}
+}
+
+type posted struct {
+	mu   sync.Mutex
+	msgs []bridge.Message
+}
+
+func (p *posted) post(msg bridge.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, msg)
+	return nil
+}
+
+func (p *posted) get() []bridge.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]bridge.Message(nil), p.msgs...)
+}
+
+func startBridge(t *testing.T, h *fakeHomeserver, post func(bridge.Message) error) *Bridge {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	b := New(Config{
+		Name:        "matrix",
+		Homeserver:  srv.URL + "/",
+		AccessToken: "tok",
+		Rooms:       map[string]string{"#schat:example.org": "lobby"},
+	}, post, WithSyncTimeout(0), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx, func() { close(ready) }) }()
+	t.Cleanup(func() {
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+		srv.Close()
+	})
+	select {
+	case <-ready:
+	case err := <-done:
+		t.Fatalf("bridge stopped: %v", err)
+	}
+	return b
+}
+
+func TestBridgePostsMatrixMessages(t *testing.T) {
+	bob := text("$1", "@bob:example.org", "m.text", "hello\n\nfrom matrix")
+	edit := text("$3", "@bob:example.org", "m.text", "* hello")
+	edit["content"].(map[string]any)["m.new_content"] = map[string]any{"msgtype": "m.text", "body": "hello"}
+	h := &fakeHomeserver{t: t, batches: [][]any{
+		{
+			member("@bob:example.org", "Bob Smith"),
+			bob,
+			text("$2", "@bot:example.org", "m.text", "<alice> echo"),
+			edit,
+			text("$4", "@alerts:example.org", "m.notice", "disk full"),
+		},
+		{
+			bob, // delivered again
+			text("$5", "@dave:example.org", "m.emote", "waves"),
+			text("$6", "@carol:example.org", "m.text", "> <@bob:example.org> hello\n\nhi bob"),
+		},
+	}}
+	var got posted
+	startBridge(t, h, got.post)
+
+	msg := func(user, text string, action bool) bridge.Message {
+		return bridge.Message{Room: "lobby", User: user, Text: text, Action: action, Origin: "matrix:matrix"}
+	}
+	want := []bridge.Message{
+		msg("Bob_Smith@matrix", "hello", false),
+		msg("Bob_Smith@matrix", "from matrix", false),
+		msg("Dave_Jones@matrix", "waves", true),
+		msg("carol@matrix", "hi bob", false),
+	}
+	require.Eventually(t, func() bool { return len(got.get()) >= len(want) }, 5*time.Second, time.Millisecond)
+	require.Equal(t, want, got.get())
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	require.Equal(t, []string{"", "s", "ss"}, h.syncs[:3], "each sync continues from the last batch")
+}
+
+func TestBridgeRelaysRoomMessages(t *testing.T) {
+	h := &fakeHomeserver{t: t, limited: 1}
+	b := startBridge(t, h, (&posted{}).post)
+
+	b.Relay(bridge.Message{Room: "lobby", User: "alice", Text: "hi matrix"})
+	b.Relay(bridge.Message{Room: "dev", User: "alice", Text: "not bridged"})
+	b.Relay(bridge.Message{Room: "lobby", User: "bob@libera", Text: "waves", Action: true})
+
+	require.Eventually(t, func() bool { return len(h.sentBodies()) == 2 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, []string{"m.text <alice> hi matrix", "m.text * bob@libera waves"}, h.sentBodies())
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	require.Len(t, h.sendPath, 3)
+	require.Equal(t, h.sendPath[0], h.sendPath[1], "a rate-limited send is retried with the same transaction ID")
+	require.NotEqual(t, h.sendPath[1], h.sendPath[2])
+}
+
+func TestBridgeRejectsBadToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]string{"errcode": "M_UNKNOWN_TOKEN", "error": "Invalid access token"})
+	}))
+	defer srv.Close()
+
+	b := New(Config{Name: "m", Homeserver: srv.URL, AccessToken: "bad"}, (&posted{}).post)
+	err := b.Run(context.Background(), func() { t.Error("ready called") })
+	require.EqualError(t, err, "matrix: 401 M_UNKNOWN_TOKEN: Invalid access token")
+}
+
+func TestStripReplyFallback(t *testing.T) {
+	cases := map[string]string{
+		"plain":                           "plain",
+		"> <@bob:x> quoted\n\nanswer":     "\nanswer",
+		"> <@bob:x> a\n> b\nanswer\nmore": "answer\nmore",
+		"> only quote":                    "",
+	}
+	for in, want := range cases {
+		require.Equal(t, want, stripReplyFallback(in), in)
+	}
+}
+
+func TestEventSetForgetsOldest(t *testing.T) {
+	set := newEventSet(2)
+	require.True(t, set.add("$1"))
+	require.False(t, set.add("$1"))
+	require.True(t, set.add("$2"))
+	require.True(t, set.add("$3"))
+	require.True(t, set.add("$1"), "evicted")
+	require.False(t, set.add("$3"))
+}
@@ -0,0 +1,38 @@
+package bridge
+
+// Message is a chat message crossing a bridge in either direction.
+type Message struct {
+	Room string
+	// User is the sender: a schat username going out, or the display name
+	// the bridge chose for a remote user coming in.
+	User string
+	Text string
+	// Action marks /me emotes.
+	Action bool
+	// Origin names the bridge an inbound message arrived through, so it is not
+	// relayed back there.
+	Origin string
+}
+
+// Relay is a Connector that mirrors room messages to its network.
+type Relay interface {
+	Connector
+	// Relay queues msg for the network without blocking. Messages sent while
+	// disconnected may be held until the next connection or dropped.
+	Relay(msg Message)
+}
+
+// Publish hands msg to every registered Relay except the one it came from.
+func (s *Supervisor) Publish(msg Message) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	relays := s.relays
+	s.mu.Unlock()
+	for _, r := range relays {
+		if r.Name() != msg.Origin {
+			r.Relay(msg)
+		}
+	}
+}
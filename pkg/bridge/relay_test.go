@@ -0,0 +1,41 @@
+package bridge
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingRelay is a connector that keeps every message relayed to it.
+type recordingRelay struct {
+	scripted
+
+	mu   sync.Mutex
+	seen []Message
+}
+
+func (r *recordingRelay) Relay(msg Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen = append(r.seen, msg)
+}
+
+func TestSupervisorPublishSkipsOrigin(t *testing.T) {
+	s := NewSupervisor()
+	irc := &recordingRelay{scripted: scripted{name: "irc:libera"}}
+	matrix := &recordingRelay{scripted: scripted{name: "matrix:home"}}
+	require.NoError(t, s.Add(irc))
+	require.NoError(t, s.Add(matrix))
+	require.NoError(t, s.Add(&scripted{name: "push"}), "connectors that do not relay are skipped")
+
+	s.Publish(Message{Room: "lobby", User: "alice", Text: "hi"})
+	s.Publish(Message{Room: "lobby", User: "bob@libera", Text: "hello", Origin: "irc:libera"})
+
+	require.Len(t, irc.seen, 1)
+	require.Equal(t, "alice", irc.seen[0].User)
+	require.Len(t, matrix.seen, 2)
+
+	var nilSupervisor *Supervisor
+	nilSupervisor.Publish(Message{Text: "dropped"})
+}
@@ -0,0 +1,110 @@
+// Package buildinfo reports which build of schat is running. Release builds
+// stamp it with the linker:
+//
+//	go build -ldflags "-X github.com/ledzpl/schat/pkg/buildinfo.Version=v1.2.0 \
+//	  -X github.com/ledzpl/schat/pkg/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/ledzpl/schat/pkg/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/schat
+//
+// Values left unset fall back to what the Go toolchain recorded in the binary.
+package buildinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set with -ldflags "-X ...". They are variables, not constants, so the linker
+// can overwrite them.
+var (
+	Version = ""
+	Commit  = ""
+	Date    = ""
+)
+
+// devVersion is reported when neither the linker nor the module says more.
+const devVersion = "dev"
+
+// shortCommit is how many hex digits of a VCS revision are shown.
+const shortCommit = 12
+
+// Info describes the running binary.
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	// Date is when the binary was built, or the commit time when unstamped.
+	Date string `json:"date,omitempty"`
+	// Modified reports a build from a working tree with uncommitted changes.
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the stamped build information, completed from the module and
+// VCS data the Go toolchain embeds.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info = fill(info, bi)
+	}
+	if info.Version == "" {
+		info.Version = devVersion
+	}
+	return info
+}
+
+// fill completes info from bi without overriding stamped values.
+func fill(info Info, bi *debug.BuildInfo) Info {
+	if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	vcs := info.Commit == ""
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if vcs {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if vcs && info.Date == "" {
+				info.Date = s.Value
+			}
+		case "vcs.modified":
+			if vcs {
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if len(info.Commit) > shortCommit {
+		info.Commit = info.Commit[:shortCommit]
+	}
+	return info
+}
+
+// String renders the info on one line, e.g.
+// "schat v1.2.0 (commit 3f9a0c12d4e5, built 2024-05-01T09:00:00Z, go1.21.0)".
+func (i Info) String() string {
+	details := []string{}
+	if i.Commit != "" {
+		commit := "commit " + i.Commit
+		if i.Modified {
+			commit += "+modified"
+		}
+		details = append(details, commit)
+	}
+	if i.Date != "" {
+		details = append(details, "built "+i.Date)
+	}
+	details = append(details, i.GoVersion)
+	return fmt.Sprintf("schat %s (%s)", i.Version, strings.Join(details, ", "))
+}
+
+// Handler serves Get as JSON, e.g. at /debug/version on the admin address.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Get())
+	})
+}
@@ -0,0 +1,47 @@
+package buildinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFillPrefersStampedValues(t *testing.T) {
+	bi := &debug.BuildInfo{
+		Main: debug.Module{Version: "v1.1.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "3f9a0c12d4e5b6a7c8d9e0f1a2b3c4d5e6f7a8b9"},
+			{Key: "vcs.time", Value: "2024-05-01T09:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	got := fill(Info{}, bi)
+	require.Equal(t, Info{Version: "v1.1.0", Commit: "3f9a0c12d4e5", Date: "2024-05-01T09:00:00Z", Modified: true}, got)
+
+	got = fill(Info{Version: "v1.2.0", Commit: "abc1234", Date: "2024-06-01T00:00:00Z"}, bi)
+	require.Equal(t, Info{Version: "v1.2.0", Commit: "abc1234", Date: "2024-06-01T00:00:00Z"}, got, "ldflags win over VCS data")
+
+	got = fill(Info{}, &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}})
+	require.Empty(t, got.Version)
+}
+
+func TestString(t *testing.T) {
+	info := Info{Version: "v1.2.0", Commit: "3f9a0c12d4e5", Date: "2024-05-01T09:00:00Z", Modified: true, GoVersion: "go1.21.0"}
+	require.Equal(t, "schat v1.2.0 (commit 3f9a0c12d4e5+modified, built 2024-05-01T09:00:00Z, go1.21.0)", info.String())
+	require.Equal(t, "schat dev (go1.21.0)", Info{Version: "dev", GoVersion: "go1.21.0"}.String())
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/version", nil))
+	var got Info
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	require.NotEmpty(t, got.Version)
+	require.Equal(t, runtime.Version(), got.GoVersion)
+}
@@ -0,0 +1,240 @@
+// Package cluster describes a static set of schat nodes behind a load balancer
+// and answers routing questions: which node hosts a room, which node a user
+// should stick to, and where a user is connected right now.
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultPeerTimeout bounds each admin API call made to a peer.
+const defaultPeerTimeout = 2 * time.Second
+
+// ErrUnknownNode is returned when a node ID is not part of the cluster.
+var ErrUnknownNode = errors.New("cluster: unknown node")
+
+// Node is one schat server in the cluster.
+type Node struct {
+	// ID names the node in config, logs, and hints.
+	ID string `json:"id"`
+	// Addr is the SSH address users should connect to, e.g. "chat-b.example.com:2222".
+	Addr string `json:"addr"`
+	// Admin is the base URL of the node's admin API, e.g. "http://10.0.0.2:9100".
+	// Nodes without one cannot be asked where users are.
+	Admin string `json:"admin,omitempty"`
+}
+
+// Cluster is this node's view of the cluster. A nil *Cluster describes a
+// single standalone node: every room is local and there are no peers.
+type Cluster struct {
+	self     Node
+	nodes    []Node
+	byID     map[string]Node
+	affinity map[string]string
+	sticky   bool
+	redirect bool
+	client   *http.Client
+	tls      *TLS
+	logger   *slog.Logger
+
+	replicate bool
+	replicas  []*replica
+}
+
+// Option customises a Cluster.
+type Option func(*Cluster)
+
+// WithAffinity pins rooms to nodes by ID. Rooms without an entry may live on
+// any node.
+func WithAffinity(rooms map[string]string) Option {
+	return func(c *Cluster) {
+		for room, node := range rooms {
+			c.affinity[normalizeRoom(room)] = node
+		}
+	}
+}
+
+// WithSticky gives every user a home node chosen by rendezvous hashing, so
+// reconnects land on the same node as long as the node set is unchanged.
+func WithSticky(on bool) Option {
+	return func(c *Cluster) {
+		c.sticky = on
+	}
+}
+
+// WithRedirect makes BannerHint suggest the right node to connecting users.
+func WithRedirect(on bool) Option {
+	return func(c *Cluster) {
+		c.redirect = on
+	}
+}
+
+// WithHTTPClient overrides the client used to query peers.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Cluster) {
+		if client != nil {
+			c.client = client
+		}
+	}
+}
+
+// WithLogger sets the destination for replication logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Cluster) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// New builds the cluster view for the node called self.
+func New(self string, nodes []Node, opts ...Option) (*Cluster, error) {
+	c := &Cluster{
+		byID:     make(map[string]Node, len(nodes)),
+		affinity: make(map[string]string),
+		client:   &http.Client{Timeout: defaultPeerTimeout},
+		logger:   slog.Default(),
+	}
+	for _, node := range nodes {
+		if node.ID == "" {
+			return nil, errors.New("cluster: node without an id")
+		}
+		if _, dup := c.byID[node.ID]; dup {
+			return nil, fmt.Errorf("cluster: duplicate node %q", node.ID)
+		}
+		node.Admin = strings.TrimRight(node.Admin, "/")
+		c.byID[node.ID] = node
+		c.nodes = append(c.nodes, node)
+	}
+	sort.Slice(c.nodes, func(i, j int) bool { return c.nodes[i].ID < c.nodes[j].ID })
+
+	var ok bool
+	if c.self, ok = c.byID[self]; !ok {
+		return nil, fmt.Errorf("%w %q (this node must be listed in nodes)", ErrUnknownNode, self)
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	for room, node := range c.affinity {
+		if _, ok := c.byID[node]; !ok {
+			return nil, fmt.Errorf("%w %q for room #%s", ErrUnknownNode, node, room)
+		}
+	}
+	if c.replicate {
+		for _, node := range c.Peers() {
+			c.replicas = append(c.replicas, &replica{
+				node:   node,
+				events: make(chan Event, replicationQueueSize),
+				status: PeerStatus{Node: node.ID},
+			})
+		}
+	}
+	return c, nil
+}
+
+// Self returns this node, or the zero Node when standalone.
+func (c *Cluster) Self() Node {
+	if c == nil {
+		return Node{}
+	}
+	return c.self
+}
+
+// Nodes returns every node ordered by ID.
+func (c *Cluster) Nodes() []Node {
+	if c == nil {
+		return nil
+	}
+	return append([]Node(nil), c.nodes...)
+}
+
+// Affinity returns a copy of the room to node ID mapping.
+func (c *Cluster) Affinity() map[string]string {
+	out := make(map[string]string)
+	if c == nil {
+		return out
+	}
+	for room, node := range c.affinity {
+		out[room] = node
+	}
+	return out
+}
+
+// RoomNode returns the node a room is pinned to, if any.
+func (c *Cluster) RoomNode(room string) (Node, bool) {
+	if c == nil {
+		return Node{}, false
+	}
+	id, ok := c.affinity[normalizeRoom(room)]
+	if !ok {
+		return Node{}, false
+	}
+	return c.byID[id], true
+}
+
+// Local reports whether room may be hosted on this node.
+func (c *Cluster) Local(room string) bool {
+	node, pinned := c.RoomNode(room)
+	return !pinned || node.ID == c.self.ID
+}
+
+// HomeNode returns the node username sticks to. Without sticky sessions every
+// user's home is this node.
+func (c *Cluster) HomeNode(username string) Node {
+	if c == nil || !c.sticky {
+		return c.Self()
+	}
+
+	var best Node
+	var bestScore uint64
+	for _, node := range c.nodes {
+		h := fnv.New64a()
+		h.Write([]byte(node.ID))
+		h.Write([]byte{0})
+		h.Write([]byte(username))
+		if score := h.Sum64(); best.ID == "" || score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+// BannerHint returns pre-authentication text pointing username at the right
+// node, or "" when redirects are off or this node is already right. Lines end
+// in "\r\n" like the rest of the SSH banner.
+func (c *Cluster) BannerHint(username string) string {
+	if c == nil || !c.redirect {
+		return ""
+	}
+
+	var b strings.Builder
+	if home := c.HomeNode(username); home.ID != c.self.ID {
+		fmt.Fprintf(&b, "schat: %s, your sessions are served by %s; please connect to %s\r\n", username, home.ID, home.Addr)
+	}
+	rooms := make([]string, 0, len(c.affinity))
+	for room := range c.affinity {
+		if !c.Local(room) {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Strings(rooms)
+	for _, room := range rooms {
+		node, _ := c.RoomNode(room)
+		fmt.Fprintf(&b, "schat: #%s is hosted on %s (%s)\r\n", room, node.ID, node.Addr)
+	}
+	return b.String()
+}
+
+func normalizeRoom(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+}
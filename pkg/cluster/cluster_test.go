@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testNodes = []Node{
+	{ID: "b", Addr: "chat-b:2222"},
+	{ID: "a", Addr: "chat-a:2222"},
+	{ID: "c", Addr: "chat-c:2222"},
+}
+
+func TestNewValidates(t *testing.T) {
+	cases := []struct {
+		name    string
+		self    string
+		nodes   []Node
+		opts    []Option
+		wantErr string
+	}{
+		{name: "valid", self: "a", nodes: testNodes, opts: []Option{WithAffinity(map[string]string{"dev": "b"})}},
+		{name: "self missing", self: "z", nodes: testNodes, wantErr: `unknown node "z"`},
+		{name: "duplicate", self: "a", nodes: append(testNodes, Node{ID: "a"}), wantErr: "duplicate node"},
+		{name: "empty id", self: "a", nodes: append(testNodes, Node{}), wantErr: "without an id"},
+		{name: "affinity to unknown node", self: "a", nodes: testNodes, opts: []Option{WithAffinity(map[string]string{"dev": "z"})}, wantErr: "#dev"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New(tc.self, tc.nodes, tc.opts...)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "a", c.Self().ID)
+			require.Equal(t, []string{"a", "b", "c"}, []string{c.Nodes()[0].ID, c.Nodes()[1].ID, c.Nodes()[2].ID})
+		})
+	}
+}
+
+func TestRoomAffinity(t *testing.T) {
+	c, err := New("a", testNodes, WithAffinity(map[string]string{"#Dev": "b", "ops": "a"}))
+	require.NoError(t, err)
+
+	node, ok := c.RoomNode("dev")
+	require.True(t, ok)
+	require.Equal(t, "chat-b:2222", node.Addr)
+	require.False(t, c.Local("#DEV"))
+	require.True(t, c.Local("ops"))
+	require.True(t, c.Local("random"), "unpinned rooms may live anywhere")
+
+	var standalone *Cluster
+	require.True(t, standalone.Local("dev"))
+	require.Empty(t, standalone.BannerHint("alice"))
+	require.Equal(t, Node{}, standalone.HomeNode("alice"))
+}
+
+func TestHomeNodeIsStable(t *testing.T) {
+	a, err := New("a", testNodes, WithSticky(true))
+	require.NoError(t, err)
+	c, err := New("c", testNodes, WithSticky(true))
+	require.NoError(t, err)
+
+	homes := make(map[string]bool)
+	for _, user := range []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi"} {
+		home := a.HomeNode(user)
+		require.Equal(t, home, c.HomeNode(user), "every node agrees on %s's home", user)
+		homes[home.ID] = true
+	}
+	require.Greater(t, len(homes), 1, "users spread over nodes")
+
+	plain, err := New("a", testNodes)
+	require.NoError(t, err)
+	require.Equal(t, "a", plain.HomeNode("bob").ID, "without sticky sessions users stay put")
+}
+
+func TestBannerHint(t *testing.T) {
+	c, err := New("a", testNodes, WithSticky(true), WithRedirect(true), WithAffinity(map[string]string{"dev": "b", "ops": "a"}))
+	require.NoError(t, err)
+
+	var away, home string
+	for _, user := range []string{"alice", "bob", "carol", "dave", "erin", "frank"} {
+		if c.HomeNode(user).ID == "a" {
+			home = user
+		} else {
+			away = user
+		}
+	}
+	require.NotEmpty(t, home)
+	require.NotEmpty(t, away)
+
+	require.Equal(t, "schat: #dev is hosted on b (chat-b:2222)\r\n", c.BannerHint(home))
+	hint := c.BannerHint(away)
+	require.Contains(t, hint, "schat: "+away+", your sessions are served by "+c.HomeNode(away).ID)
+	require.Contains(t, hint, "#dev is hosted on b")
+
+	quiet, err := New("a", testNodes, WithSticky(true), WithAffinity(map[string]string{"dev": "b"}))
+	require.NoError(t, err)
+	require.Empty(t, quiet.BannerHint(away), "hints need redirects enabled")
+}
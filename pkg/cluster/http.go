@@ -0,0 +1,84 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handlerPath is where Handler is expected to be mounted on every node, so
+// peers can find each other from their admin base URLs.
+const handlerPath = "/debug/cluster"
+
+// Info is the JSON document served for GET without a user.
+type Info struct {
+	Node     Node              `json:"node"`
+	Nodes    []Node            `json:"nodes"`
+	Affinity map[string]string `json:"affinity"`
+	Sticky   bool              `json:"sticky"`
+	Redirect bool              `json:"redirect"`
+	// Replicate reports whether room messages are replicated to peers.
+	Replicate bool `json:"replicate"`
+}
+
+// Handler serves the admin API, mounted at /debug/cluster:
+//
+//	GET                      this node and the cluster layout
+//	GET user=NAME            where NAME is connected, across every node
+//	GET user=NAME&local=1    where NAME is connected on this node only
+//
+// Mount it only on an address reachable by administrators and peers. With
+// WithTLS, local queries are answered only to peers with a CA-signed
+// certificate.
+func (c *Cluster) Handler(dir Directory) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := r.URL.Query().Get("user")
+		if user == "" {
+			writeJSON(w, c.Info())
+			return
+		}
+
+		var body struct {
+			Locations []Location `json:"locations"`
+			Error     string     `json:"error,omitempty"`
+		}
+		if r.URL.Query().Get("local") != "" {
+			if c != nil && c.tls != nil && !authenticatedPeer(r) {
+				http.Error(w, ErrPeerUnauthenticated.Error(), http.StatusForbidden)
+				return
+			}
+			body.Locations = c.local(dir, user)
+		} else {
+			var err error
+			if body.Locations, err = c.Locate(r.Context(), dir, user); err != nil {
+				body.Error = err.Error()
+			}
+		}
+		if body.Locations == nil {
+			body.Locations = []Location{}
+		}
+		writeJSON(w, body)
+	})
+}
+
+// Info summarises the cluster layout.
+func (c *Cluster) Info() Info {
+	info := Info{Node: c.Self(), Nodes: c.Nodes(), Affinity: c.Affinity()}
+	if c != nil {
+		info.Sticky, info.Redirect, info.Replicate = c.sticky, c.redirect, c.replicate
+	}
+	if info.Nodes == nil {
+		info.Nodes = []Node{}
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func directory(rooms map[string][]string) Directory {
+	return func(user string) []string { return rooms[user] }
+}
+
+func TestLocateAcrossPeers(t *testing.T) {
+	var peer *Cluster
+	peerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer.Handler(directory(map[string][]string{"alice": {"dev"}})).ServeHTTP(w, r)
+	}))
+	defer peerServer.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	nodes := []Node{
+		{ID: "a", Addr: "chat-a:2222"},
+		{ID: "b", Addr: "chat-b:2222", Admin: peerServer.URL + "/"},
+		{ID: "c", Addr: "chat-c:2222", Admin: down.URL},
+		{ID: "d", Addr: "chat-d:2222"},
+	}
+	var err error
+	peer, err = New("b", nodes)
+	require.NoError(t, err)
+	self, err := New("a", nodes)
+	require.NoError(t, err)
+
+	locations, err := self.Locate(context.Background(), directory(map[string][]string{"alice": {"lobby"}}), "alice")
+	require.ErrorContains(t, err, "c: unexpected status 500")
+	require.Equal(t, []Location{
+		{Node: "a", User: "alice", Room: "lobby"},
+		{Node: "b", User: "alice", Room: "dev"},
+	}, locations)
+
+	locations, err = self.Locate(context.Background(), directory(nil), "bob")
+	require.Error(t, err)
+	require.Empty(t, locations)
+
+	var standalone *Cluster
+	locations, err = standalone.Locate(context.Background(), directory(map[string][]string{"alice": {"lobby"}}), "alice")
+	require.NoError(t, err)
+	require.Equal(t, []Location{{User: "alice", Room: "lobby"}}, locations)
+}
+
+func TestHandler(t *testing.T) {
+	c, err := New("a", []Node{{ID: "a", Addr: "chat-a:2222"}, {ID: "b", Addr: "chat-b:2222"}},
+		WithAffinity(map[string]string{"dev": "b"}), WithSticky(true))
+	require.NoError(t, err)
+	handler := c.Handler(directory(map[string][]string{"alice": {"lobby", "ops"}}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cluster", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var info Info
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&info))
+	require.Equal(t, "a", info.Node.ID)
+	require.Len(t, info.Nodes, 2)
+	require.Equal(t, map[string]string{"dev": "b"}, info.Affinity)
+	require.True(t, info.Sticky)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cluster?user=alice", nil))
+	require.JSONEq(t, `{"locations":[{"node":"a","user":"alice","room":"lobby"},{"node":"a","user":"alice","room":"ops"}]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cluster?user=bob&local=1", nil))
+	require.JSONEq(t, `{"locations":[]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/cluster", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestPing(t *testing.T) {
+	var peer *Cluster
+	peerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer.Handler(directory(nil)).ServeHTTP(w, r)
+	}))
+	defer peerServer.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	nodes := []Node{
+		{ID: "a", Addr: "chat-a:2222"},
+		{ID: "b", Addr: "chat-b:2222", Admin: peerServer.URL},
+		{ID: "c", Addr: "chat-c:2222", Admin: down.URL},
+		{ID: "d", Addr: "chat-d:2222"},
+	}
+	var err error
+	peer, err = New("b", nodes)
+	require.NoError(t, err)
+	self, err := New("a", nodes)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, node := range self.Peers() {
+		ids = append(ids, node.ID)
+	}
+	require.Equal(t, []string{"b", "c"}, ids)
+
+	latency, err := self.Ping(context.Background(), "b")
+	require.NoError(t, err)
+	require.Positive(t, latency)
+
+	_, err = self.Ping(context.Background(), "c")
+	require.ErrorContains(t, err, "cluster: ping c: unexpected status 500")
+	_, err = self.Ping(context.Background(), "d")
+	require.ErrorContains(t, err, "no admin URL")
+	_, err = self.Ping(context.Background(), "z")
+	require.ErrorIs(t, err, ErrUnknownNode)
+}
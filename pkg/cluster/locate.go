@@ -0,0 +1,143 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// probeUser is the user Ping asks peers about; only the round trip matters.
+const probeUser = "schat-probe"
+
+// Location is a room a user is connected to on a node.
+type Location struct {
+	Node string `json:"node"`
+	User string `json:"user"`
+	Room string `json:"room"`
+}
+
+// Directory lists the rooms username is in on this node.
+type Directory func(username string) []string
+
+// Locate finds username on this node and on every peer with an admin API.
+// Peers that cannot be reached are reported in the error while the locations
+// that were found are still returned.
+func (c *Cluster) Locate(ctx context.Context, dir Directory, username string) ([]Location, error) {
+	locations := c.local(dir, username)
+	if c == nil {
+		return locations, nil
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	for _, node := range c.Peers() {
+		wg.Add(1)
+		go func(node Node) {
+			defer wg.Done()
+			found, err := c.queryPeer(ctx, node, username)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", node.ID, err))
+				return
+			}
+			locations = append(locations, found...)
+		}(node)
+	}
+	wg.Wait()
+
+	sortLocations(locations)
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return locations, fmt.Errorf("cluster: unreachable peers: %v", errs)
+	}
+	return locations, nil
+}
+
+// local lists username's rooms on this node.
+func (c *Cluster) local(dir Directory, username string) []Location {
+	if dir == nil {
+		return nil
+	}
+	var locations []Location
+	for _, room := range dir(username) {
+		locations = append(locations, Location{Node: c.Self().ID, User: username, Room: room})
+	}
+	return locations
+}
+
+// Ping sends the same peer query Locate makes to the node with the given ID
+// and reports how long the answer took, so probes exercise the link, its
+// mutual TLS, and the peer's handler.
+func (c *Cluster) Ping(ctx context.Context, id string) (time.Duration, error) {
+	if c == nil {
+		return 0, fmt.Errorf("%w %q", ErrUnknownNode, id)
+	}
+	node, ok := c.byID[id]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownNode, id)
+	}
+	if node.Admin == "" {
+		return 0, fmt.Errorf("cluster: node %q has no admin URL", id)
+	}
+	start := time.Now()
+	if _, err := c.queryPeer(ctx, node, probeUser); err != nil {
+		return 0, fmt.Errorf("cluster: ping %s: %w", id, err)
+	}
+	return time.Since(start), nil
+}
+
+// Peers returns the other nodes that have an admin API, ordered by ID.
+func (c *Cluster) Peers() []Node {
+	if c == nil {
+		return nil
+	}
+	var peers []Node
+	for _, node := range c.nodes {
+		if node.ID != c.self.ID && node.Admin != "" {
+			peers = append(peers, node)
+		}
+	}
+	return peers
+}
+
+func (c *Cluster) queryPeer(ctx context.Context, node Node, username string) ([]Location, error) {
+	query := url.Values{"user": {username}, "local": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, node.Admin+handlerPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var body struct {
+		Locations []Location `json:"locations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Locations, nil
+}
+
+func sortLocations(locations []Location) {
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].Node != locations[j].Node {
+			return locations[i].Node < locations[j].Node
+		}
+		return locations[i].Room < locations[j].Room
+	})
+}
@@ -0,0 +1,261 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+// eventsPath is where EventsHandler is expected to be mounted on every node.
+const eventsPath = handlerPath + "/events"
+
+const (
+	// replicationQueueSize bounds the events waiting for each peer; newer
+	// events are dropped while it is full.
+	replicationQueueSize = 1024
+	// replicationBatchSize bounds the events sent to a peer in one request.
+	replicationBatchSize = 100
+	// replicationAttempts is how often a batch is tried before it is dropped.
+	replicationAttempts = 5
+	// maxEventsBody bounds the request bodies EventsHandler reads.
+	maxEventsBody = 4 << 20
+)
+
+// replicationBackoff spaces the attempts to deliver a batch.
+var replicationBackoff = bridge.Backoff{Initial: 500 * time.Millisecond, Max: 10 * time.Second, Multiplier: 2, Jitter: 0.2}
+
+// Event is a room message replicated from the node it was posted on to the
+// others.
+type Event struct {
+	// Node is the ID of the node the message was posted on.
+	Node string    `json:"node"`
+	Room string    `json:"room"`
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	Text string    `json:"text"`
+	// Action marks /me emotes.
+	Action bool `json:"action,omitempty"`
+}
+
+// PeerStatus reports replication to one peer.
+type PeerStatus struct {
+	Node      string `json:"node"`
+	Sent      int    `json:"sent"`
+	Queued    int    `json:"queued"`
+	Dropped   int    `json:"dropped"`
+	Failed    int    `json:"failed"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Sink delivers an event received from a peer to this node's rooms.
+type Sink func(Event) error
+
+// replica is the outbound queue of one peer.
+type replica struct {
+	node   Node
+	events chan Event
+
+	mu     sync.Mutex
+	status PeerStatus
+}
+
+func (r *replica) update(fn func(*PeerStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(&r.status)
+}
+
+// WithReplication makes every node post the messages of its rooms to every
+// peer with an admin URL, so users connected to different nodes share one
+// conversation. Start delivery with Run and mount EventsHandler.
+func WithReplication(on bool) Option {
+	return func(c *Cluster) {
+		c.replicate = on
+	}
+}
+
+// Replicating reports whether room messages are replicated to peers.
+func (c *Cluster) Replicating() bool {
+	return c != nil && c.replicate
+}
+
+// Replicate queues ev for every peer without blocking, stamped with this
+// node's ID. Events for rooms pinned to a node are not replicated, and
+// neither is anything while replication is off.
+func (c *Cluster) Replicate(ev Event) {
+	if !c.Replicating() {
+		return
+	}
+	if _, pinned := c.RoomNode(ev.Room); pinned {
+		return
+	}
+	ev.Node = c.self.ID
+	for _, r := range c.replicas {
+		select {
+		case r.events <- ev:
+		default:
+			r.update(func(st *PeerStatus) { st.Dropped++ })
+		}
+	}
+}
+
+// Run delivers replicated events to the peers until ctx is cancelled.
+func (c *Cluster) Run(ctx context.Context) {
+	if !c.Replicating() {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, r := range c.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			c.sendEvents(ctx, r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// ReplicationStatus reports replication to each peer, ordered by ID.
+func (c *Cluster) ReplicationStatus() []PeerStatus {
+	if !c.Replicating() {
+		return nil
+	}
+	out := make([]PeerStatus, 0, len(c.replicas))
+	for _, r := range c.replicas {
+		r.mu.Lock()
+		st := r.status
+		r.mu.Unlock()
+		st.Queued = len(r.events)
+		out = append(out, st)
+	}
+	return out
+}
+
+// sendEvents posts the events queued for r in batches, in order.
+func (c *Cluster) sendEvents(ctx context.Context, r *replica) {
+	for {
+		var batch []Event
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-r.events:
+			batch = append(batch, ev)
+		}
+	fill:
+		for len(batch) < replicationBatchSize {
+			select {
+			case ev := <-r.events:
+				batch = append(batch, ev)
+			default:
+				break fill
+			}
+		}
+		c.deliver(ctx, r, batch)
+	}
+}
+
+// deliver posts batch to r, retrying with backoff, and drops it after
+// replicationAttempts failures.
+func (c *Cluster) deliver(ctx context.Context, r *replica, batch []Event) {
+	var err error
+	for attempt := 1; attempt <= replicationAttempts; attempt++ {
+		if err = c.postEvents(ctx, r.node, batch); err == nil {
+			r.update(func(st *PeerStatus) { st.Sent += len(batch) })
+			return
+		}
+		if attempt == replicationAttempts || sleepContext(ctx, replicationBackoff.Delay(attempt)) != nil {
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	c.logger.Warn("cluster: replication failed", "node", r.node.ID, "events", len(batch), "err", err)
+	r.update(func(st *PeerStatus) {
+		st.Failed += len(batch)
+		st.LastError = err.Error()
+	})
+}
+
+func (c *Cluster) postEvents(ctx context.Context, node Node, batch []Event) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, node.Admin+eventsPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// EventsHandler receives the events peers replicate, mounted at
+// /debug/cluster/events, and hands each to sink. With WithTLS it answers
+// only peers with a CA-signed certificate; without it, anyone who can reach
+// the address can post into rooms.
+func (c *Cluster) EventsHandler(sink Sink) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !c.Replicating() {
+			http.Error(w, "cluster: replication is off", http.StatusNotFound)
+			return
+		}
+		if c.tls != nil && !authenticatedPeer(r) {
+			http.Error(w, ErrPeerUnauthenticated.Error(), http.StatusForbidden)
+			return
+		}
+
+		var batch []Event
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventsBody)).Decode(&batch); err != nil {
+			http.Error(w, fmt.Sprintf("invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Accepted int `json:"accepted"`
+			Rejected int `json:"rejected"`
+		}
+		for _, ev := range batch {
+			if _, known := c.byID[ev.Node]; !known || ev.Node == c.self.ID {
+				body.Rejected++
+				continue
+			}
+			if err := sink(ev); err != nil {
+				c.logger.Debug("cluster: replicated event rejected", "node", ev.Node, "room", ev.Room, "err", err)
+				body.Rejected++
+				continue
+			}
+			body.Accepted++
+		}
+		writeJSON(w, body)
+	})
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,99 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicationOverMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	aDir, bDir := t.TempDir(), t.TempDir()
+	ca.writeNode(t, aDir, "a")
+	ca.writeNode(t, bDir, "b")
+	aTLS, bTLS := loadTestTLS(t, aDir), loadTestTLS(t, bDir)
+
+	received := make(chan Event, 10)
+	var peer *Cluster
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer.EventsHandler(func(ev Event) error {
+			if ev.Room == "closed" {
+				return errors.New("no such room")
+			}
+			received <- ev
+			return nil
+		}).ServeHTTP(w, r)
+	}))
+	server.TLS = bTLS.ServerConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	nodes := []Node{{ID: "a", Addr: "chat-a:2222"}, {ID: "b", Addr: "chat-b:2222", Admin: server.URL}}
+	var err error
+	peer, err = New("b", nodes, WithTLS(bTLS), WithReplication(true))
+	require.NoError(t, err)
+	self, err := New("a", nodes, WithTLS(aTLS), WithReplication(true), WithAffinity(map[string]string{"ops": "a"}))
+	require.NoError(t, err)
+	require.True(t, self.Info().Replicate)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go self.Run(ctx)
+
+	now := time.Now().UTC()
+	self.Replicate(Event{Node: "spoofed", Room: "ops", Time: now, User: "alice", Text: "pinned rooms live on one node"})
+	self.Replicate(Event{Room: "closed", Time: now, User: "alice", Text: "dropped by the sink"})
+	self.Replicate(Event{Room: "dev", Time: now, User: "alice", Text: "hello"})
+	self.Replicate(Event{Room: "dev", Time: now, User: "alice", Text: "waves", Action: true})
+
+	require.Equal(t, Event{Node: "a", Room: "dev", Time: now, User: "alice", Text: "hello"}, <-received)
+	require.Equal(t, Event{Node: "a", Room: "dev", Time: now, User: "alice", Text: "waves", Action: true}, <-received)
+	require.Eventually(t, func() bool {
+		st := self.ReplicationStatus()
+		return len(st) == 1 && st[0].Sent == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "b", self.ReplicationStatus()[0].Node)
+
+	post := func(client *http.Client, body string) int {
+		resp, err := client.Post(server.URL+eventsPath, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	anonymous := aTLS.ClientConfig()
+	anonymous.GetClientCertificate = nil
+	require.Equal(t, http.StatusForbidden, post(&http.Client{Transport: &http.Transport{TLSClientConfig: anonymous}}, `[]`))
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: aTLS.ClientConfig()}}
+	require.Equal(t, http.StatusOK, post(client, `[{"node":"z","room":"dev","text":"unknown node"},{"node":"b","room":"dev","text":"its own"}]`))
+	require.Equal(t, http.StatusBadRequest, post(client, `{`))
+	require.Empty(t, received)
+}
+
+func TestReplicateDropsWhenQueueIsFull(t *testing.T) {
+	nodes := []Node{{ID: "a"}, {ID: "b", Admin: "http://127.0.0.1:1"}, {ID: "c"}}
+	c, err := New("a", nodes, WithReplication(true))
+	require.NoError(t, err)
+	for i := 0; i < replicationQueueSize+2; i++ {
+		c.Replicate(Event{Room: "dev", Text: "hi"})
+	}
+	require.Equal(t, []PeerStatus{{Node: "b", Queued: replicationQueueSize, Dropped: 2}}, c.ReplicationStatus(), "nodes without an admin URL get nothing")
+
+	off, err := New("a", nodes)
+	require.NoError(t, err)
+	off.Replicate(Event{Room: "dev", Text: "hi"})
+	require.Nil(t, off.ReplicationStatus())
+
+	var standalone *Cluster
+	standalone.Replicate(Event{Room: "dev", Text: "hi"})
+	require.False(t, standalone.Replicating())
+	resp := httptest.NewRecorder()
+	off.EventsHandler(func(Event) error { return nil }).ServeHTTP(resp, httptest.NewRequest(http.MethodPost, eventsPath, strings.NewReader(`[]`)))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
@@ -0,0 +1,191 @@
+package cluster
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates for 127.0.0.1.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "schat cluster CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// writeNode writes a node certificate, its key, and the CA bundle into dir.
+func (ca *testCA) writeNode(t *testing.T, dir, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), ca.pem, 0o600))
+}
+
+func loadTestTLS(t *testing.T, dir string) *TLS {
+	t.Helper()
+	tlsFiles, err := LoadTLS(filepath.Join(dir, "node.crt"), filepath.Join(dir, "node.key"), filepath.Join(dir, "ca.crt"))
+	require.NoError(t, err)
+	return tlsFiles
+}
+
+func TestLocateOverMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	aDir, bDir := t.TempDir(), t.TempDir()
+	ca.writeNode(t, aDir, "a")
+	ca.writeNode(t, bDir, "b")
+	aTLS, bTLS := loadTestTLS(t, aDir), loadTestTLS(t, bDir)
+
+	var peer *Cluster
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer.Handler(directory(map[string][]string{"alice": {"dev"}})).ServeHTTP(w, r)
+	}))
+	server.TLS = bTLS.ServerConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	nodes := []Node{{ID: "a", Addr: "chat-a:2222"}, {ID: "b", Addr: "chat-b:2222", Admin: server.URL}}
+	var err error
+	peer, err = New("b", nodes, WithTLS(bTLS))
+	require.NoError(t, err)
+	self, err := New("a", nodes, WithTLS(aTLS))
+	require.NoError(t, err)
+
+	locations, err := self.Locate(context.Background(), directory(nil), "alice")
+	require.NoError(t, err)
+	require.Equal(t, []Location{{Node: "b", User: "alice", Room: "dev"}}, locations)
+
+	// A client trusting the CA but presenting no certificate is refused.
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: aTLS.ClientConfig()}}
+	anonymous.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate = nil
+	resp, err := anonymous.Get(server.URL + handlerPath + "?user=alice&local=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, err = anonymous.Get(server.URL + handlerPath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "administrators may still read the layout")
+
+	// A node with a certificate from another CA is rejected by both sides.
+	rogueDir := t.TempDir()
+	newTestCA(t).writeNode(t, rogueDir, "rogue")
+	rogue, err := New("a", nodes, WithTLS(loadTestTLS(t, rogueDir)))
+	require.NoError(t, err)
+	_, err = rogue.Locate(context.Background(), directory(nil), "alice")
+	require.ErrorContains(t, err, "unreachable peers")
+}
+
+func TestTLSReloadRotatesKeys(t *testing.T) {
+	oldCA, newCA := newTestCA(t), newTestCA(t)
+	aDir, bDir := t.TempDir(), t.TempDir()
+	oldCA.writeNode(t, aDir, "a")
+	oldCA.writeNode(t, bDir, "b")
+	aTLS, bTLS := loadTestTLS(t, aDir), loadTestTLS(t, bDir)
+
+	var peer *Cluster
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer.Handler(directory(map[string][]string{"alice": {"dev"}})).ServeHTTP(w, r)
+	}))
+	server.TLS = bTLS.ServerConfig()
+	server.StartTLS()
+	defer server.Close()
+	nodes := []Node{{ID: "a", Addr: "chat-a:2222"}, {ID: "b", Addr: "chat-b:2222", Admin: server.URL}}
+	var err error
+	peer, err = New("b", nodes, WithTLS(bTLS))
+	require.NoError(t, err)
+
+	newCA.writeNode(t, bDir, "b")
+	require.NoError(t, bTLS.Reload())
+
+	self, err := New("a", nodes, WithTLS(aTLS))
+	require.NoError(t, err)
+	_, err = self.Locate(context.Background(), directory(nil), "alice")
+	require.Error(t, err, "a still trusts only the old CA")
+
+	newCA.writeNode(t, aDir, "a")
+	require.NoError(t, aTLS.Reload())
+	self, err = New("a", nodes, WithTLS(aTLS))
+	require.NoError(t, err)
+	locations, err := self.Locate(context.Background(), directory(nil), "alice")
+	require.NoError(t, err)
+	require.Len(t, locations, 1)
+
+	require.NoError(t, os.WriteFile(filepath.Join(aDir, "ca.crt"), []byte("garbage"), 0o600))
+	require.ErrorContains(t, aTLS.Reload(), "no certificates")
+	locations, err = self.Locate(context.Background(), directory(nil), "alice")
+	require.NoError(t, err, "a failed reload keeps the current keys")
+	require.Len(t, locations, 1)
+}
+
+func TestStrictServerConfigRequiresClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	aDir, bDir := t.TempDir(), t.TempDir()
+	ca.writeNode(t, aDir, "a")
+	ca.writeNode(t, bDir, "b")
+	aTLS, bTLS := loadTestTLS(t, aDir), loadTestTLS(t, bDir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.TLS = bTLS.StrictServerConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: aTLS.ClientConfig()}}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	anonymous := aTLS.ClientConfig()
+	anonymous.GetClientCertificate = nil
+	_, err = (&http.Client{Transport: &http.Transport{TLSClientConfig: anonymous}}).Get(server.URL)
+	require.Error(t, err, "the handshake fails without a client certificate")
+}
@@ -0,0 +1,1024 @@
+// Package config holds server settings and the loaders that produce them.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultHostKey is where the host key is kept when neither host_key nor
+// data_dir says otherwise.
+const DefaultHostKey = "configs/ssh_host_rsa"
+
+// Files kept under DataDir unless their own setting names another path.
+const (
+	DataDirHostKey = "ssh_host_key"
+	DataDirDB      = "schat.db"
+	DataDirArchive = "archive"
+	DataDirAudit   = "audit.log"
+	DataDirBans    = "bans.json"
+)
+
+// Config is the resolved server configuration.
+type Config struct {
+	// Addr is the TCP address the SSH server listens on.
+	Addr string `yaml:"addr" toml:"addr"`
+	// DataDir holds the host key, the database, and room archives by
+	// default, so one directory can be backed up or mounted into a
+	// container. Explicit host_key, db, and archive.dir settings win.
+	DataDir string `yaml:"data_dir" toml:"data_dir"`
+	// HostKey is the path of the SSH host private key, or a secret reference
+	// such as "vault:secret/data/schat#host_key" holding the key itself.
+	HostKey string `yaml:"host_key" toml:"host_key"`
+	// HostKeys are additional existing host keys, as paths or secret
+	// references, served next to HostKey, e.g. the previous key while clients
+	// migrate to a new one.
+	HostKeys []string `yaml:"host_keys" toml:"host_keys"`
+	// HostKeyType is the algorithm used if the host key must be generated.
+	HostKeyType string `yaml:"host_key_type" toml:"host_key_type"`
+	// HostKeyPassphraseEnv names the environment variable, or the secret
+	// reference, holding the passphrase of an encrypted host key.
+	HostKeyPassphraseEnv string `yaml:"host_key_passphrase_env" toml:"host_key_passphrase_env"`
+	// ServerName is shown in the MOTD.
+	ServerName string `yaml:"server_name" toml:"server_name"`
+	// MOTD is a template file for the greeting shown after joining.
+	MOTD string `yaml:"motd" toml:"motd"`
+	// Banner is a text file shown before authentication.
+	Banner string `yaml:"banner" toml:"banner"`
+	// Goodbye is a line shown to users as they quit.
+	Goodbye string `yaml:"goodbye" toml:"goodbye"`
+	// Operators are usernames granted operator commands once a session proves
+	// the name with an account, a password file entry, an OIDC sign-in, or a
+	// key identity.
+	Operators []string `yaml:"operators" toml:"operators"`
+	// Rooms are created at startup in addition to the lobby.
+	Rooms []string `yaml:"rooms" toml:"rooms"`
+	// Announcements are system messages posted on a schedule.
+	Announcements []Announcement `yaml:"announcements" toml:"announcements"`
+	// Features enables feature flags, e.g. "reactions" or "bridges=false".
+	Features []string `yaml:"features" toml:"features"`
+	// MetricsAddr serves expvar metrics when set.
+	MetricsAddr string `yaml:"metrics_addr" toml:"metrics_addr"`
+	// TokenFile stores hashed API tokens when set.
+	TokenFile string `yaml:"token_file" toml:"token_file"`
+	// AuditFile is the append-only log of moderation and administrative
+	// actions; empty keeps them in memory only.
+	AuditFile string `yaml:"audit_file" toml:"audit_file"`
+	// BanFile keeps the bans operators add with /ban so they survive
+	// restarts; empty keeps them in memory only.
+	BanFile string `yaml:"ban_file" toml:"ban_file"`
+	// DB is the SQLite database for message persistence when set.
+	DB string `yaml:"db" toml:"db"`
+	// DBRetention prunes messages in DB older than this; zero keeps them.
+	DBRetention time.Duration `yaml:"db_retention" toml:"db_retention"`
+	// DBKeyEnv names the environment variable, or the secret reference,
+	// holding the secret that messages in DB and room archives are encrypted
+	// with; empty stores them in plaintext.
+	DBKeyEnv string `yaml:"db_key_env" toml:"db_key_env"`
+	// ProxyProtocol lists the addresses or CIDR ranges of load balancers
+	// that send a PROXY protocol header naming the real client; empty reads
+	// no headers.
+	ProxyProtocol []string `yaml:"proxy_protocol" toml:"proxy_protocol"`
+	// DrainTimeout bounds how long a server that handed its ports to a new
+	// process on a hot restart keeps serving its sessions; zero waits until
+	// they all end.
+	DrainTimeout time.Duration `yaml:"drain_timeout" toml:"drain_timeout"`
+
+	Auth    Auth    `yaml:"auth" toml:"auth"`
+	Limits  Limits  `yaml:"limits" toml:"limits"`
+	Archive Archive `yaml:"archive" toml:"archive"`
+	Log     Log     `yaml:"log" toml:"log"`
+	Cluster Cluster `yaml:"cluster" toml:"cluster"`
+
+	Keys       Keys       `yaml:"keys" toml:"keys"`
+	StatusBar  StatusBar  `yaml:"status_bar" toml:"status_bar"`
+	Translate  Translate  `yaml:"translate" toml:"translate"`
+	WordFilter WordFilter `yaml:"word_filter" toml:"word_filter"`
+	AutoMod    AutoMod    `yaml:"automod" toml:"automod"`
+	Files      Files      `yaml:"files" toml:"files"`
+	Probes     Probes     `yaml:"probes" toml:"probes"`
+	Webhooks   Webhooks   `yaml:"webhooks" toml:"webhooks"`
+	AdminAPI   AdminAPI   `yaml:"admin_api" toml:"admin_api"`
+	ControlAPI ControlAPI `yaml:"control_api" toml:"control_api"`
+	WebGateway WebGateway `yaml:"web_gateway" toml:"web_gateway"`
+	Telnet     Telnet     `yaml:"telnet" toml:"telnet"`
+	// RoomBackend picks where rooms keep the state servers share.
+	RoomBackend RoomBackend `yaml:"room_backend" toml:"room_backend"`
+	Bridges     Bridges     `yaml:"bridges" toml:"bridges"`
+	Hardening   Hardening   `yaml:"hardening" toml:"hardening"`
+	Secrets     Secrets     `yaml:"secrets" toml:"secrets"`
+	Security    Security    `yaml:"security" toml:"security"`
+	FailBan     FailBan     `yaml:"fail_ban" toml:"fail_ban"`
+
+	// Profile selects a tuning preset; see Profiles.
+	Profile string `yaml:"profile" toml:"profile"`
+	// Tuning overrides individual preset values when non-zero.
+	Tuning Tuning `yaml:"tuning" toml:"tuning"`
+}
+
+// Auth configures how SSH connections authenticate.
+type Auth struct {
+	// Modes lists providers: none, password, pubkey, oidc.
+	Modes          []string `yaml:"modes" toml:"modes"`
+	PasswordFile   string   `yaml:"password_file" toml:"password_file"`
+	AuthorizedKeys string   `yaml:"authorized_keys" toml:"authorized_keys"`
+	OIDCIssuer     string   `yaml:"oidc_issuer" toml:"oidc_issuer"`
+	OIDCClientID   string   `yaml:"oidc_client_id" toml:"oidc_client_id"`
+	// AdminKeys is an authorized_keys file whose keys may run one-shot admin
+	// commands over exec as AdminUser; empty disables it.
+	AdminKeys string `yaml:"admin_keys" toml:"admin_keys"`
+	AdminUser string `yaml:"admin_user" toml:"admin_user"`
+	// AccountsFile stores the accounts users create with /register; empty
+	// disables registration.
+	AccountsFile string `yaml:"accounts_file" toml:"accounts_file"`
+	// IdentitiesFile maps public keys to stable usernames; empty disables it.
+	// It needs the pubkey mode.
+	IdentitiesFile string `yaml:"identities_file" toml:"identities_file"`
+}
+
+// Limits bounds connections and slow or idle clients.
+type Limits struct {
+	// MaxClients caps concurrent connections; 0 is unlimited.
+	MaxClients int `yaml:"max_clients" toml:"max_clients"`
+	// MaxPerIP caps concurrent connections per source IP; 0 is unlimited.
+	MaxPerIP int `yaml:"max_per_ip" toml:"max_per_ip"`
+	// AutoAway marks users away after this much inactivity; 0 disables it.
+	AutoAway time.Duration `yaml:"auto_away" toml:"auto_away"`
+	// Backpressure is the slow client policy name.
+	Backpressure string `yaml:"backpressure" toml:"backpressure"`
+	// BackpressureTimeout is how long the block policy waits for queue space.
+	BackpressureTimeout time.Duration `yaml:"backpressure_timeout" toml:"backpressure_timeout"`
+	// RoomBackpressure maps room names to a policy name that replaces
+	// Backpressure in those rooms.
+	RoomBackpressure map[string]string `yaml:"room_backpressure" toml:"room_backpressure"`
+	// MaxMessageLength cuts message bodies to this many characters; 0 is
+	// unlimited.
+	MaxMessageLength int `yaml:"max_message_length" toml:"max_message_length"`
+}
+
+// Archive configures what happens to the history of deleted rooms, and when
+// idle rooms are archived in place.
+type Archive struct {
+	Dir       string        `yaml:"dir" toml:"dir"`
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+	// Inactive makes rooms nobody joined or wrote in for this long read-only
+	// and hides them from /rooms; zero never archives them.
+	Inactive time.Duration `yaml:"inactive" toml:"inactive"`
+}
+
+// Log configures server logging.
+type Log struct {
+	// File appends logs to a file instead of stdout when set.
+	File string `yaml:"file" toml:"file"`
+	// Level is the minimum level logged: debug, info, warn, or error.
+	Level string `yaml:"level" toml:"level"`
+	// Format selects text or json output.
+	Format string `yaml:"format" toml:"format"`
+	// RoomLevel is the minimum level streamed into the operators' #server-log
+	// room, or "off" for no such room.
+	RoomLevel string `yaml:"room_level" toml:"room_level"`
+}
+
+// Log formats accepted by Log.Format.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogRoomOff is the RoomLevel that leaves out #server-log.
+const LogRoomOff = "off"
+
+// SlogLevel parses Level.
+func (l Log) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return 0, fmt.Errorf("log level %q (want debug, info, warn, or error)", l.Level)
+	}
+	return level, nil
+}
+
+// RoomSlogLevel parses RoomLevel, reporting false when the room is off.
+func (l Log) RoomSlogLevel() (slog.Level, bool, error) {
+	if l.RoomLevel == LogRoomOff {
+		return 0, false, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.RoomLevel)); err != nil {
+		return 0, false, fmt.Errorf("log room level %q (want debug, info, warn, error, or off)", l.RoomLevel)
+	}
+	return level, true, nil
+}
+
+// Cluster places the server in a multi-node deployment behind a load balancer.
+type Cluster struct {
+	// Node is this server's ID among Nodes; empty runs standalone.
+	Node  string        `yaml:"node" toml:"node"`
+	Nodes []ClusterNode `yaml:"nodes" toml:"nodes"`
+	// Affinity pins rooms to node IDs.
+	Affinity map[string]string `yaml:"affinity" toml:"affinity"`
+	// Sticky gives each user a home node by hashing their username.
+	Sticky bool `yaml:"sticky" toml:"sticky"`
+	// Redirect suggests the right node in the pre-authentication banner.
+	Redirect bool `yaml:"redirect" toml:"redirect"`
+	// Replicate posts the messages of rooms not pinned to a node to every
+	// other node, so users on different nodes share the conversation.
+	Replicate bool `yaml:"replicate" toml:"replicate"`
+	// TLS secures the admin API between nodes with mutual TLS.
+	TLS ClusterTLS `yaml:"tls" toml:"tls"`
+}
+
+// ClusterTLS names the PEM files for mutual TLS between nodes. Every node's
+// certificate must be signed by CA and valid for the host in its admin URL.
+// Replace the files and reload the configuration to rotate them.
+type ClusterTLS struct {
+	Cert string `yaml:"cert" toml:"cert"`
+	Key  string `yaml:"key" toml:"key"`
+	CA   string `yaml:"ca" toml:"ca"`
+}
+
+// Enabled reports whether any TLS file is set.
+func (t ClusterTLS) Enabled() bool {
+	return t.Cert != "" || t.Key != "" || t.CA != ""
+}
+
+// validate reports problems with the cluster settings.
+func (c Cluster) validate() []error {
+	var errs []error
+	if c.Replicate {
+		if !c.TLS.Enabled() {
+			errs = append(errs, errors.New("cluster replicate needs cluster tls so nodes can tell peers from impostors"))
+		}
+		for _, n := range c.Nodes {
+			if n.Admin == "" {
+				errs = append(errs, fmt.Errorf("cluster node %q needs an admin URL when cluster replicate is set", n.ID))
+			}
+		}
+	}
+	if !c.TLS.Enabled() {
+		return errs
+	}
+	if c.TLS.Cert == "" || c.TLS.Key == "" || c.TLS.CA == "" {
+		errs = append(errs, errors.New("cluster tls needs cert, key, and ca"))
+	}
+	for _, n := range c.Nodes {
+		if n.Admin != "" && !strings.HasPrefix(n.Admin, "https://") {
+			errs = append(errs, fmt.Errorf("cluster node %q admin %q must be an https URL when cluster tls is set", n.ID, n.Admin))
+		}
+	}
+	return errs
+}
+
+// ClusterNode describes one node of the cluster.
+type ClusterNode struct {
+	ID string `yaml:"id" toml:"id"`
+	// Addr is the SSH address users connect to.
+	Addr string `yaml:"addr" toml:"addr"`
+	// Admin is the base URL of the node's metrics and admin server.
+	Admin string `yaml:"admin" toml:"admin"`
+}
+
+// Keys sets the key bindings sessions start with and limits what users may
+// remap with /keys.
+type Keys struct {
+	// Bindings replaces default bindings, mapping an action such as "room" to
+	// space-separated keys such as "ctrl+x".
+	Bindings map[string]string `yaml:"bindings" toml:"bindings"`
+	// Locked lists actions users may not remap, e.g. "quit".
+	Locked []string `yaml:"locked" toml:"locked"`
+	// Interrupt is what the cancel key does: double, quit, or clear.
+	Interrupt string `yaml:"interrupt" toml:"interrupt"`
+}
+
+// StatusBar lays out the status line. Each segment is a template with fields
+// such as {{.Room}}, {{.Topic}}, {{.Users}}, {{.UnreadDMs}}, {{.Clock}}, and
+// {{.Latency}}; an unset side keeps its default.
+type StatusBar struct {
+	// Left segments start at the first column.
+	Left []string `yaml:"left" toml:"left"`
+	// Right segments end at the last column, and are dropped after the left
+	// ones when the terminal is too narrow.
+	Right []string `yaml:"right" toml:"right"`
+}
+
+// Translate configures the machine translation behind /translate.
+type Translate struct {
+	// URL is a LibreTranslate server; empty disables /translate.
+	URL string `yaml:"url" toml:"url"`
+	// APIKeyEnv names the environment variable, or the secret reference,
+	// holding the server's API key.
+	APIKeyEnv string `yaml:"api_key_env" toml:"api_key_env"`
+	// RatePerMinute caps requests to the server across all users.
+	RatePerMinute int `yaml:"rate_per_minute" toml:"rate_per_minute"`
+	// CacheSize is how many translations are kept in memory.
+	CacheSize int `yaml:"cache_size" toml:"cache_size"`
+}
+
+// WordFilter masks or blocks listed words in chat messages. It applies in
+// rooms where the word-filter feature flag is on, which it turns on by default.
+type WordFilter struct {
+	// File lists one word per line; "#" starts a comment. Operators re-read
+	// it with /wordfilter reload.
+	File string `yaml:"file" toml:"file"`
+	// Words are filtered in addition to those in File.
+	Words []string `yaml:"words" toml:"words"`
+	// Action is mask or block.
+	Action string `yaml:"action" toml:"action"`
+}
+
+// Enabled reports whether any words are configured.
+func (w WordFilter) Enabled() bool {
+	return w.File != "" || len(w.Words) > 0
+}
+
+// AutoMod tunes automatic moderation of spam and flooding. It applies in rooms
+// where the automod feature flag is on, which Enabled turns on by default. A
+// zero count or ratio turns its rule off.
+type AutoMod struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Repeats identical messages within RepeatWindow are spam.
+	Repeats      int           `yaml:"repeats" toml:"repeats"`
+	RepeatWindow time.Duration `yaml:"repeat_window" toml:"repeat_window"`
+	// A message with at least CapsMinLetters letters, more than CapsRatio of
+	// them capitals, is shouting.
+	CapsRatio      float64 `yaml:"caps_ratio" toml:"caps_ratio"`
+	CapsMinLetters int     `yaml:"caps_min_letters" toml:"caps_min_letters"`
+	// More than Links links within LinkWindow are link spam.
+	Links      int           `yaml:"links" toml:"links"`
+	LinkWindow time.Duration `yaml:"link_window" toml:"link_window"`
+	// Joins joins and leaves within JoinWindow are flooding.
+	Joins      int           `yaml:"joins" toml:"joins"`
+	JoinWindow time.Duration `yaml:"join_window" toml:"join_window"`
+	// Actions answer a user's first, second, ... offence: warn, mute, kick,
+	// or ban. Later offences repeat the last.
+	Actions []string      `yaml:"actions" toml:"actions"`
+	MuteFor time.Duration `yaml:"mute_for" toml:"mute_for"`
+	BanFor  time.Duration `yaml:"ban_for" toml:"ban_for"`
+	// StrikeWindow is how long an offence counts against the user.
+	StrikeWindow time.Duration `yaml:"strike_window" toml:"strike_window"`
+}
+
+// Announcement is a system message posted on a cron-like schedule.
+type Announcement struct {
+	// Schedule has five fields (minute hour day month weekday), e.g.
+	// "0 9 * * 1-5", or is a descriptor such as "@daily" or "@every 2h".
+	Schedule string `yaml:"schedule" toml:"schedule"`
+	// Room is where it is posted; empty posts in every room.
+	Room string `yaml:"room" toml:"room"`
+	Text string `yaml:"text" toml:"text"`
+}
+
+// Files configures the file sharing behind /upload and /download.
+type Files struct {
+	// MaxBytes caps each file; 0 disables file sharing.
+	MaxBytes int64 `yaml:"max_bytes" toml:"max_bytes"`
+	// TotalBytes caps all shared files together. They are kept in memory.
+	TotalBytes int64 `yaml:"total_bytes" toml:"total_bytes"`
+	// TTL is how long a file stays available.
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// Probes configures the canary messages sent through every room's delivery
+// pipeline and the queries to cluster peers that check them end to end.
+type Probes struct {
+	// Interval is how often every target is probed; 0 disables probes.
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+	// Timeout is how long a probe may take before operators are alerted.
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// Webhooks connects rooms to HTTP integrations such as CI bots and alerting.
+type Webhooks struct {
+	// Addr serves the inbound endpoint at /webhook when set.
+	Addr string `yaml:"addr" toml:"addr"`
+	// SecretEnv names the environment variable, or the secret reference,
+	// holding the shared secret that inbound requests and outbound deliveries
+	// are signed with.
+	SecretEnv string `yaml:"secret_env" toml:"secret_env"`
+	// Outbound lists URLs that receive every room broadcast.
+	Outbound []string `yaml:"outbound" toml:"outbound"`
+	// Prompts lists the systems that may post prompts at /webhook/prompt for
+	// users to answer with /approve and /deny.
+	Prompts []PromptSystem `yaml:"prompts" toml:"prompts"`
+}
+
+// AdminAPI serves health probes and an HTTP API for operators.
+type AdminAPI struct {
+	// Addr serves /healthz, /readyz, and the /api endpoints when set.
+	Addr string `yaml:"addr" toml:"addr"`
+	// TokenEnv names the environment variable, or the secret reference,
+	// holding the bearer token the /api endpoints require. It also guards
+	// changes through /debug/features and /debug/upgrade on MetricsAddr.
+	TokenEnv string `yaml:"token_env" toml:"token_env"`
+}
+
+// ControlAPI serves the gRPC control API over mutual TLS. Clients need a
+// certificate signed by TLS.CA; its common name is who their kicks and
+// announcements are attributed to.
+type ControlAPI struct {
+	// Addr serves the control API when set.
+	Addr string `yaml:"addr" toml:"addr"`
+	// TLS names the server's certificate and key and the CA that signs
+	// client certificates. Replace the files and reload to rotate them.
+	TLS ClusterTLS `yaml:"tls" toml:"tls"`
+}
+
+// WebGateway serves a browser client that joins the rooms over WebSocket.
+// Browsers sign in with API tokens from token_file, or under a name of their
+// choosing when auth modes include none.
+type WebGateway struct {
+	// Addr serves the client and its WebSocket when set.
+	Addr string `yaml:"addr" toml:"addr"`
+	// Origins lists other origins whose pages may open the WebSocket, e.g.
+	// "https://chat.example.com".
+	Origins []string `yaml:"origins" toml:"origins"`
+}
+
+// Telnet serves the chat over plaintext TCP for labs and LANs. Nothing is
+// encrypted and users pick any name, so it needs auth mode none.
+type Telnet struct {
+	// Addr accepts telnet connections when set.
+	Addr string `yaml:"addr" toml:"addr"`
+	// Raw skips telnet negotiation, for clients such as nc.
+	Raw bool `yaml:"raw" toml:"raw"`
+}
+
+// Room backend types.
+const (
+	RoomBackendMemory = "memory"
+	RoomBackendRedis  = "redis"
+	RoomBackendNATS   = "nats"
+)
+
+// RoomBackend picks where rooms keep presence and messages. Rooms in memory
+// live in one process; rooms in Redis or NATS JetStream are shared by every
+// server using it.
+type RoomBackend struct {
+	// Type is "memory", "redis", or "nats".
+	Type string `yaml:"type" toml:"type"`
+	// Server names this server among those sharing the backend; empty uses
+	// cluster.node, then the host name.
+	Server string `yaml:"server" toml:"server"`
+	Redis  Redis  `yaml:"redis" toml:"redis"`
+	NATS   NATS   `yaml:"nats" toml:"nats"`
+}
+
+// Redis is how to reach a Redis server.
+type Redis struct {
+	Addr string `yaml:"addr" toml:"addr"`
+	// PasswordEnv names the environment variable, or the secret reference,
+	// holding the password; an empty value connects without one.
+	PasswordEnv string `yaml:"password_env" toml:"password_env"`
+	DB          int    `yaml:"db" toml:"db"`
+	// Prefix starts every key and channel name.
+	Prefix string `yaml:"prefix" toml:"prefix"`
+	TLS    bool   `yaml:"tls" toml:"tls"`
+}
+
+// NATS is how to reach a NATS server with JetStream enabled, and the stream
+// that keeps room messages.
+type NATS struct {
+	// URL lists the servers to connect to, comma separated; tls:// URLs
+	// connect over TLS.
+	URL string `yaml:"url" toml:"url"`
+	// TokenEnv names the environment variable, or the secret reference,
+	// holding an authentication token; an empty value connects without one.
+	TokenEnv string `yaml:"token_env" toml:"token_env"`
+	// Credentials is a .creds file holding a user JWT and seed.
+	Credentials string `yaml:"credentials" toml:"credentials"`
+	// Stream names the JetStream stream; it is created when missing.
+	Stream string `yaml:"stream" toml:"stream"`
+	// Prefix starts every subject and the presence bucket's name.
+	Prefix string `yaml:"prefix" toml:"prefix"`
+	// Retention is how long a stream created by the server keeps messages
+	// for replay.
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+}
+
+func (n NATS) validate() []error {
+	var errs []error
+	if n.URL == "" {
+		errs = append(errs, errors.New("room_backend nats needs nats url"))
+	}
+	for _, f := range []struct{ name, value string }{{"stream", n.Stream}, {"prefix", n.Prefix}} {
+		if !natsName(f.value) {
+			errs = append(errs, fmt.Errorf("room_backend nats %s %q may only use letters, digits, '-' and '_'", f.name, f.value))
+		}
+	}
+	if n.Retention < 0 {
+		errs = append(errs, errors.New("room_backend nats retention must not be negative"))
+	}
+	return errs
+}
+
+// natsName reports whether s can name a stream and stand in a subject.
+func natsName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// PromptSystem is an external system, such as a deploy pipeline, that asks
+// a room for approval.
+type PromptSystem struct {
+	// Name identifies the system in its prompts and the replies.
+	Name string `yaml:"name" toml:"name"`
+	// Rooms are the rooms it may prompt.
+	Rooms []string `yaml:"rooms" toml:"rooms"`
+	// Callback receives the signed answers.
+	Callback string `yaml:"callback" toml:"callback"`
+	// Approvers may answer, when signed in with a password or key; empty
+	// lets anyone in the room answer.
+	Approvers []string `yaml:"approvers" toml:"approvers"`
+}
+
+// Enabled reports whether either direction is configured.
+func (w Webhooks) Enabled() bool {
+	return w.Addr != "" || len(w.Outbound) > 0
+}
+
+func (w Webhooks) validate() []error {
+	var errs []error
+	for _, target := range w.Outbound {
+		if !isHTTPURL(target) {
+			errs = append(errs, fmt.Errorf("webhooks outbound %q is not an http(s) URL", target))
+		}
+	}
+	if len(w.Prompts) > 0 && w.Addr == "" {
+		errs = append(errs, errors.New("webhooks prompts need webhooks addr to receive them"))
+	}
+	names := make(map[string]bool)
+	for _, p := range w.Prompts {
+		if p.Name == "" || names[p.Name] {
+			errs = append(errs, fmt.Errorf("webhooks prompts name %q must be set and unique", p.Name))
+		}
+		names[p.Name] = true
+		if len(p.Rooms) == 0 {
+			errs = append(errs, fmt.Errorf("webhooks prompts %q must list at least one room", p.Name))
+		}
+		if !isHTTPURL(p.Callback) {
+			errs = append(errs, fmt.Errorf("webhooks prompts %q callback %q is not an http(s) URL", p.Name, p.Callback))
+		}
+	}
+	return errs
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Hardening locks the server down once its ports are bound.
+type Hardening struct {
+	// Enabled switches to User, confines file access to DataDir with
+	// Landlock on Linux, and refuses to keep running as root.
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// User is the account, by name or as uid:gid, that a server started as
+	// root switches to.
+	User string `yaml:"user" toml:"user"`
+	// AllowRoot lets a hardened server run as root when User is not set.
+	AllowRoot bool `yaml:"allow_root" toml:"allow_root"`
+}
+
+// Secrets configures where secret references are resolved. Settings that
+// name an environment variable, such as db_key_env, also accept
+// "env:NAME", "file:/path" for a file only its owner can read, and, when
+// Vault is set, "vault:path#field".
+type Secrets struct {
+	Vault Vault `yaml:"vault" toml:"vault"`
+}
+
+// Vault is a HashiCorp Vault compatible server that vault: references are
+// read from.
+type Vault struct {
+	// Addr is the server's base URL, e.g. "https://vault.example.com:8200";
+	// empty disables vault: references.
+	Addr string `yaml:"addr" toml:"addr"`
+	// Token is a reference to the token the server authenticates with; it
+	// may not itself be a vault: reference.
+	Token string `yaml:"token" toml:"token"`
+	// Namespace selects a Vault Enterprise namespace.
+	Namespace string `yaml:"namespace" toml:"namespace"`
+}
+
+func (s Secrets) validate() []error {
+	if s.Vault.Addr == "" {
+		return nil
+	}
+	var errs []error
+	if u, err := url.Parse(s.Vault.Addr); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("secrets vault addr %q must be an http or https URL", s.Vault.Addr))
+	}
+	if s.Vault.Token == "" || strings.HasPrefix(s.Vault.Token, "vault:") {
+		errs = append(errs, errors.New("secrets vault token must be set and must not be a vault: reference"))
+	}
+	return errs
+}
+
+// Security selects the SSH algorithms the server negotiates.
+type Security struct {
+	// Policy is a preset: modern, intermediate, or legacy.
+	Policy string `yaml:"policy" toml:"policy"`
+	// KeyExchanges, Ciphers, and MACs replace the preset's lists when set.
+	KeyExchanges []string `yaml:"kex" toml:"kex"`
+	Ciphers      []string `yaml:"ciphers" toml:"ciphers"`
+	MACs         []string `yaml:"macs" toml:"macs"`
+	// MinRSABits replaces the preset's smallest accepted RSA client key when
+	// non-zero.
+	MinRSABits int `yaml:"min_rsa_bits" toml:"min_rsa_bits"`
+}
+
+// FailBan temporarily bans addresses whose handshakes or password attempts
+// keep failing.
+type FailBan struct {
+	// MaxFailures failures within Window ban an address; 0 disables it.
+	MaxFailures int           `yaml:"max_failures" toml:"max_failures"`
+	Window      time.Duration `yaml:"window" toml:"window"`
+	// BanFor is the first ban; each further ban of the address doubles it,
+	// up to MaxBan.
+	BanFor time.Duration `yaml:"ban_for" toml:"ban_for"`
+	MaxBan time.Duration `yaml:"max_ban" toml:"max_ban"`
+}
+
+// Bridges mirrors rooms to other chat networks. Relaying also needs the
+// bridges feature flag in each room.
+type Bridges struct {
+	IRC    []IRCBridge    `yaml:"irc" toml:"irc"`
+	Matrix []MatrixBridge `yaml:"matrix" toml:"matrix"`
+}
+
+// IRCBridge connects rooms to channels on one IRC network.
+type IRCBridge struct {
+	// Name identifies the network, e.g. "libera"; IRC users appear in rooms
+	// as "nick@name".
+	Name string `yaml:"name" toml:"name"`
+	// Server is the host:port of the IRC server.
+	Server string `yaml:"server" toml:"server"`
+	TLS    bool   `yaml:"tls" toml:"tls"`
+	Nick   string `yaml:"nick" toml:"nick"`
+	// PasswordEnv names the environment variable, or the secret reference,
+	// holding the server password, if any.
+	PasswordEnv string `yaml:"password_env" toml:"password_env"`
+	// Channels maps IRC channels to rooms, e.g. "#schat": lobby.
+	Channels map[string]string `yaml:"channels" toml:"channels"`
+}
+
+// MatrixBridge connects rooms to Matrix rooms through one bot account.
+type MatrixBridge struct {
+	// Name identifies the account, e.g. "matrix"; Matrix users appear in
+	// rooms as "displayname@name".
+	Name string `yaml:"name" toml:"name"`
+	// Homeserver is the base URL, e.g. "https://matrix.example.org".
+	Homeserver string `yaml:"homeserver" toml:"homeserver"`
+	// TokenEnv names the environment variable, or the secret reference,
+	// holding the bot's access token.
+	TokenEnv string `yaml:"token_env" toml:"token_env"`
+	// Rooms maps Matrix room IDs or aliases to rooms, e.g.
+	// "#schat:example.org": lobby.
+	Rooms map[string]string `yaml:"rooms" toml:"rooms"`
+}
+
+// validate reports problems with the bridge settings.
+func (b Bridges) validate() []error {
+	var errs []error
+	names := make(map[string]bool)
+	for _, irc := range b.IRC {
+		if irc.Name == "" || names[irc.Name] {
+			errs = append(errs, fmt.Errorf("bridges irc name %q must be set and unique", irc.Name))
+		}
+		names[irc.Name] = true
+		if _, _, err := net.SplitHostPort(irc.Server); err != nil {
+			errs = append(errs, fmt.Errorf("bridges irc %q server %q must be host:port", irc.Name, irc.Server))
+		}
+		if irc.Nick == "" || strings.ContainsAny(irc.Nick, " ,!@") {
+			errs = append(errs, fmt.Errorf("bridges irc %q nick %q is not a valid nickname", irc.Name, irc.Nick))
+		}
+		if len(irc.Channels) == 0 {
+			errs = append(errs, fmt.Errorf("bridges irc %q must map at least one channel", irc.Name))
+		}
+		for channel, room := range irc.Channels {
+			if !strings.HasPrefix(channel, "#") && !strings.HasPrefix(channel, "&") || strings.ContainsAny(channel, " ,") || room == "" {
+				errs = append(errs, fmt.Errorf("bridges irc %q channel %q -> room %q is not a valid mapping", irc.Name, channel, room))
+			}
+		}
+	}
+	names = make(map[string]bool)
+	for _, m := range b.Matrix {
+		if m.Name == "" || names[m.Name] {
+			errs = append(errs, fmt.Errorf("bridges matrix name %q must be set and unique", m.Name))
+		}
+		names[m.Name] = true
+		if u, err := url.Parse(m.Homeserver); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("bridges matrix %q homeserver %q is not an http(s) URL", m.Name, m.Homeserver))
+		}
+		if m.TokenEnv == "" {
+			errs = append(errs, fmt.Errorf("bridges matrix %q must set token_env", m.Name))
+		}
+		if len(m.Rooms) == 0 {
+			errs = append(errs, fmt.Errorf("bridges matrix %q must map at least one room", m.Name))
+		}
+		for id, room := range m.Rooms {
+			if !strings.HasPrefix(id, "!") && !strings.HasPrefix(id, "#") || !strings.Contains(id, ":") || room == "" {
+				errs = append(errs, fmt.Errorf("bridges matrix %q room %q -> room %q is not a valid mapping", m.Name, id, room))
+			}
+		}
+	}
+	return errs
+}
+
+// Default returns the built-in configuration used when neither a file nor a
+// flag sets a value.
+func Default() Config {
+	return Config{
+		Addr:                 ":2222",
+		DrainTimeout:         time.Hour,
+		HostKey:              DefaultHostKey,
+		HostKeyType:          "ed25519",
+		HostKeyPassphraseEnv: "SCHAT_HOST_KEY_PASSPHRASE",
+		ServerName:           "schat",
+		Auth:                 Auth{Modes: []string{"none"}, AdminUser: "admin"},
+		Limits: Limits{
+			AutoAway:            30 * time.Minute,
+			Backpressure:        "drop-oldest",
+			BackpressureTimeout: 250 * time.Millisecond,
+			MaxMessageLength:    2000,
+		},
+		Log:  Log{Level: "info", Format: LogFormatText, RoomLevel: "warn"},
+		Keys: Keys{Interrupt: "double"},
+		Translate: Translate{
+			APIKeyEnv:     "SCHAT_TRANSLATE_API_KEY",
+			RatePerMinute: 60,
+			CacheSize:     1000,
+		},
+		WordFilter: WordFilter{Action: "mask"},
+		AutoMod: AutoMod{
+			Repeats:        3,
+			RepeatWindow:   30 * time.Second,
+			CapsRatio:      0.7,
+			CapsMinLetters: 12,
+			Links:          3,
+			LinkWindow:     time.Minute,
+			Joins:          8,
+			JoinWindow:     time.Minute,
+			Actions:        []string{"warn", "mute", "kick", "ban"},
+			MuteFor:        5 * time.Minute,
+			BanFor:         time.Hour,
+			StrikeWindow:   time.Hour,
+		},
+		Files:    Files{TotalBytes: 64 << 20, TTL: 24 * time.Hour},
+		Probes:   Probes{Interval: time.Minute, Timeout: 5 * time.Second},
+		Webhooks: Webhooks{SecretEnv: "SCHAT_WEBHOOK_SECRET"},
+		AdminAPI: AdminAPI{TokenEnv: "SCHAT_ADMIN_TOKEN"},
+		RoomBackend: RoomBackend{
+			Type:  RoomBackendMemory,
+			Redis: Redis{PasswordEnv: "SCHAT_REDIS_PASSWORD", Prefix: "schat"},
+			NATS:  NATS{TokenEnv: "SCHAT_NATS_TOKEN", Stream: "SCHAT", Prefix: "schat", Retention: 7 * 24 * time.Hour},
+		},
+		Secrets:  Secrets{Vault: Vault{Token: "env:VAULT_TOKEN"}},
+		Security: Security{Policy: "intermediate"},
+		FailBan:  FailBan{MaxFailures: 10, Window: 10 * time.Minute, BanFor: 10 * time.Minute, MaxBan: 24 * time.Hour},
+		Profile:  ProfileDefault,
+	}
+}
+
+// ApplyDataDir points the host key, database, archive directory, and audit
+// log that were left at their defaults into DataDir. It does nothing when DataDir is empty.
+func (c *Config) ApplyDataDir() {
+	if c.DataDir == "" {
+		return
+	}
+	if c.HostKey == DefaultHostKey {
+		c.HostKey = filepath.Join(c.DataDir, DataDirHostKey)
+	}
+	if c.DB == "" {
+		c.DB = filepath.Join(c.DataDir, DataDirDB)
+	}
+	if c.Archive.Dir == "" {
+		c.Archive.Dir = filepath.Join(c.DataDir, DataDirArchive)
+	}
+	if c.AuditFile == "" {
+		c.AuditFile = filepath.Join(c.DataDir, DataDirAudit)
+	}
+	if c.BanFile == "" {
+		c.BanFile = filepath.Join(c.DataDir, DataDirBans)
+	}
+}
+
+// Validate reports settings that can never work, independent of the packages
+// that consume them.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr must not be empty"))
+	}
+	if c.Limits.MaxClients < 0 || c.Limits.MaxPerIP < 0 {
+		errs = append(errs, errors.New("connection limits must not be negative"))
+	}
+	if c.Limits.MaxMessageLength < 0 {
+		errs = append(errs, errors.New("limits max_message_length must not be negative"))
+	}
+	if c.Limits.AutoAway < 0 || c.Limits.BackpressureTimeout < 0 || c.Archive.Retention < 0 || c.Archive.Inactive < 0 || c.DBRetention < 0 {
+		errs = append(errs, errors.New("durations must not be negative"))
+	}
+	if _, err := c.Log.SlogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, _, err := c.Log.RoomSlogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Log.Format != LogFormatText && c.Log.Format != LogFormatJSON {
+		errs = append(errs, fmt.Errorf("log format %q (want text or json)", c.Log.Format))
+	}
+	if c.DBKeyEnv != "" && c.DB == "" {
+		errs = append(errs, errors.New("db_key_env needs db to be set"))
+	}
+	if c.Auth.AdminKeys != "" && c.Auth.AdminUser == "" {
+		errs = append(errs, errors.New("auth admin_user must not be empty when admin_keys is set"))
+	}
+	if c.Auth.IdentitiesFile != "" && !slices.Contains(c.Auth.Modes, "pubkey") {
+		errs = append(errs, errors.New("auth identities_file needs the pubkey mode"))
+	}
+	if c.Translate.RatePerMinute <= 0 || c.Translate.CacheSize < 0 {
+		errs = append(errs, errors.New("translate rate_per_minute must be positive and cache_size not negative"))
+	}
+	if c.Files.MaxBytes < 0 || (c.Files.MaxBytes > 0 && (c.Files.TotalBytes < c.Files.MaxBytes || c.Files.TTL <= 0)) {
+		errs = append(errs, errors.New("files total_bytes must be at least max_bytes and ttl positive"))
+	}
+	if c.Probes.Interval < 0 || (c.Probes.Interval > 0 && (c.Probes.Timeout <= 0 || c.Probes.Timeout >= c.Probes.Interval)) {
+		errs = append(errs, errors.New("probes timeout must be positive and shorter than interval"))
+	}
+	for _, a := range c.Announcements {
+		if a.Schedule == "" || strings.TrimSpace(a.Text) == "" {
+			errs = append(errs, errors.New("announcements need a schedule and text"))
+			break
+		}
+	}
+	errs = append(errs, c.Webhooks.validate()...)
+	errs = append(errs, c.Cluster.validate()...)
+	if c.Cluster.Replicate && c.MetricsAddr == "" {
+		errs = append(errs, errors.New("cluster replicate needs metrics_addr, where peers post their messages"))
+	}
+	switch c.RoomBackend.Type {
+	case RoomBackendMemory:
+	case RoomBackendRedis:
+		if c.RoomBackend.Redis.Addr == "" {
+			errs = append(errs, errors.New("room_backend redis needs redis addr"))
+		}
+		if c.RoomBackend.Redis.DB < 0 {
+			errs = append(errs, errors.New("room_backend redis db must not be negative"))
+		}
+	case RoomBackendNATS:
+		errs = append(errs, c.RoomBackend.NATS.validate()...)
+	default:
+		errs = append(errs, fmt.Errorf("room_backend type %q must be memory, redis, or nats", c.RoomBackend.Type))
+	}
+	if c.RoomBackend.Type != RoomBackendMemory && c.Cluster.Replicate {
+		errs = append(errs, fmt.Errorf("room_backend %s and cluster replicate both share messages between servers; use one", c.RoomBackend.Type))
+	}
+	errs = append(errs, c.Bridges.validate()...)
+	errs = append(errs, c.Secrets.validate()...)
+	if c.FailBan.MaxFailures < 0 || (c.FailBan.MaxFailures > 0 && (c.FailBan.Window <= 0 || c.FailBan.BanFor <= 0 || c.FailBan.MaxBan < c.FailBan.BanFor)) {
+		errs = append(errs, errors.New("fail_ban window and ban_for must be positive and max_ban at least ban_for"))
+	}
+	if c.DrainTimeout < 0 {
+		errs = append(errs, errors.New("drain_timeout must not be negative"))
+	}
+	for _, source := range c.ProxyProtocol {
+		if !validProxySource(strings.TrimSpace(source)) {
+			errs = append(errs, fmt.Errorf("proxy_protocol %q is not an address or CIDR range", source))
+		}
+	}
+	if c.Security.MinRSABits < 0 {
+		errs = append(errs, errors.New("security min_rsa_bits must not be negative"))
+	}
+	if c.Hardening.Enabled && c.DataDir == "" {
+		errs = append(errs, errors.New("hardening needs data_dir to confine the server to"))
+	}
+	if c.Webhooks.Enabled() && c.Webhooks.SecretEnv == "" {
+		errs = append(errs, errors.New("webhooks secret_env must not be empty when webhooks are enabled"))
+	}
+	if c.AdminAPI.Addr != "" && c.AdminAPI.TokenEnv == "" {
+		errs = append(errs, errors.New("admin_api token_env must not be empty when admin_api addr is set"))
+	}
+	if c.WebGateway.Addr != "" && c.TokenFile == "" && !slices.Contains(c.Auth.Modes, "none") {
+		errs = append(errs, errors.New("web_gateway needs token_file, or auth mode none, for browsers to sign in"))
+	}
+	if c.Telnet.Addr != "" && !slices.Contains(c.Auth.Modes, "none") {
+		errs = append(errs, errors.New("telnet needs auth mode none, as telnet users cannot authenticate"))
+	}
+	if c.ControlAPI.Addr != "" && (c.ControlAPI.TLS.Cert == "" || c.ControlAPI.TLS.Key == "" || c.ControlAPI.TLS.CA == "") {
+		errs = append(errs, errors.New("control_api tls needs cert, key, and ca when control_api addr is set"))
+	}
+	if _, err := c.EffectiveTuning(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+// validProxySource reports whether s is an address or CIDR range.
+func validProxySource(s string) bool {
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// EffectiveTuning merges explicit overrides over the selected profile preset.
+// A GOGC environment variable wins over the profile but not over tuning.gogc;
+// the result then leaves GOGC zero so ApplyRuntime keeps it.
+func (c Config) EffectiveTuning() (Tuning, error) {
+	preset, err := Preset(c.Profile)
+	if err != nil {
+		return Tuning{}, err
+	}
+	tuning := c.Tuning.Merge(preset)
+	if c.Tuning.GOGC == 0 && os.Getenv("GOGC") != "" {
+		tuning.GOGC = 0
+	}
+	return tuning, nil
+}
+
+// RestartRequired lists the settings that differ between c and next but only
+// take effect when the server restarts. Everything else is applied on reload.
+func (c Config) RestartRequired(next Config) []string {
+	fixed := []struct {
+		name      string
+		old, next any
+	}{
+		{"addr", c.Addr, next.Addr},
+		{"data_dir", c.DataDir, next.DataDir},
+		{"host_key", c.HostKey, next.HostKey},
+		{"host_keys", c.HostKeys, next.HostKeys},
+		{"host_key_type", c.HostKeyType, next.HostKeyType},
+		{"host_key_passphrase_env", c.HostKeyPassphraseEnv, next.HostKeyPassphraseEnv},
+		{"goodbye", c.Goodbye, next.Goodbye},
+		{"announcements", c.Announcements, next.Announcements},
+		{"features", c.Features, next.Features},
+		{"metrics_addr", c.MetricsAddr, next.MetricsAddr},
+		{"token_file", c.TokenFile, next.TokenFile},
+		{"audit_file", c.AuditFile, next.AuditFile},
+		{"ban_file", c.BanFile, next.BanFile},
+		{"db", c.DB, next.DB},
+		{"db_retention", c.DBRetention, next.DBRetention},
+		{"db_key_env", c.DBKeyEnv, next.DBKeyEnv},
+		{"auth", c.Auth, next.Auth},
+		{"limits.backpressure", c.Limits.Backpressure, next.Limits.Backpressure},
+		{"limits.backpressure_timeout", c.Limits.BackpressureTimeout, next.Limits.BackpressureTimeout},
+		{"limits.room_backpressure", c.Limits.RoomBackpressure, next.Limits.RoomBackpressure},
+		{"limits.max_message_length", c.Limits.MaxMessageLength, next.Limits.MaxMessageLength},
+		{"archive", c.Archive, next.Archive},
+		{"log.file", c.Log.File, next.Log.File},
+		{"log.format", c.Log.Format, next.Log.Format},
+		{"log.room_level", c.Log.RoomLevel == LogRoomOff, next.Log.RoomLevel == LogRoomOff},
+		{"cluster", c.Cluster, next.Cluster},
+		{"keys", c.Keys, next.Keys},
+		{"status_bar", c.StatusBar, next.StatusBar},
+		{"translate", c.Translate, next.Translate},
+		{"word_filter", c.WordFilter, next.WordFilter},
+		{"automod", c.AutoMod, next.AutoMod},
+		{"files", c.Files, next.Files},
+		{"probes", c.Probes, next.Probes},
+		{"webhooks", c.Webhooks, next.Webhooks},
+		{"admin_api", c.AdminAPI, next.AdminAPI},
+		{"control_api", c.ControlAPI, next.ControlAPI},
+		{"web_gateway", c.WebGateway, next.WebGateway},
+		{"telnet", c.Telnet, next.Telnet},
+		{"room_backend", c.RoomBackend, next.RoomBackend},
+		{"bridges", c.Bridges, next.Bridges},
+		{"hardening", c.Hardening, next.Hardening},
+		{"secrets", c.Secrets, next.Secrets},
+		{"security", c.Security, next.Security},
+		{"fail_ban", c.FailBan, next.FailBan},
+		{"proxy_protocol", c.ProxyProtocol, next.ProxyProtocol},
+		{"drain_timeout", c.DrainTimeout, next.DrainTimeout},
+		{"profile", c.Profile, next.Profile},
+		{"tuning", c.Tuning, next.Tuning},
+	}
+
+	var changed []string
+	for _, f := range fixed {
+		if !reflect.DeepEqual(f.old, f.next) {
+			changed = append(changed, f.name)
+		}
+	}
+	return changed
+}
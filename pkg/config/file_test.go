@@ -0,0 +1,275 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			file: "schat.yaml",
+			content: `
+addr: ":2022"
+operators: [alice, bob]
+rooms: [dev]
+auth:
+  modes: [password, pubkey]
+  password_file: users.txt
+  accounts_file: accounts.json
+  identities_file: identities.json
+limits:
+  max_per_ip: 4
+  auto_away: 10m
+  max_message_length: 500
+tuning:
+  queue_size: 32
+cluster:
+  node: a
+  nodes:
+    - {id: a, addr: "chat-a:2222", admin: "http://10.0.0.1:9100"}
+  affinity: {dev: a}
+keys:
+  bindings: {room: ctrl+x}
+  locked: [quit]
+status_bar:
+  right: ["{{.Clock}}"]
+word_filter:
+  words: [darn]
+  action: block
+automod:
+  enabled: true
+  caps_ratio: 0
+  actions: [warn, kick]
+secrets:
+  vault: {addr: "https://vault.example.com:8200"}
+fail_ban:
+  max_failures: 5
+  max_ban: 1h
+security:
+  policy: modern
+  macs: [hmac-sha2-256-etm@openssh.com]
+db_retention: 720h
+db_key_env: SCHAT_DB_KEY
+proxy_protocol: [10.0.0.0/8, 192.0.2.10]
+drain_timeout: 15m
+announcements:
+  - {schedule: "0 9 * * 1-5", room: dev, text: stand-up}
+files:
+  max_bytes: 1048576
+  ttl: 2h
+probes:
+  interval: 30s
+webhooks:
+  addr: ":9200"
+  prompts:
+    - {name: deploy, rooms: [ops], callback: "https://ci.example.com/schat", approvers: [alice]}
+admin_api:
+  addr: "127.0.0.1:9300"
+control_api:
+  addr: "127.0.0.1:9400"
+  tls: {cert: control.crt, key: control.key, ca: clients.crt}
+web_gateway:
+  addr: ":8080"
+  origins: ["https://chat.example.com"]
+telnet:
+  addr: "127.0.0.1:2323"
+  raw: true
+room_backend:
+  type: redis
+  redis: {addr: "127.0.0.1:6379", db: 2}
+  nats: {url: "nats://127.0.0.1:4222", stream: CHAT, retention: 24h}
+`,
+		},
+		{
+			name: "toml",
+			file: "schat.toml",
+			content: `
+addr = ":2022"
+operators = ["alice", "bob"]
+rooms = ["dev"]
+db_retention = "720h"
+db_key_env = "SCHAT_DB_KEY"
+proxy_protocol = ["10.0.0.0/8", "192.0.2.10"]
+drain_timeout = "15m"
+announcements = [{ schedule = "0 9 * * 1-5", room = "dev", text = "stand-up" }]
+
+[auth]
+modes = ["password", "pubkey"]
+password_file = "users.txt"
+accounts_file = "accounts.json"
+identities_file = "identities.json"
+
+[limits]
+max_per_ip = 4
+auto_away = "10m"
+max_message_length = 500
+
+[tuning]
+queue_size = 32
+
+[cluster]
+node = "a"
+affinity = { dev = "a" }
+
+[[cluster.nodes]]
+id = "a"
+addr = "chat-a:2222"
+admin = "http://10.0.0.1:9100"
+
+[keys]
+bindings = { room = "ctrl+x" }
+locked = ["quit"]
+
+[status_bar]
+right = ["{{.Clock}}"]
+
+[word_filter]
+words = ["darn"]
+action = "block"
+
+[automod]
+enabled = true
+caps_ratio = 0.0
+actions = ["warn", "kick"]
+
+[secrets.vault]
+addr = "https://vault.example.com:8200"
+
+[fail_ban]
+max_failures = 5
+max_ban = "1h"
+
+[security]
+policy = "modern"
+macs = ["hmac-sha2-256-etm@openssh.com"]
+
+[files]
+max_bytes = 1048576
+ttl = "2h"
+
+[probes]
+interval = "30s"
+
+[webhooks]
+addr = ":9200"
+
+[[webhooks.prompts]]
+name = "deploy"
+rooms = ["ops"]
+callback = "https://ci.example.com/schat"
+approvers = ["alice"]
+
+[admin_api]
+addr = "127.0.0.1:9300"
+
+[control_api]
+addr = "127.0.0.1:9400"
+tls = {cert = "control.crt", key = "control.key", ca = "clients.crt"}
+
+[web_gateway]
+addr = ":8080"
+origins = ["https://chat.example.com"]
+
+[telnet]
+addr = "127.0.0.1:2323"
+raw = true
+
+[room_backend]
+type = "redis"
+redis = {addr = "127.0.0.1:6379", db = 2}
+nats = {url = "nats://127.0.0.1:4222", stream = "CHAT", retention = "24h"}
+`,
+		},
+		{name: "unknown yaml key", file: "schat.yml", content: "adr: \":2022\"\n", wantErr: "adr"},
+		{name: "unknown toml key", file: "schat.toml", content: "[limits]\nmax_clinets = 3\n", wantErr: "limits.max_clinets"},
+		{name: "unsupported format", file: "schat.json", content: "{}", wantErr: "unsupported format"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			err := cfg.LoadFile(writeConfig(t, tc.file, tc.content))
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, ":2022", cfg.Addr)
+			require.Equal(t, []string{"alice", "bob"}, cfg.Operators)
+			require.Equal(t, []string{"dev"}, cfg.Rooms)
+			require.Equal(t, Auth{Modes: []string{"password", "pubkey"}, PasswordFile: "users.txt", AdminUser: "admin", AccountsFile: "accounts.json", IdentitiesFile: "identities.json"}, cfg.Auth)
+			require.Equal(t, 4, cfg.Limits.MaxPerIP)
+			require.Equal(t, 10*time.Minute, cfg.Limits.AutoAway)
+			require.Equal(t, 500, cfg.Limits.MaxMessageLength)
+			require.Equal(t, 32, cfg.Tuning.QueueSize)
+			require.Equal(t, Cluster{
+				Node:     "a",
+				Nodes:    []ClusterNode{{ID: "a", Addr: "chat-a:2222", Admin: "http://10.0.0.1:9100"}},
+				Affinity: map[string]string{"dev": "a"},
+			}, cfg.Cluster)
+			require.Equal(t, Keys{Bindings: map[string]string{"room": "ctrl+x"}, Locked: []string{"quit"}, Interrupt: "double"}, cfg.Keys)
+			require.Equal(t, StatusBar{Right: []string{"{{.Clock}}"}}, cfg.StatusBar)
+			require.Equal(t, WordFilter{Words: []string{"darn"}, Action: "block"}, cfg.WordFilter)
+			require.True(t, cfg.AutoMod.Enabled)
+			require.Zero(t, cfg.AutoMod.CapsRatio)
+			require.Equal(t, []string{"warn", "kick"}, cfg.AutoMod.Actions)
+			require.Equal(t, 3, cfg.AutoMod.Repeats, "unset values keep their defaults")
+			require.Equal(t, Vault{Addr: "https://vault.example.com:8200", Token: "env:VAULT_TOKEN"}, cfg.Secrets.Vault)
+			require.Equal(t, FailBan{MaxFailures: 5, Window: 10 * time.Minute, BanFor: 10 * time.Minute, MaxBan: time.Hour}, cfg.FailBan)
+			require.Equal(t, Security{Policy: "modern", MACs: []string{"hmac-sha2-256-etm@openssh.com"}}, cfg.Security)
+			require.Equal(t, 720*time.Hour, cfg.DBRetention)
+			require.Equal(t, "SCHAT_DB_KEY", cfg.DBKeyEnv)
+			require.Equal(t, []string{"10.0.0.0/8", "192.0.2.10"}, cfg.ProxyProtocol)
+			require.Equal(t, 15*time.Minute, cfg.DrainTimeout)
+			require.Equal(t, []Announcement{{Schedule: "0 9 * * 1-5", Room: "dev", Text: "stand-up"}}, cfg.Announcements)
+			require.Equal(t, Files{MaxBytes: 1 << 20, TotalBytes: 64 << 20, TTL: 2 * time.Hour}, cfg.Files)
+			require.Equal(t, Probes{Interval: 30 * time.Second, Timeout: 5 * time.Second}, cfg.Probes)
+			require.Equal(t, Webhooks{
+				Addr:      ":9200",
+				SecretEnv: "SCHAT_WEBHOOK_SECRET",
+				Prompts:   []PromptSystem{{Name: "deploy", Rooms: []string{"ops"}, Callback: "https://ci.example.com/schat", Approvers: []string{"alice"}}},
+			}, cfg.Webhooks)
+			require.Equal(t, AdminAPI{Addr: "127.0.0.1:9300", TokenEnv: "SCHAT_ADMIN_TOKEN"}, cfg.AdminAPI)
+			require.Equal(t, RoomBackend{
+				Type:  "redis",
+				Redis: Redis{Addr: "127.0.0.1:6379", PasswordEnv: "SCHAT_REDIS_PASSWORD", DB: 2, Prefix: "schat"},
+				NATS:  NATS{URL: "nats://127.0.0.1:4222", TokenEnv: "SCHAT_NATS_TOKEN", Stream: "CHAT", Prefix: "schat", Retention: 24 * time.Hour},
+			}, cfg.RoomBackend)
+			require.Equal(t, ControlAPI{Addr: "127.0.0.1:9400", TLS: ClusterTLS{Cert: "control.crt", Key: "control.key", CA: "clients.crt"}}, cfg.ControlAPI)
+			require.Equal(t, WebGateway{Addr: ":8080", Origins: []string{"https://chat.example.com"}}, cfg.WebGateway)
+			require.Equal(t, Telnet{Addr: "127.0.0.1:2323", Raw: true}, cfg.Telnet)
+			require.Equal(t, "drop-oldest", cfg.Limits.Backpressure, "omitted keys keep their defaults")
+			require.Equal(t, "configs/ssh_host_rsa", cfg.HostKey)
+		})
+	}
+}
+
+func TestLoadFileEmpty(t *testing.T) {
+	cfg := Default()
+	require.NoError(t, cfg.LoadFile(writeConfig(t, "empty.yaml", "")))
+	require.Equal(t, Default(), cfg)
+}
+
+func TestExampleConfigLoads(t *testing.T) {
+	cfg := Default()
+	require.NoError(t, cfg.LoadFile(filepath.Join("..", "..", "configs", "schat.example.yaml")))
+	require.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RegisterFlags binds command-line flags to the fields of c, using the current
+// values of c as the flag defaults.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "TCP address for the SSH chat server")
+	fs.StringVar(&c.DataDir, "data-dir", c.DataDir, "Directory holding the host key, -db, and -archive-dir unless they are set (created 0700 if missing)")
+	fs.StringVar(&c.HostKey, "host-key", c.HostKey, "Path to the SSH host private key (auto-generated if missing), or a secret reference holding it")
+	fs.Var(listFlag{&c.HostKeys}, "host-keys", "Comma-separated `paths` of extra existing host keys to serve, e.g. the old key during a rotation")
+	fs.StringVar(&c.HostKeyType, "host-key-type", c.HostKeyType, "Algorithm for a generated host key: ed25519 (default), ecdsa-p256, rsa-4096")
+	fs.StringVar(&c.Security.Policy, "ssh-policy", c.Security.Policy, "SSH algorithm preset: modern, intermediate (default), legacy")
+	fs.StringVar(&c.HostKeyPassphraseEnv, "host-key-passphrase-env", c.HostKeyPassphraseEnv, "Environment variable or secret reference holding the passphrase of an encrypted host key")
+	fs.Var(listFlag{&c.Auth.Modes}, "auth", "Comma-separated auth `providers`: none, password, pubkey, oidc")
+	fs.StringVar(&c.Auth.PasswordFile, "password-file", c.Auth.PasswordFile, "File of username:bcrypt-hash lines for -auth password")
+	fs.StringVar(&c.Auth.AuthorizedKeys, "authorized-keys", c.Auth.AuthorizedKeys, "OpenSSH authorized_keys file for -auth pubkey")
+	fs.StringVar(&c.Auth.OIDCIssuer, "oidc-issuer", c.Auth.OIDCIssuer, "OIDC issuer URL for -auth oidc (device code flow)")
+	fs.StringVar(&c.Auth.OIDCClientID, "oidc-client-id", c.Auth.OIDCClientID, "OIDC client ID for -auth oidc")
+	fs.StringVar(&c.Auth.AdminKeys, "admin-keys", c.Auth.AdminKeys, "OpenSSH authorized_keys file of keys allowed to run admin commands over exec, e.g. ssh admin@host kick bob")
+	fs.StringVar(&c.Auth.AccountsFile, "accounts-file", c.Auth.AccountsFile, "File storing accounts created with /register; registered usernames then need their password or key")
+	fs.StringVar(&c.Auth.IdentitiesFile, "identities-file", c.Auth.IdentitiesFile, "File mapping public keys to stable usernames, colors, and operator status (needs -auth pubkey)")
+	fs.StringVar(&c.Auth.AdminUser, "admin-user", c.Auth.AdminUser, "Username reserved for -admin-keys")
+	fs.Var(listFlag{&c.Operators}, "operators", "Comma-separated `usernames` granted operator commands")
+	fs.Var(listFlag{&c.Rooms}, "rooms", "Comma-separated `rooms` to create at startup besides the lobby")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "Optional HTTP address serving expvar metrics at /debug/vars")
+	fs.StringVar(&c.Limits.Backpressure, "backpressure", c.Limits.Backpressure, "Slow client policy: drop-oldest, drop-newest, disconnect, block")
+	fs.StringVar(&c.Profile, "profile", c.Profile, "Tuning preset: "+strings.Join(Profiles(), ", "))
+	fs.DurationVar(&c.Limits.AutoAway, "auto-away", c.Limits.AutoAway, "Mark users away after this much inactivity (0 disables)")
+	fs.DurationVar(&c.Limits.BackpressureTimeout, "backpressure-timeout", c.Limits.BackpressureTimeout, "How long -backpressure block waits for queue space")
+	fs.StringVar(&c.Keys.Interrupt, "interrupt", c.Keys.Interrupt, "What Ctrl+C does: double (clear the line, quit when pressed twice), quit, clear")
+	fs.StringVar(&c.ServerName, "server-name", c.ServerName, "Server name shown in the MOTD")
+	fs.StringVar(&c.MOTD, "motd", c.MOTD, "Template file for the message of the day shown after joining")
+	fs.StringVar(&c.Banner, "banner", c.Banner, "Text file shown by SSH clients before authentication")
+	fs.StringVar(&c.Goodbye, "goodbye", c.Goodbye, "Line shown to users as they quit (empty shows none)")
+	fs.Var(listFlag{&c.Features}, "features", "Comma-separated feature `flags` to enable, e.g. reactions,bridges=false")
+	fs.IntVar(&c.Limits.MaxClients, "max-clients", c.Limits.MaxClients, "Maximum concurrent SSH connections (0 = unlimited)")
+	fs.IntVar(&c.FailBan.MaxFailures, "fail-ban", c.FailBan.MaxFailures, "Temporarily ban an address after this many failed handshakes or password attempts within fail_ban.window (0 disables)")
+	fs.DurationVar(&c.DrainTimeout, "drain-timeout", c.DrainTimeout, "How long sessions may stay on the old process after a hot restart (SIGUSR1) before it exits (0 waits for all)")
+	fs.Var(listFlag{&c.ProxyProtocol}, "proxy-protocol", "Comma-separated `addresses` or CIDR ranges of load balancers that send a PROXY protocol v1/v2 header")
+	fs.IntVar(&c.Limits.MaxPerIP, "max-per-ip", c.Limits.MaxPerIP, "Maximum concurrent SSH connections from one source IP (0 = unlimited)")
+	fs.IntVar(&c.Limits.MaxMessageLength, "max-message-length", c.Limits.MaxMessageLength, "Cut messages to this many characters, telling the sender (0 = unlimited)")
+	fs.StringVar(&c.TokenFile, "token-file", c.TokenFile, "File storing hashed API tokens; enables /token when set")
+	fs.StringVar(&c.BanFile, "ban-file", c.BanFile, "JSON file keeping the users, keys, and IP ranges banned with /ban across restarts (empty keeps them in memory)")
+	fs.StringVar(&c.AuditFile, "audit-file", c.AuditFile, "Append-only log of kicks, bans, mutes, topic changes, config reloads, and other operator actions (empty keeps them in memory)")
+	fs.DurationVar(&c.DBRetention, "db-retention", c.DBRetention, "Prune messages in -db older than this (0 keeps them forever)")
+	fs.StringVar(&c.DBKeyEnv, "db-key-env", c.DBKeyEnv, "Environment variable or secret reference holding the secret that encrypts messages in -db (empty stores plaintext)")
+	fs.StringVar(&c.Archive.Dir, "archive-dir", c.Archive.Dir, "Directory for the history of deleted rooms (empty discards it)")
+	fs.DurationVar(&c.Archive.Retention, "archive-retention", c.Archive.Retention, "Prune room archives older than this (0 keeps them forever)")
+	fs.DurationVar(&c.Archive.Inactive, "archive-inactive", c.Archive.Inactive, "Archive rooms nobody joined or wrote in for this long, making them read-only (0 never archives)")
+	fs.StringVar(&c.DB, "db", c.DB, "SQLite database for persisting messages and enabling /search (empty disables)")
+	fs.StringVar(&c.Cluster.Node, "node-id", c.Cluster.Node, "This server's ID in the cluster config (empty runs standalone)")
+	fs.StringVar(&c.Translate.URL, "translate-url", c.Translate.URL, "LibreTranslate server URL; enables /translate when set")
+	fs.StringVar(&c.WordFilter.File, "word-filter", c.WordFilter.File, "File of words to mask in messages, one per line; enables the word-filter feature")
+	fs.BoolVar(&c.AutoMod.Enabled, "automod", c.AutoMod.Enabled, "Turn on the automod feature: warn, mute, kick, then ban users who repeat messages, shout, spam links, or flood joins")
+	fs.Int64Var(&c.Files.MaxBytes, "files-max-bytes", c.Files.MaxBytes, "Largest file users may share with upload/download over SSH (0 disables file sharing)")
+	fs.DurationVar(&c.Probes.Interval, "probe-interval", c.Probes.Interval, "How often to send canary messages through every room and query cluster peers (0 disables)")
+	fs.StringVar(&c.Webhooks.Addr, "webhook-addr", c.Webhooks.Addr, "HTTP address accepting signed JSON messages for rooms at /webhook (empty disables)")
+	fs.StringVar(&c.AdminAPI.Addr, "admin-api-addr", c.AdminAPI.Addr, "HTTP address serving /healthz, /readyz, and the token-protected admin API under /api (empty disables)")
+	fs.StringVar(&c.RoomBackend.Type, "room-backend", c.RoomBackend.Type, "where rooms keep presence and messages: memory, or redis or nats to share them with other servers")
+	fs.StringVar(&c.RoomBackend.Redis.Addr, "redis-addr", c.RoomBackend.Redis.Addr, "Redis address for -room-backend redis, e.g. 127.0.0.1:6379")
+	fs.StringVar(&c.RoomBackend.NATS.URL, "nats-url", c.RoomBackend.NATS.URL, "NATS server URL for -room-backend nats, e.g. nats://127.0.0.1:4222")
+	fs.StringVar(&c.ControlAPI.Addr, "control-api-addr", c.ControlAPI.Addr, "address serving the gRPC control API over mutual TLS; needs control_api tls in the config file (empty disables)")
+	fs.StringVar(&c.WebGateway.Addr, "web-addr", c.WebGateway.Addr, "HTTP address serving a browser client that joins the rooms over WebSocket (empty disables)")
+	fs.StringVar(&c.Telnet.Addr, "telnet-addr", c.Telnet.Addr, "Plaintext TCP address accepting telnet connections for labs and LANs; needs -auth none (empty disables)")
+	fs.Var(listFlag{&c.Webhooks.Outbound}, "webhook-urls", "Comma-separated `urls` that receive every room broadcast as signed JSON")
+	fs.BoolVar(&c.Hardening.Enabled, "hardened", c.Hardening.Enabled, "After binding, drop to -run-as, confine file access to -data-dir with Landlock on Linux, and refuse to run as root")
+	fs.StringVar(&c.Hardening.User, "run-as", c.Hardening.User, "User, by name or as uid:gid, that a -hardened server started as root switches to")
+	fs.BoolVar(&c.Hardening.AllowRoot, "allow-root", c.Hardening.AllowRoot, "Let a -hardened server keep running as root when -run-as is not set")
+	fs.StringVar(&c.Log.File, "log-file", c.Log.File, "Append logs to this file instead of stdout")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "Minimum log level: debug, info, warn, error")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "Log output format: text, json")
+	fs.StringVar(&c.Log.RoomLevel, "log-room-level", c.Log.RoomLevel, "Minimum level streamed into the operators' #server-log room: debug, info, warn, error, off")
+}
+
+// listFlag adapts a string slice to a comma-separated flag value.
+type listFlag struct {
+	items *[]string
+}
+
+func (l listFlag) String() string {
+	if l.items == nil {
+		return ""
+	}
+	return strings.Join(*l.items, ",")
+}
+
+func (l listFlag) Set(value string) error {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*l.items = items
+	return nil
+}
+
+// Loader resolves the configuration from the built-in defaults, an optional
+// file, and command-line flags, in increasing order of precedence. Load may be
+// called again to pick up file changes; flag overrides are kept.
+type Loader struct {
+	path      string
+	overrides map[string]string
+}
+
+// ParseFlags parses args, including -config, and records which flags were set
+// explicitly so they keep overriding the file across reloads.
+func ParseFlags(fs *flag.FlagSet, args []string) (*Loader, error) {
+	l := &Loader{overrides: make(map[string]string)}
+	defaults := Default()
+	defaults.RegisterFlags(fs)
+	fs.StringVar(&l.path, "config", "", "YAML or TOML config file; flags override its values and SIGHUP reloads it")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			l.overrides[f.Name] = f.Value.String()
+		}
+	})
+	return l, nil
+}
+
+// Path returns the config file path, or "" when running from flags alone.
+func (l *Loader) Path() string {
+	return l.path
+}
+
+// Load reads the config file, if any, applies flag overrides, places files
+// left at their defaults in the data directory, and validates the result.
+func (l *Loader) Load() (Config, error) {
+	cfg := Default()
+	if l.path != "" {
+		if err := cfg.LoadFile(l.path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	fs := flag.NewFlagSet("overrides", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	names := make([]string, 0, len(l.overrides))
+	for name := range l.overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fs.Set(name, l.overrides[name]); err != nil {
+			return Config{}, fmt.Errorf("config: flag -%s: %w", name, err)
+		}
+	}
+	cfg.ApplyDataDir()
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
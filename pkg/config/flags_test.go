@@ -0,0 +1,238 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func parseFlags(t *testing.T, args ...string) *Loader {
+	t.Helper()
+	fs := flag.NewFlagSet("schat", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	loader, err := ParseFlags(fs, args)
+	require.NoError(t, err)
+	return loader
+}
+
+func TestLoaderPrecedence(t *testing.T) {
+	path := writeConfig(t, "schat.yaml", "addr: \":2022\"\nmotd: motd.tmpl\noperators: [alice]\nlimits:\n  max_clients: 50\n")
+
+	cfg, err := parseFlags(t).Load()
+	require.NoError(t, err)
+	require.Equal(t, Default(), cfg, "no file and no flags yields the defaults")
+
+	loader := parseFlags(t, "-config", path, "-addr", ":3022", "-operators", "carol, dave", "-auto-away", "0")
+	require.Equal(t, path, loader.Path())
+	cfg, err = loader.Load()
+	require.NoError(t, err)
+	require.Equal(t, ":3022", cfg.Addr, "flags override the file")
+	require.Equal(t, []string{"carol", "dave"}, cfg.Operators)
+	require.Zero(t, cfg.Limits.AutoAway, "explicit zero flags still override")
+	require.Equal(t, "motd.tmpl", cfg.MOTD, "file overrides the defaults")
+	require.Equal(t, 50, cfg.Limits.MaxClients)
+
+	cfg, err = parseFlags(t, "-ssh-policy", "legacy").Load()
+	require.NoError(t, err)
+	require.Equal(t, Security{Policy: "legacy"}, cfg.Security)
+
+	require.NoError(t, os.WriteFile(path, []byte("addr: \":4022\"\nlimits:\n  max_clients: 10\n"), 0o600))
+	cfg, err = loader.Load()
+	require.NoError(t, err)
+	require.Equal(t, ":3022", cfg.Addr, "flag overrides survive a reload")
+	require.Equal(t, 10, cfg.Limits.MaxClients, "reload picks up file changes")
+	require.Empty(t, cfg.MOTD, "keys removed from the file fall back to defaults")
+}
+
+func TestLoaderDataDir(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := parseFlags(t, "-data-dir", dir).Load()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "ssh_host_key"), cfg.HostKey)
+	require.Equal(t, filepath.Join(dir, "schat.db"), cfg.DB)
+	require.Equal(t, filepath.Join(dir, "archive"), cfg.Archive.Dir)
+	require.Equal(t, filepath.Join(dir, "audit.log"), cfg.AuditFile)
+	require.Equal(t, filepath.Join(dir, "bans.json"), cfg.BanFile)
+
+	path := writeConfig(t, "schat.yaml", "data_dir: /var/lib/schat\nhost_key: /etc/schat/host_key\n")
+	cfg, err = parseFlags(t, "-config", path, "-db", "chat.db").Load()
+	require.NoError(t, err)
+	require.Equal(t, "/etc/schat/host_key", cfg.HostKey, "explicit paths win")
+	require.Equal(t, "chat.db", cfg.DB)
+	require.Equal(t, "/var/lib/schat/archive", cfg.Archive.Dir)
+
+	cfg, err = parseFlags(t).Load()
+	require.NoError(t, err)
+	require.Equal(t, DefaultHostKey, cfg.HostKey, "without a data dir nothing moves")
+	require.Empty(t, cfg.DB)
+}
+
+func TestLoaderRejectsInvalidConfig(t *testing.T) {
+	path := writeConfig(t, "schat.toml", "profile = \"tiny\"\n[limits]\nmax_per_ip = -1\n")
+	_, err := parseFlags(t, "-config", path).Load()
+	require.ErrorContains(t, err, "unknown profile")
+	require.ErrorContains(t, err, "must not be negative")
+
+	_, err = parseFlags(t, "-log-level", "loud", "-log-format", "xml", "-log-room-level", "chatty").Load()
+	require.ErrorContains(t, err, `log level "loud"`)
+	require.ErrorContains(t, err, `log format "xml"`)
+	require.ErrorContains(t, err, `log room level "chatty"`)
+
+	_, err = parseFlags(t, "-webhook-urls", "https://hooks.example.com/a,ftp://example.com").Load()
+	require.ErrorContains(t, err, `webhooks outbound "ftp://example.com" is not an http(s) URL`)
+	require.NotContains(t, err.Error(), "hooks.example.com/a")
+
+	path = writeConfig(t, "schat.yaml", "fail_ban: {ban_for: 1h, max_ban: 10m}\n")
+	_, err = parseFlags(t, "-config", path).Load()
+	require.ErrorContains(t, err, "fail_ban window and ban_for must be positive and max_ban at least ban_for")
+	_, err = parseFlags(t, "-config", path, "-fail-ban", "0").Load()
+	require.NoError(t, err, "a disabled fail ban is not checked")
+
+	_, err = parseFlags(t, "-drain-timeout", "-1s").Load()
+	require.ErrorContains(t, err, "drain_timeout must not be negative")
+
+	_, err = parseFlags(t, "-proxy-protocol", "10.0.0.0/8,lb.example.com").Load()
+	require.ErrorContains(t, err, `proxy_protocol "lb.example.com" is not an address or CIDR range`)
+	require.NotContains(t, err.Error(), `"10.0.0.0/8"`)
+
+	path = writeConfig(t, "schat.yaml", "admin_api: {addr: \"127.0.0.1:9300\", token_env: \"\"}\n")
+	_, err = parseFlags(t, "-config", path).Load()
+	require.ErrorContains(t, err, "admin_api token_env must not be empty when admin_api addr is set")
+
+	_, err = parseFlags(t, "-room-backend", "etcd").Load()
+	require.ErrorContains(t, err, `room_backend type "etcd" must be memory, redis, or nats`)
+	_, err = parseFlags(t, "-room-backend", "redis").Load()
+	require.ErrorContains(t, err, "room_backend redis needs redis addr")
+	_, err = parseFlags(t, "-room-backend", "nats").Load()
+	require.ErrorContains(t, err, "room_backend nats needs nats url")
+	path = writeConfig(t, "schat.yaml", "room_backend: {type: nats, nats: {url: \"nats://127.0.0.1:4222\", stream: \"chat.rooms\", retention: -1h}}\n")
+	_, err = parseFlags(t, "-config", path).Load()
+	require.ErrorContains(t, err, `room_backend nats stream "chat.rooms" may only use letters, digits, '-' and '_'`)
+	require.ErrorContains(t, err, "room_backend nats retention must not be negative")
+	require.NotContains(t, err.Error(), "prefix")
+
+	_, err = parseFlags(t, "-control-api-addr", "127.0.0.1:9400").Load()
+	require.ErrorContains(t, err, "control_api tls needs cert, key, and ca when control_api addr is set")
+
+	_, err = parseFlags(t, "-web-addr", ":8080", "-auth", "pubkey", "-authorized-keys", "keys").Load()
+	require.ErrorContains(t, err, "web_gateway needs token_file, or auth mode none, for browsers to sign in")
+	cfg, err := parseFlags(t, "-web-addr", ":8080", "-auth", "pubkey", "-authorized-keys", "keys", "-token-file", "tokens.json").Load()
+	require.NoError(t, err)
+	require.Equal(t, ":8080", cfg.WebGateway.Addr)
+
+	_, err = parseFlags(t, "-telnet-addr", ":2323", "-auth", "pubkey", "-authorized-keys", "keys").Load()
+	require.ErrorContains(t, err, "telnet needs auth mode none, as telnet users cannot authenticate")
+	cfg, err = parseFlags(t, "-telnet-addr", ":2323").Load()
+	require.NoError(t, err)
+	require.Equal(t, ":2323", cfg.Telnet.Addr)
+
+	_, err = parseFlags(t, "-db-key-env", "SCHAT_DB_KEY").Load()
+	require.ErrorContains(t, err, "db_key_env needs db to be set")
+
+	_, err = parseFlags(t, "-identities-file", "identities.json").Load()
+	require.ErrorContains(t, err, "auth identities_file needs the pubkey mode")
+
+	_, err = parseFlags(t, "-archive-inactive", "-24h").Load()
+	require.ErrorContains(t, err, "durations must not be negative")
+
+	_, err = parseFlags(t, "-probe-interval", "3s").Load()
+	require.ErrorContains(t, err, "probes timeout must be positive and shorter than interval")
+
+	_, err = parseFlags(t, "-hardened", "-run-as", "schat").Load()
+	require.ErrorContains(t, err, "hardening needs data_dir")
+	cfg, err = parseFlags(t, "-hardened", "-run-as", "schat", "-data-dir", t.TempDir()).Load()
+	require.NoError(t, err)
+	require.Equal(t, Hardening{Enabled: true, User: "schat"}, cfg.Hardening)
+
+	path = writeConfig(t, "schat.yaml", `
+bridges:
+  irc:
+    - {name: libera, server: irc.libera.chat, nick: "bad nick", channels: {schat: lobby}}
+    - {name: libera, server: "irc.oftc.net:6697", nick: bot, channels: {"#ok": lobby}}
+  matrix:
+    - {name: matrix, homeserver: "matrix.example.org", rooms: {"schat": lobby}}
+    - {name: ok, homeserver: "https://matrix.example.org", token_env: T, rooms: {"#ok:example.org": lobby}}
+`)
+	_, err = parseFlags(t, "-config", path).Load()
+	require.ErrorContains(t, err, `bridges irc "libera" server "irc.libera.chat" must be host:port`)
+	require.ErrorContains(t, err, `nick "bad nick" is not a valid nickname`)
+	require.ErrorContains(t, err, `channel "schat" -> room "lobby" is not a valid mapping`)
+	require.ErrorContains(t, err, `bridges irc name "libera" must be set and unique`)
+	require.ErrorContains(t, err, `bridges matrix "matrix" homeserver "matrix.example.org" is not an http(s) URL`)
+	require.ErrorContains(t, err, `bridges matrix "matrix" must set token_env`)
+	require.ErrorContains(t, err, `bridges matrix "matrix" room "schat" -> room "lobby" is not a valid mapping`)
+	require.NotContains(t, err.Error(), "#ok")
+
+	path = writeConfig(t, "schat.yaml", `
+webhooks:
+  prompts:
+    - {name: deploy, rooms: [ops], callback: "ci.example.com"}
+    - {name: deploy, callback: "https://ci.example.com/schat"}
+`)
+	_, err = parseFlags(t, "-config", path).Load()
+	require.ErrorContains(t, err, "webhooks prompts need webhooks addr to receive them")
+	require.ErrorContains(t, err, `webhooks prompts "deploy" callback "ci.example.com" is not an http(s) URL`)
+	require.ErrorContains(t, err, `webhooks prompts name "deploy" must be set and unique`)
+	require.ErrorContains(t, err, `webhooks prompts "deploy" must list at least one room`)
+
+	path = writeConfig(t, "schat.yaml", `
+cluster:
+  node: a
+  nodes:
+    - {id: a, addr: "chat-a:2222", admin: "http://10.0.0.1:9100"}
+    - {id: b, addr: "chat-b:2222", admin: "https://10.0.0.2:9100"}
+  tls: {cert: a.crt, key: a.key}
+`)
+	_, err = parseFlags(t, "-config", path).Load()
+	require.ErrorContains(t, err, "cluster tls needs cert, key, and ca")
+	require.ErrorContains(t, err, `cluster node "a" admin "http://10.0.0.1:9100" must be an https URL`)
+	require.NotContains(t, err.Error(), `"b"`)
+
+	path = writeConfig(t, "schat.yaml", `
+cluster:
+  node: a
+  replicate: true
+  nodes:
+    - {id: a, addr: "chat-a:2222", admin: "http://10.0.0.1:9100"}
+    - {id: b, addr: "chat-b:2222"}
+room_backend: {type: redis, redis: {addr: "127.0.0.1:6379"}}
+`)
+	_, err = parseFlags(t, "-config", path).Load()
+	require.ErrorContains(t, err, "cluster replicate needs cluster tls")
+	require.ErrorContains(t, err, "cluster replicate needs metrics_addr")
+	require.ErrorContains(t, err, "room_backend redis and cluster replicate both share messages between servers")
+	require.ErrorContains(t, err, `cluster node "b" needs an admin URL when cluster replicate is set`)
+	require.NotContains(t, err.Error(), `node "a" needs`)
+
+	path = writeConfig(t, "schat.yaml", `
+secrets:
+  vault: {addr: "vault.example.com:8200", token: "vault:auth/token"}
+`)
+	_, err = parseFlags(t, "-config", path).Load()
+	require.ErrorContains(t, err, `secrets vault addr "vault.example.com:8200" must be an http or https URL`)
+	require.ErrorContains(t, err, "secrets vault token must be set and must not be a vault: reference")
+}
+
+func TestRestartRequired(t *testing.T) {
+	base := Default()
+	next := base
+	next.MOTD = "motd.tmpl"
+	next.Operators = []string{"alice"}
+	next.Limits.MaxClients = 10
+	next.Limits.AutoAway = time.Minute
+	next.Log.Level = "debug"
+	next.Log.RoomLevel = "error"
+	require.Empty(t, base.RestartRequired(next), "reloadable settings")
+
+	next.Addr = ":3022"
+	next.Auth.Modes = []string{"pubkey"}
+	next.Tuning.QueueSize = 4
+	next.Log.RoomLevel = LogRoomOff
+	next.Hardening.Enabled = true
+	require.Equal(t, []string{"addr", "auth", "log.room_level", "hardening", "tuning"}, base.RestartRequired(next))
+}
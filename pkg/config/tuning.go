@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// Profile names accepted by Config.Profile.
+const (
+	ProfileDefault   = "default"
+	ProfileSmallVPS  = "small-vps"
+	ProfileBigServer = "big-server"
+)
+
+// Tuning groups the performance knobs that trade memory for throughput.
+// Zero values mean "use the profile's value".
+type Tuning struct {
+	// QueueSize is the per-client outbound message queue length.
+	QueueSize int `yaml:"queue_size" toml:"queue_size"`
+	// HistorySize is how many recent messages each room keeps in memory.
+	HistorySize int `yaml:"history_size" toml:"history_size"`
+	// RelayWorkers is the number of goroutines multiplexing outbound writes.
+	RelayWorkers int `yaml:"relay_workers" toml:"relay_workers"`
+	// GOGC sets the garbage collector target percentage. Left to the
+	// profile, it gives way to a GOGC environment variable.
+	GOGC int `yaml:"gogc" toml:"gogc"`
+	// MemoryLimit is a soft heap limit in bytes handed to the runtime; 0 disables it.
+	MemoryLimit int64 `yaml:"memory_limit" toml:"memory_limit"`
+}
+
+var profiles = map[string]Tuning{
+	ProfileDefault: {
+		QueueSize:    16,
+		HistorySize:  100,
+		RelayWorkers: runtime.GOMAXPROCS(0) * 4,
+		GOGC:         100,
+	},
+	// small-vps favours a low, steady footprint on 512 MiB - 1 GiB machines.
+	ProfileSmallVPS: {
+		QueueSize:    8,
+		HistorySize:  50,
+		RelayWorkers: 2,
+		GOGC:         50,
+		MemoryLimit:  256 << 20,
+	},
+	// big-server trades memory for fewer GC cycles and deeper buffers.
+	ProfileBigServer: {
+		QueueSize:    64,
+		HistorySize:  1000,
+		RelayWorkers: runtime.GOMAXPROCS(0) * 8,
+		GOGC:         200,
+	},
+}
+
+// Profiles lists the available preset names in sorted order.
+func Profiles() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset returns the tuning for a named profile. An empty name selects the default.
+func Preset(name string) (Tuning, error) {
+	if name == "" {
+		name = ProfileDefault
+	}
+	tuning, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return Tuning{}, fmt.Errorf("config: unknown profile %q (want one of %s)", name, strings.Join(Profiles(), ", "))
+	}
+	return tuning, nil
+}
+
+// Merge returns t with every zero field filled from base.
+func (t Tuning) Merge(base Tuning) Tuning {
+	if t.QueueSize == 0 {
+		t.QueueSize = base.QueueSize
+	}
+	if t.HistorySize == 0 {
+		t.HistorySize = base.HistorySize
+	}
+	if t.RelayWorkers == 0 {
+		t.RelayWorkers = base.RelayWorkers
+	}
+	if t.GOGC == 0 {
+		t.GOGC = base.GOGC
+	}
+	if t.MemoryLimit == 0 {
+		t.MemoryLimit = base.MemoryLimit
+	}
+	return t
+}
+
+// ApplyRuntime pushes the garbage collector settings into the Go runtime. A
+// zero GOGC leaves the runtime's own, e.g. from the environment.
+func (t Tuning) ApplyRuntime() {
+	if t.GOGC != 0 {
+		debug.SetGCPercent(t.GOGC)
+	}
+	if t.MemoryLimit > 0 {
+		debug.SetMemoryLimit(t.MemoryLimit)
+	}
+}
+
+// String summarises the tuning for startup logs.
+func (t Tuning) String() string {
+	limit := "off"
+	if t.MemoryLimit > 0 {
+		limit = fmt.Sprintf("%dMiB", t.MemoryLimit>>20)
+	}
+	gogc := "env"
+	if t.GOGC != 0 {
+		gogc = fmt.Sprint(t.GOGC)
+	}
+	return fmt.Sprintf("queue=%d history=%d relay_workers=%d gogc=%s memory_limit=%s",
+		t.QueueSize, t.HistorySize, t.RelayWorkers, gogc, limit)
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEffectiveTuning(t *testing.T) {
+	cases := []struct {
+		name    string
+		cfg     Config
+		want    func(Tuning) bool
+		wantErr bool
+	}{
+		{
+			name: "default profile",
+			cfg:  Config{},
+			want: func(t Tuning) bool { return t.QueueSize == 16 && t.HistorySize == 100 },
+		},
+		{
+			name: "small vps preset",
+			cfg:  Config{Profile: ProfileSmallVPS},
+			want: func(t Tuning) bool { return t.RelayWorkers == 2 && t.MemoryLimit == 256<<20 },
+		},
+		{
+			name: "override wins over preset",
+			cfg:  Config{Profile: ProfileBigServer, Tuning: Tuning{QueueSize: 5}},
+			want: func(t Tuning) bool { return t.QueueSize == 5 && t.HistorySize == 1000 },
+		},
+		{
+			name:    "unknown profile",
+			cfg:     Config{Profile: "tiny"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.cfg.EffectiveTuning()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, tc.want(got), "unexpected tuning %s", got)
+		})
+	}
+}
+
+func TestEffectiveTuningDefersToGOGCEnv(t *testing.T) {
+	t.Setenv("GOGC", "400")
+
+	got, err := Config{Profile: ProfileSmallVPS}.EffectiveTuning()
+	require.NoError(t, err)
+	require.Zero(t, got.GOGC, "the environment wins over the profile")
+	require.Contains(t, got.String(), "gogc=env")
+
+	got, err = Config{Profile: ProfileSmallVPS, Tuning: Tuning{GOGC: 80}}.EffectiveTuning()
+	require.NoError(t, err)
+	require.Equal(t, 80, got.GOGC, "tuning.gogc wins over the environment")
+}
@@ -0,0 +1,205 @@
+// Package controlapi serves the gRPC control API, a typed alternative to the
+// admin HTTP API for tooling and dashboards: it lists and kicks sessions,
+// posts announcements, reports room statistics, and streams room messages.
+// Clients authenticate with a certificate signed by the CA the server trusts.
+package controlapi
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/ledzpl/schat/pkg/adminapi"
+	"github.com/ledzpl/schat/pkg/controlapi/controlpb"
+)
+
+// DefaultActor is the name kicks and announcements are shown and audited
+// under when the client certificate has no common name.
+const DefaultActor = "control-api"
+
+// ErrUnknownSession is returned by a Backend asked to kick a session that is
+// not connected; the service answers it with NotFound.
+var ErrUnknownSession = errors.New("controlapi: no such session")
+
+// RoomStats describes a room and the memory it holds.
+type RoomStats struct {
+	adminapi.Room
+	HistoryMessages int
+	HistoryBytes    int64
+	QueuedBytes     int64
+}
+
+// Backend is the server the API reports on and acts upon. Rooms it does not
+// know are reported with adminapi.ErrUnknownRoom.
+type Backend interface {
+	Sessions() []adminapi.Session
+	// KickSession disconnects the session with id, telling its room why, and
+	// returns its user, or ErrUnknownSession.
+	KickSession(actor, id, reason string) (string, error)
+	// Broadcast posts text from actor to room, or to every room when room is
+	// empty, and returns how many rooms that was.
+	Broadcast(actor, room, text string) (int, error)
+	// RoomStats reports on room, or on every room when room is empty.
+	RoomStats(room string) ([]RoomStats, error)
+	// Watch delivers the messages posted in room, or in every room when room
+	// is empty, until stop is called. A watcher that falls behind misses
+	// messages rather than holding up the room.
+	Watch(room string) (msgs <-chan adminapi.Message, stop func(), err error)
+}
+
+// NewServer returns a gRPC server offering the control API over TLS with
+// tlsConfig, which should require client certificates.
+func NewServer(tlsConfig *tls.Config, backend Backend) *grpc.Server {
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	Register(srv, backend)
+	return srv
+}
+
+// Register adds the control API for backend to srv.
+func Register(srv *grpc.Server, backend Backend) {
+	controlpb.RegisterControlServer(srv, &service{backend: backend})
+}
+
+type service struct {
+	controlpb.UnimplementedControlServer
+	backend Backend
+}
+
+func (s *service) ListSessions(_ context.Context, req *controlpb.ListSessionsRequest) (*controlpb.ListSessionsResponse, error) {
+	room := roomName(req.GetRoom())
+	resp := &controlpb.ListSessionsResponse{}
+	for _, session := range s.backend.Sessions() {
+		if room != "" && session.Room != room {
+			continue
+		}
+		resp.Sessions = append(resp.Sessions, &controlpb.Session{
+			Id:            session.ID,
+			User:          session.User,
+			Room:          session.Room,
+			RemoteAddr:    session.RemoteAddr,
+			ClientVersion: session.ClientVersion,
+			AuthMethod:    session.AuthMethod,
+			Operator:      session.Operator,
+			JoinedAt:      timestamp(session.JoinedAt),
+			LastActive:    timestamp(session.LastActive),
+		})
+	}
+	return resp, nil
+}
+
+func (s *service) KickSession(ctx context.Context, req *controlpb.KickSessionRequest) (*controlpb.KickSessionResponse, error) {
+	if req.GetSessionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+	user, err := s.backend.KickSession(actor(ctx), req.GetSessionId(), strings.TrimSpace(req.GetReason()))
+	if err != nil {
+		return nil, statusFor(err)
+	}
+	return &controlpb.KickSessionResponse{User: user}, nil
+}
+
+func (s *service) Broadcast(ctx context.Context, req *controlpb.BroadcastRequest) (*controlpb.BroadcastResponse, error) {
+	text := strings.TrimSpace(req.GetText())
+	if text == "" {
+		return nil, status.Error(codes.InvalidArgument, "text is required")
+	}
+	rooms, err := s.backend.Broadcast(actor(ctx), roomName(req.GetRoom()), text)
+	if err != nil {
+		return nil, statusFor(err)
+	}
+	return &controlpb.BroadcastResponse{Rooms: int32(rooms)}, nil
+}
+
+func (s *service) GetRoomStats(_ context.Context, req *controlpb.GetRoomStatsRequest) (*controlpb.GetRoomStatsResponse, error) {
+	stats, err := s.backend.RoomStats(roomName(req.GetRoom()))
+	if err != nil {
+		return nil, statusFor(err)
+	}
+	resp := &controlpb.GetRoomStatsResponse{}
+	for _, room := range stats {
+		resp.Rooms = append(resp.Rooms, &controlpb.RoomStats{
+			Name:            room.Name,
+			Topic:           room.Topic,
+			Owner:           room.Owner,
+			Members:         int32(room.Members),
+			Archived:        room.Archived,
+			LastActivity:    timestamp(room.LastActivity),
+			HistoryMessages: int32(room.HistoryMessages),
+			HistoryBytes:    room.HistoryBytes,
+			QueuedBytes:     room.QueuedBytes,
+		})
+	}
+	return resp, nil
+}
+
+func (s *service) StreamMessages(req *controlpb.StreamMessagesRequest, stream controlpb.Control_StreamMessagesServer) error {
+	msgs, stop, err := s.backend.Watch(roomName(req.GetRoom()))
+	if err != nil {
+		return statusFor(err)
+	}
+	defer stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case msg := <-msgs:
+			err := stream.Send(&controlpb.Message{
+				Room: msg.Room,
+				Id:   msg.ID,
+				Time: timestamp(msg.Time),
+				Kind: msg.Kind,
+				From: msg.From,
+				Body: msg.Body,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// actor names the caller by the common name of its client certificate.
+func actor(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return DefaultActor
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 {
+		return DefaultActor
+	}
+	if name := info.State.VerifiedChains[0][0].Subject.CommonName; name != "" {
+		return name
+	}
+	return DefaultActor
+}
+
+// statusFor maps backend errors to gRPC status codes.
+func statusFor(err error) error {
+	switch {
+	case errors.Is(err, adminapi.ErrUnknownRoom), errors.Is(err, ErrUnknownSession):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func roomName(room string) string {
+	return strings.TrimPrefix(strings.TrimSpace(room), "#")
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
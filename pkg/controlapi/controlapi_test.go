@@ -0,0 +1,227 @@
+package controlapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/ledzpl/schat/pkg/adminapi"
+	"github.com/ledzpl/schat/pkg/controlapi/controlpb"
+)
+
+// testCA issues certificates for 127.0.0.1.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "schat control CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+type fakeBackend struct {
+	kicked    []string
+	announced []string
+	msgs      chan adminapi.Message
+	watching  chan string
+}
+
+func (b *fakeBackend) Sessions() []adminapi.Session {
+	return []adminapi.Session{
+		{ID: "1", User: "alice", Room: "lobby"},
+		{ID: "2", User: "bob", Room: "dev", AuthMethod: "publickey"},
+	}
+}
+
+func (b *fakeBackend) KickSession(actor, id, reason string) (string, error) {
+	if id != "2" {
+		return "", ErrUnknownSession
+	}
+	b.kicked = append(b.kicked, actor+" "+id+" "+reason)
+	return "bob", nil
+}
+
+func (b *fakeBackend) Broadcast(actor, room, text string) (int, error) {
+	if room != "" && room != "dev" {
+		return 0, adminapi.ErrUnknownRoom
+	}
+	b.announced = append(b.announced, actor+" "+room+" "+text)
+	if room == "" {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+func (b *fakeBackend) RoomStats(room string) ([]RoomStats, error) {
+	if room != "" && room != "dev" {
+		return nil, adminapi.ErrUnknownRoom
+	}
+	return []RoomStats{{Room: adminapi.Room{Name: "dev", Members: 1}, HistoryMessages: 3, HistoryBytes: 300}}, nil
+}
+
+func (b *fakeBackend) Watch(room string) (<-chan adminapi.Message, func(), error) {
+	if room != "" && room != "dev" {
+		return nil, nil, adminapi.ErrUnknownRoom
+	}
+	b.watching <- room
+	return b.msgs, func() {}, nil
+}
+
+// serve starts the control API with mutual TLS and returns its address.
+func serve(t *testing.T, ca *testCA, backend Backend) string {
+	t.Helper()
+	srv := NewServer(&tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{ca.issue(t, "server")},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, backend)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+	return ln.Addr().String()
+}
+
+func dial(t *testing.T, addr string, ca *testCA, certs ...tls.Certificate) controlpb.ControlClient {
+	t.Helper()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		RootCAs:      ca.pool,
+		Certificates: certs,
+	})))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return controlpb.NewControlClient(conn)
+}
+
+func TestControlAPI(t *testing.T) {
+	ca := newTestCA(t)
+	backend := &fakeBackend{msgs: make(chan adminapi.Message, 1), watching: make(chan string, 1)}
+	client := dial(t, serve(t, ca, backend), ca, ca.issue(t, "dashboard"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := client.ListSessions(ctx, &controlpb.ListSessionsRequest{Room: "#dev"})
+	require.NoError(t, err)
+	require.Len(t, sessions.Sessions, 1)
+	require.Equal(t, "bob", sessions.Sessions[0].User)
+	require.Equal(t, "publickey", sessions.Sessions[0].AuthMethod)
+	require.Nil(t, sessions.Sessions[0].JoinedAt, "unknown times are left out")
+	sessions, err = client.ListSessions(ctx, &controlpb.ListSessionsRequest{})
+	require.NoError(t, err)
+	require.Len(t, sessions.Sessions, 2)
+
+	kicked, err := client.KickSession(ctx, &controlpb.KickSessionRequest{SessionId: "2", Reason: " spam "})
+	require.NoError(t, err)
+	require.Equal(t, "bob", kicked.User)
+	require.Equal(t, []string{"dashboard 2 spam"}, backend.kicked, "the client certificate names the actor")
+	_, err = client.KickSession(ctx, &controlpb.KickSessionRequest{SessionId: "9"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.KickSession(ctx, &controlpb.KickSessionRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	sent, err := client.Broadcast(ctx, &controlpb.BroadcastRequest{Text: "restart at 10"})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, sent.Rooms)
+	sent, err = client.Broadcast(ctx, &controlpb.BroadcastRequest{Text: "deploying", Room: "dev"})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, sent.Rooms)
+	require.Equal(t, []string{"dashboard  restart at 10", "dashboard dev deploying"}, backend.announced)
+	_, err = client.Broadcast(ctx, &controlpb.BroadcastRequest{Text: " "})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Broadcast(ctx, &controlpb.BroadcastRequest{Text: "hi", Room: "ops"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	stats, err := client.GetRoomStats(ctx, &controlpb.GetRoomStatsRequest{Room: "dev"})
+	require.NoError(t, err)
+	require.Len(t, stats.Rooms, 1)
+	require.Equal(t, "dev", stats.Rooms[0].Name)
+	require.EqualValues(t, 3, stats.Rooms[0].HistoryMessages)
+	require.EqualValues(t, 300, stats.Rooms[0].HistoryBytes)
+	_, err = client.GetRoomStats(ctx, &controlpb.GetRoomStatsRequest{Room: "ops"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	stream, err := client.StreamMessages(ctx, &controlpb.StreamMessagesRequest{Room: "dev"})
+	require.NoError(t, err)
+	require.Equal(t, "dev", <-backend.watching)
+	now := time.Now()
+	backend.msgs <- adminapi.Message{Room: "dev", ID: 7, Time: now, Kind: "chat", From: "alice", Body: "hello"}
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "dev", msg.Room)
+	require.EqualValues(t, 7, msg.Id)
+	require.True(t, now.Equal(msg.Time.AsTime()))
+	require.Equal(t, "alice", msg.From)
+	require.Equal(t, "hello", msg.Body)
+
+	stream, err = client.StreamMessages(ctx, &controlpb.StreamMessagesRequest{Room: "ops"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestControlAPIRequiresClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	addr := serve(t, ca, &fakeBackend{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := dial(t, addr, ca).ListSessions(ctx, &controlpb.ListSessionsRequest{})
+	require.Equal(t, codes.Unavailable, status.Code(err), "no certificate")
+
+	rogue := newTestCA(t)
+	_, err = dial(t, addr, ca, rogue.issue(t, "dashboard")).ListSessions(ctx, &controlpb.ListSessionsRequest{})
+	require.Equal(t, codes.Unavailable, status.Code(err), "a certificate from another CA")
+}
@@ -0,0 +1,5 @@
+// Package controlpb holds the protocol buffer messages and gRPC stubs of the
+// control API, generated from control.proto.
+package controlpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto
@@ -0,0 +1,193 @@
+// Package features implements runtime feature flags. Flags have a deployment
+// default that can be overridden globally or for a single room while the server
+// is running, so risky capabilities can be rolled out and rolled back without a
+// redeploy.
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Flag names a toggleable capability.
+type Flag string
+
+// Known flags. Every flag is off unless enabled by configuration or at runtime.
+const (
+	Reactions  Flag = "reactions"
+	Bridges    Flag = "bridges"
+	WebGateway Flag = "web-gateway"
+	WordFilter Flag = "word-filter"
+	AutoMod    Flag = "automod"
+)
+
+var known = map[Flag]string{
+	Reactions:  "emoji reactions on messages",
+	Bridges:    "relaying rooms to external chat networks",
+	WebGateway: "browser access over WebSocket",
+	WordFilter: "masking or blocking listed words in messages",
+	AutoMod:    "automatic moderation of spam, shouting, and join flooding",
+}
+
+// Known lists the registered flags in sorted order.
+func Known() []Flag {
+	flags := make([]Flag, 0, len(known))
+	for flag := range known {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+	return flags
+}
+
+// Lookup resolves a flag by name.
+func Lookup(name string) (Flag, error) {
+	flag := Flag(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := known[flag]; !ok {
+		names := make([]string, 0, len(known))
+		for _, f := range Known() {
+			names = append(names, string(f))
+		}
+		return "", fmt.Errorf("features: unknown flag %q (want one of %s)", name, strings.Join(names, ", "))
+	}
+	return flag, nil
+}
+
+// Describe returns the one-line description of flag.
+func (f Flag) Describe() string {
+	return known[f]
+}
+
+// Parse reads a comma-separated list such as "reactions,bridges=false". A bare
+// name enables the flag; name=value accepts anything strconv.ParseBool does.
+func Parse(spec string) (map[Flag]bool, error) {
+	values := make(map[Flag]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, raw, hasValue := strings.Cut(item, "=")
+		flag, err := Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		on := true
+		if hasValue {
+			if on, err = strconv.ParseBool(strings.TrimSpace(raw)); err != nil {
+				return nil, fmt.Errorf("features: flag %q: invalid value %q", name, raw)
+			}
+		}
+		values[flag] = on
+	}
+	return values, nil
+}
+
+// Set holds the flag state for a deployment. A nil *Set reports every flag off.
+type Set struct {
+	mu       sync.RWMutex
+	defaults map[Flag]bool
+	global   map[Flag]bool
+	rooms    map[string]map[Flag]bool
+}
+
+// New returns a Set using defaults as the configured deployment values.
+func New(defaults map[Flag]bool) *Set {
+	s := &Set{
+		defaults: make(map[Flag]bool, len(defaults)),
+		global:   make(map[Flag]bool),
+		rooms:    make(map[string]map[Flag]bool),
+	}
+	for flag, on := range defaults {
+		s.defaults[flag] = on
+	}
+	return s
+}
+
+// Enabled reports whether flag is on in room. A room override wins over a
+// runtime global override, which wins over the configured default.
+func (s *Set) Enabled(flag Flag, room string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if on, ok := s.rooms[room][flag]; ok {
+		return on
+	}
+	if on, ok := s.global[flag]; ok {
+		return on
+	}
+	return s.defaults[flag]
+}
+
+// Set overrides flag for room, or for the whole deployment when room is empty.
+func (s *Set) Set(room string, flag Flag, on bool) error {
+	if _, ok := known[flag]; !ok {
+		return fmt.Errorf("features: unknown flag %q", flag)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room == "" {
+		s.global[flag] = on
+		return nil
+	}
+	if s.rooms[room] == nil {
+		s.rooms[room] = make(map[Flag]bool)
+	}
+	s.rooms[room][flag] = on
+	return nil
+}
+
+// Reset removes the runtime override of flag for room, or the global override
+// when room is empty, falling back to the next level.
+func (s *Set) Reset(room string, flag Flag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room == "" {
+		delete(s.global, flag)
+		return
+	}
+	delete(s.rooms[room], flag)
+	if len(s.rooms[room]) == 0 {
+		delete(s.rooms, room)
+	}
+}
+
+// State describes one flag for reporting.
+type State struct {
+	Flag        Flag            `json:"flag"`
+	Description string          `json:"description"`
+	Default     bool            `json:"default"`
+	Global      *bool           `json:"global,omitempty"`
+	Rooms       map[string]bool `json:"rooms,omitempty"`
+}
+
+// Snapshot returns the state of every known flag.
+func (s *Set) Snapshot() []State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	states := make([]State, 0, len(known))
+	for _, flag := range Known() {
+		st := State{Flag: flag, Description: flag.Describe(), Default: s.defaults[flag]}
+		if on, ok := s.global[flag]; ok {
+			st.Global = &on
+		}
+		for room, overrides := range s.rooms {
+			if on, ok := overrides[flag]; ok {
+				if st.Rooms == nil {
+					st.Rooms = make(map[string]bool)
+				}
+				st.Rooms[room] = on
+			}
+		}
+		states = append(states, st)
+	}
+	return states
+}
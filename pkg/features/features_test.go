@@ -0,0 +1,77 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[Flag]bool
+		wantErr bool
+	}{
+		{name: "empty", spec: "", want: map[Flag]bool{}},
+		{name: "bare names enable", spec: "reactions, bridges", want: map[Flag]bool{Reactions: true, Bridges: true}},
+		{name: "explicit values", spec: "reactions=false,web-gateway=1", want: map[Flag]bool{Reactions: false, WebGateway: true}},
+		{name: "case insensitive", spec: "Reactions", want: map[Flag]bool{Reactions: true}},
+		{name: "unknown flag", spec: "teleport", wantErr: true},
+		{name: "bad value", spec: "reactions=maybe", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSetPrecedence(t *testing.T) {
+	set := New(map[Flag]bool{Reactions: true})
+
+	require.True(t, set.Enabled(Reactions, "lobby"))
+	require.False(t, set.Enabled(Bridges, "lobby"))
+
+	require.NoError(t, set.Set("", Reactions, false))
+	require.False(t, set.Enabled(Reactions, "lobby"), "global override beats the default")
+
+	require.NoError(t, set.Set("lobby", Reactions, true))
+	require.True(t, set.Enabled(Reactions, "lobby"), "room override beats the global override")
+	require.False(t, set.Enabled(Reactions, "ops"))
+
+	set.Reset("lobby", Reactions)
+	require.False(t, set.Enabled(Reactions, "lobby"))
+	set.Reset("", Reactions)
+	require.True(t, set.Enabled(Reactions, "lobby"), "resetting falls back to the default")
+
+	require.Error(t, set.Set("", Flag("teleport"), true))
+
+	var nilSet *Set
+	require.False(t, nilSet.Enabled(Reactions, "lobby"))
+}
+
+func TestSnapshot(t *testing.T) {
+	set := New(map[Flag]bool{Bridges: true})
+	require.NoError(t, set.Set("", Reactions, true))
+	require.NoError(t, set.Set("ops", Reactions, false))
+
+	states := set.Snapshot()
+	require.Len(t, states, len(Known()))
+
+	byFlag := make(map[Flag]State)
+	for _, st := range states {
+		byFlag[st.Flag] = st
+	}
+	require.True(t, byFlag[Bridges].Default)
+	require.Nil(t, byFlag[Bridges].Global)
+	require.True(t, *byFlag[Reactions].Global)
+	require.Equal(t, map[string]bool{"ops": false}, byFlag[Reactions].Rooms)
+}
@@ -0,0 +1,56 @@
+package features
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Handler serves the flag state as JSON and accepts runtime toggles:
+//
+//	GET                               list every flag
+//	POST   flag=NAME&enabled=BOOL[&room=ROOM]  set an override
+//	DELETE flag=NAME[&room=ROOM]              clear an override
+//
+// Parameters go in the query string, or in a form body for POST. Mount it only
+// on an address reachable by administrators.
+func (s *Set) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodDelete:
+			if err := s.applyRequest(r); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.Snapshot())
+	})
+}
+
+func (s *Set) applyRequest(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	flag, err := Lookup(r.Form.Get("flag"))
+	if err != nil {
+		return err
+	}
+	room := r.Form.Get("room")
+
+	if r.Method == http.MethodDelete {
+		s.Reset(room, flag)
+		return nil
+	}
+	on, err := strconv.ParseBool(r.Form.Get("enabled"))
+	if err != nil {
+		return err
+	}
+	return s.Set(room, flag, on)
+}
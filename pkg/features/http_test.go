@@ -0,0 +1,59 @@
+package features
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerTogglesFlags(t *testing.T) {
+	set := New(nil)
+	h := set.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var states []State
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &states))
+	require.Len(t, states, len(Known()))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("flag=reactions&enabled=true&room=lobby"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, set.Enabled(Reactions, "lobby"))
+	require.False(t, set.Enabled(Reactions, "ops"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/?flag=reactions&room=lobby", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.False(t, set.Enabled(Reactions, "lobby"))
+}
+
+func TestHandlerRejectsBadRequests(t *testing.T) {
+	h := New(nil).Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{name: "unknown flag", method: http.MethodPost, target: "/?flag=teleport&enabled=true", want: http.StatusBadRequest},
+		{name: "bad value", method: http.MethodPost, target: "/?flag=reactions&enabled=maybe", want: http.StatusBadRequest},
+		{name: "method", method: http.MethodPut, target: "/", want: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			require.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
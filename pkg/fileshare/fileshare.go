@@ -0,0 +1,235 @@
+// Package fileshare keeps small files users share in chat rooms. Files live in
+// memory until they expire, bounded per file and in total, so a restart
+// discards them.
+package fileshare
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	idBytes       = 6
+	maxNameLength = 64
+)
+
+var (
+	// ErrTooLarge is returned for uploads over the per-file limit.
+	ErrTooLarge = errors.New("fileshare: file is too large")
+	// ErrFull is returned when an upload would exceed the total limit.
+	ErrFull = errors.New("fileshare: storage is full")
+	// ErrNotFound is returned for unknown or expired files.
+	ErrNotFound = errors.New("fileshare: no such file")
+	// ErrBadName is returned for names with nothing usable in them.
+	ErrBadName = errors.New("fileshare: file name is empty")
+)
+
+// File describes a shared file.
+type File struct {
+	ID      string
+	Name    string
+	Room    string
+	Owner   string
+	Size    int64
+	Created time.Time
+	Expires time.Time
+}
+
+// Store holds shared files. It is safe for concurrent use.
+type Store struct {
+	maxBytes   int64
+	totalBytes int64
+	ttl        time.Duration
+	clock      func() time.Time
+
+	mu    sync.Mutex
+	files map[string]stored
+	used  int64
+}
+
+type stored struct {
+	File
+	data []byte
+}
+
+// Option customises a Store.
+type Option func(*Store)
+
+// WithClock replaces time.Now, for tests.
+func WithClock(clock func() time.Time) Option {
+	return func(s *Store) {
+		if clock != nil {
+			s.clock = clock
+		}
+	}
+}
+
+// New returns an empty store accepting files up to maxBytes each and
+// totalBytes together, each kept for ttl.
+func New(maxBytes, totalBytes int64, ttl time.Duration, opts ...Option) *Store {
+	s := &Store{
+		maxBytes:   maxBytes,
+		totalBytes: totalBytes,
+		ttl:        ttl,
+		clock:      time.Now,
+		files:      make(map[string]stored),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// MaxBytes returns the per-file size limit.
+func (s *Store) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// Put reads a file from r and shares it in room. name is reduced to its base
+// name without control characters.
+func (s *Store) Put(owner, room, name string, r io.Reader) (File, error) {
+	name = CleanName(name)
+	if name == "" {
+		return File{}, ErrBadName
+	}
+	data, err := io.ReadAll(io.LimitReader(r, s.maxBytes+1))
+	if err != nil {
+		return File{}, fmt.Errorf("fileshare: %w", err)
+	}
+	if int64(len(data)) > s.maxBytes {
+		return File{}, ErrTooLarge
+	}
+	id, err := newID()
+	if err != nil {
+		return File{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock()
+	s.pruneLocked(now)
+	if s.used+int64(len(data)) > s.totalBytes {
+		return File{}, ErrFull
+	}
+	f := File{
+		ID:      id,
+		Name:    name,
+		Room:    room,
+		Owner:   owner,
+		Size:    int64(len(data)),
+		Created: now,
+		Expires: now.Add(s.ttl),
+	}
+	s.files[id] = stored{File: f, data: data}
+	s.used += f.Size
+	return f, nil
+}
+
+// Open returns a file and its contents.
+func (s *Store) Open(id string) (File, io.Reader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(s.clock())
+	f, ok := s.files[strings.ToLower(id)]
+	if !ok {
+		return File{}, nil, ErrNotFound
+	}
+	return f.File, bytes.NewReader(f.data), nil
+}
+
+// List returns the files shared in room, oldest first.
+func (s *Store) List(room string) []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(s.clock())
+	var out []File
+	for _, f := range s.files {
+		if f.Room == room {
+			out = append(out, f.File)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Created.Equal(out[j].Created) {
+			return out[i].Created.Before(out[j].Created)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Delete removes a file shared by owner.
+func (s *Store) Delete(owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[strings.ToLower(id)]
+	if !ok || f.Owner != owner {
+		return ErrNotFound
+	}
+	delete(s.files, f.ID)
+	s.used -= f.Size
+	return nil
+}
+
+func (s *Store) pruneLocked(now time.Time) {
+	for id, f := range s.files {
+		if !now.Before(f.Expires) {
+			delete(s.files, id)
+			s.used -= f.Size
+		}
+	}
+}
+
+// CleanName reduces name to a short base name that is safe to show and to use
+// as a local file name in a shell command: control characters are dropped and
+// spaces become underscores.
+func CleanName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Join(strings.Fields(name), "_")
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+	return name
+}
+
+func newID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("fileshare: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// FormatSize renders n bytes for people, e.g. "12.3 KB".
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
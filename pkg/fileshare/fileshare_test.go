@@ -0,0 +1,88 @@
+package fileshare
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorePutOpenList(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	s := New(10, 15, time.Hour, WithClock(func() time.Time { return now }))
+
+	a, err := s.Put("alice", "lobby", "../notes/todo.txt", strings.NewReader("buy milk"))
+	require.NoError(t, err)
+	require.Equal(t, "todo.txt", a.Name)
+	require.Equal(t, int64(8), a.Size)
+	require.Len(t, a.ID, 2*idBytes)
+	require.Equal(t, now.Add(time.Hour), a.Expires)
+
+	now = now.Add(time.Minute)
+	b, err := s.Put("bob", "dev", "x", strings.NewReader("12345"))
+	require.NoError(t, err)
+
+	f, r, err := s.Open(strings.ToUpper(a.ID))
+	require.NoError(t, err)
+	require.Equal(t, a, f)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "buy milk", string(data))
+
+	require.Equal(t, []File{a}, s.List("lobby"))
+	require.Equal(t, []File{b}, s.List("dev"))
+	require.Empty(t, s.List("random"))
+}
+
+func TestStoreLimits(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	s := New(10, 15, time.Hour, WithClock(func() time.Time { return now }))
+
+	_, err := s.Put("alice", "lobby", "big", strings.NewReader("01234567890"))
+	require.ErrorIs(t, err, ErrTooLarge)
+	_, err = s.Put("alice", "lobby", "a", strings.NewReader("0123456789"))
+	require.NoError(t, err)
+	_, err = s.Put("alice", "lobby", "b", strings.NewReader("0123456789"))
+	require.ErrorIs(t, err, ErrFull)
+	_, err = s.Put("alice", "lobby", "/", strings.NewReader("x"))
+	require.ErrorIs(t, err, ErrBadName)
+
+	now = now.Add(time.Hour)
+	require.Empty(t, s.List("lobby"), "expired")
+	_, err = s.Put("alice", "lobby", "b", strings.NewReader("0123456789"))
+	require.NoError(t, err, "expired files free their space")
+}
+
+func TestStoreDelete(t *testing.T) {
+	s := New(10, 100, time.Hour)
+	f, err := s.Put("alice", "lobby", "a", strings.NewReader("hi"))
+	require.NoError(t, err)
+
+	require.ErrorIs(t, s.Delete("bob", f.ID), ErrNotFound, "only the owner may delete")
+	require.NoError(t, s.Delete("alice", f.ID))
+	_, _, err = s.Open(f.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCleanName(t *testing.T) {
+	cases := map[string]string{
+		"report.pdf":             "report.pdf",
+		"/etc/passwd":            "passwd",
+		`C:\Users\a\b.txt`:       "b.txt",
+		"..":                     "",
+		"  my notes.txt  ":       "my_notes.txt",
+		"bell\a.txt":             "bell.txt",
+		strings.Repeat("x", 100): strings.Repeat("x", maxNameLength),
+	}
+	for in, want := range cases {
+		require.Equal(t, want, CleanName(in), in)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	require.Equal(t, "512 B", FormatSize(512))
+	require.Equal(t, "1.5 KB", FormatSize(1536))
+	require.Equal(t, "2.0 MB", FormatSize(2<<20))
+}
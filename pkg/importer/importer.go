@@ -0,0 +1,234 @@
+// Package importer reads chat logs written by other chat servers and clients
+// into history store records, so a community moving to schat keeps its
+// searchable past. Speakers in the logs have no accounts here; they are given
+// names like the ones bridged users get, e.g. alice@irc.
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+// Format names a log format Read understands.
+type Format string
+
+const (
+	// FormatSSHChat is a transcript of an ssh-chat session, as the client
+	// printed it with /timestamp on.
+	FormatSSHChat Format = "ssh-chat"
+	// FormatIRC is an IRC log as written by irssi, ZNC, or WeeChat.
+	FormatIRC Format = "irc"
+	// FormatJSONL is one JSON object per line, such as a schat room archive or
+	// a log of outbound webhook payloads.
+	FormatJSONL Format = "jsonl"
+)
+
+var formats = []Format{FormatSSHChat, FormatIRC, FormatJSONL}
+
+// Formats returns the names of the formats Read understands.
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for _, f := range formats {
+		names = append(names, string(f))
+	}
+	return names
+}
+
+// ParseFormat returns the format called name.
+func ParseFormat(name string) (Format, error) {
+	for _, f := range formats {
+		if string(f) == strings.ToLower(name) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("importer: unknown format %q (want %s)", name, strings.Join(Formats(), ", "))
+}
+
+// maxLineBytes bounds one line of a log.
+const maxLineBytes = 1 << 20
+
+// ErrNoDate is reported for a time of day before the log said which day it
+// is and no day was set with WithDate.
+var ErrNoDate = errors.New("a time of day comes before any date")
+
+// Option customises Read.
+type Option func(*parser)
+
+// WithRoom sets the room records are imported into, unless the log names
+// one itself. The default is "lobby".
+func WithRoom(room string) Option {
+	return func(p *parser) {
+		p.room = room
+	}
+}
+
+// WithOrigin appends "@origin" to every sender, marking them as imported
+// rather than as local users. An empty origin keeps the names as they are.
+func WithOrigin(origin string) Option {
+	return func(p *parser) {
+		p.origin = origin
+	}
+}
+
+// WithLocation sets the time zone of timestamps that do not carry one. The
+// default is the local time zone.
+func WithLocation(loc *time.Location) Option {
+	return func(p *parser) {
+		if loc != nil {
+			p.loc = loc
+		}
+	}
+}
+
+// WithDate sets the day of timestamps that only carry a time of day, until
+// the log itself says which day it is.
+func WithDate(date time.Time) Option {
+	return func(p *parser) {
+		p.date = date
+	}
+}
+
+// WithDecrypt opens the sealed senders and bodies of a schat room archive
+// written with history encryption on, e.g. with store.Encrypted.Open. Lines
+// that name no room are opened with the key of the room set by WithRoom.
+func WithDecrypt(open func(room, field, text string) (string, error)) Option {
+	return func(p *parser) {
+		p.open = open
+	}
+}
+
+// Stats counts what Read did with the lines of a log.
+type Stats struct {
+	// Records is how many records were passed on.
+	Records int
+	// Skipped is how many non-empty lines held nothing to import, such as
+	// direct messages or client status lines.
+	Skipped int
+}
+
+// parser holds the state of one Read.
+type parser struct {
+	room   string
+	origin string
+	loc    *time.Location
+	date   time.Time
+	open   func(room, field, text string) (string, error)
+}
+
+// Read parses the log in r and passes each message it holds to fn, in the
+// order they appear. It stops at the first line it cannot make sense of, or
+// the first error fn returns.
+func Read(r io.Reader, format Format, fn func(store.Record) error, opts ...Option) (Stats, error) {
+	p := &parser{room: "lobby", loc: time.Local}
+	for _, opt := range opts {
+		opt(p)
+	}
+	var parse func(line string) (store.Record, bool, error)
+	switch format {
+	case FormatSSHChat:
+		parse = p.sshChat
+	case FormatIRC:
+		parse = p.irc
+	case FormatJSONL:
+		parse = p.jsonl
+	default:
+		return Stats{}, fmt.Errorf("importer: unknown format %q", format)
+	}
+
+	var stats Stats
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineBytes)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rec, ok, err := parse(line)
+		if err != nil {
+			return stats, fmt.Errorf("importer: line %d: %w", n, err)
+		}
+		if !ok {
+			stats.Skipped++
+			continue
+		}
+		if rec.Room == "" {
+			rec.Room = p.room
+		}
+		if err := fn(rec); err != nil {
+			return stats, err
+		}
+		stats.Records++
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("importer: %w", err)
+	}
+	return stats, nil
+}
+
+// sender returns the name an imported speaker is stored under.
+func (p *parser) sender(nick string) string {
+	if p.origin == "" {
+		return nick
+	}
+	return nick + "@" + p.origin
+}
+
+// clockLayouts are the timestamps logs write, longest first.
+var clockLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// timeOfDayLayouts are timestamps that need a date from elsewhere.
+var timeOfDayLayouts = []string{"15:04:05", "15:04"}
+
+// at parses a timestamp from a log, taking the date from the parser when it
+// only holds a time of day.
+func (p *parser) at(text string) (time.Time, bool, error) {
+	for _, layout := range clockLayouts {
+		if t, err := time.ParseInLocation(layout, text, p.loc); err == nil {
+			return t, true, nil
+		}
+	}
+	for _, layout := range timeOfDayLayouts {
+		t, err := time.Parse(layout, text)
+		if err != nil {
+			continue
+		}
+		if p.date.IsZero() {
+			return time.Time{}, true, ErrNoDate
+		}
+		y, m, d := p.date.Date()
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, p.loc), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// cutTimestamp splits a leading "[timestamp]" or bare timestamp off line.
+func (p *parser) cutTimestamp(line string) (time.Time, string, bool, error) {
+	if rest, ok := strings.CutPrefix(line, "["); ok {
+		stamp, rest, ok := strings.Cut(rest, "]")
+		if !ok {
+			return time.Time{}, line, false, nil
+		}
+		t, ok, err := p.at(stamp)
+		return t, strings.TrimLeft(rest, " "), ok, err
+	}
+	// A bare timestamp may itself hold a space, as in "2024-05-01 09:30".
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) == 3 {
+		if t, ok, err := p.at(fields[0] + " " + fields[1]); ok {
+			return t, strings.TrimLeft(fields[2], " "), true, err
+		}
+	}
+	stamp, rest, _ := strings.Cut(line, " ")
+	t, ok, err := p.at(stamp)
+	return t, strings.TrimLeft(rest, " "), ok, err
+}
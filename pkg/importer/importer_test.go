@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+// readAll reads log in format and returns the records.
+func readAll(t *testing.T, format Format, log string, opts ...Option) ([]store.Record, Stats) {
+	t.Helper()
+	var recs []store.Record
+	stats, err := Read(strings.NewReader(log), format, func(rec store.Record) error {
+		recs = append(recs, rec)
+		return nil
+	}, opts...)
+	require.NoError(t, err)
+	return recs, stats
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("IRC")
+	require.NoError(t, err)
+	require.Equal(t, FormatIRC, f)
+	_, err = ParseFormat("slack")
+	require.ErrorContains(t, err, "want ssh-chat, irc, jsonl")
+}
+
+func TestReadDefaultsAndOptions(t *testing.T) {
+	log := "[2024-05-01 09:30:00] alice: hi\n\n[2024-05-01 09:31:00] -> you are now away\n"
+	recs, stats := readAll(t, FormatSSHChat, log, WithLocation(time.UTC))
+	require.Equal(t, Stats{Records: 1, Skipped: 1}, stats, "blank lines are not counted")
+	require.Equal(t, store.Record{
+		Room:      "lobby",
+		Timestamp: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC),
+		Kind:      "chat",
+		Sender:    "alice",
+		Body:      "hi",
+	}, recs[0])
+
+	recs, _ = readAll(t, FormatSSHChat, log, WithRoom("dev"), WithOrigin("oldchat"))
+	require.Equal(t, "dev", recs[0].Room)
+	require.Equal(t, "alice@oldchat", recs[0].Sender)
+}
+
+func TestReadTimeOfDayNeedsDate(t *testing.T) {
+	_, err := Read(strings.NewReader("x\n[09:30] alice: hi\n"), FormatSSHChat, func(store.Record) error { return nil })
+	require.ErrorIs(t, err, ErrNoDate)
+	require.ErrorContains(t, err, "line 2")
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	recs, _ := readAll(t, FormatSSHChat, "[09:30] alice: hi\n", WithDate(day), WithLocation(time.UTC))
+	require.Equal(t, time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC), recs[0].Timestamp)
+}
+
+func TestReadStopsOnCallbackError(t *testing.T) {
+	boom := errors.New("disk full")
+	stats, err := Read(strings.NewReader("[2024-05-01 09:30] a: 1\n[2024-05-01 09:31] b: 2\n"), FormatSSHChat, func(store.Record) error { return boom })
+	require.ErrorIs(t, err, boom)
+	require.Zero(t, stats.Records)
+}
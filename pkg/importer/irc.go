@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+// ircModePrefixes mark channel operators, voiced users, and the like in front
+// of a nick.
+const ircModePrefixes = "~&@%+"
+
+// ircDayLayouts are the dates irssi writes in "--- Log opened" and "--- Day
+// changed" lines.
+var ircDayLayouts = []string{
+	"Mon Jan 02 15:04:05 2006",
+	"Mon Jan 2 15:04:05 2006",
+	"Mon Jan 02 2006",
+	"Mon Jan 2 2006",
+}
+
+// irc parses a line of an IRC log in any of these styles:
+//
+//	09:30 <@alice> hello                        irssi
+//	09:30  * alice waves
+//	09:30 -!- bob [~bob@host] has joined #dev
+//	--- Day changed Thu May 02 2024
+//	[09:30:00] <alice> hello                    ZNC
+//	[09:30:00] *** Joins: bob (~bob@host)
+//	2024-05-01 09:30:00<TAB>alice<TAB>hello     WeeChat
+//	2024-05-01 09:30:00<TAB> *<TAB>alice waves
+//
+// Times of day take their date from the last "Log opened" or "Day changed"
+// line, or from WithDate.
+func (p *parser) irc(line string) (store.Record, bool, error) {
+	if fields := strings.SplitN(line, "\t", 3); len(fields) == 3 {
+		return p.weechat(fields)
+	}
+	for _, prefix := range []string{"--- Log opened ", "--- Day changed "} {
+		if day, ok := strings.CutPrefix(line, prefix); ok {
+			p.setDay(day)
+			return store.Record{}, false, nil
+		}
+	}
+
+	ts, rest, ok, err := p.cutTimestamp(line)
+	if !ok || err != nil {
+		return store.Record{}, false, err
+	}
+	rec := store.Record{Timestamp: ts}
+	switch {
+	case strings.HasPrefix(rest, "<"):
+		nick, body, ok := strings.Cut(rest[1:], "> ")
+		if !ok {
+			return store.Record{}, false, nil
+		}
+		rec.Kind, rec.Sender, rec.Body = "chat", p.ircSender(nick), body
+	case strings.HasPrefix(rest, "-!- "), strings.HasPrefix(rest, "*** "):
+		rec.Kind, rec.Body = "system", strings.TrimSpace(rest[4:])
+	case strings.HasPrefix(rest, "* "):
+		nick, body, ok := strings.Cut(rest[2:], " ")
+		if !ok {
+			return store.Record{}, false, nil
+		}
+		rec.Kind, rec.Sender, rec.Body = "action", p.ircSender(nick), body
+	default:
+		return store.Record{}, false, nil
+	}
+	if rec.Sender == "" && rec.Kind != "system" {
+		return store.Record{}, false, nil
+	}
+	return rec, true, nil
+}
+
+// weechat parses the tab-separated date, prefix, and text of a WeeChat log
+// line.
+func (p *parser) weechat(fields []string) (store.Record, bool, error) {
+	ts, ok, err := p.at(fields[0])
+	if !ok || err != nil {
+		return store.Record{}, false, err
+	}
+	prefix, text := strings.TrimSpace(fields[1]), fields[2]
+	rec := store.Record{Timestamp: ts}
+	switch prefix {
+	case "*":
+		nick, body, ok := strings.Cut(text, " ")
+		if !ok {
+			return store.Record{}, false, nil
+		}
+		rec.Kind, rec.Sender, rec.Body = "action", p.ircSender(nick), body
+	case "-->", "<--", "--", "=!=":
+		rec.Kind, rec.Body = "system", strings.TrimSpace(text)
+	case "":
+		return store.Record{}, false, nil
+	default:
+		rec.Kind, rec.Sender, rec.Body = "chat", p.ircSender(prefix), text
+	}
+	return rec, true, nil
+}
+
+// setDay takes the date of later times of day from an irssi date line.
+func (p *parser) setDay(day string) {
+	for _, layout := range ircDayLayouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(day), p.loc); err == nil {
+			p.date = t
+			return
+		}
+	}
+}
+
+// ircSender strips the channel mode from a nick.
+func (p *parser) ircSender(nick string) string {
+	nick = strings.TrimLeft(strings.TrimSpace(nick), ircModePrefixes)
+	if nick == "" {
+		return ""
+	}
+	return p.sender(nick)
+}
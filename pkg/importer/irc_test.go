@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIRCIrssiLog(t *testing.T) {
+	log := `--- Log opened Wed May 01 09:00:00 2024
+09:30 -!- bob [~bob@example.org] has joined #dev
+09:31 <@alice> hello
+09:32  * bob waves
+--- Day changed Thu May 02 2024
+00:05 <+bob> past midnight
+--- Log closed Thu May 02 00:10:00 2024
+`
+	recs, stats := readAll(t, FormatIRC, log, WithOrigin("irc"), WithLocation(time.UTC))
+	require.Equal(t, Stats{Records: 4, Skipped: 3}, stats)
+
+	require.Equal(t, "system", recs[0].Kind)
+	require.Equal(t, "bob [~bob@example.org] has joined #dev", recs[0].Body)
+	require.Equal(t, "alice@irc", recs[1].Sender, "channel modes are dropped")
+	require.Equal(t, time.Date(2024, 5, 1, 9, 31, 0, 0, time.UTC), recs[1].Timestamp)
+	require.Equal(t, "action", recs[2].Kind)
+	require.Equal(t, "waves", recs[2].Body)
+	require.Equal(t, "bob@irc", recs[3].Sender)
+	require.Equal(t, time.Date(2024, 5, 2, 0, 5, 0, 0, time.UTC), recs[3].Timestamp)
+}
+
+func TestIRCZNCLog(t *testing.T) {
+	log := `[09:30:00] *** Joins: bob (~bob@example.org)
+[09:30:05] <bob> hi all
+[09:30:09] * bob waves
+`
+	recs, _ := readAll(t, FormatIRC, log, WithDate(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)), WithLocation(time.UTC))
+	require.Len(t, recs, 3)
+	require.Equal(t, "Joins: bob (~bob@example.org)", recs[0].Body)
+	require.Equal(t, "bob", recs[1].Sender)
+	require.Equal(t, time.Date(2024, 5, 1, 9, 30, 5, 0, time.UTC), recs[1].Timestamp)
+	require.Equal(t, "action", recs[2].Kind)
+}
+
+func TestIRCWeeChatLog(t *testing.T) {
+	log := "2024-05-01 09:30:00\t-->\tbob (~bob@example.org) has joined #dev\n" +
+		"2024-05-01 09:30:05\t@alice\thello\tthere\n" +
+		"2024-05-01 09:30:09\t *\tbob waves\n" +
+		"2024-05-01 09:30:10\t\tnothing to see\n"
+	recs, stats := readAll(t, FormatIRC, log, WithLocation(time.UTC))
+	require.Equal(t, Stats{Records: 3, Skipped: 1}, stats)
+	require.Equal(t, "system", recs[0].Kind)
+	require.Equal(t, "alice", recs[1].Sender)
+	require.Equal(t, "hello\tthere", recs[1].Body)
+	require.Equal(t, "action", recs[2].Kind)
+	require.Equal(t, "bob", recs[2].Sender)
+}
@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+// jsonlLine is one line of a JSONL log. Both the field names of schat's room
+// archives and those of its outbound webhook payloads are understood.
+type jsonlLine struct {
+	Time      time.Time `json:"time"`
+	Timestamp time.Time `json:"timestamp"`
+	Room      string    `json:"room"`
+	From      string    `json:"from"`
+	Sender    string    `json:"sender_name"`
+	Kind      string    `json:"kind"`
+	Body      string    `json:"body"`
+	Edited    bool      `json:"edited"`
+	Deleted   bool      `json:"deleted"`
+}
+
+// jsonl parses one JSON object. Kinds other than chat, action, and system,
+// and deleted messages, are skipped; a missing kind is chat.
+func (p *parser) jsonl(line string) (store.Record, bool, error) {
+	var l jsonlLine
+	if err := json.Unmarshal([]byte(line), &l); err != nil {
+		return store.Record{}, false, fmt.Errorf("bad JSON: %w", err)
+	}
+	if l.Time.IsZero() {
+		l.Time = l.Timestamp
+	}
+	if l.Time.IsZero() {
+		return store.Record{}, false, errors.New("no time or timestamp")
+	}
+	if l.From == "" {
+		l.From = l.Sender
+	}
+	switch l.Kind {
+	case "":
+		l.Kind = "chat"
+	case "chat", "action", "system":
+	default:
+		return store.Record{}, false, nil
+	}
+	if l.Deleted {
+		return store.Record{}, false, nil
+	}
+	if p.open != nil {
+		room := l.Room
+		if room == "" {
+			room = p.room
+		}
+		var err error
+		if l.Body, err = p.open(room, "body", l.Body); err != nil {
+			return store.Record{}, false, err
+		}
+		if l.From, err = p.open(room, "sender", l.From); err != nil {
+			return store.Record{}, false, err
+		}
+	}
+	rec := store.Record{Room: l.Room, Timestamp: l.Time, Kind: l.Kind, Body: l.Body, Edited: l.Edited}
+	if l.From != "" {
+		rec.Sender = p.sender(l.From)
+	}
+	return rec, true, nil
+}
@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+func TestJSONLArchivesAndWebhookPayloads(t *testing.T) {
+	log := `{"v":1,"room":"dev","time":"2024-05-01T09:30:00Z","kind":"chat","from":"alice","body":"deploying now"}
+{"id":7,"timestamp":"2024-05-01T09:31:00Z","sender_name":"bob","body":"ok","kind":"chat","edited":true}
+{"timestamp":"2024-05-01T09:32:00Z","sender_name":"bob","kind":"chat","deleted":true}
+{"timestamp":"2024-05-01T09:33:00Z","body":"carol joined the chat","kind":"system"}
+{"timestamp":"2024-05-01T09:34:00Z","sender_name":"bob","kind":"direct","body":"secret"}
+`
+	recs, stats := readAll(t, FormatJSONL, log, WithRoom("lobby"))
+	require.Equal(t, Stats{Records: 3, Skipped: 2}, stats)
+	require.Equal(t, store.Record{Room: "dev", Timestamp: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC), Kind: "chat", Sender: "alice", Body: "deploying now"}, recs[0])
+	require.Equal(t, "lobby", recs[1].Room, "lines without a room go to WithRoom")
+	require.True(t, recs[1].Edited)
+	require.Equal(t, "system", recs[2].Kind)
+	require.Empty(t, recs[2].Sender)
+}
+
+func TestJSONLRejectsBadLines(t *testing.T) {
+	for line, want := range map[string]string{
+		`{"body":"when?"}`: "line 1: no time or timestamp",
+		`not json`:         "line 1: bad JSON",
+	} {
+		_, err := Read(strings.NewReader(line), FormatJSONL, func(store.Record) error { return nil })
+		require.ErrorContains(t, err, want)
+	}
+}
+
+func TestJSONLOpensSealedArchives(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	sealed, err := store.NewEncrypted(nil, secret)
+	require.NoError(t, err)
+	from, err := sealed.Seal("dev", "sender", "alice")
+	require.NoError(t, err)
+	body, err := sealed.Seal("dev", "body", "ship it")
+	require.NoError(t, err)
+	log := `{"timestamp":"2024-05-01T09:30:00Z","sender_name":"` + from + `","body":"` + body + `","kind":"chat"}
+{"timestamp":"2024-05-01T09:31:00Z","sender_name":"bob","body":"written before encryption","kind":"chat"}
+`
+	recs, _ := readAll(t, FormatJSONL, log, WithRoom("dev"), WithDecrypt(sealed.Open), WithOrigin("old"))
+	require.Equal(t, "alice@old", recs[0].Sender)
+	require.Equal(t, "ship it", recs[0].Body)
+	require.Equal(t, "written before encryption", recs[1].Body)
+
+	_, err = Read(strings.NewReader(log), FormatJSONL, func(store.Record) error { return nil }, WithRoom("ops"), WithDecrypt(sealed.Open))
+	require.ErrorIs(t, err, store.ErrDecrypt, "each room has its own key")
+}
@@ -0,0 +1,42 @@
+package importer
+
+import (
+	"strings"
+
+	"github.com/ledzpl/schat/pkg/store"
+)
+
+// sshChat parses a line of an ssh-chat transcript:
+//
+//	[2024-05-01 09:30:00] alice: hello
+//	[2024-05-01 09:30:05] ** alice waves
+//	[2024-05-01 09:30:09]  * bob joined. (Connected: 2)
+//
+// Lines without a timestamp, direct messages, and command output ("-> ...")
+// are skipped.
+func (p *parser) sshChat(line string) (store.Record, bool, error) {
+	ts, rest, ok, err := p.cutTimestamp(line)
+	if !ok || err != nil {
+		return store.Record{}, false, err
+	}
+	rec := store.Record{Timestamp: ts}
+	switch {
+	case strings.HasPrefix(rest, "** "):
+		nick, body, ok := strings.Cut(strings.TrimPrefix(rest, "** "), " ")
+		if !ok || nick == "" {
+			return store.Record{}, false, nil
+		}
+		rec.Kind, rec.Sender, rec.Body = "action", p.sender(nick), body
+	case strings.HasPrefix(rest, "* "):
+		rec.Kind, rec.Body = "system", strings.TrimSpace(strings.TrimPrefix(rest, "* "))
+	case strings.HasPrefix(rest, "-> "), strings.HasPrefix(rest, "[PM "):
+		return store.Record{}, false, nil
+	default:
+		nick, body, ok := strings.Cut(rest, ": ")
+		if !ok || nick == "" || strings.ContainsAny(nick, " \t") {
+			return store.Record{}, false, nil
+		}
+		rec.Kind, rec.Sender, rec.Body = "chat", p.sender(nick), body
+	}
+	return rec, true, nil
+}
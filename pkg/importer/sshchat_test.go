@@ -0,0 +1,33 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHChatTranscript(t *testing.T) {
+	log := `[2024-05-01 09:30:00]  * bob joined. (Connected: 2)
+[2024-05-01 09:30:05] alice: morning: coffee?
+[2024-05-01 09:30:09] ** bob waves
+[2024-05-01 09:30:12] [PM from alice] psst
+[2024-05-01 09:30:15] -> Set theme: mono
+no timestamp: ignored
+`
+	recs, stats := readAll(t, FormatSSHChat, log, WithOrigin("ssh-chat"), WithLocation(time.UTC))
+	require.Equal(t, Stats{Records: 3, Skipped: 3}, stats)
+
+	require.Equal(t, "system", recs[0].Kind)
+	require.Equal(t, "bob joined. (Connected: 2)", recs[0].Body)
+	require.Empty(t, recs[0].Sender)
+
+	require.Equal(t, "chat", recs[1].Kind)
+	require.Equal(t, "alice@ssh-chat", recs[1].Sender)
+	require.Equal(t, "morning: coffee?", recs[1].Body)
+
+	require.Equal(t, "action", recs[2].Kind)
+	require.Equal(t, "bob@ssh-chat", recs[2].Sender)
+	require.Equal(t, "waves", recs[2].Body)
+	require.Equal(t, time.Date(2024, 5, 1, 9, 30, 9, 0, time.UTC), recs[2].Timestamp)
+}
@@ -0,0 +1,382 @@
+// Package natsroom implements roomstate.Room on NATS JetStream, sharing rooms
+// between servers. Messages posted in a room are published to a stream
+// subject per room, so they stay replayable for as long as the stream keeps
+// them and other services can consume them with a consumer of their own. Who
+// is present is kept in a key-value bucket whose entries expire unless their
+// server refreshes them.
+package natsroom
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+	"github.com/ledzpl/schat/pkg/roomstate"
+)
+
+const (
+	// DefaultStream names the stream that keeps room messages.
+	DefaultStream = "SCHAT"
+	// DefaultPrefix starts every subject and the presence bucket's name.
+	DefaultPrefix = "schat"
+	// DefaultRetention is how long a stream created here keeps messages.
+	DefaultRetention = 7 * 24 * time.Hour
+	// DefaultPresenceTTL is how long a presence entry outlives its last
+	// refresh, so the users of a server that died disappear.
+	DefaultPresenceTTL = 90 * time.Second
+	// opTimeout bounds each call made on behalf of a session.
+	opTimeout = 2 * time.Second
+)
+
+// Backend is one server's connection to the shared room state. It is a
+// roomstate.Backend.
+type Backend struct {
+	js        nats.JetStreamContext
+	server    string
+	stream    string
+	prefix    string
+	retention time.Duration
+	ttl       time.Duration
+	logger    *slog.Logger
+	presence  nats.KeyValue
+
+	mu sync.Mutex
+	// local counts the sessions of each user in each room on this server, so
+	// presence is refreshed while they stay and removed when the last leaves.
+	local map[string]map[string]int
+}
+
+// Option customises a Backend.
+type Option func(*Backend)
+
+// WithStream changes the name of the stream that keeps room messages.
+func WithStream(name string) Option {
+	return func(b *Backend) {
+		if name != "" {
+			b.stream = name
+		}
+	}
+}
+
+// WithPrefix changes the prefix of subjects and of the presence bucket, e.g.
+// to run several deployments against one NATS account.
+func WithPrefix(prefix string) Option {
+	return func(b *Backend) {
+		if prefix != "" {
+			b.prefix = prefix
+		}
+	}
+}
+
+// WithRetention sets how long a stream created by Open keeps messages; zero
+// keeps them until the stream's limits say otherwise.
+func WithRetention(d time.Duration) Option {
+	return func(b *Backend) {
+		if d >= 0 {
+			b.retention = d
+		}
+	}
+}
+
+// WithPresenceTTL sets how long presence entries survive without a refresh
+// in a bucket created by Open.
+func WithPresenceTTL(ttl time.Duration) Option {
+	return func(b *Backend) {
+		if ttl > 0 {
+			b.ttl = ttl
+		}
+	}
+}
+
+// WithLogger sets the destination for NATS failure logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(b *Backend) {
+		if logger != nil {
+			b.logger = logger
+		}
+	}
+}
+
+// Open returns the backend of the server called server, which must be unique
+// among the servers sharing nc's account. It creates the stream and the
+// presence bucket when they do not exist; existing ones are used as they
+// are, so operators may tune their limits and replicas.
+func Open(nc *nats.Conn, server string, opts ...Option) (*Backend, error) {
+	b := &Backend{
+		server:    server,
+		stream:    DefaultStream,
+		prefix:    DefaultPrefix,
+		retention: DefaultRetention,
+		ttl:       DefaultPresenceTTL,
+		logger:    slog.Default(),
+		local:     make(map[string]map[string]int),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(b)
+		}
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("natsroom: %w", err)
+	}
+	b.js = js
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := js.StreamInfo(b.stream, nats.Context(ctx)); errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     b.stream,
+			Subjects: []string{b.subject("*")},
+			MaxAge:   b.retention,
+			Storage:  nats.FileStorage,
+		}, nats.Context(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("natsroom: create stream %s: %w", b.stream, err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("natsroom: stream %s: %w", b.stream, err)
+	}
+
+	bucket := b.prefix + "_presence"
+	b.presence, err = js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		b.presence, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: bucket, TTL: b.ttl, Storage: nats.MemoryStorage})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("natsroom: presence bucket %s: %w", bucket, err)
+	}
+	if status, err := b.presence.Status(); err == nil && status.TTL() > 0 {
+		b.ttl = status.TTL()
+	}
+	return b, nil
+}
+
+// Server returns the name this server is known by to the others.
+func (b *Backend) Server() string {
+	return b.server
+}
+
+// Room returns the room called name.
+func (b *Backend) Room(name string) roomstate.Room {
+	return &Room{b: b, name: name}
+}
+
+// Room is one room kept in JetStream.
+type Room struct {
+	b    *Backend
+	name string
+}
+
+// Name returns the room's name.
+func (r *Room) Name() string {
+	return r.name
+}
+
+// Join records a session of username in the room.
+func (r *Room) Join(username string) {
+	b := r.b
+	b.mu.Lock()
+	users, ok := b.local[r.name]
+	if !ok {
+		users = make(map[string]int)
+		b.local[r.name] = users
+	}
+	users[username]++
+	b.mu.Unlock()
+
+	if _, err := b.presence.PutString(b.presenceKey(r.name, username), member(b.server, username)); err != nil {
+		b.logger.Warn("natsroom: presence update failed", "room", r.name, "user", username, "err", err)
+	}
+}
+
+// Leave forgets a session of username in the room; the user stays present
+// while other sessions remain.
+func (r *Room) Leave(username string) {
+	b := r.b
+	b.mu.Lock()
+	users := b.local[r.name]
+	users[username]--
+	last := users[username] <= 0
+	if last {
+		delete(users, username)
+		if len(users) == 0 {
+			delete(b.local, r.name)
+		}
+	}
+	b.mu.Unlock()
+	if !last {
+		return
+	}
+
+	if err := b.presence.Delete(b.presenceKey(r.name, username)); err != nil {
+		b.logger.Warn("natsroom: presence update failed", "room", r.name, "user", username, "err", err)
+	}
+}
+
+// Members lists who is in the room on every server, ordered by server and
+// user.
+func (r *Room) Members() ([]cluster.Location, error) {
+	b := r.b
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	w, err := b.presence.Watch(r.name+".>", nats.IgnoreDeletes(), nats.Context(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("natsroom: members of %s: %w", r.name, err)
+	}
+	defer w.Stop()
+	var members []cluster.Location
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("natsroom: members of %s: %w", r.name, ctx.Err())
+		case entry := <-w.Updates():
+			// A nil entry marks the end of the current values.
+			if entry == nil {
+				sort.Slice(members, func(i, j int) bool {
+					if members[i].Node != members[j].Node {
+						return members[i].Node < members[j].Node
+					}
+					return members[i].User < members[j].User
+				})
+				return members, nil
+			}
+			server, user, ok := strings.Cut(string(entry.Value()), "\t")
+			if ok {
+				members = append(members, cluster.Location{Node: server, User: user, Room: r.name})
+			}
+		}
+	}
+}
+
+// Publish adds ev, stamped with this server's name and the room's, to the
+// room's subject.
+func (r *Room) Publish(ev cluster.Event) {
+	b := r.b
+	ev.Node = b.server
+	ev.Room = r.name
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if _, err := b.js.Publish(b.subject(ev.Room), body, nats.Context(ctx)); err != nil {
+		b.logger.Warn("natsroom: publish failed", "room", ev.Room, "err", err)
+	}
+}
+
+// Run hands the messages other servers publish from now on to deliver and
+// keeps this server's presence fresh until ctx is cancelled.
+func (b *Backend) Run(ctx context.Context, deliver func(cluster.Event) error) {
+	ticker := time.NewTicker(b.ttl / 3)
+	defer ticker.Stop()
+	var sub *nats.Subscription
+	defer func() {
+		if sub != nil {
+			_ = sub.Unsubscribe()
+		}
+	}()
+	for {
+		if sub == nil {
+			var err error
+			// An ordered consumer is ephemeral and recreates itself after
+			// reconnects, so each server sees every message exactly once.
+			sub, err = b.js.Subscribe(b.subject("*"), func(msg *nats.Msg) {
+				b.receive(msg, deliver)
+			}, nats.DeliverNew(), nats.OrderedConsumer())
+			if err != nil {
+				b.logger.Warn("natsroom: subscribe failed", "stream", b.stream, "err", err)
+				sub = nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.refresh()
+		}
+	}
+}
+
+func (b *Backend) receive(msg *nats.Msg, deliver func(cluster.Event) error) {
+	var ev cluster.Event
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		b.logger.Warn("natsroom: bad message", "subject", msg.Subject, "err", err)
+		return
+	}
+	if ev.Node == b.server || ev.Node == "" {
+		return
+	}
+	if err := deliver(ev); err != nil {
+		b.logger.Debug("natsroom: message rejected", "server", ev.Node, "room", ev.Room, "err", err)
+	}
+}
+
+// Close removes this server's presence entries, e.g. on shutdown. The
+// connection stays open.
+func (b *Backend) Close() error {
+	b.mu.Lock()
+	local := b.local
+	b.local = make(map[string]map[string]int)
+	b.mu.Unlock()
+
+	var errs []error
+	for room, users := range local {
+		for user := range users {
+			if err := b.presence.Delete(b.presenceKey(room, user)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("natsroom: close: %w", err)
+	}
+	return nil
+}
+
+// refresh rewrites this server's presence entries before they expire.
+func (b *Backend) refresh() {
+	b.mu.Lock()
+	var keys [][2]string
+	for room, users := range b.local {
+		for user := range users {
+			keys = append(keys, [2]string{room, user})
+		}
+	}
+	b.mu.Unlock()
+
+	for _, k := range keys {
+		if _, err := b.presence.PutString(b.presenceKey(k[0], k[1]), member(b.server, k[1])); err != nil {
+			b.logger.Warn("natsroom: presence refresh failed", "room", k[0], "err", err)
+		}
+	}
+}
+
+// subject is where the messages of room are published. Room names are
+// valid subject tokens.
+func (b *Backend) subject(room string) string {
+	return b.prefix + ".room." + room
+}
+
+// presenceKey names a user on this server within a room. Servers and users
+// are encoded since keys only allow a few characters besides letters and
+// digits.
+func (b *Backend) presenceKey(room, user string) string {
+	return room + "." + base64.RawURLEncoding.EncodeToString([]byte(b.server)) + "." + base64.RawURLEncoding.EncodeToString([]byte(user))
+}
+
+// member is the value of a presence entry. Usernames never contain tabs.
+func member(server, user string) string {
+	return server + "\t" + user
+}
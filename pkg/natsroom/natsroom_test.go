@@ -0,0 +1,106 @@
+package natsroom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestNames(t *testing.T) {
+	b := &Backend{server: "chat a", prefix: DefaultPrefix}
+	require.Equal(t, "schat.room.dev", b.subject("dev"))
+	require.Equal(t, "dev.Y2hhdCBh.w6lsb2lzZS5i", b.presenceKey("dev", "éloise.b"), "keys hold no dots or spaces but the separators")
+}
+
+func TestReceive(t *testing.T) {
+	b := &Backend{server: "a", logger: discard}
+	var got []cluster.Event
+	deliver := func(ev cluster.Event) error {
+		got = append(got, ev)
+		return nil
+	}
+	msg := func(ev cluster.Event) *nats.Msg {
+		body, err := json.Marshal(ev)
+		require.NoError(t, err)
+		return &nats.Msg{Subject: "schat.room." + ev.Room, Data: body}
+	}
+
+	b.receive(msg(cluster.Event{Node: "a", Room: "dev", Text: "its own"}), deliver)
+	b.receive(msg(cluster.Event{Room: "dev", Text: "from another service"}), deliver)
+	b.receive(&nats.Msg{Subject: "schat.room.dev", Data: []byte("{")}, deliver)
+	b.receive(msg(cluster.Event{Node: "b", Room: "dev", User: "bob", Text: "hello", Action: true}), deliver)
+	require.Equal(t, []cluster.Event{{Node: "b", Room: "dev", User: "bob", Text: "hello", Action: true}}, got)
+}
+
+// TestJetStream needs a NATS server with JetStream enabled, e.g.
+// nats-server -js, at $SCHAT_TEST_NATS_URL.
+func TestJetStream(t *testing.T) {
+	url := os.Getenv("SCHAT_TEST_NATS_URL")
+	if url == "" {
+		t.Skip("SCHAT_TEST_NATS_URL is not set")
+	}
+	prefix := fmt.Sprintf("schattest%d", time.Now().UnixNano())
+	open := func(server string) *Backend {
+		nc, err := nats.Connect(url)
+		require.NoError(t, err)
+		t.Cleanup(nc.Close)
+		b, err := Open(nc, server, WithStream(prefix), WithPrefix(prefix), WithLogger(discard))
+		require.NoError(t, err)
+		return b
+	}
+	a, b := open("a"), open("b")
+	t.Cleanup(func() {
+		_ = a.js.DeleteStream(prefix)
+		_ = a.js.DeleteKeyValue(prefix + "_presence")
+	})
+
+	a.Room("dev").Join("alice")
+	a.Room("dev").Join("alice")
+	b.Room("dev").Join("carol")
+	members, err := b.Room("dev").Members()
+	require.NoError(t, err)
+	require.Equal(t, []cluster.Location{{Node: "a", User: "alice", Room: "dev"}, {Node: "b", User: "carol", Room: "dev"}}, members)
+	a.Room("dev").Leave("alice")
+	members, err = b.Room("dev").Members()
+	require.NoError(t, err)
+	require.Len(t, members, 2, "alice still has a session on a")
+	require.NoError(t, a.Close())
+	members, err = b.Room("dev").Members()
+	require.NoError(t, err)
+	require.Equal(t, []cluster.Location{{Node: "b", User: "carol", Room: "dev"}}, members)
+
+	received := make(chan cluster.Event, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx, func(ev cluster.Event) error {
+		received <- ev
+		return nil
+	})
+	now := time.Now().UTC().Truncate(time.Second)
+	require.Eventually(t, func() bool {
+		a.Room("dev").Publish(cluster.Event{Time: now, User: "alice", Text: "hello"})
+		select {
+		case ev := <-received:
+			require.Equal(t, cluster.Event{Node: "a", Room: "dev", Time: now, User: "alice", Text: "hello"}, ev)
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	info, err := a.js.StreamInfo(prefix)
+	require.NoError(t, err)
+	require.NotZero(t, info.State.Msgs, "messages stay in the stream for replay")
+}
@@ -0,0 +1,316 @@
+// Package redisroom implements roomstate.Room in Redis: who is present is
+// kept in one sorted set per room, and the messages posted travel over
+// pub/sub. Several servers using the same Redis serve the same rooms, and
+// presence outlives the restart of any one of them.
+package redisroom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+	"github.com/ledzpl/schat/pkg/roomstate"
+)
+
+const (
+	// DefaultPrefix starts every key and channel name.
+	DefaultPrefix = "schat"
+	// DefaultPresenceTTL is how long a server's presence entries outlive its
+	// last refresh, so the users of a server that died disappear.
+	DefaultPresenceTTL = 90 * time.Second
+	// opTimeout bounds each Redis call made on behalf of a session.
+	opTimeout = 2 * time.Second
+)
+
+// Backend is one server's connection to the shared room state. It is a
+// roomstate.Backend.
+type Backend struct {
+	client redis.UniversalClient
+	server string
+	prefix string
+	ttl    time.Duration
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu sync.Mutex
+	// local counts the sessions of each user in each room on this server, so
+	// presence is refreshed while they stay and removed when the last leaves.
+	local map[string]map[string]int
+}
+
+// Option customises a Backend.
+type Option func(*Backend)
+
+// WithPrefix changes the prefix of keys and channels, e.g. to run several
+// deployments against one Redis.
+func WithPrefix(prefix string) Option {
+	return func(b *Backend) {
+		if prefix != "" {
+			b.prefix = prefix
+		}
+	}
+}
+
+// WithPresenceTTL sets how long presence entries survive without a refresh.
+func WithPresenceTTL(ttl time.Duration) Option {
+	return func(b *Backend) {
+		if ttl > 0 {
+			b.ttl = ttl
+		}
+	}
+}
+
+// WithLogger sets the destination for Redis failure logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(b *Backend) {
+		if logger != nil {
+			b.logger = logger
+		}
+	}
+}
+
+// New returns the backend of the server called server, which must be unique
+// among the servers sharing client's Redis.
+func New(client redis.UniversalClient, server string, opts ...Option) *Backend {
+	b := &Backend{
+		client: client,
+		server: server,
+		prefix: DefaultPrefix,
+		ttl:    DefaultPresenceTTL,
+		logger: slog.Default(),
+		now:    time.Now,
+		local:  make(map[string]map[string]int),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(b)
+		}
+	}
+	return b
+}
+
+// Server returns the name this server is known by to the others.
+func (b *Backend) Server() string {
+	return b.server
+}
+
+// Room returns the room called name.
+func (b *Backend) Room(name string) roomstate.Room {
+	return &Room{b: b, name: name}
+}
+
+// Room is one room kept in Redis.
+type Room struct {
+	b    *Backend
+	name string
+}
+
+// Name returns the room's name.
+func (r *Room) Name() string {
+	return r.name
+}
+
+// Join records a session of username in the room.
+func (r *Room) Join(username string) {
+	b := r.b
+	b.mu.Lock()
+	users, ok := b.local[r.name]
+	if !ok {
+		users = make(map[string]int)
+		b.local[r.name] = users
+	}
+	users[username]++
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := b.add(ctx, r.name, username); err != nil {
+		b.logger.Warn("redisroom: presence update failed", "room", r.name, "user", username, "err", err)
+	}
+}
+
+// Leave forgets a session of username in the room; the user stays present
+// while other sessions remain.
+func (r *Room) Leave(username string) {
+	b := r.b
+	b.mu.Lock()
+	users := b.local[r.name]
+	users[username]--
+	last := users[username] <= 0
+	if last {
+		delete(users, username)
+		if len(users) == 0 {
+			delete(b.local, r.name)
+		}
+	}
+	b.mu.Unlock()
+	if !last {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := b.client.ZRem(ctx, b.presenceKey(r.name), member(b.server, username)).Err(); err != nil {
+		b.logger.Warn("redisroom: presence update failed", "room", r.name, "user", username, "err", err)
+	}
+}
+
+// Members lists who is in the room on every server, ordered by server and
+// user.
+func (r *Room) Members() ([]cluster.Location, error) {
+	b := r.b
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	names, err := b.client.ZRangeByScore(ctx, b.presenceKey(r.name), &redis.ZRangeBy{
+		Min: strconv.FormatInt(b.now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redisroom: members of %s: %w", r.name, err)
+	}
+	members := make([]cluster.Location, 0, len(names))
+	for _, name := range names {
+		server, user, ok := strings.Cut(name, "\t")
+		if !ok {
+			continue
+		}
+		members = append(members, cluster.Location{Node: server, User: user, Room: r.name})
+	}
+	return members, nil
+}
+
+// Publish posts ev, stamped with this server's name and the room's, to the
+// other servers.
+func (r *Room) Publish(ev cluster.Event) {
+	b := r.b
+	ev.Node = b.server
+	ev.Room = r.name
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	if err := b.client.Publish(ctx, b.channel(r.name), body).Err(); err != nil {
+		b.logger.Warn("redisroom: publish failed", "room", r.name, "err", err)
+	}
+}
+
+// Run hands the messages other servers publish to deliver and keeps this
+// server's presence fresh until ctx is cancelled.
+func (b *Backend) Run(ctx context.Context, deliver func(cluster.Event) error) {
+	sub := b.client.PSubscribe(ctx, b.channel("*"))
+	defer sub.Close()
+	msgs := sub.Channel()
+
+	ticker := time.NewTicker(b.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.refresh(ctx)
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			var ev cluster.Event
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+				b.logger.Warn("redisroom: bad message", "channel", msg.Channel, "err", err)
+				continue
+			}
+			if ev.Node == b.server || ev.Node == "" {
+				continue
+			}
+			if err := deliver(ev); err != nil {
+				b.logger.Debug("redisroom: message rejected", "server", ev.Node, "room", ev.Room, "err", err)
+			}
+		}
+	}
+}
+
+// Close removes this server's presence entries, e.g. on shutdown.
+func (b *Backend) Close() error {
+	b.mu.Lock()
+	local := b.local
+	b.local = make(map[string]map[string]int)
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	var errs []error
+	for room, users := range local {
+		names := make([]any, 0, len(users))
+		for user := range users {
+			names = append(names, member(b.server, user))
+		}
+		if err := b.client.ZRem(ctx, b.presenceKey(room), names...).Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("redisroom: close: %w", err)
+	}
+	return nil
+}
+
+// refresh extends this server's presence entries and prunes expired ones.
+func (b *Backend) refresh(ctx context.Context) {
+	b.mu.Lock()
+	rooms := make(map[string][]string, len(b.local))
+	for room, users := range b.local {
+		for user := range users {
+			rooms[room] = append(rooms[room], user)
+		}
+	}
+	b.mu.Unlock()
+
+	for room, users := range rooms {
+		if err := b.add(ctx, room, users...); err != nil {
+			b.logger.Warn("redisroom: presence refresh failed", "room", room, "err", err)
+		}
+	}
+}
+
+// add marks users present in room until the TTL runs out, pruning entries
+// whose servers stopped refreshing them.
+func (b *Backend) add(ctx context.Context, room string, users ...string) error {
+	now := b.now()
+	expiry := float64(now.Add(b.ttl).Unix())
+	entries := make([]redis.Z, len(users))
+	for i, user := range users {
+		entries[i] = redis.Z{Score: expiry, Member: member(b.server, user)}
+	}
+	key := b.presenceKey(room)
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, entries...)
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now.Unix(), 10))
+		pipe.Expire(ctx, key, b.ttl)
+		return nil
+	})
+	return err
+}
+
+func (b *Backend) presenceKey(room string) string {
+	return b.prefix + ":presence:" + room
+}
+
+func (b *Backend) channel(room string) string {
+	return b.prefix + ":room:" + room
+}
+
+// member names a user on a server within a presence set. Usernames never
+// contain tabs.
+func member(server, user string) string {
+	return server + "\t" + user
+}
@@ -0,0 +1,92 @@
+package redisroom
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+)
+
+func newTestBackends(t *testing.T) (*miniredis.Miniredis, *Backend, *Backend) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return srv, New(client, "a"), New(client, "b")
+}
+
+func TestPresence(t *testing.T) {
+	srv, a, b := newTestBackends(t)
+
+	a.Room("dev").Join("alice")
+	a.Room("dev").Join("alice")
+	a.Room("dev").Join("bob")
+	b.Room("dev").Join("carol")
+	b.Room("ops").Join("carol")
+
+	members, err := b.Room("dev").Members()
+	require.NoError(t, err)
+	require.Equal(t, []cluster.Location{
+		{Node: "a", User: "alice", Room: "dev"},
+		{Node: "a", User: "bob", Room: "dev"},
+		{Node: "b", User: "carol", Room: "dev"},
+	}, members)
+	require.Equal(t, DefaultPresenceTTL, srv.TTL("schat:presence:dev"), "sets of rooms nobody refreshes expire")
+
+	a.Room("dev").Leave("alice")
+	members, err = b.Room("dev").Members()
+	require.NoError(t, err)
+	require.Len(t, members, 3, "alice still has a session on a")
+	a.Room("dev").Leave("alice")
+	members, err = b.Room("dev").Members()
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+
+	// a stops refreshing, as if it crashed; its entries expire while b keeps
+	// its own fresh.
+	later := time.Now().Add(DefaultPresenceTTL + time.Second)
+	a.now, b.now = func() time.Time { return later }, func() time.Time { return later }
+	b.refresh(context.Background())
+	members, err = b.Room("dev").Members()
+	require.NoError(t, err)
+	require.Equal(t, []cluster.Location{{Node: "b", User: "carol", Room: "dev"}}, members)
+
+	require.NoError(t, b.Close())
+	members, err = a.Room("ops").Members()
+	require.NoError(t, err)
+	require.Empty(t, members)
+}
+
+func TestMessages(t *testing.T) {
+	srv, a, b := newTestBackends(t)
+	other := New(redis.NewClient(&redis.Options{Addr: srv.Addr()}), "c", WithPrefix("other"))
+
+	received := make(chan cluster.Event, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Run(ctx, func(ev cluster.Event) error {
+			received <- ev
+			return nil
+		})
+	}()
+	require.Eventually(t, func() bool { return srv.PubSubNumPat() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	b.Room("dev").Publish(cluster.Event{Time: now, User: "bob", Text: "not delivered to its own server"})
+	other.Room("dev").Publish(cluster.Event{Time: now, User: "eve", Text: "another deployment"})
+	a.Room("dev").Publish(cluster.Event{Node: "spoofed", Room: "ops", Time: now, User: "alice", Text: "hello", Action: true})
+
+	require.Equal(t, cluster.Event{Node: "a", Room: "dev", Time: now, User: "alice", Text: "hello", Action: true}, <-received)
+	require.Empty(t, received)
+
+	cancel()
+	<-done
+}
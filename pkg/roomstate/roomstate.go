@@ -0,0 +1,107 @@
+// Package roomstate describes the part of a chat room that can outlive the
+// process serving it: who is present and the messages posted there. Memory
+// keeps that state in this process; redisroom and natsroom keep it where
+// several servers behind a load balancer share it.
+package roomstate
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+)
+
+// Room is the shared state of one chat room as one server sees it.
+type Room interface {
+	// Name returns the room's name.
+	Name() string
+	// Join and Leave record a session of username entering or leaving the
+	// room on this server.
+	Join(username string)
+	Leave(username string)
+	// Members lists who is in the room on every server sharing it, ordered
+	// by server and user.
+	Members() ([]cluster.Location, error)
+	// Publish hands a message posted here to the other servers sharing the
+	// room. The event's Room is the room's name.
+	Publish(ev cluster.Event)
+}
+
+// Backend holds the rooms of one server.
+type Backend interface {
+	// Server names this server among those sharing the rooms.
+	Server() string
+	// Room returns the state of the room called name.
+	Room(name string) Room
+}
+
+// Memory keeps rooms in this process alone: members are the sessions of this
+// server and published messages reach nobody else.
+type Memory struct {
+	server string
+
+	mu sync.Mutex
+	// local counts the sessions of each user in each room.
+	local map[string]map[string]int
+}
+
+// NewMemory returns the rooms of the server called server.
+func NewMemory(server string) *Memory {
+	return &Memory{server: server, local: make(map[string]map[string]int)}
+}
+
+// Server returns the name this server was given.
+func (m *Memory) Server() string {
+	return m.server
+}
+
+// Room returns the room called name.
+func (m *Memory) Room(name string) Room {
+	return memoryRoom{m: m, name: name}
+}
+
+type memoryRoom struct {
+	m    *Memory
+	name string
+}
+
+func (r memoryRoom) Name() string {
+	return r.name
+}
+
+func (r memoryRoom) Join(username string) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	users, ok := r.m.local[r.name]
+	if !ok {
+		users = make(map[string]int)
+		r.m.local[r.name] = users
+	}
+	users[username]++
+}
+
+func (r memoryRoom) Leave(username string) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	users := r.m.local[r.name]
+	users[username]--
+	if users[username] <= 0 {
+		delete(users, username)
+		if len(users) == 0 {
+			delete(r.m.local, r.name)
+		}
+	}
+}
+
+func (r memoryRoom) Members() ([]cluster.Location, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	members := make([]cluster.Location, 0, len(r.m.local[r.name]))
+	for user := range r.m.local[r.name] {
+		members = append(members, cluster.Location{Node: r.m.server, User: user, Room: r.name})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].User < members[j].User })
+	return members, nil
+}
+
+func (r memoryRoom) Publish(cluster.Event) {}
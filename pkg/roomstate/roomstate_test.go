@@ -0,0 +1,36 @@
+package roomstate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/cluster"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory("a")
+	dev := m.Room("dev")
+	require.Equal(t, "dev", dev.Name())
+
+	dev.Join("bob")
+	dev.Join("alice")
+	dev.Join("alice")
+	m.Room("ops").Join("carol")
+	members, err := m.Room("dev").Members()
+	require.NoError(t, err)
+	require.Equal(t, []cluster.Location{
+		{Node: "a", User: "alice", Room: "dev"},
+		{Node: "a", User: "bob", Room: "dev"},
+	}, members)
+
+	dev.Leave("alice")
+	members, err = dev.Members()
+	require.NoError(t, err)
+	require.Len(t, members, 2, "alice still has a session")
+	dev.Leave("alice")
+	dev.Leave("bob")
+	members, err = dev.Members()
+	require.NoError(t, err)
+	require.Empty(t, members)
+}
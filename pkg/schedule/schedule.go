@@ -0,0 +1,229 @@
+// Package schedule parses cron-like schedules: five fields (minute, hour, day
+// of month, month, day of week), descriptors such as "@daily", and fixed
+// intervals such as "@every 30m".
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchLimit bounds how far Next looks for a match, so impossible dates such
+// as February 30 end the search.
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+// minEvery is the shortest "@every" interval.
+const minEvery = time.Minute
+
+var descriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// field is the range of one cron field.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Schedule is a parsed schedule. The zero value never fires.
+type Schedule struct {
+	spec  string
+	every time.Duration
+	// sets holds one bit per allowed value of each field.
+	sets [5]uint64
+	// anyDOM and anyDOW record whether the day fields are "*"; when both are
+	// restricted, matching either one is enough, as in cron.
+	anyDOM, anyDOW bool
+}
+
+// Parse parses spec, e.g. "0 9 * * 1-5", "@daily", or "@every 2h".
+func Parse(spec string) (Schedule, error) {
+	spec = strings.Join(strings.Fields(spec), " ")
+	s := Schedule{spec: spec}
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(rest)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("schedule: %q: %w", spec, err)
+		}
+		if d < minEvery {
+			return Schedule{}, fmt.Errorf("schedule: %q: interval must be at least %s", spec, minEvery)
+		}
+		s.every = d
+		return s, nil
+	}
+
+	expr := spec
+	if strings.HasPrefix(spec, "@") {
+		var ok bool
+		if expr, ok = descriptors[spec]; !ok {
+			return Schedule{}, fmt.Errorf("schedule: unknown descriptor %q", spec)
+		}
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("schedule: %q: want 5 fields (minute hour day month weekday), got %d", spec, len(parts))
+	}
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("schedule: %q: %w", spec, err)
+		}
+		s.sets[i] = set
+	}
+	// Sunday is both 0 and 7.
+	if s.sets[4]&(1<<7) != 0 {
+		s.sets[4] |= 1
+	}
+	s.anyDOM, s.anyDOW = parts[2] == "*", parts[4] == "*"
+	return s, nil
+}
+
+// parseField parses a comma-separated list of values, ranges, and steps.
+func parseField(text string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(text, ",") {
+		span, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s step %q is not a positive number", f.name, stepText)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if span != "*" {
+			loText, hiText, isRange := strings.Cut(span, "-")
+			var err error
+			if lo, err = parseValue(loText, f); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseValue(hiText, f); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("%s range %q runs backwards", f.name, span)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func parseValue(text string, f field) (int, error) {
+	n, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q is not a number", f.name, text)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("%s %d is outside %d-%d", f.name, n, f.min, f.max)
+	}
+	return n, nil
+}
+
+// String returns the schedule as it was written, with spaces normalised.
+func (s Schedule) String() string {
+	return s.spec
+}
+
+// IsZero reports whether s is the zero Schedule.
+func (s Schedule) IsZero() bool {
+	return s.spec == ""
+}
+
+// Next returns the first time after t the schedule fires, in t's location,
+// or the zero time if it never does.
+func (s Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	if s.IsZero() {
+		return time.Time{}
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(searchLimit)
+	for t.Before(limit) {
+		switch {
+		case !s.has(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.has(1, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.has(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) has(i, v int) bool {
+	return s.sets[i]&(1<<v) != 0
+}
+
+func (s Schedule) matchDay(t time.Time) bool {
+	dom, dow := s.has(2, t.Day()), s.has(4, int(t.Weekday()))
+	if s.anyDOM || s.anyDOW {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// ErrEmpty is returned by Split when the text has no schedule in front.
+var ErrEmpty = errors.New("schedule: missing schedule")
+
+// Split separates a schedule written at the start of text from the rest,
+// e.g. "0 9 * * 1 stand-up" or "@every 1h drink water".
+func Split(text string) (Schedule, string, error) {
+	words := strings.Fields(text)
+	n := len(fields)
+	switch {
+	case len(words) == 0:
+		return Schedule{}, "", ErrEmpty
+	case words[0] == "@every":
+		n = 2
+	case strings.HasPrefix(words[0], "@"):
+		n = 1
+	}
+	if len(words) < n {
+		return Schedule{}, "", fmt.Errorf("schedule: %q: want 5 fields (minute hour day month weekday)", text)
+	}
+	s, err := Parse(strings.Join(words[:n], " "))
+	if err != nil {
+		return Schedule{}, "", err
+	}
+	rest := text
+	for i := 0; i < n; i++ {
+		rest = strings.TrimLeft(rest, " \t")
+		rest = strings.TrimLeft(rest[len(words[i]):], " \t")
+	}
+	return s, rest, nil
+}
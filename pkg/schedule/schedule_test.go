@@ -0,0 +1,85 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// Wednesday.
+	start := time.Date(2024, 5, 1, 9, 30, 15, 0, time.UTC)
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 1, 9, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 1, 9, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)},
+		{"30 18 * * 0", time.Date(2024, 5, 5, 18, 30, 0, 0, time.UTC)},
+		{"30 18 * * 7", time.Date(2024, 5, 5, 18, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		{"@every 90m", start.Add(90 * time.Minute)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tc := range cases {
+		s, err := Parse(tc.spec)
+		require.NoError(t, err, tc.spec)
+		require.Equal(t, tc.want, s.Next(start), tc.spec)
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	seoul := time.FixedZone("KST", 9*60*60)
+	india := time.FixedZone("IST", 5*60*60+30*60)
+	s, err := Parse("0 9 * * *")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 5, 2, 9, 0, 0, 0, seoul), s.Next(time.Date(2024, 5, 1, 10, 0, 0, 0, seoul)))
+	require.Equal(t, time.Date(2024, 5, 1, 9, 0, 0, 0, india), s.Next(time.Date(2024, 5, 1, 7, 45, 0, 0, india)), "half-hour offsets")
+}
+
+func TestParseErrors(t *testing.T) {
+	for spec, want := range map[string]string{
+		"* * * *":      "want 5 fields",
+		"60 * * * *":   "minute 60 is outside 0-59",
+		"* * * 0 *":    "month 0 is outside 1-12",
+		"5-1 * * * *":  "runs backwards",
+		"*/0 * * * *":  "step",
+		"x * * * *":    "is not a number",
+		"@fortnightly": "unknown descriptor",
+		"@every 10s":   "at least 1m0s",
+		"@every soon":  "invalid duration",
+	} {
+		_, err := Parse(spec)
+		require.ErrorContains(t, err, want, spec)
+	}
+	require.True(t, Schedule{}.Next(time.Now()).IsZero())
+}
+
+func TestSplit(t *testing.T) {
+	s, rest, err := Split("0 9 * * 1-5  stand-up in  5 minutes")
+	require.NoError(t, err)
+	require.Equal(t, "0 9 * * 1-5", s.String())
+	require.Equal(t, "stand-up in  5 minutes", rest)
+
+	s, rest, err = Split("@every 1h drink water")
+	require.NoError(t, err)
+	require.Equal(t, "@every 1h", s.String())
+	require.Equal(t, "drink water", rest)
+
+	s, rest, err = Split("@daily")
+	require.NoError(t, err)
+	require.Equal(t, "@daily", s.String())
+	require.Empty(t, rest)
+
+	_, _, err = Split("0 9 *")
+	require.ErrorContains(t, err, "want 5 fields")
+	_, _, err = Split("  ")
+	require.ErrorIs(t, err, ErrEmpty)
+}
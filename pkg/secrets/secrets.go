@@ -0,0 +1,144 @@
+// Package secrets resolves the secrets a server needs, such as passphrases,
+// API keys, and host keys, from where they are kept instead of plaintext in
+// its config. A reference names the source:
+//
+//	env:NAME                 the environment variable NAME
+//	file:/run/secrets/name   a file no other user can read
+//	vault:secret/data/schat#field
+//	                         a field of a secret from a provider, here Vault
+//
+// A reference without a scheme is the name of an environment variable, which
+// is what settings ending in _env have always held.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Built-in schemes.
+const (
+	SchemeEnv  = "env"
+	SchemeFile = "file"
+)
+
+// ErrNotFound is returned when a reference points at nothing, such as an
+// unset variable or a missing file or field.
+var ErrNotFound = errors.New("secrets: not found")
+
+// Provider looks secrets up in an external store.
+type Provider interface {
+	// Secret returns the field of the secret at path. An empty field selects
+	// the only field of a secret that has just one.
+	Secret(ctx context.Context, path, field string) (string, error)
+}
+
+// Resolver resolves references. It is safe for concurrent use.
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// Option customises a Resolver.
+type Option func(*Resolver)
+
+// WithProvider serves references with the given scheme, such as "vault",
+// from p.
+func WithProvider(scheme string, p Provider) Option {
+	return func(r *Resolver) {
+		if p != nil {
+			r.providers[scheme] = p
+		}
+	}
+}
+
+// New returns a resolver for env: and file: references and those of the
+// given providers.
+func New(opts ...Option) *Resolver {
+	r := &Resolver{providers: make(map[string]Provider)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// IsRef reports whether s starts with a scheme the resolver knows, as
+// opposed to being a bare name or path.
+func (r *Resolver) IsRef(s string) bool {
+	scheme, _, ok := strings.Cut(s, ":")
+	if !ok {
+		return false
+	}
+	if scheme == SchemeEnv || scheme == SchemeFile {
+		return true
+	}
+	_, known := r.providers[scheme]
+	return known
+}
+
+// Resolve returns the secret ref points at. An empty ref resolves to an empty
+// secret, and so does a bare variable name that is not set, as it always has;
+// every other reference that points at nothing is an error wrapping
+// ErrNotFound.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	if !r.IsRef(ref) {
+		return os.Getenv(ref), nil
+	}
+	scheme, rest, _ := strings.Cut(ref, ":")
+	switch scheme {
+	case SchemeEnv:
+		value, ok := os.LookupEnv(rest)
+		if !ok || value == "" {
+			return "", fmt.Errorf("%w: $%s is not set", ErrNotFound, rest)
+		}
+		return value, nil
+	case SchemeFile:
+		return readFile(rest)
+	}
+	path, field, _ := strings.Cut(rest, "#")
+	value, err := r.providers[scheme].Secret(ctx, path, field)
+	if err != nil {
+		return "", fmt.Errorf("secrets: %s: %w", ref, err)
+	}
+	return value, nil
+}
+
+// readFile reads a secret file, refusing one that other users could read.
+// One trailing newline is dropped, as editors and echo add it.
+func readFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s does not exist", ErrNotFound, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("secrets: %w", err)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return "", fmt.Errorf("secrets: %s is readable by other users (mode %04o); chmod 600 it", path, perm)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secrets: %w", err)
+	}
+	value := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	if value == "" {
+		return "", fmt.Errorf("%w: %s is empty", ErrNotFound, path)
+	}
+	return value, nil
+}
+
+// Files returns the paths of the file: references among refs.
+func Files(refs ...string) []string {
+	var paths []string
+	for _, ref := range refs {
+		if path, ok := strings.CutPrefix(ref, SchemeFile+":"); ok && path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
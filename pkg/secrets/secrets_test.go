@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stubProvider map[string]string
+
+func (p stubProvider) Secret(_ context.Context, path, field string) (string, error) {
+	value, ok := p[path+"#"+field]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func TestResolveEnv(t *testing.T) {
+	t.Setenv("SCHAT_TEST_SECRET", "hunter2")
+	r := New()
+	ctx := context.Background()
+
+	got, err := r.Resolve(ctx, "env:SCHAT_TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", got)
+	got, err = r.Resolve(ctx, "SCHAT_TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", got, "a bare name is a variable")
+
+	_, err = r.Resolve(ctx, "env:SCHAT_TEST_UNSET")
+	require.ErrorIs(t, err, ErrNotFound)
+	got, err = r.Resolve(ctx, "SCHAT_TEST_UNSET")
+	require.NoError(t, err, "an unset bare variable stays optional")
+	require.Empty(t, got)
+	got, err = r.Resolve(ctx, "")
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func TestResolveFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(path, []byte("hunter2\n"), 0o600))
+	r := New()
+	ctx := context.Background()
+
+	got, err := r.Resolve(ctx, "file:"+path)
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", got)
+
+	require.NoError(t, os.Chmod(path, 0o644))
+	_, err = r.Resolve(ctx, "file:"+path)
+	require.ErrorContains(t, err, "readable by other users (mode 0644)")
+
+	_, err = r.Resolve(ctx, "file:"+filepath.Join(dir, "missing"))
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, []string{path}, Files("env:X", "file:"+path, "", "file:"))
+}
+
+func TestResolveProvider(t *testing.T) {
+	r := New(WithProvider("stub", stubProvider{"kv/schat#db": "s3cret"}))
+	ctx := context.Background()
+	require.True(t, r.IsRef("stub:kv/schat#db"))
+	require.False(t, r.IsRef("other:kv/schat"))
+	require.False(t, r.IsRef("/etc/ssh/host_key"))
+
+	got, err := r.Resolve(ctx, "stub:kv/schat#db")
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", got)
+	_, err = r.Resolve(ctx, "stub:kv/schat#other")
+	require.True(t, errors.Is(err, ErrNotFound))
+	require.ErrorContains(t, err, "secrets: stub:kv/schat#other")
+}
@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemeVault is the scheme Vault is usually registered under.
+const SchemeVault = "vault"
+
+// errEmptyPath is returned for a vault: reference without a path.
+var errEmptyPath = errors.New("vault: empty path")
+
+// vaultTimeout bounds a single request to the Vault server.
+const vaultTimeout = 10 * time.Second
+
+// Vault is a Provider backed by the HTTP API of HashiCorp Vault or a
+// compatible server such as OpenBao. Paths are API paths below /v1, such as
+// "secret/data/schat" for the KV version 2 engine mounted at secret/ or
+// "kv/schat" for version 1.
+type Vault struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// VaultOption customises a Vault provider.
+type VaultOption func(*Vault)
+
+// WithNamespace sends requests to a Vault Enterprise namespace.
+func WithNamespace(namespace string) VaultOption {
+	return func(v *Vault) {
+		v.namespace = namespace
+	}
+}
+
+// WithHTTPClient replaces the default client, e.g. to trust a private CA.
+func WithHTTPClient(client *http.Client) VaultOption {
+	return func(v *Vault) {
+		if client != nil {
+			v.client = client
+		}
+	}
+}
+
+// NewVault returns a provider for the server at addr, such as
+// "https://vault.example.com:8200", authenticating with token.
+func NewVault(addr, token string, opts ...VaultOption) *Vault {
+	v := &Vault{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: vaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Secret implements Provider.
+func (v *Vault) Secret(ctx context.Context, path, field string) (string, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", errEmptyPath
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+(&url.URL{Path: path}).EscapedPath(), nil)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data   map[string]any `json:"data"`
+		Errors []string       `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("vault: decode response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%w: no secret at %s", ErrNotFound, path)
+	case resp.StatusCode != http.StatusOK:
+		if len(body.Errors) > 0 {
+			return "", fmt.Errorf("vault: %s: %s", resp.Status, strings.Join(body.Errors, "; "))
+		}
+		return "", fmt.Errorf("vault: %s", resp.Status)
+	}
+
+	data := body.Data
+	// KV version 2 wraps the fields next to their metadata.
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	if field == "" {
+		if len(data) != 1 {
+			names := make([]string, 0, len(data))
+			for name := range data {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", fmt.Errorf("vault: %s has fields %s; name one after #", path, strings.Join(names, ", "))
+		}
+		for name := range data {
+			field = name
+		}
+	}
+	raw, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %s has no field %q", ErrNotFound, path, field)
+	}
+	value, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("vault: field %q of %s is not a string", field, path)
+	}
+	return value, nil
+}
@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultKV2(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "root-token", r.Header.Get("X-Vault-Token"))
+		require.Equal(t, "team", r.Header.Get("X-Vault-Namespace"))
+		switch r.URL.Path {
+		case "/v1/secret/data/schat":
+			_, _ = w.Write([]byte(`{"data":{"data":{"db_key":"s3cret","webhook":"hook"},"metadata":{"version":3}}}`))
+		case "/v1/kv/single":
+			_, _ = w.Write([]byte(`{"data":{"value":"only"}}`))
+		case "/v1/kv/denied":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	r := New(WithProvider(SchemeVault, NewVault(srv.URL+"/", "root-token", WithNamespace("team"))))
+	ctx := context.Background()
+
+	got, err := r.Resolve(ctx, "vault:secret/data/schat#db_key")
+	require.NoError(t, err)
+	require.Equal(t, "s3cret", got)
+	got, err = r.Resolve(ctx, "vault:kv/single")
+	require.NoError(t, err)
+	require.Equal(t, "only", got, "a lone field needs no name")
+
+	_, err = r.Resolve(ctx, "vault:secret/data/schat")
+	require.ErrorContains(t, err, "has fields db_key, webhook")
+	_, err = r.Resolve(ctx, "vault:secret/data/schat#missing")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = r.Resolve(ctx, "vault:kv/gone#x")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = r.Resolve(ctx, "vault:kv/denied#x")
+	require.ErrorContains(t, err, "403 Forbidden: permission denied")
+}
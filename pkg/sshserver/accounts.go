@@ -0,0 +1,216 @@
+package sshserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+// MinPasswordLength is the shortest password Register accepts.
+const MinPasswordLength = 8
+
+// ErrWeakPassword is returned by Register for passwords shorter than
+// MinPasswordLength.
+var ErrWeakPassword = fmt.Errorf("sshserver: passwords must be at least %d characters", MinPasswordLength)
+
+// Account is a username claimed with /register.
+type Account struct {
+	User string `json:"user"`
+	// Hash is the bcrypt hash of the account password.
+	Hash string `json:"hash"`
+	// Keys are SHA256 fingerprints of public keys that may sign in too.
+	Keys      []string  `json:"keys,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Accounts protects registered usernames: once a user registers, that name
+// signs in only with the account password or a key registered with it, so
+// nobody else can take it under -auth none or with another authorized key.
+// Names nobody registered authenticate as before. Accounts are saved to a
+// JSON file after every change.
+type Accounts struct {
+	path  string
+	clock func() time.Time
+
+	mu       sync.RWMutex
+	accounts map[string]Account
+}
+
+// OpenAccounts loads the accounts file at path, starting empty when it does
+// not exist.
+func OpenAccounts(path string) (*Accounts, error) {
+	a := &Accounts{path: path, clock: time.Now, accounts: make(map[string]Account)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sshserver: read accounts %q: %w", path, err)
+	}
+	var list []Account
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("sshserver: parse accounts %q: %w", path, err)
+	}
+	for _, acct := range list {
+		a.accounts[acct.User] = acct
+	}
+	return a, nil
+}
+
+// Registered reports whether user is a registered account.
+func (a *Accounts) Registered(user string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.accounts[user]
+	return ok
+}
+
+// Register sets user's password, creating the account if needed. A non-empty
+// keyFingerprint, as from ssh.FingerprintSHA256, may sign in as user too.
+func (a *Accounts) Register(user, password, keyFingerprint string) error {
+	if user == "" {
+		return errors.New("sshserver: account user required")
+	}
+	if len(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("sshserver: hash password: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	old, existed := a.accounts[user]
+	acct := Account{User: user, Hash: string(hash), Keys: append([]string(nil), old.Keys...), CreatedAt: old.CreatedAt}
+	if !existed {
+		acct.CreatedAt = a.clock().UTC()
+	}
+	if keyFingerprint != "" && !acct.hasKey(keyFingerprint) {
+		acct.Keys = append(acct.Keys, keyFingerprint)
+	}
+	a.accounts[user] = acct
+	if err := a.saveLocked(); err != nil {
+		if existed {
+			a.accounts[user] = old
+		} else {
+			delete(a.accounts, user)
+		}
+		return err
+	}
+	return nil
+}
+
+func (acct Account) hasKey(fingerprint string) bool {
+	for _, k := range acct.Keys {
+		if k == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply wraps the callbacks installed by the other authenticators, so it must
+// be applied after them and before AdminKeys. Registered names are refused
+// every method except the account password and registered keys.
+func (a *Accounts) Apply(cfg *ssh.ServerConfig) {
+	if cfg.NoClientAuth {
+		next := cfg.NoClientAuthCallback
+		cfg.NoClientAuthCallback = func(conn ssh.ConnMetadata) (*ssh.Permissions, error) {
+			if a.Registered(conn.User()) {
+				return nil, errAuthFailed
+			}
+			if next == nil {
+				return nil, nil
+			}
+			return next(conn)
+		}
+	}
+	if next := cfg.KeyboardInteractiveCallback; next != nil {
+		cfg.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			if a.Registered(conn.User()) {
+				return nil, errAuthFailed
+			}
+			return next(conn, challenge)
+		}
+	}
+
+	nextPassword := cfg.PasswordCallback
+	cfg.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+		if acct, ok := a.account(conn.User()); ok {
+			if bcrypt.CompareHashAndPassword([]byte(acct.Hash), password) != nil {
+				return nil, errAuthFailed
+			}
+			return &ssh.Permissions{Extensions: map[string]string{ExtAuthMethod: "password", ExtAccount: "1"}}, nil
+		}
+		if nextPassword == nil {
+			return nil, errAuthFailed
+		}
+		return nextPassword(conn, password)
+	}
+
+	nextKey := cfg.PublicKeyCallback
+	cfg.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if acct, ok := a.account(conn.User()); ok {
+			fingerprint := ssh.FingerprintSHA256(key)
+			if !acct.hasKey(fingerprint) {
+				return nil, errAuthFailed
+			}
+			return &ssh.Permissions{Extensions: map[string]string{
+				ExtAuthMethod:     "publickey",
+				ExtKeyFingerprint: fingerprint,
+				ExtAccount:        "1",
+			}}, nil
+		}
+		if nextKey == nil {
+			return nil, errAuthFailed
+		}
+		return nextKey(conn, key)
+	}
+}
+
+func (a *Accounts) account(user string) (Account, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	acct, ok := a.accounts[user]
+	return acct, ok
+}
+
+// saveLocked writes the accounts to disk atomically, readable only by the
+// server's user.
+func (a *Accounts) saveLocked() error {
+	list := make([]Account, 0, len(a.accounts))
+	for _, acct := range a.accounts {
+		list = append(list, acct)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].User < list[j].User })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("sshserver: encode accounts: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), ".accounts-*")
+	if err != nil {
+		return fmt.Errorf("sshserver: save accounts %q: %w", a.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sshserver: save accounts %q: %w", a.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("sshserver: save accounts %q: %w", a.path, err)
+	}
+	if err := os.Rename(tmp.Name(), a.path); err != nil {
+		return fmt.Errorf("sshserver: save accounts %q: %w", a.path, err)
+	}
+	return nil
+}
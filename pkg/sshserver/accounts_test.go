@@ -0,0 +1,83 @@
+package sshserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAccountsProtectRegisteredNames(t *testing.T) {
+	aliceKey, otherKey := newTestPublicKey(t), newTestPublicKey(t)
+	dir := t.TempDir()
+	keysPath := filepath.Join(dir, "authorized_keys")
+	require.NoError(t, os.WriteFile(keysPath, append(ssh.MarshalAuthorizedKey(aliceKey), ssh.MarshalAuthorizedKey(otherKey)...), 0o600))
+	ak, err := LoadAuthorizedKeys(keysPath)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "accounts.json")
+	accounts, err := OpenAccounts(path)
+	require.NoError(t, err)
+	cfg := &ssh.ServerConfig{}
+	for _, auth := range []Authenticator{NoAuth(), ak, accounts} {
+		auth.Apply(cfg)
+	}
+
+	_, err = cfg.NoClientAuthCallback(fakeConnMeta{user: "alice"})
+	require.NoError(t, err, "unregistered names sign in as before")
+	_, err = cfg.PublicKeyCallback(fakeConnMeta{user: "alice"}, otherKey)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, accounts.Register("alice", "short", ""), ErrWeakPassword)
+	require.NoError(t, accounts.Register("alice", "correct horse", ssh.FingerprintSHA256(aliceKey)))
+	require.True(t, accounts.Registered("alice"))
+
+	_, err = cfg.NoClientAuthCallback(fakeConnMeta{user: "alice"})
+	require.ErrorIs(t, err, errAuthFailed, "a registered name needs its credential")
+	_, err = cfg.NoClientAuthCallback(fakeConnMeta{user: "bob"})
+	require.NoError(t, err)
+	_, err = cfg.PublicKeyCallback(fakeConnMeta{user: "alice"}, otherKey)
+	require.ErrorIs(t, err, errAuthFailed, "another authorized key cannot take the name")
+	_, err = cfg.PasswordCallback(fakeConnMeta{user: "alice"}, []byte("wrong password"))
+	require.ErrorIs(t, err, errAuthFailed)
+	_, err = cfg.PasswordCallback(fakeConnMeta{user: "bob"}, []byte("correct horse"))
+	require.ErrorIs(t, err, errAuthFailed)
+
+	perms, err := cfg.PasswordCallback(fakeConnMeta{user: "alice"}, []byte("correct horse"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{ExtAuthMethod: "password", ExtAccount: "1"}, perms.Extensions)
+	perms, err = cfg.PublicKeyCallback(fakeConnMeta{user: "alice"}, aliceKey)
+	require.NoError(t, err)
+	require.Equal(t, "1", perms.Extensions[ExtAccount])
+	require.Equal(t, ssh.FingerprintSHA256(aliceKey), perms.Extensions[ExtKeyFingerprint])
+
+	// Changing the password keeps the registered keys.
+	require.NoError(t, accounts.Register("alice", "battery staple", ""))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	reopened, err := OpenAccounts(path)
+	require.NoError(t, err)
+	cfg = &ssh.ServerConfig{}
+	for _, auth := range []Authenticator{NoAuth(), reopened} {
+		auth.Apply(cfg)
+	}
+	_, err = cfg.PasswordCallback(fakeConnMeta{user: "alice"}, []byte("correct horse"))
+	require.ErrorIs(t, err, errAuthFailed)
+	_, err = cfg.PasswordCallback(fakeConnMeta{user: "alice"}, []byte("battery staple"))
+	require.NoError(t, err)
+	_, err = cfg.PublicKeyCallback(fakeConnMeta{user: "alice"}, aliceKey)
+	require.NoError(t, err)
+	_, err = cfg.PublicKeyCallback(fakeConnMeta{user: "bob"}, aliceKey)
+	require.ErrorIs(t, err, errAuthFailed, "without -auth pubkey only registered keys are accepted")
+}
+
+func TestOpenAccountsRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err := OpenAccounts(path)
+	require.ErrorContains(t, err, "parse accounts")
+}
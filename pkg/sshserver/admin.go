@@ -0,0 +1,83 @@
+package sshserver
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// ExtAdmin is set on connections authenticated with an admin key. Like an
+// OpenSSH forced command, such connections may only run one-shot admin
+// commands over exec, never an interactive chat session.
+const ExtAdmin = "schat-admin"
+
+// AdminKeys reserves one username for scripted moderation, e.g.
+// `ssh admin@host kick bob`. That user can only sign in with a key from an
+// authorized_keys file; every other user authenticates as before.
+type AdminKeys struct {
+	user string
+	keys *AuthorizedKeys
+}
+
+// LoadAdminKeys reserves user for the admin keys listed in the
+// authorized_keys file at path.
+func LoadAdminKeys(path, user string) (*AdminKeys, error) {
+	keys, err := LoadAuthorizedKeys(path)
+	if err != nil {
+		return nil, err
+	}
+	return &AdminKeys{user: user, keys: keys}, nil
+}
+
+// Reload re-reads the admin authorized_keys file from disk.
+func (a *AdminKeys) Reload() error {
+	return a.keys.Reload()
+}
+
+// Apply wraps the callbacks installed by the other authenticators, so it must
+// be applied after them. The admin user is refused by every method except its
+// keys, which keeps `-auth none` from letting anyone in as the admin.
+func (a *AdminKeys) Apply(cfg *ssh.ServerConfig) {
+	if cfg.NoClientAuth {
+		next := cfg.NoClientAuthCallback
+		cfg.NoClientAuthCallback = func(conn ssh.ConnMetadata) (*ssh.Permissions, error) {
+			if conn.User() == a.user {
+				return nil, errAuthFailed
+			}
+			if next == nil {
+				return nil, nil
+			}
+			return next(conn)
+		}
+	}
+	if next := cfg.PasswordCallback; next != nil {
+		cfg.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == a.user {
+				return nil, errAuthFailed
+			}
+			return next(conn, password)
+		}
+	}
+	if next := cfg.KeyboardInteractiveCallback; next != nil {
+		cfg.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			if conn.User() == a.user {
+				return nil, errAuthFailed
+			}
+			return next(conn, challenge)
+		}
+	}
+
+	next := cfg.PublicKeyCallback
+	cfg.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if conn.User() != a.user {
+			if next == nil {
+				return nil, errAuthFailed
+			}
+			return next(conn, key)
+		}
+		perms, err := a.keys.check(conn, key)
+		if err != nil {
+			return nil, err
+		}
+		perms.Extensions[ExtAdmin] = "1"
+		return perms, nil
+	}
+}
@@ -0,0 +1,61 @@
+package sshserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAdminKeysApply(t *testing.T) {
+	adminKey := newTestPublicKey(t)
+	userKey := newTestPublicKey(t)
+	dir := t.TempDir()
+	adminPath := filepath.Join(dir, "admin_keys")
+	require.NoError(t, os.WriteFile(adminPath, ssh.MarshalAuthorizedKey(adminKey), 0o600))
+	userPath := filepath.Join(dir, "authorized_keys")
+	require.NoError(t, os.WriteFile(userPath, ssh.MarshalAuthorizedKey(userKey), 0o600))
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	passwdPath := filepath.Join(dir, "passwd")
+	require.NoError(t, os.WriteFile(passwdPath, []byte("admin:"+string(hash)+"\nalice:"+string(hash)+"\n"), 0o600))
+
+	pf, err := LoadPasswordFile(passwdPath)
+	require.NoError(t, err)
+	ak, err := LoadAuthorizedKeys(userPath)
+	require.NoError(t, err)
+	admin, err := LoadAdminKeys(adminPath, "admin")
+	require.NoError(t, err)
+
+	cfg := &ssh.ServerConfig{}
+	for _, auth := range []Authenticator{NoAuth(), pf, ak, admin} {
+		auth.Apply(cfg)
+	}
+
+	_, err = cfg.NoClientAuthCallback(fakeConnMeta{user: "admin"})
+	require.ErrorIs(t, err, errAuthFailed, "-auth none never lets anyone in as the admin")
+	_, err = cfg.NoClientAuthCallback(fakeConnMeta{user: "alice"})
+	require.NoError(t, err)
+
+	_, err = cfg.PasswordCallback(fakeConnMeta{user: "admin"}, []byte("s3cret"))
+	require.ErrorIs(t, err, errAuthFailed, "the admin user only signs in with its keys")
+	_, err = cfg.PasswordCallback(fakeConnMeta{user: "alice"}, []byte("s3cret"))
+	require.NoError(t, err)
+
+	perms, err := cfg.PublicKeyCallback(fakeConnMeta{user: "admin"}, adminKey)
+	require.NoError(t, err)
+	require.Equal(t, "1", perms.Extensions[ExtAdmin])
+	require.Equal(t, ssh.FingerprintSHA256(adminKey), perms.Extensions[ExtKeyFingerprint])
+
+	_, err = cfg.PublicKeyCallback(fakeConnMeta{user: "admin"}, userKey)
+	require.ErrorIs(t, err, errAuthFailed)
+	_, err = cfg.PublicKeyCallback(fakeConnMeta{user: "alice"}, adminKey)
+	require.ErrorIs(t, err, errAuthFailed, "admin keys are not user keys")
+
+	perms, err = cfg.PublicKeyCallback(fakeConnMeta{user: "alice"}, userKey)
+	require.NoError(t, err)
+	require.Empty(t, perms.Extensions[ExtAdmin])
+}
@@ -0,0 +1,175 @@
+package sshserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+// Permission extension keys populated by the built-in authenticators so session
+// handlers can tell how a connection was authenticated.
+const (
+	ExtAuthMethod     = "schat-auth-method"
+	ExtKeyFingerprint = "schat-pubkey-fp"
+	ExtOIDCSubject    = "schat-oidc-sub"
+	// ExtOIDCUsername is the verified email or subject of an OIDC sign-in,
+	// which the chat uses instead of the SSH username.
+	ExtOIDCUsername = "schat-oidc-username"
+	// ExtAccount is set on connections whose credential proves the name they
+	// join under: a registered account's password or key, an entry of a
+	// PasswordFile, or an OIDC sign-in, whose name is ExtOIDCUsername.
+	ExtAccount = "schat-account"
+)
+
+// errAuthFailed is returned to the SSH library for any rejected credential so
+// clients cannot distinguish unknown users from wrong secrets.
+var errAuthFailed = errors.New("sshserver: authentication failed")
+
+// Authenticator installs an authentication method on an SSH server config.
+// Providers of different methods can be combined; each sets its own callback.
+type Authenticator interface {
+	Apply(cfg *ssh.ServerConfig)
+}
+
+// AuthenticatorFunc adapts a plain function to the Authenticator interface.
+type AuthenticatorFunc func(cfg *ssh.ServerConfig)
+
+// Apply calls f(cfg).
+func (f AuthenticatorFunc) Apply(cfg *ssh.ServerConfig) {
+	f(cfg)
+}
+
+// NoAuth accepts every client without credentials. This is the default.
+func NoAuth() Authenticator {
+	return AuthenticatorFunc(func(cfg *ssh.ServerConfig) {
+		cfg.NoClientAuth = true
+	})
+}
+
+// PasswordFile authenticates users against a file of "username:bcrypt-hash" lines.
+// Blank lines and lines starting with '#' are ignored. Reload re-reads the file.
+type PasswordFile struct {
+	path string
+
+	mu     sync.RWMutex
+	hashes map[string][]byte
+}
+
+// LoadPasswordFile parses the password file at path.
+func LoadPasswordFile(path string) (*PasswordFile, error) {
+	pf := &PasswordFile{path: path}
+	if err := pf.Reload(); err != nil {
+		return nil, err
+	}
+	return pf, nil
+}
+
+// Reload re-reads the password file from disk, replacing the in-memory entries.
+func (p *PasswordFile) Reload() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("sshserver: read password file %q: %w", p.path, err)
+	}
+
+	hashes := make(map[string][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" || hash == "" {
+			return fmt.Errorf("sshserver: password file %q line %d: expected username:hash", p.path, lineNo)
+		}
+		hashes[user] = []byte(hash)
+	}
+
+	p.mu.Lock()
+	p.hashes = hashes
+	p.mu.Unlock()
+	return nil
+}
+
+// Apply installs the password callback.
+func (p *PasswordFile) Apply(cfg *ssh.ServerConfig) {
+	cfg.PasswordCallback = p.check
+}
+
+func (p *PasswordFile) check(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	p.mu.RLock()
+	hash, ok := p.hashes[conn.User()]
+	p.mu.RUnlock()
+
+	if !ok || bcrypt.CompareHashAndPassword(hash, password) != nil {
+		return nil, errAuthFailed
+	}
+	return &ssh.Permissions{Extensions: map[string]string{ExtAuthMethod: "password", ExtAccount: "1"}}, nil
+}
+
+// AuthorizedKeys authenticates clients whose public key appears in an OpenSSH
+// authorized_keys file. Any SSH username is accepted for a listed key.
+type AuthorizedKeys struct {
+	path string
+
+	mu   sync.RWMutex
+	keys map[string]struct{}
+}
+
+// LoadAuthorizedKeys parses the authorized_keys file at path.
+func LoadAuthorizedKeys(path string) (*AuthorizedKeys, error) {
+	ak := &AuthorizedKeys{path: path}
+	if err := ak.Reload(); err != nil {
+		return nil, err
+	}
+	return ak, nil
+}
+
+// Reload re-reads the authorized_keys file from disk.
+func (a *AuthorizedKeys) Reload() error {
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("sshserver: read authorized keys %q: %w", a.path, err)
+	}
+
+	keys := make(map[string]struct{})
+	for rest := bytes.TrimSpace(data); len(rest) > 0; {
+		var key ssh.PublicKey
+		key, _, _, rest, err = ssh.ParseAuthorizedKey(rest)
+		if err != nil {
+			return fmt.Errorf("sshserver: parse authorized keys %q: %w", a.path, err)
+		}
+		keys[string(key.Marshal())] = struct{}{}
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.mu.Unlock()
+	return nil
+}
+
+// Apply installs the public key callback.
+func (a *AuthorizedKeys) Apply(cfg *ssh.ServerConfig) {
+	cfg.PublicKeyCallback = a.check
+}
+
+func (a *AuthorizedKeys) check(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	a.mu.RLock()
+	_, ok := a.keys[string(key.Marshal())]
+	a.mu.RUnlock()
+
+	if !ok {
+		return nil, errAuthFailed
+	}
+	return &ssh.Permissions{Extensions: map[string]string{
+		ExtAuthMethod:     "publickey",
+		ExtKeyFingerprint: ssh.FingerprintSHA256(key),
+	}}, nil
+}
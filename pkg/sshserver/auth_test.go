@@ -0,0 +1,215 @@
+package sshserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestPasswordFileCheck(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "passwd")
+	require.NoError(t, os.WriteFile(path, []byte("# users\nalice:"+string(hash)+"\n"), 0o600))
+
+	pf, err := LoadPasswordFile(path)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		user     string
+		password string
+		ok       bool
+	}{
+		{name: "valid", user: "alice", password: "s3cret", ok: true},
+		{name: "wrong password", user: "alice", password: "nope"},
+		{name: "unknown user", user: "mallory", password: "s3cret"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			perms, err := pf.check(fakeConnMeta{user: tc.user}, []byte(tc.password))
+			if !tc.ok {
+				require.ErrorIs(t, err, errAuthFailed)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "password", perms.Extensions[ExtAuthMethod])
+			require.Equal(t, "1", perms.Extensions[ExtAccount], "the entry proves the username")
+		})
+	}
+}
+
+func TestAuthorizedKeysCheck(t *testing.T) {
+	allowed := newTestPublicKey(t)
+	other := newTestPublicKey(t)
+
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	require.NoError(t, os.WriteFile(path, ssh.MarshalAuthorizedKey(allowed), 0o600))
+
+	ak, err := LoadAuthorizedKeys(path)
+	require.NoError(t, err)
+
+	perms, err := ak.check(fakeConnMeta{user: "bob"}, allowed)
+	require.NoError(t, err)
+	require.Equal(t, ssh.FingerprintSHA256(allowed), perms.Extensions[ExtKeyFingerprint])
+
+	_, err = ak.check(fakeConnMeta{user: "bob"}, other)
+	require.ErrorIs(t, err, errAuthFailed)
+}
+
+func TestDeviceFlowAuthenticate(t *testing.T) {
+	var polls atomic.Int32
+	now := time.Unix(1700000000, 0)
+	idToken := testIDToken(t, map[string]any{
+		"iss": "https://idp.example", "aud": "schat", "exp": now.Add(time.Minute).Unix(),
+		"sub": "123", "preferred_username": "root", "email": "alice@example.com", "email_verified": true,
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"device_code":      "dev-1",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": "https://idp.example/activate",
+			"expires_in":       30,
+			"interval":         0,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, deviceCodeGrantType, r.PostForm.Get("grant_type"))
+		if polls.Add(1) < 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	flow := &DeviceFlow{
+		cfg: DeviceFlowConfig{
+			Issuer:        "https://idp.example/",
+			ClientID:      "schat",
+			Scopes:        []string{"openid"},
+			DeviceAuthURL: srv.URL + "/device",
+			TokenURL:      srv.URL + "/token",
+		},
+		client:          srv.Client(),
+		defaultInterval: 10 * time.Millisecond,
+		clock:           func() time.Time { return now },
+	}
+
+	var instruction string
+	challenge := func(name, instr string, questions []string, echos []bool) ([]string, error) {
+		instruction = instr
+		return nil, nil
+	}
+
+	perms, err := flow.authenticate(fakeConnMeta{user: "alice"}, challenge)
+	require.NoError(t, err)
+	require.Contains(t, instruction, "https://idp.example/activate")
+	require.Contains(t, instruction, "ABCD-EFGH")
+	require.Equal(t, "123", perms.Extensions[ExtOIDCSubject])
+	require.Equal(t, "alice@example.com", perms.Extensions[ExtOIDCUsername], "the verified email, not preferred_username")
+	require.Equal(t, "1", perms.Extensions[ExtAccount])
+	require.EqualValues(t, 2, polls.Load())
+}
+
+func testIDToken(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func TestParseIDToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	flow := &DeviceFlow{cfg: DeviceFlowConfig{Issuer: "https://idp.example", ClientID: "schat"}, clock: func() time.Time { return now }}
+	valid := func() map[string]any {
+		return map[string]any{"iss": "https://idp.example", "aud": "schat", "exp": now.Add(time.Minute).Unix(), "sub": "123"}
+	}
+
+	claims, err := flow.parseIDToken(testIDToken(t, valid()))
+	require.NoError(t, err)
+	require.Equal(t, "123", claims.username())
+
+	withEmail := valid()
+	withEmail["email"], withEmail["email_verified"] = "alice@example.com", false
+	claims, err = flow.parseIDToken(testIDToken(t, withEmail))
+	require.NoError(t, err)
+	require.Equal(t, "123", claims.username(), "an unverified email is not a name")
+
+	withAudiences := valid()
+	withAudiences["aud"], withAudiences["azp"] = []string{"other", "schat"}, "schat"
+	_, err = flow.parseIDToken(testIDToken(t, withAudiences))
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name  string
+		claim string
+		value any
+		want  string
+	}{
+		{name: "other issuer", claim: "iss", value: "https://evil.example", want: "issued by"},
+		{name: "other client", claim: "aud", value: "other", want: "not issued to"},
+		{name: "other party", claim: "azp", value: "other", want: "authorized for"},
+		{name: "expired", claim: "exp", value: now.Unix(), want: "expired"},
+		{name: "no expiry", claim: "exp", value: nil, want: "missing expiry"},
+		{name: "no subject", claim: "sub", value: nil, want: "missing subject"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			if tt.claim == "azp" {
+				claims["aud"] = []string{"schat", "other"}
+			}
+			if tt.value == nil {
+				delete(claims, tt.claim)
+			} else {
+				claims[tt.claim] = tt.value
+			}
+			_, err := flow.parseIDToken(testIDToken(t, claims))
+			require.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+type fakeConnMeta struct {
+	user string
+}
+
+func (m fakeConnMeta) User() string          { return m.user }
+func (m fakeConnMeta) SessionID() []byte     { return nil }
+func (m fakeConnMeta) ClientVersion() []byte { return []byte("SSH-2.0-test") }
+func (m fakeConnMeta) ServerVersion() []byte { return []byte("SSH-2.0-schat") }
+func (m fakeConnMeta) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+}
+func (m fakeConnMeta) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+}
+
+func newTestPublicKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return key
+}
@@ -0,0 +1,94 @@
+package sshserver
+
+import (
+	"net"
+	"net/netip"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// BanFunc reports whether a connection is banned and why. fingerprint is the
+// SHA256 fingerprint of the public key being offered, or empty when the client
+// authenticates another way.
+type BanFunc func(user, fingerprint string, addr netip.Addr) (reason string, banned bool)
+
+// WithBans refuses banned connections during authentication, whichever
+// method they use. A banned user or address is told why in the banner.
+func WithBans(banned BanFunc) Option {
+	return func(s *Server) {
+		s.banned = banned
+	}
+}
+
+// applyBans wraps the callbacks installed by the authenticators, so it runs
+// after all of them.
+func (s *Server) applyBans(cfg *ssh.ServerConfig) {
+	refused := func(conn ssh.ConnMetadata, fingerprint string) bool {
+		reason, banned := s.banned(conn.User(), fingerprint, connAddr(conn.RemoteAddr()))
+		if banned {
+			s.logger.Warn("sshserver: banned connection refused", "remote_addr", conn.RemoteAddr().String(),
+				"username", conn.User(), "key", fingerprint, "reason", reason)
+		}
+		return banned
+	}
+
+	if cfg.NoClientAuth {
+		next := cfg.NoClientAuthCallback
+		cfg.NoClientAuthCallback = func(conn ssh.ConnMetadata) (*ssh.Permissions, error) {
+			if refused(conn, "") {
+				return nil, errAuthFailed
+			}
+			if next == nil {
+				return nil, nil
+			}
+			return next(conn)
+		}
+	}
+	if next := cfg.PasswordCallback; next != nil {
+		cfg.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if refused(conn, "") {
+				return nil, errAuthFailed
+			}
+			return next(conn, password)
+		}
+	}
+	if next := cfg.KeyboardInteractiveCallback; next != nil {
+		cfg.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			if refused(conn, "") {
+				return nil, errAuthFailed
+			}
+			return next(conn, challenge)
+		}
+	}
+	if next := cfg.PublicKeyCallback; next != nil {
+		cfg.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if refused(conn, ssh.FingerprintSHA256(key)) {
+				return nil, errAuthFailed
+			}
+			return next(conn, key)
+		}
+	}
+}
+
+// banNotice tells a banned user or address why it will be refused.
+func (s *Server) banNotice(conn ssh.ConnMetadata) string {
+	reason, banned := s.banned(conn.User(), "", connAddr(conn.RemoteAddr()))
+	if !banned {
+		return ""
+	}
+	notice := "schat: you are banned"
+	if reason != "" {
+		notice += ": " + reason
+	}
+	return notice + "\r\n"
+}
+
+// connAddr returns the IP address of addr, or the zero Addr when it has none.
+func connAddr(addr net.Addr) netip.Addr {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		ip, _ := netip.AddrFromSlice(tcp.IP)
+		return ip.Unmap()
+	}
+	ip, _ := netip.ParseAddr(remoteIP(addr))
+	return ip.Unmap()
+}
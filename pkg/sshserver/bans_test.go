@@ -0,0 +1,54 @@
+package sshserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestWithBansRefusesEveryMethod(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	bannedKey := newTestPublicKey(t)
+	userKey := newTestPublicKey(t)
+	keysPath := filepath.Join(t.TempDir(), "authorized_keys")
+	require.NoError(t, os.WriteFile(keysPath, append(ssh.MarshalAuthorizedKey(bannedKey), ssh.MarshalAuthorizedKey(userKey)...), 0o600))
+	ak, err := LoadAuthorizedKeys(keysPath)
+	require.NoError(t, err)
+
+	bannedAddr := netip.MustParseAddr("192.0.2.1")
+	server := New(":0", signer, nil, WithAuthenticators(NoAuth(), ak), WithBans(func(user, fingerprint string, addr netip.Addr) (string, bool) {
+		switch {
+		case user == "mallory":
+			return "spam", true
+		case fingerprint == ssh.FingerprintSHA256(bannedKey):
+			return "", true
+		case addr == bannedAddr:
+			return "abuse", true
+		}
+		return "", false
+	}))
+	cfg := server.Config
+
+	_, err = cfg.NoClientAuthCallback(fakeConnMeta{user: "mallory"})
+	require.ErrorIs(t, err, errAuthFailed)
+	_, err = cfg.NoClientAuthCallback(fakeConnMeta{user: "alice"})
+	require.NoError(t, err)
+
+	_, err = cfg.PublicKeyCallback(fakeConnMeta{user: "alice"}, bannedKey)
+	require.ErrorIs(t, err, errAuthFailed)
+	_, err = cfg.PublicKeyCallback(fakeConnMeta{user: "alice"}, userKey)
+	require.NoError(t, err)
+	require.Nil(t, cfg.PasswordCallback, "methods that are not configured stay off")
+
+	require.Equal(t, "schat: you are banned: spam\r\n", cfg.BannerCallback(fakeConnMeta{user: "mallory"}))
+	require.Empty(t, cfg.BannerCallback(fakeConnMeta{user: "alice"}))
+}
@@ -0,0 +1,109 @@
+package sshserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrDraining is returned by Serve once Drain has stopped it accepting
+// connections.
+var ErrDraining = errors.New("sshserver: draining")
+
+// drainState tracks the listeners Serve accepts on and the connections it
+// serves, so Drain can stop the former and wait for the latter.
+type drainState struct {
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	active    int
+	draining  bool
+	// idle is closed once draining and no connection is left.
+	idle chan struct{}
+}
+
+// Drain stops Serve accepting connections, making it return ErrDraining, and
+// waits until the connections it already serves end or ctx is done. Sessions
+// keep running meanwhile, e.g. while a new process takes over the port.
+func (s *Server) Drain(ctx context.Context) error {
+	d := &s.drain
+	d.mu.Lock()
+	if !d.draining {
+		d.draining = true
+		d.idle = make(chan struct{})
+		for ln := range d.listeners {
+			_ = ln.Close()
+		}
+		s.logger.Info("sshserver: draining", "connections", d.active)
+		d.idleLocked()
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Accepting reports whether Serve is accepting connections on any listener,
+// e.g. for a readiness probe.
+func (s *Server) Accepting() bool {
+	d := &s.drain
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.draining && len(d.listeners) > 0
+}
+
+// addListener registers ln with Drain; false means the server is already
+// draining and ln must not be served.
+func (d *drainState) addListener(ln net.Listener) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	if d.listeners == nil {
+		d.listeners = make(map[net.Listener]struct{})
+	}
+	d.listeners[ln] = struct{}{}
+	return true
+}
+
+func (d *drainState) removeListener(ln net.Listener) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.listeners, ln)
+}
+
+func (d *drainState) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+func (d *drainState) opened() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active++
+}
+
+func (d *drainState) closed() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active--
+	d.idleLocked()
+}
+
+func (d *drainState) idleLocked() {
+	if !d.draining || d.active > 0 {
+		return
+	}
+	select {
+	case <-d.idle:
+	default:
+		close(d.idle)
+	}
+}
@@ -0,0 +1,68 @@
+package sshserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDrainKeepsSessionsUntilTheyEnd(t *testing.T) {
+	signer, err := EphemeralSigner()
+	require.NoError(t, err)
+	server := New("127.0.0.1:0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	listener, err := server.Listen()
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(context.Background(), listener, func(_ context.Context, _ *ssh.ServerConn, channel ssh.Channel, _ <-chan *ssh.Request) error {
+			_, _ = io.Copy(channel, channel)
+			return nil
+		})
+	}()
+
+	config := &ssh.ClientConfig{User: "alice", HostKeyCallback: ssh.InsecureIgnoreHostKey(), Timeout: 2 * time.Second}
+	client, err := ssh.Dial("tcp", listener.Addr().String(), config)
+	require.NoError(t, err)
+	defer client.Close()
+	require.True(t, server.Accepting())
+	channel, _, err := client.OpenChannel("session", nil)
+	require.NoError(t, err)
+
+	// Draining stops accepting at once but waits for the open session.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, server.Drain(ctx), context.DeadlineExceeded)
+	require.ErrorIs(t, <-served, ErrDraining)
+	require.False(t, server.Accepting())
+	_, err = net.DialTimeout("tcp", listener.Addr().String(), time.Second)
+	require.Error(t, err, "the listener is closed")
+
+	_, err = channel.Write([]byte("still here"))
+	require.NoError(t, err)
+	echo := make([]byte, len("still here"))
+	_, err = io.ReadFull(channel, echo)
+	require.NoError(t, err)
+	require.Equal(t, "still here", string(echo))
+
+	drained := make(chan error, 1)
+	go func() { drained <- server.Drain(context.Background()) }()
+	require.NoError(t, client.Close())
+	select {
+	case err := <-drained:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain did not finish after the last connection closed")
+	}
+
+	// A server that is draining serves no new listener.
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.ErrorIs(t, server.Serve(context.Background(), other, func(context.Context, *ssh.ServerConn, ssh.Channel, <-chan *ssh.Request) error { return nil }), ErrDraining)
+}
@@ -0,0 +1,147 @@
+package sshserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExitReason classifies why a session ended. The server logs it, counts it,
+// and derives the exit status sent to the client from it.
+type ExitReason string
+
+const (
+	// ExitNormal is a session the user ended, e.g. by quitting the chat.
+	ExitNormal ExitReason = "normal"
+	// ExitClientGone is a session whose client closed the channel first, so
+	// there is no one left to receive an exit status.
+	ExitClientGone ExitReason = "client_gone"
+	// ExitFailed is a one-shot command that ran and failed.
+	ExitFailed ExitReason = "failed"
+	// ExitKicked is a session ended by a moderator.
+	ExitKicked ExitReason = "kicked"
+	// ExitSlowClient is a session dropped for not keeping up with its output.
+	ExitSlowClient ExitReason = "slow_client"
+	// ExitError is a session that ended on an unexpected error.
+	ExitError ExitReason = "error"
+	// ExitShutdown is a session ended because the server shut down.
+	ExitShutdown ExitReason = "shutdown"
+)
+
+// errConnClosed is the cause of a session context cancelled because its
+// connection closed.
+var errConnClosed = errors.New("connection closed")
+
+// errServerShutdown is what users of sessions ended by a shutdown are told.
+var errServerShutdown = errors.New("server is shutting down")
+
+// Status returns the exit status reported to the client for r.
+func (r ExitReason) Status() uint32 {
+	switch r {
+	case ExitNormal, ExitClientGone:
+		return 0
+	case ExitKicked, ExitSlowClient:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// SessionExit is the error a SessionHandler returns to say how its session
+// ended. Handlers may also return nil for ExitNormal or any other error for
+// ExitError.
+type SessionExit struct {
+	Reason ExitReason
+	// Err is the cause shown in logs, if any.
+	Err error
+}
+
+// Exit returns a SessionExit for reason caused by err, which may be nil.
+func Exit(reason ExitReason, err error) *SessionExit {
+	return &SessionExit{Reason: reason, Err: err}
+}
+
+func (e *SessionExit) Error() string {
+	if e.Err == nil {
+		return string(e.Reason)
+	}
+	return e.Err.Error()
+}
+
+func (e *SessionExit) Unwrap() error {
+	return e.Err
+}
+
+// ExitFor classifies a SessionHandler result.
+func ExitFor(err error) *SessionExit {
+	if err == nil {
+		return Exit(ExitNormal, nil)
+	}
+	var exit *SessionExit
+	if errors.As(err, &exit) {
+		return exit
+	}
+	return Exit(ExitError, err)
+}
+
+// ContextExit returns how a session ended whose context is done: the client is
+// gone if its connection closed; a *SessionExit cause, e.g. from a caller that
+// cancels the context to kick the session, is returned as it is; otherwise the
+// server is shutting down.
+func ContextExit(ctx context.Context) *SessionExit {
+	cause := context.Cause(ctx)
+	var exit *SessionExit
+	switch {
+	case errors.Is(cause, errConnClosed):
+		return Exit(ExitClientGone, cause)
+	case errors.As(cause, &exit):
+		return exit
+	case errors.Is(cause, context.Canceled):
+		return Exit(ExitShutdown, errServerShutdown)
+	default:
+		return Exit(ExitShutdown, cause)
+	}
+}
+
+// CloseSession ends a session channel once its handler returned err the way
+// OpenSSH does: it signals the end of output, sends the exit status unless the
+// client is already gone, then closes the channel. Clients such as "ssh host
+// cmd" exit with that status. It returns how the session ended.
+func CloseSession(channel ssh.Channel, err error) *SessionExit {
+	exit := ExitFor(err)
+	if exit.Reason != ExitClientGone {
+		// Both fail harmlessly if the handler already had to close the channel.
+		_ = channel.CloseWrite()
+		_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{exit.Reason.Status()}))
+	}
+	_ = channel.Close()
+	return exit
+}
+
+// exitCounter counts ended sessions by reason.
+type exitCounter struct {
+	mu     sync.Mutex
+	counts map[ExitReason]int64
+}
+
+func (c *exitCounter) add(reason ExitReason) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[ExitReason]int64)
+	}
+	c.counts[reason]++
+}
+
+// SessionExits returns how many sessions have ended for each reason.
+func (s *Server) SessionExits() map[string]int64 {
+	s.exits.mu.Lock()
+	defer s.exits.mu.Unlock()
+	out := make(map[string]int64, len(s.exits.counts))
+	for reason, n := range s.exits.counts {
+		out[string(reason)] = n
+	}
+	return out
+}
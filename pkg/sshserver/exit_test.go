@@ -0,0 +1,201 @@
+package sshserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestExitFor(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name   string
+		err    error
+		reason ExitReason
+		status uint32
+	}{
+		{name: "nil", err: nil, reason: ExitNormal, status: 0},
+		{name: "client gone", err: Exit(ExitClientGone, nil), reason: ExitClientGone, status: 0},
+		{name: "failed", err: Exit(ExitFailed, boom), reason: ExitFailed, status: 1},
+		{name: "kicked", err: Exit(ExitKicked, boom), reason: ExitKicked, status: 2},
+		{name: "wrapped", err: errors.Join(boom, Exit(ExitSlowClient, nil)), reason: ExitSlowClient, status: 2},
+		{name: "plain error", err: boom, reason: ExitError, status: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exit := ExitFor(tt.err)
+			require.Equal(t, tt.reason, exit.Reason)
+			require.Equal(t, tt.status, exit.Reason.Status())
+		})
+	}
+	require.ErrorIs(t, Exit(ExitFailed, boom), boom)
+	require.Equal(t, "kicked", Exit(ExitKicked, nil).Error())
+}
+
+// recordingChannel records how a session channel is torn down.
+type recordingChannel struct {
+	ssh.Channel
+	calls []string
+}
+
+func (c *recordingChannel) CloseWrite() error {
+	c.calls = append(c.calls, "eof")
+	return nil
+}
+
+func (c *recordingChannel) SendRequest(name string, _ bool, payload []byte) (bool, error) {
+	var status struct{ Status uint32 }
+	if err := ssh.Unmarshal(payload, &status); err != nil {
+		return false, err
+	}
+	c.calls = append(c.calls, fmt.Sprintf("%s %d", name, status.Status))
+	return false, nil
+}
+
+func (c *recordingChannel) Close() error {
+	c.calls = append(c.calls, "close")
+	return nil
+}
+
+func TestCloseSessionTeardown(t *testing.T) {
+	channel := &recordingChannel{}
+	require.Equal(t, ExitKicked, CloseSession(channel, Exit(ExitKicked, nil)).Reason)
+	require.Equal(t, []string{"eof", "exit-status 2", "close"}, channel.calls, "output ends before the status, like OpenSSH")
+
+	channel = &recordingChannel{}
+	CloseSession(channel, Exit(ExitClientGone, io.EOF))
+	require.Equal(t, []string{"close"}, channel.calls, "no one is left to tell")
+}
+
+func TestServerReportsSessionExits(t *testing.T) {
+	signer, err := EphemeralSigner()
+	require.NoError(t, err)
+	server := New(":0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := func(_ context.Context, _ *ssh.ServerConn, _ ssh.Channel, requests <-chan *ssh.Request) error {
+		req := <-requests
+		req.Reply(true, nil)
+		var payload struct{ Command string }
+		_ = ssh.Unmarshal(req.Payload, &payload)
+		switch payload.Command {
+		case "kick":
+			return Exit(ExitKicked, errors.New("bye"))
+		case "fail":
+			return errors.New("broken")
+		}
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			nc, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handleConn(ctx, nc, handler)
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "alice",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         2 * time.Second,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	for command, want := range map[string]int{"ok": 0, "kick": 2, "fail": 1} {
+		sess, err := client.NewSession()
+		require.NoError(t, err)
+		err = sess.Run(command)
+		var exit *ssh.ExitError
+		if want == 0 {
+			require.NoError(t, err, command)
+		} else {
+			require.ErrorAs(t, err, &exit, command)
+			require.Equal(t, want, exit.ExitStatus(), command)
+		}
+	}
+	require.Eventually(t, func() bool {
+		exits := server.SessionExits()
+		return exits["normal"] == 1 && exits["kicked"] == 1 && exits["error"] == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestContextExit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, Exit(ExitShutdown, errServerShutdown), ContextExit(ctx))
+
+	ctx, cancelCause := context.WithCancelCause(context.Background())
+	cancelCause(errConnClosed)
+	require.Equal(t, ExitClientGone, ContextExit(ctx).Reason)
+
+	kick := Exit(ExitKicked, errors.New("bye"))
+	ctx, cancelCause = context.WithCancelCause(context.Background())
+	cancelCause(kick)
+	require.Same(t, kick, ContextExit(ctx), "a session exit cause is kept")
+}
+
+func TestShutdownEndsSessions(t *testing.T) {
+	signer, err := EphemeralSigner()
+	require.NoError(t, err)
+	server := New(":0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := func(ctx context.Context, _ *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) error {
+		req := <-requests
+		req.Reply(true, nil)
+		<-ctx.Done()
+		exit := ContextExit(ctx)
+		_, _ = io.WriteString(channel, exit.Error())
+		return exit
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handled := make(chan struct{})
+	go func() {
+		nc, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		server.handleConn(ctx, nc, handler)
+		close(handled)
+	}()
+
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "alice",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         2 * time.Second,
+	})
+	require.NoError(t, err)
+	defer client.Close()
+	sess, err := client.NewSession()
+	require.NoError(t, err)
+	var out strings.Builder
+	sess.Stdout = &out
+	require.NoError(t, sess.Start("wait"))
+
+	cancel()
+	var exit *ssh.ExitError
+	require.ErrorAs(t, sess.Wait(), &exit, "the session ends with an exit status before the connection closes")
+	require.Equal(t, 1, exit.ExitStatus())
+	require.Equal(t, "server is shutting down", out.String())
+	<-handled
+	require.Equal(t, int64(1), server.SessionExits()["shutdown"])
+}
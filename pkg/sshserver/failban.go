@@ -0,0 +1,213 @@
+package sshserver
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// FailBan temporarily bans source addresses that keep failing to connect, in
+// the manner of fail2ban. MaxFailures failures within Window ban an address
+// for BanFor; every further ban of the same address doubles that, up to
+// MaxBan. A failure is a password or keyboard-interactive attempt that is
+// rejected, or a connection that sent data but never finished the handshake.
+// Probes that connect and send nothing do not count, so health checks are
+// never banned.
+type FailBan struct {
+	MaxFailures int
+	Window      time.Duration
+	BanFor      time.Duration
+	MaxBan      time.Duration
+}
+
+// FailBanStats counts what the fail ban did since the server started.
+type FailBanStats struct {
+	Failures int64 `json:"failures"`
+	Bans     int64 `json:"bans"`
+	Refused  int64 `json:"refused"`
+	Banned   int   `json:"banned"`
+}
+
+// WithFailBan enables FailBan. A zero MaxFailures disables it.
+func WithFailBan(cfg FailBan) Option {
+	return func(s *Server) {
+		if cfg.MaxFailures <= 0 {
+			s.failBan = nil
+			return
+		}
+		s.failBan = newFailBanner(cfg, time.Now)
+	}
+}
+
+// FailBanStats returns the fail ban counters; all zero when it is disabled.
+func (s *Server) FailBanStats() FailBanStats {
+	if s.failBan == nil {
+		return FailBanStats{}
+	}
+	return s.failBan.stats()
+}
+
+// failHost is what the fail ban remembers about one address.
+type failHost struct {
+	failures []time.Time
+	until    time.Time
+	// strikes is how many times the address has been banned; it is forgotten
+	// once the address stays out of trouble for MaxBan after a ban.
+	strikes int
+}
+
+type failBanner struct {
+	cfg FailBan
+	now func() time.Time
+
+	mu        sync.Mutex
+	hosts     map[string]*failHost
+	lastSweep time.Time
+	counts    FailBanStats
+}
+
+func newFailBanner(cfg FailBan, now func() time.Time) *failBanner {
+	if cfg.MaxBan < cfg.BanFor {
+		cfg.MaxBan = cfg.BanFor
+	}
+	return &failBanner{cfg: cfg, now: now, hosts: make(map[string]*failHost)}
+}
+
+// banned reports whether ip may not connect and, if so, until when.
+func (f *failBanner) banned(ip string) (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h, ok := f.hosts[ip]
+	if !ok || !f.now().Before(h.until) {
+		return time.Time{}, false
+	}
+	f.counts.Refused++
+	return h.until, true
+}
+
+// fail records a failure from ip and returns how long it is now banned for,
+// or zero when it is not.
+func (f *failBanner) fail(ip string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	f.sweepLocked(now)
+	f.counts.Failures++
+
+	h, ok := f.hosts[ip]
+	if !ok {
+		h = &failHost{}
+		f.hosts[ip] = h
+	}
+	if now.Before(h.until) {
+		return 0
+	}
+	if h.strikes > 0 && now.Sub(h.until) >= f.cfg.MaxBan {
+		h.strikes = 0
+	}
+	h.failures = append(pruneBefore(h.failures, now.Add(-f.cfg.Window)), now)
+	if len(h.failures) < f.cfg.MaxFailures {
+		return 0
+	}
+
+	d := f.cfg.BanFor
+	for i := 0; i < h.strikes && d < f.cfg.MaxBan; i++ {
+		d *= 2
+	}
+	d = min(d, f.cfg.MaxBan)
+	h.failures = nil
+	h.until = now.Add(d)
+	h.strikes++
+	f.counts.Bans++
+	return d
+}
+
+// succeed forgets the failures of ip once it authenticates, keeping its
+// strikes.
+func (f *failBanner) succeed(ip string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if h, ok := f.hosts[ip]; ok {
+		h.failures = nil
+	}
+}
+
+func (f *failBanner) stats() FailBanStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := f.counts
+	now := f.now()
+	for _, h := range f.hosts {
+		if now.Before(h.until) {
+			stats.Banned++
+		}
+	}
+	return stats
+}
+
+// sweepLocked drops addresses with nothing left to remember, at most once per
+// window so that a scan does not make every failure walk the whole map.
+func (f *failBanner) sweepLocked(now time.Time) {
+	if now.Sub(f.lastSweep) < f.cfg.Window {
+		return
+	}
+	f.lastSweep = now
+	for ip, h := range f.hosts {
+		h.failures = pruneBefore(h.failures, now.Add(-f.cfg.Window))
+		if len(h.failures) == 0 && now.Sub(h.until) >= f.cfg.MaxBan {
+			delete(f.hosts, ip)
+		}
+	}
+}
+
+// pruneBefore drops the times before cutoff from the sorted list.
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// applyFailBan counts rejected password and keyboard-interactive attempts.
+// Public key offers are not counted: clients routinely offer several keys
+// before the one that is accepted.
+func (s *Server) applyFailBan(cfg *ssh.ServerConfig) {
+	next := cfg.AuthLogCallback
+	cfg.AuthLogCallback = func(conn ssh.ConnMetadata, method string, err error) {
+		if next != nil {
+			next(conn, method, err)
+		}
+		ip := remoteIP(conn.RemoteAddr())
+		switch {
+		case err == nil:
+			s.failBan.succeed(ip)
+		case method == "password" || method == "keyboard-interactive":
+			s.recordFailure(ip, "auth failed")
+		}
+	}
+}
+
+// recordFailure counts a failure from ip and logs a resulting ban.
+func (s *Server) recordFailure(ip, what string) {
+	if d := s.failBan.fail(ip); d > 0 {
+		s.logger.Warn("sshserver: address banned after repeated failures", "ip", ip, "last_failure", what, "ban", d.String())
+	}
+}
+
+// readCounter notes whether the client sent anything, to tell a failed
+// handshake from a bare TCP probe.
+type readCounter struct {
+	net.Conn
+	read bool
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.read = true
+	}
+	return n, err
+}
@@ -0,0 +1,124 @@
+package sshserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFailBanner(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	f := newFailBanner(FailBan{MaxFailures: 3, Window: time.Minute, BanFor: time.Minute, MaxBan: 5 * time.Minute}, func() time.Time { return now })
+
+	require.Zero(t, f.fail("192.0.2.1"))
+	now = now.Add(2 * time.Minute)
+	require.Zero(t, f.fail("192.0.2.1"))
+	require.Zero(t, f.fail("192.0.2.1"), "failures outside the window are forgotten")
+	require.Equal(t, time.Minute, f.fail("192.0.2.1"))
+	until, banned := f.banned("192.0.2.1")
+	require.True(t, banned)
+	require.Equal(t, now.Add(time.Minute), until)
+	_, banned = f.banned("192.0.2.2")
+	require.False(t, banned, "other addresses are unaffected")
+
+	// Each further ban doubles, up to MaxBan.
+	want := []time.Duration{2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for _, d := range want {
+		_, banned = f.banned("192.0.2.1")
+		for banned {
+			now = now.Add(time.Minute)
+			_, banned = f.banned("192.0.2.1")
+		}
+		f.fail("192.0.2.1")
+		f.fail("192.0.2.1")
+		require.Equal(t, d, f.fail("192.0.2.1"))
+	}
+
+	// Staying out of trouble for MaxBan after a ban forgets the strikes.
+	now = now.Add(10 * time.Minute)
+	f.fail("192.0.2.1")
+	f.fail("192.0.2.1")
+	require.Equal(t, time.Minute, f.fail("192.0.2.1"))
+
+	// Authenticating forgets earlier failures.
+	f.fail("192.0.2.3")
+	f.fail("192.0.2.3")
+	f.succeed("192.0.2.3")
+	require.Zero(t, f.fail("192.0.2.3"))
+
+	stats := f.stats()
+	require.Equal(t, int64(6), stats.Bans)
+	require.Equal(t, 1, stats.Banned)
+	require.Positive(t, stats.Refused)
+
+	now = now.Add(time.Hour)
+	f.fail("192.0.2.4")
+	require.NotContains(t, f.hosts, "192.0.2.1", "idle addresses are swept")
+}
+
+func TestFailBanCountsPasswordFailures(t *testing.T) {
+	signer, err := EphemeralSigner()
+	require.NoError(t, err)
+	server := New(":0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithFailBan(FailBan{MaxFailures: 2, Window: time.Minute, BanFor: time.Minute}))
+	log := server.Config.AuthLogCallback
+	denied := errors.New("denied")
+
+	log(fakeConnMeta{user: "alice"}, "none", denied)
+	log(fakeConnMeta{user: "alice"}, "publickey", denied)
+	log(fakeConnMeta{user: "alice"}, "publickey", denied)
+	require.Zero(t, server.FailBanStats().Failures, "key offers and the none probe do not count")
+
+	log(fakeConnMeta{user: "alice"}, "password", denied)
+	log(fakeConnMeta{user: "alice"}, "keyboard-interactive", denied)
+	stats := server.FailBanStats()
+	require.Equal(t, int64(2), stats.Failures)
+	require.Equal(t, 1, stats.Banned)
+}
+
+func TestHandleConnFailBan(t *testing.T) {
+	signer, err := EphemeralSigner()
+	require.NoError(t, err)
+	server := New(":0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithFailBan(FailBan{MaxFailures: 2, Window: time.Minute, BanFor: time.Minute}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := func(context.Context, *ssh.ServerConn, ssh.Channel, <-chan *ssh.Request) error { return nil }
+
+	connect := func(send string) string {
+		serverConn, clientConn := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			server.handleConn(ctx, serverConn, handler)
+			close(done)
+		}()
+		defer func() { <-done }()
+		defer clientConn.Close()
+		require.NoError(t, clientConn.SetDeadline(time.Now().Add(2*time.Second)))
+		line, err := bufio.NewReader(clientConn).ReadString('\n')
+		require.NoError(t, err)
+		if send != "" {
+			_, _ = io.WriteString(clientConn, send)
+		}
+		return line
+	}
+
+	for i := 0; i < 3; i++ {
+		require.Contains(t, connect(""), "SSH-2.0-", "probes that send nothing are not failures")
+	}
+	require.Zero(t, server.FailBanStats().Failures)
+
+	connect("GET / HTTP/1.0\r\n\r\n")
+	connect("GET / HTTP/1.0\r\n\r\n")
+	require.Contains(t, connect(""), "too many failed attempts from pipe")
+	stats := server.FailBanStats()
+	require.Equal(t, FailBanStats{Failures: 2, Bans: 1, Refused: 1, Banned: 1}, stats)
+}
@@ -0,0 +1,89 @@
+package sshserver
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// defaultHandshakeTimeout bounds the SSH handshake, authentication
+	// included, so connections that stall it do not hold a connection slot.
+	defaultHandshakeTimeout = 30 * time.Second
+	// defaultInteractiveTimeout bounds each keyboard-interactive attempt,
+	// which waits on a person: long enough for a device flow sign-in.
+	defaultInteractiveTimeout = defaultDeviceLifetime
+)
+
+// WithHandshakeTimeout bounds how long a connection may take to finish the
+// SSH handshake and authenticate. Keyboard-interactive authentication waits
+// on the user, e.g. to approve an OIDC device flow in a browser, so each
+// attempt gets interactive instead. Zero keeps a default: 30s and 10m.
+func WithHandshakeTimeout(handshake, interactive time.Duration) Option {
+	return func(s *Server) {
+		if handshake > 0 {
+			s.handshakeTimeout = handshake
+		}
+		if interactive > 0 {
+			s.interactiveTimeout = interactive
+		}
+	}
+}
+
+// handshakes tracks the connections in their handshake by remote address, so
+// auth callbacks, which only see ssh.ConnMetadata, can move their deadline.
+type handshakes struct {
+	mu    sync.Mutex
+	conns map[string]net.Conn
+}
+
+// start sets the handshake deadline of conn and tracks it until done is
+// called, which clears the deadline.
+func (h *handshakes) start(conn net.Conn, timeout time.Duration) (done func()) {
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	key := conn.RemoteAddr().String()
+	h.mu.Lock()
+	if h.conns == nil {
+		h.conns = make(map[string]net.Conn)
+	}
+	// Addresses are unique for TCP; anything else just is not extended.
+	_, dup := h.conns[key]
+	if !dup {
+		h.conns[key] = conn
+	}
+	h.mu.Unlock()
+	return func() {
+		if !dup {
+			h.mu.Lock()
+			delete(h.conns, key)
+			h.mu.Unlock()
+		}
+		_ = conn.SetDeadline(time.Time{})
+	}
+}
+
+// extend moves the deadline of the connection meta belongs to timeout ahead.
+func (h *handshakes) extend(meta ssh.ConnMetadata, timeout time.Duration) {
+	h.mu.Lock()
+	conn, ok := h.conns[meta.RemoteAddr().String()]
+	h.mu.Unlock()
+	if ok {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+}
+
+// applyInteractiveTimeout gives each keyboard-interactive attempt the
+// interactive budget, and the rest of the handshake the usual one afterwards.
+func (s *Server) applyInteractiveTimeout(cfg *ssh.ServerConfig) {
+	next := cfg.KeyboardInteractiveCallback
+	if next == nil {
+		return
+	}
+	cfg.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+		s.handshakes.extend(conn, s.interactiveTimeout)
+		defer s.handshakes.extend(conn, s.handshakeTimeout)
+		return next(conn, challenge)
+	}
+}
@@ -1,24 +1,128 @@
 package sshserver
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"golang.org/x/crypto/ssh"
 )
 
-const rsaKeyBits = 2048
+// KeyType selects the algorithm used when a host key has to be generated.
+// Existing keys of any type supported by x/crypto/ssh are loaded as is.
+type KeyType string
 
-// LoadOrGenerateSigner loads an SSH signer from the provided path, generating a new RSA host key if none exists.
-func LoadOrGenerateSigner(path string) (ssh.Signer, error) {
+// Supported host key types.
+const (
+	KeyEd25519   KeyType = "ed25519"
+	KeyECDSAP256 KeyType = "ecdsa-p256"
+	KeyRSA4096   KeyType = "rsa-4096"
+)
+
+// DefaultKeyType is generated when no type is requested.
+const DefaultKeyType = KeyEd25519
+
+const rsaKeyBits = 4096
+
+// hostKeyComment labels generated keys in the private and public key files.
+const hostKeyComment = "schat host key"
+
+// Algorithm returns the SSH public key algorithm of keys of this type.
+func (t KeyType) Algorithm() string {
+	switch t {
+	case KeyEd25519:
+		return ssh.KeyAlgoED25519
+	case KeyECDSAP256:
+		return ssh.KeyAlgoECDSA256
+	case KeyRSA4096:
+		return ssh.KeyAlgoRSA
+	default:
+		return ""
+	}
+}
+
+// KeyTypes lists the accepted key type names.
+func KeyTypes() []string {
+	return []string{string(KeyEd25519), string(KeyECDSAP256), string(KeyRSA4096)}
+}
+
+// ParseKeyType validates a key type name. An empty name selects DefaultKeyType.
+func ParseKeyType(name string) (KeyType, error) {
+	switch t := KeyType(strings.ToLower(strings.TrimSpace(name))); t {
+	case "":
+		return DefaultKeyType, nil
+	case KeyEd25519, KeyECDSAP256, KeyRSA4096:
+		return t, nil
+	default:
+		return "", fmt.Errorf("sshserver: unknown host key type %q (want one of %s)", name, strings.Join(KeyTypes(), ", "))
+	}
+}
+
+// PassphraseFunc supplies the passphrase for an encrypted host key. It is only
+// called when the key on disk is encrypted.
+type PassphraseFunc func() ([]byte, error)
+
+// PassphraseFromEnv reads the passphrase from the named environment variable.
+func PassphraseFromEnv(name string) PassphraseFunc {
+	return func() ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("sshserver: host key is encrypted and $%s is not set", name)
+		}
+		return []byte(value), nil
+	}
+}
+
+type hostKeyOptions struct {
+	keyType    KeyType
+	passphrase PassphraseFunc
+}
+
+// HostKeyOption customises host key loading and generation.
+type HostKeyOption func(*hostKeyOptions)
+
+// WithKeyType sets the algorithm for newly generated keys.
+func WithKeyType(t KeyType) HostKeyOption {
+	return func(o *hostKeyOptions) {
+		if t != "" {
+			o.keyType = t
+		}
+	}
+}
+
+// WithPassphrase sets how the passphrase of an encrypted host key is obtained.
+func WithPassphrase(fn PassphraseFunc) HostKeyOption {
+	return func(o *hostKeyOptions) {
+		o.passphrase = fn
+	}
+}
+
+func newHostKeyOptions(opts []HostKeyOption) hostKeyOptions {
+	o := hostKeyOptions{keyType: DefaultKeyType}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// LoadOrGenerateSigner loads an SSH signer from the provided path, generating
+// a new host key in OpenSSH format if none exists. The public key is written
+// next to it with a ".pub" suffix.
+func LoadOrGenerateSigner(path string, opts ...HostKeyOption) (ssh.Signer, error) {
+	o := newHostKeyOptions(opts)
 	if path == "" {
-		return EphemeralSigner()
+		return EphemeralSigner(opts...)
 	}
 
 	absPath, err := filepath.Abs(path)
@@ -26,22 +130,80 @@ func LoadOrGenerateSigner(path string) (ssh.Signer, error) {
 		return nil, fmt.Errorf("sshserver: resolve host key path: %w", err)
 	}
 
-	if signer, err := loadSigner(absPath); err == nil {
+	if signer, err := loadSigner(absPath, o.passphrase); err == nil {
 		return signer, nil
 	} else if !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
 
-	return generateAndStoreSigner(absPath)
+	return generateAndStoreSigner(absPath, o.keyType)
+}
+
+// LoadSigner loads an existing host key. Unlike LoadOrGenerateSigner it never
+// creates one, so a missing file is reported as an error wrapping
+// os.ErrNotExist.
+func LoadSigner(path string, opts ...HostKeyOption) (ssh.Signer, error) {
+	signer, err := loadSigner(path, newHostKeyOptions(opts).passphrase)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("sshserver: host key %q: %w", path, err)
+	}
+	return signer, err
+}
+
+// GenerateSigner writes a new host key to path as LoadOrGenerateSigner would,
+// refusing to replace an existing file.
+func GenerateSigner(path string, opts ...HostKeyOption) (ssh.Signer, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("sshserver: host key %q already exists", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("sshserver: host key %q: %w", path, err)
+	}
+	return generateAndStoreSigner(path, newHostKeyOptions(opts).keyType)
+}
+
+// CheckHostKeys reports host keys that cannot be served together. SSH offers
+// one key per algorithm, so a later key would silently replace an earlier one
+// of the same type.
+func CheckHostKeys(signers ...ssh.Signer) error {
+	seen := make(map[string]string, len(signers))
+	for _, signer := range signers {
+		algo := signer.PublicKey().Type()
+		fp := ssh.FingerprintSHA256(signer.PublicKey())
+		if prev, ok := seen[algo]; ok {
+			return fmt.Errorf("sshserver: host keys %s and %s are both %s; serve at most one key per algorithm", prev, fp, algo)
+		}
+		seen[algo] = fp
+	}
+	return nil
+}
+
+// ParseSigner parses a PEM or OpenSSH private key held in memory, such as one
+// fetched from a secrets store. name identifies the key in errors.
+func ParseSigner(name string, data []byte, opts ...HostKeyOption) (ssh.Signer, error) {
+	return parseSigner(name, data, newHostKeyOptions(opts).passphrase)
 }
 
-func loadSigner(path string) (ssh.Signer, error) {
+func loadSigner(path string, passphrase PassphraseFunc) (ssh.Signer, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	return parseSigner(path, data, passphrase)
+}
 
+func parseSigner(path string, data []byte, passphrase PassphraseFunc) (ssh.Signer, error) {
 	key, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == nil {
+			return nil, fmt.Errorf("sshserver: host key %q is encrypted and no passphrase source is configured", path)
+		}
+		secret, perr := passphrase()
+		if perr != nil {
+			return nil, perr
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, secret)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("sshserver: parse host key %q: %w", path, err)
 	}
@@ -54,8 +216,12 @@ func loadSigner(path string) (ssh.Signer, error) {
 	return signer, nil
 }
 
-func generateAndStoreSigner(path string) (ssh.Signer, error) {
-	key, err := generateRSAKey()
+func generateAndStoreSigner(path string, keyType KeyType) (ssh.Signer, error) {
+	key, err := generateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := signerFromKey(key)
 	if err != nil {
 		return nil, err
 	}
@@ -65,36 +231,54 @@ func generateAndStoreSigner(path string) (ssh.Signer, error) {
 		return nil, fmt.Errorf("sshserver: create host key dir %q: %w", dir, err)
 	}
 
-	pemBlock := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	block, err := ssh.MarshalPrivateKey(key, hostKeyComment)
+	if err != nil {
+		return nil, fmt.Errorf("sshserver: encode host key: %w", err)
 	}
-
-	if err := os.WriteFile(path, pem.EncodeToMemory(pemBlock), 0o600); err != nil {
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
 		return nil, fmt.Errorf("sshserver: write host key %q: %w", path, err)
 	}
 
-	return signerFromKey(key)
+	pub := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))) + " " + hostKeyComment + "\n"
+	if err := os.WriteFile(path+".pub", []byte(pub), 0o644); err != nil {
+		return nil, fmt.Errorf("sshserver: write host public key %q: %w", path+".pub", err)
+	}
+
+	return signer, nil
 }
 
-// EphemeralSigner creates a temporary RSA host key for development environments.
-func EphemeralSigner() (ssh.Signer, error) {
-	key, err := generateRSAKey()
+// EphemeralSigner creates a temporary host key for development environments.
+func EphemeralSigner(opts ...HostKeyOption) (ssh.Signer, error) {
+	key, err := generateKey(newHostKeyOptions(opts).keyType)
 	if err != nil {
 		return nil, err
 	}
 	return signerFromKey(key)
 }
 
-func generateRSAKey() (*rsa.PrivateKey, error) {
-	key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+func generateKey(keyType KeyType) (crypto.Signer, error) {
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch keyType {
+	case KeyEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case KeyECDSAP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyRSA4096:
+		key, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		_, err = ParseKeyType(string(keyType))
+		return nil, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("sshserver: generate host key: %w", err)
+		return nil, fmt.Errorf("sshserver: generate %s host key: %w", keyType, err)
 	}
 	return key, nil
 }
 
-func signerFromKey(key *rsa.PrivateKey) (ssh.Signer, error) {
+func signerFromKey(key crypto.Signer) (ssh.Signer, error) {
 	signer, err := ssh.NewSignerFromKey(key)
 	if err != nil {
 		return nil, fmt.Errorf("sshserver: create signer: %w", err)
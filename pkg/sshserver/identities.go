@@ -0,0 +1,150 @@
+package sshserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxIdentitySuffix bounds the search for a free username when a new key asks
+// for a name another key already holds.
+const maxIdentitySuffix = 1000
+
+// Profile is what a public key is known as across reconnects.
+type Profile struct {
+	// Fingerprint is the SHA256 fingerprint of the key, as from
+	// ssh.FingerprintSHA256.
+	Fingerprint string `json:"fingerprint"`
+	User        string `json:"user"`
+	// Color is the name of the user's display color, e.g. "cyan".
+	Color string `json:"color,omitempty"`
+	// Operator makes the key an operator whatever the operators list says. It
+	// is only ever set by editing the file.
+	Operator  bool      `json:"operator,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Identities maps public key fingerprints to stable profiles, so someone
+// signing in with the same key keeps their name, color, and operator status
+// whatever SSH username they connect as. A key seen for the first time gets
+// the username it connected with, or the first free name after it (alice-2).
+// Profiles are saved to a JSON file as they are created.
+type Identities struct {
+	path  string
+	clock func() time.Time
+
+	mu       sync.RWMutex
+	profiles map[string]Profile
+}
+
+// OpenIdentities loads the identities file at path, starting empty when it
+// does not exist.
+func OpenIdentities(path string) (*Identities, error) {
+	ids := &Identities{path: path, clock: time.Now, profiles: make(map[string]Profile)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sshserver: read identities %q: %w", path, err)
+	}
+	var list []Profile
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("sshserver: parse identities %q: %w", path, err)
+	}
+	for _, p := range list {
+		if p.Fingerprint == "" || p.User == "" {
+			return nil, fmt.Errorf("sshserver: parse identities %q: profile without fingerprint or user", path)
+		}
+		ids.profiles[p.Fingerprint] = p
+	}
+	return ids, nil
+}
+
+// Lookup returns the profile of the key with the given fingerprint.
+func (i *Identities) Lookup(fingerprint string) (Profile, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	p, ok := i.profiles[fingerprint]
+	return p, ok
+}
+
+// Claim returns the profile of the key with the given fingerprint, creating
+// it from want when the key is new. A new profile is named want.User unless
+// another key holds that name or taken reports it, in which case a numeric
+// suffix is added.
+func (i *Identities) Claim(fingerprint string, want Profile, taken func(user string) bool) (Profile, error) {
+	if fingerprint == "" || want.User == "" {
+		return Profile{}, errors.New("sshserver: identity fingerprint and user required")
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if p, ok := i.profiles[fingerprint]; ok {
+		return p, nil
+	}
+
+	user, err := i.freeNameLocked(want.User, taken)
+	if err != nil {
+		return Profile{}, err
+	}
+	p := Profile{Fingerprint: fingerprint, User: user, Color: want.Color, CreatedAt: i.clock().UTC()}
+	i.profiles[fingerprint] = p
+	if err := i.saveLocked(); err != nil {
+		delete(i.profiles, fingerprint)
+		return Profile{}, err
+	}
+	return p, nil
+}
+
+// freeNameLocked returns user, or user-2, user-3, ... if it is in use.
+func (i *Identities) freeNameLocked(user string, taken func(string) bool) (string, error) {
+	held := make(map[string]bool, len(i.profiles))
+	for _, p := range i.profiles {
+		held[p.User] = true
+	}
+	name := user
+	for n := 2; n <= maxIdentitySuffix; n++ {
+		if !held[name] && (taken == nil || !taken(name)) {
+			return name, nil
+		}
+		name = user + "-" + strconv.Itoa(n)
+	}
+	return "", fmt.Errorf("sshserver: no free username like %q", user)
+}
+
+// saveLocked writes the profiles to disk atomically, readable only by the
+// server's user.
+func (i *Identities) saveLocked() error {
+	list := make([]Profile, 0, len(i.profiles))
+	for _, p := range i.profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].User < list[b].User })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("sshserver: encode identities: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(i.path), ".identities-*")
+	if err != nil {
+		return fmt.Errorf("sshserver: save identities %q: %w", i.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sshserver: save identities %q: %w", i.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("sshserver: save identities %q: %w", i.path, err)
+	}
+	if err := os.Rename(tmp.Name(), i.path); err != nil {
+		return fmt.Errorf("sshserver: save identities %q: %w", i.path, err)
+	}
+	return nil
+}
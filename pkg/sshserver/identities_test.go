@@ -0,0 +1,66 @@
+package sshserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentitiesKeepNamesPerKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.json")
+	ids, err := OpenIdentities(path)
+	require.NoError(t, err)
+
+	alice, err := ids.Claim("SHA256:alice", Profile{User: "alice", Color: "cyan"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "alice", alice.User)
+	require.Equal(t, "cyan", alice.Color)
+	require.False(t, alice.CreatedAt.IsZero())
+
+	again, err := ids.Claim("SHA256:alice", Profile{User: "root", Color: "red"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, alice, again, "a known key keeps its profile whatever name it asks for")
+
+	other, err := ids.Claim("SHA256:other", Profile{User: "alice"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "alice-2", other.User, "another key cannot take the name")
+
+	registered := func(user string) bool { return user == "carol" }
+	carol, err := ids.Claim("SHA256:carol", Profile{User: "carol"}, registered)
+	require.NoError(t, err)
+	require.Equal(t, "carol-2", carol.User)
+
+	_, err = ids.Claim("", Profile{User: "dave"}, nil)
+	require.Error(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	reopened, err := OpenIdentities(path)
+	require.NoError(t, err)
+	got, ok := reopened.Lookup("SHA256:other")
+	require.True(t, ok)
+	require.Equal(t, "alice-2", got.User)
+	_, ok = reopened.Lookup("SHA256:unknown")
+	require.False(t, ok)
+}
+
+func TestOpenIdentitiesRejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "identities.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"fingerprint":"SHA256:x"}]`), 0o600))
+	_, err := OpenIdentities(path)
+	require.ErrorContains(t, err, "without fingerprint or user")
+
+	require.NoError(t, os.WriteFile(path, []byte(`not json`), 0o600))
+	_, err = OpenIdentities(path)
+	require.Error(t, err)
+
+	ids, err := OpenIdentities(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	_, ok := ids.Lookup("SHA256:x")
+	require.False(t, ok)
+}
@@ -0,0 +1,81 @@
+package sshserver
+
+import (
+	"net"
+	"sync"
+)
+
+// WithConnLimits caps concurrent connections across the server and per source
+// IP. Connections over either limit are closed before the SSH handshake, so a
+// connection storm never reaches key exchange. Zero means unlimited.
+func WithConnLimits(maxTotal, maxPerIP int) Option {
+	return func(s *Server) {
+		s.limits.setLimits(maxTotal, maxPerIP)
+	}
+}
+
+// SetConnLimits changes the connection limits of a running server. Connections
+// already open are kept even if they now exceed a lowered limit.
+func (s *Server) SetConnLimits(maxTotal, maxPerIP int) {
+	s.limits.setLimits(maxTotal, maxPerIP)
+}
+
+// connLimiter counts open connections. Zero limits admit everything.
+type connLimiter struct {
+	mu       sync.Mutex
+	maxTotal int
+	maxPerIP int
+	total    int
+	perIP    map[string]int
+}
+
+func newConnLimiter(maxTotal, maxPerIP int) *connLimiter {
+	l := &connLimiter{perIP: make(map[string]int)}
+	l.setLimits(maxTotal, maxPerIP)
+	return l
+}
+
+func (l *connLimiter) setLimits(maxTotal, maxPerIP int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxTotal = maxTotal
+	l.maxPerIP = maxPerIP
+}
+
+// acquire reserves a slot for ip, returning a reason when a limit is reached.
+func (l *connLimiter) acquire(ip string) (reason string, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return "server is full", false
+	}
+	if l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP {
+		return "too many connections from " + ip, false
+	}
+	l.total++
+	l.perIP[ip]++
+	return "", true
+}
+
+func (l *connLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// remoteIP returns the host part of addr, or the whole string when it has no port.
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,334 @@
+package sshserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	deviceCodeGrantType   = "urn:ietf:params:oauth:grant-type:device_code"
+	defaultDevicePoll     = 5 * time.Second
+	defaultDeviceLifetime = 10 * time.Minute
+)
+
+// DeviceFlowConfig configures the OIDC device authorization grant (RFC 8628).
+type DeviceFlowConfig struct {
+	// Issuer is the OIDC issuer URL used for discovery.
+	Issuer   string
+	ClientID string
+	// Scopes defaults to "openid profile".
+	Scopes []string
+
+	// DeviceAuthURL and TokenURL skip discovery when both are set.
+	DeviceAuthURL string
+	TokenURL      string
+
+	HTTPClient *http.Client
+}
+
+// DeviceFlow authenticates users through keyboard-interactive by printing a
+// verification URL and code, then polling the identity provider until the user
+// approves the login in a browser. The name the provider vouches for, in
+// ExtOIDCUsername, replaces the SSH username.
+type DeviceFlow struct {
+	cfg    DeviceFlowConfig
+	client *http.Client
+
+	// defaultInterval applies when the provider does not suggest a poll interval.
+	defaultInterval time.Duration
+	// clock checks ID tokens for expiry.
+	clock func() time.Time
+}
+
+// NewDeviceFlow validates cfg and resolves the provider endpoints, performing
+// OIDC discovery against the issuer when explicit URLs are not supplied.
+func NewDeviceFlow(ctx context.Context, cfg DeviceFlowConfig) (*DeviceFlow, error) {
+	if cfg.ClientID == "" {
+		return nil, errors.New("sshserver: oidc client id required")
+	}
+	if cfg.Issuer == "" {
+		// ID tokens are checked against it even with explicit endpoints.
+		return nil, errors.New("sshserver: oidc issuer required")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile"}
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+
+	if cfg.DeviceAuthURL == "" || cfg.TokenURL == "" {
+		if err := discoverEndpoints(ctx, client, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return &DeviceFlow{cfg: cfg, client: client, defaultInterval: defaultDevicePoll, clock: time.Now}, nil
+}
+
+func discoverEndpoints(ctx context.Context, client *http.Client, cfg *DeviceFlowConfig) error {
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return fmt.Errorf("sshserver: oidc discovery: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sshserver: oidc discovery: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sshserver: oidc discovery: unexpected status %s", resp.Status)
+	}
+
+	var doc struct {
+		DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+		TokenEndpoint               string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("sshserver: oidc discovery: decode: %w", err)
+	}
+	if doc.DeviceAuthorizationEndpoint == "" || doc.TokenEndpoint == "" {
+		return errors.New("sshserver: oidc discovery: provider does not support the device flow")
+	}
+
+	if cfg.DeviceAuthURL == "" {
+		cfg.DeviceAuthURL = doc.DeviceAuthorizationEndpoint
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = doc.TokenEndpoint
+	}
+	return nil
+}
+
+// Apply installs the keyboard-interactive callback.
+func (d *DeviceFlow) Apply(cfg *ssh.ServerConfig) {
+	cfg.KeyboardInteractiveCallback = d.authenticate
+}
+
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
+}
+
+func (d *DeviceFlow) authenticate(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+	auth, err := d.requestDeviceCode()
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime := time.Duration(auth.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultDeviceLifetime
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lifetime)
+	defer cancel()
+
+	if _, err := challenge(conn.User(), deviceInstruction(auth), nil, nil); err != nil {
+		return nil, err
+	}
+
+	claims, err := d.pollToken(ctx, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.Permissions{Extensions: map[string]string{
+		ExtAuthMethod:   "oidc",
+		ExtOIDCSubject:  claims.Subject,
+		ExtOIDCUsername: claims.username(),
+		ExtAccount:      "1",
+	}}, nil
+}
+
+func deviceInstruction(auth *deviceAuthorization) string {
+	if auth.VerificationURIComplete != "" {
+		return fmt.Sprintf("To sign in, open %s\r\nand confirm the code %s.\r\n", auth.VerificationURIComplete, auth.UserCode)
+	}
+	return fmt.Sprintf("To sign in, open %s\r\nand enter the code %s.\r\n", auth.VerificationURI, auth.UserCode)
+}
+
+func (d *DeviceFlow) requestDeviceCode() (*deviceAuthorization, error) {
+	form := url.Values{
+		"client_id": {d.cfg.ClientID},
+		"scope":     {strings.Join(d.cfg.Scopes, " ")},
+	}
+
+	resp, err := d.client.PostForm(d.cfg.DeviceAuthURL, form)
+	if err != nil {
+		return nil, fmt.Errorf("sshserver: oidc device authorization: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sshserver: oidc device authorization: unexpected status %s", resp.Status)
+	}
+
+	var auth deviceAuthorization
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return nil, fmt.Errorf("sshserver: oidc device authorization: decode: %w", err)
+	}
+	if auth.DeviceCode == "" || auth.UserCode == "" {
+		return nil, errors.New("sshserver: oidc device authorization: incomplete response")
+	}
+	return &auth, nil
+}
+
+func (d *DeviceFlow) pollToken(ctx context.Context, auth *deviceAuthorization) (*idTokenClaims, error) {
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = d.defaultInterval
+	}
+
+	form := url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"device_code": {auth.DeviceCode},
+		"client_id":   {d.cfg.ClientID},
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("sshserver: oidc device flow: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+
+		tok, err := d.exchange(ctx, form)
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok.Error {
+		case "":
+			return d.parseIDToken(tok.IDToken)
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, fmt.Errorf("sshserver: oidc device flow: %s", tok.Error)
+		}
+	}
+}
+
+func (d *DeviceFlow) exchange(ctx context.Context, form url.Values) (*tokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("sshserver: oidc token: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sshserver: oidc token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tok tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("sshserver: oidc token: decode: %w", err)
+	}
+	if tok.Error == "" && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sshserver: oidc token: unexpected status %s", resp.Status)
+	}
+	return &tok, nil
+}
+
+type idTokenClaims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	Expiry          int64    `json:"exp"`
+	Email           string   `json:"email"`
+	EmailVerified   bool     `json:"email_verified"`
+}
+
+// audience is the aud claim, which is a string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// username is the name the user joins the chat under: their email if the
+// provider verified it, or else their subject. Claims such as
+// preferred_username are left alone, as users may set them to anything.
+func (c *idTokenClaims) username() string {
+	if c.Email != "" && c.EmailVerified {
+		return c.Email
+	}
+	return c.Subject
+}
+
+// parseIDToken extracts the claims from an ID token and checks that this
+// client's issuer issued it to this client and that it has not expired (OIDC
+// Core 3.1.3.7). The token is received directly from the token endpoint over
+// TLS, which the same section accepts in place of signature validation.
+func (d *DeviceFlow) parseIDToken(raw string) (*idTokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("sshserver: oidc token: malformed id_token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("sshserver: oidc token: decode id_token: %w", err)
+	}
+
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("sshserver: oidc token: decode id_token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("sshserver: oidc token: id_token missing subject")
+	}
+	if strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(d.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("sshserver: oidc token: id_token issued by %q, not %q", claims.Issuer, d.cfg.Issuer)
+	}
+	if !slices.Contains(claims.Audience, d.cfg.ClientID) {
+		return nil, fmt.Errorf("sshserver: oidc token: id_token not issued to client %q", d.cfg.ClientID)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != "" && claims.AuthorizedParty != d.cfg.ClientID {
+		return nil, fmt.Errorf("sshserver: oidc token: id_token authorized for %q", claims.AuthorizedParty)
+	}
+	if claims.Expiry == 0 {
+		return nil, errors.New("sshserver: oidc token: id_token missing expiry")
+	}
+	if !d.clock().Before(time.Unix(claims.Expiry, 0)) {
+		return nil, errors.New("sshserver: oidc token: id_token expired")
+	}
+	return &claims, nil
+}
@@ -0,0 +1,260 @@
+package sshserver
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Policy selects the key exchanges, ciphers, MACs, and client public key
+// algorithms the server offers, and the smallest RSA client key it accepts.
+//
+// x/crypto/ssh does not offer Diffie-Hellman group exchange on the server, so
+// there is no moduli file to prune; the presets choose among fixed groups.
+type Policy struct {
+	Name         string
+	KeyExchanges []string
+	Ciphers      []string
+	MACs         []string
+	// PublicKeyAlgorithms are the signature algorithms accepted from clients.
+	PublicKeyAlgorithms []string
+	// MinRSABits refuses RSA client keys, and warns about RSA host keys,
+	// shorter than this.
+	MinRSABits int
+}
+
+// Policy presets.
+const (
+	PolicyModern       = "modern"
+	PolicyIntermediate = "intermediate"
+	PolicyLegacy       = "legacy"
+)
+
+// DefaultPolicy is used when no policy is configured.
+const DefaultPolicy = PolicyIntermediate
+
+// Algorithms x/crypto/ssh implements, strongest first.
+var (
+	supportedKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group16-sha512", "diffie-hellman-group14-sha256",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+	}
+	supportedCiphers = []string{
+		"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com", "aes128-gcm@openssh.com",
+		"aes256-ctr", "aes192-ctr", "aes128-ctr",
+		"aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour",
+	}
+	supportedMACs = []string{
+		"hmac-sha2-512-etm@openssh.com", "hmac-sha2-256-etm@openssh.com",
+		"hmac-sha2-512", "hmac-sha2-256", "hmac-sha1", "hmac-sha1-96",
+	}
+	supportedPublicKeyAlgorithms = []string{
+		ssh.KeyAlgoED25519, ssh.KeyAlgoSKED25519, ssh.KeyAlgoSKECDSA256,
+		ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	}
+)
+
+// weakAlgorithms are supported for old clients but no longer considered safe,
+// with the reason the startup report gives.
+var weakAlgorithms = map[string]string{
+	"diffie-hellman-group1-sha1":  "1024-bit group and SHA-1",
+	"diffie-hellman-group14-sha1": "SHA-1",
+	"aes128-cbc":                  "CBC mode",
+	"3des-cbc":                    "64-bit block cipher",
+	"arcfour256":                  "RC4",
+	"arcfour128":                  "RC4",
+	"arcfour":                     "RC4",
+	"hmac-sha1":                   "SHA-1",
+	"hmac-sha1-96":                "truncated SHA-1",
+	ssh.KeyAlgoRSA:                "SHA-1 signatures",
+	ssh.KeyAlgoDSA:                "DSA",
+}
+
+// minSafeRSABits is the RSA size below which the report warns.
+const minSafeRSABits = 2048
+
+var policies = map[string]Policy{
+	PolicyModern: {
+		Name:         PolicyModern,
+		KeyExchanges: []string{"curve25519-sha256", "curve25519-sha256@libssh.org"},
+		Ciphers:      []string{"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com", "aes128-gcm@openssh.com"},
+		MACs:         []string{"hmac-sha2-512-etm@openssh.com", "hmac-sha2-256-etm@openssh.com"},
+		PublicKeyAlgorithms: []string{
+			ssh.KeyAlgoED25519, ssh.KeyAlgoSKED25519, ssh.KeyAlgoSKECDSA256,
+			ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+			ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256,
+		},
+		MinRSABits: 3072,
+	},
+	PolicyIntermediate: {
+		Name: PolicyIntermediate,
+		KeyExchanges: []string{
+			"curve25519-sha256", "curve25519-sha256@libssh.org",
+			"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+			"diffie-hellman-group16-sha512", "diffie-hellman-group14-sha256",
+		},
+		Ciphers: []string{
+			"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com", "aes128-gcm@openssh.com",
+			"aes256-ctr", "aes192-ctr", "aes128-ctr",
+		},
+		MACs: []string{
+			"hmac-sha2-512-etm@openssh.com", "hmac-sha2-256-etm@openssh.com",
+			"hmac-sha2-512", "hmac-sha2-256",
+		},
+		PublicKeyAlgorithms: []string{
+			ssh.KeyAlgoED25519, ssh.KeyAlgoSKED25519, ssh.KeyAlgoSKECDSA256,
+			ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+			ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256,
+		},
+		MinRSABits: 2048,
+	},
+	PolicyLegacy: {
+		Name:                PolicyLegacy,
+		KeyExchanges:        supportedKeyExchanges,
+		Ciphers:             []string{"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com", "aes128-gcm@openssh.com", "aes256-ctr", "aes192-ctr", "aes128-ctr", "aes128-cbc", "3des-cbc"},
+		MACs:                supportedMACs,
+		PublicKeyAlgorithms: supportedPublicKeyAlgorithms,
+		MinRSABits:          1024,
+	},
+}
+
+// Policies lists the preset names, strictest first.
+func Policies() []string {
+	return []string{PolicyModern, PolicyIntermediate, PolicyLegacy}
+}
+
+// ParsePolicy returns the named preset. An empty name selects DefaultPolicy.
+func ParsePolicy(name string) (Policy, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if key == "" {
+		key = DefaultPolicy
+	}
+	p, ok := policies[key]
+	if !ok {
+		return Policy{}, fmt.Errorf("sshserver: unknown security policy %q (want one of %s)", name, strings.Join(Policies(), ", "))
+	}
+	p.KeyExchanges = slices.Clone(p.KeyExchanges)
+	p.Ciphers = slices.Clone(p.Ciphers)
+	p.MACs = slices.Clone(p.MACs)
+	p.PublicKeyAlgorithms = slices.Clone(p.PublicKeyAlgorithms)
+	return p, nil
+}
+
+// Validate reports algorithms x/crypto/ssh does not implement and lists or
+// sizes that leave nothing to negotiate.
+func (p Policy) Validate() error {
+	lists := []struct {
+		what      string
+		names     []string
+		supported []string
+	}{
+		{"key exchange", p.KeyExchanges, supportedKeyExchanges},
+		{"cipher", p.Ciphers, supportedCiphers},
+		{"MAC", p.MACs, supportedMACs},
+		{"public key algorithm", p.PublicKeyAlgorithms, supportedPublicKeyAlgorithms},
+	}
+	for _, l := range lists {
+		if len(l.names) == 0 {
+			return fmt.Errorf("sshserver: policy %s: no %s algorithms", p.Name, l.what)
+		}
+		for _, name := range l.names {
+			if !slices.Contains(l.supported, name) {
+				return fmt.Errorf("sshserver: policy %s: unsupported %s %q (want one of %s)", p.Name, l.what, name, strings.Join(l.supported, ", "))
+			}
+		}
+	}
+	if p.MinRSABits < 1024 {
+		return fmt.Errorf("sshserver: policy %s: minimum RSA size %d is below 1024 bits", p.Name, p.MinRSABits)
+	}
+	return nil
+}
+
+// Report summarises the policy as log attributes.
+func (p Policy) Report() []any {
+	return []any{
+		"policy", p.Name,
+		"kex", strings.Join(p.KeyExchanges, ","),
+		"ciphers", strings.Join(p.Ciphers, ","),
+		"macs", strings.Join(p.MACs, ","),
+		"pubkey_algorithms", strings.Join(p.PublicKeyAlgorithms, ","),
+		"min_rsa_bits", p.MinRSABits,
+	}
+}
+
+// Warnings lists the weak choices in the policy and among the host keys the
+// server will present.
+func (p Policy) Warnings(hostKeys ...ssh.Signer) []string {
+	var warnings []string
+	for _, list := range [][]string{p.KeyExchanges, p.Ciphers, p.MACs, p.PublicKeyAlgorithms} {
+		for _, name := range list {
+			if why, weak := weakAlgorithms[name]; weak {
+				warnings = append(warnings, fmt.Sprintf("%s is enabled (%s)", name, why))
+			}
+		}
+	}
+	if p.MinRSABits < minSafeRSABits {
+		warnings = append(warnings, fmt.Sprintf("RSA client keys of %d bits are accepted (below %d)", p.MinRSABits, minSafeRSABits))
+	}
+	for _, signer := range hostKeys {
+		key := signer.PublicKey()
+		switch bits := rsaBits(key); {
+		case key.Type() == ssh.KeyAlgoDSA:
+			warnings = append(warnings, fmt.Sprintf("host key %s is DSA", ssh.FingerprintSHA256(key)))
+		case bits > 0 && bits < max(p.MinRSABits, minSafeRSABits):
+			warnings = append(warnings, fmt.Sprintf("host key %s is %d-bit RSA", ssh.FingerprintSHA256(key), bits))
+		}
+	}
+	return warnings
+}
+
+// WithPolicy negotiates only the algorithms of p and refuses RSA client keys
+// shorter than p.MinRSABits. Validate p first; without this option the
+// x/crypto/ssh defaults apply.
+func WithPolicy(p Policy) Option {
+	return func(s *Server) {
+		s.Config.KeyExchanges = slices.Clone(p.KeyExchanges)
+		s.Config.Ciphers = slices.Clone(p.Ciphers)
+		s.Config.MACs = slices.Clone(p.MACs)
+		s.Config.PublicKeyAuthAlgorithms = slices.Clone(p.PublicKeyAlgorithms)
+		s.minRSABits = p.MinRSABits
+	}
+}
+
+// applyMinRSABits wraps the public key callback installed by the
+// authenticators to refuse short RSA keys before they are checked.
+func (s *Server) applyMinRSABits(cfg *ssh.ServerConfig) {
+	next := cfg.PublicKeyCallback
+	if next == nil {
+		return
+	}
+	cfg.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if bits := rsaBits(key); bits > 0 && bits < s.minRSABits {
+			s.logger.Warn("sshserver: short RSA key refused", "remote_addr", conn.RemoteAddr().String(),
+				"username", conn.User(), "key", ssh.FingerprintSHA256(key), "bits", bits, "min_bits", s.minRSABits)
+			return nil, errAuthFailed
+		}
+		return next(conn, key)
+	}
+}
+
+// rsaBits returns the modulus size of an RSA key or certificate, or 0 for
+// other keys.
+func rsaBits(key ssh.PublicKey) int {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	crypto, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	if k, ok := crypto.CryptoPublicKey().(*rsa.PublicKey); ok {
+		return k.N.BitLen()
+	}
+	return 0
+}
@@ -0,0 +1,154 @@
+package sshserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("")
+	require.NoError(t, err)
+	require.Equal(t, DefaultPolicy, p.Name)
+
+	for _, name := range Policies() {
+		p, err := ParsePolicy(name)
+		require.NoError(t, err)
+		require.NoError(t, p.Validate(), name)
+	}
+
+	_, err = ParsePolicy("paranoid")
+	require.ErrorContains(t, err, "modern, intermediate, legacy")
+
+	// Presets are copied, so overriding a list does not change them.
+	p, err = ParsePolicy(PolicyModern)
+	require.NoError(t, err)
+	p.Ciphers[0] = "3des-cbc"
+	again, err := ParsePolicy(PolicyModern)
+	require.NoError(t, err)
+	require.Equal(t, "chacha20-poly1305@openssh.com", again.Ciphers[0])
+}
+
+func TestPolicyValidate(t *testing.T) {
+	p, err := ParsePolicy(PolicyIntermediate)
+	require.NoError(t, err)
+
+	bad := p
+	bad.Ciphers = []string{"aes128-ctr", "twofish256-cbc"}
+	require.ErrorContains(t, bad.Validate(), `unsupported cipher "twofish256-cbc"`)
+
+	bad = p
+	bad.MACs = nil
+	require.ErrorContains(t, bad.Validate(), "no MAC algorithms")
+
+	bad = p
+	bad.MinRSABits = 512
+	require.ErrorContains(t, bad.Validate(), "below 1024 bits")
+}
+
+func TestPolicyWarnings(t *testing.T) {
+	modern, err := ParsePolicy(PolicyModern)
+	require.NoError(t, err)
+	ed, err := EphemeralSigner()
+	require.NoError(t, err)
+	require.Empty(t, modern.Warnings(ed))
+
+	intermediate, err := ParsePolicy(PolicyIntermediate)
+	require.NoError(t, err)
+	require.Empty(t, intermediate.Warnings(ed), "the default policy is not weak")
+
+	legacy, err := ParsePolicy(PolicyLegacy)
+	require.NoError(t, err)
+	warnings := legacy.Warnings()
+	require.Contains(t, warnings, "diffie-hellman-group1-sha1 is enabled (1024-bit group and SHA-1)")
+	require.Contains(t, warnings, "3des-cbc is enabled (64-bit block cipher)")
+	require.Contains(t, warnings, "hmac-sha1 is enabled (SHA-1)")
+	require.Contains(t, warnings, "RSA client keys of 1024 bits are accepted (below 2048)")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaSigner, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	warnings = modern.Warnings(rsaSigner)
+	require.Equal(t, []string{"host key " + ssh.FingerprintSHA256(rsaSigner.PublicKey()) + " is 2048-bit RSA"}, warnings)
+}
+
+func TestWithPolicyRefusesShortRSAKeys(t *testing.T) {
+	signer, err := EphemeralSigner()
+	require.NoError(t, err)
+	short, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	shortKey, err := ssh.NewPublicKey(&short.PublicKey)
+	require.NoError(t, err)
+	long, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	longKey, err := ssh.NewPublicKey(&long.PublicKey)
+	require.NoError(t, err)
+
+	keysPath := filepath.Join(t.TempDir(), "authorized_keys")
+	require.NoError(t, os.WriteFile(keysPath, append(ssh.MarshalAuthorizedKey(shortKey), ssh.MarshalAuthorizedKey(longKey)...), 0o600))
+	ak, err := LoadAuthorizedKeys(keysPath)
+	require.NoError(t, err)
+
+	p, err := ParsePolicy(PolicyIntermediate)
+	require.NoError(t, err)
+	server := New(":0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)), WithPolicy(p), WithAuthenticators(ak))
+
+	_, err = server.Config.PublicKeyCallback(fakeConnMeta{user: "alice"}, shortKey)
+	require.ErrorIs(t, err, errAuthFailed)
+	_, err = server.Config.PublicKeyCallback(fakeConnMeta{user: "alice"}, longKey)
+	require.NoError(t, err)
+}
+
+func TestWithPolicyLimitsNegotiation(t *testing.T) {
+	signer, err := EphemeralSigner()
+	require.NoError(t, err)
+	p, err := ParsePolicy(PolicyModern)
+	require.NoError(t, err)
+	server := New(":0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)), WithPolicy(p))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			nc, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer nc.Close()
+				if conn, _, reqs, err := ssh.NewServerConn(nc, server.Config); err == nil {
+					go ssh.DiscardRequests(reqs)
+					conn.Close()
+				}
+			}()
+		}
+	}()
+
+	handshake := func(ciphers ...string) error {
+		cfg := &ssh.ClientConfig{
+			User:            "alice",
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         2 * time.Second,
+		}
+		cfg.Ciphers = ciphers
+		client, err := ssh.Dial("tcp", listener.Addr().String(), cfg)
+		if err == nil {
+			client.Close()
+		}
+		return err
+	}
+
+	require.NoError(t, handshake("aes128-gcm@openssh.com"))
+	require.ErrorContains(t, handshake("aes128-ctr"), "no common algorithm")
+}
@@ -0,0 +1,193 @@
+package sshserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxyHeaderTimeout bounds how long a load balancer may take to send the
+// PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV1MaxLen is the longest v1 header the specification allows.
+const proxyV1MaxLen = 107
+
+// proxyV2Signature starts every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// WithProxyProtocol reads a PROXY protocol v1 or v2 header, as sent by
+// HAProxy and cloud TCP load balancers, from connections whose address is in
+// one of the trusted prefixes, and uses the client address it names for
+// logging, connection limits, and bans. Those connections must send a header;
+// connections from other addresses are served as they are, so a header from
+// an untrusted client is never believed.
+func WithProxyProtocol(trusted ...netip.Prefix) Option {
+	return func(s *Server) {
+		s.proxies = trusted
+	}
+}
+
+// ParseProxySources parses addresses and CIDR ranges for WithProxyProtocol.
+func ParseProxySources(sources []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(sources))
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if strings.Contains(source, "/") {
+			prefix, err := netip.ParsePrefix(source)
+			if err != nil {
+				return nil, fmt.Errorf("sshserver: invalid proxy source %q", source)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(source)
+		if err != nil {
+			return nil, fmt.Errorf("sshserver: invalid proxy source %q", source)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trustedProxy reports whether conn comes from a load balancer that sends
+// PROXY protocol headers.
+func (s *Server) trustedProxy(conn net.Conn) bool {
+	addr := connAddr(conn.RemoteAddr())
+	if !addr.IsValid() {
+		return false
+	}
+	for _, prefix := range s.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxiedConn is a connection whose remote address came from a PROXY
+// protocol header. Reads go through the buffer the header was read with.
+type proxiedConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxiedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c *proxiedConn) RemoteAddr() net.Addr { return c.remote }
+
+// readProxyHeader reads the PROXY protocol header from conn. Headers that do
+// not name a TCP client, such as v2 LOCAL health checks and v1 UNKNOWN, keep
+// the address of the load balancer.
+func readProxyHeader(conn net.Conn) (net.Conn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout)); err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	// Every header is longer than the v2 signature.
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	var remote net.Addr
+	if bytes.Equal(sig, proxyV2Signature) {
+		remote, err = readProxyV2(r)
+	} else {
+		remote, err = readProxyV1(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	if remote == nil {
+		remote = conn.RemoteAddr()
+	}
+	return &proxiedConn{Conn: conn, r: r, remote: remote}, nil
+}
+
+// readProxyV1 reads a text header such as
+// "PROXY TCP4 203.0.113.7 10.0.0.1 51234 22\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("proxy protocol: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok || !strings.HasPrefix(text, "PROXY ") {
+		return nil, errors.New("proxy protocol: missing header")
+	}
+	fields := strings.Fields(text)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("proxy protocol: malformed v1 header %q", text)
+	}
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil || addr.Is4() != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("proxy protocol: invalid source address %q", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxy protocol: invalid source port %q", fields[4])
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr.Unmap(), uint16(port))), nil
+}
+
+// readProxyV2 reads a binary header.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("proxy protocol: unsupported version %d", hdr[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("proxy protocol: %w", err)
+	}
+	switch cmd := hdr[12] & 0x0f; cmd {
+	case 0x0: // LOCAL: the load balancer's own connection, e.g. a health check.
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("proxy protocol: unsupported command %d", cmd)
+	}
+
+	var size int
+	switch hdr[13] {
+	case 0x11: // TCP over IPv4
+		size = 4
+	case 0x21: // TCP over IPv6
+		size = 16
+	default:
+		// UDP and Unix sockets carry no TCP client address to use.
+		return nil, nil
+	}
+	if len(body) < 2*size+4 {
+		return nil, errors.New("proxy protocol: truncated v2 addresses")
+	}
+	addr, _ := netip.AddrFromSlice(body[:size])
+	port := binary.BigEndian.Uint16(body[2*size:])
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr.Unmap(), port)), nil
+}
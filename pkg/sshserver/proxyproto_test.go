@@ -0,0 +1,150 @@
+package sshserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// lbConn is a pipe end that appears to come from a load balancer.
+type lbConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c lbConn) RemoteAddr() net.Addr { return c.addr }
+
+func proxyV2Header(cmd, family byte, addrs []byte) []byte {
+	hdr := append([]byte{}, proxyV2Signature...)
+	hdr = append(hdr, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(hdr[14:], uint16(len(addrs)))
+	return append(hdr, addrs...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	lb := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 40000}
+	v4 := append(append(netip.MustParseAddr("203.0.113.7").AsSlice(), netip.MustParseAddr("10.0.0.1").AsSlice()...), 0xc8, 0x22, 0, 22)
+	v6 := append(append(netip.MustParseAddr("2001:db8::7").AsSlice(), netip.MustParseAddr("2001:db8::1").AsSlice()...), 0xc8, 0x22, 0, 22)
+
+	cases := []struct {
+		name    string
+		header  []byte
+		want    string
+		wantErr string
+	}{
+		{name: "v1 tcp4", header: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 22\r\n"), want: "203.0.113.7:51234"},
+		{name: "v1 tcp6", header: []byte("PROXY TCP6 2001:db8::7 2001:db8::1 51234 22\r\n"), want: "[2001:db8::7]:51234"},
+		{name: "v1 unknown", header: []byte("PROXY UNKNOWN\r\n"), want: lb.String()},
+		{name: "v2 tcp4", header: proxyV2Header(1, 0x11, v4), want: "203.0.113.7:51234"},
+		{name: "v2 tcp6 with tlv", header: proxyV2Header(1, 0x21, append(v6, 0x04, 0, 1, 'x')), want: "[2001:db8::7]:51234"},
+		{name: "v2 local", header: proxyV2Header(0, 0, nil), want: lb.String()},
+		{name: "no header", header: []byte("SSH-2.0-OpenSSH_9.6\r\n"), wantErr: "missing header"},
+		{name: "v1 family mismatch", header: []byte("PROXY TCP4 2001:db8::7 10.0.0.1 1 22\r\n"), wantErr: "invalid source address"},
+		{name: "v1 bad port", header: []byte("PROXY TCP4 203.0.113.7 10.0.0.1 70000 22\r\n"), wantErr: "invalid source port"},
+		{name: "v2 truncated", header: proxyV2Header(1, 0x11, v4[:6]), wantErr: "truncated"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			go func() {
+				// The client's version line follows without waiting.
+				_, _ = client.Write(append(tc.header, "SSH-2.0-client\r\n"...))
+			}()
+
+			conn, err := readProxyHeader(lbConn{Conn: server, addr: lb})
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, conn.RemoteAddr().String())
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			require.NoError(t, err)
+			require.Equal(t, "SSH-2.0-client\r\n", line, "bytes after the header are kept")
+		})
+	}
+}
+
+func TestParseProxySources(t *testing.T) {
+	got, err := ParseProxySources([]string{"10.0.0.0/8", " 192.0.2.10 ", "2001:db8::/32"})
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.10/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}, got)
+
+	_, err = ParseProxySources([]string{"lb.example.com"})
+	require.ErrorContains(t, err, `invalid proxy source "lb.example.com"`)
+}
+
+func TestHandleConnUsesProxiedAddress(t *testing.T) {
+	signer, err := EphemeralSigner()
+	require.NoError(t, err)
+	server := New(":0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithProxyProtocol(netip.MustParsePrefix("10.0.0.0/8")), WithConnLimits(0, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := func(context.Context, *ssh.ServerConn, ssh.Channel, <-chan *ssh.Request) error { return nil }
+
+	connect := func(from string, header string) (net.Conn, <-chan struct{}) {
+		serverConn, clientConn := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			server.handleConn(ctx, lbConn{Conn: serverConn, addr: &net.TCPAddr{IP: net.ParseIP(from), Port: 40000}}, handler)
+			close(done)
+		}()
+		require.NoError(t, clientConn.SetDeadline(time.Now().Add(2*time.Second)))
+		if header != "" {
+			_, err := io.WriteString(clientConn, header)
+			require.NoError(t, err)
+		}
+		return clientConn, done
+	}
+	readLine := func(conn net.Conn) string {
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.NoError(t, err)
+		return line
+	}
+
+	// Two clients behind the same load balancer each get their own slot.
+	first, firstDone := connect("10.0.0.5", "PROXY TCP4 203.0.113.7 10.0.0.1 51234 22\r\n")
+	require.Contains(t, readLine(first), "SSH-2.0-")
+	second, secondDone := connect("10.0.0.5", "PROXY TCP4 203.0.113.8 10.0.0.1 51235 22\r\n")
+	require.Contains(t, readLine(second), "SSH-2.0-")
+
+	third, thirdDone := connect("10.0.0.6", "PROXY TCP4 203.0.113.7 10.0.0.1 51236 22\r\n")
+	require.Contains(t, readLine(third), "too many connections from 203.0.113.7")
+	<-thirdDone
+
+	// Connections from other addresses are served as they are, so a header
+	// from them is never read, and their own address counts.
+	direct, directDone := connect("198.51.100.1", "")
+	require.Contains(t, readLine(direct), "SSH-2.0-")
+	require.Equal(t, 1, server.limits.perIP["198.51.100.1"])
+	direct.Close()
+	<-directDone
+
+	// A trusted load balancer must send a header.
+	bare, bareDone := connect("10.0.0.5", "SSH-2.0-client\r\n")
+	<-bareDone
+	_, err = bare.Read(make([]byte, 1))
+	require.Error(t, err)
+
+	for _, c := range []net.Conn{first, second, third, bare} {
+		c.Close()
+	}
+	<-firstDone
+	<-secondDone
+	require.Zero(t, server.limits.total)
+}
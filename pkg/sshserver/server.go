@@ -2,41 +2,170 @@ package sshserver
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
-// SessionHandler handles an accepted SSH "session" channel.
-type SessionHandler func(conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request)
+// rejectWriteTimeout bounds how long a rejected client may stall the notice.
+const rejectWriteTimeout = time.Second
+
+// sessionShutdownTimeout bounds how long the sessions of a connection may take
+// to end once the server shuts down before the connection is closed on them.
+const sessionShutdownTimeout = 2 * time.Second
+
+// SessionID returns a short, log-friendly identifier for an SSH connection,
+// derived from the key exchange session identifier.
+func SessionID(conn ssh.ConnMetadata) string {
+	id := conn.SessionID()
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	return hex.EncodeToString(id)
+}
+
+// SessionHandler handles an accepted SSH "session" channel and returns how the
+// session ended: nil, a *SessionExit, or any other error for ExitError. The
+// server then logs and counts the exit, sends the matching exit status, and
+// closes the channel, so handlers should leave closing it to the server unless
+// they must abort blocked I/O. ctx is done once the connection closes or the
+// server shuts down; ContextExit says which, and handlers should return
+// promptly then.
+type SessionHandler func(ctx context.Context, conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) error
 
 // Server wraps the SSH listener lifecycle.
 type Server struct {
 	Addr   string
 	Config *ssh.ServerConfig
 
-	logger *log.Logger
+	logger *slog.Logger
+	auths  []Authenticator
+	banner atomic.Pointer[string]
+	hint   func(user string) string
+	banned BanFunc
+	// minRSABits is set by WithPolicy.
+	minRSABits int
+	failBan    *failBanner
+	proxies    []netip.Prefix
+	limits     *connLimiter
+	exits      exitCounter
+	drain      drainState
+
+	handshakeTimeout   time.Duration
+	interactiveTimeout time.Duration
+	handshakes         handshakes
 }
 
-// New creates a Server with the provided host signer.
-func New(addr string, signer ssh.Signer, logger *log.Logger) *Server {
-	cfg := &ssh.ServerConfig{
-		NoClientAuth: true,
+// Option customises server construction.
+type Option func(*Server)
+
+// WithAuthenticators replaces the default anonymous access with the given
+// authentication providers. Providers for different SSH auth methods combine.
+func WithAuthenticators(auths ...Authenticator) Option {
+	return func(s *Server) {
+		for _, auth := range auths {
+			if auth != nil {
+				s.auths = append(s.auths, auth)
+			}
+		}
 	}
-	cfg.AddHostKey(signer)
+}
+
+// WithBanner shows banner to clients before authentication. Most clients print
+// it verbatim, so lines should end in "\r\n".
+func WithBanner(banner string) Option {
+	return func(s *Server) {
+		s.SetBanner(banner)
+	}
+}
 
+// SetBanner replaces the pre-authentication banner; "" shows none. It is safe
+// to call while the server is running.
+func (s *Server) SetBanner(banner string) {
+	s.banner.Store(&banner)
+}
+
+// WithBannerHint appends per-user text, such as which node to connect to, to
+// the pre-authentication banner.
+func WithBannerHint(hint func(user string) string) Option {
+	return func(s *Server) {
+		s.hint = hint
+	}
+}
+
+// WithHostKeys serves additional host keys next to the primary one, such as
+// the old key during a rotation so clients that only know it keep working.
+// Keys must use different algorithms; see CheckHostKeys.
+func WithHostKeys(signers ...ssh.Signer) Option {
+	return func(s *Server) {
+		for _, signer := range signers {
+			s.Config.AddHostKey(signer)
+		}
+	}
+}
+
+// New creates a Server with the provided host signer.
+func New(addr string, signer ssh.Signer, logger *slog.Logger, opts ...Option) *Server {
 	if logger == nil {
-		logger = log.Default()
+		logger = slog.Default()
 	}
 
-	return &Server{
+	s := &Server{
 		Addr:   addr,
-		Config: cfg,
+		Config: &ssh.ServerConfig{},
 		logger: logger,
+		limits: newConnLimiter(0, 0),
+
+		handshakeTimeout:   defaultHandshakeTimeout,
+		interactiveTimeout: defaultInteractiveTimeout,
 	}
+	s.Config.AddHostKey(signer)
+	s.SetBanner("")
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+
+	if len(s.auths) == 0 {
+		s.auths = []Authenticator{NoAuth()}
+	}
+	for _, auth := range s.auths {
+		auth.Apply(s.Config)
+	}
+	s.applyCanonicalUsernames(s.Config)
+	if s.banned != nil {
+		s.applyBans(s.Config)
+	}
+	if s.minRSABits > 0 {
+		s.applyMinRSABits(s.Config)
+	}
+	if s.failBan != nil {
+		s.applyFailBan(s.Config)
+	}
+	s.applyInteractiveTimeout(s.Config)
+	s.Config.BannerCallback = func(conn ssh.ConnMetadata) string {
+		banner := *s.banner.Load()
+		if s.hint != nil {
+			banner += s.hint(conn.User())
+		}
+		if s.banned != nil {
+			banner += s.banNotice(conn)
+		}
+		return banner
+	}
+
+	return s
 }
 
 // ListenAndServe starts the SSH server until the context is cancelled or an error occurs.
@@ -44,12 +173,35 @@ func (s *Server) ListenAndServe(ctx context.Context, handler SessionHandler) err
 	if handler == nil {
 		return errors.New("sshserver: session handler required")
 	}
+	listener, err := s.Listen()
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener, handler)
+}
 
+// Listen binds the server's address. Callers binding a privileged port can
+// drop their privileges before calling Serve.
+func (s *Server) Listen() (net.Listener, error) {
 	listener, err := net.Listen("tcp", s.Addr)
 	if err != nil {
-		return fmt.Errorf("sshserver: listen %q: %w", s.Addr, err)
+		return nil, fmt.Errorf("sshserver: listen %q: %w", s.Addr, err)
+	}
+	return listener, nil
+}
+
+// Serve accepts connections on listener until the context is cancelled, Drain
+// is called, or an error occurs, and closes it on return.
+func (s *Server) Serve(ctx context.Context, listener net.Listener, handler SessionHandler) error {
+	if handler == nil {
+		_ = listener.Close()
+		return errors.New("sshserver: session handler required")
 	}
 	defer listener.Close()
+	if !s.drain.addListener(listener) {
+		return ErrDraining
+	}
+	defer s.drain.removeListener(listener)
 
 	shutdown := make(chan struct{})
 	defer close(shutdown)
@@ -58,13 +210,13 @@ func (s *Server) ListenAndServe(ctx context.Context, handler SessionHandler) err
 		select {
 		case <-ctx.Done():
 			if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
-				s.logger.Printf("sshserver: listener close error: %v", err)
+				s.logger.Error("sshserver: listener close failed", "err", err)
 			}
 		case <-shutdown:
 		}
 	}()
 
-	s.logger.Printf("sshserver: listening on %s", listener.Addr())
+	s.logger.Info("sshserver: listening", "addr", listener.Addr().String())
 
 	for {
 		conn, err := listener.Accept()
@@ -74,31 +226,89 @@ func (s *Server) ListenAndServe(ctx context.Context, handler SessionHandler) err
 				return ctx.Err()
 			default:
 			}
-			s.logger.Printf("sshserver: accept error: %v", err)
+			if errors.Is(err, net.ErrClosed) && s.drain.isDraining() {
+				return ErrDraining
+			}
+			s.logger.Warn("sshserver: accept failed", "err", err)
 			continue
 		}
 
-		go s.handleConn(ctx, conn, handler)
+		s.drain.opened()
+		go func() {
+			defer s.drain.closed()
+			s.handleConn(ctx, conn, handler)
+		}()
 	}
 }
 
 func (s *Server) handleConn(ctx context.Context, tcpConn net.Conn, handler SessionHandler) {
 	defer tcpConn.Close()
 
-	sshConn, chans, reqs, err := ssh.NewServerConn(tcpConn, s.Config)
+	if len(s.proxies) > 0 && s.trustedProxy(tcpConn) {
+		proxied, err := readProxyHeader(tcpConn)
+		if err != nil {
+			s.logger.Warn("sshserver: proxy protocol header rejected", "remote_addr", tcpConn.RemoteAddr().String(), "err", err)
+			return
+		}
+		tcpConn = proxied
+	}
+
+	ip := remoteIP(tcpConn.RemoteAddr())
+	if s.failBan != nil {
+		if until, banned := s.failBan.banned(ip); banned {
+			// Scans keep coming while banned; logging each would flood the log.
+			s.logger.Debug("sshserver: connection from banned address refused", "remote_addr", tcpConn.RemoteAddr().String(), "until", until)
+			reject(tcpConn, "too many failed attempts from "+ip+", try again after "+until.UTC().Format(time.RFC3339))
+			return
+		}
+	}
+	if reason, ok := s.limits.acquire(ip); !ok {
+		s.logger.Warn("sshserver: connection rejected", "remote_addr", tcpConn.RemoteAddr().String(), "reason", reason)
+		reject(tcpConn, reason+", try again later")
+		return
+	}
+	defer s.limits.release(ip)
+
+	conn := &readCounter{Conn: tcpConn}
+	handshook := s.handshakes.start(conn, s.handshakeTimeout)
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.Config)
+	handshook()
 	if err != nil {
-		s.logger.Printf("sshserver: handshake failed: %v", err)
+		s.logger.Info("sshserver: handshake failed", "remote_addr", tcpConn.RemoteAddr().String(), "err", err)
+		if s.failBan != nil && conn.read {
+			s.recordFailure(ip, "handshake failed")
+		}
 		return
 	}
 	defer sshConn.Close()
 
-	s.logger.Printf("sshserver: new connection from %s (%s)", sshConn.RemoteAddr(), sshConn.ClientVersion())
+	logger := s.logger.With(
+		"remote_addr", sshConn.RemoteAddr().String(),
+		"username", sshConn.User(),
+		"session_id", SessionID(sshConn),
+	)
+	logger.Info("sshserver: connection established", "client_version", string(sshConn.ClientVersion()))
+	defer logger.Info("sshserver: connection closed")
 
 	go ssh.DiscardRequests(reqs)
 
+	connCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(errConnClosed)
+	var sessions sync.WaitGroup
 	for {
 		select {
 		case <-ctx.Done():
+			// The sessions see ctx end too; let them tell their users and
+			// send an exit status before the connection goes.
+			ended := make(chan struct{})
+			go func() {
+				sessions.Wait()
+				close(ended)
+			}()
+			select {
+			case <-ended:
+			case <-time.After(sessionShutdownTimeout):
+			}
 			return
 		case newChannel, ok := <-chans:
 			if !ok {
@@ -111,11 +321,39 @@ func (s *Server) handleConn(ctx context.Context, tcpConn net.Conn, handler Sessi
 
 			channel, requests, err := newChannel.Accept()
 			if err != nil {
-				s.logger.Printf("sshserver: channel accept failed: %v", err)
+				logger.Warn("sshserver: channel accept failed", "err", err)
 				continue
 			}
 
-			go handler(sshConn, channel, requests)
+			sessions.Add(1)
+			go func() {
+				defer sessions.Done()
+				s.serveSession(connCtx, logger, handler, sshConn, channel, requests)
+			}()
 		}
 	}
 }
+
+// reject tells a refused client why before the connection is closed. RFC 4253
+// lets the server send text lines before its version string; clients that
+// show them give the user a hint instead of a bare reset.
+func reject(conn net.Conn, reason string) {
+	_ = conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout))
+	_, _ = io.WriteString(conn, "schat: "+reason+"\r\n")
+}
+
+// serveSession runs handler on one channel and reports how the session ended.
+func (s *Server) serveSession(ctx context.Context, logger *slog.Logger, handler SessionHandler, conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) {
+	exit := CloseSession(channel, handler(ctx, conn, channel, requests))
+	s.exits.add(exit.Reason)
+
+	level := slog.LevelInfo
+	if exit.Reason == ExitError {
+		level = slog.LevelWarn
+	}
+	attrs := []any{"reason", exit.Reason, "exit_status", exit.Reason.Status()}
+	if exit.Err != nil {
+		attrs = append(attrs, "err", exit.Err)
+	}
+	logger.Log(context.Background(), level, "sshserver: session ended", attrs...)
+}
@@ -0,0 +1,221 @@
+package sshserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestWithBannerInstallsCallback(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	server := New(":0", signer, nil)
+	require.Empty(t, server.Config.BannerCallback(fakeConnMeta{user: "alice"}), "no banner is sent by default")
+
+	server = New(":0", signer, nil, WithBanner("Authorized use only\r\n"))
+	require.Equal(t, "Authorized use only\r\n", server.Config.BannerCallback(fakeConnMeta{user: "alice"}))
+
+	server.SetBanner("Maintenance tonight\r\n")
+	require.Equal(t, "Maintenance tonight\r\n", server.Config.BannerCallback(fakeConnMeta{user: "alice"}))
+
+	server = New(":0", signer, nil, WithBanner("Welcome\r\n"), WithBannerHint(func(user string) string {
+		return "hi " + user + "\r\n"
+	}))
+	require.Equal(t, "Welcome\r\nhi alice\r\n", server.Config.BannerCallback(fakeConnMeta{user: "alice"}))
+}
+
+func TestHandleConnEnforcesLimits(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	server := New(":0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)), WithConnLimits(0, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := func(context.Context, *ssh.ServerConn, ssh.Channel, <-chan *ssh.Request) error { return nil }
+
+	// The first connection holds its slot while stuck in the handshake.
+	firstServer, firstClient := net.Pipe()
+	firstDone := make(chan struct{})
+	go func() {
+		server.handleConn(ctx, firstServer, handler)
+		close(firstDone)
+	}()
+	require.NoError(t, firstClient.SetReadDeadline(time.Now().Add(2*time.Second)))
+	version, err := bufio.NewReader(firstClient).ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(version, "SSH-2.0-"))
+
+	secondServer, secondClient := net.Pipe()
+	secondDone := make(chan struct{})
+	go func() {
+		server.handleConn(ctx, secondServer, handler)
+		close(secondDone)
+	}()
+
+	require.NoError(t, secondClient.SetReadDeadline(time.Now().Add(2*time.Second)))
+	line, err := bufio.NewReader(secondClient).ReadString('\n')
+	require.NoError(t, err)
+	require.Contains(t, line, "too many connections")
+	<-secondDone
+
+	require.NoError(t, firstClient.Close())
+	<-firstDone
+	require.Zero(t, server.limits.total)
+	require.Empty(t, server.limits.perIP)
+}
+
+func TestConnLimiter(t *testing.T) {
+	unlimited := newConnLimiter(0, 0)
+	for i := 0; i < 5; i++ {
+		_, ok := unlimited.acquire("198.51.100.1")
+		require.True(t, ok, "zero limits admit everything")
+	}
+
+	l := newConnLimiter(3, 2)
+	for i := 0; i < 2; i++ {
+		_, ok := l.acquire("198.51.100.1")
+		require.True(t, ok)
+	}
+	reason, ok := l.acquire("198.51.100.1")
+	require.False(t, ok)
+	require.Contains(t, reason, "198.51.100.1")
+
+	_, ok = l.acquire("198.51.100.2")
+	require.True(t, ok)
+	reason, ok = l.acquire("198.51.100.3")
+	require.False(t, ok)
+	require.Equal(t, "server is full", reason)
+
+	l.release("198.51.100.1")
+	_, ok = l.acquire("198.51.100.3")
+	require.True(t, ok)
+
+	l.setLimits(5, 2)
+	_, ok = l.acquire("198.51.100.4")
+	require.True(t, ok, "raised limits apply to new connections")
+}
+
+func TestWithHostKeysServesEveryAlgorithm(t *testing.T) {
+	primary, err := EphemeralSigner()
+	require.NoError(t, err)
+	old, err := EphemeralSigner(WithKeyType(KeyECDSAP256))
+	require.NoError(t, err)
+	server := New(":0", primary, slog.New(slog.NewTextHandler(io.Discard, nil)), WithHostKeys(old))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			nc, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer nc.Close()
+				if conn, chans, reqs, err := ssh.NewServerConn(nc, server.Config); err == nil {
+					go ssh.DiscardRequests(reqs)
+					go func() {
+						for ch := range chans {
+							_ = ch.Reject(ssh.Prohibited, "test")
+						}
+					}()
+					_ = conn.Wait()
+				}
+			}()
+		}
+	}()
+
+	for _, want := range []ssh.Signer{primary, old} {
+		t.Run(want.PublicKey().Type(), func(t *testing.T) {
+			// A client that already knows one key asks for that algorithm.
+			var seen ssh.PublicKey
+			client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+				User:              "alice",
+				HostKeyAlgorithms: []string{want.PublicKey().Type()},
+				HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+					seen = key
+					return nil
+				},
+				Timeout: 2 * time.Second,
+			})
+			require.NoError(t, err)
+			defer client.Close()
+			require.Equal(t, want.PublicKey().Marshal(), seen.Marshal())
+		})
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	signer, err := EphemeralSigner()
+	require.NoError(t, err)
+	approve := 1500 * time.Millisecond
+	server := New(":0", signer, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithHandshakeTimeout(500*time.Millisecond, 5*time.Second),
+		WithAuthenticators(AuthenticatorFunc(func(cfg *ssh.ServerConfig) {
+			cfg.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, _ ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+				// Stand in for a user approving a device flow sign-in.
+				time.Sleep(approve)
+				return nil, nil
+			}
+		})))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := func(context.Context, *ssh.ServerConn, ssh.Channel, <-chan *ssh.Request) error { return nil }
+
+	t.Run("stalled", func(t *testing.T) {
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		done := make(chan struct{})
+		go func() {
+			server.handleConn(ctx, serverConn, handler)
+			close(done)
+		}()
+		require.NoError(t, clientConn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		_, err := bufio.NewReader(clientConn).ReadString('\n')
+		require.NoError(t, err)
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			t.Fatal("a client that stalls the handshake keeps its connection")
+		}
+	})
+
+	t.Run("interactive", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				server.handleConn(ctx, conn, handler)
+			}
+		}()
+
+		client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+			User: "alice",
+			Auth: []ssh.AuthMethod{ssh.KeyboardInteractive(func(string, string, []string, []bool) ([]string, error) {
+				return nil, nil
+			})},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         10 * time.Second,
+		})
+		require.NoError(t, err, "keyboard-interactive sign-in outlasts the handshake timeout")
+		client.Close()
+	})
+}
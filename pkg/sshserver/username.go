@@ -0,0 +1,74 @@
+package sshserver
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/text/unicode/norm"
+)
+
+// CanonicalUsername returns name in NFC with control and invisible formatting
+// characters and surrounding space removed: the spelling accounts, admin keys,
+// bans, and the chat compare names in.
+func CanonicalUsername(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, name)
+	return strings.TrimSpace(norm.NFC.String(name))
+}
+
+// applyCanonicalUsernames refuses usernames not spelled canonically, so a
+// name with a zero-width space, surrounding space, or a decomposed accent
+// cannot pass the account, admin, and ban checks as a different name and
+// then join as the canonical one.
+func (s *Server) applyCanonicalUsernames(cfg *ssh.ServerConfig) {
+	refused := func(conn ssh.ConnMetadata) bool {
+		if CanonicalUsername(conn.User()) == conn.User() {
+			return false
+		}
+		s.logger.Warn("sshserver: non-canonical username refused", "remote_addr", conn.RemoteAddr().String(), "username", fmt.Sprintf("%q", conn.User()))
+		return true
+	}
+
+	if cfg.NoClientAuth {
+		next := cfg.NoClientAuthCallback
+		cfg.NoClientAuthCallback = func(conn ssh.ConnMetadata) (*ssh.Permissions, error) {
+			if refused(conn) {
+				return nil, errAuthFailed
+			}
+			if next == nil {
+				return nil, nil
+			}
+			return next(conn)
+		}
+	}
+	if next := cfg.PasswordCallback; next != nil {
+		cfg.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if refused(conn) {
+				return nil, errAuthFailed
+			}
+			return next(conn, password)
+		}
+	}
+	if next := cfg.KeyboardInteractiveCallback; next != nil {
+		cfg.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			if refused(conn) {
+				return nil, errAuthFailed
+			}
+			return next(conn, challenge)
+		}
+	}
+	if next := cfg.PublicKeyCallback; next != nil {
+		cfg.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if refused(conn) {
+				return nil, errAuthFailed
+			}
+			return next(conn, key)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package sshserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCanonicalUsername(t *testing.T) {
+	require.Equal(t, "alice", CanonicalUsername(" alice\u200b\n"))
+	require.Equal(t, "jos\u00e9", CanonicalUsername("jose\u0301"))
+	require.Equal(t, "bob", CanonicalUsername("bob"))
+}
+
+func TestServerRefusesNonCanonicalUsernames(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	accounts, err := OpenAccounts(filepath.Join(t.TempDir(), "accounts.json"))
+	require.NoError(t, err)
+	require.NoError(t, accounts.Register("alice", "correct horse", ""))
+
+	server := New(":0", signer, nil, WithAuthenticators(NoAuth(), accounts))
+	cfg := server.Config
+	for _, user := range []string{"alice\u200b", "alice ", " alice", "e\u0301ve"} {
+		_, err := cfg.NoClientAuthCallback(fakeConnMeta{user: user})
+		require.ErrorIs(t, err, errAuthFailed, "%q cannot dodge the account check", user)
+		_, err = cfg.PasswordCallback(fakeConnMeta{user: user}, []byte("correct horse"))
+		require.ErrorIs(t, err, errAuthFailed, "%q", user)
+	}
+
+	_, err = cfg.NoClientAuthCallback(fakeConnMeta{user: "alice"})
+	require.ErrorIs(t, err, errAuthFailed)
+	_, err = cfg.PasswordCallback(fakeConnMeta{user: "alice"}, []byte("correct horse"))
+	require.NoError(t, err)
+	_, err = cfg.NoClientAuthCallback(fakeConnMeta{user: "bob"})
+	require.NoError(t, err)
+}
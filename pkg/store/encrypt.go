@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// MinSecretLength is the shortest server secret NewEncrypted accepts.
+const MinSecretLength = 16
+
+// encryptedPrefix marks sealed fields, so rows written before encryption was
+// turned on are still read as plaintext.
+const encryptedPrefix = "enc1:"
+
+// searchBatch is how many records Encrypted.Search decrypts at a time.
+const searchBatch = 500
+
+// ErrDecrypt is returned when a stored message cannot be opened, usually
+// because the server secret changed.
+var ErrDecrypt = errors.New("store: cannot decrypt message (wrong secret?)")
+
+// Encrypted wraps a Store so message bodies and senders are sealed with
+// AES-256-GCM before they are written. Every room has its own key, derived
+// from the server secret with HKDF. Room and user settings are passed through
+// unchanged.
+//
+// Sealed bodies cannot be matched by the database, so Search reads the room's
+// records in batches and matches them after decrypting.
+type Encrypted struct {
+	Store
+	secret []byte
+
+	mu    sync.Mutex
+	rooms map[string]cipher.AEAD
+}
+
+// NewEncrypted encrypts the history kept in st with keys derived from secret.
+func NewEncrypted(st Store, secret []byte) (*Encrypted, error) {
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("store: encryption secret must be at least %d bytes", MinSecretLength)
+	}
+	return &Encrypted{Store: st, secret: append([]byte(nil), secret...), rooms: make(map[string]cipher.AEAD)}, nil
+}
+
+// aead returns the cipher for room, deriving its key on first use.
+func (e *Encrypted) aead(room string) (cipher.AEAD, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if a, ok := e.rooms[room]; ok {
+		return a, nil
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, e.secret, nil, []byte("schat history room "+room)), key); err != nil {
+		return nil, fmt.Errorf("store: derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("store: derive key: %w", err)
+	}
+	a, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("store: derive key: %w", err)
+	}
+	e.rooms[room] = a
+	return a, nil
+}
+
+// Seal encrypts text for room, field being "body" or "sender". The field name
+// is authenticated so a body cannot be passed off as a sender. Copies of the
+// history kept outside the store, such as room archives, use it too.
+func (e *Encrypted) Seal(room, field, text string) (string, error) {
+	a, err := e.aead(room)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, a.NonceSize(), a.NonceSize()+len(text)+a.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("store: encrypt: %w", err)
+	}
+	sealed := a.Seal(nonce, nonce, []byte(text), []byte(field))
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a field written by Seal; other values are returned as is.
+func (e *Encrypted) Open(room, field, text string) (string, error) {
+	encoded, ok := strings.CutPrefix(text, encryptedPrefix)
+	if !ok {
+		return text, nil
+	}
+	a, err := e.aead(room)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < a.NonceSize() {
+		return "", ErrDecrypt
+	}
+	plain, err := a.Open(nil, sealed[:a.NonceSize()], sealed[a.NonceSize():], []byte(field))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plain), nil
+}
+
+// Append seals rec's sender and body and stores it.
+func (e *Encrypted) Append(ctx context.Context, rec Record) error {
+	var err error
+	if rec.Body, err = e.Seal(rec.Room, "body", rec.Body); err != nil {
+		return err
+	}
+	if rec.Sender != "" {
+		if rec.Sender, err = e.Seal(rec.Room, "sender", rec.Sender); err != nil {
+			return err
+		}
+	}
+	return e.Store.Append(ctx, rec)
+}
+
+// Edit seals body and stores it in place of the record's.
+func (e *Encrypted) Edit(ctx context.Context, room string, id uint64, body string) error {
+	sealed, err := e.Seal(room, "body", body)
+	if err != nil {
+		return err
+	}
+	return e.Store.Edit(ctx, room, id, sealed)
+}
+
+// Search matches Text case-insensitively against the decrypted bodies.
+func (e *Encrypted) Search(ctx context.Context, q Query) ([]Record, error) {
+	text := strings.ToLower(q.Text)
+	var out []Record
+	skipped := 0
+	for offset := 0; ; offset += searchBatch {
+		batch, err := e.Store.Search(ctx, Query{Room: q.Room, Limit: searchBatch, Offset: offset})
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range batch {
+			if rec.Body, err = e.Open(rec.Room, "body", rec.Body); err != nil {
+				return nil, err
+			}
+			if !strings.Contains(strings.ToLower(rec.Body), text) {
+				continue
+			}
+			if skipped < q.Offset {
+				skipped++
+				continue
+			}
+			if rec.Sender, err = e.Open(rec.Room, "sender", rec.Sender); err != nil {
+				return nil, err
+			}
+			out = append(out, rec)
+			if q.Limit > 0 && len(out) == q.Limit {
+				return out, nil
+			}
+		}
+		if len(batch) < searchBatch {
+			return out, nil
+		}
+	}
+}
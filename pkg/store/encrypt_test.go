@@ -0,0 +1,97 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedSQLiteKeepsNoPlaintext(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "schat.db")
+	db, err := OpenSQLite(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Written before encryption was turned on.
+	require.NoError(t, db.Append(ctx, Record{Room: "lobby", Timestamp: time.Unix(1, 0), Kind: "chat", Sender: "carol", Body: "old plaintext secret"}))
+
+	st, err := NewEncrypted(db, []byte("correct horse battery staple"))
+	require.NoError(t, err)
+	require.NoError(t, st.Append(ctx, Record{Room: "lobby", Timestamp: time.Unix(2, 0), Kind: "chat", Sender: "alice", Body: "the launch code is 1234"}))
+	require.NoError(t, st.Append(ctx, Record{Room: "dev", Timestamp: time.Unix(3, 0), Kind: "chat", Sender: "alice", Body: "the launch code is 1234"}))
+	require.NoError(t, st.Append(ctx, Record{Room: "lobby", Timestamp: time.Unix(4, 0), Kind: "system", Body: "bob joined the chat"}))
+
+	raw, err := db.Search(ctx, Query{Room: "lobby", Text: "launch"})
+	require.NoError(t, err)
+	require.Empty(t, raw, "the database cannot see the bodies")
+	raw, err = db.Search(ctx, Query{Room: "lobby"})
+	require.NoError(t, err)
+	require.Len(t, raw, 3)
+	require.True(t, strings.HasPrefix(raw[0].Body, encryptedPrefix))
+	require.Empty(t, raw[0].Sender, "system messages have no sender to seal")
+	require.True(t, strings.HasPrefix(raw[1].Sender, encryptedPrefix))
+
+	got, err := st.Search(ctx, Query{Room: "lobby", Text: "LAUNCH"})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, Record{Room: "lobby", Timestamp: time.Unix(2, 0), Kind: "chat", Sender: "alice", Body: "the launch code is 1234"}, got[0])
+
+	got, err = st.Search(ctx, Query{Room: "lobby", Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, "old plaintext secret", got[1].Body, "rows written in plaintext are still read")
+
+	dev, err := db.Search(ctx, Query{Room: "dev"})
+	require.NoError(t, err)
+	require.NotEqual(t, raw[1].Body, dev[0].Body, "rooms have their own keys")
+	dev[0].Room = "lobby"
+	require.NoError(t, db.Append(ctx, dev[0]))
+	_, err = st.Search(ctx, Query{Room: "lobby"})
+	require.ErrorIs(t, err, ErrDecrypt, "a message copied to another room does not open")
+
+	wrong, err := NewEncrypted(db, []byte("another secret of enough length"))
+	require.NoError(t, err)
+	_, err = wrong.Search(ctx, Query{Room: "dev"})
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	require.NoError(t, db.Close())
+	file, err := os.ReadFile(path)
+	require.NoError(t, err)
+	wal, _ := os.ReadFile(path + "-wal")
+	require.False(t, bytes.Contains(append(file, wal...), []byte("launch code")))
+}
+
+func TestEncryptedSearchPagesThroughBatches(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewEncrypted(NewMemory(), []byte("0123456789abcdef"))
+	require.NoError(t, err)
+	for i := 0; i < searchBatch*2+10; i++ {
+		body := "noise"
+		if i%100 == 0 {
+			body = "needle"
+		}
+		require.NoError(t, st.Append(ctx, Record{Room: "lobby", Timestamp: time.Unix(int64(i), 0), Kind: "chat", Sender: "alice", Body: body}))
+	}
+
+	got, err := st.Search(ctx, Query{Room: "lobby", Text: "needle"})
+	require.NoError(t, err)
+	require.Len(t, got, 11)
+	require.Equal(t, time.Unix(1000, 0), got[0].Timestamp)
+	require.Equal(t, time.Unix(0, 0), got[10].Timestamp)
+
+	got, err = st.Search(ctx, Query{Room: "lobby", Text: "needle", Limit: 3, Offset: 9})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+}
+
+func TestNewEncryptedRejectsShortSecrets(t *testing.T) {
+	_, err := NewEncrypted(NewMemory(), []byte("short"))
+	require.ErrorContains(t, err, "at least 16 bytes")
+}
@@ -0,0 +1,268 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // registers the "sqlite3" driver
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	room   TEXT    NOT NULL,
+	ts     INTEGER NOT NULL,
+	kind   TEXT    NOT NULL,
+	sender TEXT    NOT NULL DEFAULT '',
+	body   TEXT    NOT NULL,
+	msg_id INTEGER NOT NULL DEFAULT 0,
+	edited INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS messages_room_ts ON messages (room, ts);
+CREATE TABLE IF NOT EXISTS room_settings (
+	room  TEXT NOT NULL,
+	key   TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (room, key)
+);
+CREATE TABLE IF NOT EXISTS user_settings (
+	user  TEXT NOT NULL,
+	key   TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (user, key)
+);
+`
+
+// sqliteColumns are columns added to the messages table after its first
+// release, with their definitions, so older databases can be upgraded.
+var sqliteColumns = []struct{ name, definition string }{
+	{"msg_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"edited", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// SQLite is a Store backed by a SQLite database file.
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the database at path and applies the schema.
+func OpenSQLite(path string) (*SQLite, error) {
+	dsn := "file:" + path + "?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("store: open %q: %w", path, err)
+	}
+	// SQLite serialises writers anyway; one connection avoids busy errors.
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("store: migrate %q: %w", path, err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+// migrateSQLite applies the schema and adds the columns older databases lack.
+func migrateSQLite(db *sql.DB) error {
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('messages')`)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		have[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, col := range sqliteColumns {
+		if have[col.name] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE messages ADD COLUMN ` + col.name + ` ` + col.definition); err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS messages_room_msg_id ON messages (room, msg_id)`)
+	return err
+}
+
+// SnapshotSQLite writes a consistent copy of the database at src to dst, which
+// must not exist, while a server may still be writing to src.
+func SnapshotSQLite(ctx context.Context, src, dst string) error {
+	db, err := sql.Open("sqlite3", "file:"+src+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		return fmt.Errorf("store: open %q: %w", src, err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", dst); err != nil {
+		return fmt.Errorf("store: snapshot %q: %w", src, err)
+	}
+	return nil
+}
+
+// Append inserts rec.
+func (s *SQLite) Append(ctx context.Context, rec Record) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO messages (room, msg_id, ts, kind, sender, body, edited) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rec.Room, int64(rec.ID), rec.Timestamp.UnixNano(), rec.Kind, rec.Sender, rec.Body, rec.Edited)
+	if err != nil {
+		return fmt.Errorf("store: append: %w", err)
+	}
+	return nil
+}
+
+// Search matches Text case-insensitively (ASCII) against message bodies.
+func (s *SQLite) Search(ctx context.Context, q Query) ([]Record, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT room, msg_id, ts, kind, sender, body, edited FROM messages
+		 WHERE room = ? AND body LIKE ? ESCAPE '\'
+		 ORDER BY ts DESC, id DESC LIMIT ? OFFSET ?`,
+		q.Room, "%"+escapeLike(q.Text)+"%", limit, q.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("store: search: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Record
+	for rows.Next() {
+		var rec Record
+		var id, ts int64
+		if err := rows.Scan(&rec.Room, &id, &ts, &rec.Kind, &rec.Sender, &rec.Body, &rec.Edited); err != nil {
+			return nil, fmt.Errorf("store: search: %w", err)
+		}
+		rec.ID = uint64(id)
+		rec.Timestamp = time.Unix(0, ts)
+		out = append(out, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: search: %w", err)
+	}
+	return out, nil
+}
+
+// Edit replaces the body of the record with id.
+func (s *SQLite) Edit(ctx context.Context, room string, id uint64, body string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE messages SET body = ?, edited = 1 WHERE room = ? AND msg_id = ?`, body, room, int64(id))
+	if err != nil {
+		return fmt.Errorf("store: edit: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the record with id.
+func (s *SQLite) Delete(ctx context.Context, room string, id uint64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM messages WHERE room = ? AND msg_id = ?`, room, int64(id))
+	if err != nil {
+		return fmt.Errorf("store: delete: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes records older than before.
+func (s *SQLite) Prune(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM messages WHERE ts < ?`, before.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("store: prune: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("store: prune: %w", err)
+	}
+	return int(n), nil
+}
+
+// RoomSettings returns the settings saved for room.
+func (s *SQLite) RoomSettings(ctx context.Context, room string) (map[string]string, error) {
+	return s.settings(ctx, "room_settings", "room", room)
+}
+
+// SaveRoomSettings replaces the settings saved for room in one transaction.
+func (s *SQLite) SaveRoomSettings(ctx context.Context, room string, settings map[string]string) error {
+	return s.saveSettings(ctx, "room_settings", "room", room, settings)
+}
+
+// UserSettings returns the preferences saved for user.
+func (s *SQLite) UserSettings(ctx context.Context, user string) (map[string]string, error) {
+	return s.settings(ctx, "user_settings", "user", user)
+}
+
+// SaveUserSettings replaces the preferences saved for user in one transaction.
+func (s *SQLite) SaveUserSettings(ctx context.Context, user string, settings map[string]string) error {
+	return s.saveSettings(ctx, "user_settings", "user", user, settings)
+}
+
+// settings reads the key/value rows of table owned by owner. table and column
+// are constants, never user input.
+func (s *SQLite) settings(ctx context.Context, table, column, owner string) (map[string]string, error) {
+	what := strings.ReplaceAll(table, "_", " ")
+	rows, err := s.db.QueryContext(ctx, `SELECT key, value FROM `+table+` WHERE `+column+` = ?`, owner)
+	if err != nil {
+		return nil, fmt.Errorf("store: %s: %w", what, err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("store: %s: %w", what, err)
+		}
+		settings[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store: %s: %w", what, err)
+	}
+	return settings, nil
+}
+
+// saveSettings replaces the rows of table owned by owner.
+func (s *SQLite) saveSettings(ctx context.Context, table, column, owner string, settings map[string]string) error {
+	what := "save " + strings.ReplaceAll(table, "_", " ")
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("store: %s: %w", what, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+column+` = ?`, owner); err != nil {
+		return fmt.Errorf("store: %s: %w", what, err)
+	}
+	for key, value := range settings {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (`+column+`, key, value) VALUES (?, ?, ?)`, owner, key, value); err != nil {
+			return fmt.Errorf("store: %s: %w", what, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("store: %s: %w", what, err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,199 @@
+// Package store persists room events, room settings, and user preferences so
+// they survive restarts and can be searched later.
+package store
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is one persisted room event.
+type Record struct {
+	Room string
+	// ID is the room's ID of a chat or action message, zero for other kinds.
+	ID        uint64
+	Timestamp time.Time
+	// Kind is the chat message kind name, e.g. "chat" or "system".
+	Kind   string
+	Sender string
+	Body   string
+	// Edited is set once the sender changed the body.
+	Edited bool
+}
+
+// Query selects records from a room whose body contains Text, newest first.
+type Query struct {
+	Room   string
+	Text   string
+	Limit  int
+	Offset int
+}
+
+// Store is a message, room settings, and user preferences persistence backend.
+type Store interface {
+	Append(ctx context.Context, rec Record) error
+	Search(ctx context.Context, q Query) ([]Record, error)
+	// Edit replaces the body of the record with id in room and marks it
+	// edited. Unknown records are ignored.
+	Edit(ctx context.Context, room string, id uint64, body string) error
+	// Delete removes the record with id in room. Unknown records are
+	// ignored.
+	Delete(ctx context.Context, room string, id uint64) error
+	// Prune removes records older than before and returns how many it
+	// removed.
+	Prune(ctx context.Context, before time.Time) (int, error)
+	// RoomSettings returns the settings saved for room, empty if there are none.
+	RoomSettings(ctx context.Context, room string) (map[string]string, error)
+	// SaveRoomSettings replaces the settings saved for room; an empty map
+	// removes them.
+	SaveRoomSettings(ctx context.Context, room string, settings map[string]string) error
+	// UserSettings returns the preferences saved for user, empty if there are
+	// none.
+	UserSettings(ctx context.Context, user string) (map[string]string, error)
+	// SaveUserSettings replaces the preferences saved for user; an empty map
+	// removes them.
+	SaveUserSettings(ctx context.Context, user string, settings map[string]string) error
+	Close() error
+}
+
+// Memory is a Store that keeps records in process memory. It is meant for
+// tests and ephemeral deployments.
+type Memory struct {
+	mu       sync.RWMutex
+	records  []Record
+	settings map[string]map[string]string
+	users    map[string]map[string]string
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		settings: make(map[string]map[string]string),
+		users:    make(map[string]map[string]string),
+	}
+}
+
+// Append stores rec.
+func (m *Memory) Append(_ context.Context, rec Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, rec)
+	return nil
+}
+
+// Search matches Text case-insensitively.
+func (m *Memory) Search(_ context.Context, q Query) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	text := strings.ToLower(q.Text)
+	var out []Record
+	skipped := 0
+	for i := len(m.records) - 1; i >= 0; i-- {
+		rec := m.records[i]
+		if rec.Room != q.Room || !strings.Contains(strings.ToLower(rec.Body), text) {
+			continue
+		}
+		if skipped < q.Offset {
+			skipped++
+			continue
+		}
+		out = append(out, rec)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+// Edit replaces the body of the record with id.
+func (m *Memory) Edit(_ context.Context, room string, id uint64, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.records {
+		if rec := &m.records[i]; rec.Room == room && rec.ID == id {
+			rec.Body, rec.Edited = body, true
+		}
+	}
+	return nil
+}
+
+// Delete removes the record with id.
+func (m *Memory) Delete(_ context.Context, room string, id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = slices.DeleteFunc(m.records, func(rec Record) bool {
+		return rec.Room == room && rec.ID == id
+	})
+	return nil
+}
+
+// Prune removes records older than before.
+func (m *Memory) Prune(_ context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.records[:0]
+	for _, rec := range m.records {
+		if !rec.Timestamp.Before(before) {
+			kept = append(kept, rec)
+		}
+	}
+	removed := len(m.records) - len(kept)
+	clear(m.records[len(kept):])
+	m.records = kept
+	return removed, nil
+}
+
+// RoomSettings returns a copy of the settings saved for room.
+func (m *Memory) RoomSettings(_ context.Context, room string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return copySettings(m.settings[room]), nil
+}
+
+// SaveRoomSettings replaces the settings saved for room.
+func (m *Memory) SaveRoomSettings(_ context.Context, room string, settings map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(settings) == 0 {
+		delete(m.settings, room)
+		return nil
+	}
+	m.settings[room] = copySettings(settings)
+	return nil
+}
+
+// UserSettings returns a copy of the preferences saved for user.
+func (m *Memory) UserSettings(_ context.Context, user string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return copySettings(m.users[user]), nil
+}
+
+// SaveUserSettings replaces the preferences saved for user.
+func (m *Memory) SaveUserSettings(_ context.Context, user string, settings map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(settings) == 0 {
+		delete(m.users, user)
+		return nil
+	}
+	m.users[user] = copySettings(settings)
+	return nil
+}
+
+func copySettings(settings map[string]string) map[string]string {
+	out := make(map[string]string, len(settings))
+	for k, v := range settings {
+		out[k] = v
+	}
+	return out
+}
+
+// Close is a no-op.
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	backends := map[string]func(t *testing.T) Store{
+		"memory": func(*testing.T) Store { return NewMemory() },
+		"sqlite": func(t *testing.T) Store {
+			db, err := OpenSQLite(filepath.Join(t.TempDir(), "schat.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = db.Close() })
+			return db
+		},
+		"encrypted": func(t *testing.T) Store {
+			st, err := NewEncrypted(NewMemory(), []byte("0123456789abcdef"))
+			require.NoError(t, err)
+			return st
+		},
+	}
+
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, open(t))
+		})
+	}
+}
+
+func testStore(t *testing.T, st Store) {
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, st.Append(ctx, Record{
+			Room:      "lobby",
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+			Kind:      "chat",
+			Sender:    "alice",
+			Body:      fmt.Sprintf("Deploy %d done", i),
+		}))
+	}
+	require.NoError(t, st.Append(ctx, Record{Room: "dev", Timestamp: base, Kind: "chat", Sender: "bob", Body: "deploy elsewhere"}))
+	require.NoError(t, st.Append(ctx, Record{Room: "lobby", Timestamp: base, Kind: "chat", Sender: "bob", Body: "100% sure"}))
+
+	got, err := st.Search(ctx, Query{Room: "lobby", Text: "deploy", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, "Deploy 4 done", got[0].Body, "newest first, case-insensitive")
+	require.Equal(t, "Deploy 3 done", got[1].Body)
+	require.True(t, got[0].Timestamp.Equal(base.Add(4*time.Minute)))
+	require.Equal(t, "alice", got[0].Sender)
+
+	got, err = st.Search(ctx, Query{Room: "lobby", Text: "deploy", Limit: 10, Offset: 3})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, "Deploy 1 done", got[0].Body)
+
+	got, err = st.Search(ctx, Query{Room: "lobby", Text: "0%"})
+	require.NoError(t, err)
+	require.Len(t, got, 1, "LIKE wildcards in the query are literal")
+	require.Equal(t, "100% sure", got[0].Body)
+
+	got, err = st.Search(ctx, Query{Room: "lobby", Text: "elsewhere"})
+	require.NoError(t, err)
+	require.Empty(t, got, "search is scoped to the room")
+
+	removed, err := st.Prune(ctx, base.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 4, removed, "records before the cutoff in every room")
+	got, err = st.Search(ctx, Query{Room: "lobby", Text: ""})
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	require.Equal(t, "Deploy 2 done", got[2].Body, "the cutoff itself is kept")
+
+	require.NoError(t, st.Append(ctx, Record{Room: "ops", ID: 7, Timestamp: base.Add(time.Hour), Kind: "chat", Sender: "alice", Body: "restart at 4"}))
+	require.NoError(t, st.Append(ctx, Record{Room: "ops", ID: 8, Timestamp: base.Add(time.Hour), Kind: "chat", Sender: "alice", Body: "oops, wrong room"}))
+	require.NoError(t, st.Append(ctx, Record{Room: "dev", ID: 7, Timestamp: base.Add(time.Hour), Kind: "chat", Sender: "bob", Body: "same id, other room"}))
+	require.NoError(t, st.Edit(ctx, "ops", 7, "restart at 5"))
+	require.NoError(t, st.Delete(ctx, "ops", 8))
+	require.NoError(t, st.Edit(ctx, "ops", 99, "unknown records are ignored"))
+	got, err = st.Search(ctx, Query{Room: "ops"})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, uint64(7), got[0].ID)
+	require.Equal(t, "restart at 5", got[0].Body)
+	require.True(t, got[0].Edited)
+	got, err = st.Search(ctx, Query{Room: "dev", Text: "same id"})
+	require.NoError(t, err)
+	require.Len(t, got, 1, "edits and deletions are scoped to the room")
+	require.False(t, got[0].Edited)
+
+	settings, err := st.RoomSettings(ctx, "dev")
+	require.NoError(t, err)
+	require.Empty(t, settings)
+	require.NoError(t, st.SaveRoomSettings(ctx, "dev", map[string]string{"template.join": "hi {user}", "template.leave": ""}))
+	require.NoError(t, st.SaveRoomSettings(ctx, "lobby", map[string]string{"template.join": "welcome"}))
+	require.NoError(t, st.SaveRoomSettings(ctx, "dev", map[string]string{"template.join": "hello {user}"}))
+	settings, err = st.RoomSettings(ctx, "dev")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"template.join": "hello {user}"}, settings, "saving replaces every setting")
+	require.NoError(t, st.SaveRoomSettings(ctx, "dev", nil))
+	settings, err = st.RoomSettings(ctx, "dev")
+	require.NoError(t, err)
+	require.Empty(t, settings)
+	settings, err = st.RoomSettings(ctx, "lobby")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"template.join": "welcome"}, settings)
+
+	prefs, err := st.UserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Empty(t, prefs)
+	require.NoError(t, st.SaveUserSettings(ctx, "alice", map[string]string{"prompt": "❯ ", "status_bar": "bottom"}))
+	require.NoError(t, st.SaveRoomSettings(ctx, "alice", map[string]string{"template.join": "room"}))
+	prefs, err = st.UserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"prompt": "❯ ", "status_bar": "bottom"}, prefs, "user and room settings are kept apart")
+	require.NoError(t, st.SaveUserSettings(ctx, "alice", nil))
+	prefs, err = st.UserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Empty(t, prefs)
+}
+
+func TestSQLitePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schat.db")
+	db, err := OpenSQLite(path)
+	require.NoError(t, err)
+	require.NoError(t, db.Append(context.Background(), Record{Room: "lobby", Timestamp: time.Now(), Kind: "system", Body: "alice joined the chat"}))
+	require.NoError(t, db.Close())
+
+	db, err = OpenSQLite(path)
+	require.NoError(t, err)
+	defer db.Close()
+	got, err := db.Search(context.Background(), Query{Room: "lobby", Text: "joined"})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, "system", got[0].Kind)
+}
+
+func TestOpenSQLiteUpgradesOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schat.db")
+	db, err := sql.Open("sqlite3", "file:"+path)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, room TEXT NOT NULL, ts INTEGER NOT NULL,
+		kind TEXT NOT NULL, sender TEXT NOT NULL DEFAULT '', body TEXT NOT NULL);
+		INSERT INTO messages (room, ts, kind, sender, body) VALUES ('lobby', 1, 'chat', 'alice', 'from before');`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	st, err := OpenSQLite(path)
+	require.NoError(t, err)
+	defer st.Close()
+	ctx := context.Background()
+	require.NoError(t, st.Append(ctx, Record{Room: "lobby", ID: 3, Timestamp: time.Now(), Kind: "chat", Sender: "alice", Body: "after"}))
+	require.NoError(t, st.Edit(ctx, "lobby", 3, "after, edited"))
+	got, err := st.Search(ctx, Query{Room: "lobby"})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, "after, edited", got[0].Body)
+	require.Equal(t, "from before", got[1].Body)
+	require.Zero(t, got[1].ID)
+	require.False(t, got[1].Edited)
+}
+
+func TestSnapshotSQLite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := OpenSQLite(filepath.Join(dir, "schat.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Append(ctx, Record{Room: "dev", Timestamp: time.Now(), Kind: "chat", Sender: "alice", Body: "kept"}))
+	require.NoError(t, db.SaveUserSettings(ctx, "alice", map[string]string{"theme": "dark"}))
+
+	snapshot := filepath.Join(dir, "snapshot.db")
+	require.NoError(t, SnapshotSQLite(ctx, filepath.Join(dir, "schat.db"), snapshot))
+	require.Error(t, SnapshotSQLite(ctx, filepath.Join(dir, "schat.db"), snapshot), "an existing file is not overwritten")
+
+	copied, err := OpenSQLite(snapshot)
+	require.NoError(t, err)
+	defer copied.Close()
+	recs, err := copied.Search(ctx, Query{Room: "dev", Text: "kept"})
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	settings, err := copied.UserSettings(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"theme": "dark"}, settings)
+}
@@ -0,0 +1,473 @@
+// Package telnet serves the chat over plaintext TCP for labs and LANs where
+// SSH clients are not at hand. Connections are negotiated as telnet sessions
+// in character mode, with the server echoing and the client reporting its
+// window size (NAWS); in raw mode nothing is negotiated, for clients such as
+// nc. Either way the user picks a name before the connection is handed to a
+// Handler. Nothing is encrypted or authenticated.
+package telnet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ClientVersion is how telnet sessions are listed next to SSH client versions.
+const ClientVersion = "telnet"
+
+const (
+	// nameTimeout bounds how long a connection may take to pick a name.
+	nameTimeout = time.Minute
+	// maxNameLen bounds the name typed at the prompt, in bytes.
+	maxNameLen = 64
+	// namePrompt asks for the name the user joins under.
+	namePrompt = "name: "
+	// nameRefused starts the line explaining why a name was not accepted.
+	nameRefused = "that name is not available"
+)
+
+// Telnet commands and options (RFC 854, 857, 858, 1073).
+const (
+	cmdSE   = 240
+	cmdIP   = 244
+	cmdSB   = 250
+	cmdWill = 251
+	cmdWont = 252
+	cmdDo   = 253
+	cmdDont = 254
+	cmdIAC  = 255
+
+	optEcho = 1
+	optSGA  = 3
+	optNAWS = 31
+)
+
+// ErrNoName is returned for connections that leave without picking a name.
+var ErrNoName = errors.New("telnet: no name given")
+
+// Handler runs the session of a connection until it ends or ctx is done.
+type Handler func(ctx context.Context, conn *Conn) error
+
+// Server accepts telnet connections and hands them to a Handler.
+type Server struct {
+	ctx    context.Context
+	handle Handler
+	raw    bool
+	logger *slog.Logger
+	banner string
+	// checkName refuses names typed at the prompt; nil accepts any.
+	checkName func(name string) error
+}
+
+// Option customises a Server.
+type Option func(*Server)
+
+// WithRaw turns telnet negotiation off, for clients that send and show plain
+// bytes and echo what the user types themselves.
+func WithRaw(raw bool) Option {
+	return func(s *Server) {
+		s.raw = raw
+	}
+}
+
+// WithBanner sets text shown before the name prompt.
+func WithBanner(banner string) Option {
+	return func(s *Server) {
+		s.banner = banner
+	}
+}
+
+// WithNameCheck refuses names for which check returns an error, such as
+// names that need a password elsewhere; the error is shown and the prompt
+// asks again. Telnet cannot prove who anyone is, so any name it accepts is
+// open to everyone.
+func WithNameCheck(check func(name string) error) Option {
+	return func(s *Server) {
+		s.checkName = check
+	}
+}
+
+// WithLogger sets the destination for connection logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// New returns a server handing connections to handle. Their sessions end when
+// ctx is done, which outlives the listener so shutdown can tell users why.
+func New(ctx context.Context, handle Handler, opts ...Option) *Server {
+	s := &Server{ctx: ctx, handle: handle, logger: slog.Default()}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
+}
+
+// Serve accepts connections on ln until ctx is done or ln fails, and closes
+// ln on return. Sessions already running are left to end on their own.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	defer ln.Close()
+	stop := context.AfterFunc(ctx, func() { _ = ln.Close() })
+	defer stop()
+
+	s.logger.Info("telnet: listening", "addr", ln.Addr().String(), "raw", s.raw)
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			s.logger.Warn("telnet: accept failed", "err", err)
+			continue
+		}
+		go s.serveConn(nc)
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	defer nc.Close()
+	logger := s.logger.With("remote_addr", nc.RemoteAddr().String())
+
+	id, err := sessionID()
+	if err != nil {
+		logger.Warn("telnet: connection refused", "err", err)
+		return
+	}
+	c := newConn(nc, id, s.raw)
+	if err := c.negotiate(); err != nil {
+		logger.Debug("telnet: negotiation failed", "err", err)
+		return
+	}
+	if s.banner != "" {
+		if _, err := io.WriteString(c, crlf(s.banner)+"\r\n"); err != nil {
+			return
+		}
+	}
+	_ = nc.SetReadDeadline(time.Now().Add(nameTimeout))
+	name, err := c.readName(s.checkName)
+	if err != nil {
+		logger.Debug("telnet: no name given", "err", err)
+		return
+	}
+	_ = nc.SetReadDeadline(time.Time{})
+	c.name = name
+
+	logger = logger.With("username", name, "session_id", id)
+	logger.Info("telnet: connection established", "raw", s.raw)
+	err = s.handle(s.ctx, c)
+	logger.Info("telnet: connection closed", "err", err)
+}
+
+// Conn is a telnet connection. Reads return what the user typed with telnet
+// commands removed, and writes escape bytes telnet would take for commands.
+type Conn struct {
+	nc        net.Conn
+	r         *bufio.Reader
+	raw       bool
+	name      string
+	sessionID string
+
+	// wmu keeps negotiation replies from splitting writes.
+	wmu sync.Mutex
+	// lastCR is set after a carriage return, whose NUL telnet pads with is
+	// dropped; only touched by Read.
+	lastCR bool
+
+	mu       sync.Mutex
+	onResize func(cols, rows int)
+	cols     int
+	rows     int
+}
+
+func newConn(nc net.Conn, sessionID string, raw bool) *Conn {
+	return &Conn{nc: nc, r: bufio.NewReader(nc), raw: raw, sessionID: sessionID}
+}
+
+// Name returns the name the user picked.
+func (c *Conn) Name() string {
+	return c.name
+}
+
+// SessionID identifies the connection in logs, e.g. "telnet-1a2b3c4d5e6f7a8b".
+func (c *Conn) SessionID() string {
+	return c.sessionID
+}
+
+// RemoteAddr returns the client's address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.nc.RemoteAddr()
+}
+
+// OnResize calls fn with the window size the client reports, now if it has
+// already reported one and again on every change.
+func (c *Conn) OnResize(fn func(cols, rows int)) {
+	c.mu.Lock()
+	c.onResize = fn
+	cols, rows := c.cols, c.rows
+	c.mu.Unlock()
+	if cols > 0 && fn != nil {
+		fn(cols, rows)
+	}
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.nc.Close()
+}
+
+// Write sends p to the client, doubling the bytes telnet reads as commands.
+func (c *Conn) Write(p []byte) (int, error) {
+	if c.raw || bytes.IndexByte(p, cmdIAC) < 0 {
+		return c.write(p)
+	}
+	escaped := make([]byte, 0, len(p)+8)
+	for _, b := range p {
+		escaped = append(escaped, b)
+		if b == cmdIAC {
+			escaped = append(escaped, cmdIAC)
+		}
+	}
+	if _, err := c.write(escaped); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *Conn) write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.nc.Write(p)
+}
+
+// Read reads what the user typed. Telnet commands are answered or dropped,
+// window sizes are reported to OnResize, and an interrupt becomes Ctrl+C.
+func (c *Conn) Read(p []byte) (int, error) {
+	if c.raw {
+		return c.r.Read(p)
+	}
+	n := 0
+	for n < len(p) {
+		if n > 0 && c.r.Buffered() == 0 {
+			break
+		}
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if b == cmdIAC {
+			b, err = c.command()
+			if err != nil {
+				return n, err
+			}
+			if b == 0 {
+				continue
+			}
+		} else if b == 0 && c.lastCR {
+			c.lastCR = false
+			continue
+		}
+		c.lastCR = b == '\r'
+		p[n] = b
+		n++
+	}
+	return n, nil
+}
+
+// command handles the telnet command after an IAC and returns the data byte
+// it stands for, or 0 if none.
+func (c *Conn) command() (byte, error) {
+	cmd, err := c.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch cmd {
+	case cmdIAC:
+		return cmdIAC, nil
+	case cmdIP:
+		return 0x03, nil
+	case cmdWill, cmdWont, cmdDo, cmdDont:
+		opt, err := c.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		return 0, c.answer(cmd, opt)
+	case cmdSB:
+		return 0, c.subnegotiation()
+	}
+	// NOP, GA, AYT, and the like need no answer.
+	return 0, nil
+}
+
+// answer refuses options the server did not offer or ask for. Replies to
+// its own offers need no answer.
+func (c *Conn) answer(cmd, opt byte) error {
+	switch {
+	case cmd == cmdDo && opt != optEcho && opt != optSGA:
+		_, err := c.write([]byte{cmdIAC, cmdWont, opt})
+		return err
+	case cmd == cmdWill && opt != optSGA && opt != optNAWS:
+		_, err := c.write([]byte{cmdIAC, cmdDont, opt})
+		return err
+	}
+	return nil
+}
+
+// subnegotiation reads up to IAC SE and applies a window size report.
+func (c *Conn) subnegotiation() error {
+	var data []byte
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == cmdIAC {
+			if b, err = c.r.ReadByte(); err != nil {
+				return err
+			}
+			if b == cmdSE {
+				break
+			}
+		}
+		if len(data) < 16 {
+			data = append(data, b)
+		}
+	}
+	if len(data) != 5 || data[0] != optNAWS {
+		return nil
+	}
+	cols := int(data[1])<<8 | int(data[2])
+	rows := int(data[3])<<8 | int(data[4])
+	c.mu.Lock()
+	c.cols, c.rows = cols, rows
+	fn := c.onResize
+	c.mu.Unlock()
+	if fn != nil && cols > 0 {
+		fn(cols, rows)
+	}
+	return nil
+}
+
+// negotiate asks the client for character mode with the server echoing and
+// for its window size.
+func (c *Conn) negotiate() error {
+	if c.raw {
+		return nil
+	}
+	_, err := c.write([]byte{
+		cmdIAC, cmdWill, optEcho,
+		cmdIAC, cmdWill, optSGA,
+		cmdIAC, cmdDo, optSGA,
+		cmdIAC, cmdDo, optNAWS,
+	})
+	return err
+}
+
+// readName prompts for a name until one is given that check, if set,
+// accepts. In telnet mode the server echoes what is typed.
+func (c *Conn) readName(check func(string) error) (string, error) {
+	for {
+		if _, err := io.WriteString(c, namePrompt); err != nil {
+			return "", err
+		}
+		line, err := c.readLine()
+		if err != nil {
+			return "", err
+		}
+		name := strings.TrimSpace(line)
+		if name == "" {
+			continue
+		}
+		if check != nil {
+			if err := check(name); err != nil {
+				if _, err := io.WriteString(c, crlf(fmt.Sprintf("%s: %v", nameRefused, err))+"\r\n"); err != nil {
+					return "", err
+				}
+				continue
+			}
+		}
+		return name, nil
+	}
+}
+
+// readLine reads one line, handling erase keys and echoing unless raw.
+func (c *Conn) readLine() (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(c, buf); err != nil {
+			return "", err
+		}
+		switch b := buf[0]; {
+		case b == '\r' || b == '\n':
+			if c.raw && b == '\r' {
+				continue
+			}
+			if b == '\r' && c.r.Buffered() > 0 {
+				// Drop the line feed of a CR LF so the session does not see
+				// an empty line.
+				if next, err := c.r.Peek(1); err == nil && next[0] == '\n' {
+					_, _ = c.r.Discard(1)
+				}
+			}
+			c.echo("\r\n")
+			return string(line), nil
+		case b == 0x03 || b == 0x04:
+			c.echo("\r\n")
+			return "", ErrNoName
+		case b == '\b' || b == 0x7f:
+			if len(line) == 0 {
+				continue
+			}
+			_, size := utf8.DecodeLastRune(line)
+			line = line[:len(line)-size]
+			c.echo("\b \b")
+		case b >= 0x20 && len(line) < maxNameLen:
+			line = append(line, b)
+			if r, _ := utf8.DecodeLastRune(line); r != utf8.RuneError && unicode.IsPrint(r) {
+				c.echo(string(r))
+			}
+		}
+	}
+}
+
+func (c *Conn) echo(s string) {
+	if !c.raw {
+		_, _ = io.WriteString(c, s)
+	}
+}
+
+// crlf ends lines with CR LF, as terminals in character mode need.
+func crlf(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
+
+func sessionID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("telnet: session id: %w", err)
+	}
+	return "telnet-" + hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,156 @@
+package telnet
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startServer serves handle on a local port and returns its address.
+func startServer(t *testing.T, handle Handler, opts ...Option) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go New(ctx, handle, opts...).Serve(ctx, ln)
+	return ln.Addr().String()
+}
+
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { nc.Close() })
+	_ = nc.SetDeadline(time.Now().Add(5 * time.Second))
+	return nc, bufio.NewReader(nc)
+}
+
+func readN(t *testing.T, r io.Reader, n int) []byte {
+	t.Helper()
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	require.NoError(t, err)
+	return buf
+}
+
+func TestTelnetSession(t *testing.T) {
+	conns := make(chan *Conn, 1)
+	sizes := make(chan [2]int, 4)
+	lines := make(chan []byte, 4)
+	addr := startServer(t, func(ctx context.Context, c *Conn) error {
+		c.OnResize(func(cols, rows int) { sizes <- [2]int{cols, rows} })
+		conns <- c
+		buf := make([]byte, 64)
+		for {
+			n, err := c.Read(buf)
+			if err != nil {
+				return err
+			}
+			lines <- append([]byte(nil), buf[:n]...)
+		}
+	}, WithBanner("lab chat\nbe nice"))
+
+	nc, r := dial(t, addr)
+	require.Equal(t, []byte{
+		cmdIAC, cmdWill, optEcho,
+		cmdIAC, cmdWill, optSGA,
+		cmdIAC, cmdDo, optSGA,
+		cmdIAC, cmdDo, optNAWS,
+	}, readN(t, r, 12))
+	require.Equal(t, "lab chat\r\nbe nice\r\n"+namePrompt, string(readN(t, r, len("lab chat\r\nbe nice\r\n"+namePrompt))))
+
+	_, err := nc.Write([]byte{cmdIAC, cmdSB, optNAWS, 0, 100, 0, 40, cmdIAC, cmdSE})
+	require.NoError(t, err)
+	_, err = nc.Write([]byte{cmdIAC, cmdDo, 24})
+	require.NoError(t, err)
+	require.Equal(t, []byte{cmdIAC, cmdWont, 24}, readN(t, r, 3), "options the server did not offer are refused")
+
+	_, err = nc.Write([]byte("alx\x7fice\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, "alx\b \bice\r\n", string(readN(t, r, len("alx\b \bice\r\n"))), "the server echoes the name")
+
+	c := <-conns
+	require.Equal(t, "alice", c.Name())
+	require.True(t, strings.HasPrefix(c.SessionID(), "telnet-"))
+	require.Equal(t, [2]int{100, 40}, <-sizes, "a size reported before OnResize is passed on")
+
+	_, err = nc.Write([]byte{cmdIAC, cmdSB, optNAWS, 0, 120, 0, 50, cmdIAC, cmdSE})
+	require.NoError(t, err)
+	require.Equal(t, [2]int{120, 50}, <-sizes)
+
+	_, err = nc.Write([]byte{'x', '\r', 0, 'y', cmdIAC, cmdIAC, cmdIAC, cmdIP})
+	require.NoError(t, err)
+	var got []byte
+	for len(got) < 5 {
+		got = append(got, <-lines...)
+	}
+	require.Equal(t, []byte{'x', '\r', 'y', cmdIAC, 0x03}, got)
+
+	_, err = c.Write([]byte{'h', 'i', cmdIAC})
+	require.NoError(t, err)
+	require.Equal(t, []byte{'h', 'i', cmdIAC, cmdIAC}, readN(t, r, 4))
+}
+
+func TestRawSession(t *testing.T) {
+	names := make(chan string, 1)
+	addr := startServer(t, func(ctx context.Context, c *Conn) error {
+		names <- c.Name()
+		_, err := c.Write([]byte{'o', 'k', cmdIAC})
+		return err
+	}, WithRaw(true))
+
+	nc, r := dial(t, addr)
+	require.Equal(t, namePrompt, string(readN(t, r, len(namePrompt))), "raw connections are not negotiated")
+	_, err := nc.Write([]byte("\nbob\r\n"))
+	require.NoError(t, err)
+	require.Equal(t, namePrompt, string(readN(t, r, len(namePrompt))), "an empty name asks again")
+	require.Equal(t, "bob", <-names)
+	require.Equal(t, []byte{'o', 'k', cmdIAC}, readN(t, r, 3))
+}
+
+func TestNoName(t *testing.T) {
+	called := make(chan struct{}, 1)
+	addr := startServer(t, func(ctx context.Context, c *Conn) error {
+		called <- struct{}{}
+		return nil
+	}, WithRaw(true))
+
+	nc, r := dial(t, addr)
+	readN(t, r, len(namePrompt))
+	_, err := nc.Write([]byte("\x04"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.NoError(t, err, "the connection closes")
+	require.Empty(t, called)
+}
+
+func TestNameCheck(t *testing.T) {
+	names := make(chan string, 1)
+	addr := startServer(t, func(ctx context.Context, c *Conn) error {
+		names <- c.Name()
+		return nil
+	}, WithRaw(true), WithNameCheck(func(name string) error {
+		if name == "root" {
+			return errors.New("the name belongs to an operator")
+		}
+		return nil
+	}))
+
+	nc, r := dial(t, addr)
+	readN(t, r, len(namePrompt))
+	_, err := nc.Write([]byte("root\n"))
+	require.NoError(t, err)
+	refused := nameRefused + ": the name belongs to an operator\r\n" + namePrompt
+	require.Equal(t, refused, string(readN(t, r, len(refused))), "a refused name asks again")
+	_, err = nc.Write([]byte("bob\n"))
+	require.NoError(t, err)
+	require.Equal(t, "bob", <-names)
+}
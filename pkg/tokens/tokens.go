@@ -0,0 +1,246 @@
+// Package tokens issues and verifies scoped API tokens for bots and
+// integrations. Only a SHA-256 hash of each secret is stored; the plaintext is
+// shown once when the token is created.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope limits what a token may do.
+type Scope string
+
+// Supported scopes.
+const (
+	ScopeReadOnly  Scope = "read-only"
+	ScopeReadWrite Scope = "read-write"
+)
+
+// ParseScope validates a scope name.
+func ParseScope(name string) (Scope, error) {
+	switch scope := Scope(strings.ToLower(name)); scope {
+	case ScopeReadOnly, ScopeReadWrite:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("tokens: unknown scope %q (want %s or %s)", name, ScopeReadOnly, ScopeReadWrite)
+	}
+}
+
+// Allows reports whether a token with scope s may perform an action needing want.
+func (s Scope) Allows(want Scope) bool {
+	return s == ScopeReadWrite || s == want
+}
+
+const (
+	tokenPrefix = "schat"
+	idBytes     = 6
+	secretBytes = 32
+)
+
+var (
+	// ErrInvalid is returned for malformed, unknown, or revoked tokens.
+	ErrInvalid = errors.New("tokens: invalid token")
+	// ErrNotFound is returned when revoking a token the owner does not have.
+	ErrNotFound = errors.New("tokens: no such token")
+)
+
+// Token is the stored metadata of an issued token.
+type Token struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Scope     Scope     `json:"scope"`
+	Label     string    `json:"label,omitempty"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps tokens in memory and, when created with a path, persists them to
+// a JSON file after every change.
+type Store struct {
+	path  string
+	clock func() time.Time
+
+	mu     sync.RWMutex
+	tokens map[string]Token
+}
+
+// NewStore returns an empty in-memory store.
+func NewStore() *Store {
+	return &Store{clock: time.Now, tokens: make(map[string]Token)}
+}
+
+// Open loads the token file at path, starting empty when it does not exist.
+func Open(path string) (*Store, error) {
+	s := NewStore()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tokens: read %q: %w", path, err)
+	}
+
+	var list []Token
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("tokens: parse %q: %w", path, err)
+	}
+	for _, tok := range list {
+		s.tokens[tok.ID] = tok
+	}
+	return s, nil
+}
+
+// Create issues a token for owner and returns its metadata and the plaintext
+// secret, which cannot be recovered later.
+func (s *Store) Create(owner string, scope Scope, label string) (Token, string, error) {
+	if owner == "" {
+		return Token{}, "", errors.New("tokens: owner required")
+	}
+	if _, err := ParseScope(string(scope)); err != nil {
+		return Token{}, "", err
+	}
+
+	id, err := randomString(idBytes, hex.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret, err := randomString(secretBytes, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	tok := Token{
+		ID:        id,
+		Owner:     owner,
+		Scope:     scope,
+		Label:     label,
+		Hash:      hashSecret(secret),
+		CreatedAt: s.clock().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[id] = tok
+	if err := s.saveLocked(); err != nil {
+		delete(s.tokens, id)
+		return Token{}, "", err
+	}
+	return tok, tokenPrefix + "_" + id + "_" + secret, nil
+}
+
+// List returns owner's tokens, oldest first.
+func (s *Store) List(owner string) []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []Token
+	for _, tok := range s.tokens {
+		if tok.Owner == owner {
+			list = append(list, tok)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Revoke deletes owner's token with the given ID.
+func (s *Store) Revoke(owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tok, ok := s.tokens[id]
+	if !ok || tok.Owner != owner {
+		return ErrNotFound
+	}
+	delete(s.tokens, id)
+	if err := s.saveLocked(); err != nil {
+		s.tokens[id] = tok
+		return err
+	}
+	return nil
+}
+
+// Verify checks a plaintext token and returns its metadata.
+func (s *Store) Verify(raw string) (Token, error) {
+	prefix, rest, ok := strings.Cut(raw, "_")
+	if !ok || prefix != tokenPrefix {
+		return Token{}, ErrInvalid
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok {
+		return Token{}, ErrInvalid
+	}
+
+	s.mu.RLock()
+	tok, found := s.tokens[id]
+	s.mu.RUnlock()
+
+	if !found || subtle.ConstantTimeCompare([]byte(tok.Hash), []byte(hashSecret(secret))) != 1 {
+		return Token{}, ErrInvalid
+	}
+	return tok, nil
+}
+
+// saveLocked writes the store to disk atomically. It is a no-op for in-memory stores.
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	list := make([]Token, 0, len(s.tokens))
+	for _, tok := range s.tokens {
+		list = append(list, tok)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("tokens: encode: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tokens-*")
+	if err != nil {
+		return fmt.Errorf("tokens: save %q: %w", s.path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("tokens: save %q: %w", s.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("tokens: save %q: %w", s.path, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("tokens: save %q: %w", s.path, err)
+	}
+	return nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("tokens: generate: %w", err)
+	}
+	return encode(buf), nil
+}
@@ -0,0 +1,88 @@
+package tokens
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateVerifyRevoke(t *testing.T) {
+	store := NewStore()
+
+	tok, secret, err := store.Create("alice", ScopeReadOnly, "ci bot")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(secret, "schat_"+tok.ID+"_"))
+	require.NotContains(t, tok.Hash, strings.TrimPrefix(secret, "schat_"+tok.ID+"_"))
+
+	got, err := store.Verify(secret)
+	require.NoError(t, err)
+	require.Equal(t, "alice", got.Owner)
+	require.Equal(t, ScopeReadOnly, got.Scope)
+
+	for _, bad := range []string{"", "schat_" + tok.ID, "schat_" + tok.ID + "_wrong", "other_" + tok.ID + "_x", secret + "x"} {
+		_, err := store.Verify(bad)
+		require.ErrorIs(t, err, ErrInvalid, bad)
+	}
+
+	require.ErrorIs(t, store.Revoke("bob", tok.ID), ErrNotFound, "only the owner may revoke")
+	require.NoError(t, store.Revoke("alice", tok.ID))
+	_, err = store.Verify(secret)
+	require.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestListIsPerOwner(t *testing.T) {
+	store := NewStore()
+	_, _, err := store.Create("alice", ScopeReadOnly, "")
+	require.NoError(t, err)
+	_, _, err = store.Create("alice", ScopeReadWrite, "")
+	require.NoError(t, err)
+	_, _, err = store.Create("bob", ScopeReadOnly, "")
+	require.NoError(t, err)
+
+	require.Len(t, store.List("alice"), 2)
+	require.Len(t, store.List("bob"), 1)
+	require.Empty(t, store.List("carol"))
+
+	_, _, err = store.Create("", ScopeReadOnly, "")
+	require.Error(t, err)
+	_, _, err = store.Create("alice", Scope("admin"), "")
+	require.Error(t, err)
+}
+
+func TestStorePersistsHashesOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	store, err := Open(path)
+	require.NoError(t, err)
+	tok, secret, err := store.Create("alice", ScopeReadWrite, "deploy")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), secret[len("schat_"+tok.ID+"_"):])
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	got, err := reopened.Verify(secret)
+	require.NoError(t, err)
+	require.Equal(t, "deploy", got.Label)
+}
+
+func TestScope(t *testing.T) {
+	scope, err := ParseScope("Read-Only")
+	require.NoError(t, err)
+	require.Equal(t, ScopeReadOnly, scope)
+	_, err = ParseScope("admin")
+	require.Error(t, err)
+
+	require.True(t, ScopeReadOnly.Allows(ScopeReadOnly))
+	require.False(t, ScopeReadOnly.Allows(ScopeReadWrite))
+	require.True(t, ScopeReadWrite.Allows(ScopeReadOnly))
+}
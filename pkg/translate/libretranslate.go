@@ -0,0 +1,76 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// libreTranslateTimeout bounds a single request to the translation server.
+const libreTranslateTimeout = 10 * time.Second
+
+// maxResponseBytes bounds the response read from the translation server.
+const maxResponseBytes = 1 << 20
+
+// LibreTranslate is a Provider backed by a LibreTranslate server's
+// POST /translate endpoint.
+type LibreTranslate struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewLibreTranslate returns a provider for the server at baseURL, such as
+// "https://libretranslate.example.com". apiKey may be empty.
+func NewLibreTranslate(baseURL, apiKey string) *LibreTranslate {
+	return &LibreTranslate{
+		url:    strings.TrimRight(baseURL, "/") + "/translate",
+		apiKey: apiKey,
+		client: &http.Client{Timeout: libreTranslateTimeout},
+	}
+}
+
+// Translate implements Provider.
+func (p *LibreTranslate) Translate(ctx context.Context, text, target string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  "auto",
+		"target":  target,
+		"format":  "text",
+		"api_key": p.apiKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("translate: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("translate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		TranslatedText string `json:"translatedText"`
+		Error          string `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&out); err != nil {
+		return "", fmt.Errorf("translate: decode response (%s): %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if out.Error == "" {
+			out.Error = resp.Status
+		}
+		return "", fmt.Errorf("translate: %s", out.Error)
+	}
+	return out.TranslatedText, nil
+}
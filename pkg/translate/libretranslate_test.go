@@ -0,0 +1,51 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibreTranslate(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/translate", r.URL.Path)
+		require.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		_, _ = w.Write([]byte(`{"translatedText":"hola"}`))
+	}))
+	defer srv.Close()
+
+	text, err := NewLibreTranslate(srv.URL+"/", "secret").Translate(context.Background(), "hello", "es")
+	require.NoError(t, err)
+	require.Equal(t, "hola", text)
+	require.Equal(t, map[string]string{
+		"q": "hello", "source": "auto", "target": "es", "format": "text", "api_key": "secret",
+	}, got)
+}
+
+func TestLibreTranslateError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"xx is not supported"}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewLibreTranslate(srv.URL, "").Translate(context.Background(), "hello", "xx")
+	require.EqualError(t, err, "translate: xx is not supported")
+}
+
+func TestLibreTranslateLimitsTheResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"translatedText":"` + strings.Repeat("a", 2*maxResponseBytes) + `"}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewLibreTranslate(srv.URL, "").Translate(context.Background(), "hello", "es")
+	require.ErrorContains(t, err, "translate: decode response")
+}
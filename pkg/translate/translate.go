@@ -0,0 +1,178 @@
+// Package translate wraps machine translation providers with the caching and
+// rate limiting every caller needs.
+package translate
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a translation would exceed the rate limit.
+var ErrRateLimited = errors.New("translate: rate limit reached")
+
+// Provider translates text into a target language, detecting the source.
+type Provider interface {
+	Translate(ctx context.Context, text, target string) (string, error)
+}
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z]{2,4})?$`)
+
+// ParseLanguage validates a language code such as "es" or "pt-BR".
+func ParseLanguage(code string) (string, error) {
+	if !languagePattern.MatchString(code) {
+		return "", fmt.Errorf("translate: invalid language code %q (want e.g. es, de, pt-BR)", code)
+	}
+	return code, nil
+}
+
+// Translator adds an LRU cache and a request rate limit in front of a
+// Provider. Cache hits do not count against the limit.
+type Translator struct {
+	provider Provider
+
+	mu      sync.Mutex
+	size    int
+	entries map[cacheKey]*list.Element
+	order   *list.List
+	limiter *limiter
+}
+
+type cacheKey struct {
+	target string
+	text   string
+}
+
+type cacheEntry struct {
+	key         cacheKey
+	translation string
+}
+
+// Option customises a Translator.
+type Option func(*Translator)
+
+// WithCacheSize sets how many translations are kept; 0 disables caching.
+func WithCacheSize(n int) Option {
+	return func(t *Translator) {
+		if n >= 0 {
+			t.size = n
+		}
+	}
+}
+
+// WithRateLimit allows at most n provider requests per interval, with bursts
+// up to n.
+func WithRateLimit(n int, per time.Duration) Option {
+	return func(t *Translator) {
+		if n > 0 && per > 0 {
+			t.limiter = newLimiter(n, per, time.Now)
+		}
+	}
+}
+
+// New wraps provider. By default 1000 translations are cached and requests are
+// limited to 60 per minute.
+func New(provider Provider, opts ...Option) *Translator {
+	t := &Translator{
+		provider: provider,
+		size:     1000,
+		entries:  make(map[cacheKey]*list.Element),
+		order:    list.New(),
+		limiter:  newLimiter(60, time.Minute, time.Now),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(t)
+		}
+	}
+	return t
+}
+
+// Translate returns text translated into target.
+func (t *Translator) Translate(ctx context.Context, text, target string) (string, error) {
+	key := cacheKey{target: target, text: text}
+	if cached, ok := t.lookup(key); ok {
+		return cached, nil
+	}
+	if !t.limiter.allow() {
+		return "", ErrRateLimited
+	}
+
+	translation, err := t.provider.Translate(ctx, text, target)
+	if err != nil {
+		return "", err
+	}
+	t.store(key, translation)
+	return translation, nil
+}
+
+func (t *Translator) lookup(key cacheKey) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elem, ok := t.entries[key]
+	if !ok {
+		return "", false
+	}
+	t.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).translation, true
+}
+
+func (t *Translator) store(key cacheKey, translation string) {
+	if t.size == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, ok := t.entries[key]; ok {
+		elem.Value.(*cacheEntry).translation = translation
+		t.order.MoveToFront(elem)
+		return
+	}
+	t.entries[key] = t.order.PushFront(&cacheEntry{key: key, translation: translation})
+	for t.order.Len() > t.size {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		delete(t.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// limiter is a token bucket refilled continuously at n tokens per interval.
+type limiter struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	rate   float64 // tokens per nanosecond
+	last   time.Time
+	now    func() time.Time
+}
+
+func newLimiter(n int, per time.Duration, now func() time.Time) *limiter {
+	return &limiter{
+		tokens: float64(n),
+		max:    float64(n),
+		rate:   float64(n) / float64(per),
+		last:   now(),
+		now:    now,
+	}
+}
+
+func (l *limiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens += float64(now.Sub(l.last)) * l.rate
+	if l.tokens > l.max {
+		l.tokens = l.max
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
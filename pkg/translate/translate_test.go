@@ -0,0 +1,115 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+}
+
+func (p *fakeProvider) Translate(_ context.Context, text, target string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.err != nil {
+		return "", p.err
+	}
+	return target + ":" + text, nil
+}
+
+func TestTranslatorCaches(t *testing.T) {
+	p := &fakeProvider{}
+	tr := New(p)
+
+	for i := 0; i < 3; i++ {
+		got, err := tr.Translate(context.Background(), "hello", "es")
+		require.NoError(t, err)
+		require.Equal(t, "es:hello", got)
+	}
+	got, err := tr.Translate(context.Background(), "hello", "de")
+	require.NoError(t, err)
+	require.Equal(t, "de:hello", got)
+	require.Equal(t, 2, p.calls)
+}
+
+func TestTranslatorEvictsLeastRecentlyUsed(t *testing.T) {
+	p := &fakeProvider{}
+	tr := New(p, WithCacheSize(2))
+	ctx := context.Background()
+
+	for _, text := range []string{"a", "b", "a", "c", "a", "b"} {
+		_, err := tr.Translate(ctx, text, "es")
+		require.NoError(t, err)
+	}
+	// a, b, c miss; c evicts b; the final b misses again.
+	require.Equal(t, 4, p.calls)
+}
+
+func TestTranslatorDoesNotCacheErrors(t *testing.T) {
+	p := &fakeProvider{err: errors.New("boom")}
+	tr := New(p)
+
+	_, err := tr.Translate(context.Background(), "hello", "es")
+	require.EqualError(t, err, "boom")
+	p.err = nil
+	got, err := tr.Translate(context.Background(), "hello", "es")
+	require.NoError(t, err)
+	require.Equal(t, "es:hello", got)
+}
+
+func TestTranslatorRateLimit(t *testing.T) {
+	p := &fakeProvider{}
+	tr := New(p, WithRateLimit(2, time.Minute))
+	now := time.Unix(0, 0)
+	tr.limiter = newLimiter(2, time.Minute, func() time.Time { return now })
+	ctx := context.Background()
+
+	_, err := tr.Translate(ctx, "one", "es")
+	require.NoError(t, err)
+	_, err = tr.Translate(ctx, "two", "es")
+	require.NoError(t, err)
+	_, err = tr.Translate(ctx, "three", "es")
+	require.ErrorIs(t, err, ErrRateLimited)
+
+	_, err = tr.Translate(ctx, "one", "es")
+	require.NoError(t, err, "cache hits are not rate limited")
+
+	now = now.Add(30 * time.Second)
+	_, err = tr.Translate(ctx, "three", "es")
+	require.NoError(t, err)
+	require.Equal(t, 3, p.calls)
+}
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		code string
+		ok   bool
+	}{
+		{"es", true},
+		{"pt-BR", true},
+		{"zh-Hans", true},
+		{"", false},
+		{"ES", false},
+		{"english", false},
+		{"es/../x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			_, err := ParseLanguage(tt.code)
+			if tt.ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
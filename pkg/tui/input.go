@@ -0,0 +1,173 @@
+package tui
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// EventKind classifies what a terminal sent.
+type EventKind int
+
+const (
+	// EventRune is a character that belongs in the input line.
+	EventRune EventKind = iota
+	// EventEnter is the Enter key, sent as CR, LF, or CR LF.
+	EventEnter
+	// EventErase is Backspace or Delete.
+	EventErase
+	// EventControl is any other control character, such as Ctrl+C or Tab.
+	// Rune holds it, so it can be looked up as a Key.
+	EventControl
+	// EventEscape is an escape sequence, such as an arrow key or Alt plus a
+	// key, or a lone Esc. Seq holds its bytes.
+	EventEscape
+	// EventPasteStart and EventPasteEnd bracket pasted text, once
+	// Screen.EnablePaste has asked the terminal to mark it.
+	EventPasteStart
+	EventPasteEnd
+)
+
+// Bracketed paste markers.
+const (
+	seqPasteStart = "\x1b[200~"
+	seqPasteEnd   = "\x1b[201~"
+)
+
+// Event is one key press decoded by InputParser.
+type Event struct {
+	Kind EventKind
+	Rune rune
+	Seq  string
+}
+
+// maxEscapeLen bounds an escape sequence; longer ones are cut off and the
+// bytes after them read as ordinary input.
+const maxEscapeLen = 32
+
+const esc = 0x1b
+
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateCSI
+	stateSS3
+)
+
+// InputParser decodes the bytes a terminal sends into Events. It is a pure
+// state machine with no I/O: Feed takes input as it arrives, and the events
+// are the same however the input was split into chunks. UTF-8 is decoded as
+// bufio.Reader.ReadRune does, invalid bytes becoming utf8.RuneError.
+type InputParser struct {
+	state parserState
+	// pending holds an incomplete UTF-8 sequence or escape sequence.
+	pending []byte
+	// afterCR drops the LF of a CR LF pair, so it counts as one Enter.
+	afterCR bool
+}
+
+// Feed decodes data, appending the events it completes to events.
+func (p *InputParser) Feed(events []Event, data []byte) []Event {
+	for len(data) > 0 {
+		var n int
+		events, n = p.step(events, data)
+		data = data[n:]
+	}
+	return events
+}
+
+// step consumes up to all of data, returning how many bytes it used.
+func (p *InputParser) step(events []Event, data []byte) ([]Event, int) {
+	b := data[0]
+	switch p.state {
+	case stateEscape:
+		switch {
+		case b == '[':
+			p.pending, p.state = append(p.pending, b), stateCSI
+		case b == 'O':
+			p.pending, p.state = append(p.pending, b), stateSS3
+		case b >= 0x20 && b < 0x7f:
+			events = p.escape(events, append(p.pending, b))
+		default:
+			// Esc on its own, followed by some other key.
+			return p.escape(events, p.pending), 0
+		}
+		return events, 1
+	case stateCSI:
+		switch {
+		case len(p.pending) == maxEscapeLen:
+		case b >= 0x40 && b <= 0x7e:
+			return p.escape(events, append(p.pending, b)), 1
+		case b >= 0x20 && b <= 0x3f:
+			p.pending = append(p.pending, b)
+			return events, 1
+		}
+		return p.escape(events, p.pending), 0
+	case stateSS3:
+		if b >= 0x40 && b <= 0x7e {
+			return p.escape(events, append(p.pending, b)), 1
+		}
+		return p.escape(events, p.pending), 0
+	}
+
+	if len(p.pending) == 0 && b == esc {
+		p.afterCR = false
+		p.pending, p.state = append(p.pending, b), stateEscape
+		return events, 1
+	}
+	if len(p.pending) > 0 || !utf8.FullRune(data) {
+		// Gather the rest of a split UTF-8 sequence one byte at a time.
+		p.pending = append(p.pending, b)
+		if !utf8.FullRune(p.pending) {
+			return events, 1
+		}
+		r, size := utf8.DecodeRune(p.pending)
+		rest := append([]byte(nil), p.pending[size:]...)
+		p.pending = p.pending[:0]
+		// An invalid sequence uses only its first byte; the others are
+		// read again.
+		return p.Feed(p.rune(events, r), rest), 1
+	}
+	r, size := utf8.DecodeRune(data)
+	return p.rune(events, r), size
+}
+
+func (p *InputParser) escape(events []Event, seq []byte) []Event {
+	ev := Event{Kind: EventEscape, Rune: esc, Seq: string(seq)}
+	switch ev.Seq {
+	case seqPasteStart:
+		ev.Kind = EventPasteStart
+	case seqPasteEnd:
+		ev.Kind = EventPasteEnd
+	}
+	events = append(events, ev)
+	p.pending, p.state = p.pending[:0], stateGround
+	return events
+}
+
+func (p *InputParser) rune(events []Event, r rune) []Event {
+	afterCR := p.afterCR
+	p.afterCR = r == '\r'
+	if r == '\n' && afterCR {
+		return events
+	}
+	return append(events, KeyEvent(r))
+}
+
+// KeyEvent classifies a single rune the way InputParser does.
+func KeyEvent(r rune) Event {
+	switch {
+	case r == '\r' || r == '\n':
+		return Event{Kind: EventEnter, Rune: r}
+	case r == '\b' || r == 0x7f:
+		return Event{Kind: EventErase, Rune: r}
+	case unicode.IsPrint(r) || r == ZeroWidthJoiner:
+		// Zero-width joiners are accepted alongside printable runes so
+		// composed emoji sequences survive intact.
+		return Event{Kind: EventRune, Rune: r}
+	case r == esc:
+		return Event{Kind: EventEscape, Rune: r, Seq: string(r)}
+	}
+	return Event{Kind: EventControl, Rune: r}
+}
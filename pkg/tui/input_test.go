@@ -0,0 +1,109 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputParser(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []Event
+	}{
+		{name: "text", input: "hi 한", want: []Event{
+			{Kind: EventRune, Rune: 'h'}, {Kind: EventRune, Rune: 'i'}, {Kind: EventRune, Rune: ' '}, {Kind: EventRune, Rune: '한'},
+		}},
+		{name: "cr lf is one enter", input: "\r\n\n\r", want: []Event{
+			{Kind: EventEnter, Rune: '\r'}, {Kind: EventEnter, Rune: '\n'}, {Kind: EventEnter, Rune: '\r'},
+		}},
+		{name: "erase", input: "\b\x7f", want: []Event{{Kind: EventErase, Rune: '\b'}, {Kind: EventErase, Rune: 0x7f}}},
+		{name: "controls", input: "\x03\t", want: []Event{{Kind: EventControl, Rune: 0x03}, {Kind: EventControl, Rune: '\t'}}},
+		{name: "arrow keys", input: "\x1b[A\x1bOB", want: []Event{
+			{Kind: EventEscape, Rune: esc, Seq: "\x1b[A"}, {Kind: EventEscape, Rune: esc, Seq: "\x1bOB"},
+		}},
+		{name: "csi with parameters", input: "\x1b[1;5C\x1b[3~x", want: []Event{
+			{Kind: EventEscape, Rune: esc, Seq: "\x1b[1;5C"}, {Kind: EventEscape, Rune: esc, Seq: "\x1b[3~"}, {Kind: EventRune, Rune: 'x'},
+		}},
+		{name: "bracketed paste", input: "\x1b[200~a\rb\x1b[201~", want: []Event{
+			{Kind: EventPasteStart, Rune: esc, Seq: "\x1b[200~"}, {Kind: EventRune, Rune: 'a'}, {Kind: EventEnter, Rune: '\r'},
+			{Kind: EventRune, Rune: 'b'}, {Kind: EventPasteEnd, Rune: esc, Seq: "\x1b[201~"},
+		}},
+		{name: "alt key", input: "\x1bb", want: []Event{{Kind: EventEscape, Rune: esc, Seq: "\x1bb"}}},
+		{name: "lone esc", input: "\x1b\r", want: []Event{{Kind: EventEscape, Rune: esc, Seq: "\x1b"}, {Kind: EventEnter, Rune: '\r'}}},
+		{name: "interrupted csi", input: "\x1b[1\x03", want: []Event{{Kind: EventEscape, Rune: esc, Seq: "\x1b[1"}, {Kind: EventControl, Rune: 0x03}}},
+		{name: "invalid utf-8", input: "\xe2a\xff", want: []Event{
+			{Kind: EventRune, Rune: utf8.RuneError}, {Kind: EventRune, Rune: 'a'}, {Kind: EventRune, Rune: utf8.RuneError},
+		}},
+		{name: "zero-width joiner", input: "👩‍💻", want: []Event{
+			{Kind: EventRune, Rune: '👩'}, {Kind: EventRune, Rune: ZeroWidthJoiner}, {Kind: EventRune, Rune: '💻'},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var p InputParser
+			require.Equal(t, tc.want, p.Feed(nil, []byte(tc.input)))
+
+			var bytewise InputParser
+			var got []Event
+			for i := range len(tc.input) {
+				got = bytewise.Feed(got, []byte{tc.input[i]})
+			}
+			require.Equal(t, tc.want, got, "fed one byte at a time")
+		})
+	}
+}
+
+func TestInputParserWaitsForSplitInput(t *testing.T) {
+	var p InputParser
+	require.Empty(t, p.Feed(nil, []byte("\x1b[1;")))
+	require.Equal(t, []Event{{Kind: EventEscape, Rune: esc, Seq: "\x1b[1;2D"}}, p.Feed(nil, []byte("2D")))
+	require.Empty(t, p.Feed(nil, []byte{0xed, 0x95}))
+	require.Equal(t, []Event{{Kind: EventRune, Rune: '한'}}, p.Feed(nil, []byte{0x9c}))
+}
+
+func TestInputParserBoundsEscapes(t *testing.T) {
+	var p InputParser
+	events := p.Feed(nil, []byte("\x1b["+strings.Repeat("1", 2*maxEscapeLen)+"m"))
+	require.Equal(t, EventEscape, events[0].Kind)
+	require.Len(t, events[0].Seq, maxEscapeLen)
+	require.Equal(t, EventRune, events[1].Kind, "the rest is read as input")
+}
+
+// FuzzInputParser checks the parser never panics, and decodes input the
+// same whether it arrives at once or split at any point.
+func FuzzInputParser(f *testing.F) {
+	for _, seed := range []string{"hello\r\n", "\x1b[A\x1bOP\x1b[1;5C", "\x1b\x1b[", "\xe2\x82\xac\xff\xc3", "\r\x1b\n", "\x1b[" + "9;9;9;9;9;9;9;9;9;9;9;9;9;9;9;9;9" + "~"} {
+		f.Add([]byte(seed), 3)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, split int) {
+		var whole InputParser
+		want := whole.Feed(nil, data)
+
+		if split < 0 {
+			split = -split
+		}
+		var parts InputParser
+		var got []Event
+		if len(data) > 0 {
+			split %= len(data) + 1
+			got = parts.Feed(got, data[:split])
+			got = parts.Feed(got, data[split:])
+		}
+		require.Equal(t, want, got)
+
+		for _, ev := range want {
+			switch ev.Kind {
+			case EventEscape, EventPasteStart, EventPasteEnd:
+				require.NotEmpty(t, ev.Seq)
+				require.LessOrEqual(t, len(ev.Seq), maxEscapeLen)
+				require.Equal(t, byte(esc), ev.Seq[0])
+			default:
+				require.Equal(t, KeyEvent(ev.Rune), ev)
+			}
+		}
+	})
+}
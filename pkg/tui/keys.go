@@ -0,0 +1,59 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Key is a single-byte key press that can be bound to an action: Ctrl plus a
+// letter, or Tab.
+type Key rune
+
+// KeyTab is the Tab key, which terminals send as Ctrl+I.
+const KeyTab Key = '\t'
+
+// Keys that editing the input line relies on and so cannot be bound.
+var reservedKeys = map[Key]string{
+	'\b': "backspace",
+	'\n': "enter",
+	'\r': "enter",
+}
+
+// ParseKey reads a key name such as "ctrl+l", "^L", or "tab".
+func ParseKey(name string) (Key, error) {
+	lower := strings.ToLower(strings.TrimSpace(name))
+	if lower == "tab" {
+		return KeyTab, nil
+	}
+	letter, ok := strings.CutPrefix(lower, "ctrl+")
+	if !ok {
+		letter, ok = strings.CutPrefix(lower, "^")
+	}
+	if !ok || len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' {
+		return 0, fmt.Errorf("tui: unknown key %q (want ctrl+<letter> or tab)", name)
+	}
+	key := Key(letter[0] - 'a' + 1)
+	if what, reserved := reservedKeys[key]; reserved {
+		return 0, fmt.Errorf("tui: %s is %s and cannot be bound", key, what)
+	}
+	return key, nil
+}
+
+// String returns the name ParseKey accepts, e.g. "ctrl+l".
+func (k Key) String() string {
+	if k == KeyTab {
+		return "tab"
+	}
+	if k >= 1 && k <= 26 {
+		return "ctrl+" + string(rune('a'+k-1))
+	}
+	return fmt.Sprintf("key(%#x)", rune(k))
+}
+
+// Label is the caret form terminals echo, e.g. "^C".
+func (k Key) Label() string {
+	if k != KeyTab && k >= 1 && k <= 26 {
+		return "^" + string(rune('A'+k-1))
+	}
+	return k.String()
+}
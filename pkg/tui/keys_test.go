@@ -0,0 +1,41 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKey(t *testing.T) {
+	cases := []struct {
+		name string
+		want Key
+		err  string
+	}{
+		{name: "ctrl+c", want: 0x03},
+		{name: "Ctrl+L", want: 0x0c},
+		{name: "^o", want: 0x0f},
+		{name: "tab", want: KeyTab},
+		{name: "ctrl+i", want: KeyTab},
+		{name: "ctrl+h", err: `tui: ctrl+h is backspace and cannot be bound`},
+		{name: "ctrl+m", err: `tui: ctrl+m is enter and cannot be bound`},
+		{name: "alt+x", err: `tui: unknown key "alt+x" (want ctrl+<letter> or tab)`},
+		{name: "ctrl+1", err: `tui: unknown key "ctrl+1" (want ctrl+<letter> or tab)`},
+	}
+	for _, tc := range cases {
+		got, err := ParseKey(tc.name)
+		if tc.err != "" {
+			require.EqualError(t, err, tc.err, tc.name)
+			continue
+		}
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.want, got, tc.name)
+	}
+}
+
+func TestKeyNames(t *testing.T) {
+	require.Equal(t, "ctrl+d", Key(0x04).String())
+	require.Equal(t, "^D", Key(0x04).Label())
+	require.Equal(t, "tab", KeyTab.String())
+	require.Equal(t, "tab", KeyTab.Label())
+}
@@ -0,0 +1,100 @@
+package tui
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Sanitize removes terminal escape sequences and other control characters
+// from untrusted text, such as a chat message, so it cannot move the cursor,
+// clear the screen, or retitle the window of whoever it is drawn for. Whole
+// sequences are removed, the parameters and strings of CSI, OSC, DCS, and
+// the like included, in their 7-bit (ESC [) and 8-bit (U+009B) forms.
+// Invalid UTF-8 becomes U+FFFD, so stray 8-bit bytes cannot act as controls
+// either. Valid text without control characters is returned unchanged.
+func Sanitize(s string) string {
+	if utf8.ValidString(s) && !strings.ContainsFunc(s, unicode.IsControl) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if !unicode.IsControl(r) {
+			b.WriteRune(r)
+			continue
+		}
+		i = skipSequence(runes, i)
+	}
+	return b.String()
+}
+
+// C1 controls that introduce a sequence, and their 7-bit ESC forms.
+const (
+	c1DCS = 0x90
+	c1SOS = 0x98
+	c1CSI = 0x9b
+	c1ST  = 0x9c
+	c1OSC = 0x9d
+	c1PM  = 0x9e
+	c1APC = 0x9f
+)
+
+// skipSequence returns the index of the last rune of the control character
+// or sequence starting at runes[i].
+func skipSequence(runes []rune, i int) int {
+	introducer := runes[i]
+	if introducer == esc {
+		if i+1 == len(runes) {
+			return i
+		}
+		next := runes[i+1]
+		switch {
+		case next >= 0x40 && next <= 0x5f:
+			// ESC @ through ESC _ are the 7-bit forms of the C1 controls.
+			introducer = next + 0x40
+			i++
+		case next >= 0x20 && next <= 0x2f:
+			// nF: intermediates up to a final byte, e.g. ESC ( B.
+			i++
+			for i+1 < len(runes) && runes[i+1] >= 0x20 && runes[i+1] <= 0x2f {
+				i++
+			}
+			if i+1 < len(runes) && runes[i+1] >= 0x30 && runes[i+1] <= 0x7e {
+				i++
+			}
+			return i
+		case next >= 0x30 && next <= 0x7e:
+			// Fp and Fs: two-character sequences such as ESC 7 or ESC c.
+			return i + 1
+		default:
+			return i
+		}
+	}
+
+	switch introducer {
+	case c1CSI:
+		// Parameters and intermediates up to a final byte.
+		for i+1 < len(runes) && runes[i+1] >= 0x20 && runes[i+1] <= 0x3f {
+			i++
+		}
+		if i+1 < len(runes) && runes[i+1] >= 0x40 && runes[i+1] <= 0x7e {
+			i++
+		}
+	case c1OSC, c1DCS, c1SOS, c1PM, c1APC:
+		// A control string runs to ST, or BEL for OSC as xterm allows, or to
+		// the end of the text.
+		for i+1 < len(runes) {
+			i++
+			switch {
+			case runes[i] == c1ST, runes[i] == 0x07 && introducer == c1OSC:
+				return i
+			case runes[i] == esc && i+1 < len(runes) && runes[i+1] == '\\':
+				return i + 1
+			}
+		}
+	}
+	return i
+}
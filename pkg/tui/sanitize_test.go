@@ -0,0 +1,32 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+	}{
+		{name: "plain text", in: "héllo 👋", want: "héllo 👋"},
+		{name: "colors", in: "\x1b[1;31mred\x1b[0m", want: "red"},
+		{name: "cursor moves and clears", in: "a\x1b[2J\x1b[H\x1b[10;5Hb\x1b[K", want: "ab"},
+		{name: "title change with bel", in: "x\x1b]0;owned\x07y", want: "xy"},
+		{name: "title change with st", in: "x\x1b]2;owned\x1b\\y", want: "xy"},
+		{name: "hyperlink", in: "\x1b]8;;http://evil\x1b\\click\x1b]8;;\x1b\\", want: "click"},
+		{name: "dcs", in: "a\x1bPq#0;2;0;0;0\x1b\\b", want: "ab"},
+		{name: "unterminated string", in: "a\x1b]0;never ends", want: "a"},
+		{name: "8-bit csi and osc", in: "a\u009b2Jb\u009d0;t\u009cc", want: "abc"},
+		{name: "two-character escapes", in: "a\x1bcb\x1b7c\x1b(Bd", want: "abcd"},
+		{name: "lone esc", in: "a\x1b", want: "a"},
+		{name: "other controls", in: "a\tb\r\nc\x07\x08\x7f", want: "abc"},
+		{name: "invalid utf-8", in: "a\x9b2Jb", want: "a�2Jb"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, Sanitize(tc.in))
+		})
+	}
+}
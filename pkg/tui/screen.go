@@ -0,0 +1,425 @@
+// Package tui draws the line-oriented terminal interface shared by SSH
+// session handlers: a status line pinned to the top row (or kept just above the
+// prompt), output scrolling beneath it, and an input prompt on the bottom row,
+// redrawn with minimal escape sequences.
+package tui
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	seqSaveCursor    = "\0337\033[s"
+	seqRestoreCursor = "\033[u\0338"
+	seqCursorHome    = "\033[H"
+	seqClearLine     = "\033[2K"
+	seqInsertLine    = "\033[1L"
+	seqClearScreen   = "\033[2J"
+	seqEraseToEOL    = "\033[K"
+	seqCursorDown    = "\033[1B"
+	seqCursorUp      = "\033[1A"
+	seqPasteOn       = "\033[?2004h"
+	seqPasteOff      = "\033[?2004l"
+)
+
+// DefaultPrompt precedes the input line unless WithPrompt changes it.
+const DefaultPrompt = "> "
+
+// StatusPosition is where the status line is drawn.
+type StatusPosition int
+
+const (
+	// StatusTop pins the status line to the top row of the terminal.
+	StatusTop StatusPosition = iota
+	// StatusBottom keeps the status line on the row just above the prompt.
+	StatusBottom
+)
+
+// String returns "top" or "bottom".
+func (p StatusPosition) String() string {
+	if p == StatusBottom {
+		return "bottom"
+	}
+	return "top"
+}
+
+// Screen renders one client's terminal. It is safe for concurrent use; every
+// operation reaches the client as a single write.
+type Screen struct {
+	writer *writer
+
+	width atomic.Int32
+	// term is the TERM value from the client's "pty-req".
+	term atomic.Value
+
+	// render tracks what is currently on screen so UpdatePrompt can emit only the
+	// difference. Anything that overwrites the prompt row invalidates it. The
+	// prompt and status position are guarded by the same lock.
+	renderMu    sync.Mutex
+	prompt      string
+	statusPos   StatusPosition
+	statusInit  bool
+	lastStatus  string
+	statusDrawn bool
+	drawnPos    StatusPosition
+	lastPrompt  string
+	lastInput   string
+	inputDrawn  bool
+	// paste is set once bracketed paste is on, for Finish to turn it off.
+	paste bool
+	// finished is set by Finish; nothing is drawn after it.
+	finished bool
+}
+
+// Option customises a Screen.
+type Option func(*Screen)
+
+// WithPrompt sets the text shown before the input line; "" shows none, for
+// handlers that take no input.
+func WithPrompt(prompt string) Option {
+	return func(ui *Screen) {
+		ui.prompt = prompt
+	}
+}
+
+// WithStatusPosition sets where the status line is drawn; the default is
+// StatusTop.
+func WithStatusPosition(pos StatusPosition) Option {
+	return func(ui *Screen) {
+		ui.statusPos = pos
+	}
+}
+
+// NewScreen renders to out, typically an SSH channel.
+func NewScreen(out io.Writer, opts ...Option) *Screen {
+	ui := &Screen{writer: newWriter(out), prompt: DefaultPrompt}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(ui)
+		}
+	}
+	return ui
+}
+
+// SetPrompt replaces the text shown before the input line. It is drawn on the
+// next render, cut to at most half the terminal width.
+func (ui *Screen) SetPrompt(prompt string) {
+	ui.renderMu.Lock()
+	defer ui.renderMu.Unlock()
+	ui.prompt = prompt
+}
+
+// SetStatusPosition moves the status line on the next render.
+func (ui *Screen) SetStatusPosition(pos StatusPosition) {
+	ui.renderMu.Lock()
+	defer ui.renderMu.Unlock()
+	ui.statusPos = pos
+}
+
+// ClearScreen blanks the terminal and, with the status line at the top,
+// reserves the top row for it.
+func (ui *Screen) ClearScreen() error {
+	ui.renderMu.Lock()
+	defer ui.renderMu.Unlock()
+	if ui.finished {
+		return nil
+	}
+
+	seq := seqClearScreen + seqCursorHome
+	if ui.statusPos == StatusTop {
+		// Reserve the top row for the status line and start output beneath it.
+		seq += "\r\n"
+	}
+	if err := ui.writer.writeString(seq); err != nil {
+		return err
+	}
+	ui.statusInit = ui.statusPos == StatusTop
+	ui.statusDrawn = false
+	ui.inputDrawn = false
+	return nil
+}
+
+// EnablePaste asks the terminal to bracket pasted text, which InputParser
+// reports as EventPasteStart and EventPasteEnd, so line breaks in a paste
+// can be told from Enter. Finish turns it off again.
+func (ui *Screen) EnablePaste() error {
+	ui.renderMu.Lock()
+	defer ui.renderMu.Unlock()
+	if ui.finished || ui.paste {
+		return nil
+	}
+	if err := ui.writer.writeString(seqPasteOn); err != nil {
+		return err
+	}
+	ui.paste = true
+	return nil
+}
+
+// DisplayControlAck echoes a control key label and redraws the prompt.
+func (ui *Screen) DisplayControlAck(label, header, line string) error {
+	return ui.writeLine(label, header, line)
+}
+
+// DisplayMessage prints msg above the prompt and redraws the prompt beneath it.
+func (ui *Screen) DisplayMessage(msg, header, line string) error {
+	return ui.writeLine(msg, header, line)
+}
+
+// writeLine prints a full line over the prompt row followed by a fresh prompt,
+// all in one frame.
+func (ui *Screen) writeLine(text, header, line string) error {
+	ui.renderMu.Lock()
+	defer ui.renderMu.Unlock()
+	if ui.finished {
+		return nil
+	}
+
+	buf := getWriteBuffer()
+	defer putWriteBuffer(buf)
+
+	buf.WriteString("\r" + seqEraseToEOL)
+	if ui.statusDrawn && ui.drawnPos == StatusBottom {
+		// Print over the status row; the status moves down to the prompt row and
+		// the prompt to a fresh row beneath it.
+		buf.WriteString(seqCursorUp + "\r" + seqClearLine)
+		ui.statusDrawn = false
+	}
+	buf.WriteString(text)
+	buf.WriteString("\r\n")
+	ui.inputDrawn = false
+
+	return ui.flushPromptLocked(buf, header, line)
+}
+
+// UpdatePrompt refreshes the status header and input line, writing nothing for
+// parts that are unchanged since the last render.
+func (ui *Screen) UpdatePrompt(header, line string) error {
+	ui.renderMu.Lock()
+	defer ui.renderMu.Unlock()
+	if ui.finished {
+		return nil
+	}
+
+	buf := getWriteBuffer()
+	defer putWriteBuffer(buf)
+
+	return ui.flushPromptLocked(buf, header, line)
+}
+
+// Finish ends the screen when its session closes: it erases the prompt (and a
+// status line kept above it), prints msg unless it is empty, and leaves the
+// cursor at the start of a fresh line for whatever the client shows next.
+// Later drawing calls do nothing.
+func (ui *Screen) Finish(msg string) error {
+	ui.renderMu.Lock()
+	defer ui.renderMu.Unlock()
+	if ui.finished {
+		return nil
+	}
+	ui.finished = true
+
+	seq := "\r" + seqEraseToEOL
+	if ui.paste {
+		seq += seqPasteOff
+	}
+	if ui.statusDrawn && ui.drawnPos == StatusBottom {
+		seq += seqCursorUp + "\r" + seqClearLine
+	}
+	if msg != "" {
+		seq += msg + "\r\n"
+	}
+	return ui.writer.writeString(seq)
+}
+
+// flushPromptLocked appends the status and input updates to buf and writes the
+// whole frame, committing the render state only when the write succeeds.
+func (ui *Screen) flushPromptLocked(buf *bytes.Buffer, header, line string) error {
+	statusDrawn, inputDrawn := ui.statusDrawn, ui.inputDrawn
+	if statusDrawn && ui.drawnPos != ui.statusPos {
+		// The status line moved: blank it where it was.
+		if ui.drawnPos == StatusTop {
+			buf.WriteString(seqSaveCursor + seqCursorHome + seqClearLine + seqRestoreCursor)
+		} else {
+			buf.WriteString("\r" + seqClearLine + seqCursorUp + "\r" + seqClearLine)
+			inputDrawn = false
+		}
+		statusDrawn = false
+	}
+
+	header = ui.visibleStatus(header)
+	statusChanged := !statusDrawn || ui.lastStatus != header
+	if ui.statusPos == StatusTop {
+		if !ui.statusInit {
+			// Push existing output down one row to make room for the status line and
+			// follow it so the cursor stays on the same content.
+			buf.WriteString(seqSaveCursor + seqCursorHome + seqInsertLine + seqRestoreCursor + seqCursorDown)
+		}
+		if statusChanged {
+			buf.WriteString(seqSaveCursor + seqCursorHome + seqClearLine)
+			buf.WriteString(header)
+			buf.WriteString(seqRestoreCursor)
+		}
+	} else if !statusDrawn {
+		// Draw the status on the prompt row and open a new row for the prompt.
+		buf.WriteString("\r" + seqClearLine + header + "\r\n")
+		inputDrawn = false
+	} else if statusChanged {
+		buf.WriteString(seqSaveCursor + seqCursorUp + "\r" + seqClearLine)
+		buf.WriteString(header)
+		buf.WriteString(seqRestoreCursor)
+	}
+
+	prompt := ui.visiblePrompt()
+	if prompt != ui.lastPrompt {
+		inputDrawn = false
+	}
+	visible := ui.visibleInput(prompt, line)
+	if !inputDrawn || ui.lastInput != visible {
+		buf.WriteString(ui.inputDiff(inputDrawn, prompt, visible))
+	}
+
+	if err := ui.writer.write(buf.Bytes()); err != nil {
+		ui.statusDrawn = false
+		ui.inputDrawn = false
+		return err
+	}
+
+	if ui.statusPos == StatusTop {
+		ui.statusInit = true
+	}
+	ui.lastStatus, ui.statusDrawn, ui.drawnPos = header, true, ui.statusPos
+	ui.lastPrompt = prompt
+	ui.lastInput, ui.inputDrawn = visible, true
+	return nil
+}
+
+// inputDiff builds the escape sequence turning the drawn input line into next.
+// Typing appends only the new runes and erasing steps the cursor back over the
+// removed columns; anything else falls back to a full prompt redraw.
+func (ui *Screen) inputDiff(drawn bool, prompt, next string) string {
+	if drawn {
+		prev := ui.lastInput
+		switch {
+		case strings.HasPrefix(next, prev):
+			return next[len(prev):]
+		case strings.HasPrefix(prev, next):
+			return cursorBack(StringWidth(prev[len(next):])) + seqEraseToEOL
+		}
+	}
+	return "\r" + prompt + next + seqEraseToEOL
+}
+
+func cursorBack(cols int) string {
+	switch cols {
+	case 0:
+		return ""
+	case 1:
+		return "\b"
+	default:
+		return "\033[" + strconv.Itoa(cols) + "D"
+	}
+}
+
+// ptyRequest mirrors the RFC 4254 "pty-req" payload.
+type ptyRequest struct {
+	Term     string
+	Columns  uint32
+	Rows     uint32
+	WidthPx  uint32
+	HeightPx uint32
+	Modes    string
+}
+
+// windowChangeRequest mirrors the RFC 4254 "window-change" payload.
+type windowChangeRequest struct {
+	Columns  uint32
+	Rows     uint32
+	WidthPx  uint32
+	HeightPx uint32
+}
+
+// Resize applies the terminal width from an SSH "pty-req" or "window-change"
+// request, and the terminal type from a "pty-req", and reports whether req
+// was one of them. The caller still replies.
+func (ui *Screen) Resize(req *ssh.Request) bool {
+	switch req.Type {
+	case "pty-req":
+		var pty ptyRequest
+		if err := ssh.Unmarshal(req.Payload, &pty); err == nil {
+			ui.SetWidth(int(pty.Columns))
+			ui.SetTerm(pty.Term)
+		}
+	case "window-change":
+		var win windowChangeRequest
+		if err := ssh.Unmarshal(req.Payload, &win); err == nil {
+			ui.SetWidth(int(win.Columns))
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// SetWidth records the terminal width in columns reported by the client.
+func (ui *Screen) SetWidth(cols int) {
+	if cols > 0 {
+		ui.width.Store(int32(cols))
+	}
+}
+
+// Width returns the terminal width in columns reported by the client, or 0
+// before it reported one.
+func (ui *Screen) Width() int {
+	return int(ui.width.Load())
+}
+
+// SetTerm records the terminal type the client reported, such as
+// "xterm-256color".
+func (ui *Screen) SetTerm(term string) {
+	ui.term.Store(term)
+}
+
+// Term returns the terminal type the client reported, such as
+// "xterm-256color", or "" before a "pty-req".
+func (ui *Screen) Term() string {
+	term, _ := ui.term.Load().(string)
+	return term
+}
+
+// visiblePrompt cuts the prompt to half the terminal width so a long custom
+// prompt always leaves room to type.
+func (ui *Screen) visiblePrompt() string {
+	cols := int(ui.width.Load())
+	if cols == 0 {
+		return ui.prompt
+	}
+	return HeadByWidth(ui.prompt, cols/2)
+}
+
+// visibleInput returns the tail of line that fits on one row after prompt,
+// measured in display columns so wide characters keep the cursor on screen.
+func (ui *Screen) visibleInput(prompt, line string) string {
+	cols := int(ui.width.Load())
+	if cols == 0 {
+		return line
+	}
+	// Leave the last column free so the cursor never wraps onto a new row.
+	return TailByWidth(line, cols-StringWidth(prompt)-1)
+}
+
+// visibleStatus cuts header to one row so a long status never wraps onto the
+// output below it.
+func (ui *Screen) visibleStatus(header string) string {
+	cols := int(ui.width.Load())
+	if cols == 0 {
+		return header
+	}
+	return HeadByWidth(header, cols-1)
+}
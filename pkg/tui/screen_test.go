@@ -0,0 +1,245 @@
+package tui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestScreenUpdatePromptEmitsMinimalDiff(t *testing.T) {
+	cases := []struct {
+		name string
+		prev string
+		next string
+		want string
+	}{
+		{name: "unchanged", prev: "hi", next: "hi", want: ""},
+		{name: "append", prev: "hi", next: "hi!", want: "!"},
+		{name: "erase ascii", prev: "hi!", next: "hi", want: "\b" + seqEraseToEOL},
+		{name: "erase wide", prev: "a한", next: "a", want: "\033[2D" + seqEraseToEOL},
+		{name: "replace", prev: "abc", next: "xyz", want: "\r" + DefaultPrompt + "xyz" + seqEraseToEOL},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			ui := NewScreen(&out)
+
+			require.NoError(t, ui.UpdatePrompt("Users online: 1", tc.prev))
+			out.Reset()
+
+			require.NoError(t, ui.UpdatePrompt("Users online: 1", tc.next))
+			require.Equal(t, tc.want, out.String())
+		})
+	}
+}
+
+func TestScreenRedrawsPromptAfterMessage(t *testing.T) {
+	var out bytes.Buffer
+	ui := NewScreen(&out)
+
+	require.NoError(t, ui.UpdatePrompt("Users online: 1", "draft"))
+	out.Reset()
+
+	require.NoError(t, ui.DisplayMessage("hello", "Users online: 1", "draft"))
+	require.Equal(t, "\r"+seqEraseToEOL+"hello\r\n\r"+DefaultPrompt+"draft"+seqEraseToEOL, out.String())
+}
+
+func TestScreenMakesRoomForTheStatusLine(t *testing.T) {
+	var out bytes.Buffer
+	ui := NewScreen(&out)
+
+	// Without a cleared screen the first frame pushes existing output down a
+	// row and moves the cursor with it, so the next line lands under it.
+	require.NoError(t, ui.UpdatePrompt("Users online: 1", ""))
+	require.True(t, strings.HasPrefix(out.String(), seqSaveCursor+seqCursorHome+seqInsertLine+seqRestoreCursor+seqCursorDown))
+
+	// A cleared screen reserves the top row itself, so nothing is pushed down.
+	out.Reset()
+	ui = NewScreen(&out)
+	require.NoError(t, ui.ClearScreen())
+	require.Equal(t, seqClearScreen+seqCursorHome+"\r\n", out.String())
+	out.Reset()
+	require.NoError(t, ui.UpdatePrompt("Users online: 1", ""))
+	require.NotContains(t, out.String(), seqInsertLine)
+}
+
+func TestScreenRedrawsStatusOnlyWhenChanged(t *testing.T) {
+	var out bytes.Buffer
+	ui := NewScreen(&out)
+
+	require.NoError(t, ui.UpdatePrompt("Users online: 1", ""))
+	out.Reset()
+
+	require.NoError(t, ui.UpdatePrompt("Users online: 2", ""))
+	require.Contains(t, out.String(), "Users online: 2")
+}
+
+func BenchmarkScreenKeystroke(b *testing.B) {
+	counter := &countingWriter{}
+	ui := NewScreen(counter)
+	line := []rune("the quick brown fox jumps over the lazy dog")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := i%len(line) + 1
+		if err := ui.UpdatePrompt("Users online: 3", string(line[:n])); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counter.n)/float64(b.N), "bytes/op")
+}
+
+func TestScreenWritesOneFramePerOperation(t *testing.T) {
+	counter := &countingWriter{}
+	ui := NewScreen(counter)
+
+	require.NoError(t, ui.UpdatePrompt("Users online: 1", "hi"))
+	require.NoError(t, ui.DisplayMessage("hello", "Users online: 2", "hi"))
+	require.Equal(t, 2, counter.writes)
+}
+
+func BenchmarkScreenMessageStorm(b *testing.B) {
+	counter := &countingWriter{}
+	ui := NewScreen(counter)
+	msg := "[2024-05-01 09:30:00] alice: the quick brown fox jumps over the lazy dog"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := ui.DisplayMessage(msg, "Users online: 3", "draft"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkScreenIdleRefresh(b *testing.B) {
+	counter := &countingWriter{}
+	ui := NewScreen(counter)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ui.UpdatePrompt("Users online: 3", "draft"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counter.n)/float64(b.N), "bytes/op")
+}
+
+type countingWriter struct {
+	n      int
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	w.writes++
+	return len(p), nil
+}
+
+func TestScreenResize(t *testing.T) {
+	var out bytes.Buffer
+	ui := NewScreen(&out, WithPrompt(""))
+	require.Empty(t, ui.Term())
+
+	require.True(t, ui.Resize(&ssh.Request{Type: "pty-req", Payload: ssh.Marshal(ptyRequest{Term: "xterm", Columns: 12, Rows: 24})}))
+	require.Equal(t, "xterm", ui.Term())
+	require.NoError(t, ui.UpdatePrompt("a status line that is too long", "typed input"))
+	require.Contains(t, out.String(), "a status li"+seqRestoreCursor, "the status fits in 11 columns")
+	require.True(t, strings.HasSuffix(out.String(), "\r"+"typed input"+seqEraseToEOL), "no prompt before the input")
+
+	require.True(t, ui.Resize(&ssh.Request{Type: "window-change", Payload: ssh.Marshal(windowChangeRequest{Columns: 80, Rows: 24})}))
+	require.Equal(t, int32(80), ui.width.Load())
+	require.Equal(t, "xterm", ui.Term(), "window changes keep the terminal type")
+	require.False(t, ui.Resize(&ssh.Request{Type: "shell"}))
+}
+
+func TestScreenSetPromptTruncatesToHalfWidth(t *testing.T) {
+	var out bytes.Buffer
+	ui := NewScreen(&out)
+	ui.SetWidth(12)
+
+	require.NoError(t, ui.UpdatePrompt("status", "hi"))
+	out.Reset()
+	ui.SetPrompt("❯ ")
+	require.NoError(t, ui.UpdatePrompt("status", "hi"))
+	require.Equal(t, "\r❯ hi"+seqEraseToEOL, out.String(), "a new prompt redraws the input line")
+
+	out.Reset()
+	ui.SetPrompt("한국어 프롬프트> ")
+	require.NoError(t, ui.UpdatePrompt("status", "typed input"))
+	require.Equal(t, "\r한국어"+"input"+seqEraseToEOL, out.String(), "the prompt keeps 6 columns and the input the rest")
+}
+
+func TestScreenStatusAtBottom(t *testing.T) {
+	var out bytes.Buffer
+	ui := NewScreen(&out, WithStatusPosition(StatusBottom))
+
+	require.NoError(t, ui.ClearScreen())
+	require.Equal(t, seqClearScreen+seqCursorHome, out.String(), "no row is reserved at the top")
+
+	out.Reset()
+	require.NoError(t, ui.UpdatePrompt("Users online: 1", ""))
+	require.Equal(t, "\r"+seqClearLine+"Users online: 1\r\n\r"+DefaultPrompt+seqEraseToEOL, out.String())
+
+	out.Reset()
+	require.NoError(t, ui.UpdatePrompt("Users online: 2", "x"))
+	require.Equal(t, seqSaveCursor+seqCursorUp+"\r"+seqClearLine+"Users online: 2"+seqRestoreCursor+"x", out.String())
+
+	out.Reset()
+	require.NoError(t, ui.DisplayMessage("hello", "Users online: 2", "x"))
+	require.Equal(t, "\r"+seqEraseToEOL+seqCursorUp+"\r"+seqClearLine+"hello\r\n"+
+		"\r"+seqClearLine+"Users online: 2\r\n\r"+DefaultPrompt+"x"+seqEraseToEOL, out.String(),
+		"the message replaces the status row and the status follows it down")
+}
+
+func TestScreenMovesStatusLine(t *testing.T) {
+	var out bytes.Buffer
+	ui := NewScreen(&out)
+	require.NoError(t, ui.ClearScreen())
+	require.NoError(t, ui.UpdatePrompt("status", "x"))
+
+	out.Reset()
+	ui.SetStatusPosition(StatusBottom)
+	require.NoError(t, ui.UpdatePrompt("status", "x"))
+	require.True(t, strings.HasPrefix(out.String(), seqSaveCursor+seqCursorHome+seqClearLine+seqRestoreCursor), "the top row is blanked")
+	require.Contains(t, out.String(), "status\r\n\r"+DefaultPrompt+"x")
+
+	out.Reset()
+	ui.SetStatusPosition(StatusTop)
+	require.NoError(t, ui.UpdatePrompt("status", "x"))
+	require.True(t, strings.HasPrefix(out.String(), "\r"+seqClearLine+seqCursorUp+"\r"+seqClearLine), "the bottom status row is blanked")
+	require.Contains(t, out.String(), seqCursorHome+seqClearLine+"status"+seqRestoreCursor)
+	require.True(t, strings.HasSuffix(out.String(), "\r"+DefaultPrompt+"x"+seqEraseToEOL))
+}
+
+func TestScreenFinish(t *testing.T) {
+	var out bytes.Buffer
+	ui := NewScreen(&out)
+	require.NoError(t, ui.UpdatePrompt("status", "draft"))
+
+	out.Reset()
+	require.NoError(t, ui.Finish("Goodbye!"))
+	require.Equal(t, "\r"+seqEraseToEOL+"Goodbye!\r\n", out.String())
+
+	out.Reset()
+	require.NoError(t, ui.DisplayMessage("late", "status", ""))
+	require.NoError(t, ui.UpdatePrompt("status", "x"))
+	require.NoError(t, ui.ClearScreen())
+	require.NoError(t, ui.Finish("again"))
+	require.Empty(t, out.String(), "nothing is drawn after Finish")
+
+	ui = NewScreen(&out, WithStatusPosition(StatusBottom))
+	require.NoError(t, ui.UpdatePrompt("status", ""))
+	out.Reset()
+	require.NoError(t, ui.Finish(""))
+	require.Equal(t, "\r"+seqEraseToEOL+seqCursorUp+"\r"+seqClearLine, out.String(), "the status row above the prompt is erased too")
+}
@@ -0,0 +1,54 @@
+package tui
+
+import "strings"
+
+// StatusSeparator sits between the segments of a status bar.
+const StatusSeparator = " | "
+
+// LayoutStatus lays out a status bar cols columns wide: the left segments from
+// the first column and the right ones flush against the last column the
+// screen draws in, each group joined by StatusSeparator. Empty segments are
+// skipped. When the bar is too narrow, segments are dropped from the end of
+// the left group and then of the right one; the first left segment is always
+// kept, for the screen to cut. A cols of 0, for an unknown width, puts the
+// right group straight after the left one.
+func LayoutStatus(left, right []string, cols int) string {
+	left, right = nonEmpty(left), nonEmpty(right)
+	if cols <= 0 {
+		return strings.Join(append(left, right...), StatusSeparator)
+	}
+	// The screen leaves the last column free.
+	avail := cols - 1
+	for {
+		l := strings.Join(left, StatusSeparator)
+		r := strings.Join(right, StatusSeparator)
+		gap := avail - StringWidth(l) - StringWidth(r)
+		if len(left) > 0 && len(right) > 0 {
+			// Keep the groups a space apart.
+			gap--
+		}
+		switch {
+		case gap >= 0:
+			if len(right) == 0 {
+				return l
+			}
+			return l + strings.Repeat(" ", avail-StringWidth(l)-StringWidth(r)) + r
+		case len(left) > 1:
+			left = left[:len(left)-1]
+		case len(right) > 0:
+			right = right[:len(right)-1]
+		default:
+			return l
+		}
+	}
+}
+
+func nonEmpty(segments []string) []string {
+	var kept []string
+	for _, s := range segments {
+		if s != "" {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,42 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayoutStatus(t *testing.T) {
+	left := []string{"#lobby", "", "ship it"}
+	right := []string{"2 online", "rtt 4ms"}
+	require.Equal(t, "#lobby | ship it | 2 online | rtt 4ms", LayoutStatus(left, right, 0), "unknown widths do not align")
+
+	cases := []struct {
+		name        string
+		cols        int
+		left, right string
+	}{
+		{name: "wide", cols: 60, left: "#lobby | ship it", right: "2 online | rtt 4ms"},
+		{name: "snug", cols: 36, left: "#lobby | ship it", right: "2 online | rtt 4ms"},
+		{name: "left dropped first", cols: 35, left: "#lobby", right: "2 online | rtt 4ms"},
+		{name: "then right", cols: 20, left: "#lobby", right: "2 online"},
+		{name: "first left kept", cols: 5, left: "#lobby"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := LayoutStatus(left, right, tc.cols)
+			if tc.right == "" {
+				require.Equal(t, tc.left, got)
+				return
+			}
+			require.True(t, strings.HasPrefix(got, tc.left+" "), got)
+			require.True(t, strings.HasSuffix(got, " "+tc.right), got)
+			require.Empty(t, strings.TrimSpace(got[len(tc.left):len(got)-len(tc.right)]), got)
+			require.Equal(t, tc.cols-1, StringWidth(got), "the right group ends next to the last column")
+		})
+	}
+
+	require.Equal(t, "      한국어", LayoutStatus(nil, []string{"한국어"}, 13), "wide runes are measured in columns")
+	require.Empty(t, LayoutStatus([]string{""}, nil, 80))
+}
@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hinshun/vt10x"
+	"github.com/stretchr/testify/require"
+	"github.com/xo/terminfo"
+)
+
+// TestSequencesMatchTerminfo checks the escape sequences the screen writes
+// against the terminfo entries of the terminals it supports. Entries missing
+// from this machine's terminfo database are skipped.
+func TestSequencesMatchTerminfo(t *testing.T) {
+	for _, name := range []string{"xterm-256color", "tmux-256color", "screen-256color", "linux"} {
+		t.Run(name, func(t *testing.T) {
+			ti, err := terminfo.Load(name)
+			if err != nil {
+				t.Skipf("no terminfo entry for %s: %v", name, err)
+			}
+
+			require.Equal(t, ti.Printf(terminfo.CursorHome), seqCursorHome)
+			require.Equal(t, ti.Printf(terminfo.ParmInsertLine, 1), seqInsertLine)
+			require.Equal(t, ti.Printf(terminfo.ClrEol), seqEraseToEOL)
+			require.Equal(t, ti.Printf(terminfo.ParmDownCursor, 1), seqCursorDown)
+			require.Equal(t, ti.Printf(terminfo.ParmUpCursor, 1), seqCursorUp)
+			// The screen saves and restores the cursor both ways, DEC and
+			// SCO, so terminals that know only one still get it.
+			require.Contains(t, seqSaveCursor, ti.Printf(terminfo.SaveCursor))
+			require.Contains(t, seqRestoreCursor, ti.Printf(terminfo.RestoreCursor))
+
+			// The rest are spelled differently but must leave the same screen.
+			requireSameEffect(t, ti.Printf(terminfo.ClearScreen), seqClearScreen+seqCursorHome)
+			requireSameEffect(t, ti.Printf(terminfo.CarriageReturn)+ti.Printf(terminfo.ClrEol), "\r"+seqClearLine)
+		})
+	}
+}
+
+// requireSameEffect replays want and got on a filled terminal and compares the
+// screens and cursors they leave.
+func requireSameEffect(t *testing.T, want, got string) {
+	t.Helper()
+	replay := func(seq string) (string, vt10x.Cursor) {
+		term := vt10x.New(vt10x.WithSize(20, 4))
+		_, err := term.Write([]byte(strings.Repeat("x", 20*4-1) + "\033[2;5H" + seq))
+		require.NoError(t, err)
+		screen := term.String()
+		term.Lock()
+		defer term.Unlock()
+		return screen, term.Cursor()
+	}
+	wantScreen, wantCursor := replay(want)
+	gotScreen, gotCursor := replay(got)
+	require.Equal(t, wantScreen, gotScreen, "%q and %q", want, got)
+	require.Equal(t, [2]int{wantCursor.X, wantCursor.Y}, [2]int{gotCursor.X, gotCursor.Y}, "%q and %q", want, got)
+}
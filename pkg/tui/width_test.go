@@ -0,0 +1,43 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStringWidth(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{name: "ascii", input: "hello", want: 5},
+		{name: "hangul", input: "안녕", want: 4},
+		{name: "cjk", input: "漢字", want: 4},
+		{name: "emoji", input: "👍", want: 2},
+		{name: "combining accent", input: "é", want: 1},
+		{name: "zwj family", input: "👨‍👩‍👧", want: 6},
+		{name: "fullwidth", input: "ＡＢ", want: 4},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, StringWidth(tc.input))
+		})
+	}
+}
+
+func TestTailByWidth(t *testing.T) {
+	require.Equal(t, "cd", TailByWidth("abcd", 2))
+	require.Equal(t, "字", TailByWidth("漢字", 3))
+	require.Equal(t, "漢字", TailByWidth("漢字", 4))
+	require.Equal(t, "", TailByWidth("漢字", 0))
+}
+
+func TestHeadByWidth(t *testing.T) {
+	require.Equal(t, "ab", HeadByWidth("abcd", 2))
+	require.Equal(t, "漢", HeadByWidth("漢字", 3))
+	require.Equal(t, "漢字", HeadByWidth("漢字", 4))
+	require.Equal(t, "", HeadByWidth("漢字", 0))
+}
@@ -0,0 +1,67 @@
+package tui
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize caps buffers returned to the pool so a single huge frame
+// does not pin memory for the lifetime of the process.
+const maxPooledBufferSize = 16 << 10
+
+var writeBufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getWriteBuffer() *bytes.Buffer {
+	buf := writeBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putWriteBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	writeBufferPool.Put(buf)
+}
+
+// writer serialises output to the client. Callers assemble each logical
+// UI operation into one frame so the channel sees a single Write per update.
+type writer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func newWriter(out io.Writer) *writer {
+	return &writer{out: out}
+}
+
+// writeString sends s to the client in a single locked call. A frame built
+// as a string needs no pooled buffer; io.WriteString skips the copy when out
+// can take a string.
+func (w *writer) writeString(s string) error {
+	if s == "" {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := io.WriteString(w.out, s)
+	return err
+}
+
+// write sends p to the client in a single locked call.
+func (w *writer) write(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := w.out.Write(p)
+	return err
+}
@@ -0,0 +1,85 @@
+// The browser client of pkg/webgateway. It signs in over the WebSocket and
+// shows the events the server sends; lines typed are sent as they are, so
+// /commands work as they do over SSH.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+let socket;
+let me = "";
+
+function time(iso) {
+  const t = new Date(iso);
+  return isNaN(t) ? "" : t.toLocaleTimeString([], { hour: "2-digit", minute: "2-digit" });
+}
+
+function show(ev) {
+  const item = document.createElement("li");
+  item.className = ev.type === "message" ? ev.kind : ev.type;
+  let text = ev.body || "";
+  if (ev.type === "message") {
+    switch (ev.kind) {
+      case "chat": text = `<${ev.from}> ${ev.body}`; break;
+      case "action": text = `* ${ev.from} ${ev.body}`; break;
+      case "direct": text = `[${ev.from}] ${ev.body}`; break;
+    }
+  } else if (ev.type === "error") {
+    text = ev.error;
+  }
+  item.textContent = `${time(ev.time)} ${text}`;
+  const log = $("log");
+  const atBottom = log.scrollTop + log.clientHeight >= log.scrollHeight - 4;
+  log.append(item);
+  if (atBottom) {
+    log.scrollTop = log.scrollHeight;
+  }
+}
+
+function connect(hello) {
+  const scheme = location.protocol === "https:" ? "wss:" : "ws:";
+  socket = new WebSocket(`${scheme}//${location.host}${location.pathname.replace(/[^/]*$/, "")}ws`);
+  socket.onopen = () => socket.send(JSON.stringify(hello));
+  socket.onmessage = (msg) => {
+    const ev = JSON.parse(msg.data);
+    if (ev.type === "ready") {
+      me = ev.user;
+      $("signin").hidden = true;
+      $("chat").hidden = false;
+      $("line").focus();
+    }
+    if (ev.room && ev.kind !== "direct") {
+      $("room").textContent = `#${ev.room} as ${me}`;
+    }
+    if ($("chat").hidden) {
+      if (ev.type === "error") {
+        $("status").textContent = ev.error;
+      }
+      return;
+    }
+    if (ev.type !== "ready") {
+      show(ev);
+    }
+  };
+  socket.onclose = () => {
+    if ($("chat").hidden) {
+      $("status").textContent ||= "could not connect";
+      return;
+    }
+    show({ type: "error", time: new Date().toISOString(), error: "disconnected; reload to join again" });
+    $("line").disabled = true;
+  };
+}
+
+$("signin").addEventListener("submit", (e) => {
+  e.preventDefault();
+  $("status").textContent = "";
+  connect({ type: "hello", user: $("user").value.trim(), token: $("token").value.trim() });
+});
+
+$("input").addEventListener("submit", (e) => {
+  e.preventDefault();
+  const line = $("line");
+  if (line.value.trim() !== "" && socket && socket.readyState === WebSocket.OPEN) {
+    socket.send(JSON.stringify({ type: "send", text: line.value }));
+  }
+  line.value = "";
+});
@@ -0,0 +1,393 @@
+// Package webgateway lets people without an SSH client join the rooms from a
+// browser. It serves a small embedded HTML/JS client and a WebSocket endpoint
+// that signs the browser in and hands the connection to a Handler, which
+// joins it to the same rooms SSH sessions use.
+package webgateway
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/ledzpl/schat/pkg/tokens"
+)
+
+// Path is where the WebSocket endpoint is served.
+const Path = "/ws"
+
+// ClientVersion is how web sessions are listed next to SSH client versions.
+const ClientVersion = "websocket"
+
+const (
+	// maxFrameSize bounds one frame from the browser.
+	maxFrameSize = 16 << 10
+	// helloTimeout bounds how long a browser may take to sign in.
+	helloTimeout = 10 * time.Second
+	// writeTimeout bounds one write to a browser.
+	writeTimeout = 10 * time.Second
+	// pingInterval is how often idle connections are checked; a browser
+	// that misses two pings is gone.
+	pingInterval = 30 * time.Second
+)
+
+// Event types sent to the browser.
+const (
+	// EventReady confirms the sign-in and names the user and room.
+	EventReady = "ready"
+	// EventMessage is a message posted in the room or sent to the user.
+	EventMessage = "message"
+	// EventSystem is a line of server output, e.g. a command's answer.
+	EventSystem = "system"
+	// EventError reports a request that failed; the connection closes after
+	// a failed sign-in.
+	EventError = "error"
+)
+
+// Request types sent by the browser.
+const (
+	// RequestHello signs in and must come first.
+	RequestHello = "hello"
+	// RequestSend is a line the user typed: a message or a /command.
+	RequestSend = "send"
+)
+
+// ErrSignInRequired is returned for browsers that send neither a valid token
+// nor, where anonymous users are allowed, a name.
+var ErrSignInRequired = errors.New("webgateway: sign in with an API token")
+
+//go:embed static
+var static embed.FS
+
+// Event is one frame sent to the browser.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Room string    `json:"room,omitempty"`
+	// User is the signed-in user, on ready.
+	User string `json:"user,omitempty"`
+	From string `json:"from,omitempty"`
+	// Kind is the message kind, e.g. "chat", "action", "direct", or "system".
+	Kind  string `json:"kind,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Request is one frame sent by the browser.
+type Request struct {
+	Type string `json:"type"`
+	// User is the name an anonymous user asks for, on hello.
+	User string `json:"user,omitempty"`
+	// Token is an API token minted with /token, on hello.
+	Token string `json:"token,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+// User is who a browser signed in as.
+type User struct {
+	Name string
+	// AuthMethod is "token", or empty for anonymous users.
+	AuthMethod string
+	// Account reports that a token of the user's registered account signed
+	// them in.
+	Account bool
+	// ReadOnly is set for read-only tokens, which may watch but not post.
+	ReadOnly   bool
+	RemoteAddr string
+	SessionID  string
+}
+
+// Conn is one signed-in browser.
+type Conn interface {
+	User() User
+	// Receive blocks for the next line the user typed. It returns io.EOF
+	// once the browser leaves or the connection is closed.
+	Receive() (string, error)
+	// Send shows ev to the user; it is safe for concurrent use.
+	Send(ev Event) error
+	// Close ends the connection, making Receive return.
+	Close() error
+}
+
+// Handler runs the session of a signed-in browser until it leaves or ctx is
+// done.
+type Handler func(ctx context.Context, conn Conn) error
+
+// Gateway serves the browser client and its WebSocket endpoint.
+type Gateway struct {
+	ctx       context.Context
+	handle    Handler
+	tokens    *tokens.Store
+	anonymous bool
+	// checkName refuses names anonymous browsers ask for; nil accepts any.
+	checkName func(name string) error
+	origins   map[string]bool
+	logger    *slog.Logger
+	upgrader  websocket.Upgrader
+	files     http.Handler
+}
+
+// Option customises a Gateway.
+type Option func(*Gateway)
+
+// WithTokens signs browsers in with the API tokens in store.
+func WithTokens(store *tokens.Store) Option {
+	return func(g *Gateway) {
+		g.tokens = store
+	}
+}
+
+// WithAnonymous lets browsers without a token join under a name of their
+// choosing, as SSH users may when the server accepts them without auth.
+func WithAnonymous(allow bool) Option {
+	return func(g *Gateway) {
+		g.anonymous = allow
+	}
+}
+
+// WithNameCheck refuses anonymous sign-ins under names for which check
+// returns an error, such as names that need a password or token; the browser
+// is shown the error. Token sign-ins take the token owner's name unchecked.
+func WithNameCheck(check func(name string) error) Option {
+	return func(g *Gateway) {
+		g.checkName = check
+	}
+}
+
+// WithOrigins allows pages from other origins, e.g.
+// "https://chat.example.com", to open the WebSocket. Pages served by the
+// gateway itself are always allowed.
+func WithOrigins(origins ...string) Option {
+	return func(g *Gateway) {
+		for _, o := range origins {
+			g.origins[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+		}
+	}
+}
+
+// WithLogger sets the destination for connection logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(g *Gateway) {
+		if logger != nil {
+			g.logger = logger
+		}
+	}
+}
+
+// New returns a gateway handing signed-in browsers to handle. Their sessions
+// end when ctx is done, which outlives the HTTP server so shutdown can tell
+// users why.
+func New(ctx context.Context, handle Handler, opts ...Option) *Gateway {
+	g := &Gateway{
+		ctx:     ctx,
+		handle:  handle,
+		origins: make(map[string]bool),
+		logger:  slog.Default(),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(g)
+		}
+	}
+	g.upgrader = websocket.Upgrader{CheckOrigin: g.checkOrigin}
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	g.files = http.FileServer(http.FS(files))
+	return g
+}
+
+// ServeHTTP serves the client's files and, at Path, the WebSocket.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == Path {
+		g.serveWebSocket(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; connect-src 'self' ws: wss:; frame-ancestors 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	g.files.ServeHTTP(w, r)
+}
+
+func (g *Gateway) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered the request.
+		g.logger.Debug("webgateway: upgrade failed", "remote_addr", r.RemoteAddr, "err", err)
+		return
+	}
+	defer ws.Close()
+	ws.SetReadLimit(maxFrameSize)
+
+	c := &conn{ws: ws, done: make(chan struct{})}
+	user, err := g.signIn(ws, r.RemoteAddr)
+	if err != nil {
+		g.logger.Info("webgateway: sign-in failed", "remote_addr", r.RemoteAddr, "err", err)
+		_ = c.Send(Event{Type: EventError, Time: time.Now(), Error: err.Error()})
+		_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "sign-in failed"), time.Now().Add(writeTimeout))
+		return
+	}
+	c.user = user
+	_ = ws.SetReadDeadline(time.Now().Add(2 * pingInterval))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(2 * pingInterval))
+	})
+	go c.keepAlive()
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(g.ctx, cancel)
+	defer stop()
+	if err := g.handle(ctx, c); err != nil {
+		g.logger.Debug("webgateway: session ended", "user", user.Name, "session_id", user.SessionID, "err", err)
+	}
+}
+
+// signIn reads the browser's hello and checks its credentials.
+func (g *Gateway) signIn(ws *websocket.Conn, remoteAddr string) (User, error) {
+	_ = ws.SetReadDeadline(time.Now().Add(helloTimeout))
+	var hello Request
+	if err := ws.ReadJSON(&hello); err != nil {
+		return User{}, fmt.Errorf("webgateway: read hello: %w", err)
+	}
+	_ = ws.SetReadDeadline(time.Time{})
+	if hello.Type != RequestHello {
+		return User{}, fmt.Errorf("webgateway: want %s first, got %q", RequestHello, hello.Type)
+	}
+	id, err := sessionID()
+	if err != nil {
+		return User{}, err
+	}
+	user := User{RemoteAddr: remoteAddr, SessionID: id}
+	switch {
+	case hello.Token != "" && g.tokens != nil:
+		tok, err := g.tokens.Verify(strings.TrimSpace(hello.Token))
+		if err != nil {
+			return User{}, err
+		}
+		user.Name, user.AuthMethod, user.Account = tok.Owner, "token", true
+		user.ReadOnly = !tok.Scope.Allows(tokens.ScopeReadWrite)
+	case hello.Token == "" && g.anonymous && strings.TrimSpace(hello.User) != "":
+		user.Name = strings.TrimSpace(hello.User)
+		if g.checkName != nil {
+			if err := g.checkName(user.Name); err != nil {
+				return User{}, fmt.Errorf("webgateway: %s: %w", user.Name, err)
+			}
+		}
+	default:
+		return User{}, ErrSignInRequired
+	}
+	return user, nil
+}
+
+// checkOrigin allows pages served by the gateway and the configured origins.
+func (g *Gateway) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host) || g.origins[strings.ToLower(origin)]
+}
+
+// conn is a signed-in WebSocket connection.
+type conn struct {
+	ws   *websocket.Conn
+	user User
+
+	// mu serialises writers, which gorilla/websocket requires.
+	mu        sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *conn) User() User {
+	return c.user
+}
+
+func (c *conn) Receive() (string, error) {
+	for {
+		var req Request
+		if err := c.ws.ReadJSON(&req); err != nil {
+			select {
+			case <-c.done:
+				return "", io.EOF
+			default:
+			}
+			var closed *websocket.CloseError
+			if errors.As(err, &closed) {
+				return "", io.EOF
+			}
+			return "", err
+		}
+		if req.Type == RequestSend {
+			return req.Text, nil
+		}
+		if err := c.Send(Event{Type: EventError, Time: time.Now(), Error: fmt.Sprintf("unknown request type %q", req.Type)}); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (c *conn) Send(ev Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.ws.WriteJSON(ev)
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		_ = c.ws.Close()
+	})
+	return nil
+}
+
+// keepAlive pings the browser until the connection closes. A browser that
+// stops answering misses the read deadline its pongs extend.
+func (c *conn) keepAlive() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				_ = c.Close()
+				return
+			}
+		}
+	}
+}
+
+func sessionID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("webgateway: session id: %w", err)
+	}
+	return "web-" + hex.EncodeToString(b[:]), nil
+}
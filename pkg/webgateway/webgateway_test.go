@@ -0,0 +1,206 @@
+package webgateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/tokens"
+)
+
+// echo is a handler that answers every line with a message event.
+func echo(users chan<- User) Handler {
+	return func(ctx context.Context, c Conn) error {
+		users <- c.User()
+		if err := c.Send(Event{Type: EventReady, User: c.User().Name}); err != nil {
+			return err
+		}
+		for {
+			line, err := c.Receive()
+			if err != nil {
+				return err
+			}
+			if err := c.Send(Event{Type: EventMessage, From: c.User().Name, Body: line}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func startGateway(t *testing.T, opts ...Option) (*httptest.Server, chan User) {
+	t.Helper()
+	users := make(chan User, 1)
+	srv := httptest.NewServer(New(context.Background(), echo(users), opts...))
+	t.Cleanup(srv.Close)
+	return srv, users
+}
+
+func dial(t *testing.T, srv *httptest.Server, header http.Header) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+Path, header)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+func read(t *testing.T, ws *websocket.Conn) Event {
+	t.Helper()
+	var ev Event
+	require.NoError(t, ws.ReadJSON(&ev))
+	return ev
+}
+
+func TestTokenSignIn(t *testing.T) {
+	store := tokens.NewStore()
+	_, rw, err := store.Create("alice", tokens.ScopeReadWrite, "")
+	require.NoError(t, err)
+	_, ro, err := store.Create("bob", tokens.ScopeReadOnly, "")
+	require.NoError(t, err)
+	srv, users := startGateway(t, WithTokens(store))
+
+	ws := dial(t, srv, nil)
+	require.NoError(t, ws.WriteJSON(Request{Type: RequestHello, User: "mallory", Token: rw}))
+	user := <-users
+	require.Equal(t, "alice", user.Name, "the token names the user")
+	require.Equal(t, "token", user.AuthMethod)
+	require.True(t, user.Account)
+	require.False(t, user.ReadOnly)
+	require.True(t, strings.HasPrefix(user.SessionID, "web-"))
+	require.Equal(t, EventReady, read(t, ws).Type)
+
+	require.NoError(t, ws.WriteJSON(Request{Type: "bogus"}))
+	require.Contains(t, read(t, ws).Error, `unknown request type "bogus"`)
+	require.NoError(t, ws.WriteJSON(Request{Type: RequestSend, Text: "hi"}))
+	ev := read(t, ws)
+	require.Equal(t, EventMessage, ev.Type)
+	require.Equal(t, "hi", ev.Body)
+
+	ws = dial(t, srv, nil)
+	require.NoError(t, ws.WriteJSON(Request{Type: RequestHello, Token: ro}))
+	require.True(t, (<-users).ReadOnly)
+}
+
+func TestSignInRejected(t *testing.T) {
+	store := tokens.NewStore()
+	srv, _ := startGateway(t, WithTokens(store))
+
+	for _, hello := range []Request{
+		{Type: RequestHello, User: "anon"},
+		{Type: RequestHello, Token: "schat_nope_nope"},
+		{Type: RequestSend, Text: "hi"},
+	} {
+		ws := dial(t, srv, nil)
+		require.NoError(t, ws.WriteJSON(hello))
+		ev := read(t, ws)
+		require.Equal(t, EventError, ev.Type, hello)
+		require.NotEmpty(t, ev.Error)
+		_, _, err := ws.ReadMessage()
+		require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "%v", err)
+	}
+}
+
+func TestAnonymousSignIn(t *testing.T) {
+	srv, users := startGateway(t, WithAnonymous(true))
+	ws := dial(t, srv, nil)
+	require.NoError(t, ws.WriteJSON(Request{Type: RequestHello, User: "  guest  "}))
+	user := <-users
+	require.Equal(t, "guest", user.Name)
+	require.Empty(t, user.AuthMethod)
+	require.False(t, user.Account)
+}
+
+func TestAnonymousNameCheck(t *testing.T) {
+	store := tokens.NewStore()
+	_, tok, err := store.Create("root", tokens.ScopeReadWrite, "")
+	require.NoError(t, err)
+	srv, users := startGateway(t, WithAnonymous(true), WithTokens(store), WithNameCheck(func(name string) error {
+		if name == "root" {
+			return errors.New("the name belongs to an operator")
+		}
+		return nil
+	}))
+
+	ws := dial(t, srv, nil)
+	require.NoError(t, ws.WriteJSON(Request{Type: RequestHello, User: "root"}))
+	ev := read(t, ws)
+	require.Equal(t, EventError, ev.Type)
+	require.Contains(t, ev.Error, "the name belongs to an operator")
+	_, _, err = ws.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "%v", err)
+
+	ws = dial(t, srv, nil)
+	require.NoError(t, ws.WriteJSON(Request{Type: RequestHello, Token: tok}))
+	require.Equal(t, "root", (<-users).Name, "a token proves the name")
+}
+
+func TestCheckOrigin(t *testing.T) {
+	srv, _ := startGateway(t, WithAnonymous(true), WithOrigins("https://chat.example.com/"))
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + Path
+
+	for origin, ok := range map[string]bool{
+		srv.URL:                    true,
+		"https://chat.example.com": true,
+		"https://evil.example.com": false,
+	} {
+		ws, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {origin}})
+		if ok {
+			require.NoError(t, err, origin)
+			ws.Close()
+			continue
+		}
+		require.Error(t, err, origin)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestServesClient(t *testing.T) {
+	srv, _ := startGateway(t)
+
+	resp, err := http.Get(srv.URL + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, resp.Header.Get("Content-Security-Policy"), "default-src 'self'")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `<script src="app.js"`)
+
+	resp, err = http.Get(srv.URL + "/app.js")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Post(srv.URL+"/", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestReceiveReturnsEOFOnClose(t *testing.T) {
+	got := make(chan error, 1)
+	srv := httptest.NewServer(New(context.Background(), func(ctx context.Context, c Conn) error {
+		_, err := c.Receive()
+		got <- err
+		return err
+	}, WithAnonymous(true)))
+	defer srv.Close()
+
+	ws := dial(t, srv, nil)
+	require.NoError(t, ws.WriteJSON(Request{Type: RequestHello, User: "guest"}))
+	require.NoError(t, ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "")))
+	select {
+	case err := <-got:
+		require.ErrorIs(t, err, io.EOF)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Receive did not return")
+	}
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxBodySize bounds inbound request bodies.
+	maxBodySize = 64 << 10
+	// MaxTextLength bounds the text of an inbound message.
+	MaxTextLength = 4096
+	// MaxUserLength bounds the sender name of an inbound message.
+	MaxUserLength = 32
+)
+
+// ErrUnknownRoom is returned by a Poster for rooms that do not exist; the
+// handler answers it with 404.
+var ErrUnknownRoom = errors.New("webhook: unknown room")
+
+// Poster injects a validated inbound message into its room.
+type Poster func(Message) error
+
+// Handler serves the inbound endpoint: it accepts POSTed Message JSON signed
+// with secret and hands it to post. It answers 204 once the message is
+// posted, 401 for a missing or bad signature, 400 for an invalid message,
+// and 404 for an unknown room.
+func Handler(secret string, post Poster) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !Verify(secret, body, r.Header.Get(SignatureHeader), r.Header.Get("Authorization")) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var msg Message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			http.Error(w, fmt.Sprintf("invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		if msg, err = validate(msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch err := post(msg); {
+		case errors.Is(err, ErrUnknownRoom):
+			http.Error(w, fmt.Sprintf("unknown room %q", msg.Room), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+// validate checks an inbound message and fills in defaults.
+func validate(msg Message) (Message, error) {
+	msg.Room = strings.TrimPrefix(strings.TrimSpace(msg.Room), "#")
+	msg.User = strings.TrimSpace(msg.User)
+	msg.Text = strings.TrimSpace(msg.Text)
+	switch {
+	case msg.Room == "":
+		return msg, errors.New("room is required")
+	case msg.Text == "":
+		return msg, errors.New("text is required")
+	case len(msg.Text) > MaxTextLength:
+		return msg, fmt.Errorf("text is limited to %d bytes", MaxTextLength)
+	case len(msg.User) > MaxUserLength:
+		return msg, fmt.Errorf("user is limited to %d bytes", MaxUserLength)
+	case strings.IndexFunc(msg.User, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0:
+		return msg, errors.New("user cannot contain spaces or control characters")
+	}
+	if msg.User == "" {
+		msg.User = DefaultUser
+	}
+	return msg, nil
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"room":"dev","text":"hi"}`)
+	sig := Sign("s3cret", body)
+	require.True(t, strings.HasPrefix(sig, "sha256="))
+
+	require.True(t, Verify("s3cret", body, sig, ""))
+	require.False(t, Verify("other", body, sig, ""))
+	require.False(t, Verify("s3cret", []byte(`{"room":"ops"}`), sig, ""))
+	require.True(t, Verify("s3cret", body, "", "Bearer s3cret"))
+	require.False(t, Verify("s3cret", body, "", "Bearer wrong"))
+	require.False(t, Verify("s3cret", body, "", ""))
+	require.False(t, Verify("", body, Sign("", body), ""), "an empty secret authenticates nothing")
+}
+
+func TestHandler(t *testing.T) {
+	var posted []Message
+	handler := Handler("s3cret", func(msg Message) error {
+		if msg.Room != "dev" {
+			return ErrUnknownRoom
+		}
+		posted = append(posted, msg)
+		return nil
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		sign   bool
+		want   int
+	}{
+		{name: "posted", method: http.MethodPost, body: `{"room":"#dev","user":"ci","text":" build passed "}`, sign: true, want: http.StatusNoContent},
+		{name: "default user", method: http.MethodPost, body: `{"room":"dev","text":"deployed"}`, sign: true, want: http.StatusNoContent},
+		{name: "unsigned", method: http.MethodPost, body: `{"room":"dev","text":"hi"}`, want: http.StatusUnauthorized},
+		{name: "wrong method", method: http.MethodGet, want: http.StatusMethodNotAllowed},
+		{name: "bad json", method: http.MethodPost, body: `{`, sign: true, want: http.StatusBadRequest},
+		{name: "no text", method: http.MethodPost, body: `{"room":"dev"}`, sign: true, want: http.StatusBadRequest},
+		{name: "bad user", method: http.MethodPost, body: `{"room":"dev","user":"a b","text":"hi"}`, sign: true, want: http.StatusBadRequest},
+		{name: "unknown room", method: http.MethodPost, body: `{"room":"ops","text":"hi"}`, sign: true, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.sign {
+				req.Header.Set(SignatureHeader, Sign("s3cret", []byte(tt.body)))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+
+	require.Equal(t, []Message{
+		{Room: "dev", User: "ci", Text: "build passed"},
+		{Room: "dev", User: DefaultUser, Text: "deployed"},
+	}, posted)
+}
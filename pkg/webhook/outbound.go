@@ -0,0 +1,268 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ledzpl/schat/pkg/bridge"
+)
+
+// DefaultBackoff spaces out delivery retries to one failing endpoint.
+var DefaultBackoff = bridge.Backoff{
+	Initial:    time.Second,
+	Max:        time.Minute,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// TargetStatus is a snapshot of deliveries to one outbound webhook.
+type TargetStatus struct {
+	URL       string `json:"url"`
+	Delivered int64  `json:"delivered"`
+	// Failed counts events given up on after every retry.
+	Failed int64 `json:"failed"`
+	// Dropped counts events discarded because the queue was full.
+	Dropped   int64  `json:"dropped"`
+	Queued    int    `json:"queued"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Dispatcher POSTs events to outbound webhooks. Each URL has its own queue
+// and worker, so a slow or failing endpoint delays only its own deliveries;
+// events arrive at each endpoint in order.
+type Dispatcher struct {
+	secret    string
+	targets   []*target
+	client    *http.Client
+	backoff   bridge.Backoff
+	attempts  int
+	queueSize int
+	logger    *slog.Logger
+
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type target struct {
+	url   string
+	queue chan []byte
+
+	mu     sync.Mutex
+	status TargetStatus
+}
+
+// Option customises a Dispatcher.
+type Option func(*Dispatcher)
+
+// WithBackoff sets the delay policy between delivery attempts.
+func WithBackoff(b bridge.Backoff) Option {
+	return func(d *Dispatcher) {
+		if b.Initial > 0 {
+			d.backoff = b
+		}
+	}
+}
+
+// WithAttempts sets how many times an event is tried before it is dropped.
+func WithAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.attempts = n
+		}
+	}
+}
+
+// WithQueueSize sets how many events may wait per URL; further events are
+// dropped until the endpoint catches up.
+func WithQueueSize(n int) Option {
+	return func(d *Dispatcher) {
+		if n > 0 {
+			d.queueSize = n
+		}
+	}
+}
+
+// WithHTTPClient sets the client used for deliveries.
+func WithHTTPClient(c *http.Client) Option {
+	return func(d *Dispatcher) {
+		if c != nil {
+			d.client = c
+		}
+	}
+}
+
+// WithLogger sets the destination for delivery failure logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(d *Dispatcher) {
+		if logger != nil {
+			d.logger = logger
+		}
+	}
+}
+
+// NewDispatcher delivers events to urls, signing each body with secret.
+func NewDispatcher(secret string, urls []string, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		secret:    secret,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		backoff:   DefaultBackoff,
+		attempts:  5,
+		queueSize: 256,
+		logger:    slog.Default(),
+		sleep:     sleepContext,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(d)
+		}
+	}
+	for _, url := range urls {
+		d.targets = append(d.targets, &target{
+			url:    url,
+			queue:  make(chan []byte, d.queueSize),
+			status: TargetStatus{URL: url},
+		})
+	}
+	return d
+}
+
+// Send queues ev for every URL without blocking. A nil Dispatcher discards
+// it.
+func (d *Dispatcher) Send(ev Event) {
+	ev.V = Version
+	d.enqueue(ev)
+}
+
+// SendReply queues a prompt reply for every URL without blocking, with the
+// same retries as events. A nil Dispatcher discards it.
+func (d *Dispatcher) SendReply(r Reply) {
+	r.V = Version
+	d.enqueue(r)
+}
+
+func (d *Dispatcher) enqueue(v any) {
+	if d == nil || len(d.targets) == 0 {
+		return
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		d.logger.Error("webhook: encode event failed", "err", err)
+		return
+	}
+	for _, t := range d.targets {
+		select {
+		case t.queue <- body:
+		default:
+			t.update(func(st *TargetStatus) { st.Dropped++ })
+		}
+	}
+}
+
+// Run delivers queued events until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+	for _, t := range d.targets {
+		workers.Add(1)
+		go func(t *target) {
+			defer workers.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case body := <-t.queue:
+					d.deliver(ctx, t, body)
+				}
+			}
+		}(t)
+	}
+	workers.Wait()
+}
+
+// Status returns a snapshot of every outbound webhook.
+func (d *Dispatcher) Status() []TargetStatus {
+	if d == nil {
+		return nil
+	}
+	out := make([]TargetStatus, 0, len(d.targets))
+	for _, t := range d.targets {
+		t.mu.Lock()
+		st := t.status
+		t.mu.Unlock()
+		st.Queued = len(t.queue)
+		out = append(out, st)
+	}
+	return out
+}
+
+// deliver POSTs body to t, retrying with backoff on network errors, 429, and
+// 5xx responses. Other responses are final.
+func (d *Dispatcher) deliver(ctx context.Context, t *target, body []byte) {
+	var err error
+	for attempt := 1; attempt <= d.attempts; attempt++ {
+		var retry bool
+		if retry, err = d.post(ctx, t.url, body); err == nil {
+			t.update(func(st *TargetStatus) { st.Delivered++ })
+			return
+		}
+		if !retry || attempt == d.attempts {
+			break
+		}
+		if d.sleep(ctx, d.backoff.Delay(attempt)) != nil {
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	d.logger.Warn("webhook: delivery failed", "url", t.url, "err", err)
+	t.update(func(st *TargetStatus) {
+		st.Failed++
+		st.LastError = err.Error()
+	})
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying.
+func (d *Dispatcher) post(ctx context.Context, url string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(d.secret, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook: %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook: %s", resp.Status)
+	}
+}
+
+func (t *target) update(fn func(*TargetStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.status)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// endpoint records deliveries and answers with scripted status codes, then
+// 200 once the script runs out.
+type endpoint struct {
+	mu       sync.Mutex
+	statuses []int
+	events   []Event
+	attempts int
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.attempts++
+	if !Verify("s3cret", body, r.Header.Get(SignatureHeader), "") {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	status := http.StatusOK
+	if len(e.statuses) > 0 {
+		status, e.statuses = e.statuses[0], e.statuses[1:]
+	}
+	if status == http.StatusOK {
+		var ev Event
+		_ = json.Unmarshal(body, &ev)
+		e.events = append(e.events, ev)
+	}
+	w.WriteHeader(status)
+}
+
+func runDispatcher(t *testing.T, url string, opts ...Option) *Dispatcher {
+	t.Helper()
+	opts = append([]Option{WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)
+	d := NewDispatcher("s3cret", []string{url}, opts...)
+	d.sleep = func(context.Context, time.Duration) error { return nil }
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return d
+}
+
+func waitStatus(t *testing.T, d *Dispatcher, done func(TargetStatus) bool) TargetStatus {
+	t.Helper()
+	var st TargetStatus
+	require.Eventually(t, func() bool {
+		st = d.Status()[0]
+		return done(st)
+	}, 5*time.Second, 5*time.Millisecond)
+	return st
+}
+
+func TestDispatcherRetriesTransientFailures(t *testing.T) {
+	ep := &endpoint{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(ep)
+	defer srv.Close()
+
+	d := runDispatcher(t, srv.URL)
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	d.Send(Event{Room: "dev", Time: at, Kind: "chat", From: "alice", Body: "hi"})
+
+	st := waitStatus(t, d, func(st TargetStatus) bool { return st.Delivered == 1 })
+	require.Zero(t, st.Failed)
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	require.Equal(t, 3, ep.attempts)
+	require.Equal(t, []Event{{V: Version, Room: "dev", Time: at, Kind: "chat", From: "alice", Body: "hi"}}, ep.events)
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+	}{
+		{name: "client error is final", statuses: []int{http.StatusBadRequest}, attempts: 1},
+		{name: "retries exhausted", statuses: []int{500, 500, 500, 500}, attempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := &endpoint{statuses: tt.statuses}
+			srv := httptest.NewServer(ep)
+			defer srv.Close()
+
+			d := runDispatcher(t, srv.URL, WithAttempts(3))
+			d.Send(Event{Room: "dev", Kind: "system", Body: "alice joined the chat"})
+
+			st := waitStatus(t, d, func(st TargetStatus) bool { return st.Failed == 1 })
+			require.Zero(t, st.Delivered)
+			require.NotEmpty(t, st.LastError)
+			ep.mu.Lock()
+			defer ep.mu.Unlock()
+			require.Equal(t, tt.attempts, ep.attempts)
+		})
+	}
+}
+
+func TestDispatcherDropsWhenQueueFull(t *testing.T) {
+	d := NewDispatcher("s3cret", []string{"http://127.0.0.1:1"}, WithQueueSize(2))
+	for i := 0; i < 5; i++ {
+		d.Send(Event{Room: "dev", Body: "flood"})
+	}
+	st := d.Status()[0]
+	require.Equal(t, 2, st.Queued)
+	require.EqualValues(t, 3, st.Dropped)
+
+	var nilDispatcher *Dispatcher
+	nilDispatcher.Send(Event{})
+	require.Nil(t, nilDispatcher.Status())
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Prompt limits and defaults.
+const (
+	// DefaultPromptTTL is how long a prompt stays open when it sets no TTL.
+	DefaultPromptTTL = time.Hour
+	// MaxPromptTTL bounds how long a prompt may stay open.
+	MaxPromptTTL = 7 * 24 * time.Hour
+	// MaxRefLength bounds the reference a system attaches to a prompt.
+	MaxRefLength = 256
+)
+
+// Decisions reported in a Reply.
+const (
+	DecisionApprove = "approve"
+	DecisionDeny    = "deny"
+	// DecisionExpired is reported when nobody answered before the TTL.
+	DecisionExpired = "expired"
+)
+
+// ErrUnknownSystem is returned by a PromptPoster for systems that are not
+// configured or may not prompt the room; the handler answers it with 403.
+var ErrUnknownSystem = errors.New("webhook: system may not prompt this room")
+
+// Prompt is the JSON body accepted by the prompt endpoint: a question posted
+// into a room, answered by users with /approve or /deny. The answer is POSTed
+// to the system's configured callback as a Reply.
+type Prompt struct {
+	// System names the configured system posting the prompt.
+	System string `json:"system"`
+	Room   string `json:"room"`
+	// User is the name the prompt is shown from; empty uses the system name.
+	User string `json:"user"`
+	Text string `json:"text"`
+	// Ref is echoed in the Reply so the system can match it to its request.
+	Ref string `json:"ref,omitempty"`
+	// TTL is how long the prompt stays open, e.g. "30m"; empty uses
+	// DefaultPromptTTL.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// Lifetime returns how long the prompt stays open, falling back to
+// DefaultPromptTTL when TTL is empty or invalid.
+func (p Prompt) Lifetime() time.Duration {
+	ttl, err := time.ParseDuration(p.TTL)
+	if err != nil || ttl <= 0 || ttl > MaxPromptTTL {
+		return DefaultPromptTTL
+	}
+	return ttl
+}
+
+// PromptReceipt answers an accepted prompt.
+type PromptReceipt struct {
+	// ID is what users type to answer, e.g. "/approve 42".
+	ID      int64     `json:"id"`
+	Expires time.Time `json:"expires"`
+}
+
+// Reply is POSTed to a system's callback once a prompt is answered or
+// expires, signed like every outbound delivery.
+type Reply struct {
+	V      int    `json:"v"`
+	ID     int64  `json:"id"`
+	Ref    string `json:"ref,omitempty"`
+	System string `json:"system"`
+	Room   string `json:"room"`
+	// Decision is DecisionApprove, DecisionDeny, or DecisionExpired.
+	Decision string `json:"decision"`
+	// User answered the prompt; empty when it expired.
+	User string `json:"user,omitempty"`
+	// AuthMethod is how User signed in, e.g. "publickey".
+	AuthMethod string    `json:"auth_method,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// PromptPoster posts a validated prompt into its room.
+type PromptPoster func(Prompt) (PromptReceipt, error)
+
+// PromptHandler serves the prompt endpoint: it accepts POSTed Prompt JSON
+// signed with secret and hands it to post. It answers 201 with a
+// PromptReceipt, 401 for a missing or bad signature, 400 for an invalid
+// prompt, 403 for a system that may not prompt the room, and 404 for an
+// unknown room.
+func PromptHandler(secret string, post PromptPoster) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !Verify(secret, body, r.Header.Get(SignatureHeader), r.Header.Get("Authorization")) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var p Prompt
+		if err := json.Unmarshal(body, &p); err != nil {
+			http.Error(w, fmt.Sprintf("invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		if p, err = validatePrompt(p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		receipt, err := post(p)
+		switch {
+		case errors.Is(err, ErrUnknownSystem):
+			http.Error(w, fmt.Sprintf("system %q may not prompt room %q", p.System, p.Room), http.StatusForbidden)
+		case errors.Is(err, ErrUnknownRoom):
+			http.Error(w, fmt.Sprintf("unknown room %q", p.Room), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(receipt)
+		}
+	})
+}
+
+// validatePrompt checks a prompt and fills in defaults.
+func validatePrompt(p Prompt) (Prompt, error) {
+	p.System = strings.TrimSpace(p.System)
+	if p.System == "" {
+		return p, errors.New("system is required")
+	}
+	if strings.TrimSpace(p.User) == "" {
+		p.User = p.System
+	}
+	msg, err := validate(Message{Room: p.Room, User: p.User, Text: p.Text})
+	if err != nil {
+		return p, err
+	}
+	p.Room, p.User, p.Text = msg.Room, msg.User, msg.Text
+	if len(p.Ref) > MaxRefLength {
+		return p, fmt.Errorf("ref is limited to %d bytes", MaxRefLength)
+	}
+	if p.TTL != "" {
+		if ttl, err := time.ParseDuration(p.TTL); err != nil || ttl <= 0 || ttl > MaxPromptTTL {
+			return p, fmt.Errorf("ttl %q must be a duration between 1s and %s", p.TTL, MaxPromptTTL)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptHandler(t *testing.T) {
+	expires := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	var posted []Prompt
+	handler := PromptHandler("s3cret", func(p Prompt) (PromptReceipt, error) {
+		switch {
+		case p.System != "deploy":
+			return PromptReceipt{}, ErrUnknownSystem
+		case p.Room != "ops":
+			return PromptReceipt{}, ErrUnknownRoom
+		}
+		posted = append(posted, p)
+		return PromptReceipt{ID: 42, Expires: expires}, nil
+	})
+
+	tests := []struct {
+		name string
+		body string
+		sign bool
+		want int
+	}{
+		{name: "posted", body: `{"system":"deploy","room":"#ops","text":"Deploy 1.2.3?","ref":"run-7","ttl":"30m"}`, sign: true, want: http.StatusCreated},
+		{name: "unsigned", body: `{"system":"deploy","room":"ops","text":"Deploy?"}`, want: http.StatusUnauthorized},
+		{name: "no system", body: `{"room":"ops","text":"Deploy?"}`, sign: true, want: http.StatusBadRequest},
+		{name: "bad ttl", body: `{"system":"deploy","room":"ops","text":"Deploy?","ttl":"forever"}`, sign: true, want: http.StatusBadRequest},
+		{name: "ttl too long", body: `{"system":"deploy","room":"ops","text":"Deploy?","ttl":"1000h"}`, sign: true, want: http.StatusBadRequest},
+		{name: "ref too long", body: `{"system":"deploy","room":"ops","text":"Deploy?","ref":"` + strings.Repeat("x", MaxRefLength+1) + `"}`, sign: true, want: http.StatusBadRequest},
+		{name: "unknown system", body: `{"system":"billing","room":"ops","text":"Pay?"}`, sign: true, want: http.StatusForbidden},
+		{name: "unknown room", body: `{"system":"deploy","room":"dev","text":"Deploy?"}`, sign: true, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook/prompt", strings.NewReader(tt.body))
+			if tt.sign {
+				req.Header.Set(SignatureHeader, Sign("s3cret", []byte(tt.body)))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+
+	require.Len(t, posted, 1)
+	p := posted[0]
+	require.Equal(t, "ops", p.Room)
+	require.Equal(t, "deploy", p.User, "the system name is the default sender")
+	require.Equal(t, "run-7", p.Ref)
+	require.Equal(t, 30*time.Minute, p.Lifetime())
+	require.Equal(t, DefaultPromptTTL, Prompt{}.Lifetime())
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/prompt", strings.NewReader(`{"system":"deploy","room":"ops","text":"again"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var receipt PromptReceipt
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&receipt))
+	require.Equal(t, PromptReceipt{ID: 42, Expires: expires}, receipt)
+}
+
+func TestDispatcherSendsSignedReplies(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		replies []Reply
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify("s3cret", body, r.Header.Get(SignatureHeader), "") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var reply Reply
+		require.NoError(t, json.Unmarshal(body, &reply))
+		mu.Lock()
+		replies = append(replies, reply)
+		mu.Unlock()
+	}))
+	defer server.Close()
+	d := runDispatcher(t, server.URL)
+
+	d.SendReply(Reply{ID: 42, Ref: "run-7", System: "deploy", Room: "ops", Decision: DecisionApprove, User: "alice"})
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(replies) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+	require.Equal(t, Reply{V: Version, ID: 42, Ref: "run-7", System: "deploy", Room: "ops", Decision: DecisionApprove, User: "alice"}, replies[0])
+	require.Equal(t, int64(1), d.Status()[0].Delivered)
+}
@@ -0,0 +1,64 @@
+// Package webhook connects rooms to plain HTTP integrations: an inbound
+// endpoint that lets CI bots and alerting post messages into a room, and a
+// dispatcher that POSTs every room broadcast to configured URLs. Both
+// directions authenticate with a shared secret.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body keyed with
+// the shared secret, prefixed with "sha256=".
+const SignatureHeader = "X-Schat-Signature"
+
+// Version is the schema version of Event.
+const Version = 1
+
+// Message is the JSON body accepted by the inbound endpoint.
+type Message struct {
+	Room string `json:"room"`
+	// User is the name the message is shown from; empty uses DefaultUser.
+	User string `json:"user"`
+	Text string `json:"text"`
+}
+
+// DefaultUser is the sender name of inbound messages that do not set one.
+const DefaultUser = "webhook"
+
+// Event is the JSON body POSTed to outbound webhooks for each broadcast.
+type Event struct {
+	V    int       `json:"v"`
+	Room string    `json:"room"`
+	Time time.Time `json:"time"`
+	// Kind is the message kind, e.g. "chat", "action", or "system".
+	Kind string `json:"kind"`
+	From string `json:"from,omitempty"`
+	Body string `json:"body"`
+}
+
+// Sign returns the SignatureHeader value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether header is a valid signature of body, or a bearer
+// Authorization value holding the secret itself for clients such as curl
+// that cannot easily sign.
+func Verify(secret string, body []byte, signature, authorization string) bool {
+	if secret == "" {
+		return false
+	}
+	if signature != "" {
+		return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+	}
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
@@ -0,0 +1,235 @@
+// Package wordfilter finds listed words, such as profanity, in chat messages
+// so they can be masked or the message blocked. Words match whole words
+// case-insensitively; an entry ending in "*" matches every word starting with
+// the rest, which also covers inflected forms such as Korean particles.
+package wordfilter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Action is what happens to a message containing a listed word.
+type Action int
+
+const (
+	// Mask replaces every letter of a listed word with '*'.
+	Mask Action = iota
+	// Block rejects the whole message.
+	Block
+)
+
+var actionNames = map[Action]string{
+	Mask:  "mask",
+	Block: "block",
+}
+
+// String returns the action's configuration name.
+func (a Action) String() string {
+	if name, ok := actionNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ParseAction resolves an action by name; empty means Mask.
+func ParseAction(name string) (Action, error) {
+	if name == "" {
+		return Mask, nil
+	}
+	for action, n := range actionNames {
+		if strings.EqualFold(name, n) {
+			return action, nil
+		}
+	}
+	return 0, fmt.Errorf("wordfilter: unknown action %q (want mask or block)", name)
+}
+
+// List is an immutable set of words to find.
+type List struct {
+	words    map[string]bool
+	prefixes []string
+}
+
+// NewList builds a list from words. Entries must be single words, optionally
+// ending in "*"; blank entries are ignored.
+func NewList(words []string) (*List, error) {
+	l := &List{words: make(map[string]bool)}
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		prefix := strings.HasSuffix(w, "*")
+		w = strings.TrimSuffix(w, "*")
+		if w == "" {
+			if prefix {
+				return nil, errors.New("wordfilter: \"*\" alone would match every word")
+			}
+			continue
+		}
+		if strings.IndexFunc(w, func(r rune) bool { return !isWordRune(r) }) >= 0 {
+			return nil, fmt.Errorf("wordfilter: %q is not a single word", w)
+		}
+		if prefix {
+			l.prefixes = append(l.prefixes, w)
+		} else {
+			l.words[w] = true
+		}
+	}
+	return l, nil
+}
+
+// ReadWords reads one word per line from r. Blank lines and lines starting
+// with "#" are skipped.
+func ReadWords(r io.Reader) ([]string, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("wordfilter: %w", err)
+	}
+	return words, nil
+}
+
+// Len returns the number of entries in the list.
+func (l *List) Len() int {
+	return len(l.words) + len(l.prefixes)
+}
+
+// Contains reports whether text has any listed word.
+func (l *List) Contains(text string) bool {
+	found := false
+	l.scan(text, func(int, int) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// Mask replaces every letter of each listed word in text with '*'.
+func (l *List) Mask(text string) string {
+	var b strings.Builder
+	last := 0
+	l.scan(text, func(start, end int) bool {
+		b.WriteString(text[last:start])
+		b.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[start:end])))
+		last = end
+		return true
+	})
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// scan calls fn with the byte range of each listed word in text until fn
+// returns false.
+func (l *List) scan(text string, fn func(start, end int) bool) {
+	start := -1
+	for i, r := range text + " " {
+		switch {
+		case isWordRune(r):
+			if start < 0 {
+				start = i
+			}
+		case start >= 0:
+			if l.match(strings.ToLower(text[start:i])) && !fn(start, i) {
+				return
+			}
+			start = -1
+		}
+	}
+}
+
+func (l *List) match(word string) bool {
+	if l.words[word] {
+		return true
+	}
+	for _, p := range l.prefixes {
+		if strings.HasPrefix(word, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// Filter is a List built from a word file and fixed words, which can be
+// reloaded while in use. It is safe for concurrent use.
+type Filter struct {
+	file   string
+	words  []string
+	action Action
+
+	mu   sync.RWMutex
+	list *List
+}
+
+// New loads a filter from file, if not empty, and words.
+func New(file string, words []string, action Action) (*Filter, error) {
+	f := &Filter{file: file, words: words, action: action}
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload re-reads the word file and returns the new number of entries. The
+// previous list stays in use when reading fails.
+func (f *Filter) Reload() (int, error) {
+	words := append([]string(nil), f.words...)
+	if f.file != "" {
+		file, err := os.Open(f.file)
+		if err != nil {
+			return 0, fmt.Errorf("wordfilter: %w", err)
+		}
+		defer file.Close()
+		more, err := ReadWords(file)
+		if err != nil {
+			return 0, err
+		}
+		words = append(words, more...)
+	}
+	list, err := NewList(words)
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	f.list = list
+	f.mu.Unlock()
+	return list.Len(), nil
+}
+
+// Action returns what happens to messages with a listed word.
+func (f *Filter) Action() Action {
+	return f.action
+}
+
+// File returns the word file, or "" when the words come only from
+// configuration.
+func (f *Filter) File() string {
+	return f.file
+}
+
+// List returns the words currently in effect.
+func (f *Filter) List() *List {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.list
+}
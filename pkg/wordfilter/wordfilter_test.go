@@ -0,0 +1,85 @@
+package wordfilter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListMasksWholeWords(t *testing.T) {
+	list, err := NewList([]string{"darn", " Heck ", "", "바보*"})
+	require.NoError(t, err)
+	require.Equal(t, 3, list.Len())
+
+	cases := map[string]string{
+		"darn it":             "**** it",
+		"DARN, heck!":         "****, ****!",
+		"darning needles":     "darning needles",
+		"undarn":              "undarn",
+		"what the heck":       "what the ****",
+		"너 바보야 바보":            "너 *** **",
+		"nothing to see":      "nothing to see",
+		"darn_it is one word": "darn_it is one word",
+		"heck\tdarn\nheck":    "****\t****\n****",
+		"édarn stays intact": "édarn stays intact",
+	}
+	for in, want := range cases {
+		require.Equal(t, want, list.Mask(in), in)
+		require.Equal(t, want != in, list.Contains(in), in)
+	}
+}
+
+func TestNewListRejectsPhrases(t *testing.T) {
+	_, err := NewList([]string{"two words"})
+	require.EqualError(t, err, `wordfilter: "two words" is not a single word`)
+	_, err = NewList([]string{"*"})
+	require.Error(t, err)
+}
+
+func TestReadWordsSkipsComments(t *testing.T) {
+	words, err := ReadWords(strings.NewReader("# profanity\ndarn\n\n  heck  \n#gosh\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"darn", "heck"}, words)
+}
+
+func TestParseAction(t *testing.T) {
+	for name, want := range map[string]Action{"": Mask, "mask": Mask, "BLOCK": Block} {
+		got, err := ParseAction(name)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	_, err := ParseAction("delete")
+	require.EqualError(t, err, `wordfilter: unknown action "delete" (want mask or block)`)
+	require.Equal(t, "block", Block.String())
+}
+
+func TestFilterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(path, []byte("darn\n"), 0o600))
+
+	f, err := New(path, []string{"heck"}, Block)
+	require.NoError(t, err)
+	require.Equal(t, Block, f.Action())
+	require.Equal(t, path, f.File())
+	require.True(t, f.List().Contains("darn"))
+	require.False(t, f.List().Contains("gosh"))
+
+	require.NoError(t, os.WriteFile(path, []byte("gosh\n"), 0o600))
+	n, err := f.Reload()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.True(t, f.List().Contains("gosh"))
+	require.True(t, f.List().Contains("heck"), "configured words survive a reload")
+	require.False(t, f.List().Contains("darn"))
+
+	require.NoError(t, os.WriteFile(path, []byte("bad phrase\n"), 0o600))
+	_, err = f.Reload()
+	require.Error(t, err)
+	require.True(t, f.List().Contains("gosh"), "a failed reload keeps the old list")
+
+	_, err = New(filepath.Join(t.TempDir(), "missing"), nil, Mask)
+	require.Error(t, err)
+}
@@ -0,0 +1,124 @@
+//go:build conformance
+
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledzpl/schat/pkg/botclient"
+)
+
+func TestShellWithoutPTY(t *testing.T) {
+	h := newHarness(t)
+	cmd := h.command("carol", []string{"-T"})
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	_, err = io.WriteString(stdin, "hello without a pty\n")
+	require.NoError(t, err)
+	h.expectMessage("carol", "hello without a pty")
+	_, err = io.WriteString(stdin, "\x04") // ctrl+d leaves
+	require.NoError(t, err)
+	require.NoError(t, wait(t, cmd))
+
+	require.Len(t, h.requestsOf("carol", "shell"), 1)
+	require.Empty(t, h.requestsOf("carol", "pty-req"))
+}
+
+func TestShellEOF(t *testing.T) {
+	h := newHarness(t)
+	cmd := h.command("carol", []string{"-T"})
+	cmd.Stdin = bytes.NewBufferString("hello then eof\n")
+	require.NoError(t, cmd.Start())
+
+	h.expectMessage("carol", "hello then eof")
+	require.NoError(t, wait(t, cmd), "closing stdin ends the session cleanly")
+}
+
+func TestExec(t *testing.T) {
+	h := newHarness(t)
+	content := []byte("conformance\nover exec\n")
+
+	// Uploads are shared in a room the user is chatting in.
+	shell := h.command("erin", []string{"-T"})
+	stdin, err := shell.StdinPipe()
+	require.NoError(t, err)
+	require.NoError(t, shell.Start())
+	defer func() {
+		_ = stdin.Close()
+		_ = wait(t, shell)
+	}()
+	_, err = io.WriteString(stdin, "sharing notes\n")
+	require.NoError(t, err)
+	h.expectMessage("erin", "sharing notes")
+
+	upload := h.command("erin", nil, "upload", "notes.txt")
+	upload.Stdin = bytes.NewReader(content)
+	out, err := upload.Output()
+	require.NoError(t, err)
+	id := regexp.MustCompile(`as (\S+) until`).FindSubmatch(out)
+	require.NotNil(t, id, "upload prints the file ID: %s", out)
+
+	out, err = h.command("erin", nil, "download", string(id[1])).Output()
+	require.NoError(t, err)
+	require.Equal(t, content, out)
+
+	var exit *exec.ExitError
+	_, err = h.command("erin", nil, "download").Output()
+	require.True(t, errors.As(err, &exit), "bad usage fails: %v", err)
+	require.NotZero(t, exit.ExitCode())
+	require.Contains(t, string(exit.Stderr), "usage: upload")
+}
+
+func TestSubsystem(t *testing.T) {
+	h := newHarness(t)
+	cmd := h.command("frank", []string{"-s", "-o", "SetEnv=" + botclient.ProtocolEnv + "=1"}, botclient.Subsystem)
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	events := json.NewDecoder(bufio.NewReader(stdout))
+
+	var ev botclient.Event
+	require.NoError(t, events.Decode(&ev))
+	require.Equal(t, botclient.EventReady, ev.Type)
+	require.Equal(t, "frank", ev.User)
+
+	require.NoError(t, json.NewEncoder(stdin).Encode(botclient.Request{ID: 1, Type: botclient.RequestSend, Text: "hello from a subsystem"}))
+	h.expectMessage("frank", "hello from a subsystem")
+	for ev.Type != botclient.EventOK {
+		require.NoError(t, events.Decode(&ev))
+		require.NotEqual(t, botclient.EventError, ev.Type, ev.Error)
+	}
+	require.EqualValues(t, 1, ev.ID)
+
+	require.NoError(t, stdin.Close())
+	require.NoError(t, wait(t, cmd))
+	require.Len(t, h.requestsOf("frank", "env"), 1, "SetEnv reaches the server")
+}
+
+func TestUnknownSubsystem(t *testing.T) {
+	h := newHarness(t)
+	cmd := h.command("grace", []string{"-s"}, "sftp")
+	err := wait(t, start(t, cmd))
+	var exit *exec.ExitError
+	require.True(t, errors.As(err, &exit), "an unknown subsystem is refused: %v", err)
+	require.Len(t, h.requestsOf("grace", "subsystem"), 1)
+}
+
+func start(t *testing.T, cmd *exec.Cmd) *exec.Cmd {
+	t.Helper()
+	require.NoError(t, cmd.Start())
+	return cmd
+}
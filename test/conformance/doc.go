@@ -0,0 +1,10 @@
+// Package conformance checks that the server works with the OpenSSH client
+// users actually run: shells with and without a pty, window changes, exec
+// commands, and subsystems. The tests shell out to ssh and only build with
+// the conformance tag:
+//
+//	go test -tags conformance ./test/conformance/
+//
+// SCHAT_SSH names another ssh binary, and run.sh repeats the suite in
+// containers shipping different OpenSSH releases.
+package conformance
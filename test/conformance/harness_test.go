@@ -0,0 +1,218 @@
+//go:build conformance
+
+package conformance
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ledzpl/schat/internal/chat"
+	"github.com/ledzpl/schat/pkg/botclient"
+	"github.com/ledzpl/schat/pkg/fileshare"
+	"github.com/ledzpl/schat/pkg/sshserver"
+)
+
+// waitFor bounds how long a test waits for the server or the client to act.
+const waitFor = 10 * time.Second
+
+// request is a channel request the server received.
+type request struct {
+	User    string
+	Type    string
+	Payload []byte
+}
+
+// harness runs a server with the default policy and a bot watching the lobby.
+type harness struct {
+	t       *testing.T
+	ssh     string
+	port    string
+	keyFile string
+
+	mu       sync.Mutex
+	requests []request
+
+	messages chan botclient.Message
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	binary := os.Getenv("SCHAT_SSH")
+	if binary == "" {
+		binary = "ssh"
+	}
+	binary, err := exec.LookPath(binary)
+	if err != nil {
+		t.Skipf("no OpenSSH client: %v", err)
+	}
+	if out, err := exec.Command(binary, "-V").CombinedOutput(); err == nil {
+		t.Logf("client: %s", strings.TrimSpace(string(out)))
+	}
+
+	dir := t.TempDir()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600))
+	userKey, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	keysFile := filepath.Join(dir, "authorized_keys")
+	require.NoError(t, os.WriteFile(keysFile, ssh.MarshalAuthorizedKey(userKey.PublicKey()), 0o600))
+	keys, err := sshserver.LoadAuthorizedKeys(keysFile)
+	require.NoError(t, err)
+
+	hostKey, err := sshserver.EphemeralSigner()
+	require.NoError(t, err)
+	policy, err := sshserver.ParsePolicy(sshserver.DefaultPolicy)
+	require.NoError(t, err)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := sshserver.New("127.0.0.1:0", hostKey, logger, sshserver.WithPolicy(policy), sshserver.WithAuthenticators(keys))
+	rooms := chat.NewRoomManager(chat.WithRoomOptions(chat.WithLogger(logger), chat.WithFiles(fileshare.New(1<<20, 4<<20, time.Hour))))
+
+	h := &harness{t: t, ssh: binary, keyFile: keyFile, messages: make(chan botclient.Message, 64)}
+	listener, err := server.Listen()
+	require.NoError(t, err)
+	_, h.port, _ = net.SplitHostPort(listener.Addr().String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		_ = server.Serve(ctx, listener, func(ctx context.Context, conn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) error {
+			return chat.HandleSession(ctx, rooms.Lobby(), conn, channel, h.record(conn.User(), requests))
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-served
+	})
+
+	bot, err := botclient.Connect(ctx, listener.Addr().String(), "watcher",
+		botclient.WithPublicKey(userKey), botclient.WithHostKeyCallback(ssh.FixedHostKey(hostKey.PublicKey())))
+	require.NoError(t, err)
+	t.Cleanup(func() { bot.Close() })
+	bot.OnMessage(func(msg botclient.Message) {
+		if msg.Kind != botclient.KindChat {
+			return
+		}
+		select {
+		case h.messages <- msg:
+		default:
+			t.Logf("dropped message %q from %s", msg.Text, msg.From)
+		}
+	})
+	return h
+}
+
+// record passes requests on to the session, keeping a copy of each.
+func (h *harness) record(user string, requests <-chan *ssh.Request) <-chan *ssh.Request {
+	out := make(chan *ssh.Request)
+	go func() {
+		defer close(out)
+		for req := range requests {
+			h.mu.Lock()
+			h.requests = append(h.requests, request{User: user, Type: req.Type, Payload: req.Payload})
+			h.mu.Unlock()
+			out <- req
+		}
+	}()
+	return out
+}
+
+// requestsOf returns the requests of user's sessions with the given type.
+func (h *harness) requestsOf(user, typ string) []request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var found []request
+	for _, req := range h.requests {
+		if req.User == user && req.Type == typ {
+			found = append(found, req)
+		}
+	}
+	return found
+}
+
+// awaitRequest waits for the nth request of the given type from user's
+// sessions, counting from one.
+func (h *harness) awaitRequest(user, typ string, n int) request {
+	h.t.Helper()
+	deadline := time.Now().Add(waitFor)
+	for time.Now().Before(deadline) {
+		if found := h.requestsOf(user, typ); len(found) >= n {
+			return found[n-1]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	h.t.Fatalf("no %s request #%d from %s", typ, n, user)
+	return request{}
+}
+
+// command returns an ssh invocation for user with the given options before the
+// host and the remote command after it. No config file, agent, or known hosts
+// file of the machine running the tests is used.
+func (h *harness) command(user string, opts []string, remote ...string) *exec.Cmd {
+	args := []string{
+		"-F", "/dev/null",
+		"-p", h.port,
+		"-l", user,
+		"-i", h.keyFile,
+		"-o", "IdentitiesOnly=yes",
+		"-o", "IdentityAgent=none",
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "LogLevel=ERROR",
+	}
+	args = append(args, opts...)
+	args = append(args, "127.0.0.1")
+	args = append(args, remote...)
+	return exec.Command(h.ssh, args...)
+}
+
+// expectMessage waits for the watcher to see text from user.
+func (h *harness) expectMessage(from, text string) {
+	h.t.Helper()
+	timeout := time.After(waitFor)
+	for {
+		select {
+		case msg := <-h.messages:
+			if msg.From == from && msg.Text == text {
+				return
+			}
+		case <-timeout:
+			h.t.Fatalf("no message %q from %s", text, from)
+		}
+	}
+}
+
+// wait waits for cmd to exit, killing it after waitFor.
+func wait(t *testing.T, cmd *exec.Cmd) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(waitFor):
+		_ = cmd.Process.Kill()
+		t.Fatalf("%s did not exit", cmd)
+		return nil
+	}
+}
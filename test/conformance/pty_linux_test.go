@@ -0,0 +1,76 @@
+//go:build conformance && linux
+
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sys/unix"
+)
+
+func TestShellWithPTY(t *testing.T) {
+	h := newHarness(t)
+	master, tty := openPTY(t)
+	resize(t, master, 80, 24)
+
+	cmd := h.command("dave", []string{"-t"})
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	// ssh reads the window size from its controlling terminal and is sent
+	// SIGWINCH when it changes.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	require.NoError(t, cmd.Start())
+	require.NoError(t, tty.Close())
+	go func() { _, _ = io.Copy(io.Discard, master) }()
+
+	var pty struct {
+		Term                         string
+		Columns, Rows, Width, Height uint32
+		Modes                        string
+	}
+	require.NoError(t, ssh.Unmarshal(h.awaitRequest("dave", "pty-req", 1).Payload, &pty))
+	require.Equal(t, "xterm-256color", pty.Term)
+	require.Equal(t, [2]uint32{80, 24}, [2]uint32{pty.Columns, pty.Rows})
+	h.awaitRequest("dave", "shell", 1)
+
+	_, err := io.WriteString(master, "hello from a pty\r")
+	require.NoError(t, err)
+	h.expectMessage("dave", "hello from a pty")
+
+	resize(t, master, 120, 40)
+	var window struct{ Columns, Rows, Width, Height uint32 }
+	require.NoError(t, ssh.Unmarshal(h.awaitRequest("dave", "window-change", 1).Payload, &window))
+	require.Equal(t, [2]uint32{120, 40}, [2]uint32{window.Columns, window.Rows})
+
+	_, err = io.WriteString(master, "\x04") // ctrl+d leaves
+	require.NoError(t, err)
+	require.NoError(t, wait(t, cmd))
+}
+
+// openPTY allocates a pseudo-terminal, returning its master and the terminal
+// to hand to ssh.
+func openPTY(t *testing.T) (master, tty *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { master.Close() })
+	fd := int(master.Fd())
+	require.NoError(t, unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0))
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	require.NoError(t, err)
+	tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	require.NoError(t, err)
+	return master, tty
+}
+
+// resize sets the terminal size, which signals the process group in front.
+func resize(t *testing.T, master *os.File, cols, rows uint16) {
+	t.Helper()
+	require.NoError(t, unix.IoctlSetWinsize(int(master.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Col: cols, Row: rows}))
+}
@@ -0,0 +1,29 @@
+#!/bin/sh
+# Runs the conformance suite in containers shipping different OpenSSH
+# releases. Pass images to override the matrix:
+#
+#	test/conformance/run.sh golang:1.23-bookworm
+set -eu
+
+root=$(cd "$(dirname "$0")/../.." && pwd)
+engine=${CONTAINER_ENGINE:-docker}
+
+if [ "$#" -eq 0 ]; then
+	# OpenSSH 8.4, 9.2, and 9.7.
+	set -- golang:1.23-bullseye golang:1.23-bookworm golang:1.23-alpine3.20
+fi
+
+failed=""
+for image in "$@"; do
+	tag="schat-conformance:$(echo "$image" | tr ':/' '--')"
+	echo "==> $image"
+	if ! "$engine" build -q -f "$root/test/conformance/Dockerfile" --build-arg "GO_IMAGE=$image" -t "$tag" "$root" >/dev/null ||
+		! "$engine" run --rm "$tag"; then
+		failed="$failed $image"
+	fi
+done
+
+if [ -n "$failed" ]; then
+	echo "conformance failed on:$failed" >&2
+	exit 1
+fi